@@ -0,0 +1,832 @@
+package hydrocarbon
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	activityContentType = "application/activity+json"
+	activityPublic      = "https://www.w3.org/ns/activitystreams#Public"
+
+	activityDeliveryInterval = 5 * time.Minute
+	// posts written this recently are left for the next delivery, their
+	// transactions may not have committed yet
+	activityDeliveryLag = time.Minute
+	// a burst of posts larger than this only delivers the newest, the rest
+	// are still in the outbox
+	maxDeliveredPosts = 50
+	outboxPageSize    = 20
+	maxInboxSize      = 64 * 1024
+)
+
+var activityContext = []string{
+	"https://www.w3.org/ns/activitystreams",
+	"https://w3id.org/security/v1",
+}
+
+// privateNets are the ranges remote actors are never fetched or delivered to
+// from, besides loopback and link-local addresses
+var privateNets = parseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"fc00::/7",
+)
+
+// A PublicFolder is a folder published as an ActivityPub actor, so fediverse
+// users can follow it as a reading list
+type PublicFolder struct {
+	ID          string
+	Name        string
+	CreatedAt   time.Time
+	DeliveredAt time.Time
+	// PrivateKey is the PEM encoded RSA key the actor signs requests with
+	PrivateKey string
+}
+
+// A Follower is a remote actor following a public folder, Inbox is their
+// shared inbox if they have one
+type Follower struct {
+	Actor string
+	Inbox string
+}
+
+// An ActivityPubStore is an interface used to seperate the ActivityPubAPI from
+// knowledge of the actual underlying database
+type ActivityPubStore interface {
+	// SetFolderPublic publishes or hides a folder, privateKey is only stored
+	// if the folder does not have a key yet
+	SetFolderPublic(ctx context.Context, sessionKey, folderID string, public bool, privateKey string) error
+	GetPublicFolder(ctx context.Context, folderID string) (*PublicFolder, error)
+	// ListPublicFolders returns the public folders with at least one follower
+	ListPublicFolders(ctx context.Context) ([]*PublicFolder, error)
+	// GetFolderPosts returns posts in the feeds of a folder created between
+	// after and before, newest first and without bodies
+	GetFolderPosts(ctx context.Context, folderID string, after, before time.Time, limit int) ([]*Post, error)
+	// ClaimDelivery moves the delivered_at of a folder from from to to, it
+	// returns false if another node got there first
+	ClaimDelivery(ctx context.Context, folderID string, from, to time.Time) (bool, error)
+
+	AddFollower(ctx context.Context, folderID string, f *Follower) error
+	RemoveFollower(ctx context.Context, folderID, actor string) error
+	ListFollowers(ctx context.Context, folderID string) ([]*Follower, error)
+}
+
+// ActivityPubAPI publishes public folders as ActivityPub actors
+type ActivityPubAPI struct {
+	s      ActivityPubStore
+	ks     *KeySigner
+	domain string
+	host   string
+	c      *apClient
+}
+
+// NewActivityPubAPI returns a new ActivityPubAPI
+func NewActivityPubAPI(s ActivityPubStore, ks *KeySigner, domain string) *ActivityPubAPI {
+	var host string
+	if u, err := url.Parse(domain); err == nil {
+		host = u.Host
+	}
+
+	return &ActivityPubAPI{
+		s:      s,
+		ks:     ks,
+		domain: domain,
+		host:   host,
+		c:      newAPClient(domain),
+	}
+}
+
+type apPublicKey struct {
+	ID           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPem string `json:"publicKeyPem"`
+}
+
+type apActor struct {
+	Context           []string     `json:"@context,omitempty"`
+	ID                string       `json:"id"`
+	Type              string       `json:"type"`
+	PreferredUsername string       `json:"preferredUsername"`
+	Name              string       `json:"name"`
+	Summary           string       `json:"summary"`
+	URL               string       `json:"url"`
+	Inbox             string       `json:"inbox"`
+	Outbox            string       `json:"outbox"`
+	Followers         string       `json:"followers"`
+	PublicKey         *apPublicKey `json:"publicKey"`
+}
+
+type apCollection struct {
+	Context      []string      `json:"@context,omitempty"`
+	ID           string        `json:"id"`
+	Type         string        `json:"type"`
+	TotalItems   *int          `json:"totalItems,omitempty"`
+	First        string        `json:"first,omitempty"`
+	PartOf       string        `json:"partOf,omitempty"`
+	Next         string        `json:"next,omitempty"`
+	OrderedItems []interface{} `json:"orderedItems,omitempty"`
+}
+
+type apNote struct {
+	ID           string    `json:"id"`
+	Type         string    `json:"type"`
+	AttributedTo string    `json:"attributedTo"`
+	Published    time.Time `json:"published"`
+	URL          string    `json:"url,omitempty"`
+	To           []string  `json:"to"`
+	CC           []string  `json:"cc"`
+	Content      string    `json:"content"`
+}
+
+type apActivity struct {
+	Context   []string    `json:"@context,omitempty"`
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	Actor     string      `json:"actor"`
+	Published *time.Time  `json:"published,omitempty"`
+	To        []string    `json:"to,omitempty"`
+	CC        []string    `json:"cc,omitempty"`
+	Object    interface{} `json:"object"`
+}
+
+// a remote actor, only the fields needed to verify and answer it
+type apRemoteActor struct {
+	ID        string `json:"id"`
+	Inbox     string `json:"inbox"`
+	Endpoints struct {
+		SharedInbox string `json:"sharedInbox"`
+	} `json:"endpoints"`
+	PublicKey apPublicKey `json:"publicKey"`
+}
+
+func (ap *ActivityPubAPI) actorURL(folderID string) string {
+	return activityURL(ap.domain, "actor/get", folderID)
+}
+
+func activityURL(domain, path, folderID string) string {
+	return domain + "/v1/activitypub/" + path + "?folder_id=" + url.QueryEscape(folderID)
+}
+
+// folders are named by their ID, as fediverse usernames only allow [a-z0-9_]
+func actorUsername(folderID string) string {
+	return strings.Replace(folderID, "-", "", -1)
+}
+
+// Publish makes a folder public, or private again, returning the handle it
+// can be followed by
+func (ap *ActivityPubAPI) Publish(w http.ResponseWriter, r *http.Request) error {
+	key, err := ap.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		FolderID string `json:"folder_id"`
+		Public   bool   `json:"public"`
+	}
+	err = limitDecoder(r, &req)
+	if err != nil {
+		return err
+	}
+
+	if _, err := uuid.Parse(req.FolderID); err != nil {
+		return errors.New("invalid folder ID")
+	}
+
+	var privateKey string
+	if req.Public {
+		privateKey, err = generateActorKey()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = ap.s.SetFolderPublic(r.Context(), key, req.FolderID, req.Public, privateKey)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, map[string]interface{}{
+		"public": req.Public,
+		"handle": "@" + actorUsername(req.FolderID) + "@" + ap.host,
+		"actor":  ap.actorURL(req.FolderID),
+	})
+}
+
+// WebFinger resolves acct: handles to the actor of a public folder
+func (ap *ActivityPubAPI) WebFinger(w http.ResponseWriter, r *http.Request) error {
+	resource := r.URL.Query().Get("resource")
+
+	parts := strings.SplitN(strings.TrimPrefix(resource, "acct:"), "@", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[1], ap.host) {
+		w.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+
+	id, err := uuid.Parse(parts[0])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+
+	folder, err := ap.s.GetPublicFolder(r.Context(), id.String())
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/jrd+json")
+	return json.NewEncoder(w).Encode(map[string]interface{}{
+		"subject": resource,
+		"links": []map[string]string{{
+			"rel":  "self",
+			"type": activityContentType,
+			"href": ap.actorURL(folder.ID),
+		}},
+	})
+}
+
+// Actor writes out the actor document of a public folder
+func (ap *ActivityPubAPI) Actor(w http.ResponseWriter, r *http.Request) error {
+	folder, err := ap.s.GetPublicFolder(r.Context(), r.URL.Query().Get("folder_id"))
+	if err != nil {
+		return err
+	}
+
+	key, err := parsePrivateKey(folder.PrivateKey)
+	if err != nil {
+		return err
+	}
+
+	pub, err := publicKeyPEM(key)
+	if err != nil {
+		return err
+	}
+
+	actor := ap.actorURL(folder.ID)
+	return writeActivity(w, &apActor{
+		Context:           activityContext,
+		ID:                actor,
+		Type:              "Service",
+		PreferredUsername: actorUsername(folder.ID),
+		Name:              folder.Name,
+		Summary:           "A reading list curated on hydrocarbon",
+		URL:               ap.domain,
+		Inbox:             activityURL(ap.domain, "inbox", folder.ID),
+		Outbox:            activityURL(ap.domain, "outbox/get", folder.ID),
+		Followers:         activityURL(ap.domain, "followers/get", folder.ID),
+		PublicKey: &apPublicKey{
+			ID:           actor + "#main-key",
+			Owner:        actor,
+			PublicKeyPem: pub,
+		},
+	})
+}
+
+// Outbox writes out the posts of a public folder as Create activities, pages
+// are fetched with a before cursor
+func (ap *ActivityPubAPI) Outbox(w http.ResponseWriter, r *http.Request) error {
+	q := r.URL.Query()
+
+	folder, err := ap.s.GetPublicFolder(r.Context(), q.Get("folder_id"))
+	if err != nil {
+		return err
+	}
+
+	outbox := activityURL(ap.domain, "outbox/get", folder.ID)
+	if q.Get("page") == "" {
+		return writeActivity(w, &apCollection{
+			Context: activityContext,
+			ID:      outbox,
+			Type:    "OrderedCollection",
+			First:   outbox + "&page=true",
+		})
+	}
+
+	before := time.Now()
+	if b := q.Get("before"); b != "" {
+		before, err = time.Parse(time.RFC3339Nano, b)
+		if err != nil {
+			return errors.New("invalid cursor")
+		}
+	}
+
+	posts, err := ap.s.GetFolderPosts(r.Context(), folder.ID, time.Time{}, before, outboxPageSize)
+	if err != nil {
+		return err
+	}
+
+	page := &apCollection{
+		Context:      activityContext,
+		ID:           outbox + "&page=true&before=" + url.QueryEscape(before.UTC().Format(time.RFC3339Nano)),
+		Type:         "OrderedCollectionPage",
+		PartOf:       outbox,
+		OrderedItems: make([]interface{}, len(posts)),
+	}
+	for i, p := range posts {
+		page.OrderedItems[i] = postActivity(ap.domain, folder.ID, p)
+	}
+	if len(posts) == outboxPageSize {
+		page.Next = outbox + "&page=true&before=" + url.QueryEscape(posts[len(posts)-1].CreatedAt.UTC().Format(time.RFC3339Nano))
+	}
+
+	return writeActivity(w, page)
+}
+
+// Followers writes out how many actors follow a public folder, but not who
+// they are
+func (ap *ActivityPubAPI) Followers(w http.ResponseWriter, r *http.Request) error {
+	folder, err := ap.s.GetPublicFolder(r.Context(), r.URL.Query().Get("folder_id"))
+	if err != nil {
+		return err
+	}
+
+	followers, err := ap.s.ListFollowers(r.Context(), folder.ID)
+	if err != nil {
+		return err
+	}
+
+	total := len(followers)
+	return writeActivity(w, &apCollection{
+		Context:    activityContext,
+		ID:         activityURL(ap.domain, "followers/get", folder.ID),
+		Type:       "OrderedCollection",
+		TotalItems: &total,
+	})
+}
+
+// Inbox accepts signed Follow and Undo activities from remote actors, anything
+// else is ignored
+func (ap *ActivityPubAPI) Inbox(w http.ResponseWriter, r *http.Request) error {
+	folder, err := ap.s.GetPublicFolder(r.Context(), r.URL.Query().Get("folder_id"))
+	if err != nil {
+		return err
+	}
+
+	key, err := parsePrivateKey(folder.PrivateKey)
+	if err != nil {
+		return err
+	}
+	actor := ap.actorURL(folder.ID)
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxInboxSize))
+	if err != nil {
+		return err
+	}
+
+	var remote *apRemoteActor
+	_, err = verifyRequest(r, body, func(keyID string) (*rsa.PublicKey, error) {
+		var ferr error
+		remote, ferr = ap.c.fetchActor(r.Context(), keyID, actor+"#main-key", key)
+		if ferr != nil {
+			return nil, ferr
+		}
+		return parsePublicKey(remote.PublicKey.PublicKeyPem)
+	})
+	if err != nil {
+		return err
+	}
+
+	var activity struct {
+		ID     string          `json:"id"`
+		Type   string          `json:"type"`
+		Actor  string          `json:"actor"`
+		Object json.RawMessage `json:"object"`
+	}
+	err = json.Unmarshal(body, &activity)
+	if err != nil {
+		return err
+	}
+
+	if activity.Actor != remote.ID {
+		return errors.New("activitypub: activity not signed by its actor")
+	}
+
+	switch activity.Type {
+	case "Follow":
+		if objectID(activity.Object) != actor {
+			return errors.New("activitypub: follow is not for this folder")
+		}
+
+		inbox := remote.Endpoints.SharedInbox
+		if inbox == "" {
+			inbox = remote.Inbox
+		}
+
+		err = ap.s.AddFollower(r.Context(), folder.ID, &Follower{Actor: remote.ID, Inbox: inbox})
+		if err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256([]byte(activity.ID))
+		err = ap.c.deliverActivity(r.Context(), remote.Inbox, actor+"#main-key", key, &apActivity{
+			Context: activityContext,
+			ID:      actor + "#accepts/" + hex.EncodeToString(sum[:8]),
+			Type:    "Accept",
+			Actor:   actor,
+			Object:  json.RawMessage(body),
+		})
+		if err != nil {
+			return err
+		}
+	case "Undo":
+		var undone struct {
+			Type string `json:"type"`
+		}
+		// undo of anything but a follow is ignored, as are bare IDs
+		if json.Unmarshal(activity.Object, &undone) == nil && undone.Type == "Follow" {
+			err = ap.s.RemoveFollower(r.Context(), folder.ID, remote.ID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
+
+// postActivity wraps a post up as a Create of a Note linking to it. Posts are
+// not served over activitypub, so their IDs are fragments of the actor
+func postActivity(domain, folderID string, p *Post) *apActivity {
+	actor := activityURL(domain, "actor/get", folderID)
+	followers := activityURL(domain, "followers/get", folderID)
+	published := p.CreatedAt
+
+	title := p.Title
+	if title == "" {
+		title = p.OriginalURL
+	}
+
+	content := `<p><a href="` + html.EscapeString(p.OriginalURL) + `">` + html.EscapeString(title) + `</a>`
+	if p.Author != "" {
+		content += " by " + html.EscapeString(p.Author)
+	}
+	content += "</p>"
+
+	return &apActivity{
+		ID:        actor + "#posts/" + p.ID + "/activity",
+		Type:      "Create",
+		Actor:     actor,
+		Published: &published,
+		To:        []string{activityPublic},
+		CC:        []string{followers},
+		Object: &apNote{
+			ID:           actor + "#posts/" + p.ID,
+			Type:         "Note",
+			AttributedTo: actor,
+			Published:    published,
+			URL:          p.OriginalURL,
+			To:           []string{activityPublic},
+			CC:           []string{followers},
+			Content:      content,
+		},
+	}
+}
+
+// objectID returns the ID of an object that may be inlined or just its ID
+func objectID(raw json.RawMessage) string {
+	var id string
+	if json.Unmarshal(raw, &id) == nil {
+		return id
+	}
+
+	var obj struct {
+		ID string `json:"id"`
+	}
+	if json.Unmarshal(raw, &obj) == nil {
+		return obj.ID
+	}
+	return ""
+}
+
+// An apClient fetches remote actors and delivers to their inboxes. The urls it
+// is given come from strangers, so it only dials public addresses over https,
+// unless hydrocarbon is in dev, served over http itself
+type apClient struct {
+	c   *http.Client
+	dev bool
+}
+
+func newAPClient(domain string) *apClient {
+	dev := strings.HasPrefix(domain, "http://")
+
+	d := &net.Dialer{Timeout: 10 * time.Second}
+	if !dev {
+		// checked once the address is resolved, so names pointing inside
+		// are refused too
+		d.Control = refusePrivate
+	}
+
+	ac := &apClient{dev: dev}
+	ac.c = &http.Client{
+		Timeout: 15 * time.Second,
+		// no proxy, it would be dialed in place of the remote
+		Transport: &http.Transport{
+			DialContext:         d.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("activitypub: too many redirects")
+			}
+			_, err := ac.remoteURL(req.URL.String())
+			return err
+		},
+	}
+
+	return ac
+}
+
+// remoteURL parses raw, the url of a remote actor, key or inbox
+func (ac *apClient) remoteURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && !(ac.dev && u.Scheme == "http")) {
+		return nil, fmt.Errorf("activitypub: %q is not an https url", raw)
+	}
+
+	return u, nil
+}
+
+// refusePrivate is a net.Dialer Control refusing loopback, link-local and
+// private addresses
+func refusePrivate(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !publicIP(ip) {
+		return fmt.Errorf("activitypub: refusing to dial %s", address)
+	}
+
+	return nil
+}
+
+func publicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+
+	return nets
+}
+
+// fetchActor fetches the actor owning keyID, the fetch itself is signed for
+// instances that require it. The actor and its inboxes must be on the host of
+// the key, so one instance can not speak for, or have us post to, another
+func (ac *apClient) fetchActor(ctx context.Context, keyID, signingKeyID string, key *rsa.PrivateKey) (*apRemoteActor, error) {
+	u, err := ac.remoteURL(keyID)
+	if err != nil {
+		return nil, errors.New("activitypub: invalid key ID")
+	}
+	u.Fragment = ""
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", activityContentType)
+	req.Header.Set("User-Agent", "hydrocarbon/1.0 (+https://github.com/fortytw2/hydrocarbon)")
+
+	err = signRequest(req, signingKeyID, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := ac.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("activitypub: could not fetch %s, status %d", u, resp.StatusCode)
+	}
+
+	var actor apRemoteActor
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxInboxSize)).Decode(&actor)
+	if err != nil {
+		return nil, err
+	}
+
+	if actor.PublicKey.ID != keyID || actor.PublicKey.Owner != actor.ID || actor.Inbox == "" {
+		return nil, errors.New("activitypub: key is not owned by the actor it was fetched from")
+	}
+
+	for _, raw := range []string{actor.ID, actor.Inbox, actor.Endpoints.SharedInbox} {
+		if raw == "" {
+			continue
+		}
+
+		v, err := ac.remoteURL(raw)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.EqualFold(v.Host, u.Host) {
+			return nil, fmt.Errorf("activitypub: %s is not on the host of key %s", raw, keyID)
+		}
+	}
+
+	return &actor, nil
+}
+
+// deliverActivity posts a signed activity to a remote inbox
+func (ac *apClient) deliverActivity(ctx context.Context, inbox, keyID string, key *rsa.PrivateKey, activity *apActivity) error {
+	_, err := ac.remoteURL(inbox)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, inbox, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", activityContentType)
+	req.Header.Set("User-Agent", "hydrocarbon/1.0 (+https://github.com/fortytw2/hydrocarbon)")
+
+	err = signRequest(req, keyID, key, body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := ac.c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("activitypub: delivery to %s failed with status %d", inbox, resp.StatusCode)
+	}
+	return nil
+}
+
+func writeActivity(w http.ResponseWriter, x interface{}) error {
+	w.Header().Set("Content-Type", activityContentType)
+	w.WriteHeader(http.StatusOK)
+	return json.NewEncoder(w).Encode(x)
+}
+
+// An ActivityPublisher delivers new posts of public folders to the inboxes of
+// their followers
+type ActivityPublisher struct {
+	s      ActivityPubStore
+	domain string
+	c      *apClient
+
+	shutdown chan chan struct{}
+}
+
+// NewActivityPublisher returns a new ActivityPublisher
+func NewActivityPublisher(s ActivityPubStore, domain string) *ActivityPublisher {
+	return &ActivityPublisher{
+		s:        s,
+		domain:   domain,
+		c:        newAPClient(domain),
+		shutdown: make(chan chan struct{}),
+	}
+}
+
+// Start launches the publisher, it blocks until Stop is called
+func (ap *ActivityPublisher) Start() error {
+	ticker := time.NewTicker(activityDeliveryInterval)
+
+	for {
+		select {
+		case a := <-ap.shutdown:
+			ticker.Stop()
+			a <- struct{}{}
+			return nil
+		case <-ticker.C:
+			err := ap.deliver(context.TODO())
+			if err != nil {
+				log.Println("hydrocarbon: could not deliver activities:", err)
+			}
+		}
+	}
+}
+
+// Stop blocks until the publisher is shutdown
+func (ap *ActivityPublisher) Stop() {
+	c := make(chan struct{})
+	ap.shutdown <- c
+	<-c
+}
+
+func (ap *ActivityPublisher) deliver(ctx context.Context) error {
+	folders, err := ap.s.ListPublicFolders(ctx)
+	if err != nil {
+		return err
+	}
+
+	until := time.Now().Add(-activityDeliveryLag)
+	for _, f := range folders {
+		if !f.DeliveredAt.Before(until) {
+			continue
+		}
+
+		// deliveries are at most once, a node that dies midway drops the rest
+		claimed, err := ap.s.ClaimDelivery(ctx, f.ID, f.DeliveredAt, until)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+
+		err = ap.deliverFolder(ctx, f, until)
+		if err != nil {
+			log.Println("hydrocarbon: could not deliver folder", f.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (ap *ActivityPublisher) deliverFolder(ctx context.Context, f *PublicFolder, until time.Time) error {
+	posts, err := ap.s.GetFolderPosts(ctx, f.ID, f.DeliveredAt, until, maxDeliveredPosts)
+	if err != nil || len(posts) == 0 {
+		return err
+	}
+
+	followers, err := ap.s.ListFollowers(ctx, f.ID)
+	if err != nil {
+		return err
+	}
+
+	key, err := parsePrivateKey(f.PrivateKey)
+	if err != nil {
+		return err
+	}
+	keyID := activityURL(ap.domain, "actor/get", f.ID) + "#main-key"
+
+	// followers on the same instance share an inbox
+	inboxes := make(map[string]struct{})
+	for _, fo := range followers {
+		inboxes[fo.Inbox] = struct{}{}
+	}
+
+	// oldest first, so timelines show them in order
+	for i := len(posts) - 1; i >= 0; i-- {
+		activity := postActivity(ap.domain, f.ID, posts[i])
+		activity.Context = activityContext
+
+		for inbox := range inboxes {
+			err := ap.c.deliverActivity(ctx, inbox, keyID, key, activity)
+			if err != nil {
+				log.Println("hydrocarbon:", err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package hydrocarbon
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPublicIP(t *testing.T) {
+	t.Parallel()
+
+	for ip, public := range map[string]bool{
+		"93.184.216.34":    true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"10.1.2.3":         false,
+		"172.20.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"fd00::1":          false,
+		"fe80::1":          false,
+		"::ffff:127.0.0.1": false,
+	} {
+		if got := publicIP(net.ParseIP(ip)); got != public {
+			t.Errorf("expected publicIP(%s) to be %t", ip, public)
+		}
+	}
+}
+
+func TestAPClientRefusesPrivate(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	key, err := generateActorKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, err := parsePrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ac := newAPClient("https://hydrocarbon.example")
+	_, err = ac.fetchActor(context.Background(), srv.URL+"/actor#main-key", "https://hydrocarbon.example/actor#main-key", pk)
+	if err == nil {
+		t.Fatal("expected an http key ID to be refused outside of dev")
+	}
+
+	https := strings.Replace(srv.URL, "http://", "https://", 1)
+	_, err = ac.fetchActor(context.Background(), https+"/actor#main-key", "https://hydrocarbon.example/actor#main-key", pk)
+	if err == nil || !strings.Contains(err.Error(), "refusing to dial") {
+		t.Fatalf("expected loopback to be refused, got %v", err)
+	}
+}
+
+func TestAPClientSameHost(t *testing.T) {
+	t.Parallel()
+
+	key, err := generateActorKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, err := parsePrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var inbox, sharedInbox string
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a apRemoteActor
+		a.ID = srv.URL + "/actor"
+		a.Inbox = inbox
+		a.Endpoints.SharedInbox = sharedInbox
+		a.PublicKey = apPublicKey{ID: a.ID + "#main-key", Owner: a.ID}
+		json.NewEncoder(w).Encode(a)
+	}))
+	defer srv.Close()
+
+	// dev, so the test server can be reached
+	ac := newAPClient("http://localhost:8080")
+	fetch := func() error {
+		_, err := ac.fetchActor(context.Background(), srv.URL+"/actor#main-key", "http://localhost:8080/actor#main-key", pk)
+		return err
+	}
+
+	inbox = srv.URL + "/inbox"
+	if err := fetch(); err != nil {
+		t.Fatal(err)
+	}
+
+	inbox = "http://elsewhere.example/inbox"
+	if err := fetch(); err == nil {
+		t.Fatal("expected an inbox on another host to be refused")
+	}
+
+	inbox, sharedInbox = srv.URL+"/inbox", "http://elsewhere.example/inbox"
+	if err := fetch(); err == nil {
+		t.Fatal("expected a shared inbox on another host to be refused")
+	}
+}
@@ -0,0 +1,654 @@
+package hydrocarbon
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fortytw2/hydrocarbon/discollect"
+)
+
+const (
+	// nodes that have not heartbeated within nodeListWindow are assumed dead
+	nodeListWindow = 10 * time.Minute
+
+	defaultQualityDays = 30
+	maxQualityDays     = 365
+
+	// the stats of posts pruned by the retention policy cover this many days
+	pruneStatsDays = 30
+)
+
+// An AdminStore is an interface used to seperate the AdminAPI from knowledge of
+// the actual underlying database
+type AdminStore interface {
+	// VerifyAdmin ensures the given session belongs to an admin
+	VerifyAdmin(ctx context.Context, sessionKey string) error
+
+	CreateAnnouncement(ctx context.Context, a *Announcement) (string, error)
+	UpdateAnnouncement(ctx context.Context, a *Announcement) error
+	DeleteAnnouncement(ctx context.Context, id string) error
+	ListAnnouncements(ctx context.Context, limit, offset int) ([]*Announcement, error)
+
+	ListNodes(ctx context.Context, within time.Duration) ([]*discollect.Node, error)
+	SetNodeDraining(ctx context.Context, id string, draining bool) error
+
+	// SetFeedDeleted and SetPostDeleted delete or restore a feed or post for
+	// every user, deleted rows are purged after a grace period
+	SetFeedDeleted(ctx context.Context, feedID string, deleted bool) error
+	SetPostDeleted(ctx context.Context, postID string, deleted bool) error
+
+	// GetTableStats returns the size and estimated bloat of every table
+	GetTableStats(ctx context.Context) ([]*TableStats, error)
+	// GetPruneStats returns how many posts the retention policy deleted on
+	// each day since the given time, oldest first
+	GetPruneStats(ctx context.Context, since time.Time) ([]*PruneStats, error)
+	// ListBackups lists the backups taken, newest first
+	ListBackups(ctx context.Context, limit, offset int) ([]*Backup, error)
+
+	// GetQualityTrend returns daily plugin quality metrics since the given
+	// time, for every plugin if plugin is empty
+	GetQualityTrend(ctx context.Context, since time.Time, plugin string) ([]*PluginQuality, error)
+
+	// ListScrapes lists scrapes in the given state
+	ListScrapes(ctx context.Context, state string, limit, offset int) ([]*discollect.Scrape, error)
+	// RequeueScrape moves a DEAD scrape back to WAITING
+	RequeueScrape(ctx context.Context, id uuid.UUID) error
+	// RequeueDeadScrapes requeues every DEAD scrape of plugin, or every DEAD
+	// scrape if plugin is empty
+	RequeueDeadScrapes(ctx context.Context, plugin string) ([]uuid.UUID, error)
+	// GetLogs returns the requests and errors logged by the tasks of a
+	// scrape, oldest first
+	GetLogs(ctx context.Context, scrapeID uuid.UUID, limit, offset int) ([]*discollect.LogEntry, error)
+}
+
+// AdminAPI encapsulates everything instance operators can manage
+type AdminAPI struct {
+	s  AdminStore
+	ks *KeySigner
+	dc *discollect.Discollector
+}
+
+// NewAdminAPI returns a new AdminAPI
+func NewAdminAPI(s AdminStore, dc *discollect.Discollector, ks *KeySigner) *AdminAPI {
+	return &AdminAPI{
+		s:  s,
+		ks: ks,
+		dc: dc,
+	}
+}
+
+// verifyAdmin checks that the request was made by an admin
+func (aa *AdminAPI) verifyAdmin(r *http.Request) error {
+	key, err := aa.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	return aa.s.VerifyAdmin(r.Context(), key)
+}
+
+type announcementReq struct {
+	ID       string     `json:"id"`
+	Title    string     `json:"title"`
+	Body     string     `json:"body"`
+	StartsAt *time.Time `json:"starts_at,omitempty"`
+	EndsAt   *time.Time `json:"ends_at,omitempty"`
+}
+
+func (ar *announcementReq) announcement() (*Announcement, error) {
+	if ar.Title == "" {
+		return nil, errors.New("announcements must have a title")
+	}
+
+	a := &Announcement{
+		ID:       ar.ID,
+		Title:    ar.Title,
+		Body:     ar.Body,
+		StartsAt: time.Now(),
+		EndsAt:   ar.EndsAt,
+	}
+
+	if ar.StartsAt != nil {
+		a.StartsAt = *ar.StartsAt
+	}
+
+	if a.EndsAt != nil && a.EndsAt.Before(a.StartsAt) {
+		return nil, errors.New("announcements cannot end before they start")
+	}
+
+	return a, nil
+}
+
+// CreateAnnouncement creates a new announcement
+func (aa *AdminAPI) CreateAnnouncement(w http.ResponseWriter, r *http.Request) error {
+	err := aa.verifyAdmin(r)
+	if err != nil {
+		return err
+	}
+
+	var req announcementReq
+	err = limitDecoder(r, &req)
+	if err != nil {
+		return err
+	}
+
+	a, err := req.announcement()
+	if err != nil {
+		return err
+	}
+
+	id, err := aa.s.CreateAnnouncement(r.Context(), a)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, map[string]string{
+		"id": id,
+	})
+}
+
+// UpdateAnnouncement replaces the contents of an existing announcement
+func (aa *AdminAPI) UpdateAnnouncement(w http.ResponseWriter, r *http.Request) error {
+	err := aa.verifyAdmin(r)
+	if err != nil {
+		return err
+	}
+
+	var req announcementReq
+	err = limitDecoder(r, &req)
+	if err != nil {
+		return err
+	}
+
+	if req.ID == "" {
+		return errors.New("no announcement ID sent")
+	}
+
+	a, err := req.announcement()
+	if err != nil {
+		return err
+	}
+
+	err = aa.s.UpdateAnnouncement(r.Context(), a)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, nil)
+}
+
+// DeleteAnnouncement removes an announcement
+func (aa *AdminAPI) DeleteAnnouncement(w http.ResponseWriter, r *http.Request) error {
+	err := aa.verifyAdmin(r)
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		ID string `json:"id"`
+	}
+	err = limitDecoder(r, &req)
+	if err != nil {
+		return err
+	}
+
+	if req.ID == "" {
+		return errors.New("no announcement ID sent")
+	}
+
+	err = aa.s.DeleteAnnouncement(r.Context(), req.ID)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, nil)
+}
+
+// ListAnnouncements writes out all announcements, newest first
+func (aa *AdminAPI) ListAnnouncements(w http.ResponseWriter, r *http.Request) error {
+	err := aa.verifyAdmin(r)
+	if err != nil {
+		return err
+	}
+
+	var page struct {
+		Limit  int `json:"limit"`
+		Offset int `json:"offset"`
+	}
+	err = limitDecoder(r, &page)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	if page.Limit <= 0 || page.Limit > 100 {
+		page.Limit = 25
+	}
+
+	if page.Offset < 0 {
+		page.Offset = 0
+	}
+
+	as, err := aa.s.ListAnnouncements(r.Context(), page.Limit, page.Offset)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, as)
+}
+
+// ListNodes writes out every scraping node that is still heartbeating
+func (aa *AdminAPI) ListNodes(w http.ResponseWriter, r *http.Request) error {
+	err := aa.verifyAdmin(r)
+	if err != nil {
+		return err
+	}
+
+	nodes, err := aa.s.ListNodes(r.Context(), nodeListWindow)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, nodes)
+}
+
+// DrainNode tells a node to stop starting new scrapes while it finishes its
+// current ones, or resumes a drained node
+func (aa *AdminAPI) DrainNode(w http.ResponseWriter, r *http.Request) error {
+	err := aa.verifyAdmin(r)
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		ID    string `json:"id"`
+		Drain bool   `json:"drain"`
+	}
+	err = limitDecoder(r, &req)
+	if err != nil {
+		return err
+	}
+
+	if req.ID == "" {
+		return errors.New("no node ID sent")
+	}
+
+	err = aa.s.SetNodeDraining(r.Context(), req.ID, req.Drain)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, nil)
+}
+
+// DeleteFeed deletes a feed for every user following it
+func (aa *AdminAPI) DeleteFeed(w http.ResponseWriter, r *http.Request) error {
+	return aa.setDeleted(w, r, aa.s.SetFeedDeleted, true)
+}
+
+// RestoreFeed restores a deleted feed
+func (aa *AdminAPI) RestoreFeed(w http.ResponseWriter, r *http.Request) error {
+	return aa.setDeleted(w, r, aa.s.SetFeedDeleted, false)
+}
+
+// DeletePost deletes a post for every user, later scrapes do not bring it back
+func (aa *AdminAPI) DeletePost(w http.ResponseWriter, r *http.Request) error {
+	return aa.setDeleted(w, r, aa.s.SetPostDeleted, true)
+}
+
+// RestorePost restores a deleted post
+func (aa *AdminAPI) RestorePost(w http.ResponseWriter, r *http.Request) error {
+	return aa.setDeleted(w, r, aa.s.SetPostDeleted, false)
+}
+
+func (aa *AdminAPI) setDeleted(w http.ResponseWriter, r *http.Request,
+	set func(context.Context, string, bool) error, deleted bool) error {
+	err := aa.verifyAdmin(r)
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		ID string `json:"id"`
+	}
+	err = limitDecoder(r, &req)
+	if err != nil {
+		return err
+	}
+
+	if req.ID == "" {
+		return errors.New("no ID sent")
+	}
+
+	err = set(r.Context(), req.ID, deleted)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, nil)
+}
+
+// ReplayScrape re-runs a scrape against the responses captured when it first
+// ran, regenerating its posts without contacting the origin site
+func (aa *AdminAPI) ReplayScrape(w http.ResponseWriter, r *http.Request) error {
+	err := aa.verifyAdmin(r)
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		ScrapeID string `json:"scrape_id"`
+	}
+	err = limitDecoder(r, &req)
+	if err != nil {
+		return err
+	}
+
+	id, err := uuid.Parse(req.ScrapeID)
+	if err != nil {
+		return errors.New("invalid scrape ID sent")
+	}
+
+	res, err := aa.dc.Replay(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, res)
+}
+
+// DryRunScrape runs a plugin against the live site without storing anything,
+// returning what it extracted so plugin authors can check their selectors
+func (aa *AdminAPI) DryRunScrape(w http.ResponseWriter, r *http.Request) error {
+	err := aa.verifyAdmin(r)
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		Plugin   string             `json:"plugin"`
+		Config   *discollect.Config `json:"config"`
+		MaxTasks int                `json:"max_tasks"`
+	}
+	err = limitDecoder(r, &req)
+	if err != nil {
+		return err
+	}
+
+	if req.Plugin == "" || req.Config == nil {
+		return errors.New("plugin and config are required")
+	}
+
+	res, err := aa.dc.DryRun(r.Context(), req.Plugin, req.Config, req.MaxTasks)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, res)
+}
+
+type pauseReq struct {
+	// ScrapeID pauses a single scrape, otherwise every scrape of Plugin, or
+	// every scrape if both are empty
+	ScrapeID string `json:"scrape_id"`
+	Plugin   string `json:"plugin"`
+}
+
+// PauseScrapes pauses running scrapes during upstream incidents, saving their
+// pending tasks until they are resumed
+func (aa *AdminAPI) PauseScrapes(w http.ResponseWriter, r *http.Request) error {
+	return aa.pauseOrResume(w, r, aa.dc.Pause, aa.dc.PauseAll)
+}
+
+// ResumeScrapes resumes paused scrapes where they left off
+func (aa *AdminAPI) ResumeScrapes(w http.ResponseWriter, r *http.Request) error {
+	return aa.pauseOrResume(w, r, aa.dc.Resume, aa.dc.ResumeAll)
+}
+
+func (aa *AdminAPI) pauseOrResume(w http.ResponseWriter, r *http.Request,
+	one func(context.Context, uuid.UUID) error,
+	all func(context.Context, string) ([]uuid.UUID, error)) error {
+	err := aa.verifyAdmin(r)
+	if err != nil {
+		return err
+	}
+
+	var req pauseReq
+	err = limitDecoder(r, &req)
+	if err != nil {
+		return err
+	}
+
+	var ids []uuid.UUID
+	if req.ScrapeID != "" {
+		id, err := uuid.Parse(req.ScrapeID)
+		if err != nil {
+			return errors.New("invalid scrape ID sent")
+		}
+
+		err = one(r.Context(), id)
+		if err != nil {
+			return err
+		}
+		ids = []uuid.UUID{id}
+	} else {
+		ids, err = all(r.Context(), req.Plugin)
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeSuccess(w, map[string]interface{}{
+		"scrape_ids": ids,
+	})
+}
+
+// DeadScrapes writes out scrapes that failed too many times to be retried, with
+// their errors, config and the last url that failed
+func (aa *AdminAPI) DeadScrapes(w http.ResponseWriter, r *http.Request) error {
+	err := aa.verifyAdmin(r)
+	if err != nil {
+		return err
+	}
+
+	var page struct {
+		Limit  int `json:"limit"`
+		Offset int `json:"offset"`
+	}
+	err = limitDecoder(r, &page)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	if page.Limit <= 0 || page.Limit > 100 {
+		page.Limit = 25
+	}
+
+	if page.Offset < 0 {
+		page.Offset = 0
+	}
+
+	scrapes, err := aa.s.ListScrapes(r.Context(), "DEAD", page.Limit, page.Offset)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, scrapes)
+}
+
+// ScrapeLogs writes out every request made and error hit by the tasks of a
+// scrape, to find out why a feed is producing no posts
+func (aa *AdminAPI) ScrapeLogs(w http.ResponseWriter, r *http.Request) error {
+	err := aa.verifyAdmin(r)
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		ScrapeID string `json:"scrape_id"`
+		Limit    int    `json:"limit"`
+		Offset   int    `json:"offset"`
+	}
+	err = limitDecoder(r, &req)
+	if err != nil {
+		return err
+	}
+
+	id, err := uuid.Parse(req.ScrapeID)
+	if err != nil {
+		return errors.New("invalid scrape ID sent")
+	}
+
+	if req.Limit <= 0 || req.Limit > 500 {
+		req.Limit = 100
+	}
+
+	if req.Offset < 0 {
+		req.Offset = 0
+	}
+
+	entries, err := aa.s.GetLogs(r.Context(), id, req.Limit, req.Offset)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, entries)
+}
+
+// RequeueScrapes puts dead scrapes back on the schedule once whatever broke
+// them has been fixed, a single scrape, every dead scrape of a plugin, or every
+// dead scrape if both are empty
+func (aa *AdminAPI) RequeueScrapes(w http.ResponseWriter, r *http.Request) error {
+	err := aa.verifyAdmin(r)
+	if err != nil {
+		return err
+	}
+
+	var req pauseReq
+	err = limitDecoder(r, &req)
+	if err != nil {
+		return err
+	}
+
+	var ids []uuid.UUID
+	if req.ScrapeID != "" {
+		id, err := uuid.Parse(req.ScrapeID)
+		if err != nil {
+			return errors.New("invalid scrape ID sent")
+		}
+
+		err = aa.s.RequeueScrape(r.Context(), id)
+		if err != nil {
+			return err
+		}
+		ids = []uuid.UUID{id}
+	} else {
+		ids, err = aa.s.RequeueDeadScrapes(r.Context(), req.Plugin)
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeSuccess(w, map[string]interface{}{
+		"scrape_ids": ids,
+	})
+}
+
+// Stats writes out instance health statistics and the posts pruned each day,
+// robots.txt counters are only for the node serving the request
+func (aa *AdminAPI) Stats(w http.ResponseWriter, r *http.Request) error {
+	err := aa.verifyAdmin(r)
+	if err != nil {
+		return err
+	}
+
+	tables, err := aa.s.GetTableStats(r.Context())
+	if err != nil {
+		return err
+	}
+
+	pruned, err := aa.s.GetPruneStats(r.Context(), time.Now().UTC().AddDate(0, 0, -pruneStatsDays))
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, struct {
+		Tables []*TableStats                     `json:"tables"`
+		Pruned []*PruneStats                     `json:"pruned"`
+		Robots map[string]discollect.RobotsStats `json:"robots"`
+	}{
+		tables,
+		pruned,
+		aa.dc.RobotsStats(),
+	})
+}
+
+// ListBackups writes out the backups taken, whether they succeeded or not,
+// newest first
+func (aa *AdminAPI) ListBackups(w http.ResponseWriter, r *http.Request) error {
+	err := aa.verifyAdmin(r)
+	if err != nil {
+		return err
+	}
+
+	var page struct {
+		Limit  int `json:"limit"`
+		Offset int `json:"offset"`
+	}
+	err = limitDecoder(r, &page)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	if page.Limit <= 0 || page.Limit > 100 {
+		page.Limit = 25
+	}
+
+	if page.Offset < 0 {
+		page.Offset = 0
+	}
+
+	bs, err := aa.s.ListBackups(r.Context(), page.Limit, page.Offset)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, bs)
+}
+
+// QualityTrend writes out the daily quality metrics of each plugin over the
+// last N days, so slowly degrading extraction can be spotted
+func (aa *AdminAPI) QualityTrend(w http.ResponseWriter, r *http.Request) error {
+	err := aa.verifyAdmin(r)
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		Plugin string `json:"plugin"`
+		Days   int    `json:"days"`
+	}
+	err = limitDecoder(r, &req)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	if req.Days <= 0 {
+		req.Days = defaultQualityDays
+	}
+	if req.Days > maxQualityDays {
+		req.Days = maxQualityDays
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -req.Days)
+	trend, err := aa.s.GetQualityTrend(r.Context(), since, req.Plugin)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, trend)
+}
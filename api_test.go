@@ -46,12 +46,15 @@ func runCases(t *testing.T, db *pg.DB, cases []apiCase) {
 
 		mm := &hydrocarbon.MockMailer{}
 		ks := hydrocarbon.NewKeySigner("test")
-		h := hydrocarbon.NewRouter(
-			hydrocarbon.NewUserAPI(db, ks, mm, "", "", false),
-			hydrocarbon.NewFeedAPI(db, dc, ks),
-			hydrocarbon.NewReadStatusAPI(db, ks),
-			"http://localhost:3000",
-		)
+		h := hydrocarbon.NewRouter(hydrocarbon.RouterConfig{
+			Users:      hydrocarbon.NewUserAPI(db, ks, mm, nil, ""),
+			Feeds:      hydrocarbon.NewFeedAPI(db, dc, ks),
+			ReadStatus: hydrocarbon.NewReadStatusAPI(db, ks),
+			Billing:    hydrocarbon.NewBillingAPI(db, ks, nil, "http://localhost:3000"),
+			Admin:      hydrocarbon.NewAdminAPI(db, dc, ks),
+			Plugins:    hydrocarbon.NewPluginAPI(dc),
+			Domain:     "http://localhost:3000",
+		})
 
 		w := httptest.NewRecorder()
 
@@ -0,0 +1,404 @@
+package hydrocarbon
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/microcosm-cc/bluemonday"
+)
+
+const (
+	// archives are read into memory, as zip needs random access
+	maxArchiveSize = 64 * 1024 * 1024
+	// the most any single file in an archive may decompress to
+	maxArchiveFileSize = 4 * 1024 * 1024
+	maxArchivePosts    = 5000
+)
+
+var (
+	errUnknownArchive = errors.New("archive is not an epub, zip or wordpress export")
+
+	archivePolicy = bluemonday.UGCPolicy()
+)
+
+// ParseArchive reads the posts out of an archive of a feed, an epub, a zip of
+// html or text chapters, or a WordPress export. The format is detected from
+// the contents. Chapters of epubs and zips have no url or date of their own,
+// so they are numbered from 1 in reading order and given dates one second
+// apart, ending at the date of the archive
+func ParseArchive(data []byte) ([]*Post, error) {
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+
+	var posts []*Post
+	var err error
+
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		posts, err = parseZipArchive(data)
+	case bytes.Contains(head, []byte("<rss")):
+		posts, err = parseWordPressExport(data)
+	default:
+		return nil, errUnknownArchive
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(posts) == 0 {
+		return nil, errors.New("archive contains no posts")
+	}
+	if len(posts) > maxArchivePosts {
+		return nil, fmt.Errorf("archives are limited to %d posts", maxArchivePosts)
+	}
+
+	return posts, nil
+}
+
+func parseZipArchive(data []byte) ([]*Post, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	if _, ok := files["META-INF/container.xml"]; ok {
+		return parseEPUB(files)
+	}
+
+	var names []string
+	var newest time.Time
+	for _, f := range zr.File {
+		switch strings.ToLower(path.Ext(f.Name)) {
+		case ".html", ".htm", ".xhtml", ".txt":
+			names = append(names, f.Name)
+			if f.Modified.After(newest) {
+				newest = f.Modified
+			}
+		}
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		return naturalLess(names[i], names[j])
+	})
+
+	var chapters []*Post
+	for _, name := range names {
+		buf, err := readZipFile(files[name])
+		if err != nil {
+			return nil, err
+		}
+
+		title := strings.TrimSuffix(path.Base(name), path.Ext(name))
+		var p *Post
+		if strings.EqualFold(path.Ext(name), ".txt") {
+			p = &Post{Title: title, Body: textToHTML(string(buf))}
+		} else {
+			p, err = parseChapter(buf, title)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", name, err)
+			}
+		}
+
+		chapters = append(chapters, p)
+	}
+
+	return numberChapters(chapters, newest, ""), nil
+}
+
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type epubPackage struct {
+	Creator string `xml:"metadata>creator"`
+	Date    string `xml:"metadata>date"`
+
+	Manifest []struct {
+		ID        string `xml:"id,attr"`
+		Href      string `xml:"href,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"manifest>item"`
+
+	Spine []struct {
+		IDRef string `xml:"idref,attr"`
+	} `xml:"spine>itemref"`
+}
+
+func parseEPUB(files map[string]*zip.File) ([]*Post, error) {
+	var container epubContainer
+	err := readZipXML(files["META-INF/container.xml"], &container)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(container.Rootfiles) == 0 {
+		return nil, errors.New("epub has no package")
+	}
+
+	opfPath := container.Rootfiles[0].FullPath
+	opf, ok := files[opfPath]
+	if !ok {
+		return nil, fmt.Errorf("epub package %s is missing", opfPath)
+	}
+
+	var pkg epubPackage
+	err = readZipXML(opf, &pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	hrefs := make(map[string]string, len(pkg.Manifest))
+	for _, item := range pkg.Manifest {
+		if item.MediaType == "application/xhtml+xml" {
+			hrefs[item.ID] = item.Href
+		}
+	}
+
+	var chapters []*Post
+	for _, ref := range pkg.Spine {
+		href, ok := hrefs[ref.IDRef]
+		if !ok {
+			continue
+		}
+
+		// hrefs are relative to the package and may be escaped
+		href, err = url.PathUnescape(href)
+		if err != nil {
+			return nil, err
+		}
+
+		name := path.Join(path.Dir(opfPath), href)
+		f, ok := files[name]
+		if !ok {
+			return nil, fmt.Errorf("epub chapter %s is missing", name)
+		}
+
+		buf, err := readZipFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		p, err := parseChapter(buf, fmt.Sprintf("Chapter %d", len(chapters)+1))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+
+		// covers, title pages and the like have no text
+		if strings.TrimSpace(stripPolicy.Sanitize(p.Body)) == "" {
+			continue
+		}
+
+		chapters = append(chapters, p)
+	}
+
+	// dc:date is often only a year or a day
+	var date time.Time
+	for _, layout := range []string{time.RFC3339, "2006-01-02", "2006-01", "2006"} {
+		date, err = time.Parse(layout, strings.TrimSpace(pkg.Date))
+		if err == nil {
+			break
+		}
+	}
+
+	return numberChapters(chapters, date, strings.TrimSpace(pkg.Creator)), nil
+}
+
+// parseChapter extracts the title and body of an html chapter, falling back
+// to title when it has no heading
+func parseChapter(buf []byte, title string) (*Post, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+
+	if h := strings.TrimSpace(doc.Find("h1, h2, h3").First().Text()); h != "" {
+		title = h
+	} else if t := strings.TrimSpace(doc.Find("title").First().Text()); t != "" {
+		title = t
+	}
+
+	body, err := doc.Find("body").First().Html()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Post{
+		Title: title,
+		Body:  archivePolicy.Sanitize(body),
+	}, nil
+}
+
+// numberChapters gives chapters their index as a url fragment, so importing
+// the same archive again matches up with the posts it already created, and
+// dates one second apart so they sort in reading order
+func numberChapters(chapters []*Post, last time.Time, author string) []*Post {
+	if last.IsZero() {
+		last = time.Now()
+	}
+
+	start := last.Add(-time.Duration(len(chapters)) * time.Second)
+	for i, p := range chapters {
+		p.OriginalURL = "#chapter-" + strconv.Itoa(i+1)
+		p.PostedAt = start.Add(time.Duration(i+1) * time.Second)
+		if p.Author == "" {
+			p.Author = author
+		}
+	}
+
+	return chapters
+}
+
+type wordPressExport struct {
+	Items []struct {
+		Title    string `xml:"title"`
+		Link     string `xml:"link"`
+		PubDate  string `xml:"pubDate"`
+		Creator  string `xml:"creator"`
+		Content  string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+		PostID   string `xml:"post_id"`
+		PostType string `xml:"post_type"`
+		Status   string `xml:"status"`
+		DateGMT  string `xml:"post_date_gmt"`
+	} `xml:"channel>item"`
+}
+
+func parseWordPressExport(data []byte) ([]*Post, error) {
+	var export wordPressExport
+	err := xml.Unmarshal(data, &export)
+	if err != nil {
+		return nil, err
+	}
+
+	var posts []*Post
+	for _, item := range export.Items {
+		// attachments, pages and drafts are all items too
+		if item.PostType != "post" || item.Status != "publish" {
+			continue
+		}
+
+		postedAt, err := time.Parse("2006-01-02 15:04:05", item.DateGMT)
+		if err != nil {
+			postedAt, err = time.Parse(time.RFC1123Z, item.PubDate)
+			if err != nil {
+				return nil, fmt.Errorf("post %s has no valid date", item.PostID)
+			}
+		}
+
+		if item.Link == "" {
+			return nil, fmt.Errorf("post %s has no link", item.PostID)
+		}
+
+		posts = append(posts, &Post{
+			Title:       html.UnescapeString(item.Title),
+			Author:      item.Creator,
+			Body:        archivePolicy.Sanitize(wpautop(item.Content)),
+			OriginalURL: item.Link,
+			PostedAt:    postedAt,
+		})
+	}
+
+	return posts, nil
+}
+
+// wpautop wraps the paragraphs of WordPress content in <p>, it is stored with
+// blank lines between them, like text
+func wpautop(content string) string {
+	if strings.Contains(content, "<p") {
+		return content
+	}
+
+	var sb strings.Builder
+	for _, para := range strings.Split(strings.Replace(content, "\r\n", "\n", -1), "\n\n") {
+		if para = strings.TrimSpace(para); para != "" {
+			sb.WriteString("<p>" + strings.Replace(para, "\n", "<br>", -1) + "</p>")
+		}
+	}
+	return sb.String()
+}
+
+// textToHTML escapes plain text and wraps its paragraphs in <p>
+func textToHTML(text string) string {
+	return wpautop(html.EscapeString(text))
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	buf, err := ioutil.ReadAll(io.LimitReader(rc, maxArchiveFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(buf) > maxArchiveFileSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", f.Name, maxArchiveFileSize)
+	}
+
+	return buf, nil
+}
+
+func readZipXML(f *zip.File, x interface{}) error {
+	buf, err := readZipFile(f)
+	if err != nil {
+		return err
+	}
+
+	return xml.Unmarshal(buf, x)
+}
+
+// naturalLess compares names with runs of digits compared as numbers, so
+// chapter-2 sorts before chapter-10
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		da, db := leadingDigits(a), leadingDigits(b)
+		if da != "" && db != "" {
+			na, _ := strconv.Atoi(da)
+			nb, _ := strconv.Atoi(db)
+			if na != nb {
+				return na < nb
+			}
+			a, b = a[len(da):], b[len(db):]
+			continue
+		}
+
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+
+	return len(a) < len(b)
+}
+
+func leadingDigits(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
@@ -0,0 +1,147 @@
+package hydrocarbon
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+	"time"
+)
+
+func buildZip(t *testing.T, files [][2]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = w.Write([]byte(f[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestParseArchive(t *testing.T) {
+	t.Parallel()
+
+	epub := buildZip(t, [][2]string{
+		{"mimetype", "application/epub+zip"},
+		{"META-INF/container.xml", `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+	<rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`},
+		{"OEBPS/content.opf", `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" xmlns:dc="http://purl.org/dc/elements/1.1/" version="3.0">
+	<metadata><dc:title>Worm</dc:title><dc:creator>Wildbow</dc:creator><dc:date>2013-11-19</dc:date></metadata>
+	<manifest>
+		<item id="cover" href="cover.xhtml" media-type="application/xhtml+xml"/>
+		<item id="c1" href="text/chapter%201.xhtml" media-type="application/xhtml+xml"/>
+		<item id="c2" href="text/chapter2.xhtml" media-type="application/xhtml+xml"/>
+		<item id="css" href="style.css" media-type="text/css"/>
+	</manifest>
+	<spine><itemref idref="cover"/><itemref idref="c2"/><itemref idref="c1"/></spine>
+</package>`},
+		{"OEBPS/cover.xhtml", `<html><body><img src="cover.jpg"/></body></html>`},
+		{"OEBPS/text/chapter 1.xhtml", `<html><head><title>ignored</title></head><body><h1>Gestation 1.1</h1><p>Brief note.</p></body></html>`},
+		{"OEBPS/text/chapter2.xhtml", `<html><head><title>Interlude 1</title></head><body><p>Second <script>x</script>part.</p></body></html>`},
+	})
+
+	posts, err := ParseArchive(epub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(posts) != 2 {
+		t.Fatalf("expected 2 chapters, got %d", len(posts))
+	}
+	if posts[0].Title != "Interlude 1" || posts[1].Title != "Gestation 1.1" {
+		t.Errorf("chapters are not in spine order: %q, %q", posts[0].Title, posts[1].Title)
+	}
+	if posts[0].Body != "<p>Second part.</p>" {
+		t.Errorf("unexpected body %q", posts[0].Body)
+	}
+	if posts[1].OriginalURL != "#chapter-2" || posts[1].Author != "Wildbow" {
+		t.Errorf("unexpected url %q or author %q", posts[1].OriginalURL, posts[1].Author)
+	}
+	if !posts[0].PostedAt.Before(posts[1].PostedAt) || !posts[1].PostedAt.Equal(time.Date(2013, 11, 19, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected dates %s, %s", posts[0].PostedAt, posts[1].PostedAt)
+	}
+
+	chapters, err := ParseArchive(buildZip(t, [][2]string{
+		{"chapter-10.txt", "ten"},
+		{"chapter-2.html", "<p>two</p>"},
+		{"notes.pdf", "skipped"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(chapters) != 2 || chapters[0].Title != "chapter-2" || chapters[1].Body != "<p>ten</p>" {
+		t.Errorf("unexpected chapters %+v %+v", chapters[0], chapters[1])
+	}
+
+	wxr := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/" xmlns:excerpt="http://wordpress.org/export/1.2/excerpt/"
+	xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:wp="http://wordpress.org/export/1.2/">
+<channel>
+	<title>A Blog</title>
+	<item>
+		<title>Hello &amp;amp; welcome</title>
+		<link>https://blog.example.com/hello</link>
+		<pubDate>Mon, 02 Jan 2017 15:04:05 +0000</pubDate>
+		<dc:creator>admin</dc:creator>
+		<content:encoded><![CDATA[First paragraph.
+
+Second paragraph.]]></content:encoded>
+		<excerpt:encoded><![CDATA[an excerpt]]></excerpt:encoded>
+		<wp:post_id>1</wp:post_id>
+		<wp:post_date_gmt>2017-01-02 15:04:05</wp:post_date_gmt>
+		<wp:status>publish</wp:status>
+		<wp:post_type>post</wp:post_type>
+	</item>
+	<item>
+		<title>logo.png</title>
+		<link>https://blog.example.com/logo</link>
+		<wp:post_id>2</wp:post_id>
+		<wp:status>inherit</wp:status>
+		<wp:post_type>attachment</wp:post_type>
+	</item>
+</channel>
+</rss>`)
+
+	posts, err = ParseArchive(wxr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(posts) != 1 {
+		t.Fatalf("expected 1 post, got %d", len(posts))
+	}
+
+	p := posts[0]
+	if p.Title != "Hello & welcome" || p.Author != "admin" || p.OriginalURL != "https://blog.example.com/hello" {
+		t.Errorf("unexpected post %+v", p)
+	}
+	if p.Body != "<p>First paragraph.</p><p>Second paragraph.</p>" {
+		t.Errorf("unexpected body %q", p.Body)
+	}
+	if !p.PostedAt.Equal(time.Date(2017, 1, 2, 15, 4, 5, 0, time.UTC)) {
+		t.Errorf("unexpected date %s", p.PostedAt)
+	}
+
+	_, err = ParseArchive([]byte("just some text"))
+	if err != errUnknownArchive {
+		t.Errorf("expected unknown archive, got %v", err)
+	}
+}
@@ -0,0 +1,407 @@
+package hydrocarbon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrReadOnly is returned for any write made by a user whose trial has ended
+// without a subscription
+var ErrReadOnly = errors.New("trial expired, subscribe to make changes")
+
+var (
+	errCouponRedeemed   = errors.New("this code has already been redeemed")
+	errPaymentsDisabled = errors.New("payments are not enabled on this instance")
+)
+
+// A BillingStore is an interface used to seperate the BillingAPI from
+// knowledge of the actual underlying database
+type BillingStore interface {
+	GetBillingStatus(ctx context.Context, sessionKey string) (*BillingStatus, error)
+	GetStripeCustomerID(ctx context.Context, sessionKey string) (string, error)
+	GetPlanUsage(ctx context.Context, sessionKey string) (*PlanUsage, error)
+
+	// GetStripeSubscription returns the users ID and stripe subscription ID
+	GetStripeSubscription(ctx context.Context, sessionKey string) (string, string, error)
+	// RecordCouponRedemption records that the user has redeemed the code, it
+	// returns false if they already had
+	RecordCouponRedemption(ctx context.Context, userID, code string) (bool, error)
+	// DeleteCouponRedemption forgets a redemption whose coupon could not be
+	// applied
+	DeleteCouponRedemption(ctx context.Context, userID, code string) error
+
+	// EndSubscription removes a subscription once the provider has ended it,
+	// moving its user back to the free plan
+	EndSubscription(ctx context.Context, subscriptionID string) error
+	// UpdateSubscription moves the user with the subscription to the plan
+	// billed as planID, once the provider has taken payment for it
+	UpdateSubscription(ctx context.Context, subscriptionID, planID string) error
+
+	// GetPaymentPlanID returns the provider plan the named plan is billed as
+	GetPaymentPlanID(ctx context.Context, name string) (string, error)
+	SetPlan(ctx context.Context, userID, name string) error
+}
+
+// BillingAPI encapsulates everything related to trials and subscriptions
+type BillingAPI struct {
+	paymentRequired bool
+	domain          string
+	pp              PaymentProvider
+	s               BillingStore
+	ks              *KeySigner
+}
+
+// NewBillingAPI returns a new BillingAPI, trials are only enforced and a
+// payment provider is only contacted if pp is not nil
+func NewBillingAPI(s BillingStore, ks *KeySigner, pp PaymentProvider, domain string) *BillingAPI {
+	return &BillingAPI{
+		paymentRequired: pp != nil,
+		domain:          domain,
+		pp:              pp,
+		s:               s,
+		ks:              ks,
+	}
+}
+
+// Status writes out the trial and subscription state of the current user
+func (ba *BillingAPI) Status(w http.ResponseWriter, r *http.Request) error {
+	key, err := ba.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	bs, err := ba.s.GetBillingStatus(r.Context(), key)
+	if err != nil {
+		return err
+	}
+
+	var status = struct {
+		TrialEndsAt time.Time `json:"trial_ends_at"`
+		Trialing    bool      `json:"trialing"`
+		Subscribed  bool      `json:"subscribed"`
+		ReadOnly    bool      `json:"read_only"`
+	}{
+		bs.TrialEndsAt,
+		bs.Trialing(),
+		bs.Subscribed,
+		ba.paymentRequired && bs.ReadOnly(),
+	}
+
+	return writeSuccess(w, status)
+}
+
+// Usage writes out the current users plan and how much of it they have used
+// this billing period
+func (ba *BillingAPI) Usage(w http.ResponseWriter, r *http.Request) error {
+	key, err := ba.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	usage, err := ba.s.GetPlanUsage(r.Context(), key)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, usage)
+}
+
+// ListInvoices writes out every past invoice for the current user as well as
+// the upcoming invoice, if they are subscribed
+func (ba *BillingAPI) ListInvoices(w http.ResponseWriter, r *http.Request) error {
+	if !ba.paymentRequired {
+		return errPaymentsDisabled
+	}
+
+	ip, ok := ba.pp.(InvoiceProvider)
+	if !ok {
+		return ErrUnsupportedPayment
+	}
+
+	key, err := ba.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	customerID, err := ba.s.GetStripeCustomerID(r.Context(), key)
+	if err != nil {
+		return err
+	}
+
+	var history struct {
+		Invoices []*Invoice `json:"invoices"`
+		Upcoming *Invoice   `json:"upcoming,omitempty"`
+	}
+
+	history.Invoices, err = ip.ListInvoices(r.Context(), customerID)
+	if err != nil {
+		return err
+	}
+
+	bs, err := ba.s.GetBillingStatus(r.Context(), key)
+	if err != nil {
+		return err
+	}
+
+	if bs.Subscribed {
+		history.Upcoming, err = ip.UpcomingInvoice(r.Context(), customerID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeSuccess(w, history)
+}
+
+// CreatePortalSession creates a customer portal session for the current user
+// and writes out the URL to redirect them to, where they can update their card
+// or cancel their subscription
+func (ba *BillingAPI) CreatePortalSession(w http.ResponseWriter, r *http.Request) error {
+	if !ba.paymentRequired {
+		return errPaymentsDisabled
+	}
+
+	pp, ok := ba.pp.(PortalProvider)
+	if !ok {
+		return ErrUnsupportedPayment
+	}
+
+	key, err := ba.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	customerID, err := ba.s.GetStripeCustomerID(r.Context(), key)
+	if err != nil {
+		return err
+	}
+
+	u, err := pp.PortalURL(r.Context(), customerID, ba.domain+"/settings")
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, map[string]string{
+		"url": u,
+	})
+}
+
+// RedeemCoupon applies a coupon to the current users subscription, each code
+// can only be redeemed once per user
+func (ba *BillingAPI) RedeemCoupon(w http.ResponseWriter, r *http.Request) error {
+	if !ba.paymentRequired {
+		return errPaymentsDisabled
+	}
+
+	cp, ok := ba.pp.(CouponProvider)
+	if !ok {
+		return ErrUnsupportedPayment
+	}
+
+	key, err := ba.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	err = limitDecoder(r, &req)
+	if err != nil {
+		return err
+	}
+
+	code := strings.TrimSpace(req.Code)
+	if code == "" {
+		return errors.New("no code sent")
+	}
+
+	userID, subID, err := ba.s.GetStripeSubscription(r.Context(), key)
+	if err != nil {
+		return err
+	}
+
+	c, err := cp.GetCoupon(r.Context(), code)
+	if err != nil {
+		return err
+	}
+
+	// recorded before it is applied, so requests made at once can not both
+	// redeem the code
+	recorded, err := ba.s.RecordCouponRedemption(r.Context(), userID, code)
+	if err != nil {
+		return err
+	}
+
+	if !recorded {
+		return errCouponRedeemed
+	}
+
+	err = cp.ApplyCoupon(r.Context(), subID, code)
+	if err != nil {
+		releaseCoupon(r.Context(), ba.s, userID, code)
+		return err
+	}
+
+	return writeSuccess(w, c)
+}
+
+// releaseCoupon deletes the redemption of a code that could not be applied,
+// so the user can redeem it again
+func releaseCoupon(ctx context.Context, s interface {
+	DeleteCouponRedemption(ctx context.Context, userID, code string) error
+}, userID, code string) {
+	err := s.DeleteCouponRedemption(ctx, userID, code)
+	if err != nil {
+		log.Println("hydrocarbon: could not release coupon", code, "of", userID, err)
+	}
+}
+
+// CancelSubscription cancels the current users subscription at the end of
+// the period they have already paid for
+func (ba *BillingAPI) CancelSubscription(w http.ResponseWriter, r *http.Request) error {
+	if !ba.paymentRequired {
+		return errPaymentsDisabled
+	}
+
+	key, err := ba.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	_, subID, err := ba.s.GetStripeSubscription(r.Context(), key)
+	if err != nil {
+		return err
+	}
+
+	err = ba.pp.Cancel(r.Context(), subID)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, nil)
+}
+
+// ChangePlan switches the current users subscription to another plan
+// immediately, the provider prorates the rest of the billing period. The new
+// plans limits apply as soon as this returns, and are written out
+func (ba *BillingAPI) ChangePlan(w http.ResponseWriter, r *http.Request) error {
+	if !ba.paymentRequired {
+		return errPaymentsDisabled
+	}
+
+	pc, ok := ba.pp.(PlanChanger)
+	if !ok {
+		return ErrUnsupportedPayment
+	}
+
+	key, err := ba.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		Plan string `json:"plan"`
+	}
+	err = limitDecoder(r, &req)
+	if err != nil {
+		return err
+	}
+
+	if req.Plan == "" {
+		return errors.New("no plan sent")
+	}
+
+	usage, err := ba.s.GetPlanUsage(r.Context(), key)
+	if err != nil {
+		return err
+	}
+
+	if usage.Plan.Name == req.Plan {
+		return fmt.Errorf("already on the %s plan", req.Plan)
+	}
+
+	userID, subID, err := ba.s.GetStripeSubscription(r.Context(), key)
+	if err != nil {
+		return err
+	}
+
+	planID, err := ba.s.GetPaymentPlanID(r.Context(), req.Plan)
+	if err != nil {
+		return err
+	}
+
+	// moving between plans billed alike would change the limits without
+	// changing what is paid
+	if current, err := ba.s.GetPaymentPlanID(r.Context(), usage.Plan.Name); err == nil && current == planID {
+		return fmt.Errorf("the %s and %s plans are billed as the same plan", usage.Plan.Name, req.Plan)
+	}
+
+	err = pc.ChangePlan(r.Context(), subID, planID)
+	if err != nil {
+		return err
+	}
+
+	err = ba.s.SetPlan(r.Context(), userID, req.Plan)
+	if err != nil {
+		return err
+	}
+
+	usage, err = ba.s.GetPlanUsage(r.Context(), key)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, usage)
+}
+
+// Webhook receives event notifications from the payment provider
+func (ba *BillingAPI) Webhook(w http.ResponseWriter, r *http.Request) error {
+	if !ba.paymentRequired {
+		return errPaymentsDisabled
+	}
+
+	return ba.pp.WebhookHandler(ba.handlePaymentEvent)(w, r)
+}
+
+func (ba *BillingAPI) handlePaymentEvent(ctx context.Context, e *PaymentEvent) error {
+	switch e.Type {
+	case PaymentSubscriptionEnded:
+		return ba.s.EndSubscription(ctx, e.SubscriptionID)
+	case PaymentSubscriptionUpdated:
+		return ba.s.UpdateSubscription(ctx, e.SubscriptionID, e.PlanID)
+	}
+
+	return nil
+}
+
+// RequireWritable wraps an ErrorHandler so that it is only called for users
+// that are trialing or subscribed, it is a no-op on a nil BillingAPI
+func (ba *BillingAPI) RequireWritable(next ErrorHandler) ErrorHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if ba == nil || !ba.paymentRequired {
+			return next(w, r)
+		}
+
+		key, err := ba.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+		if err != nil {
+			return err
+		}
+
+		bs, err := ba.s.GetBillingStatus(r.Context(), key)
+		if err != nil {
+			return err
+		}
+
+		if bs.ReadOnly() {
+			return ErrReadOnly
+		}
+
+		return next(w, r)
+	}
+}
@@ -0,0 +1,38 @@
+package hydrocarbon
+
+import "context"
+
+// the kinds of Change
+const (
+	// ChangePost is a post written or updated in a feed
+	ChangePost = "post"
+	// ChangeScrape is a scrape of a feed moving to another state
+	ChangeScrape = "scrape"
+	// ChangeFollow is the user following or unfollowing a feed
+	ChangeFollow = "follow"
+	// ChangeRead is the user marking posts of a feed read or unread, from
+	// any of their sessions
+	ChangeRead = "read"
+)
+
+// A Change is something that happened to a feed a user follows, so clients
+// can refresh what they show instead of polling for it
+type Change struct {
+	Kind string `json:"kind"`
+	// ID is the ID of the post or scrape that changed, empty for follows
+	// and for many posts of a feed marked read at once
+	ID     string `json:"id,omitempty"`
+	FeedID string `json:"feed_id"`
+	// State is the state a scrape moved to, or read or unread for posts
+	// marked read or unread
+	State string `json:"state,omitempty"`
+}
+
+// A ChangeStore lets users subscribe to changes to the feeds they follow
+type ChangeStore interface {
+	// SubscribeChanges returns the changes to the feeds the user follows
+	// until ctx is done, when the channel is closed. Changes a subscriber is
+	// too slow to receive are dropped, so it should refetch what it shows
+	// now and then
+	SubscribeChanges(ctx context.Context, sessionKey string) (<-chan *Change, error)
+}
@@ -2,55 +2,280 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
+	"encoding/base64"
 	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/NYTimes/gziphandler"
 	"github.com/oklog/run"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 
 	"github.com/fortytw2/hydrocarbon"
 	"github.com/fortytw2/hydrocarbon/discollect"
 	"github.com/fortytw2/hydrocarbon/discollect/redis"
 	"github.com/fortytw2/hydrocarbon/gcs"
+	"github.com/fortytw2/hydrocarbon/memstore"
 	"github.com/fortytw2/hydrocarbon/pg"
 	"github.com/fortytw2/hydrocarbon/postmark"
+	"github.com/fortytw2/hydrocarbon/rediscache"
+	"github.com/fortytw2/hydrocarbon/s3"
+	"github.com/fortytw2/hydrocarbon/stripe"
 
+	"github.com/fortytw2/hydrocarbon/plugins/external"
+	"github.com/fortytw2/hydrocarbon/plugins/federation"
 	"github.com/fortytw2/hydrocarbon/plugins/fictionpress"
+	"github.com/fortytw2/hydrocarbon/plugins/goodreads"
 	"github.com/fortytw2/hydrocarbon/plugins/jsonfeed"
+	"github.com/fortytw2/hydrocarbon/plugins/mastodon"
+	"github.com/fortytw2/hydrocarbon/plugins/nitter"
 	"github.com/fortytw2/hydrocarbon/plugins/parahumans"
+	"github.com/fortytw2/hydrocarbon/plugins/patreon"
+	"github.com/fortytw2/hydrocarbon/plugins/royalroad"
 	"github.com/fortytw2/hydrocarbon/plugins/rss"
+	"github.com/fortytw2/hydrocarbon/plugins/scribblehub"
+	"github.com/fortytw2/hydrocarbon/plugins/tapas"
+	"github.com/fortytw2/hydrocarbon/plugins/tumblr"
+	"github.com/fortytw2/hydrocarbon/plugins/wasm"
+	"github.com/fortytw2/hydrocarbon/plugins/watch"
+	"github.com/fortytw2/hydrocarbon/plugins/webtoons"
+	"github.com/fortytw2/hydrocarbon/plugins/wordpress"
+	"github.com/fortytw2/hydrocarbon/plugins/xenforo"
 
 	"github.com/heroku/x/hmetrics"
 )
 
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+// a store is everything hydrocarbon keeps, in postgres or in memory for demos
+type store interface {
+	hydrocarbon.UserStore
+	hydrocarbon.FeedStore
+	hydrocarbon.ReadStatusStore
+	hydrocarbon.BillingStore
+	hydrocarbon.AdminStore
+	hydrocarbon.FederationStore
+	hydrocarbon.ActivityPubStore
+	hydrocarbon.NewsletterStore
+	hydrocarbon.PendingFeedStore
+	hydrocarbon.KeyUsageStore
+	hydrocarbon.QualityStore
+	hydrocarbon.HealthStore
+	hydrocarbon.ChangeStore
+	hydrocarbon.FeverStore
+	hydrocarbon.GReaderStore
+	hydrocarbon.ExportStore
+
+	discollect.Writer
+	discollect.Metastore
+	discollect.NodeRegistry
+	discollect.LogStore
+	discollect.CredentialStore
+
+	SetSanitizer(*hydrocarbon.Sanitizer)
+	DisablePlans()
+}
+
 func main() {
 	var g run.Group
 
 	var (
-		autoExplain   = flag.Bool("autoexplain", false, "run EXPLAIN on every database query")
+		slowQuery     = flag.Duration("slow-query", time.Second, "log database queries that take at least this long, with their parameters redacted, 0 disables")
 		noEmailVerify = flag.Bool("no-email-verify", false, "send login links in response to token request")
+		maintenance   = flag.Bool("maintenance", false, "periodically ANALYZE tables heavily written to by scrapes, prune old scrape logs and host rate limits, index old posts for search and prune posts past -retain-posts and -retain-for")
+		retainPosts   = flag.Int("retain-posts", 0, "with -maintenance, keep at least this many of the newest posts of every feed, 0 disables")
+		retainFor     = flag.Duration("retain-for", 0, "with -maintenance, keep every post posted within this long, 0 disables, posts kept by either rule or starred are never pruned")
+		purgeAfter    = flag.Duration("purge-after", 30*24*time.Hour, "with -maintenance, permanently delete feeds, folders and posts this long after they were deleted, 0 keeps them to be restored forever")
+		rotateKeys    = flag.Bool("rotate-keys", false, "with -maintenance, reseal post bodies and credentials sealed with any key other than the active one of ENCRYPTION_KEYS")
+		selfHosted    = flag.Bool("self-hosted", false, "disable billing entirely, ignoring any stripe configuration")
+		dedupDistance = flag.Int("dedup-distance", 0, "merge posts whose simhash differs by at most this many bits, 0 disables")
+		compression   = flag.String("compression", "gzip", "codec new post bodies are stored with, gzip or zstd, bodies already stored stay readable")
+		dictSamples   = flag.Int("zstd-samples", 1000, "recent posts a zstd dictionary is trained on when there is none yet, 0 compresses without one")
+		bodyDir       = flag.String("body-dir", "", "directory large post bodies are kept in instead of postgres, unless BODY_BUCKET is set")
+		bodyMinSize   = flag.Int("body-min-size", 64<<10, "bytes a post body must be to be kept outside of postgres, with -body-dir or BODY_BUCKET")
+		dedupWindow   = flag.Duration("dedup-window", 72*time.Hour, "how far back to look for near-duplicate posts")
+		hostRate      = flag.Float64("host-rate", 1, "requests per second allowed to any one domain, 0 disables")
+		sharedRates   = flag.Bool("shared-host-rates", true, "keep per domain rate limits in postgres, so they hold across restarts and nodes")
+		hostRates     = flag.String("host-rates", "", "per domain overrides of -host-rate, i.e. fanfiction.net=0.5,example.com=2")
+		queueLimit    = flag.Int("queue-limit", 10000, "tasks the in-memory queue holds before handlers queueing more are held back, 0 is unlimited")
+		maxRequests   = flag.Int("max-requests", 0, "requests in flight allowed across every site, 0 is unlimited")
+		hostDelay     = flag.Duration("host-delay", 0, "least time between the start of two requests to one host")
+		hostParallel  = flag.Int("host-parallelism", 0, "requests in flight allowed to any one host, 0 is unlimited")
+		breakAfter    = flag.Int("breaker-threshold", 5, "failed requests in a row after which a host is given a rest, 0 disables")
+		breakFor      = flag.Duration("breaker-cooldown", 5*time.Minute, "how long a host that keeps failing is given a rest")
+		scrapeLogs    = flag.Bool("scrape-logs", false, "log every request scrapes make, viewable by admins per scrape. They are only pruned by -maintenance")
+		userAgent     = flag.String("user-agent", "", "User-Agent sent by every scrape request in place of those of plugins, empty keeps them")
+		taskTimeout   = flag.Duration("task-timeout", 3*time.Minute, "how long one task may run before it is retried, unless its plugin sets its own")
+		shutdownGrace = flag.Duration("shutdown-grace", 30*time.Second, "how long tasks in flight may run on shutdown before they are abandoned and retried")
+		noScrape      = flag.Bool("no-scrape", false, "only serve the api, new feeds are left pending for scraping nodes to resolve")
+		qualitySample = flag.Int("quality-samples", 50, "posts per plugin sampled each day for quality metrics, 0 disables")
+		httpCache     = flag.Bool("http-cache", false, "keep the last response to every page scraped, so unchanged pages are revalidated with a 304")
+		redisQueue    = flag.String("redis-queue", "lists", "queue used when REDIS_URL is set, lists or streams, streams reclaim tasks of dead nodes and need redis 6.2+")
+		pgMaxOpen     = flag.Int("pg-max-open", 40, "connections open to postgres, and to each replica, at once, 0 is unlimited")
+		pgMaxIdle     = flag.Int("pg-max-idle", 10, "unused connections kept open to postgres, and to each replica")
+		pgLifetime    = flag.Duration("pg-conn-lifetime", 30*time.Minute, "how long a postgres connection is used before it is replaced, 0 keeps them forever")
+		pgTimeout     = flag.Duration("pg-statement-timeout", 30*time.Second, "how long postgres runs any one statement before cancelling it, 0 disables")
+		backupCmd     = flag.String("backup-cmd", "", "shell command taking a backup, such as pg_dump or wal-g backup-push, run every -backup-interval by one node at a time, the last line it prints is recorded as where the backup is")
+		backupVerify  = flag.String("backup-verify-cmd", "", "with -backup-cmd, shell command verifying each backup, given its location in $HC_BACKUP_LOCATION")
+		backupEvery   = flag.Duration("backup-interval", 24*time.Hour, "with -backup-cmd, how often a backup is taken")
+		maxBackupAge  = flag.Duration("max-backup-age", 0, "fail /backupz while no backup has succeeded within this long, 0 only reports the last backup")
+		maxLag        = flag.Duration("max-replica-lag", 0, "read from the primary rather than a postgres replica further behind than this, until it catches up, 0 disables")
+		tenants       = flag.Bool("tenants", false, "run api requests in the postgres schema of the tenant of their user, see hydrocarbon tenant, needs -no-scrape")
+		tenant        = flag.String("tenant", "", "run everything in the postgres schema of this tenant, for its scraping and maintenance nodes")
+		migrate       = flag.Bool("migrate", false, "run pending migrations at startup, otherwise hydrocarbon refuses to start until they are run with hydrocarbon migrate up")
+		demo          = flag.Bool("demo", false, "keep everything in memory instead of postgres, with billing disabled, nothing is kept once hydrocarbon exits")
 	)
 
 	flag.Parse()
 
-	dsn := os.Getenv("POSTGRES_DSN")
-	if dsn == "" {
-		dsn = os.Getenv("DATABASE_URL")
+	if flag.Arg(0) == "migrate" {
+		err := runMigrate(context.Background(), flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return
 	}
 
-	if dsn == "" {
-		log.Fatal("no postgres dsn found")
+	if flag.Arg(0) == "tenant" {
+		err := runTenant(context.Background(), flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return
 	}
 
-	db, err := pg.NewDB(dsn, *autoExplain)
+	shutdownTracing, err := setupTracing(context.Background())
 	if err != nil {
-		log.Fatal("could not connect to postgres", err)
+		log.Fatal("could not set up tracing", err)
+	}
+
+	// db is left nil in demo mode, everything only postgres can do is skipped
+	var (
+		db *pg.DB
+		st store
+	)
+	if *demo && (*tenants || *tenant != "") {
+		log.Fatal("tenants need postgres, they can not be used with -demo")
+	}
+	// api nodes serving every tenant can not know which tenant a scrape is for
+	if *tenants && !*noScrape {
+		log.Fatal("-tenants needs -no-scrape, scrape each tenant with nodes started with -tenant")
+	}
+
+	if *demo {
+		log.Println("hydrocarbon: demo mode, everything is kept in memory and lost on exit")
+		*selfHosted = true
+		*sharedRates = false
+		st = memstore.New()
+	} else {
+		dsn, err := postgresDSN()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = checkMigrations(context.Background(), dsn, *migrate)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		opts := []pg.OptionFn{
+			pg.WithMaxOpenConns(*pgMaxOpen),
+			pg.WithMaxIdleConns(*pgMaxIdle),
+			pg.WithConnMaxLifetime(*pgLifetime),
+			pg.WithStatementTimeout(*pgTimeout),
+			pg.WithSlowQueryLog(*slowQuery),
+			pg.WithMaxReplicaLag(*maxLag),
+		}
+
+		// reads that can lag behind writes are spread over any replicas
+		var replicaDSNs []string
+		for _, rdsn := range strings.Split(os.Getenv("POSTGRES_REPLICA_DSNS"), ",") {
+			if rdsn = strings.TrimSpace(rdsn); rdsn != "" {
+				replicaDSNs = append(replicaDSNs, rdsn)
+			}
+		}
+		if len(replicaDSNs) > 0 {
+			log.Println("hydrocarbon: reading from", len(replicaDSNs), "postgres replicas")
+			opts = append(opts, pg.WithReplicas(replicaDSNs...))
+		}
+
+		if *tenants || *tenant != "" {
+			opts = append(opts, pg.WithTenants(*tenant))
+		}
+
+		db, err = pg.NewDB(dsn, opts...)
+		if err != nil {
+			log.Fatal("could not connect to postgres", err)
+		}
+
+		err = db.SetCompression(context.Background(), *compression, *dictSamples)
+		if err != nil {
+			log.Fatal("could not set up compression", err)
+		}
+
+		// large bodies go to their own bucket, as images are public and
+		// bodies are not
+		var bs pg.BlobStore
+		if bucket, ok := os.LookupEnv("BODY_BUCKET"); ok {
+			bs, err = s3.NewBlobStore(os.Getenv("S3_ENDPOINT"), os.Getenv("AWS_REGION"), bucket,
+				os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"))
+		} else if *bodyDir != "" {
+			bs, err = pg.NewDirBlobStore(*bodyDir)
+		}
+		if err != nil {
+			log.Fatal("could not set up the body store", err)
+		}
+		if bs != nil {
+			log.Println("hydrocarbon: keeping post bodies of at least", *bodyMinSize, "bytes outside of postgres")
+			db.SetBlobStore(bs, *bodyMinSize)
+		}
+
+		// the cache is best kept apart from the queue, as it may evict
+		if addr := os.Getenv("CACHE_REDIS_URL"); addr != "" {
+			c, err := rediscache.New(addr, 0)
+			if err != nil {
+				log.Fatal("could not connect to the redis cache", err)
+			}
+			log.Println("hydrocarbon: caching folders and posts in redis")
+			db.SetCache(c)
+		}
+
+		if *tenants {
+			err = db.EnableTenants(context.Background())
+			if err != nil {
+				log.Fatal("could not set up tenants", err)
+			}
+			log.Println("hydrocarbon: running api requests in the schema of their tenant")
+		} else if *tenant != "" {
+			log.Println("hydrocarbon: running in the schema of tenant", *tenant)
+		}
+
+		if *dedupDistance > 0 {
+			log.Println("hydrocarbon: merging near-duplicate posts within", *dedupDistance, "bits over", *dedupWindow)
+			db.SetDedup(*dedupDistance, *dedupWindow)
+		}
+
+		st = db
 	}
 
 	var domain string
@@ -100,9 +325,28 @@ func main() {
 
 	ks := hydrocarbon.NewKeySigner(signingKey)
 
+	// other instances can only follow public feeds when a federation key is set
+	var fedKey ed25519.PrivateKey
+	if fk := os.Getenv("FEDERATION_KEY"); fk != "" {
+		seed, err := base64.StdEncoding.DecodeString(fk)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			log.Fatal("FEDERATION_KEY must be a base64 encoded 32 byte ed25519 seed")
+		}
+		log.Println("federation enabled")
+		fedKey = ed25519.NewKeyFromSeed(seed)
+	} else {
+		log.Println("no federation key, federation disabled")
+	}
+
 	// enable stripe
+	var pp hydrocarbon.PaymentProvider
 	stripePrivKey, paymentEnabled := os.LookupEnv("STRIPE_PRIVATE_TOKEN")
-	if paymentEnabled {
+	if *selfHosted {
+		// without billing there is nothing to pay for more with
+		st.DisablePlans()
+		log.Println("self-hosted, billing disabled")
+	} else if paymentEnabled {
+		pp = stripe.NewProvider(stripePrivKey, os.Getenv("STRIPE_WEBHOOK_SECRET"))
 		log.Println("payment enabled, tokens required to login")
 	} else {
 		log.Println("payment not enabled, set STRIPE_PRIVATE_TOKEN to enable")
@@ -115,6 +359,13 @@ func main() {
 			log.Fatal(err)
 		}
 		fs = gcpFS
+	} else if bucket, ok := os.LookupEnv("S3_BUCKET"); ok {
+		s3FS, err := s3.NewFileStore(os.Getenv("S3_ENDPOINT"), os.Getenv("AWS_REGION"), bucket,
+			os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("S3_PUBLIC_URL"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		fs = s3FS
 	} else {
 		localFS, err := discollect.NewLocalFS("./images", imageDomain+"/static/images/")
 		if err != nil {
@@ -139,40 +390,293 @@ func main() {
 
 	var queue discollect.Queue
 	if redisAddr, ok := os.LookupEnv("REDIS_URL"); ok {
-		queue, err = redis.NewQueue(redisAddr, 0)
+		switch *redisQueue {
+		case "lists":
+			queue, err = redis.NewQueue(redisAddr, 0)
+		case "streams":
+			queue, err = redis.NewStreamQueue(redisAddr, 0)
+		default:
+			err = fmt.Errorf("unknown redis queue %q", *redisQueue)
+		}
 		if err != nil {
 			log.Fatal(err)
 		}
 	} else {
-		queue = discollect.NewMemQueue()
+		queue = discollect.NewBoundedMemQueue(*queueLimit)
+	}
+
+	overrides, err := parseHostRates(*hostRates)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	limiter := discollect.NewHostLimiter(*hostRate, overrides)
+	if *sharedRates {
+		limiter = discollect.NewSharedHostLimiter(*hostRate, overrides, db)
+	}
+
+	// tumblr blogs are read from their RSS feeds without a key
+	tumblr.APIKey = os.Getenv("TUMBLR_API_KEY")
+	// twitter accounts can not be followed without a mirror to read them from
+	for _, inst := range strings.Split(os.Getenv("NITTER_INSTANCES"), ",") {
+		if inst = strings.TrimSpace(inst); inst != "" {
+			nitter.Instances = append(nitter.Instances, inst)
+		}
+	}
+
+	var closers []func()
+	fatal := func(v ...interface{}) {
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i]()
+		}
+		log.Fatal(v...)
 	}
 
-	dc, err := discollect.New(
-		// pg.DB is a discollect writer
+	plugins := []*discollect.Plugin{federation.Plugin, fictionpress.Plugin, parahumans.Plugin, royalroad.Plugin, scribblehub.Plugin, tapas.Plugin, tumblr.Plugin, watch.Plugin, webtoons.Plugin, xenforo.Plugin, mastodon.Plugin, nitter.Plugin, patreon.Plugin, goodreads.Plugin}
+	// community plugins built as their own binaries, ahead of the feeds that
+	// match any url. They are stopped on the way out, which log.Fatal skips
+	// defers for, so fatal stops them first
+	for _, path := range strings.Split(os.Getenv("EXTERNAL_PLUGINS"), ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+
+		proc, err := external.Load(path)
+		if err != nil {
+			fatal(err)
+		}
+		closers = append(closers, func() { proc.Close() })
+
+		plugins = append(plugins, proc.Plugin)
+	}
+	// and those compiled to WASM
+	if dir := os.Getenv("WASM_PLUGINS_DIR"); dir != "" {
+		rt, err := wasm.NewRuntime(context.Background())
+		if err != nil {
+			fatal(err)
+		}
+		closers = append(closers, func() { rt.Close(context.Background()) })
+
+		loaded, err := rt.LoadDir(context.Background(), dir)
+		if err != nil {
+			fatal(err)
+		}
+
+		plugins = append(plugins, loaded...)
+	}
+	// wordpress follows any site with a link to its API, so only once the
+	// generic feed plugins have turned a url down
+	plugins = append(plugins, rss.Plugin, jsonfeed.Plugin, wordpress.Plugin)
+	st.SetSanitizer(hydrocarbon.NewSanitizer(plugins...))
+
+	// every datum is also sent to any configured webhook
+	var writers []discollect.Writer
+	if hook := os.Getenv("WEBHOOK_URL"); hook != "" {
+		writers = append(writers, discollect.NewWebhookWriter(hook, os.Getenv("WEBHOOK_SECRET")))
+	}
+
+	dcOpts := []discollect.OptionFn{
+		// the store is a discollect writer
 		discollect.WithQueue(queue),
-		discollect.WithWriter(db),
-		discollect.WithMetastore(db),
+		discollect.WithLimiter(limiter),
+		discollect.WithWriters(st, writers...),
+		discollect.WithMetastore(st),
+		discollect.WithNodeRegistry(st, nodeVersion()),
 		discollect.WithFileStore(fs),
-		discollect.WithPlugins(fictionpress.Plugin, parahumans.Plugin, rss.Plugin, jsonfeed.Plugin),
-	)
+		discollect.WithPlugins(plugins...),
+	}
+
+	// raw responses are large, so only keep them when asked to
+	if os.Getenv("CAPTURE_SNAPSHOTS") != "" {
+		if db == nil {
+			fatal("CAPTURE_SNAPSHOTS needs postgres")
+		}
+		dcOpts = append(dcOpts, discollect.WithSnapshotStore(db))
+	}
+
+	if *httpCache {
+		if db == nil {
+			fatal("-http-cache needs postgres")
+		}
+		dcOpts = append(dcOpts, discollect.WithHTTPCache(db))
+	}
+
+	// enforced on every request, whatever the plugin making it
+	if *maxRequests > 0 || *hostDelay > 0 || *hostParallel > 0 {
+		dcOpts = append(dcOpts, discollect.WithPoliteness(discollect.Politeness{
+			MaxRequests:     *maxRequests,
+			HostDelay:       *hostDelay,
+			HostParallelism: *hostParallel,
+		}))
+	}
+
+	dcOpts = append(dcOpts, discollect.WithTaskTimeout(*taskTimeout))
+
+	if *userAgent != "" {
+		dcOpts = append(dcOpts, discollect.WithHeaders(http.Header{
+			"User-Agent": []string{*userAgent},
+		}))
+	}
+
+	if *scrapeLogs {
+		// another node may be the one running maintenance
+		if !*maintenance {
+			log.Println("hydrocarbon: scrape logs are only pruned by nodes started with -maintenance")
+		}
+		dcOpts = append(dcOpts, discollect.WithLogStore(st))
+	}
+
+	if *breakAfter > 0 {
+		dcOpts = append(dcOpts, discollect.WithCircuitBreaker(discollect.CircuitBreaker{
+			Threshold: *breakAfter,
+			Cooldown:  *breakFor,
+		}))
+	}
+
+	// post bodies and credentials are sealed with ENCRYPTION_KEYS, given
+	// directly or as a file, i.e. one a KMS or secret manager decrypts into
+	// place. The first key listed is used unless ENCRYPTION_KEY_ID says
+	// otherwise, the others only open what they sealed until -rotate-keys
+	// reseals it
+	encKeys := os.Getenv("ENCRYPTION_KEYS")
+	if path := os.Getenv("ENCRYPTION_KEYS_FILE"); path != "" {
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			fatal(err)
+		}
+		encKeys = string(buf)
+	}
+
+	// feeds can only be given credentials to log in with when a key is set
+	ck := os.Getenv("CREDENTIALS_KEY")
+	if encKeys != "" || ck != "" {
+		keys, first, err := parseEncryptionKeys(encKeys)
+		if err != nil {
+			fatal(err)
+		}
+
+		// credentials sealed with CREDENTIALS_KEY stay readable once keys
+		// are set, as the key called credentials
+		if ck != "" {
+			key, err := base64.StdEncoding.DecodeString(ck)
+			if err != nil {
+				fatal("CREDENTIALS_KEY must be a base64 encoded 32 byte key")
+			}
+			keys["credentials"] = key
+		}
+
+		// credentials and bodies are only encrypted at rest in postgres
+		if db != nil && encKeys != "" {
+			// snapshots and the http cache keep the pages bodies are
+			// scraped from as they were fetched, in the clear
+			if os.Getenv("CAPTURE_SNAPSHOTS") != "" || *httpCache {
+				fatal("ENCRYPTION_KEYS can not be used with CAPTURE_SNAPSHOTS or -http-cache, which keep pages unencrypted")
+			}
+
+			active := os.Getenv("ENCRYPTION_KEY_ID")
+			if active == "" {
+				active = first
+			}
+
+			err = db.SetEncryptionKeys(keys, active)
+			if err != nil {
+				fatal(err)
+			}
+			log.Println("hydrocarbon: sealing post bodies and credentials with key", active)
+		} else if db != nil {
+			err = db.SetCredentialKey(keys["credentials"])
+			if err != nil {
+				fatal(err)
+			}
+		}
+
+		log.Println("feed credentials enabled")
+		dcOpts = append(dcOpts, discollect.WithCredentialStore(st))
+	}
+
+	dc, err := discollect.New(dcOpts...)
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
+	}
+	// images are fetched from the same sites as the posts they are in
+	if db != nil {
+		db.SetImageStore(fs, dc.PoliteClient(&http.Client{Timeout: 30 * time.Second}))
 	}
 
-	ua := hydrocarbon.NewUserAPI(db, ks, m, "hydrocarbon", stripePrivKey, paymentEnabled)
+	ua := hydrocarbon.NewUserAPI(st, ks, m, pp, "hydrocarbon")
 	if noEmailVerify != nil && *noEmailVerify {
 		ua.DisableEmailVerification()
 	}
 
-	r := hydrocarbon.NewRouter(
-		ua,
-		hydrocarbon.NewFeedAPI(db, dc, ks),
-		hydrocarbon.NewReadStatusAPI(db, ks),
-		domain)
+	// self-hosted instances do not mount any billing routes
+	var ba *hydrocarbon.BillingAPI
+	if !*selfHosted {
+		ba = hydrocarbon.NewBillingAPI(st, ks, pp, domain)
+	}
+
+	// api only nodes add feeds as pending, scraping nodes resolve them
+	feedDC := dc
+	if *noScrape {
+		feedDC = nil
+	}
+
+	var fed *hydrocarbon.FederationAPI
+	if fedKey != nil {
+		fed = hydrocarbon.NewFederationAPI(st, fedKey, domain)
+	}
+
+	// newsletters are received once a domain has its mail sent on to the
+	// postmark inbound webhook
+	var na *hydrocarbon.NewsletterAPI
+	if nd := os.Getenv("NEWSLETTER_DOMAIN"); nd != "" {
+		auth := strings.SplitN(os.Getenv("POSTMARK_INBOUND_AUTH"), ":", 2)
+		if len(auth) != 2 || auth[1] == "" {
+			fatal("POSTMARK_INBOUND_AUTH must be set to user:password to receive newsletters")
+		}
+		log.Println("receiving newsletters at", nd)
+		na = hydrocarbon.NewNewsletterAPI(st, ks, &postmark.Receiver{Username: auth[0], Password: auth[1]}, nd)
+	}
+
+	fa := hydrocarbon.NewFeedAPI(st, feedDC, ks)
+	rs := hydrocarbon.NewReadStatusAPI(st, ks)
+	r := hydrocarbon.NewRouter(hydrocarbon.RouterConfig{
+		Users:       ua,
+		Feeds:       fa,
+		ReadStatus:  rs,
+		Admin:       hydrocarbon.NewAdminAPI(st, dc, ks),
+		Plugins:     hydrocarbon.NewPluginAPI(dc),
+		Billing:     ba,
+		Federation:  fed,
+		ActivityPub: hydrocarbon.NewActivityPubAPI(st, ks, domain),
+		Newsletters: na,
+		Fever:       hydrocarbon.NewFeverAPI(st, ks),
+		GReader:     hydrocarbon.NewGReaderAPI(st, ks),
+		Live:        hydrocarbon.NewLiveAPI(st, ks, domain),
+		Exports:     hydrocarbon.NewExportAPI(st, ks, domain),
+		Domain:      domain,
+	})
+
+	kt := hydrocarbon.NewKeyUsageTracker(st, ks, m)
+
+	// health checks are kept out of the logs, they are made every few seconds
+	ha := hydrocarbon.NewHealthAPI(st)
+	ha.SetMaxBackupAge(*maxBackupAge)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", ha.Healthz)
+	mux.HandleFunc("/readyz", ha.Readyz)
+	mux.HandleFunc("/backupz", ha.Backupz)
+	if db != nil {
+		mux.Handle("/metrics", metricsHandler(db, os.Getenv("METRICS_TOKEN")))
+	}
+	api := kt.Middleware(r)
+	if *tenants {
+		api = tenantMiddleware(db, ks, api)
+	}
+	mux.Handle("/", httpLogger(cspMiddleware(gziphandler.GzipHandler(api), imageDomain), "hydrocarbon-api"))
 
 	h := &http.Server{
 		Addr:    getPort("PORT", ":8080"),
-		Handler: httpLogger(cspMiddleware(gziphandler.GzipHandler(r), imageDomain), "hydrocarbon-api"),
+		Handler: mux,
 	}
 
 	// if running on heroku, start reporting enhanced language metrics
@@ -186,27 +690,107 @@ func main() {
 			}
 		})
 	}
-	{
+	// native clients are served over gRPC alongside the http api
+	if os.Getenv("GRPC_PORT") != "" {
+		// gRPC calls can not be told apart by tenant
+		if *tenants {
+			fatal("GRPC_PORT can not be used with -tenants")
+		}
+
+		lis, err := net.Listen("tcp", getPort("GRPC_PORT", ""))
+		if err != nil {
+			fatal(err)
+		}
+
+		gs := hydrocarbon.NewGRPCAPI(fa, rs, ba).Server()
+		log.Println("hydrocarbon: launching grpc server on port", getPort("GRPC_PORT", ""))
+		g.Add(func() error {
+			return gs.Serve(lis)
+		}, func(error) {
+			gs.GracefulStop()
+		})
+	}
+	if !*noScrape {
 		g.Add(func() error {
 			log.Println("launching scraper")
 			return dc.Start(3)
 		}, func(error) {
 			log.Println("shutting down scraper")
-			dc.Shutdown(context.Background())
+			ctx, cancel := context.WithTimeout(context.Background(), *shutdownGrace)
+			defer cancel()
+			dc.Shutdown(ctx)
+		})
+
+		fr := hydrocarbon.NewFeedResolver(st, dc)
+		g.Add(fr.Start, func(error) {
+			fr.Stop()
+		})
+
+		ap := hydrocarbon.NewActivityPublisher(st, domain)
+		g.Add(ap.Start, func(error) {
+			ap.Stop()
+		})
+	}
+	{
+		g.Add(kt.Start, func(error) {
+			kt.Stop()
+		})
+	}
+	if *qualitySample > 0 {
+		qs := hydrocarbon.NewQualitySampler(st, *qualitySample)
+		g.Add(func() error {
+			log.Println("launching quality sampler")
+			return qs.Start()
+		}, func(error) {
+			qs.Stop()
+		})
+	}
+	if *maintenance {
+		if db == nil {
+			fatal("-maintenance needs postgres")
+		}
+		m := pg.NewMaintainer(db)
+		if *retainPosts > 0 || *retainFor > 0 {
+			log.Println("hydrocarbon: pruning posts beyond the newest", *retainPosts, "of each feed and older than", *retainFor)
+			m.SetRetention(*retainPosts, *retainFor)
+		}
+		m.SetPurge(*purgeAfter)
+		m.SetKeyRotation(*rotateKeys)
+		g.Add(func() error {
+			log.Println("launching database maintenance")
+			return m.Start()
+		}, func(error) {
+			log.Println("stopping database maintenance")
+			m.Stop()
+		})
+	}
+	if *backupCmd != "" {
+		if db == nil {
+			fatal("-backup-cmd needs postgres")
+		}
+		b := pg.NewBackuper(db, *backupEvery, *backupCmd, *backupVerify)
+		g.Add(func() error {
+			log.Println("launching backups every", *backupEvery)
+			return b.Start()
+		}, func(error) {
+			log.Println("stopping backups")
+			b.Stop()
 		})
 	}
 	{
 		g.Add(func() error {
 			sigCh := make(chan os.Signal, 1)
 
-			signal.Notify(sigCh, os.Interrupt)
+			signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
 			<-sigCh
 
 			return errors.New("hydrocarbon: os initiated shutdown")
 		}, func(error) {})
 	}
 
-	log.Fatal(g.Run())
+	err = g.Run()
+	shutdownTracing(context.Background())
+	fatal(err)
 }
 
 func getPort(env string, def string) string {
@@ -224,10 +808,24 @@ func httpLogger(router http.Handler, prefix string) http.Handler {
 		router.ServeHTTP(w, req)
 		finishTime := time.Now()
 		elapsedTime := finishTime.Sub(startTime)
-		log.Println(prefix+":", hydrocarbon.GetRemoteIP(req), req.Method, req.URL, elapsedTime)
+		log.Println(prefix+":", hydrocarbon.GetRemoteIP(req), req.Method, redactKey(req.URL), elapsedTime)
 	})
 }
 
+// redactKey returns u with the session key websockets may send in their query
+// left out, so keys are never logged
+func redactKey(u *url.URL) *url.URL {
+	q := u.Query()
+	if q.Get("key") == "" {
+		return u
+	}
+
+	q.Set("key", "redacted")
+	ru := *u
+	ru.RawQuery = q.Encode()
+	return &ru
+}
+
 func cspMiddleware(router http.Handler, imageDomain string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		w.Header().Set("Content-Security-Policy", fmt.Sprintf(`default-src 'self' data:; style-src 'self' 'unsafe-inline' https://fonts.googleapis.com; font-src 'self' https://fonts.gstatic.com data:; img-src 'self' data: %s; object-src`, imageDomain))
@@ -236,6 +834,66 @@ func cspMiddleware(router http.Handler, imageDomain string) http.Handler {
 	})
 }
 
+// metricsHandler serves the query metrics of db for prometheus, to requests
+// bearing token if it is set
+func metricsHandler(db *pg.DB, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if token != "" && req.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		err := db.WriteQueryMetrics(w)
+		if err != nil {
+			log.Println("hydrocarbon: could not write metrics", err)
+		}
+	})
+}
+
+// setupTracing exports traces of requests, queries and scrapes over OTLP when
+// OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set,
+// the exporter reads the rest of its configuration from the environment.
+// The func returned flushes any spans not yet exported
+func setupTracing(ctx context.Context) (func(context.Context), error) {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func(context.Context) {}, nil
+	}
+
+	exp, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			attribute.String("service.name", "hydrocarbon"),
+			attribute.String("service.version", nodeVersion()),
+		),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+	)
+
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	log.Println("hydrocarbon: exporting traces")
+	return func(ctx context.Context) {
+		err := tp.Shutdown(ctx)
+		if err != nil {
+			log.Println("hydrocarbon: could not flush traces", err)
+		}
+	}, nil
+}
+
 func herokuMetrics() {
 	if os.Getenv("HEROKU_METRICS_URL") != "" {
 		var logger hmetrics.ErrHandler = func(_ error) error { return nil }
@@ -254,3 +912,66 @@ func herokuMetrics() {
 		}()
 	}
 }
+
+// parseHostRates parses a list of domain=rate pairs seperated by commas
+func parseHostRates(s string) (map[string]float64, error) {
+	rates := make(map[string]float64)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid host rate %q, expected domain=rate", pair)
+		}
+
+		rate, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid host rate %q: %s", pair, err)
+		}
+
+		rates[strings.ToLower(strings.TrimSpace(kv[0]))] = rate
+	}
+
+	return rates, nil
+}
+
+// parseEncryptionKeys parses a list of id=key pairs separated by commas or
+// newlines, keys are base64 encoded, and returns the ID of the first
+func parseEncryptionKeys(s string) (map[string][]byte, string, error) {
+	keys := make(map[string][]byte)
+	var first string
+	for _, pair := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, "", errors.New("invalid encryption key, expected id=base64 encoded key")
+		}
+
+		id := strings.TrimSpace(kv[0])
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid encryption key %q: %s", id, err)
+		}
+
+		if first == "" {
+			first = id
+		}
+		keys[id] = key
+	}
+
+	return keys, first, nil
+}
+
+// nodeVersion prefers the commit heroku deployed over the build-time version
+func nodeVersion() string {
+	if commit := os.Getenv("HEROKU_SLUG_COMMIT"); commit != "" {
+		return commit
+	}
+
+	return version
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/fortytw2/hydrocarbon/pg"
+)
+
+const migrateUsage = `usage: hydrocarbon migrate <command>
+
+  up       run every pending migration, in the schema of every tenant too
+  down     undo the latest migration run
+  status   list every migration and when it was run, in every schema
+  force N  record the first N migrations as run and the rest as pending,
+           without running any, after fixing a failed migration by hand`
+
+// postgresDSN returns the dsn of the primary postgres
+func postgresDSN() (string, error) {
+	dsn := os.Getenv("POSTGRES_DSN")
+	if dsn == "" {
+		dsn = os.Getenv("DATABASE_URL")
+	}
+
+	if dsn == "" {
+		return "", errors.New("no postgres dsn found, run with -demo to try hydrocarbon without one")
+	}
+
+	return dsn, nil
+}
+
+// checkMigrations runs pending migrations if run is true, otherwise it returns
+// an error if there are any, so hydrocarbon never runs against a schema older
+// than it expects
+func checkMigrations(ctx context.Context, dsn string, run bool) error {
+	m, err := pg.NewMigrator(dsn)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if run {
+		ran, err := m.Up(ctx)
+		for _, name := range ran {
+			log.Println("hydrocarbon: ran migration", name)
+		}
+
+		return err
+	}
+
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return err
+	}
+
+	if pending > 0 {
+		return fmt.Errorf("%d migrations are pending, run hydrocarbon migrate up or start with -migrate", pending)
+	}
+
+	return nil
+}
+
+// runMigrate runs the migrate subcommand with args
+func runMigrate(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	dsn, err := postgresDSN()
+	if err != nil {
+		return err
+	}
+
+	m, err := pg.NewMigrator(dsn)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	switch args[0] {
+	case "up":
+		ran, err := m.Up(ctx)
+		for _, name := range ran {
+			fmt.Println("ran", name)
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(ran) == 0 {
+			fmt.Println("no pending migrations")
+		}
+	case "down":
+		name, err := m.Down(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("undid", name)
+	case "status":
+		ms, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, mi := range ms {
+			applied := "pending"
+			if !mi.AppliedAt.IsZero() {
+				applied = mi.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+
+			reversible := ""
+			if mi.Reversible {
+				reversible = "reversible"
+			}
+
+			name := mi.Name
+			if mi.Schema != "" {
+				name = mi.Schema + "." + name
+			}
+
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", name, applied, reversible)
+		}
+
+		return tw.Flush()
+	case "force":
+		if len(args) != 2 {
+			return errors.New(migrateUsage)
+		}
+
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("force takes a number of migrations: %w", err)
+		}
+
+		err = m.Force(ctx, n)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("recorded the first", n, "migrations as run")
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	return nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fortytw2/hydrocarbon"
+	"github.com/fortytw2/hydrocarbon/pg"
+)
+
+const tenantUsage = `usage: hydrocarbon tenant <command>
+
+  create NAME      create a schema for a new tenant and migrate it
+  list             list every tenant
+  add NAME EMAIL   have the user with EMAIL log in to the tenant NAME`
+
+// tenantMiddleware runs every request in the schema of the tenant of its
+// session key, or when logging in, of the user logging in. Requests without
+// a tenant are run in the default schema
+func tenantMiddleware(db *pg.DB, ks *hydrocarbon.KeySigner, next http.Handler) http.Handler {
+	return hydrocarbon.ErrorHandler(func(w http.ResponseWriter, r *http.Request) error {
+		tenant, err := requestTenant(db, ks, r)
+		if err != nil {
+			return err
+		}
+
+		next.ServeHTTP(w, r.WithContext(pg.TenantContext(r.Context(), tenant)))
+		return nil
+	})
+}
+
+// requestTenant returns the tenant of the session key of r, of the email a
+// login token is requested for, of the login token being activated, of the
+// url a folder or feed is exported at, of the Fever key of a Fever or Google
+// Reader client or of the stripe customer a billing webhook is about
+func requestTenant(db *pg.DB, ks *hydrocarbon.KeySigner, r *http.Request) (string, error) {
+	path := r.URL.Path
+	switch {
+	case path == "/v1/token/create":
+		var body struct {
+			Email string `json:"email"`
+		}
+		peekBody(r, &body, 1024*8)
+
+		return db.TenantForEmail(r.Context(), body.Email)
+	case path == "/v1/key/create":
+		var body struct {
+			Token string `json:"token"`
+		}
+		peekBody(r, &body, 1024*8)
+
+		return db.TenantForKey(r.Context(), body.Token)
+	case path == "/v1/billing/webhook":
+		// the signature of the event is checked by the api, a forged
+		// customer only picks the schema it is turned away in
+		var event struct {
+			Data struct {
+				Object struct {
+					Customer string `json:"customer"`
+				} `json:"object"`
+			} `json:"data"`
+		}
+		peekBody(r, &event, 1024*64)
+
+		return db.TenantForKey(r.Context(), event.Data.Object.Customer)
+	case path == "/fever" || path == "/fever/":
+		return db.TenantForKey(r.Context(), strings.ToLower(peekForm(r).Get("api_key")))
+	case path == "/v1/folder/atom/get" || path == "/v1/folder/json/get":
+		return db.TenantForKey(r.Context(), r.URL.Query().Get("token"))
+	case path == "/v1/feed/json/get":
+		val, err := ks.Verify(r.URL.Query().Get("token"))
+		if err != nil {
+			return "", nil
+		}
+
+		return db.TenantForKey(r.Context(), val)
+	case path == "/greader/accounts/ClientLogin":
+		return db.TenantForEmail(r.Context(), peekForm(r).Get("Email"))
+	case strings.HasPrefix(path, "/greader/"):
+		// Google Reader clients are logged in with their signed Fever key
+		key, err := ks.Verify(strings.TrimPrefix(r.Header.Get("Authorization"), "GoogleLogin auth="))
+		if err != nil {
+			return "", nil
+		}
+
+		return db.TenantForKey(r.Context(), key)
+	}
+
+	// websockets opened by browsers send their key in the query instead
+	signed := r.Header.Get("X-Hydrocarbon-Key")
+	if signed == "" {
+		signed = r.URL.Query().Get("key")
+	}
+
+	// requests with a key that is not valid are turned away by the api
+	key, err := ks.Verify(signed)
+	if err != nil {
+		return "", nil
+	}
+
+	return db.TenantForKey(r.Context(), key)
+}
+
+// peekBody decodes the JSON body of r into x, if it is no longer than n bytes,
+// leaving the body to be read again by the api
+func peekBody(r *http.Request, x interface{}, n int64) {
+	buf, _ := ioutil.ReadAll(io.LimitReader(r.Body, n))
+	r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(buf), r.Body))
+
+	json.Unmarshal(buf, x)
+}
+
+// peekForm returns the form posted in r and the query of its url, leaving the
+// body to be read again by the api
+func peekForm(r *http.Request) url.Values {
+	buf, _ := ioutil.ReadAll(io.LimitReader(r.Body, 1024*8))
+	r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(buf), r.Body))
+
+	form, _ := url.ParseQuery(string(buf))
+	for k, v := range r.URL.Query() {
+		if _, ok := form[k]; !ok {
+			form[k] = v
+		}
+	}
+
+	return form
+}
+
+// runTenant runs the tenant subcommand with args
+func runTenant(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New(tenantUsage)
+	}
+
+	dsn, err := postgresDSN()
+	if err != nil {
+		return err
+	}
+
+	m, err := pg.NewMigrator(dsn)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	switch args[0] {
+	case "create":
+		if len(args) != 2 {
+			return errors.New(tenantUsage)
+		}
+
+		err = m.CreateTenant(ctx, args[1])
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("created tenant", args[1])
+	case "list":
+		tenants, err := m.ListTenants(ctx)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, t := range tenants {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", t.Name, t.Schema, t.CreatedAt.Format("2006-01-02 15:04:05"))
+		}
+
+		return tw.Flush()
+	case "add":
+		if len(args) != 3 {
+			return errors.New(tenantUsage)
+		}
+
+		db, err := pg.NewDB(dsn)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		err = db.EnableTenants(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = db.AddTenantMember(ctx, args[1], args[2])
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(args[2], "now logs in to", args[1])
+	default:
+		return errors.New(tenantUsage)
+	}
+
+	return nil
+}
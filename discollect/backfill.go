@@ -0,0 +1,86 @@
+package discollect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// backfills make at most this many requests per second to a domain
+	backfillRate = 0.2
+	// backfills may wait behind other scrapes for this long before they are
+	// paused, keeping their remaining tasks to be resumed later
+	maxBackfillDuration = 7 * 24 * time.Hour
+)
+
+// ErrNoBackfill is returned for feeds of plugins that can not be backfilled
+var ErrNoBackfill = errors.New("discollect: plugin does not support backfills")
+
+// BackfillConfig returns the config of a BackfillScrape of a feed that was
+// first scraped with c
+func (d *Discollector) BackfillConfig(pluginName string, c *Config) (*Config, error) {
+	p, err := d.r.Get(pluginName)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Backfill == nil {
+		return nil, ErrNoBackfill
+	}
+
+	c, err = migrateConfig(p, c)
+	if err != nil {
+		return nil, err
+	}
+
+	bc, err := p.Backfill(c)
+	if err != nil {
+		return nil, err
+	}
+	bc.Type = BackfillScrape
+	bc.Version = p.ConfigVersion
+
+	err = d.r.ValidateConfig(p.Name, bc)
+	if err != nil {
+		return nil, err
+	}
+
+	return bc, nil
+}
+
+// backfillLimit slows rl down to backfillRate per domain
+func backfillLimit(rl *RateLimit) *RateLimit {
+	out := &RateLimit{PerDomain: backfillRate}
+	if rl != nil {
+		*out = *rl
+		if out.PerDomain <= 0 || out.PerDomain > backfillRate {
+			out.PerDomain = backfillRate
+		}
+	}
+
+	return out
+}
+
+// pauseScrape takes the pending tasks of a scrape off q and saves them to ms
+func pauseScrape(ctx context.Context, q Queue, ms Metastore, id uuid.UUID) error {
+	tasks, status, err := q.Pause(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	err = ms.PauseScrape(ctx, id, tasks, status)
+	if err != nil {
+		// hand the tasks back rather than lose them
+		rerr := q.Resume(ctx, id, tasks, status)
+		if rerr != nil {
+			return fmt.Errorf("discollect: could not pause %s: %s, and lost %d tasks: %s", id, err, len(tasks), rerr)
+		}
+		return err
+	}
+
+	return nil
+}
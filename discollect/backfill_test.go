@@ -0,0 +1,76 @@
+package discollect
+
+import "testing"
+
+func TestBackfillConfig(t *testing.T) {
+	t.Parallel()
+
+	d, err := New(WithPlugins(
+		&Plugin{Name: "static"},
+		&Plugin{
+			Name: "archive",
+			Backfill: func(c *Config) (*Config, error) {
+				return &Config{Entrypoints: []string{c.Entrypoints[0] + "/archive"}}, nil
+			},
+		},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	initial := &Config{Type: FullScrape, Entrypoints: []string{"https://example.com"}}
+
+	_, err = d.BackfillConfig("static", initial)
+	if err != ErrNoBackfill {
+		t.Fatalf("expected ErrNoBackfill, got %v", err)
+	}
+
+	bc, err := d.BackfillConfig("archive", initial)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bc.Type != BackfillScrape || bc.Entrypoints[0] != "https://example.com/archive" {
+		t.Fatalf("unexpected backfill config %+v", bc)
+	}
+
+	if bc.Priority() != PriorityBackfill {
+		t.Fatalf("backfills should run at PriorityBackfill, got %d", bc.Priority())
+	}
+
+	// full scrapes of plugins without delta scrapes recur, so are not backfills
+	if initial.Priority() != PriorityScheduled {
+		t.Fatalf("full scrapes should run at PriorityScheduled, got %d", initial.Priority())
+	}
+}
+
+func TestBackfillLimit(t *testing.T) {
+	t.Parallel()
+
+	var cases = []struct {
+		name     string
+		rl       *RateLimit
+		expected float64
+	}{
+		{"none", nil, backfillRate},
+		{"unlimited-domain", &RateLimit{PerIP: 1}, backfillRate},
+		{"faster", &RateLimit{PerDomain: 2}, backfillRate},
+		{"slower", &RateLimit{PerDomain: 0.1}, 0.1},
+	}
+
+	for _, tt := range cases {
+		var before RateLimit
+		if tt.rl != nil {
+			before = *tt.rl
+		}
+
+		out := backfillLimit(tt.rl)
+		if out.PerDomain != tt.expected {
+			t.Errorf("%s: expected %f per second, got %f", tt.name, tt.expected, out.PerDomain)
+		}
+
+		if tt.rl != nil && *tt.rl != before {
+			t.Errorf("%s: plugin rate limit modified", tt.name)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package discollect
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CircuitBreaker is how many failures in a row a host may have before every
+// task against it is held back, and for how long
+type CircuitBreaker struct {
+	// Threshold is the number of consecutive failed requests that trip the
+	// circuit of a host
+	Threshold int
+	// Cooldown is how long a tripped circuit stays open, the first request
+	// after it is let through and trips it again if it fails
+	Cooldown time.Duration
+}
+
+// WithCircuitBreaker stops scraping hosts that look to be down, tasks against
+// them are put back on the queue until the circuit closes
+func WithCircuitBreaker(cb CircuitBreaker) OptionFn {
+	return func(d *Discollector) error {
+		if cb.Threshold <= 0 || cb.Cooldown <= 0 {
+			return fmt.Errorf("discollect: circuit breaker needs a threshold and cooldown, got %d and %s", cb.Threshold, cb.Cooldown)
+		}
+
+		d.cb = newBreaker(cb)
+		return nil
+	}
+}
+
+// A CircuitOpenError is returned for tasks held back as the circuit of a host
+// they make requests to is open
+type CircuitOpenError struct {
+	Host  string
+	Until time.Time
+}
+
+func (ce *CircuitOpenError) Error() string {
+	return fmt.Sprintf("discollect: circuit open for %s until %s", ce.Host, ce.Until.Format(time.RFC3339))
+}
+
+// breaker is the state of every circuit, shared by all workers
+type breaker struct {
+	CircuitBreaker
+
+	mu    sync.Mutex
+	hosts map[string]*circuit
+	now   func() time.Time
+}
+
+type circuit struct {
+	failures  int
+	openUntil time.Time
+	// recorded holds the scrapes already told the circuit opened, so each
+	// is told once per trip
+	recorded map[uuid.UUID]bool
+}
+
+func newBreaker(cb CircuitBreaker) *breaker {
+	return &breaker{
+		CircuitBreaker: cb,
+		hosts:          make(map[string]*circuit),
+		now:            time.Now,
+	}
+}
+
+// open returns an error if the circuit of host is open
+func (b *breaker) open(host string) *CircuitOpenError {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.hosts[host]
+	if !ok || !b.now().Before(c.openUntil) {
+		return nil
+	}
+
+	return &CircuitOpenError{Host: host, Until: c.openUntil}
+}
+
+// success closes the circuit of host
+func (b *breaker) success(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.hosts, host)
+}
+
+// failure counts a failed request to host, tripping its circuit once there
+// have been too many in a row
+func (b *breaker) failure(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.hosts[host]
+	if !ok {
+		c = &circuit{}
+		b.hosts[host] = c
+	}
+
+	c.failures++
+	if c.failures >= b.Threshold && !b.now().Before(c.openUntil) {
+		c.openUntil = b.now().Add(b.Cooldown)
+		c.recorded = make(map[uuid.UUID]bool)
+	}
+}
+
+// shouldRecord returns true the first time a scrape is held back by the
+// current trip of the circuit of host
+func (b *breaker) shouldRecord(host string, scrapeID uuid.UUID) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.hosts[host]
+	if !ok || c.recorded == nil || c.recorded[scrapeID] {
+		return false
+	}
+
+	c.recorded[scrapeID] = true
+	return true
+}
+
+// breakerClient wraps c so requests count towards the circuit of their host,
+// and are refused while it is open. The transport returned keeps the last
+// refusal, so the task making it can be put back rather than finished
+func breakerClient(c *http.Client, b *breaker) (*http.Client, *breakerTransport) {
+	next := c.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	bt := &breakerTransport{
+		next: next,
+		b:    b,
+	}
+
+	cc := *c
+	cc.Transport = bt
+
+	return &cc, bt
+}
+
+type breakerTransport struct {
+	next http.RoundTripper
+	b    *breaker
+
+	mu      sync.Mutex
+	refused *CircuitOpenError
+}
+
+func (bt *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := strings.ToLower(req.URL.Hostname())
+	if ce := bt.b.open(host); ce != nil {
+		bt.mu.Lock()
+		bt.refused = ce
+		bt.mu.Unlock()
+		return nil, ce
+	}
+
+	resp, err := bt.next.RoundTrip(req)
+	if err != nil {
+		// the task giving up is not the fault of the host
+		if req.Context().Err() != context.Canceled {
+			bt.b.failure(host)
+		}
+		return nil, err
+	}
+
+	if resp.StatusCode >= 500 {
+		bt.b.failure(host)
+	} else {
+		bt.b.success(host)
+	}
+
+	return resp, nil
+}
+
+// err returns the last request refused as its circuit was open, if any
+func (bt *breakerTransport) err() *CircuitOpenError {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+
+	return bt.refused
+}
@@ -0,0 +1,168 @@
+package discollect
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// circuitMetastore records open circuits, it panics on any other call
+type circuitMetastore struct {
+	Metastore
+
+	mu    sync.Mutex
+	opens map[uuid.UUID][]string
+}
+
+func (cm *circuitMetastore) RecordCircuitOpen(ctx context.Context, id uuid.UUID, host string, until time.Time) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	cm.opens[id] = append(cm.opens[id], host)
+	return nil
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	status := http.StatusInternalServerError
+	var hits int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		hits++
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := u.Hostname()
+
+	now := time.Now()
+	b := newBreaker(CircuitBreaker{Threshold: 2, Cooldown: time.Minute})
+	b.now = func() time.Time { return now }
+
+	get := func() (*breakerTransport, error) {
+		c, bt := breakerClient(&http.Client{}, b)
+		resp, err := c.Get(ts.URL)
+		if err != nil {
+			return bt, err
+		}
+		resp.Body.Close()
+		return bt, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := get(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bt, err := get()
+	if err == nil || bt.err() == nil || bt.err().Host != host {
+		t.Fatalf("expected the circuit to be open, got %v", err)
+	}
+	if hits != 2 {
+		t.Fatalf("expected the open circuit to refuse the request, host was hit %d times", hits)
+	}
+
+	// tasks against the host are held back before they run
+	r, err := NewRegistry([]*Plugin{{
+		Name:   "down",
+		Routes: map[string]Handler{`.*`: func(ctx context.Context, ho *HandlerOpts, t *Task) *HandlerResponse { return Response(nil) }},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWorker(r, NewDefaultRotator(), &NilLimiter{}, NewMemQueue(), NewStubFS(), &StdoutWriter{}, &StdoutReporter{})
+	w.cb = b
+
+	scrapeID := uuid.New()
+	err = w.processTask(context.Background(), &QueuedTask{
+		ScrapeID: scrapeID,
+		Plugin:   "down",
+		Config:   &Config{Type: FullScrape},
+		Task:     &Task{URL: ts.URL},
+	})
+	if _, ok := err.(*CircuitOpenError); !ok {
+		t.Fatalf("expected a CircuitOpenError, got %v", err)
+	}
+
+	// each scrape is told once per trip
+	if !b.shouldRecord(host, scrapeID) || b.shouldRecord(host, scrapeID) {
+		t.Fatal("expected the scrape to be recorded exactly once")
+	}
+
+	// one more failure after the cooldown trips it again straight away
+	now = now.Add(2 * time.Minute)
+	if _, err := get(); err != nil {
+		t.Fatal(err)
+	}
+	if b.open(host) == nil {
+		t.Fatal("expected a failure after the cooldown to trip the circuit again")
+	}
+	if !b.shouldRecord(host, scrapeID) {
+		t.Fatal("expected the scrape to be recorded again for a new trip")
+	}
+
+	// and a success after the cooldown closes it
+	now = now.Add(2 * time.Minute)
+	mu.Lock()
+	status = http.StatusOK
+	mu.Unlock()
+	if _, err := get(); err != nil {
+		t.Fatal(err)
+	}
+	if b.open(host) != nil {
+		t.Fatal("expected a success to close the circuit")
+	}
+}
+
+func TestHoldBack(t *testing.T) {
+	t.Parallel()
+
+	q := NewMemQueue()
+	scrapeID := uuid.New()
+	qt := &QueuedTask{ScrapeID: scrapeID, TaskID: uuid.New(), Task: &Task{URL: "https://example.com"}}
+	err := q.Push(context.Background(), []*QueuedTask{qt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	popped, err := q.Pop(context.Background())
+	if err != nil || popped == nil {
+		t.Fatalf("could not pop task: %v", err)
+	}
+
+	b := newBreaker(CircuitBreaker{Threshold: 1, Cooldown: time.Minute})
+	b.failure("example.com")
+
+	cm := &circuitMetastore{opens: make(map[uuid.UUID][]string)}
+	w := NewWorker(nil, nil, nil, q, nil, nil, &StdoutReporter{})
+	w.cb = b
+	w.ms = cm
+
+	w.holdBack(context.Background(), popped, b.open("example.com"))
+
+	if len(cm.opens[scrapeID]) != 1 {
+		t.Fatalf("expected the open circuit recorded, got %v", cm.opens[scrapeID])
+	}
+
+	requeued, err := q.Pop(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requeued == nil || requeued.TaskID != qt.TaskID {
+		t.Fatal("expected the held back task to be requeued")
+	}
+}
@@ -0,0 +1,61 @@
+package discollect
+
+import (
+	"fmt"
+)
+
+// A ConfigVersionError is returned for configs made by a newer version of a
+// plugin than the one registered, i.e. while a deploy is rolling out
+type ConfigVersionError struct {
+	Plugin  string
+	Version int
+	Current int
+}
+
+func (e *ConfigVersionError) Error() string {
+	return fmt.Sprintf("discollect: %s config is version %d, newer than %d", e.Plugin, e.Version, e.Current)
+}
+
+// MigrateConfig upgrades c to the ConfigVersion of the named plugin, one
+// version at a time. c is returned as is if it is already current, otherwise
+// the upgraded copy is returned and c is left untouched
+func (r *Registry) MigrateConfig(pluginName string, c *Config) (*Config, error) {
+	p, err := r.Get(pluginName)
+	if err != nil {
+		return nil, err
+	}
+
+	return migrateConfig(p, c)
+}
+
+func migrateConfig(p *Plugin, c *Config) (*Config, error) {
+	if c == nil || c.Version == p.ConfigVersion {
+		return c, nil
+	}
+
+	if c.Version > p.ConfigVersion {
+		return nil, &ConfigVersionError{
+			Plugin:  p.Name,
+			Version: c.Version,
+			Current: p.ConfigVersion,
+		}
+	}
+
+	cp := *c
+	cp.Entrypoints = append([]string(nil), c.Entrypoints...)
+	cp.Countries = append([]string(nil), c.Countries...)
+	out := &cp
+	for out.Version < p.ConfigVersion {
+		from := out.Version
+		if p.MigrateConfig != nil {
+			next, err := p.MigrateConfig(from, out)
+			if err != nil {
+				return nil, fmt.Errorf("discollect: could not migrate %s config from version %d: %s", p.Name, from, err)
+			}
+			out = next
+		}
+		out.Version = from + 1
+	}
+
+	return out, nil
+}
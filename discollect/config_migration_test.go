@@ -0,0 +1,72 @@
+package discollect
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMigrateConfig(t *testing.T) {
+	t.Parallel()
+
+	var froms []int
+	d, err := New(WithPlugins(
+		&Plugin{Name: "unversioned"},
+		&Plugin{Name: "bumped", ConfigVersion: 1},
+		&Plugin{
+			Name:          "moved",
+			ConfigVersion: 2,
+			MigrateConfig: func(from int, c *Config) (*Config, error) {
+				froms = append(froms, from)
+				switch from {
+				case 0:
+					// the site moved to https
+					c.Entrypoints = []string{strings.Replace(c.Entrypoints[0], "http://", "https://", 1)}
+				case 1:
+					// and then to a new path
+					c.Entrypoints = []string{c.Entrypoints[0] + "/v2"}
+				default:
+					return nil, errors.New("unknown version")
+				}
+				return c, nil
+			},
+		},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := &Config{Type: DeltaScrape, Entrypoints: []string{"http://example.com"}}
+
+	c, err := d.MigrateConfig("unversioned", old)
+	if err != nil || c != old {
+		t.Fatalf("expected a current config to be returned as is, got %+v, %v", c, err)
+	}
+
+	c, err = d.MigrateConfig("bumped", old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Version != 1 || c.Entrypoints[0] != "http://example.com" {
+		t.Errorf("expected the config to be stamped unchanged, got %+v", c)
+	}
+
+	c, err = d.MigrateConfig("moved", old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Version != 2 || c.Entrypoints[0] != "https://example.com/v2" || c.Type != DeltaScrape {
+		t.Errorf("expected the config to be migrated twice, got %+v", c)
+	}
+	if len(froms) != 2 || froms[0] != 0 || froms[1] != 1 {
+		t.Errorf("expected a migration from every version in order, got %v", froms)
+	}
+	if old.Version != 0 || old.Entrypoints[0] != "http://example.com" {
+		t.Errorf("expected the stored config to be left untouched, got %+v", old)
+	}
+
+	c, err = d.MigrateConfig("moved", &Config{Type: FullScrape, Entrypoints: []string{"https://example.com"}, Version: 3})
+	if _, ok := err.(*ConfigVersionError); !ok {
+		t.Errorf("expected a config newer than the plugin to be refused, got %+v, %v", c, err)
+	}
+}
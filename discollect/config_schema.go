@@ -0,0 +1,275 @@
+package discollect
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// BaseConfigSchema is the JSON schema every Config must satisfy, a plugin's own
+// ConfigSchema is checked on top of it
+const BaseConfigSchema = `{
+	"type": "object",
+	"required": ["Type", "Entrypoints"],
+	"properties": {
+		"Type": {"type": "string", "enum": ["full_scrape", "delta_scrape", "backfill_scrape"]},
+		"Entrypoints": {"type": "array", "minItems": 1, "items": {"type": "string", "minLength": 1}},
+		"Since": {"type": "string"},
+		"Countries": {"type": ["array", "null"], "items": {"type": "string", "pattern": "^[A-Za-z]{2}$"}},
+		"Version": {"type": "integer"}
+	}
+}`
+
+// A Schema is the subset of JSON Schema plugins can describe their configs
+// with
+type Schema struct {
+	Type                 schemaTypes        `json:"type,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// schemaTypes is either a single type or a list of them
+type schemaTypes []string
+
+func (st *schemaTypes) UnmarshalJSON(b []byte) error {
+	var one string
+	if json.Unmarshal(b, &one) == nil {
+		*st = schemaTypes{one}
+		return nil
+	}
+
+	var many []string
+	err := json.Unmarshal(b, &many)
+	if err != nil {
+		return fmt.Errorf("type must be a string or list of strings: %s", err)
+	}
+
+	*st = many
+	return nil
+}
+
+// ParseSchema parses and compiles a JSON schema
+func ParseSchema(raw string) (*Schema, error) {
+	var s Schema
+	err := json.Unmarshal([]byte(raw), &s)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (s *Schema) compile() error {
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("pattern %q did not compile: %s", s.Pattern, err)
+		}
+		s.pattern = re
+	}
+
+	children := append([]*Schema{s.Items}, s.AllOf...)
+	for _, p := range s.Properties {
+		children = append(children, p)
+	}
+
+	for _, c := range children {
+		if c == nil {
+			continue
+		}
+
+		err := c.compile()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// A FieldError is a single way a config does not match its schema
+type FieldError struct {
+	// Path is the field, i.e. Entrypoints[0], or empty for the whole config
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// A ValidationError lists every way a config does not match its plugin's
+// schema
+type ValidationError struct {
+	Plugin string        `json:"plugin"`
+	Fields []*FieldError `json:"fields"`
+}
+
+func (ve *ValidationError) Error() string {
+	msgs := make([]string, len(ve.Fields))
+	for i, f := range ve.Fields {
+		if f.Path == "" {
+			msgs[i] = f.Message
+		} else {
+			msgs[i] = f.Path + ": " + f.Message
+		}
+	}
+
+	return fmt.Sprintf("discollect: invalid config for plugin %s: %s", ve.Plugin, strings.Join(msgs, "; "))
+}
+
+// Validate checks c against the schema, returning every field that does not
+// match
+func (s *Schema) Validate(c *Config) ([]*FieldError, error) {
+	buf, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+	err = json.Unmarshal(buf, &v)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.validate("", v), nil
+}
+
+func (s *Schema) validate(path string, v interface{}) []*FieldError {
+	var errs []*FieldError
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, &FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for _, sub := range s.AllOf {
+		errs = append(errs, sub.validate(path, v)...)
+	}
+
+	if len(s.Type) > 0 && !s.Type.matches(v) {
+		fail("must be of type %s", strings.Join(s.Type, " or "))
+		return errs
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if reflect.DeepEqual(e, v) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			fail("must be one of %v", s.Enum)
+		}
+	}
+
+	switch v := v.(type) {
+	case string:
+		n := len([]rune(v))
+		if s.MinLength != nil && n < *s.MinLength {
+			fail("must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("must be at most %d characters", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("must match %s", s.Pattern)
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				errs = append(errs, s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item)...)
+			}
+		}
+	case map[string]interface{}:
+		for _, r := range s.Required {
+			if _, ok := v[r]; !ok {
+				errs = append(errs, &FieldError{Path: joinPath(path, r), Message: "is required"})
+			}
+		}
+
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			field := v[k]
+			prop, ok := s.Properties[k]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					errs = append(errs, &FieldError{Path: joinPath(path, k), Message: "is not allowed"})
+				}
+				continue
+			}
+
+			errs = append(errs, prop.validate(joinPath(path, k), field)...)
+		}
+	}
+
+	return errs
+}
+
+func (st schemaTypes) matches(v interface{}) bool {
+	for _, t := range st {
+		switch v := v.(type) {
+		case nil:
+			if t == "null" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case float64:
+			if t == "number" || (t == "integer" && v == math.Trunc(v)) {
+				return true
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func joinPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
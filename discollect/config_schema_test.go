@@ -0,0 +1,96 @@
+package discollect
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateConfig(t *testing.T) {
+	t.Parallel()
+
+	r, err := NewRegistry([]*Plugin{
+		{Name: "base"},
+		{
+			Name:         "strict",
+			ConfigSchema: `{"properties": {"Entrypoints": {"maxItems": 1, "items": {"pattern": "^https://"}}}}`,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cases = []struct {
+		name   string
+		plugin string
+		config *Config
+		paths  []string
+	}{
+		{
+			"valid",
+			"base",
+			&Config{Type: FullScrape, Entrypoints: []string{"http://example.com"}},
+			nil,
+		},
+		{
+			"delta",
+			"strict",
+			&Config{Type: DeltaScrape, Entrypoints: []string{"https://example.com"}, Since: time.Now()},
+			nil,
+		},
+		{
+			"no-entrypoints",
+			"base",
+			&Config{Type: FullScrape},
+			[]string{"Entrypoints"},
+		},
+		{
+			"unknown-type",
+			"base",
+			&Config{Type: "sometimes", Entrypoints: []string{""}, Countries: []string{"USA"}},
+			[]string{"Countries[0]", "Entrypoints[0]", "Type"},
+		},
+		{
+			"plugin-schema",
+			"strict",
+			&Config{Type: FullScrape, Entrypoints: []string{"http://example.com", "https://example.com"}},
+			[]string{"Entrypoints", "Entrypoints[0]"},
+		},
+		{
+			"nil",
+			"base",
+			nil,
+			[]string{""},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.ValidateConfig(tt.plugin, tt.config)
+			if tt.paths == nil {
+				if err != nil {
+					t.Fatalf("expected a valid config, got %s", err)
+				}
+				return
+			}
+
+			ve, ok := err.(*ValidationError)
+			if !ok {
+				t.Fatalf("expected a *ValidationError, got %v", err)
+			}
+
+			if len(ve.Fields) != len(tt.paths) {
+				t.Fatalf("expected errors for %v, got %s", tt.paths, ve)
+			}
+
+			for i, p := range tt.paths {
+				if ve.Fields[i].Path != p {
+					t.Errorf("error %d: expected path %q, got %q", i, p, ve.Fields[i].Path)
+				}
+			}
+		})
+	}
+
+	if err := r.ValidateConfig("missing", &Config{}); err != ErrPluginUnregistered {
+		t.Fatalf("expected ErrPluginUnregistered, got %v", err)
+	}
+}
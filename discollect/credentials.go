@@ -0,0 +1,151 @@
+package discollect
+
+import (
+	"context"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// sessions are logged into again after this long, even if the scrape is still
+// running
+const sessionTTL = time.Hour
+
+// Credentials sign into an origin site on behalf of a feed, with either a
+// username and password for the plugins Login hook or cookies of an existing
+// session, or both
+type Credentials struct {
+	Username string         `json:"username,omitempty"`
+	Password string         `json:"password,omitempty"`
+	Cookies  []*http.Cookie `json:"cookies,omitempty"`
+}
+
+// A CredentialStore looks up the credentials of the feed a scrape is of
+type CredentialStore interface {
+	// GetCredentials returns nil if the feed has no credentials
+	GetCredentials(ctx context.Context, scrapeID uuid.UUID) (*Credentials, error)
+}
+
+// WithCredentialStore signs scrapes of feeds with credentials into the origin
+// site, sharing one cookie jar between every task of a scrape on this node
+func WithCredentialStore(cs CredentialStore) OptionFn {
+	return func(d *Discollector) error {
+		d.sc = &sessionCache{
+			cs:       cs,
+			sessions: make(map[uuid.UUID]*session),
+		}
+		return nil
+	}
+}
+
+// a session is the cookie jar of a single scrape, nil if its feed has no
+// credentials
+type session struct {
+	createdAt time.Time
+
+	// held while logging in, so each scrape only logs in once
+	mu    sync.Mutex
+	ready bool
+	jar   http.CookieJar
+}
+
+// sessionCache logs in once per scrape and hands the jar to every later task
+type sessionCache struct {
+	cs CredentialStore
+
+	mu       sync.Mutex
+	sessions map[uuid.UUID]*session
+}
+
+// jar returns the cookie jar for the scrape of qt, logging in with the feeds
+// credentials if this is the first task of it seen on this node
+func (sc *sessionCache) jar(ctx context.Context, p *Plugin, qt *QueuedTask, c *http.Client) (http.CookieJar, error) {
+	s := sc.session(qt.ScrapeID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ready {
+		return s.jar, nil
+	}
+
+	creds, err := sc.cs.GetCredentials(ctx, qt.ScrapeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if creds != nil {
+		// failed logins are retried by the next task
+		s.jar, err = login(ctx, p, qt.Config, c, creds)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.ready = true
+	return s.jar, nil
+}
+
+// session returns the session of a scrape, expiring old ones
+func (sc *sessionCache) session(scrapeID uuid.UUID) *session {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	now := time.Now()
+	for id, s := range sc.sessions {
+		if now.Sub(s.createdAt) > sessionTTL {
+			delete(sc.sessions, id)
+		}
+	}
+
+	s, ok := sc.sessions[scrapeID]
+	if !ok {
+		s = &session{createdAt: now}
+		sc.sessions[scrapeID] = s
+	}
+
+	return s
+}
+
+// login builds a jar holding the cookies of creds for every entrypoint, then
+// runs the plugins Login hook if it has one
+func login(ctx context.Context, p *Plugin, cfg *Config, c *http.Client, creds *Credentials) (http.CookieJar, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(creds.Cookies) > 0 && cfg != nil {
+		for _, e := range cfg.Entrypoints {
+			u, err := url.Parse(e)
+			if err != nil {
+				return nil, err
+			}
+			jar.SetCookies(u, creds.Cookies)
+		}
+	}
+
+	if p.Login != nil {
+		err = p.Login(ctx, &HandlerOpts{
+			Config: cfg,
+			Client: jarClient(c, jar),
+			Jar:    jar,
+		}, creds)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return jar, nil
+}
+
+// jarClient returns a copy of c that keeps its cookies in jar
+func jarClient(c *http.Client, jar http.CookieJar) *http.Client {
+	cc := *c
+	cc.Jar = jar
+	return &cc
+}
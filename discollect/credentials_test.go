@@ -0,0 +1,82 @@
+package discollect
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+type memCredentialStore map[uuid.UUID]*Credentials
+
+func (m memCredentialStore) GetCredentials(ctx context.Context, scrapeID uuid.UUID) (*Credentials, error) {
+	return m[scrapeID], nil
+}
+
+func TestSessionCache(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("password") == "hunter2" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "logged-in"})
+		}
+	}))
+	defer ts.Close()
+
+	var logins int
+	p := &Plugin{
+		Name: "members",
+		Login: func(ctx context.Context, ho *HandlerOpts, c *Credentials) error {
+			logins++
+			resp, err := ho.Client.Get(ts.URL + "/login?password=" + c.Password)
+			if err != nil {
+				return err
+			}
+			return resp.Body.Close()
+		},
+	}
+
+	withCreds, without := uuid.New(), uuid.New()
+	sc := &sessionCache{
+		cs: memCredentialStore{
+			withCreds: {
+				Password: "hunter2",
+				Cookies:  []*http.Cookie{{Name: "remember", Value: "me"}},
+			},
+		},
+		sessions: make(map[uuid.UUID]*session),
+	}
+
+	cfg := &Config{Entrypoints: []string{ts.URL + "/story"}}
+	for i := 0; i < 2; i++ {
+		jar, err := sc.jar(context.Background(), p, &QueuedTask{ScrapeID: withCreds, Config: cfg}, ts.Client())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/story", nil)
+		for _, c := range jar.Cookies(req.URL) {
+			req.AddCookie(c)
+		}
+		if c, err := req.Cookie("session"); err != nil || c.Value != "logged-in" {
+			t.Fatalf("session cookie from login missing, got %v", jar.Cookies(req.URL))
+		}
+		if _, err := req.Cookie("remember"); err != nil {
+			t.Fatalf("stored cookie missing, got %v", jar.Cookies(req.URL))
+		}
+	}
+
+	if logins != 1 {
+		t.Fatalf("expected a single login for the scrape, got %d", logins)
+	}
+
+	jar, err := sc.jar(context.Background(), p, &QueuedTask{ScrapeID: without, Config: cfg}, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jar != nil || logins != 1 {
+		t.Fatalf("feed without credentials was logged in")
+	}
+}
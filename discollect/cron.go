@@ -0,0 +1,210 @@
+package discollect
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cron schedules are searched this far ahead for their next run, long enough
+// to reach the next leap day
+const maxCronSearch = 5 * 366 * 24 * time.Hour
+
+// A Cron schedules scrapes with a standard five field cron expression, minute
+// hour day-of-month month day-of-week, evaluated in UTC. Fields are *, a
+// number, ranges like 1-5, lists like 1,15 and steps like */6 or 9-17/2. As
+// with cron, when both days are restricted either matching is enough
+type Cron struct {
+	expr string
+
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny are set if the field was *
+	domAny, dowAny bool
+}
+
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// ParseCron parses a five field cron expression
+func ParseCron(expr string) (*Cron, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("discollect: cron expressions need %d fields, got %d", len(cronFields), len(fields))
+	}
+
+	var sets [5]uint64
+	for i, f := range fields {
+		set, err := parseCronField(f, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("discollect: cron %s: %s", cronFields[i].name, err)
+		}
+		sets[i] = set
+	}
+
+	// 7 is another way of writing sunday
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+
+	return &Cron{
+		expr:   expr,
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}, nil
+}
+
+// parseCronField returns the set of values a field matches as a bitmask
+func parseCronField(f string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(f, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rng = part[:i]
+		}
+
+		lo, hi := min, max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+
+			var err error
+			lo, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				hi, err = strconv.Atoi(bounds[1])
+				if err != nil {
+					return 0, fmt.Errorf("invalid value %q", part)
+				}
+			} else if step > 1 {
+				// 5/10 means from 5 onwards
+				hi = max
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is outside %d-%d", part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+
+	return set, nil
+}
+
+// Next returns the first time after t the expression matches
+func (c *Cron) Next(t time.Time) (time.Time, error) {
+	t = t.In(time.UTC).Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxCronSearch)
+
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t, nil
+		}
+	}
+
+	return time.Time{}, errors.New("discollect: cron expression " + c.expr + " never matches")
+}
+
+// MinGap returns the shortest time between two runs of the expression. Days
+// are not taken into account, runs either side of midnight are assumed to be
+// on consecutive days
+func (c *Cron) MinGap() time.Duration {
+	gap := time.Hour
+	first, last := -1, -1
+	for m := 0; m < 60; m++ {
+		if c.minute&(1<<uint(m)) == 0 {
+			continue
+		}
+		if last >= 0 && time.Duration(m-last)*time.Minute < gap {
+			gap = time.Duration(m-last) * time.Minute
+		}
+		if first < 0 {
+			first = m
+		}
+		last = m
+	}
+
+	// the last run of an hour is followed by the first of the next
+	for h := 0; h < 24; h++ {
+		if c.hour&(1<<uint(h)) != 0 && c.hour&(1<<uint((h+1)%24)) != 0 {
+			if d := time.Duration(60-last+first) * time.Minute; d < gap {
+				gap = d
+			}
+			break
+		}
+	}
+
+	return gap
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Schedule implements Scheduler, scheduling every run within the next
+// defaultScheduleHorizon, or just the next run if there are none
+func (c *Cron) Schedule(sr *ScheduleRequest) ([]*ScrapeSchedule, error) {
+	if len(sr.LatestScrapes) == 0 {
+		return nil, errors.New("discollect: cannot schedule a scrape without an initial scrape")
+	}
+
+	now := time.Now()
+	conf := sr.LatestScrapes[0].Config.Delta(sr.LatestPostAt)
+
+	var ss []*ScrapeSchedule
+	for t := now; ; {
+		next, err := c.Next(t)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(ss) > 0 && next.Sub(now) > defaultScheduleHorizon {
+			return ss, nil
+		}
+
+		ss = append(ss, &ScrapeSchedule{
+			ScheduledStartAt: next,
+			Config:           conf,
+		})
+		t = next
+	}
+}
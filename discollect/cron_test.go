@@ -0,0 +1,60 @@
+package discollect
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	t.Parallel()
+
+	// a sunday
+	from := time.Date(2018, 7, 15, 12, 30, 0, 0, time.UTC)
+
+	var cases = []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2018, 7, 15, 12, 31, 0, 0, time.UTC)},
+		{"0 */6 * * *", time.Date(2018, 7, 15, 18, 0, 0, 0, time.UTC)},
+		{"15,45 9-17 * * *", time.Date(2018, 7, 15, 12, 45, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2018, 7, 16, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2018, 8, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// either day matching is enough when both are restricted
+		{"0 0 1 * 2", time.Date(2018, 7, 17, 0, 0, 0, 0, time.UTC)},
+		{"30 12 * * 7", time.Date(2018, 7, 22, 12, 30, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range cases {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.expr, err)
+		}
+
+		next, err := c.Next(from)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.expr, err)
+		}
+
+		if !next.Equal(tt.next) {
+			t.Errorf("%s: expected %s, got %s", tt.expr, tt.next, next)
+		}
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		_, err := ParseCron(expr)
+		if err == nil {
+			t.Errorf("expected %q to be invalid", expr)
+		}
+	}
+
+	c, err := ParseCron("0 0 31 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Next(from)
+	if err == nil {
+		t.Fatal("expected an error for a date that never happens")
+	}
+}
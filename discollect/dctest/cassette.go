@@ -0,0 +1,206 @@
+package dctest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+)
+
+// An Interaction is a single recorded request and the response to it
+type Interaction struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body"`
+	// Base64 is set when Body is base64 encoded, as binary bodies like
+	// images are
+	Base64 bool `json:"base64,omitempty"`
+}
+
+// A Cassette is every interaction of a test, in the order they were recorded
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// ErrNotRecorded is returned for requests a cassette has no response to
+type ErrNotRecorded struct {
+	Method string
+	URL    string
+}
+
+func (e *ErrNotRecorded) Error() string {
+	return fmt.Sprintf("dctest: %s %s is not in the cassette, run with -dctest.record to record it", e.Method, e.URL)
+}
+
+// recorded headers are trimmed down to those handlers may look at, so
+// cassettes stay small and never keep session cookies
+var keptHeaders = []string{
+	"Content-Type",
+	"Location",
+	"Last-Modified",
+	"ETag",
+	"Link",
+}
+
+// loadCassette reads the cassette at path, a missing cassette is empty
+func loadCassette(path string) (*Cassette, error) {
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Cassette{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var c Cassette
+	err = json.Unmarshal(buf, &c)
+	if err != nil {
+		return nil, fmt.Errorf("dctest: could not read cassette %s: %s", path, err)
+	}
+
+	return &c, nil
+}
+
+func (c *Cassette) save(path string) error {
+	buf, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(buf, '\n'), 0644)
+}
+
+// cassetteTransport replays a cassette, or records into it when next is set.
+// Requests are matched on their method and url alone
+type cassetteTransport struct {
+	next http.RoundTripper
+
+	mu       sync.Mutex
+	cassette *Cassette
+	// played counts the times each request has been replayed, requests
+	// made more than once get their recorded responses in order
+	played map[string]int
+}
+
+func newCassetteTransport(c *Cassette, next http.RoundTripper) *cassetteTransport {
+	return &cassetteTransport{
+		next:     next,
+		cassette: c,
+		played:   make(map[string]int),
+	}
+}
+
+func (ct *cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if ct.next != nil {
+		return ct.record(req)
+	}
+
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	return ct.replay(req)
+}
+
+func (ct *cassetteTransport) record(req *http.Request) (*http.Response, error) {
+	resp, err := ct.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	in := &Interaction{
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		StatusCode: resp.StatusCode,
+		Header:     make(http.Header),
+		Body:       string(body),
+	}
+	if !utf8.Valid(body) {
+		in.Body = base64.StdEncoding.EncodeToString(body)
+		in.Base64 = true
+	}
+	for _, h := range keptHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			in.Header.Set(h, v)
+		}
+	}
+
+	ct.mu.Lock()
+	ct.cassette.Interactions = append(ct.cassette.Interactions, in)
+	ct.mu.Unlock()
+
+	return in.response(req), nil
+}
+
+func (ct *cassetteTransport) replay(req *http.Request) (*http.Response, error) {
+	key := req.Method + " " + req.URL.String()
+
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	var found []*Interaction
+	for _, in := range ct.cassette.Interactions {
+		if in.Method == req.Method && in.URL == req.URL.String() {
+			found = append(found, in)
+		}
+	}
+
+	if len(found) == 0 {
+		return nil, &ErrNotRecorded{Method: req.Method, URL: req.URL.String()}
+	}
+
+	// the last response is repeated once every recorded one was played
+	n := ct.played[key]
+	if n >= len(found) {
+		n = len(found) - 1
+	}
+	ct.played[key]++
+
+	return found[n].response(req), nil
+}
+
+func (in *Interaction) response(req *http.Request) *http.Response {
+	header := make(http.Header)
+	for k, v := range in.Header {
+		header[k] = v
+	}
+
+	body := []byte(in.Body)
+	if in.Base64 {
+		if buf, err := base64.StdEncoding.DecodeString(in.Body); err == nil {
+			body = buf
+		}
+	}
+
+	return &http.Response{
+		Status:        strconv.Itoa(in.StatusCode) + " " + http.StatusText(in.StatusCode),
+		StatusCode:    in.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,187 @@
+// Package dctest runs discollect plugins against recorded HTTP fixtures, so
+// plugins can be tested without hitting live sites.
+//
+// Every request a plugin makes under a Harness is answered from a cassette, a
+// JSON file usually kept in the testdata directory of the plugin. Running the
+// tests with -dctest.record makes the requests against the live site instead
+// and saves the responses into the cassette, replacing what was there.
+package dctest
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"reflect"
+	"testing"
+
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+)
+
+var record = flag.Bool("dctest.record", false, "record cassettes against live sites instead of replaying them")
+
+// A Harness runs the handlers of a single plugin against a cassette
+type Harness struct {
+	t    testing.TB
+	p    *dc.Plugin
+	r    *dc.Registry
+	path string
+
+	ct *cassetteTransport
+	// Client makes its requests through the cassette, it is given to every
+	// handler and may be used to test a ConfigCreator
+	Client *http.Client
+}
+
+// New returns a harness replaying the cassette at path, or recording into it
+// if -dctest.record is set. Close must be called once the test is done
+func New(t testing.TB, p *dc.Plugin, path string) *Harness {
+	t.Helper()
+
+	return newHarness(t, p, path, *record)
+}
+
+func newHarness(t testing.TB, p *dc.Plugin, path string, rec bool) *Harness {
+	t.Helper()
+
+	r, err := dc.NewRegistry([]*dc.Plugin{p})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Cassette{}
+	var next http.RoundTripper
+	if rec {
+		next = http.DefaultTransport
+	} else {
+		c, err = loadCassette(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ct := newCassetteTransport(c, next)
+
+	return &Harness{
+		t:    t,
+		p:    p,
+		r:    r,
+		path: path,
+		ct:   ct,
+		Client: &http.Client{
+			Transport: ct,
+		},
+	}
+}
+
+// Close saves the cassette when recording
+func (h *Harness) Close() {
+	h.t.Helper()
+
+	if h.ct.next == nil {
+		return
+	}
+
+	h.ct.mu.Lock()
+	defer h.ct.mu.Unlock()
+
+	err := h.ct.cassette.save(h.path)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+// Run runs the handler routed to url, as the first task of a scrape of cfg
+func (h *Harness) Run(cfg *dc.Config, url string) *Result {
+	h.t.Helper()
+
+	return h.RunTask(cfg, &dc.Task{URL: url})
+}
+
+// RunTask runs the handler routed to t, for tasks that need Extra from their
+// parent
+func (h *Harness) RunTask(cfg *dc.Config, t *dc.Task) *Result {
+	h.t.Helper()
+
+	handler, params, err := h.r.HandlerFor(h.p.Name, t.URL)
+	if err != nil {
+		h.t.Fatalf("no route of %s matches %s: %s", h.p.Name, t.URL, err)
+	}
+
+	resp := handler(context.Background(), &dc.HandlerOpts{
+		Config:      cfg,
+		RouteParams: params,
+		FileStore:   dc.NewStubFS(),
+		Client:      h.Client,
+	}, t)
+	if resp == nil {
+		h.t.Fatalf("handler for %s returned no response", t.URL)
+	}
+
+	return &Result{
+		t:      h.t,
+		Tasks:  resp.Tasks,
+		Facts:  resp.Facts,
+		Errors: resp.Errors,
+	}
+}
+
+// A Result is what a single task emitted
+type Result struct {
+	t testing.TB
+
+	Tasks  []*dc.Task
+	Facts  []interface{}
+	Errors []error
+}
+
+// ExpectNoErrors fails the test if the task reported any errors
+func (r *Result) ExpectNoErrors() *Result {
+	r.t.Helper()
+
+	for _, err := range r.Errors {
+		r.t.Errorf("unexpected error: %s", err)
+	}
+
+	return r
+}
+
+// ExpectTasks fails the test unless the task emitted tasks for exactly urls,
+// in order
+func (r *Result) ExpectTasks(urls ...string) *Result {
+	r.t.Helper()
+
+	got := make([]string, 0, len(r.Tasks))
+	for _, t := range r.Tasks {
+		if t != nil {
+			got = append(got, t.URL)
+		}
+	}
+
+	if len(urls) == 0 {
+		urls = []string{}
+	}
+
+	if !reflect.DeepEqual(got, urls) {
+		r.t.Errorf("expected tasks %q, got %q", urls, got)
+	}
+
+	return r
+}
+
+// ExpectFacts fails the test unless the task emitted exactly facts, in order
+func (r *Result) ExpectFacts(facts ...interface{}) *Result {
+	r.t.Helper()
+
+	if len(facts) != len(r.Facts) {
+		r.t.Errorf("expected %d facts, got %d", len(facts), len(r.Facts))
+		return r
+	}
+
+	for i := range facts {
+		if !reflect.DeepEqual(facts[i], r.Facts[i]) {
+			r.t.Errorf("fact %d: expected %+v, got %+v", i, facts[i], r.Facts[i])
+		}
+	}
+
+	return r
+}
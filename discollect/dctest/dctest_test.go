@@ -0,0 +1,128 @@
+package dctest
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+)
+
+type chapter struct {
+	URL  string
+	Body string
+}
+
+var plugin = &dc.Plugin{
+	Name: "chapters",
+	Routes: map[string]dc.Handler{
+		`.*`: func(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+			resp, err := ho.Client.Get(t.URL)
+			if err != nil {
+				return dc.ErrorResponse(err)
+			}
+			defer resp.Body.Close()
+
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				return dc.ErrorResponse(err)
+			}
+
+			var tasks []*dc.Task
+			if next := resp.Header.Get("Location"); next != "" {
+				tasks = append(tasks, &dc.Task{URL: next})
+			}
+
+			return dc.Response([]interface{}{&chapter{URL: t.URL, Body: string(body)}}, tasks...)
+		},
+	},
+}
+
+// not valid UTF-8, like any image
+var cover = []byte{0x89, 'P', 'N', 'G', 0xff, 0x00}
+
+func fetchCover(t *testing.T, h *Harness, base string) []byte {
+	resp, err := h.Client.Get(base + "/cover.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf
+}
+
+func TestRecordReplay(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/cover.png" {
+			w.Write(cover)
+			return
+		}
+		if r.URL.Path == "/1" {
+			w.Header().Set("Location", "http://"+r.Host+"/2")
+			w.Header().Set("Set-Cookie", "session=secret")
+		}
+		w.Write([]byte("chapter" + r.URL.Path))
+	}))
+
+	dir, err := ioutil.TempDir("", "dctest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "testdata", "chapters.json")
+	first, next := ts.URL+"/1", ts.URL+"/2"
+
+	h := newHarness(t, plugin, path, true)
+	h.Run(nil, first).ExpectNoErrors().ExpectTasks(next)
+	fetchCover(t, h, ts.URL)
+	h.Close()
+
+	ts.Close()
+
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(buf), "secret") {
+		t.Fatal("cookies were recorded into the cassette")
+	}
+
+	h = newHarness(t, plugin, path, false)
+	defer h.Close()
+
+	h.Run(nil, first).
+		ExpectNoErrors().
+		ExpectTasks(next).
+		ExpectFacts(&chapter{URL: first, Body: "chapter/1"})
+
+	if got := fetchCover(t, h, ts.URL); !bytes.Equal(got, cover) {
+		t.Fatalf("binary body replayed as %q", got)
+	}
+
+	res := h.Run(nil, next)
+	if len(res.Errors) != 1 {
+		t.Fatalf("expected the unrecorded request to fail, got %v", res.Errors)
+	}
+
+	ue, ok := res.Errors[0].(*url.Error)
+	if !ok {
+		t.Fatalf("expected a *url.Error, got %T", res.Errors[0])
+	}
+
+	if _, ok := ue.Err.(*ErrNotRecorded); !ok {
+		t.Fatalf("expected ErrNotRecorded, got %s", res.Errors[0])
+	}
+}
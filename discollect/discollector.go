@@ -3,13 +3,18 @@ package discollect
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
+	"net/http"
 	"sync"
+	"time"
 )
 
 // A Discollector ties every element of Discollect together
 type Discollector struct {
-	w  Writer
+	w Writer
+	// ws are written to after w, see WithWriters
+	ws []Writer
 	r  *Registry
 	l  Limiter
 	ro Rotator
@@ -17,9 +22,30 @@ type Discollector struct {
 	ms Metastore
 	fs FileStore
 	er ErrorReporter
+	nr NodeRegistry
+	ss SnapshotStore
+	rc *RobotsCache
+	hc HTTPCache
+	sc *sessionCache
+	// pol is enforced on every client of ro, if set
+	pol *politeness
+	// timeout is passed to every worker, see WithTaskTimeout
+	timeout time.Duration
+	// cb is shared by every worker, if set
+	cb *breaker
+	// ls is passed to every worker, if set
+	ls LogStore
+	// quota is passed to every worker, see WithQuota
+	quota *Quota
+	// headers override those of every plugin, see WithHeaders
+	headers http.Header
+
+	node  *Node
+	drain *drainSwitch
 
 	resolver *Resolver
-	s        *Scheduler
+	s        *scheduler
+	hb       *heartbeater
 
 	workerMu sync.RWMutex
 	workers  []*Worker
@@ -35,11 +61,15 @@ var defaultOpts = []OptionFn{
 	WithRotator(NewDefaultRotator()),
 	WithQueue(NewMemQueue()),
 	WithFileStore(NewStubFS()),
+	WithRobotsCache(NewRobotsCache()),
 }
 
 // New returns a new Discollector
 func New(opts ...OptionFn) (*Discollector, error) {
-	d := &Discollector{}
+	d := &Discollector{
+		node:  newNode(""),
+		drain: &drainSwitch{},
+	}
 
 	for _, o := range defaultOpts {
 		err := o(d)
@@ -59,14 +89,27 @@ func New(opts ...OptionFn) (*Discollector, error) {
 		return nil, errors.New("no plugins registered")
 	}
 
+	if d.pol != nil {
+		d.ro = &politeRotator{Rotator: d.ro, p: d.pol}
+	}
+
+	if len(d.ws) > 0 {
+		d.w = &multiWriter{
+			primary:   d.w,
+			secondary: d.ws,
+			er:        d.er,
+		}
+	}
+
 	d.workers = make([]*Worker, 0)
 
-	d.s = &Scheduler{
+	d.s = &scheduler{
 		shutdown: make(chan chan struct{}),
 		r:        d.r,
 		ms:       d.ms,
 		q:        d.q,
 		er:       d.er,
+		drain:    d.drain,
 	}
 
 	d.resolver = &Resolver{
@@ -76,6 +119,17 @@ func New(opts ...OptionFn) (*Discollector, error) {
 		er:       d.er,
 	}
 
+	if d.nr != nil {
+		d.hb = &heartbeater{
+			shutdown: make(chan chan struct{}),
+			nr:       d.nr,
+			er:       d.er,
+			node:     d.node,
+			drain:    d.drain,
+			load:     d.load,
+		}
+	}
+
 	return d, nil
 }
 
@@ -83,10 +137,23 @@ func New(opts ...OptionFn) (*Discollector, error) {
 func (d *Discollector) Start(workers int) error {
 	go d.s.Start()
 	go d.resolver.Start()
+	if d.hb != nil {
+		go d.hb.Start()
+	}
 
 	d.workerMu.Lock()
 	for i := workers; i > 0; i-- {
 		w := NewWorker(d.r, d.ro, d.l, d.q, d.fs, d.w, d.er)
+		w.ss = d.ss
+		w.rc = d.rc
+		w.hc = d.hc
+		w.sc = d.sc
+		w.ms = d.ms
+		w.timeout = d.timeout
+		w.cb = d.cb
+		w.ls = d.ls
+		w.quota = d.quota
+		w.headers = d.headers
 		d.workers = append(d.workers, w)
 	}
 	d.workerMu.Unlock()
@@ -101,6 +168,32 @@ func (d *Discollector) Start(workers int) error {
 	return nil
 }
 
+// load returns the number of workers and how many of them are busy
+func (d *Discollector) load() (int, int) {
+	d.workerMu.RLock()
+	defer d.workerMu.RUnlock()
+
+	var busy int
+	for _, w := range d.workers {
+		if w.Busy() {
+			busy++
+		}
+	}
+
+	return len(d.workers), busy
+}
+
+// Node returns the identity of this Discollector
+func (d *Discollector) Node() *Node {
+	return d.node
+}
+
+// Draining returns true if this node has been asked to stop starting new
+// scrapes
+func (d *Discollector) Draining() bool {
+	return d.drain.on()
+}
+
 // GetPlugin returns the plugin with the given name
 func (d *Discollector) GetPlugin(name string) (*Plugin, error) {
 	return d.r.Get(name)
@@ -119,13 +212,15 @@ func (d *Discollector) PluginForEntrypoint(url string, blacklist []string) (*Plu
 	}
 
 	return plugin, &HandlerOpts{
-		Client:      c,
+		Client:      headerClient(c, plugin, d.headers),
 		RouteParams: routeParams,
 	}, nil
 }
 
-// Shutdown spins down all the workers after allowing them to finish
-// their current tasks
+// Shutdown spins down all the workers after allowing them to finish their
+// current tasks until ctx is done, those still running then are abandoned and
+// retried. Scrapes left unfinished on an in-process queue are handed back to
+// the Metastore, to be started again where they left off by any node
 func (d *Discollector) Shutdown(ctx context.Context) {
 	log.Println("stopping scheduler")
 	d.s.Stop()
@@ -133,12 +228,58 @@ func (d *Discollector) Shutdown(ctx context.Context) {
 	log.Println("stopping scrape resolver")
 	d.resolver.Stop()
 
+	if d.hb != nil {
+		log.Println("stopping heartbeat")
+		d.hb.Stop()
+	}
+
 	d.workerMu.Lock()
 	defer d.workerMu.Unlock()
 
 	log.Println("stopping workers")
+	var wg sync.WaitGroup
 	for _, w := range d.workers {
-		w.Stop()
+		wg.Add(1)
+		go func(w *Worker) {
+			defer wg.Done()
+			w.Shutdown(ctx)
+		}(w)
+	}
+	wg.Wait()
+
+	// a shared queue keeps the tasks of this node for the others
+	if _, ok := d.q.(*MemQueue); ok && d.ms != nil {
+		log.Println("handing back unfinished scrapes")
+		// ctx may well be done by now, the tasks are saved regardless
+		d.handBackScrapes(context.Background())
+	}
+}
+
+// handBackScrapes moves every running scrape with tasks on the queue of this
+// node back to WAITING, saving its tasks and counters
+func (d *Discollector) handBackScrapes(ctx context.Context) {
+	scrapes, err := d.ms.ListScrapes(ctx, "RUNNING", maxBulkPause, 0)
+	if err != nil {
+		d.er.Report(ctx, nil, fmt.Errorf("discollect: could not list scrapes to hand back: %s", err))
+		return
+	}
+
+	for _, sc := range scrapes {
+		tasks, status, err := d.q.Pause(ctx, sc.ID)
+		if err != nil {
+			d.er.Report(ctx, nil, fmt.Errorf("discollect: could not take tasks of scrape %s off the queue: %s", sc.ID, err))
+			continue
+		}
+
+		// the scrape is running on another node
+		if len(tasks) == 0 && status.TotalTasks == 0 {
+			continue
+		}
+
+		err = d.ms.HandBackScrape(ctx, sc.ID, tasks, status)
+		if err != nil {
+			d.er.Report(ctx, nil, fmt.Errorf("discollect: could not hand back scrape %s, and lost %d tasks: %s", sc.ID, len(tasks), err))
+		}
 	}
 }
 
@@ -160,6 +301,19 @@ func WithPlugins(p ...*Plugin) OptionFn {
 func WithWriter(w Writer) OptionFn {
 	return func(d *Discollector) error {
 		d.w = w
+		d.ws = nil
+		return nil
+	}
+}
+
+// WithWriters writes every datum to each of the given writers in turn, or only
+// those the primary inserted if it is an InsertWriter. Errors from the primary
+// writer fail the task so it is retried, without writing to the rest, whose
+// errors are only reported
+func WithWriters(primary Writer, secondary ...Writer) OptionFn {
+	return func(d *Discollector) error {
+		d.w = primary
+		d.ws = secondary
 		return nil
 	}
 }
@@ -212,6 +366,69 @@ func WithMetastore(ms Metastore) OptionFn {
 	}
 }
 
+// WithNodeRegistry registers this Discollector with a NodeRegistry, tagged with
+// the given version, so that it can be drained remotely
+func WithNodeRegistry(nr NodeRegistry, version string) OptionFn {
+	return func(d *Discollector) error {
+		d.nr = nr
+		d.node.Version = version
+		return nil
+	}
+}
+
+// WithSnapshotStore captures the raw response to every request made while
+// scraping, so that scrapes can later be replayed
+func WithSnapshotStore(ss SnapshotStore) OptionFn {
+	return func(d *Discollector) error {
+		d.ss = ss
+		return nil
+	}
+}
+
+// WithHTTPCache makes every GET made while scraping conditional on the page
+// having changed since it was last fetched, answering 304s from hc
+func WithHTTPCache(hc HTTPCache) OptionFn {
+	return func(d *Discollector) error {
+		d.hc = hc
+		return nil
+	}
+}
+
+// WithRobotsCache sets the RobotsCache used to obey robots.txt, nil disables
+// robots.txt checks entirely
+func WithRobotsCache(rc *RobotsCache) OptionFn {
+	return func(d *Discollector) error {
+		d.rc = rc
+		return nil
+	}
+}
+
+// RobotsStats returns how many tasks and requests of each plugin robots.txt
+// has skipped, blocked or delayed on this node
+func (d *Discollector) RobotsStats() map[string]RobotsStats {
+	if d.rc == nil {
+		return nil
+	}
+	return d.rc.Stats()
+}
+
+// Plugins describes all registered plugins
+func (d *Discollector) Plugins() []*PluginInfo {
+	return d.r.Plugins()
+}
+
+// ValidateConfig checks a config against the schema of the named plugin,
+// returning a *ValidationError if it does not match
+func (d *Discollector) ValidateConfig(pluginName string, c *Config) error {
+	return d.r.ValidateConfig(pluginName, c)
+}
+
+// MigrateConfig upgrades a stored config to the ConfigVersion of the named
+// plugin, see Registry.MigrateConfig
+func (d *Discollector) MigrateConfig(pluginName string, c *Config) (*Config, error) {
+	return d.r.MigrateConfig(pluginName, c)
+}
+
 // ListPlugins lists all registered plugins
 func (d *Discollector) ListPlugins() []string {
 	var out []string
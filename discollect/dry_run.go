@@ -0,0 +1,194 @@
+package discollect
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// dry runs stop after this many tasks unless asked for fewer
+	defaultDryRunTasks = 10
+	maxDryRunTasks     = 50
+)
+
+// DryRunResult is everything a dry run extracted
+type DryRunResult struct {
+	Tasks  int           `json:"tasks"`
+	Facts  []interface{} `json:"facts"`
+	Errors []string      `json:"errors"`
+	// Truncated is set if tasks were left over when the dry run stopped
+	Truncated bool `json:"truncated"`
+}
+
+// DryRun runs a plugins handlers against the live site, returning every fact
+// they extract instead of writing it. Nothing is queued or stored, so plugin
+// authors can test their selectors against real pages.
+// At most maxTasks tasks are run, one at a time within the plugins rate limit.
+func (d *Discollector) DryRun(ctx context.Context, pluginName string, c *Config, maxTasks int) (*DryRunResult, error) {
+	p, err := d.r.Get(pluginName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.r.ValidateConfig(p.Name, c)
+	if err != nil {
+		return nil, err
+	}
+
+	if maxTasks <= 0 || maxTasks > maxDryRunTasks {
+		maxTasks = defaultDryRunTasks
+	}
+
+	client, err := d.ro.Get(c)
+	if err != nil {
+		return nil, err
+	}
+	client = headerClient(client, p, d.headers)
+
+	if d.rc != nil && !p.IgnoreRobots {
+		client = robotsClient(client, d.rc, p.Name)
+	}
+
+	cw := &captureWriter{}
+	scrapeID := uuid.New()
+
+	rs, err := d.runTasks(ctx, p, c, client, maxTasks, func(t *Task) error {
+		return d.wait(ctx, p, t, scrapeID)
+	}, func(f interface{}) error {
+		return cw.Write(ctx, scrapeID, f)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &DryRunResult{
+		Tasks:     rs.tasks,
+		Facts:     cw.facts,
+		Errors:    rs.errors,
+		Truncated: rs.truncated,
+	}, nil
+}
+
+// wait blocks until the plugins rate limit allows t to run
+func (d *Discollector) wait(ctx context.Context, p *Plugin, t *Task, scrapeID uuid.UUID) error {
+	res, err := d.l.Reserve(p.RateLimit, t.URL, scrapeID)
+	if err != nil {
+		return err
+	}
+
+	if !res.OK() {
+		return ErrRateLimitExceeded
+	}
+
+	select {
+	case <-ctx.Done():
+		res.Cancel()
+		return ctx.Err()
+	case <-time.After(res.Delay()):
+		return nil
+	}
+}
+
+// captureWriter buffers every fact written to it in memory
+type captureWriter struct {
+	mu    sync.Mutex
+	facts []interface{}
+}
+
+func (cw *captureWriter) Write(ctx context.Context, _ uuid.UUID, f interface{}) error {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	cw.facts = append(cw.facts, f)
+	return nil
+}
+
+func (cw *captureWriter) Close() error {
+	return nil
+}
+
+type runStats struct {
+	tasks     int
+	facts     int
+	errors    []string
+	truncated bool
+}
+
+// runTasks runs the config's entrypoints and every task they lead to in order,
+// one at a time, without going through the queue. before is called ahead of
+// each task and write with every fact, errors from either stop the run.
+// A maxTasks of 0 runs every task.
+func (d *Discollector) runTasks(ctx context.Context, p *Plugin, c *Config, client *http.Client, maxTasks int,
+	before func(t *Task) error, write func(f interface{}) error) (*runStats, error) {
+	rs := &runStats{
+		errors: make([]string, 0),
+	}
+
+	tasks := make([]*Task, 0, len(c.Entrypoints))
+	for _, e := range c.Entrypoints {
+		tasks = append(tasks, &Task{URL: e})
+	}
+	seen := make(map[string]bool)
+
+	for len(tasks) > 0 {
+		t := tasks[0]
+		tasks = tasks[1:]
+
+		if seen[t.URL] {
+			continue
+		}
+
+		if maxTasks > 0 && rs.tasks == maxTasks {
+			rs.truncated = true
+			break
+		}
+
+		seen[t.URL] = true
+		rs.tasks++
+
+		handler, params, err := d.r.HandlerFor(p.Name, t.URL)
+		if err != nil {
+			rs.errors = append(rs.errors, err.Error())
+			continue
+		}
+
+		if before != nil {
+			err = before(t)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		resp := handler(ctx, &HandlerOpts{
+			Config:      c,
+			FileStore:   d.fs,
+			RouteParams: params,
+			Client:      client,
+		}, t)
+
+		for _, err := range resp.Errors {
+			rs.errors = append(rs.errors, fmt.Sprintf("%s: %s", t.URL, err))
+		}
+
+		for _, nt := range resp.Tasks {
+			if nt != nil {
+				tasks = append(tasks, nt)
+			}
+		}
+
+		for _, f := range resp.Facts {
+			err = write(f)
+			if err != nil {
+				return nil, err
+			}
+			rs.facts++
+		}
+	}
+
+	return rs, nil
+}
@@ -0,0 +1,63 @@
+package discollect
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	t.Parallel()
+
+	rw := &recordingWriter{}
+	p := &Plugin{
+		Name: "chapters",
+		Routes: map[string]Handler{
+			`https://example.com/chapter/(\d+)`: func(ctx context.Context, ho *HandlerOpts, t *Task) *HandlerResponse {
+				var n int
+				fmt.Sscanf(ho.RouteParams[1], "%d", &n)
+
+				// every chapter links to the next, forever
+				return &HandlerResponse{
+					Tasks: []*Task{{URL: fmt.Sprintf("https://example.com/chapter/%d", n+1)}},
+					Facts: []interface{}{fmt.Sprintf("chapter %d", n)},
+				}
+			},
+		},
+	}
+
+	d, err := New(WithPlugins(p), WithRobotsCache(nil), WithWriter(rw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := d.DryRun(context.Background(), "chapters", &Config{
+		Type:        FullScrape,
+		Entrypoints: []string{"https://example.com/chapter/1"},
+	}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Tasks != 3 || !res.Truncated {
+		t.Fatalf("expected 3 tasks and truncation, got %d and %t", res.Tasks, res.Truncated)
+	}
+
+	var facts []string
+	for _, f := range res.Facts {
+		facts = append(facts, f.(string))
+	}
+	if strings.Join(facts, ", ") != "chapter 1, chapter 2, chapter 3" {
+		t.Fatalf("unexpected facts %v", facts)
+	}
+
+	if len(rw.written) != 0 {
+		t.Fatalf("dry run wrote %d facts", len(rw.written))
+	}
+
+	_, err = d.DryRun(context.Background(), "chapters", &Config{Type: FullScrape}, 3)
+	if _, ok := err.(*ValidationError); !ok {
+		t.Fatalf("expected a validation error for a config without entrypoints, got %v", err)
+	}
+}
@@ -2,6 +2,8 @@ package discollect
 
 import (
 	"errors"
+	"fmt"
+	"sort"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,6 +17,17 @@ type ScheduleRequest struct {
 	FeedID        uuid.UUID
 	LatestScrapes []*Scrape
 	LatestDatums  interface{}
+	// LatestPostAt is when the newest stored post of the feed was made, zero if
+	// it has none
+	LatestPostAt time.Time
+	// PostTimes are when the latest stored posts were made, newest first
+	PostTimes []time.Time
+	// Schedule is set if the feed was configured with its own schedule, it
+	// is used instead of the plugins Scheduler
+	Schedule *ScheduleSpec
+	// MinInterval is the shortest gap allowed between two scrapes of this
+	// feed, zero if unlimited
+	MinInterval time.Duration
 }
 
 // A ScrapeSchedule adds to the future
@@ -23,17 +36,57 @@ type ScrapeSchedule struct {
 	ScheduledStartAt time.Time
 }
 
-// DefaultScheduler uses a simple heuristic to predict when to next scrape.
-func DefaultScheduler(sr *ScheduleRequest) ([]*ScrapeSchedule, error) {
+// A Scheduler looks into the past and tells the future, deciding when the next
+// scrapes of a feed start
+type Scheduler interface {
+	Schedule(sr *ScheduleRequest) ([]*ScrapeSchedule, error)
+}
+
+// SchedulerFunc adapts a function to a Scheduler
+type SchedulerFunc func(sr *ScheduleRequest) ([]*ScrapeSchedule, error)
+
+// Schedule calls f(sr)
+func (f SchedulerFunc) Schedule(sr *ScheduleRequest) ([]*ScrapeSchedule, error) {
+	return f(sr)
+}
+
+var (
+	// DefaultScheduler scrapes every half hour, requesting delta scrapes once
+	// the feed has posts
+	DefaultScheduler Scheduler = &FixedInterval{Interval: 30 * time.Minute}
+	// NeverSchedule simply never schedules another scrape
+	NeverSchedule Scheduler = SchedulerFunc(neverSchedule)
+)
+
+// FixedInterval schedules scrapes a fixed interval apart, requesting delta
+// scrapes once the feed has posts
+type FixedInterval struct {
+	Interval time.Duration
+	// Horizon is how far ahead scrapes are scheduled, defaultScheduleHorizon
+	// if zero. At least one scrape is always scheduled
+	Horizon time.Duration
+}
+
+// Schedule implements Scheduler
+func (fi *FixedInterval) Schedule(sr *ScheduleRequest) ([]*ScrapeSchedule, error) {
 	if len(sr.LatestScrapes) == 0 {
 		return nil, errors.New("discollect: cannot schedule a scrape without an initial scrape")
 	}
 
+	if fi.Interval <= 0 {
+		return nil, errors.New("discollect: fixed interval schedules need a positive interval")
+	}
+
+	horizon := fi.Horizon
+	if horizon == 0 {
+		horizon = defaultScheduleHorizon
+	}
+
 	base := time.Now()
-	conf := sr.LatestScrapes[0].Config
+	conf := sr.LatestScrapes[0].Config.Delta(sr.LatestPostAt)
 
 	var ss []*ScrapeSchedule
-	for x := defaultScheduleHorizon; x > 0; x -= 30 * time.Minute {
+	for x := fi.Interval; x <= horizon || len(ss) == 0; x += fi.Interval {
 		ss = append(ss, &ScrapeSchedule{
 			ScheduledStartAt: base.Add(x),
 			Config:           conf,
@@ -42,8 +95,105 @@ func DefaultScheduler(sr *ScheduleRequest) ([]*ScrapeSchedule, error) {
 	return ss, nil
 }
 
-// NeverSchedule simple never schedules another scrape
-func NeverSchedule(sr *ScheduleRequest) ([]*ScrapeSchedule, error) {
+// Adaptive schedules the next scrape of a feed by how often it has posted,
+// checking at half the median gap between its latest posts so new posts are
+// picked up promptly without polling quiet feeds constantly
+type Adaptive struct {
+	// the interval is kept between Min and Max, feeds with fewer than two
+	// posts are scraped every Max
+	Min, Max time.Duration
+}
+
+// Schedule implements Scheduler
+func (a *Adaptive) Schedule(sr *ScheduleRequest) ([]*ScrapeSchedule, error) {
+	if len(sr.LatestScrapes) == 0 {
+		return nil, errors.New("discollect: cannot schedule a scrape without an initial scrape")
+	}
+
+	interval := a.Max
+	if len(sr.PostTimes) > 1 {
+		gaps := make([]time.Duration, 0, len(sr.PostTimes)-1)
+		for i := 1; i < len(sr.PostTimes); i++ {
+			gap := sr.PostTimes[i-1].Sub(sr.PostTimes[i])
+			if gap < 0 {
+				gap = -gap
+			}
+			gaps = append(gaps, gap)
+		}
+		sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+
+		interval = gaps[len(gaps)/2] / 2
+	}
+
+	if interval < a.Min {
+		interval = a.Min
+	}
+	if a.Max > 0 && interval > a.Max {
+		interval = a.Max
+	}
+
+	return []*ScrapeSchedule{{
+		ScheduledStartAt: time.Now().Add(interval),
+		Config:           sr.LatestScrapes[0].Config.Delta(sr.LatestPostAt),
+	}}, nil
+}
+
+// A ScheduleSpec is how a user configured a feed to be scheduled, in place of
+// its plugins Scheduler
+type ScheduleSpec struct {
+	// Strategy is one of fixed, adaptive or cron
+	Strategy string `json:"strategy"`
+	// Interval is the gap between fixed scrapes, or the longest gap between
+	// adaptive ones, i.e. "2h"
+	Interval string `json:"interval,omitempty"`
+	// Cron is a five field cron expression, evaluated in UTC
+	Cron string `json:"cron,omitempty"`
+}
+
+// schedules users configure never check more often than this
+const minScheduleInterval = 15 * time.Minute
+
+// Scheduler builds the Scheduler the spec describes, returning an error if it
+// is invalid
+func (ss *ScheduleSpec) Scheduler() (Scheduler, error) {
+	var interval time.Duration
+	if ss.Interval != "" {
+		var err error
+		interval, err = time.ParseDuration(ss.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("discollect: invalid schedule interval: %s", err)
+		}
+	}
+
+	switch ss.Strategy {
+	case "fixed":
+		if interval < minScheduleInterval {
+			return nil, fmt.Errorf("discollect: fixed schedules must be at least %s apart", minScheduleInterval)
+		}
+		return &FixedInterval{Interval: interval}, nil
+	case "adaptive":
+		if interval == 0 {
+			interval = 24 * time.Hour
+		}
+		if interval < minScheduleInterval {
+			return nil, fmt.Errorf("discollect: adaptive schedules must allow at least %s between scrapes", minScheduleInterval)
+		}
+		return &Adaptive{Min: minScheduleInterval, Max: interval}, nil
+	case "cron":
+		c, err := ParseCron(ss.Cron)
+		if err != nil {
+			return nil, err
+		}
+		if c.MinGap() < minScheduleInterval {
+			return nil, fmt.Errorf("discollect: cron schedules must run at least %s apart", minScheduleInterval)
+		}
+		return c, nil
+	default:
+		return nil, fmt.Errorf("discollect: unknown schedule strategy %q", ss.Strategy)
+	}
+}
+
+func neverSchedule(sr *ScheduleRequest) ([]*ScrapeSchedule, error) {
 	if len(sr.LatestScrapes) == 0 {
 		return nil, errors.New("discollect: cannot schedule a scrape without an initial scrape")
 	}
@@ -58,3 +208,40 @@ func NeverSchedule(sr *ScheduleRequest) ([]*ScrapeSchedule, error) {
 		},
 	}, nil
 }
+
+// limitFrequency drops any schedules that would start sooner than
+// sr.MinInterval after the previous scrape, always leaving at least one
+// schedule in place so the feed is never left unscheduled
+func limitFrequency(sr *ScheduleRequest, ss []*ScrapeSchedule) []*ScrapeSchedule {
+	if sr.MinInterval <= 0 || len(ss) == 0 {
+		return ss
+	}
+
+	sort.Slice(ss, func(i, j int) bool {
+		return ss[i].ScheduledStartAt.Before(ss[j].ScheduledStartAt)
+	})
+
+	var last time.Time
+	if len(sr.LatestScrapes) > 0 {
+		last = sr.LatestScrapes[0].ScheduledStartAt
+	}
+
+	out := make([]*ScrapeSchedule, 0, len(ss))
+	for _, s := range ss {
+		if !last.IsZero() && s.ScheduledStartAt.Sub(last) < sr.MinInterval {
+			continue
+		}
+
+		out = append(out, s)
+		last = s.ScheduledStartAt
+	}
+
+	if len(out) == 0 {
+		out = append(out, &ScrapeSchedule{
+			ScheduledStartAt: last.Add(sr.MinInterval),
+			Config:           ss[len(ss)-1].Config,
+		})
+	}
+
+	return out
+}
@@ -0,0 +1,195 @@
+package discollect
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimitFrequency(t *testing.T) {
+	t.Parallel()
+
+	base := time.Date(2018, 7, 15, 12, 0, 0, 0, time.UTC)
+
+	var cases = []struct {
+		name        string
+		minInterval time.Duration
+		offsets     []time.Duration
+		expected    []time.Duration
+	}{
+		{
+			"unlimited",
+			0,
+			[]time.Duration{30 * time.Minute, time.Hour},
+			[]time.Duration{30 * time.Minute, time.Hour},
+		},
+		{
+			"two-hours",
+			2 * time.Hour,
+			[]time.Duration{30 * time.Minute, time.Hour, 2 * time.Hour, 3 * time.Hour, 4 * time.Hour},
+			[]time.Duration{2 * time.Hour, 4 * time.Hour},
+		},
+		{
+			"unordered",
+			time.Hour,
+			[]time.Duration{2 * time.Hour, time.Hour, 90 * time.Minute},
+			[]time.Duration{time.Hour, 2 * time.Hour},
+		},
+		{
+			"never-empty",
+			24 * time.Hour,
+			[]time.Duration{time.Hour, 2 * time.Hour},
+			[]time.Duration{24 * time.Hour},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			sr := &ScheduleRequest{
+				MinInterval:   tt.minInterval,
+				LatestScrapes: []*Scrape{{ScheduledStartAt: base}},
+			}
+
+			var ss []*ScrapeSchedule
+			for _, o := range tt.offsets {
+				ss = append(ss, &ScrapeSchedule{ScheduledStartAt: base.Add(o)})
+			}
+
+			out := limitFrequency(sr, ss)
+			if len(out) != len(tt.expected) {
+				t.Fatalf("expected %d schedules, got %d", len(tt.expected), len(out))
+			}
+
+			for i, e := range tt.expected {
+				if !out[i].ScheduledStartAt.Equal(base.Add(e)) {
+					t.Fatalf("schedule %d: expected %s, got %s", i, base.Add(e), out[i].ScheduledStartAt)
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultSchedulerDelta(t *testing.T) {
+	t.Parallel()
+
+	latestPost := time.Date(2018, 7, 15, 12, 0, 0, 0, time.UTC)
+	full := &Config{Type: FullScrape, Entrypoints: []string{"https://example.com/feed"}}
+
+	ss, err := DefaultScheduler.Schedule(&ScheduleRequest{
+		LatestScrapes: []*Scrape{{Config: full}},
+		LatestPostAt:  latestPost,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range ss {
+		if s.Config.Type != DeltaScrape || !s.Config.Since.Equal(latestPost) {
+			t.Fatalf("expected a delta scrape since %s, got %+v", latestPost, s.Config)
+		}
+	}
+
+	if full.Type != FullScrape {
+		t.Fatal("scheduling modified the latest scrape's config")
+	}
+
+	if ss[0].Config.Newer(latestPost) || !ss[0].Config.Newer(latestPost.Add(time.Second)) {
+		t.Fatal("delta scrape should only fetch posts newer than the latest stored post")
+	}
+
+	ss, err = DefaultScheduler.Schedule(&ScheduleRequest{LatestScrapes: []*Scrape{{Config: full}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ss[0].Config.Type != FullScrape {
+		t.Fatal("feeds without posts should keep full scraping")
+	}
+}
+
+func TestAdaptiveScheduler(t *testing.T) {
+	t.Parallel()
+
+	latest := time.Now()
+	a := &Adaptive{Min: 15 * time.Minute, Max: 24 * time.Hour}
+	scrapes := []*Scrape{{Config: &Config{Type: FullScrape}}}
+
+	var cases = []struct {
+		name     string
+		gaps     []time.Duration
+		interval time.Duration
+	}{
+		{"no-posts", nil, 24 * time.Hour},
+		{"daily", []time.Duration{24 * time.Hour, 23 * time.Hour, 25 * time.Hour}, 12 * time.Hour},
+		{"median", []time.Duration{time.Hour, 4 * time.Hour, 400 * time.Hour}, 2 * time.Hour},
+		{"frequent", []time.Duration{time.Minute, time.Minute}, 15 * time.Minute},
+		{"quiet", []time.Duration{90 * 24 * time.Hour}, 24 * time.Hour},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			times := []time.Time{latest}
+			for _, g := range tt.gaps {
+				times = append(times, times[len(times)-1].Add(-g))
+			}
+			if tt.gaps == nil {
+				times = nil
+			}
+
+			start := time.Now()
+			ss, err := a.Schedule(&ScheduleRequest{LatestScrapes: scrapes, PostTimes: times})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(ss) != 1 {
+				t.Fatalf("expected a single schedule, got %d", len(ss))
+			}
+
+			interval := ss[0].ScheduledStartAt.Sub(start)
+			if interval < tt.interval || interval > tt.interval+time.Second {
+				t.Fatalf("expected an interval of %s, got %s", tt.interval, interval)
+			}
+		})
+	}
+}
+
+func TestScheduleSpec(t *testing.T) {
+	t.Parallel()
+
+	var cases = []struct {
+		spec  ScheduleSpec
+		valid bool
+	}{
+		{ScheduleSpec{Strategy: "fixed", Interval: "2h"}, true},
+		{ScheduleSpec{Strategy: "fixed", Interval: "1m"}, false},
+		{ScheduleSpec{Strategy: "fixed"}, false},
+		{ScheduleSpec{Strategy: "adaptive"}, true},
+		{ScheduleSpec{Strategy: "adaptive", Interval: "forever"}, false},
+		{ScheduleSpec{Strategy: "cron", Cron: "0 */6 * * *"}, true},
+		{ScheduleSpec{Strategy: "cron", Cron: "every day"}, false},
+		{ScheduleSpec{Strategy: "cron", Cron: "*/15 * * * *"}, true},
+		{ScheduleSpec{Strategy: "cron", Cron: "0,50 9 * * *"}, true},
+		{ScheduleSpec{Strategy: "cron", Cron: "* * * * *"}, false},
+		// only ten minutes from xx:50 to the next hour
+		{ScheduleSpec{Strategy: "cron", Cron: "0,50 * * * *"}, false},
+		{ScheduleSpec{Strategy: "hourly"}, false},
+	}
+
+	sr := &ScheduleRequest{LatestScrapes: []*Scrape{{Config: &Config{Type: FullScrape}}}}
+	for _, tt := range cases {
+		s, err := tt.spec.Scheduler()
+		if (err == nil) != tt.valid {
+			t.Errorf("%+v: expected valid=%t, got %v", tt.spec, tt.valid, err)
+			continue
+		}
+
+		if err != nil {
+			continue
+		}
+
+		ss, err := s.Schedule(sr)
+		if err != nil || len(ss) == 0 {
+			t.Errorf("%+v: expected schedules, got %d and %v", tt.spec, len(ss), err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package discollect
+
+import (
+	"net/http"
+)
+
+// DefaultUserAgent is sent by every request that sets no User-Agent of its
+// own, in place of the Go default some sites block
+const DefaultUserAgent = "hydrocarbon/1.0 (+https://github.com/fortytw2/hydrocarbon)"
+
+// A RefererPolicy says what Referer requests of a plugin are sent with
+type RefererPolicy string
+
+const (
+	// NoReferer sends no Referer, unless the handler sets one
+	NoReferer RefererPolicy = ""
+	// OriginReferer sends the origin of the requested url, for sites that
+	// refuse requests not coming from one of their own pages
+	OriginReferer RefererPolicy = "origin"
+)
+
+// WithHeaders sets headers sent by every request of every plugin, overriding
+// the Headers of plugins and any set by handlers, i.e. to change the
+// User-Agent of a whole deployment
+func WithHeaders(h http.Header) OptionFn {
+	return func(d *Discollector) error {
+		d.headers = h
+		return nil
+	}
+}
+
+// headerClient returns a copy of c that sends the default headers of p, then
+// the override headers, with every request. p is nil for requests made before
+// a plugin is picked
+func headerClient(c *http.Client, p *Plugin, override http.Header) *http.Client {
+	next := c.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	ht := &headerTransport{
+		next:     next,
+		override: override,
+	}
+	if p != nil {
+		ht.defaults = p.Headers
+		ht.referer = p.Referer
+	}
+
+	cc := *c
+	cc.Transport = ht
+
+	return &cc
+}
+
+type headerTransport struct {
+	next     http.RoundTripper
+	defaults http.Header
+	referer  RefererPolicy
+	override http.Header
+}
+
+func (ht *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+
+	// headers set by the handler win over those of its plugin
+	for k, v := range ht.defaults {
+		if _, ok := req.Header[http.CanonicalHeaderKey(k)]; !ok {
+			req.Header[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+
+	if ht.referer == OriginReferer && req.Header.Get("Referer") == "" {
+		req.Header.Set("Referer", req.URL.Scheme+"://"+req.URL.Host+"/")
+	}
+
+	for k, v := range ht.override {
+		req.Header[http.CanonicalHeaderKey(k)] = v
+	}
+
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", DefaultUserAgent)
+	}
+
+	return ht.next.RoundTrip(req)
+}
@@ -0,0 +1,78 @@
+package discollect
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHeaderClient(t *testing.T) {
+	t.Parallel()
+
+	var got http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer ts.Close()
+
+	p := &Plugin{
+		Headers: http.Header{
+			"User-Agent":      []string{"plugin"},
+			"accept-language": []string{"en"},
+			"Accept":          []string{"text/html"},
+		},
+		Referer: OriginReferer,
+	}
+
+	var cases = []struct {
+		name     string
+		p        *Plugin
+		set      http.Header
+		override http.Header
+		want     map[string]string
+	}{
+		{"default user agent", nil, nil, nil, map[string]string{
+			"User-Agent": DefaultUserAgent,
+			"Referer":    "",
+		}},
+		{"plugin defaults", p, nil, nil, map[string]string{
+			"User-Agent":      "plugin",
+			"Accept-Language": "en",
+			"Referer":         ts.URL + "/",
+		}},
+		{"handler wins over plugin", p, http.Header{"Accept": []string{"application/json"}}, nil, map[string]string{
+			"User-Agent": "plugin",
+			"Accept":     "application/json",
+		}},
+		{"override wins over all", p, http.Header{"User-Agent": []string{"handler"}}, http.Header{"User-Agent": []string{"operator"}}, map[string]string{
+			"User-Agent":      "operator",
+			"Accept-Language": "en",
+		}},
+	}
+
+	for _, tt := range cases {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/page", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range tt.set {
+			req.Header[k] = v
+		}
+
+		resp, err := headerClient(&http.Client{}, tt.p, tt.override).Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		for k, v := range tt.want {
+			if got.Get(k) != v {
+				t.Errorf("%s: expected %s %q, got %q", tt.name, k, v, got.Get(k))
+			}
+		}
+
+		if len(tt.set) > 0 && req.Header.Get("Referer") != "" {
+			t.Errorf("%s: the request of the handler was modified", tt.name)
+		}
+	}
+}
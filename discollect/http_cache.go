@@ -0,0 +1,173 @@
+package discollect
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// responses larger than this are not cached
+	maxCachedSize = 5 * 1024 * 1024
+	// cacheHeader is set on responses answered from the cache after the origin
+	// replied 304 Not Modified
+	cacheHeader = "X-Discollect-Cache"
+)
+
+// A CachedResponse is the last response to a GET of a url, kept with its
+// validators so the next request for it can be made conditional
+type CachedResponse struct {
+	URL          string      `json:"url"`
+	ETag         string      `json:"etag"`
+	LastModified string      `json:"last_modified"`
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+	StoredAt     time.Time   `json:"stored_at"`
+}
+
+// An HTTPCache stores responses by url for conditional requests
+type HTTPCache interface {
+	// GetCachedResponse returns nil if nothing is cached for the url
+	GetCachedResponse(ctx context.Context, url string) (*CachedResponse, error)
+	PutCachedResponse(ctx context.Context, cr *CachedResponse) error
+}
+
+// Revalidated returns true if resp was answered from the cache because the page
+// has not changed since it was last fetched, handlers may use it to skip work
+func Revalidated(resp *http.Response) bool {
+	return resp.Header.Get(cacheHeader) == "revalidated"
+}
+
+// cacheTransport sends If-None-Match and If-Modified-Since for every GET it has
+// a cached response to, and answers 304s from the cache so handlers never see
+// them
+type cacheTransport struct {
+	next http.RoundTripper
+	hc   HTTPCache
+}
+
+func (ct *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// requests that are already conditional are left to their caller
+	if req.Method != http.MethodGet || req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return ct.next.RoundTrip(req)
+	}
+
+	cached, err := ct.hc.GetCachedResponse(req.Context(), req.URL.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if cached != nil {
+		req = req.Clone(req.Context())
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := ct.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		return cached.response(req, resp.Header), nil
+	}
+
+	return ct.store(req, resp)
+}
+
+// store caches resp if it can be revalidated later, returning it with its body
+// intact
+func (ct *cacheTransport) store(req *http.Request, resp *http.Response) (*http.Response, error) {
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if resp.StatusCode != http.StatusOK || (etag == "" && lastModified == "") ||
+		strings.Contains(resp.Header.Get("Cache-Control"), "no-store") || resp.ContentLength > maxCachedSize {
+		return resp, nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxCachedSize+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	// hand back whatever wasn't read, uncached
+	if len(body) > maxCachedSize {
+		resp.Body = &multiReadCloser{
+			Reader: io.MultiReader(bytes.NewReader(body), resp.Body),
+			Closer: resp.Body,
+		}
+		return resp, nil
+	}
+
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	err = ct.hc.PutCachedResponse(req.Context(), &CachedResponse{
+		URL:          req.URL.String(),
+		ETag:         etag,
+		LastModified: lastModified,
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header,
+		Body:         body,
+		StoredAt:     time.Now().In(time.UTC),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// response rebuilds the cached response, with any headers the 304 updated
+func (cr *CachedResponse) response(req *http.Request, updated http.Header) *http.Response {
+	header := make(http.Header, len(cr.Header))
+	for k, v := range cr.Header {
+		header[k] = v
+	}
+	for k, v := range updated {
+		// the 304 has no body of its own
+		if k != "Content-Length" {
+			header[k] = v
+		}
+	}
+	header.Set(cacheHeader, "revalidated")
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", cr.StatusCode, http.StatusText(cr.StatusCode)),
+		StatusCode:    cr.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(cr.Body)),
+		ContentLength: int64(len(cr.Body)),
+		Request:       req,
+	}
+}
+
+// cacheClient returns a copy of c that makes conditional requests using hc
+func cacheClient(c *http.Client, hc HTTPCache) *http.Client {
+	next := c.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	cc := *c
+	cc.Transport = &cacheTransport{
+		next: next,
+		hc:   hc,
+	}
+
+	return &cc
+}
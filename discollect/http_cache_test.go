@@ -0,0 +1,79 @@
+package discollect
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type memHTTPCache map[string]*CachedResponse
+
+func (m memHTTPCache) GetCachedResponse(ctx context.Context, url string) (*CachedResponse, error) {
+	return m[url], nil
+}
+
+func (m memHTTPCache) PutCachedResponse(ctx context.Context, cr *CachedResponse) error {
+	m[cr.URL] = cr
+	return nil
+}
+
+func TestHTTPCache(t *testing.T) {
+	var full, notModified int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/uncacheable" {
+			full++
+			w.Write([]byte("fresh"))
+			return
+		}
+
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		full++
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("chapter one"))
+	}))
+	defer ts.Close()
+
+	c := cacheClient(ts.Client(), memHTTPCache{})
+
+	get := func(path string) (string, bool) {
+		resp, err := c.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status %d", resp.StatusCode)
+		}
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(body), Revalidated(resp)
+	}
+
+	for i := 0; i < 3; i++ {
+		body, revalidated := get("/chapter")
+		if body != "chapter one" || revalidated != (i > 0) {
+			t.Errorf("request %d: got %q, revalidated=%t", i, body, revalidated)
+		}
+
+		body, revalidated = get("/uncacheable")
+		if body != "fresh" || revalidated {
+			t.Errorf("request %d: got %q for an uncacheable page, revalidated=%t", i, body, revalidated)
+		}
+	}
+
+	if full != 4 || notModified != 2 {
+		t.Errorf("expected 4 full responses and 2 304s, got %d and %d", full, notModified)
+	}
+}
@@ -2,19 +2,39 @@ package discollect
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"golang.org/x/net/html"
 )
 
+// images larger than maxImageSize are left hotlinked
+const maxImageSize = 10 * 1024 * 1024
+
 // DownloadImages takes in an HTML string, shreds all the image tags to
 // newly downloaded URLs.
 // TODO(fortytw2): resize to a few standard widths, error handling...
 func DownloadImages(textIn string, c *http.Client, fs FileStore) (string, error) {
-	doc, err := html.Parse(strings.NewReader(textIn))
+	return RehostImages(context.Background(), textIn, "", c, fs)
+}
+
+// RehostImages downloads every image in body into fs and points it at the
+// stored copy, so posts keep their images when the origin removes them or
+// blocks hotlinking. Relative srcs are resolved against baseURL, images that
+// fail to download are left as they are
+func RehostImages(ctx context.Context, body, baseURL string, c *http.Client, fs FileStore) (string, error) {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+
+	base, err := url.Parse(baseURL)
 	if err != nil {
 		return "", err
 	}
@@ -22,32 +42,28 @@ func DownloadImages(textIn string, c *http.Client, fs FileStore) (string, error)
 	var f func(*html.Node)
 	f = func(n *html.Node) {
 		if n.Type == html.ElementNode && n.Data == "img" {
-			var err error
-			var src string
-			src, err = findSrc(n.Attr)
-			if err != nil {
+			src, err := findSrc(n.Attr)
+			if err != nil || strings.HasPrefix(src, "data:") {
 				return
 			}
 
-			resp, err := c.Get(src)
-			if err != nil {
+			srcURL, err := base.Parse(src)
+			if err != nil || (srcURL.Scheme != "http" && srcURL.Scheme != "https") {
 				return
 			}
 
-			buf, err := ioutil.ReadAll(resp.Body)
+			buf, err := downloadImage(ctx, c, srcURL.String())
 			if err != nil {
-				resp.Body.Close()
 				return
 			}
 
-			resp.Body.Close()
-
-			newSrc, err := fs.Put(src, buf)
+			newSrc, err := fs.Put(srcURL.String(), buf)
 			if err != nil {
 				return
 			}
 
-			n.Attr = setSrc(n.Attr, newSrc)
+			// srcset would still point at the origin
+			n.Attr = removeAttr(setSrc(n.Attr, newSrc), "srcset")
 		}
 		for c := n.FirstChild; c != nil; c = c.NextSibling {
 			f(c)
@@ -55,15 +71,65 @@ func DownloadImages(textIn string, c *http.Client, fs FileStore) (string, error)
 	}
 	f(doc)
 
+	// html.Parse wraps fragments in a full document, only the body is wanted
+	root := doc
+	if b := findBody(doc); b != nil {
+		root = b
+	}
+
 	var b bytes.Buffer
-	err = html.Render(&b, doc)
-	if err != nil {
-		return "", err
+	for n := root.FirstChild; n != nil; n = n.NextSibling {
+		err = html.Render(&b, n)
+		if err != nil {
+			return "", err
+		}
 	}
 
 	return b.String(), nil
 }
 
+func downloadImage(ctx context.Context, c *http.Client, src string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, src, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discollect: image %s returned %d", src, resp.StatusCode)
+	}
+
+	buf, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(buf) > maxImageSize {
+		return nil, fmt.Errorf("discollect: image %s is too large to rehost", src)
+	}
+
+	return buf, nil
+}
+
+func findBody(n *html.Node) *html.Node {
+	if n.Type == html.ElementNode && n.Data == "body" {
+		return n
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if b := findBody(c); b != nil {
+			return b
+		}
+	}
+
+	return nil
+}
+
 func findSrc(attrs []html.Attribute) (string, error) {
 	for _, a := range attrs {
 		if a.Key == "src" {
@@ -84,3 +150,13 @@ func setSrc(attrs []html.Attribute, src string) []html.Attribute {
 	}
 	return newVals
 }
+
+func removeAttr(attrs []html.Attribute, key string) []html.Attribute {
+	var newVals []html.Attribute
+	for _, a := range attrs {
+		if a.Key != key {
+			newVals = append(newVals, a)
+		}
+	}
+	return newVals
+}
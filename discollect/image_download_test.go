@@ -1,6 +1,7 @@
 package discollect
 
 import (
+	"context"
 	"encoding/base64"
 	"net/http"
 	"net/http/httptest"
@@ -30,11 +31,21 @@ func TestDownloadImages(t *testing.T) {
 			`<img src="` + imageServer.URL + `/img.png" />`,
 			`<img src="` + stubby.URL + imageServer.URL + `/img.png"/>`,
 		},
+		{
+			"relative",
+			`<p><img src="/img.png" srcset="/img@2x.png 2x"/></p>`,
+			`<p><img src="` + stubby.URL + imageServer.URL + `/img.png"/></p>`,
+		},
+		{
+			"data-uri",
+			`<img src="data:image/png;base64,` + onePxPng + `"/>`,
+			`<img src="data:image/png;base64,` + onePxPng + `"/>`,
+		},
 	}
 
 	for _, c := range cases {
 		t.Run(c.Name, func(t *testing.T) {
-			outText, err := DownloadImages(c.Input, http.DefaultClient, stubby)
+			outText, err := RehostImages(context.Background(), c.Input, imageServer.URL+"/post", http.DefaultClient, stubby)
 			if err != nil {
 				t.Error(err)
 			}
@@ -0,0 +1,58 @@
+package discollect
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+)
+
+// ImageSequence returns the body of a post made of nothing but the images at
+// srcs in order, like an episode of a comic. Relative srcs are resolved
+// against baseURL.
+//
+// Every image is rehosted into ho.FileStore as the post is scraped, with the
+// client of the handler, so requests carry the headers of the plugin. Comic
+// sites serve their images from CDNs that refuse hotlinking or sign urls that
+// soon expire, so unlike RehostImages an image that can not be downloaded
+// fails the whole post, to be retried, rather than leaving it unreadable
+func ImageSequence(ctx context.Context, ho *HandlerOpts, baseURL string, srcs []string) (string, error) {
+	if len(srcs) == 0 {
+		return "", fmt.Errorf("discollect: no images in the sequence of %s", baseURL)
+	}
+
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, src := range srcs {
+		u, err := base.Parse(strings.TrimSpace(src))
+		if err != nil {
+			return "", err
+		}
+
+		stored := u.String()
+		if ho.FileStore != nil {
+			buf, err := downloadImage(ctx, ho.Client, u.String())
+			if err != nil {
+				return "", err
+			}
+
+			// the query of a signed url changes every time it is handed
+			// out, so it is left out of the name of the stored copy
+			name := *u
+			name.RawQuery = ""
+			stored, err = ho.FileStore.Put(name.String(), buf)
+			if err != nil {
+				return "", err
+			}
+		}
+
+		fmt.Fprintf(&b, `<img src="%s"/>`, html.EscapeString(stored))
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,54 @@
+package discollect
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestImageSequence(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.png" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		png, _ := base64.StdEncoding.DecodeString(onePxPng)
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(png)
+	}))
+	defer ts.Close()
+
+	fs := NewStubFS()
+	ho := &HandlerOpts{
+		Client:    http.DefaultClient,
+		FileStore: fs,
+	}
+
+	body, err := ImageSequence(context.Background(), ho, ts.URL+"/episode/1", []string{
+		"/1.png?token=abc",
+		ts.URL + "/2.png",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `<img src="` + fs.URL + ts.URL + `/1.png"/><img src="` + fs.URL + ts.URL + `/2.png"/>`
+	if body != expected {
+		t.Errorf("expected %s, got %s", expected, body)
+	}
+
+	_, err = ImageSequence(context.Background(), ho, ts.URL+"/episode/1", []string{"/1.png", "/missing.png"})
+	if err == nil {
+		t.Error("expected an image that could not be downloaded to fail the sequence")
+	}
+
+	_, err = ImageSequence(context.Background(), ho, ts.URL+"/episode/1", nil)
+	if err == nil {
+		t.Error("expected an empty sequence to fail")
+	}
+}
@@ -1,10 +1,16 @@
 package discollect
 
 import (
+	"context"
 	"errors"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"golang.org/x/net/publicsuffix"
 )
 
 var (
@@ -72,3 +78,166 @@ func (*nilReservation) OK() bool {
 func (*nilReservation) Delay() time.Duration {
 	return time.Second
 }
+
+// A HostLimiter is a Limiter that spaces out requests to each host across
+// every worker sharing it. Hosts are grouped by registrable domain, so
+// www.fanfiction.net and m.fanfiction.net share a limit
+type HostLimiter struct {
+	// requests per second allowed to a domain with no override
+	rate      float64
+	overrides map[string]float64
+
+	ls LimiterStore
+}
+
+// NewHostLimiter returns a HostLimiter allowing rate requests per second to
+// each domain, overrides sets the rate for individual domains. A Plugin may
+// lower the rate further with RateLimit.PerDomain
+func NewHostLimiter(rate float64, overrides map[string]float64) *HostLimiter {
+	return NewSharedHostLimiter(rate, overrides, newMemLimiterStore())
+}
+
+// NewSharedHostLimiter returns a HostLimiter like NewHostLimiter that keeps
+// its state in ls, so limits hold across restarts and every node sharing it
+func NewSharedHostLimiter(rate float64, overrides map[string]float64, ls LimiterStore) *HostLimiter {
+	if overrides == nil {
+		overrides = make(map[string]float64)
+	}
+
+	return &HostLimiter{
+		rate:      rate,
+		overrides: overrides,
+		ls:        ls,
+	}
+}
+
+// Reserve reserves the next free slot for the domain of url
+func (hl *HostLimiter) Reserve(rl *RateLimit, rawURL string, scrapeID uuid.UUID) (Reservation, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	domain := hostDomain(u.Hostname())
+	rate := hl.domainRate(rl, domain)
+	if rate <= 0 {
+		return &hostReservation{}, nil
+	}
+
+	interval := time.Duration(float64(time.Second) / rate)
+
+	delay, end, err := hl.ls.ReserveSlot(context.Background(), domain, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	return &hostReservation{
+		hl:       hl,
+		domain:   domain,
+		end:      end,
+		interval: interval,
+		delay:    delay,
+	}, nil
+}
+
+// domainRate returns the most restrictive of the configured and plugin rates
+func (hl *HostLimiter) domainRate(rl *RateLimit, domain string) float64 {
+	rate := hl.rate
+	if r, ok := hl.overrides[domain]; ok {
+		rate = r
+	}
+
+	if rl != nil && rl.PerDomain > 0 && (rate <= 0 || rl.PerDomain < rate) {
+		rate = rl.PerDomain
+	}
+
+	return rate
+}
+
+// hostDomain returns the registrable domain of host, or host itself for IPs
+// and anything not on the public suffix list
+func hostDomain(host string) string {
+	host = strings.ToLower(host)
+	d, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return d
+}
+
+type hostReservation struct {
+	hl       *HostLimiter
+	domain   string
+	end      time.Time
+	interval time.Duration
+	delay    time.Duration
+}
+
+// Cancel gives the slot back if no later reservation has been made
+func (hr *hostReservation) Cancel() {
+	if hr.hl == nil {
+		return
+	}
+
+	err := hr.hl.ls.CancelSlot(context.Background(), hr.domain, hr.end, hr.interval)
+	if err != nil {
+		log.Println("discollect: could not cancel reservation:", err)
+	}
+}
+
+func (*hostReservation) OK() bool {
+	return true
+}
+
+func (hr *hostReservation) Delay() time.Duration {
+	return hr.delay
+}
+
+// A LimiterStore keeps when each domain may next be requested, the state of a
+// HostLimiter
+type LimiterStore interface {
+	// ReserveSlot takes the next free slot of length interval for domain,
+	// returning how long until it starts and when it ends
+	ReserveSlot(ctx context.Context, domain string, interval time.Duration) (time.Duration, time.Time, error)
+	// CancelSlot gives back the slot ending at end, unless a later one has
+	// been reserved since
+	CancelSlot(ctx context.Context, domain string, end time.Time, interval time.Duration) error
+}
+
+// memLimiterStore is a LimiterStore for a single node, that is reset with it
+type memLimiterStore struct {
+	mu sync.Mutex
+	// next is the earliest time another request to a domain may be made
+	next map[string]time.Time
+}
+
+func newMemLimiterStore() *memLimiterStore {
+	return &memLimiterStore{
+		next: make(map[string]time.Time),
+	}
+}
+
+func (ml *memLimiterStore) ReserveSlot(ctx context.Context, domain string, interval time.Duration) (time.Duration, time.Time, error) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	now := time.Now()
+	at := ml.next[domain]
+	if at.Before(now) {
+		at = now
+	}
+	ml.next[domain] = at.Add(interval)
+
+	return at.Sub(now), at.Add(interval), nil
+}
+
+func (ml *memLimiterStore) CancelSlot(ctx context.Context, domain string, end time.Time, interval time.Duration) error {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	if ml.next[domain].Equal(end) {
+		ml.next[domain] = end.Add(-interval)
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package discollect
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestHostLimiter(t *testing.T) {
+	t.Parallel()
+
+	hl := NewHostLimiter(1, map[string]float64{
+		"fanfiction.net": 0.5,
+	})
+
+	var cases = []struct {
+		name  string
+		rl    *RateLimit
+		url   string
+		delay time.Duration
+	}{
+		{"first", nil, "https://www.fanfiction.net/s/1/1", 0},
+		{"same domain", nil, "https://m.fanfiction.net/s/1/2", 2 * time.Second},
+		{"other domain", nil, "https://example.com/feed", 0},
+		{"default rate", nil, "https://example.com/feed?page=2", time.Second},
+		{"plugin rate", &RateLimit{PerDomain: 0.25}, "https://www.fictionpress.com/s/1/1", 0},
+		{"plugin rate again", &RateLimit{PerDomain: 0.25}, "https://www.fictionpress.com/s/1/2", 4 * time.Second},
+	}
+
+	for _, tt := range cases {
+		res, err := hl.Reserve(tt.rl, tt.url, uuid.New())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if d := res.Delay(); d > tt.delay || d < tt.delay-100*time.Millisecond {
+			t.Errorf("%s: expected a delay of %s, got %s", tt.name, tt.delay, d)
+		}
+	}
+
+	// cancelling the latest reservation frees its slot
+	res, err := hl.Reserve(nil, "https://www.fanfiction.net/s/1/3", uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Cancel()
+
+	again, err := hl.Reserve(nil, "https://www.fanfiction.net/s/1/3", uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again.Delay() > res.Delay() {
+		t.Errorf("cancelled reservation was not released, %s > %s", again.Delay(), res.Delay())
+	}
+}
+
+func TestSharedHostLimiter(t *testing.T) {
+	t.Parallel()
+
+	ls := newMemLimiterStore()
+
+	// a restarted node, or another one, picks up where the first left off
+	for i, hl := range []*HostLimiter{NewSharedHostLimiter(1, nil, ls), NewSharedHostLimiter(1, nil, ls)} {
+		res, err := hl.Reserve(nil, "https://www.fanfiction.net/s/1/1", uuid.New())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		delay := time.Duration(i) * time.Second
+		if d := res.Delay(); d > delay || d < delay-100*time.Millisecond {
+			t.Errorf("limiter %d: expected a delay of %s, got %s", i, delay, d)
+		}
+	}
+}
@@ -7,6 +7,19 @@ import (
 	"github.com/google/uuid"
 )
 
+// A Priority orders scrapes and their tasks, scrapes of a higher priority are
+// started and have their tasks popped first
+type Priority int
+
+const (
+	// PriorityBackfill is for full scrapes of the history of a feed
+	PriorityBackfill Priority = iota
+	// PriorityScheduled is the default, for scrapes added by a Scheduler
+	PriorityScheduled
+	// PriorityInteractive is for scrapes a user asked for and is waiting on
+	PriorityInteractive
+)
+
 type Scrape struct {
 	ID     uuid.UUID `json:"id"`
 	FeedID uuid.UUID `json:"feed_id"`
@@ -16,15 +29,34 @@ type Scrape struct {
 	StartedAt        time.Time `json:"started_at"`
 	EndedAt          time.Time `json:"ended_at"`
 
-	State  string   `json:"state"`
-	Errors []string `json:"errors"`
+	State    string   `json:"state"`
+	Errors   []string `json:"errors"`
+	Priority Priority `json:"priority"`
 
 	TotalDatums  int `json:"total_datums"`
 	TotalRetries int `json:"total_retries"`
 	TotalTasks   int `json:"total_tasks"`
+	// TotalTimeouts is how many tasks ran past their deadline, including
+	// ones that succeeded on retry
+	TotalTimeouts int `json:"total_timeouts"`
 
 	Plugin string  `json:"plugin"`
 	Config *Config `json:"config"`
+
+	// LastFailedURL is the url of the last task to error before the scrape
+	// itself failed
+	LastFailedURL string `json:"last_failed_url,omitempty"`
+	// Progress is the last recorded status of a running backfill
+	Progress *ScrapeStatus `json:"progress,omitempty"`
+	// CircuitOpens lists the hosts whose circuits held back tasks of the
+	// scrape, and until when
+	CircuitOpens []string `json:"circuit_opens,omitempty"`
+
+	// RequeuedTasks and RequeuedStatus are set by StartScrapes for scrapes
+	// handed back by HandBackScrape, which are resumed rather than started
+	// from their entrypoints
+	RequeuedTasks  []*QueuedTask `json:"-"`
+	RequeuedStatus *ScrapeStatus `json:"-"`
 }
 
 // A Metastore is used to store the history of all scrape runs and enough meta
@@ -37,6 +69,8 @@ type Metastore interface {
 	// ListScrapes is used to list and filter scrapes, for both session resumption
 	// and UI purposes
 	ListScrapes(ctx context.Context, statusFilter string, limit, offset int) ([]*Scrape, error)
+	// GetScrape returns a single scrape by ID
+	GetScrape(ctx context.Context, id uuid.UUID) (*Scrape, error)
 
 	// FindMissingSchedules adds scrapes that should be run to the future set
 	FindMissingSchedules(ctx context.Context, limit int) ([]*ScheduleRequest, error)
@@ -45,8 +79,34 @@ type Metastore interface {
 	// EndScrape marks a scrape as SUCCESS and records the number of datums and
 	// tasks returned
 	EndScrape(ctx context.Context, id uuid.UUID, datums, retries, tasks int) error
-	// ErrorScrape marks a scrape as ERRORED and adds the error to its list
-	ErrorScrape(ctx context.Context, id uuid.UUID, err error) error
+	// ErrorScrape adds the error to a scrape's list and reschedules it, or
+	// moves it to DEAD once it has failed too many times
+	ErrorScrape(ctx context.Context, id uuid.UUID, lastFailedURL string, err error) error
+
+	// PauseScrape moves a RUNNING scrape to PAUSED, saving the tasks and
+	// counters taken off the Queue so it can be resumed on any node
+	PauseScrape(ctx context.Context, id uuid.UUID, tasks []*QueuedTask, status *ScrapeStatus) error
+	// GetPausedTasks returns the tasks and counters saved by PauseScrape
+	GetPausedTasks(ctx context.Context, id uuid.UUID) ([]*QueuedTask, *ScrapeStatus, error)
+	// ResumeScrape moves a PAUSED scrape back to RUNNING and drops its saved
+	// tasks
+	ResumeScrape(ctx context.Context, id uuid.UUID) error
+
+	// HandBackScrape moves a RUNNING scrape back to WAITING, saving the tasks
+	// and counters taken off the Queue of a node shutting down, so the next
+	// node to start it carries on where it left off
+	HandBackScrape(ctx context.Context, id uuid.UUID, tasks []*QueuedTask, status *ScrapeStatus) error
+
+	// RecordProgress saves the counters of a long running scrape
+	RecordProgress(ctx context.Context, id uuid.UUID, status *ScrapeStatus) error
+	// RecordTimeout counts a task of the scrape that ran out of time
+	RecordTimeout(ctx context.Context, id uuid.UUID) error
+	// RecordCircuitOpen notes that tasks of the scrape were held back as
+	// host looked to be down
+	RecordCircuitOpen(ctx context.Context, id uuid.UUID, host string, until time.Time) error
+	// UpdateScrapeConfig replaces the config of a scrape with one upgraded to
+	// the current ConfigVersion of its plugin
+	UpdateScrapeConfig(ctx context.Context, id uuid.UUID, c *Config) error
 }
 
 // MemMetastore is a metastore that only stores information in memory
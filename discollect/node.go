@@ -0,0 +1,120 @@
+package discollect
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const heartbeatInterval = 15 * time.Second
+
+// A Node is a single running Discollector
+type Node struct {
+	ID          uuid.UUID `json:"id"`
+	Hostname    string    `json:"hostname"`
+	Version     string    `json:"version"`
+	StartedAt   time.Time `json:"started_at"`
+	HeartbeatAt time.Time `json:"heartbeat_at"`
+
+	// Workers is the number of workers running on this node
+	Workers int `json:"workers"`
+	// Load is the number of workers currently processing a task
+	Load int `json:"load"`
+
+	// Draining nodes finish their current tasks but do not start new scrapes
+	Draining bool `json:"draining"`
+}
+
+// A NodeRegistry keeps track of every Discollector running against a shared
+// Metastore, so that individual nodes can be drained before deploys
+type NodeRegistry interface {
+	// Heartbeat records that the node is alive and returns whether it has been
+	// asked to drain
+	Heartbeat(ctx context.Context, n *Node) (bool, error)
+}
+
+// a drainSwitch is flipped when this node should stop starting new scrapes
+type drainSwitch struct {
+	v int32
+}
+
+func (ds *drainSwitch) set(drain bool) {
+	var v int32
+	if drain {
+		v = 1
+	}
+	atomic.StoreInt32(&ds.v, v)
+}
+
+func (ds *drainSwitch) on() bool {
+	return atomic.LoadInt32(&ds.v) == 1
+}
+
+// heartbeater periodically registers the node with the NodeRegistry and
+// relays drain commands back to the Discollector
+type heartbeater struct {
+	nr    NodeRegistry
+	er    ErrorReporter
+	node  *Node
+	drain *drainSwitch
+	load  func() (int, int)
+
+	shutdown chan chan struct{}
+	ticker   *time.Ticker
+}
+
+func newNode(version string) *Node {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return &Node{
+		ID:        uuid.New(),
+		Hostname:  hostname,
+		Version:   version,
+		StartedAt: time.Now().In(time.UTC),
+	}
+}
+
+// Start launches the heartbeater
+func (h *heartbeater) Start() {
+	h.ticker = time.NewTicker(heartbeatInterval)
+
+	h.beat()
+	for {
+		select {
+		case a := <-h.shutdown:
+			h.ticker.Stop()
+			a <- struct{}{}
+			return
+		case <-h.ticker.C:
+			h.beat()
+		}
+	}
+}
+
+func (h *heartbeater) beat() {
+	h.node.Workers, h.node.Load = h.load()
+	h.node.HeartbeatAt = time.Now().In(time.UTC)
+
+	drain, err := h.nr.Heartbeat(context.TODO(), h.node)
+	if err != nil {
+		h.er.Report(context.TODO(), nil, fmt.Errorf("discollect: heartbeat: %s", err))
+		return
+	}
+
+	h.node.Draining = drain
+	h.drain.set(drain)
+}
+
+// Stop gracefully stops the heartbeater and blocks until its shutdown
+func (h *heartbeater) Stop() {
+	c := make(chan struct{})
+	h.shutdown <- c
+	<-c
+}
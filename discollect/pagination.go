@@ -0,0 +1,204 @@
+package discollect
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	// pagination helpers follow at most this many pages from the first
+	// unless told otherwise
+	defaultMaxPages = 1000
+	// the urls of this many pages before the current one are remembered
+	// to catch pagination going round in circles
+	pageHistory = 16
+
+	pageExtra = "discollect_page"
+)
+
+// FullScrapePages is how many pages of their newest posts plugins paging
+// through an API fetch on a full scrape, backfills page through every one
+const FullScrapePages = 5
+
+// pageState is carried from page to page in Task.Extra
+type pageState struct {
+	// Page counts pages followed, the first is 1
+	Page int `json:"page"`
+	// Recent holds hashes of the urls of the latest pages, newest last
+	Recent []string `json:"recent,omitempty"`
+}
+
+func getPageState(t *Task) *pageState {
+	ps := &pageState{Page: 1}
+	if raw, ok := t.Extra[pageExtra]; ok {
+		json.Unmarshal(raw, ps)
+	}
+
+	return ps
+}
+
+func pageHash(u string) string {
+	sum := sha256.Sum256([]byte(u))
+	return hex.EncodeToString(sum[:8])
+}
+
+// NextPage returns the task for the page at next following the page t, nil if
+// next is empty, leads back to a page just visited or past maxPages. Relative
+// urls are resolved against t.URL. A maxPages of 0 follows up to 1000 pages
+func NextPage(t *Task, next string, maxPages int) *Task {
+	if maxPages <= 0 {
+		maxPages = defaultMaxPages
+	}
+
+	next = strings.TrimSpace(next)
+	if next == "" {
+		return nil
+	}
+
+	base, err := url.Parse(t.URL)
+	if err != nil {
+		return nil
+	}
+
+	u, err := base.Parse(next)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil
+	}
+	u.Fragment = ""
+	next = u.String()
+
+	ps := getPageState(t)
+	if ps.Page >= maxPages {
+		return nil
+	}
+
+	current := pageHash(t.URL)
+	h := pageHash(next)
+	if h == current {
+		return nil
+	}
+	for _, r := range ps.Recent {
+		if r == h {
+			return nil
+		}
+	}
+
+	ps.Page++
+	ps.Recent = append(ps.Recent, current)
+	if len(ps.Recent) > pageHistory {
+		ps.Recent = ps.Recent[len(ps.Recent)-pageHistory:]
+	}
+
+	raw, err := json.Marshal(ps)
+	if err != nil {
+		return nil
+	}
+
+	extra := make(map[string]json.RawMessage, len(t.Extra)+1)
+	for k, v := range t.Extra {
+		extra[k] = v
+	}
+	extra[pageExtra] = raw
+
+	return &Task{
+		URL:     next,
+		Extra:   extra,
+		Timeout: t.Timeout,
+	}
+}
+
+// NextPageNumber returns the task for the page after t, for sites numbering
+// their pages with the query parameter param, i.e. ?page=2. Pages without it
+// are page 1. See NextPage for when it returns nil
+func NextPageNumber(t *Task, param string, maxPages int) *Task {
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return nil
+	}
+
+	q := u.Query()
+	page := 1
+	if p := q.Get(param); p != "" {
+		page, err = strconv.Atoi(p)
+		if err != nil {
+			return nil
+		}
+	}
+
+	q.Set(param, strconv.Itoa(page+1))
+	u.RawQuery = q.Encode()
+
+	return NextPage(t, u.String(), maxPages)
+}
+
+// NextOffset returns the task for the next batch of an API paged by the offset
+// query parameter param, after t returned got of at most limit items. A short
+// batch is the last one, so nil is returned for it. See NextPage for when
+// else it returns nil
+func NextOffset(t *Task, param string, got, limit, maxPages int) *Task {
+	if got <= 0 || got < limit {
+		return nil
+	}
+
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return nil
+	}
+
+	q := u.Query()
+	offset := 0
+	if o := q.Get(param); o != "" {
+		offset, err = strconv.Atoi(o)
+		if err != nil {
+			return nil
+		}
+	}
+
+	q.Set(param, strconv.Itoa(offset+got))
+	u.RawQuery = q.Encode()
+
+	return NextPage(t, u.String(), maxPages)
+}
+
+// NextLink returns the url of the next page linked from doc, by rel="next" on
+// a link or anchor, or an empty string
+func NextLink(doc *goquery.Document) string {
+	href, _ := doc.Find(`link[rel~="next"], a[rel~="next"]`).First().Attr("href")
+	return href
+}
+
+// NextLinkHeader returns the url of the next page from the Link header of
+// resp, as paged APIs send it, or an empty string
+func NextLinkHeader(resp *http.Response) string {
+	for _, h := range resp.Header["Link"] {
+		for _, link := range strings.Split(h, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+
+			for _, param := range parts[1:] {
+				kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+				if len(kv) != 2 || !strings.EqualFold(kv[0], "rel") {
+					continue
+				}
+
+				for _, rel := range strings.Fields(strings.Trim(kv[1], `"`)) {
+					if strings.EqualFold(rel, "next") {
+						return target[1 : len(target)-1]
+					}
+				}
+			}
+		}
+	}
+
+	return ""
+}
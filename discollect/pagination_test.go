@@ -0,0 +1,98 @@
+package discollect
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestNextPage(t *testing.T) {
+	t.Parallel()
+
+	first := &Task{URL: "https://example.com/stories/1"}
+
+	second := NextPage(first, "/stories/2#top", 0)
+	if second == nil || second.URL != "https://example.com/stories/2" {
+		t.Fatalf("unexpected second page %+v", second)
+	}
+
+	third := NextPage(second, "3", 0)
+	if third == nil || third.URL != "https://example.com/stories/3" {
+		t.Fatalf("unexpected third page %+v", third)
+	}
+
+	if NextPage(third, "/stories/1", 0) != nil {
+		t.Fatal("followed pagination back to the first page")
+	}
+
+	if NextPage(third, third.URL, 0) != nil {
+		t.Fatal("followed pagination to the same page")
+	}
+
+	if NextPage(third, "/stories/4", 3) != nil {
+		t.Fatal("followed pagination past the last page allowed")
+	}
+
+	if NextPage(third, "javascript:void(0)", 0) != nil {
+		t.Fatal("followed a link that is not a page")
+	}
+}
+
+func TestNextPageNumber(t *testing.T) {
+	t.Parallel()
+
+	next := NextPageNumber(&Task{URL: "https://example.com/list?sort=new"}, "page", 0)
+	if next == nil || next.URL != "https://example.com/list?page=2&sort=new" {
+		t.Fatalf("unexpected page %+v", next)
+	}
+
+	next = NextPageNumber(next, "page", 0)
+	if next == nil || next.URL != "https://example.com/list?page=3&sort=new" {
+		t.Fatalf("unexpected page %+v", next)
+	}
+}
+
+func TestNextOffset(t *testing.T) {
+	t.Parallel()
+
+	first := &Task{URL: "https://example.com/api/posts?limit=20"}
+
+	next := NextOffset(first, "offset", 20, 20, 0)
+	if next == nil || next.URL != "https://example.com/api/posts?limit=20&offset=20" {
+		t.Fatalf("unexpected batch %+v", next)
+	}
+
+	if NextOffset(next, "offset", 7, 20, 0) != nil {
+		t.Fatal("followed a short batch")
+	}
+
+	if NextOffset(next, "offset", 0, 20, 0) != nil {
+		t.Fatal("followed an empty batch")
+	}
+}
+
+func TestNextLink(t *testing.T) {
+	t.Parallel()
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<html><body>
+		<a href="/prev" rel="prev">prev</a>
+		<a href="/next" rel="nofollow next">next</a>
+	</body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l := NextLink(doc); l != "/next" {
+		t.Fatalf("expected /next, got %q", l)
+	}
+
+	resp := &http.Response{Header: http.Header{
+		"Link": []string{`<https://api.example.com/posts?page=1>; rel="prev", <https://api.example.com/posts?page=3>; rel="next"`},
+	}}
+
+	if l := NextLinkHeader(resp); l != "https://api.example.com/posts?page=3" {
+		t.Fatalf("expected the next page, got %q", l)
+	}
+}
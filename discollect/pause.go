@@ -0,0 +1,68 @@
+package discollect
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// scrapes are paused and resumed in bulk up to this many at a time
+const maxBulkPause = 1000
+
+// Pause pauses a running scrape. Its pending tasks are taken off the Queue and
+// saved to the Metastore, tasks already in flight finish but nothing more of
+// the scrape runs until it is resumed
+func (d *Discollector) Pause(ctx context.Context, id uuid.UUID) error {
+	return pauseScrape(ctx, d.q, d.ms, id)
+}
+
+// Resume resumes a paused scrape exactly where it left off, completed tasks
+// are not fetched again
+func (d *Discollector) Resume(ctx context.Context, id uuid.UUID) error {
+	tasks, status, err := d.ms.GetPausedTasks(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	err = d.q.Resume(ctx, id, tasks, status)
+	if err != nil {
+		return err
+	}
+
+	return d.ms.ResumeScrape(ctx, id)
+}
+
+// PauseAll pauses every running scrape of plugin, or every running scrape if
+// plugin is empty, returning the IDs of the scrapes it paused. It does not stop
+// new scrapes from starting, drain nodes for that
+func (d *Discollector) PauseAll(ctx context.Context, plugin string) ([]uuid.UUID, error) {
+	return d.bulk(ctx, "RUNNING", plugin, d.Pause)
+}
+
+// ResumeAll resumes every paused scrape of plugin, or every paused scrape if
+// plugin is empty, returning the IDs of the scrapes it resumed
+func (d *Discollector) ResumeAll(ctx context.Context, plugin string) ([]uuid.UUID, error) {
+	return d.bulk(ctx, "PAUSED", plugin, d.Resume)
+}
+
+func (d *Discollector) bulk(ctx context.Context, state, plugin string, fn func(context.Context, uuid.UUID) error) ([]uuid.UUID, error) {
+	scrapes, err := d.ms.ListScrapes(ctx, state, maxBulkPause, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, 0, len(scrapes))
+	for _, sc := range scrapes {
+		if plugin != "" && sc.Plugin != plugin {
+			continue
+		}
+
+		err = fn(ctx, sc.ID)
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, sc.ID)
+	}
+
+	return ids, nil
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/microcosm-cc/bluemonday"
 )
 
 // A Plugin is capable of running scrapes, ideally of a common type or against a single site
@@ -19,6 +20,22 @@ type Plugin struct {
 	// RateLimit is set per-plugin
 	RateLimit *RateLimit
 
+	// Timeout is optional, it is how long a Handler may run for tasks that
+	// do not set their own
+	Timeout time.Duration
+
+	// Headers are sent with every request of the plugin's handlers, unless
+	// the handler sets them itself, i.e. an Accept-Language or a User-Agent
+	// for sites that block the default one
+	Headers http.Header
+
+	// Referer says what Referer requests are sent with, none by default
+	Referer RefererPolicy
+
+	// IgnoreRobots skips robots.txt checks, for plugins that only fetch
+	// resources published for machines, like feeds
+	IgnoreRobots bool
+
 	// a list of valid Entrypoint patterns for this plugin, can easily just be `.*`
 	// especially if it merits further testing via the ConfigCreator
 	// this gets compiled into regexps at boot
@@ -28,30 +45,128 @@ type Plugin struct {
 	// them into a fully valid config as well as returning the normalized title
 	ConfigCreator func(url string, ho *HandlerOpts) (string, *Config, error)
 
-	// the Scheduler looks into the past and tells the future
-	Scheduler func(*ScheduleRequest) ([]*ScrapeSchedule, error)
+	// Login is optional, it signs into the origin site with the credentials
+	// of a feed before the first task of a scrape of it runs, leaving the
+	// session cookies in ho.Jar
+	Login func(ctx context.Context, ho *HandlerOpts, c *Credentials) error
+
+	// Backfill is optional, it returns the config of a BackfillScrape of the
+	// feed first scraped with c, whose handlers walk archives or chapter
+	// lists for every post ever made. Feeds of plugins without it can not be
+	// backfilled
+	Backfill func(c *Config) (*Config, error)
+
+	// ContentTypes are the media types of documents this plugin reads, i.e.
+	// application/rss+xml. They are used to pick a plugin by fetching urls no
+	// Entrypoint pattern could be resolved for, see SniffEntrypoint
+	ContentTypes []string
+
+	// ExternalID is optional, it returns the ID the origin site uses for the
+	// feed at url, i.e. a story ID, or an empty string if there is none. Feeds
+	// with the same ExternalID are the same feed no matter their url, as urls
+	// holding a title change whenever it is renamed
+	ExternalID func(url string, ho *HandlerOpts) string
+
+	// AllowHTML is optional, it extends the policy the bodies of posts scraped
+	// by this plugin are sanitized with, i.e. to keep embedded videos
+	AllowHTML func(*bluemonday.Policy)
+
+	// ConfigSchema is optional, a JSON schema configs of this plugin must
+	// satisfy on top of BaseConfigSchema
+	ConfigSchema string
+
+	// ConfigVersion is the version of the configs this plugin makes, bumped
+	// whenever their shape changes, i.e. entrypoints moving to another url.
+	// Stored configs of an older Version are upgraded before they are run
+	ConfigVersion int
+	// MigrateConfig is optional, it upgrades c from version from to the one
+	// after it. Plugins without it have older configs run unchanged
+	MigrateConfig func(from int, c *Config) (*Config, error)
+
+	// Quota is optional, it caps what a single task may use. Limits it leaves
+	// unset are those of WithQuota, or DefaultQuota
+	Quota *Quota
+
+	// the Scheduler looks into the past and tells the future, feeds may be
+	// configured with a ScheduleSpec to use instead
+	Scheduler Scheduler
 
 	// map of regexp to Handler
 	Routes map[string]Handler
 }
 
+// A ScrapeType says how much of a feed a scrape fetches
+type ScrapeType string
+
 const (
-	FullScrape  = "full_scrape"
-	DeltaScrape = "delta_scrape"
+	// FullScrape fetches every post of a feed
+	FullScrape ScrapeType = "full_scrape"
+	// DeltaScrape only fetches the index and posts newer than Config.Since
+	DeltaScrape ScrapeType = "delta_scrape"
+	// BackfillScrape walks the archives of a feed for its entire history, it
+	// runs at PriorityBackfill and a lower rate than other scrapes
+	BackfillScrape ScrapeType = "backfill_scrape"
 )
 
 // Config is a specific configuration of a given plugin
 type Config struct {
-	// friendly identifier for this config
-	Type string
+	// Type is FullScrape for initial scrapes and backfills, schedulers request
+	// DeltaScrapes once a feed has posts
+	Type ScrapeType
 	// Entrypoints is used to start a scrape
 	Entrypoints []string
-	// Since is used to convey delta information
+	// Since is the time of the latest stored post for delta scrapes
 	Since time.Time
 	// Countries is a list of countries this scrape can be executed from
 	// in two code, ISO-3166-2 form
 	// nil if unused
 	Countries []string
+	// Version is the ConfigVersion of the plugin this config was made by,
+	// zero for configs made before plugins were versioned
+	Version int
+}
+
+// Priority returns the priority a scheduled scrape of the config is given,
+// backfills run behind every other scrape. The first scrape of a feed, like
+// those a user asks for, is given PriorityInteractive instead, as the user
+// who added it is waiting on its posts
+func (c *Config) Priority() Priority {
+	if c != nil && c.Type == BackfillScrape {
+		return PriorityBackfill
+	}
+
+	return PriorityScheduled
+}
+
+// Newer returns true if a post made at t should be fetched by a scrape of this
+// config, delta scrapes skip anything that is not newer than Since
+func (c *Config) Newer(t time.Time) bool {
+	return c == nil || c.Type != DeltaScrape || c.Since.IsZero() || t.After(c.Since)
+}
+
+// NewerDay is Newer for sites that only date posts by the day, as day in UTC.
+// Posts of the same day as Since may have been made after it, so are fetched
+// too, leaving the posts already stored to be skipped when written
+func (c *Config) NewerDay(day time.Time) bool {
+	if c == nil || c.Type != DeltaScrape || c.Since.IsZero() {
+		return true
+	}
+
+	y, m, d := c.Since.UTC().Date()
+	return !day.Before(time.Date(y, m, d, 0, 0, 0, 0, time.UTC))
+}
+
+// Delta returns a delta scrape config of c for posts after since, or c
+// unchanged if nothing has been posted yet
+func (c *Config) Delta(since time.Time) *Config {
+	if since.IsZero() {
+		return c
+	}
+
+	delta := *c
+	delta.Type = DeltaScrape
+	delta.Since = since
+	return &delta
 }
 
 // Value implements sql.Valuer for config
@@ -79,6 +194,10 @@ type HandlerOpts struct {
 	FileStore FileStore
 
 	Client *http.Client
+	// Jar holds the session cookies of scrapes of feeds with Credentials, it
+	// is shared by every task of the scrape run on this node and already set
+	// on Client. nil for feeds without credentials
+	Jar http.CookieJar
 }
 
 // A HandlerResponse is returned from a Handler
@@ -115,7 +234,9 @@ type Handler func(ctx context.Context, ho *HandlerOpts, t *Task) *HandlerRespons
 const defaultTimeout = 180 * time.Second
 
 // launchScrape launches a new scrape and enqueues the initial tasks
-func launchScrape(ctx context.Context, id uuid.UUID, p *Plugin, cfg *Config, q Queue, ms Metastore) error {
+func launchScrape(ctx context.Context, id uuid.UUID, p *Plugin, cfg *Config, prio Priority, q Queue, ms Metastore) error {
+	tc := startScrapeTrace(ctx, id, p, cfg)
+
 	qts := make([]*QueuedTask, 0)
 	for _, e := range cfg.Entrypoints {
 		qts = append(qts, &QueuedTask{
@@ -124,10 +245,11 @@ func launchScrape(ctx context.Context, id uuid.UUID, p *Plugin, cfg *Config, q Q
 			ScrapeID: id,
 			QueuedAt: time.Now(),
 			Plugin:   p.Name,
+			Priority: prio,
 			Retries:  0,
+			Trace:    tc,
 			Task: &Task{
-				URL:     e,
-				Timeout: defaultTimeout,
+				URL: e,
 			},
 		})
 	}
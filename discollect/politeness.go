@@ -0,0 +1,231 @@
+package discollect
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// host states are pruned once there are more than this many
+const maxPoliteHosts = 10000
+
+// Politeness is the operators policy on how hard origin sites may be hit. It
+// is enforced on every request plugins make, on top of their own rate limits
+type Politeness struct {
+	// MaxRequests caps requests in flight across every host, 0 is unlimited
+	MaxRequests int
+	// HostDelay is the least time between the start of two requests to one
+	// host
+	HostDelay time.Duration
+	// HostParallelism caps requests in flight to any one host, 0 is unlimited
+	HostParallelism int
+}
+
+// WithPoliteness enforces p on the client of every Rotator, so no plugin can
+// get around it
+func WithPoliteness(p Politeness) OptionFn {
+	return func(d *Discollector) error {
+		d.pol = newPoliteness(p)
+		return nil
+	}
+}
+
+// politeness is the state shared by every client p is enforced on
+type politeness struct {
+	Politeness
+
+	// global holds a slot per request in flight, nil if unlimited
+	global chan struct{}
+
+	mu    sync.Mutex
+	hosts map[string]*politeHost
+}
+
+type politeHost struct {
+	// slots holds one per request in flight, nil if unlimited
+	slots chan struct{}
+	// next is the earliest the next request may start
+	next time.Time
+}
+
+func newPoliteness(p Politeness) *politeness {
+	pol := &politeness{
+		Politeness: p,
+		hosts:      make(map[string]*politeHost),
+	}
+	if p.MaxRequests > 0 {
+		pol.global = make(chan struct{}, p.MaxRequests)
+	}
+
+	return pol
+}
+
+// host returns the state of a host, pruning idle ones if there are too many
+func (p *politeness) host(name string) *politeHost {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if h, ok := p.hosts[name]; ok {
+		return h
+	}
+
+	if len(p.hosts) >= maxPoliteHosts {
+		now := time.Now()
+		for n, h := range p.hosts {
+			if len(h.slots) == 0 && h.next.Before(now) {
+				delete(p.hosts, n)
+			}
+		}
+	}
+
+	h := &politeHost{}
+	if p.HostParallelism > 0 {
+		h.slots = make(chan struct{}, p.HostParallelism)
+	}
+	p.hosts[name] = h
+
+	return h
+}
+
+// acquire blocks until a request to host may start, returning a func that
+// frees the slots it holds
+func (p *politeness) acquire(ctx context.Context, host string) (func(), error) {
+	h := p.host(host)
+
+	// the host slot is taken first so global slots are not held while
+	// waiting on a busy host
+	err := take(ctx, h.slots)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.HostDelay > 0 {
+		p.mu.Lock()
+		now := time.Now()
+		at := h.next
+		if at.Before(now) {
+			at = now
+		}
+		h.next = at.Add(p.HostDelay)
+		p.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			give(h.slots)
+			return nil, ctx.Err()
+		case <-time.After(at.Sub(now)):
+		}
+	}
+
+	err = take(ctx, p.global)
+	if err != nil {
+		give(h.slots)
+		return nil, err
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			give(p.global)
+			give(h.slots)
+		})
+	}, nil
+}
+
+// take takes a slot from sem, nil semaphores are unlimited
+func take(ctx context.Context, sem chan struct{}) error {
+	if sem == nil {
+		return nil
+	}
+
+	select {
+	case sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func give(sem chan struct{}) {
+	if sem != nil {
+		<-sem
+	}
+}
+
+// politeTransport holds a request's slots until its body is closed
+type politeTransport struct {
+	next http.RoundTripper
+	p    *politeness
+}
+
+func (pt *politeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	release, err := pt.p.acquire(req.Context(), strings.ToLower(req.URL.Hostname()))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := pt.next.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (rb *releaseBody) Close() error {
+	err := rb.ReadCloser.Close()
+	rb.release()
+	return err
+}
+
+// politeRotator enforces a politeness policy on every client of a Rotator
+type politeRotator struct {
+	Rotator
+	p *politeness
+}
+
+func (pr *politeRotator) Get(c *Config) (*http.Client, error) {
+	client, err := pr.Rotator.Get(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return pr.p.client(client), nil
+}
+
+// client returns a copy of c that makes its requests politely
+func (p *politeness) client(c *http.Client) *http.Client {
+	next := c.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	cc := *c
+	cc.Transport = &politeTransport{
+		next: next,
+		p:    p,
+	}
+
+	return &cc
+}
+
+// PoliteClient returns c with the Politeness of the Discollector enforced on
+// it, for requests made for scrapes outside of plugins, such as rehosting the
+// images of posts. Without one c is returned as it is
+func (d *Discollector) PoliteClient(c *http.Client) *http.Client {
+	if d.pol == nil {
+		return c
+	}
+
+	return d.pol.client(c)
+}
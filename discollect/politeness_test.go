@@ -0,0 +1,75 @@
+package discollect
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoliteness(t *testing.T) {
+	t.Parallel()
+
+	var cases = []struct {
+		name     string
+		p        Politeness
+		inFlight int32
+		minTime  time.Duration
+	}{
+		{"host-parallelism", Politeness{HostParallelism: 2}, 2, 0},
+		{"global", Politeness{MaxRequests: 1, HostParallelism: 3}, 1, 0},
+		{"host-delay", Politeness{HostDelay: 20 * time.Millisecond}, 6, 100 * time.Millisecond},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var current, max int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&current, 1)
+				defer atomic.AddInt32(&current, -1)
+
+				for {
+					m := atomic.LoadInt32(&max)
+					if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+						break
+					}
+				}
+
+				time.Sleep(10 * time.Millisecond)
+			}))
+			defer ts.Close()
+
+			pr := &politeRotator{Rotator: &DefaultRotator{client: ts.Client()}, p: newPoliteness(tt.p)}
+			c, err := pr.Get(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Now()
+			var wg sync.WaitGroup
+			for i := 0; i < 6; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					resp, err := c.Get(ts.URL)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					resp.Body.Close()
+				}()
+			}
+			wg.Wait()
+
+			if max > tt.inFlight {
+				t.Fatalf("expected at most %d requests in flight, got %d", tt.inFlight, max)
+			}
+
+			if elapsed := time.Since(start); elapsed < tt.minTime {
+				t.Fatalf("expected requests to be spread over %s, took %s", tt.minTime, elapsed)
+			}
+		})
+	}
+}
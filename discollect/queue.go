@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"log"
 	"sync"
 	"time"
 
@@ -12,14 +13,27 @@ import (
 
 // A Queue is used to submit and retrieve individual tasks
 type Queue interface {
+	// Pop returns a task of the highest priority scrape that has any queued
 	Pop(ctx context.Context) (*QueuedTask, error)
 	Push(ctx context.Context, tasks []*QueuedTask) error
 
 	Finish(ctx context.Context, qt *QueuedTask) error
 	Error(ctx context.Context, qt *QueuedTask) error
+	// Requeue puts a task that was popped back on the queue as it is, not
+	// counting it as a retry, for tasks that could not be run yet
+	Requeue(ctx context.Context, qt *QueuedTask) error
 
 	Status(ctx context.Context, scrapeID uuid.UUID) (*ScrapeStatus, error)
 
+	// Pause stops handing out the tasks of a scrape, removing and returning
+	// its pending tasks and counters. Tasks already in flight still finish,
+	// and anything they queue is held until the scrape is resumed
+	Pause(ctx context.Context, scrapeID uuid.UUID) ([]*QueuedTask, *ScrapeStatus, error)
+	// Resume hands out the tasks of a paused scrape again, requeueing the
+	// tasks returned by Pause. status restores the counters of the scrape if
+	// the queue lost them while it was paused
+	Resume(ctx context.Context, scrapeID uuid.UUID, tasks []*QueuedTask, status *ScrapeStatus) error
+
 	CompleteScrape(ctx context.Context, scrapeID uuid.UUID) error
 }
 
@@ -35,6 +49,12 @@ type QueuedTask struct {
 	Config   *Config   `json:"config"`
 	Plugin   string    `json:"plugin"`
 	Retries  int       `json:"retries"`
+	// Priority is the priority of the scrape, tasks of higher priority
+	// scrapes are popped first
+	Priority Priority `json:"priority,omitempty"`
+	// Trace is the trace context of the scrape, every task of it is traced
+	// as part of the same trace
+	Trace map[string]string `json:"trace,omitempty"`
 
 	Task *Task `json:"task"`
 }
@@ -45,8 +65,8 @@ type Task struct {
 	URL string `json:"url"`
 	// Extra can be used to send information from a parent task to its children
 	Extra map[string]json.RawMessage `json:"extra,omitempty"`
-	// Timeout is the timeout a single task should have attached to it
-	// defaults to 15s
+	// Timeout is the timeout a single task should have attached to it,
+	// defaults to the Timeout of its Plugin, then of the Discollector
 	Timeout time.Duration
 }
 
@@ -56,13 +76,30 @@ type ScrapeStatus struct {
 	InFlightTasks  int `json:"in_flight_tasks,omitempty"`
 	CompletedTasks int `json:"completed_tasks,omitempty"`
 	RetriedTasks   int `json:"retried_tasks,omitempty"`
+	// LastFailedURL is the url of the last task to error
+	LastFailedURL string `json:"last_failed_url,omitempty"`
 }
 
-// NewMemQueue makes a new purely in-memory queue
+// the MemQueue logs its gauges at most this often
+const queueSampleInterval = 10 * time.Second
+
+// NewMemQueue makes a new purely in-memory queue, without a limit
 func NewMemQueue() *MemQueue {
+	return NewBoundedMemQueue(0)
+}
+
+// NewBoundedMemQueue makes a new in-memory queue holding at most limit pending
+// tasks. Pushes beyond it wait for tasks to be popped, holding back the
+// handlers emitting them, unless every task in flight is waiting to push.
+// Retried and resumed tasks are always taken. A limit of 0 is unlimited
+func NewBoundedMemQueue(limit int) *MemQueue {
 	return &MemQueue{
-		state: make(map[uuid.UUID]*ScrapeStatus),
-		q:     make(map[uuid.UUID]chan *QueuedTask),
+		limit:  limit,
+		room:   make(chan struct{}),
+		state:  make(map[uuid.UUID]*ScrapeStatus),
+		q:      make(map[uuid.UUID][]*QueuedTask),
+		paused: make(map[uuid.UUID]bool),
+		prio:   make(map[uuid.UUID]Priority),
 	}
 }
 
@@ -70,55 +107,99 @@ func NewMemQueue() *MemQueue {
 type MemQueue struct {
 	mu sync.Mutex
 
-	state map[uuid.UUID]*ScrapeStatus
-	q     map[uuid.UUID]chan *QueuedTask
+	limit int
+	// pending counts tasks queued across every scrape, inFlight those
+	// popped and not yet finished and blocked pushes waiting for room
+	pending  int
+	inFlight int
+	blocked  int
+	// room is closed, and replaced, whenever tasks are popped
+	room       chan struct{}
+	lastSample time.Time
+
+	state  map[uuid.UUID]*ScrapeStatus
+	q      map[uuid.UUID][]*QueuedTask
+	paused map[uuid.UUID]bool
+	prio   map[uuid.UUID]Priority
 }
 
 func (mq *MemQueue) reset() {
 	mq.mu.Lock()
 	defer mq.mu.Unlock()
 
+	mq.pending, mq.inFlight = 0, 0
 	mq.state = make(map[uuid.UUID]*ScrapeStatus)
-	mq.q = make(map[uuid.UUID]chan *QueuedTask)
+	mq.q = make(map[uuid.UUID][]*QueuedTask)
+	mq.paused = make(map[uuid.UUID]bool)
+	mq.prio = make(map[uuid.UUID]Priority)
 }
 
-// Pop pops a single task off the left side of the array
+// Pop pops a single task off the left side of the array of the highest
+// priority scrape with tasks queued
 func (mq *MemQueue) Pop(ctx context.Context) (*QueuedTask, error) {
 	mq.mu.Lock()
 	defer mq.mu.Unlock()
 
-	if len(mq.q) == 0 {
-		return nil, nil
-	}
-
-	for _, q := range mq.q {
-		select {
-		case task := <-q:
-			if task != nil {
-				mq.state[task.ScrapeID].InFlightTasks += 1
-				return task, nil
-			} else {
-				return nil, nil
-			}
-		default:
+	var best uuid.UUID
+	var bestPrio Priority
+	found := false
+	for id, q := range mq.q {
+		if mq.paused[id] || len(q) == 0 {
 			continue
 		}
+
+		if !found || mq.prio[id] > bestPrio {
+			best, bestPrio, found = id, mq.prio[id], true
+		}
 	}
 
-	return nil, nil
+	if !found {
+		return nil, nil
+	}
+
+	task := mq.q[best][0]
+	mq.q[best][0] = nil
+	mq.q[best] = mq.q[best][1:]
+
+	mq.state[task.ScrapeID].InFlightTasks += 1
+	mq.pending--
+	mq.inFlight++
+	mq.wake()
+	mq.sample()
+
+	return task, nil
 }
 
-// Push appends tasks to the right side of the array
+// Push appends tasks to the right side of the array, waiting for room if the
+// queue is full. Tasks are pushed all at once or, if waiting fails, not at all
 func (mq *MemQueue) Push(ctx context.Context, tasks []*QueuedTask) error {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	// retries were already counted against the limit
+	fresh := 0
+	for _, t := range tasks {
+		if t != nil && t.Retries == 0 {
+			fresh++
+		}
+	}
+
+	if fresh > 0 {
+		err := mq.waitForRoom(ctx, fresh)
+		if err != nil {
+			return err
+		}
+	}
+
 	for _, t := range tasks {
 		if t == nil {
 			continue
 		}
 
-		mq.mu.Lock()
 		if mq.state[t.ScrapeID] == nil {
 			mq.state[t.ScrapeID] = &ScrapeStatus{}
 		}
+		mq.prio[t.ScrapeID] = t.Priority
 
 		if t.Retries == 0 {
 			mq.state[t.ScrapeID].TotalTasks += 1
@@ -126,41 +207,101 @@ func (mq *MemQueue) Push(ctx context.Context, tasks []*QueuedTask) error {
 			mq.state[t.ScrapeID].RetriedTasks += 1
 		}
 
-		var c chan *QueuedTask
-		if mq.q[t.ScrapeID] == nil {
-			c = make(chan *QueuedTask, 64)
-			mq.q[t.ScrapeID] = c
-		} else {
-			c = mq.q[t.ScrapeID]
-		}
+		mq.enqueue(t)
+	}
+	mq.sample()
+
+	return nil
+}
+
+// waitForRoom blocks until the queue has room for n more tasks, or is empty
+// so batches larger than the limit still go in, mq.mu must be held. Pushes
+// are made by tasks in flight, which stop waiting once every other task in
+// flight is blocked pushing too, as nothing may be left to pop
+func (mq *MemQueue) waitForRoom(ctx context.Context, n int) error {
+	for mq.limit > 0 && mq.pending+n > mq.limit && mq.pending > 0 && mq.inFlight > mq.blocked+1 {
+		mq.blocked++
+		room := mq.room
 		mq.mu.Unlock()
 
-		c <- t
+		var err error
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-room:
+		}
+
+		mq.mu.Lock()
+		mq.blocked--
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// enqueue appends t to its scrape, mq.mu must be held
+func (mq *MemQueue) enqueue(t *QueuedTask) {
+	mq.q[t.ScrapeID] = append(mq.q[t.ScrapeID], t)
+	mq.pending++
+}
+
+// wake wakes every push waiting for room, mq.mu must be held
+func (mq *MemQueue) wake() {
+	close(mq.room)
+	mq.room = make(chan struct{})
+}
+
+// sample logs the gauges of the queue l2met style, picked up by heroku log
+// metrics, mq.mu must be held
+func (mq *MemQueue) sample() {
+	if time.Since(mq.lastSample) < queueSampleInterval {
+		return
+	}
+	mq.lastSample = time.Now()
+
+	log.Printf("discollect: sample#queue.pending=%d sample#queue.in_flight=%d sample#queue.blocked=%d", mq.pending, mq.inFlight, mq.blocked)
+}
+
 func (mq *MemQueue) Error(ctx context.Context, qt *QueuedTask) error {
 	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
 	mq.state[qt.ScrapeID].InFlightTasks -= 1
 	mq.state[qt.ScrapeID].RetriedTasks += 1
+	if qt.Task != nil {
+		mq.state[qt.ScrapeID].LastFailedURL = qt.Task.URL
+	}
+
+	// retries never wait for room, the task was already counted against it
+	mq.inFlight--
+	mq.enqueue(qt)
 
-	writeTo := mq.q[qt.ScrapeID]
-	mq.mu.Unlock()
+	return nil
+}
+
+// Requeue puts a task in flight back on its scrape without counting a retry
+func (mq *MemQueue) Requeue(ctx context.Context, qt *QueuedTask) error {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
 
-	writeTo <- qt
+	mq.state[qt.ScrapeID].InFlightTasks -= 1
+	// like retries it was already counted against the limit
+	mq.inFlight--
+	mq.enqueue(qt)
 
 	return nil
 }
 
-// Finish is a no-op for the MemQueue
+// Finish marks a task as completed
 func (mq *MemQueue) Finish(ctx context.Context, qt *QueuedTask) error {
 	mq.mu.Lock()
 	defer mq.mu.Unlock()
 
 	mq.state[qt.ScrapeID].InFlightTasks -= 1
 	mq.state[qt.ScrapeID].CompletedTasks += 1
+	mq.inFlight--
 
 	return nil
 }
@@ -176,12 +317,60 @@ func (mq *MemQueue) Status(ctx context.Context, scrapeID uuid.UUID) (*ScrapeStat
 	return &cop, nil
 }
 
+// Pause drains the pending tasks of a scrape and stops popping it
+func (mq *MemQueue) Pause(ctx context.Context, scrapeID uuid.UUID) ([]*QueuedTask, *ScrapeStatus, error) {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	mq.paused[scrapeID] = true
+
+	var status ScrapeStatus
+	if ss := mq.state[scrapeID]; ss != nil {
+		status = *ss
+	}
+
+	tasks := make([]*QueuedTask, 0, len(mq.q[scrapeID]))
+	tasks = append(tasks, mq.q[scrapeID]...)
+	mq.pending -= len(tasks)
+	delete(mq.q, scrapeID)
+	mq.wake()
+
+	return tasks, &status, nil
+}
+
+// Resume requeues the tasks of a paused scrape
+func (mq *MemQueue) Resume(ctx context.Context, scrapeID uuid.UUID, tasks []*QueuedTask, status *ScrapeStatus) error {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	delete(mq.paused, scrapeID)
+
+	if mq.state[scrapeID] == nil {
+		ss := *status
+		mq.state[scrapeID] = &ss
+	}
+
+	if len(tasks) > 0 {
+		mq.prio[scrapeID] = tasks[0].Priority
+	}
+
+	for _, t := range tasks {
+		mq.enqueue(t)
+	}
+
+	return nil
+}
+
 func (mq *MemQueue) CompleteScrape(ctx context.Context, scrapeID uuid.UUID) error {
 	mq.mu.Lock()
 	defer mq.mu.Unlock()
 
+	mq.pending -= len(mq.q[scrapeID])
 	delete(mq.state, scrapeID)
 	delete(mq.q, scrapeID)
+	delete(mq.paused, scrapeID)
+	delete(mq.prio, scrapeID)
+	mq.wake()
 
 	return nil
 }
@@ -0,0 +1,114 @@
+package discollect
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestBoundedMemQueue(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mq := NewBoundedMemQueue(2)
+	id := uuid.New()
+
+	newTasks := func(n int) []*QueuedTask {
+		qts := make([]*QueuedTask, n)
+		for i := range qts {
+			qts[i] = &QueuedTask{ScrapeID: id, TaskID: uuid.New(), Task: &Task{URL: "https://example.com"}}
+		}
+		return qts
+	}
+
+	// nothing is in flight to pop the queue yet, so the entrypoints go in
+	err := mq.Push(ctx, newTasks(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// two tasks in flight, one of them pushes more than there is room for
+	a, _ := mq.Pop(ctx)
+	b, _ := mq.Pop(ctx)
+	if a == nil || b == nil {
+		t.Fatal("could not pop tasks")
+	}
+
+	pushed := make(chan error)
+	go func() {
+		pushed <- mq.Push(ctx, newTasks(2))
+	}()
+
+	select {
+	case <-pushed:
+		t.Fatal("push did not wait for room")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// popping the last task makes room for both at once
+	c, _ := mq.Pop(ctx)
+	if c == nil {
+		t.Fatal("could not pop task")
+	}
+
+	select {
+	case err := <-pushed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("push still waiting after the queue was popped")
+	}
+
+	// a full queue takes retries
+	err = mq.Error(ctx, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every task in flight pushing can not wait for each other
+	for _, qt := range []*QueuedTask{b, c} {
+		mq.Finish(ctx, qt)
+	}
+	d, _ := mq.Pop(ctx)
+	if d == nil {
+		t.Fatal("could not pop task")
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- mq.Push(ctx, newTasks(1))
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the only task in flight was left waiting on itself")
+	}
+
+	// waiting pushes give up with their context
+	e, _ := mq.Pop(ctx)
+	if e == nil {
+		t.Fatal("could not pop task")
+	}
+
+	before, _ := mq.Status(ctx, id)
+
+	cctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	err = mq.Push(cctx, newTasks(5))
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected the push to time out, got %v", err)
+	}
+
+	// and push none of their tasks
+	after, _ := mq.Status(ctx, id)
+	if after.TotalTasks != before.TotalTasks || mq.pending != 2 {
+		t.Fatalf("expected a failed push to queue nothing, total went from %d to %d", before.TotalTasks, after.TotalTasks)
+	}
+}
@@ -176,6 +176,163 @@ func QueueTests(t *testing.T, q Queue, resetFunc func()) func(t *testing.T) {
 						return errors.New("no tasks are inflight but one exists")
 					}
 
+					return nil
+				},
+			},
+			{
+				"pause-resume",
+				func(q Queue) error {
+					return q.Push(context.TODO(), []*QueuedTask{
+						{ScrapeID: exID, Task: &Task{URL: "a"}},
+						{ScrapeID: exID, Task: &Task{URL: "b"}},
+					})
+				},
+				func(q Queue) error {
+					qt1, err := q.Pop(context.TODO())
+					if err != nil || qt1 == nil {
+						return fmt.Errorf("could not pop first task: %v", err)
+					}
+
+					tasks, status, err := q.Pause(context.TODO(), exID)
+					if err != nil {
+						return err
+					}
+
+					if len(tasks) != 1 || status.TotalTasks != 2 || status.InFlightTasks != 1 {
+						return fmt.Errorf("wrong pause snapshot, got %d tasks and %+v", len(tasks), status)
+					}
+
+					// the in flight task finishes, but queues nothing poppable
+					err = q.Finish(context.TODO(), qt1)
+					if err != nil {
+						return err
+					}
+
+					err = q.Push(context.TODO(), []*QueuedTask{{ScrapeID: exID, Task: &Task{URL: "c"}}})
+					if err != nil {
+						return err
+					}
+
+					qt, err := q.Pop(context.TODO())
+					if err != nil || qt != nil {
+						return errors.New("popped a task from a paused scrape")
+					}
+
+					err = q.Resume(context.TODO(), exID, tasks, status)
+					if err != nil {
+						return err
+					}
+
+					for i := 0; i < 2; i++ {
+						qt, err := q.Pop(context.TODO())
+						if err != nil || qt == nil {
+							return fmt.Errorf("could not pop task %d after resuming: %v", i, err)
+						}
+					}
+
+					ss, err := q.Status(context.TODO(), exID)
+					if err != nil {
+						return err
+					}
+
+					if ss.TotalTasks != 3 || ss.CompletedTasks != 1 {
+						return fmt.Errorf("wrong scrape status after resuming, got %+v", ss)
+					}
+
+					return nil
+				},
+			},
+			{
+				"priority",
+				func(q Queue) error {
+					for _, p := range []Priority{PriorityBackfill, PriorityInteractive, PriorityScheduled} {
+						err := q.Push(context.TODO(), []*QueuedTask{
+							{ScrapeID: uuid.New(), Priority: p, Task: &Task{URL: "a"}},
+						})
+						if err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+				func(q Queue) error {
+					for _, want := range []Priority{PriorityInteractive, PriorityScheduled, PriorityBackfill} {
+						qt, err := q.Pop(context.TODO())
+						if err != nil || qt == nil {
+							return fmt.Errorf("could not pop task: %v", err)
+						}
+
+						if qt.Priority != want {
+							return fmt.Errorf("expected a task of priority %d, got %d", want, qt.Priority)
+						}
+					}
+
+					return nil
+				},
+			},
+			{
+				"last-failed-url",
+				func(q Queue) error {
+					return q.Push(context.TODO(), []*QueuedTask{
+						{ScrapeID: exID, Task: &Task{URL: "https://example.com/broken"}},
+					})
+				},
+				func(q Queue) error {
+					qt, err := q.Pop(context.TODO())
+					if err != nil || qt == nil {
+						return fmt.Errorf("could not pop task: %v", err)
+					}
+
+					err = q.Error(context.TODO(), qt)
+					if err != nil {
+						return err
+					}
+
+					ss, err := q.Status(context.TODO(), exID)
+					if err != nil {
+						return err
+					}
+
+					if ss.LastFailedURL != "https://example.com/broken" {
+						return fmt.Errorf("expected the failed task's url, got %q", ss.LastFailedURL)
+					}
+
+					return nil
+				},
+			},
+			{
+				"requeue-is-not-a-retry",
+				func(q Queue) error {
+					return q.Push(context.TODO(), []*QueuedTask{
+						{ScrapeID: exID, Task: &Task{URL: "https://example.com/held"}},
+					})
+				},
+				func(q Queue) error {
+					qt, err := q.Pop(context.TODO())
+					if err != nil || qt == nil {
+						return fmt.Errorf("could not pop task: %v", err)
+					}
+
+					err = q.Requeue(context.TODO(), qt)
+					if err != nil {
+						return err
+					}
+
+					ss, err := q.Status(context.TODO(), exID)
+					if err != nil {
+						return err
+					}
+
+					if ss.RetriedTasks != 0 || ss.InFlightTasks != 0 || ss.LastFailedURL != "" {
+						return fmt.Errorf("expected the requeued task to not count as a retry, got %+v", ss)
+					}
+
+					qt, err = q.Pop(context.TODO())
+					if err != nil || qt == nil {
+						return fmt.Errorf("could not pop the requeued task: %v", err)
+					}
+
 					return nil
 				},
 			},
@@ -0,0 +1,188 @@
+package discollect
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// A Quota caps what a single task of a plugin may use, so one that misbehaves
+// fails its own tasks instead of running the worker out of memory
+type Quota struct {
+	// MaxBodySize is the most bytes read of any one response
+	MaxBodySize int64
+	// MaxDocumentBytes is the most bytes read of every response of a task
+	// together, which bounds the memory of the documents parsed from them
+	MaxDocumentBytes int64
+	// MaxTasks is the most tasks a single handler call may return
+	MaxTasks int
+}
+
+// DefaultQuota is enforced on plugins without a Quota of their own, unless
+// another is set with WithQuota. It fits the largest sitemaps the protocol
+// allows, of 50,000 urls and 50MB
+var DefaultQuota = Quota{
+	MaxBodySize:      50 * 1024 * 1024,
+	MaxDocumentBytes: 128 * 1024 * 1024,
+	MaxTasks:         50000,
+}
+
+// WithQuota sets the quota of plugins that do not set their own, in place of
+// DefaultQuota
+func WithQuota(q Quota) OptionFn {
+	return func(d *Discollector) error {
+		if q.MaxBodySize < 0 || q.MaxDocumentBytes < 0 || q.MaxTasks < 0 {
+			return fmt.Errorf("discollect: quota limits can not be negative, got %+v", q)
+		}
+
+		d.quota = &q
+		return nil
+	}
+}
+
+// A QuotaError is returned for tasks that went over the quota of their plugin.
+// The task is not retried, as it would only go over again, and its scrape is
+// failed instead
+type QuotaError struct {
+	Plugin string
+	// Limit is the name of the field of the Quota that was exceeded
+	Limit string
+	Max   int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("discollect: %s went over its %s quota of %d", e.Plugin, e.Limit, e.Max)
+}
+
+// quotaFor returns the quota of p, fields it leaves unset are those of the
+// workers quota
+func (w *Worker) quotaFor(p *Plugin) Quota {
+	q := DefaultQuota
+	if w.quota != nil {
+		q = *w.quota
+	}
+
+	if p.Quota == nil {
+		return q
+	}
+
+	if p.Quota.MaxBodySize > 0 {
+		q.MaxBodySize = p.Quota.MaxBodySize
+	}
+	if p.Quota.MaxDocumentBytes > 0 {
+		q.MaxDocumentBytes = p.Quota.MaxDocumentBytes
+	}
+	if p.Quota.MaxTasks > 0 {
+		q.MaxTasks = p.Quota.MaxTasks
+	}
+
+	return q
+}
+
+// quotaClient wraps c so no response is read past the quota of plugin. The
+// returned transport holds the first limit exceeded
+func quotaClient(c *http.Client, plugin string, q Quota) (*http.Client, *quotaTransport) {
+	next := c.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	qt := &quotaTransport{
+		next:   next,
+		plugin: plugin,
+		q:      q,
+	}
+
+	cc := *c
+	cc.Transport = qt
+
+	return &cc, qt
+}
+
+type quotaTransport struct {
+	next   http.RoundTripper
+	plugin string
+	q      Quota
+
+	mu       sync.Mutex
+	read     int64
+	exceeded *QuotaError
+}
+
+func (qt *quotaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if qe := qt.err(); qe != nil {
+		return nil, qe
+	}
+
+	resp, err := qt.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// refused before it is read at all if it says it is too large
+	if qt.q.MaxBodySize > 0 && resp.ContentLength > qt.q.MaxBodySize {
+		resp.Body.Close()
+		return nil, qt.exceed("MaxBodySize", qt.q.MaxBodySize)
+	}
+
+	resp.Body = &quotaBody{ReadCloser: resp.Body, qt: qt}
+	return resp, nil
+}
+
+// count adds n bytes read of a body of which read have been read, returning
+// the limit it exceeds if any
+func (qt *quotaTransport) count(n int, read int64) error {
+	if qt.q.MaxBodySize > 0 && read > qt.q.MaxBodySize {
+		return qt.exceed("MaxBodySize", qt.q.MaxBodySize)
+	}
+
+	qt.mu.Lock()
+	qt.read += int64(n)
+	total := qt.read
+	qt.mu.Unlock()
+
+	if qt.q.MaxDocumentBytes > 0 && total > qt.q.MaxDocumentBytes {
+		return qt.exceed("MaxDocumentBytes", qt.q.MaxDocumentBytes)
+	}
+
+	return nil
+}
+
+// exceed records the first limit exceeded
+func (qt *quotaTransport) exceed(limit string, max int64) *QuotaError {
+	qt.mu.Lock()
+	defer qt.mu.Unlock()
+
+	if qt.exceeded == nil {
+		qt.exceeded = &QuotaError{Plugin: qt.plugin, Limit: limit, Max: max}
+	}
+
+	return qt.exceeded
+}
+
+// err returns the first limit exceeded, or nil
+func (qt *quotaTransport) err() *QuotaError {
+	qt.mu.Lock()
+	defer qt.mu.Unlock()
+
+	return qt.exceeded
+}
+
+// quotaBody fails reads once the body or the task reads too much
+type quotaBody struct {
+	io.ReadCloser
+	qt   *quotaTransport
+	read int64
+}
+
+func (qb *quotaBody) Read(p []byte) (int, error) {
+	n, err := qb.ReadCloser.Read(p)
+	qb.read += int64(n)
+
+	if qerr := qb.qt.count(n, qb.read); qerr != nil {
+		return 0, qerr
+	}
+
+	return n, err
+}
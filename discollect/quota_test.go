@@ -0,0 +1,171 @@
+package discollect
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestQuota(t *testing.T) {
+	t.Parallel()
+
+	// /n serves n bytes, chunked ones without saying how many
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		if r.URL.Query().Get("chunked") == "" {
+			w.Header().Set("Content-Length", strconv.Itoa(n))
+		}
+		for i := 0; i < n; i += 100 {
+			w.Write([]byte(strings.Repeat("a", 100)))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer ts.Close()
+
+	fetch := func(paths ...string) Handler {
+		return func(ctx context.Context, ho *HandlerOpts, t *Task) *HandlerResponse {
+			for _, path := range paths {
+				resp, err := ho.Client.Get(ts.URL + path)
+				if err != nil {
+					return ErrorResponse(err)
+				}
+				_, err = ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				if err != nil {
+					return ErrorResponse(err)
+				}
+			}
+
+			return Response(nil, &Task{URL: ts.URL + "/1"}, &Task{URL: ts.URL + "/2"})
+		}
+	}
+
+	var cases = []struct {
+		Name    string
+		Quota   *Quota
+		Handler Handler
+		Limit   string
+	}{
+		{"under quota", &Quota{MaxBodySize: 1000}, fetch("/1000", "/1000?chunked=1"), ""},
+		{"large body", &Quota{MaxBodySize: 1000}, fetch("/2000"), "MaxBodySize"},
+		{"large chunked body", &Quota{MaxBodySize: 1000}, fetch("/2000?chunked=1"), "MaxBodySize"},
+		{"too many documents", &Quota{MaxDocumentBytes: 2500}, fetch("/1000", "/1000", "/1000?chunked=1"), "MaxDocumentBytes"},
+		{"too many tasks", &Quota{MaxTasks: 1}, fetch(), "MaxTasks"},
+		{"default quota", nil, fetch("/1000"), ""},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			p := &Plugin{
+				Name:   "greedy",
+				Quota:  tc.Quota,
+				Routes: map[string]Handler{`.*`: tc.Handler},
+			}
+
+			r, err := NewRegistry([]*Plugin{p})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			q := NewMemQueue()
+			w := NewWorker(r, NewDefaultRotator(), &NilLimiter{}, q, NewStubFS(), &StdoutWriter{}, &StdoutReporter{})
+
+			err = w.processTask(context.Background(), &QueuedTask{
+				ScrapeID: uuid.New(),
+				Plugin:   "greedy",
+				Config:   &Config{Type: FullScrape},
+				Task:     &Task{URL: ts.URL + "/0"},
+			})
+
+			if tc.Limit == "" {
+				if err != nil {
+					t.Fatalf("expected the task to be under quota, got %v", err)
+				}
+				if qt, _ := q.Pop(context.Background()); qt == nil {
+					t.Error("expected the tasks of the handler to be queued")
+				}
+				return
+			}
+
+			qe, ok := err.(*QuotaError)
+			if !ok || qe.Limit != tc.Limit || qe.Plugin != "greedy" {
+				t.Fatalf("expected a %s QuotaError, got %v", tc.Limit, err)
+			}
+
+			// nothing made of a task over quota is kept
+			qt, _ := q.Pop(context.Background())
+			if qt != nil {
+				t.Errorf("expected no tasks to be queued, got %+v", qt.Task)
+			}
+		})
+	}
+}
+
+func TestQuotaFor(t *testing.T) {
+	t.Parallel()
+
+	w := &Worker{}
+	if got := w.quotaFor(&Plugin{}); got != DefaultQuota {
+		t.Errorf("expected the default quota, got %+v", got)
+	}
+
+	w.quota = &Quota{MaxBodySize: 10, MaxDocumentBytes: 20, MaxTasks: 30}
+	got := w.quotaFor(&Plugin{Quota: &Quota{MaxTasks: 5}})
+	if got != (Quota{MaxBodySize: 10, MaxDocumentBytes: 20, MaxTasks: 5}) {
+		t.Errorf("expected the plugin to override only the limits it sets, got %+v", got)
+	}
+}
+
+// errorMetastore records the errors of scrapes, it panics on any other call
+type errorMetastore struct {
+	Metastore
+
+	errors map[uuid.UUID][]string
+}
+
+func (em *errorMetastore) ErrorScrape(ctx context.Context, id uuid.UUID, lastFailedURL string, err error) error {
+	em.errors[id] = append(em.errors[id], lastFailedURL+": "+err.Error())
+	return nil
+}
+
+func TestFailScrape(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	q := NewMemQueue()
+	em := &errorMetastore{errors: make(map[uuid.UUID][]string)}
+	w := NewWorker(&Registry{}, NewDefaultRotator(), &NilLimiter{}, q, NewStubFS(), &StdoutWriter{}, &StdoutReporter{})
+	w.ms = em
+
+	id := uuid.New()
+	err := q.Push(ctx, []*QueuedTask{
+		{ScrapeID: id, Task: &Task{URL: "https://example.com/sitemap.xml"}},
+		{ScrapeID: id, Task: &Task{URL: "https://example.com/1"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	qt, err := q.Pop(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.failScrape(ctx, qt, &QuotaError{Plugin: "greedy", Limit: "MaxTasks", Max: 1})
+	if len(em.errors[id]) != 1 || !strings.HasPrefix(em.errors[id][0], "https://example.com/sitemap.xml: ") {
+		t.Fatalf("expected the quota error to be recorded on the scrape, got %v", em.errors[id])
+	}
+
+	// the rest of the scrape is dropped
+	qt, _ = q.Pop(ctx)
+	if qt != nil {
+		t.Fatalf("expected the tasks of the failed scrape to be dropped, got %+v", qt.Task)
+	}
+}
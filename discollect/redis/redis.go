@@ -13,12 +13,44 @@ import (
 	"github.com/google/uuid"
 )
 
-const activeScrapeIDsKey = `active_scrape_ids`
+const (
+	activeScrapeIDsKey = `active_scrape_ids`
+	// paused scrapes are left out of active_scrape_ids, so no tasks are popped
+	pausedScrapeIDsKey = `paused_scrape_ids`
+)
+
+// priorities are popped highest first
+var priorities = []discollect.Priority{
+	discollect.PriorityInteractive,
+	discollect.PriorityScheduled,
+	discollect.PriorityBackfill,
+}
+
+// activeKey returns the set of active scrapes of a priority, scheduled scrapes
+// keep the original set so queues from before priorities drain as usual
+func activeKey(p discollect.Priority) string {
+	if p == discollect.PriorityScheduled {
+		return activeScrapeIDsKey
+	}
+	return fmt.Sprintf("%s_%d", activeScrapeIDsKey, p)
+}
+
+func activeKeys() []interface{} {
+	keys := make([]interface{}, len(priorities))
+	for i, p := range priorities {
+		keys[i] = activeKey(p)
+	}
+	return keys
+}
 
 func scrapeTasksKey(scrapeID uuid.UUID) string {
 	return fmt.Sprintf("%s_tasks", scrapeID)
 }
 
+func scrapePriorityKey(scrapeID uuid.UUID) string {
+	return fmt.Sprintf("%s_priority", scrapeID)
+}
+
 func scrapeInflightTasksKey(scrapeID uuid.UUID) string {
 	return fmt.Sprintf("%s_inflight_tasks", scrapeID)
 }
@@ -39,6 +71,10 @@ func scrapeCompletedCounterKey(scrapeID uuid.UUID) string {
 	return fmt.Sprintf("%s_completed", scrapeID)
 }
 
+func scrapeLastFailedKey(scrapeID uuid.UUID) string {
+	return fmt.Sprintf("%s_last_failed_url", scrapeID)
+}
+
 // Queue implements discollect.Queue using a redis reliable queue
 type Queue struct {
 	r *redis.Pool
@@ -48,6 +84,28 @@ type Queue struct {
 
 // NewQueue instantiates a queue, checks redis, and returns
 func NewQueue(redisAddr string, redisDBIndex int) (*Queue, error) {
+	pool, err := newPool(redisAddr, redisDBIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := pool.Get()
+	defer conn.Close()
+
+	popScriptSHA, err := redis.String(conn.Do("SCRIPT", "LOAD", popScript))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Queue{
+		r: pool,
+
+		popScriptSHA: popScriptSHA,
+	}, nil
+}
+
+// newPool dials redis and checks it can be reached
+func newPool(redisAddr string, redisDBIndex int) (*redis.Pool, error) {
 	pool := &redis.Pool{
 		// Other pool configuration not shown in this example.
 		Dial: func() (redis.Conn, error) {
@@ -73,47 +131,42 @@ func NewQueue(redisAddr string, redisDBIndex int) (*Queue, error) {
 		return nil, err
 	}
 
-	popScriptSHA, err := redis.String(conn.Do("SCRIPT", "LOAD", popScript))
-	if err != nil {
-		return nil, err
-	}
-
-	return &Queue{
-		r: pool,
-
-		popScriptSHA: popScriptSHA,
-	}, nil
+	return pool, nil
 }
 
 // TODO(fortytw2): if there is nothing in the scrape returned by SRANDMEMBER
 // try again, etc.
-var popScript = fmt.Sprintf(`
+const popScript = `
 -- redis does not allow SRANDMEMBER in default replication mode.. we don't
 -- care about replication though
 redis.replicate_commands()
 
-local scrapeID = redis.call("SRANDMEMBER", "%s")
-if scrapeID == false or scrapeID == nil then
-	return false
+-- KEYS are the active scrape sets, highest priority first
+for _, key in ipairs(KEYS) do
+	local scrapeID = redis.call("SRANDMEMBER", key)
+	if scrapeID ~= false and scrapeID ~= nil then
+		local task = redis.call("RPOPLPUSH", scrapeID .. "_tasks", scrapeID .. "_inflight_tasks")
+		if task ~= nil and task ~= false then
+			redis.call("INCR", scrapeID .. "_inflight")
+			return task
+		end
+	end
 end
 
-local task = redis.call("RPOPLPUSH", scrapeID .. "_tasks", scrapeID .. "_inflight_tasks")
-if task ~= nil and task ~= false then
-	redis.call("INCR", scrapeID .. "_inflight")
-end
+return false
+`
 
-return task 
-`, activeScrapeIDsKey)
-
-// Pop pops a task off any active queue
-// SRANDMEMBER active_scrape_ids
+// Pop pops a task off any active queue, trying each priority in turn
+// SRANDMEMBER active_scrape_ids_priority
 // RPOPLPUSH from scrapeid_tasks to scrapeid_inflight_tasks
 // INCR scrapeid_inflight
 func (q *Queue) Pop(ctx context.Context) (*discollect.QueuedTask, error) {
 	conn := q.r.Get()
 	defer conn.Close()
 
-	task, err := redis.Bytes(conn.Do("EVALSHA", q.popScriptSHA, 0))
+	keys := activeKeys()
+	args := append([]interface{}{q.popScriptSHA, len(keys)}, keys...)
+	task, err := redis.Bytes(conn.Do("EVALSHA", args...))
 	if err != nil {
 		if err == redis.ErrNil {
 			return nil, nil
@@ -132,7 +185,8 @@ func (q *Queue) Pop(ctx context.Context) (*discollect.QueuedTask, error) {
 }
 
 // Push adds a slice of tasks onto the queue
-// SADD scrapeid to active_scrape_ids
+// SET scrapeid_priority
+// SADD scrapeid to active_scrape_ids_priority
 // INCR scrapeid_total
 // LPUSH onto 'scrapeid_tasks'
 func (q *Queue) Push(ctx context.Context, tasks []*discollect.QueuedTask) error {
@@ -145,11 +199,25 @@ func (q *Queue) Push(ctx context.Context, tasks []*discollect.QueuedTask) error
 
 	scrapeID := tasks[0].ScrapeID
 
-	_, err := redis.Int(conn.Do("SADD", activeScrapeIDsKey, scrapeID))
+	// tasks queued by a paused scrape are held until it is resumed
+	paused, err := redis.Bool(conn.Do("SISMEMBER", pausedScrapeIDsKey, scrapeID))
+	if err != nil {
+		return err
+	}
+
+	prio := tasks[0].Priority
+	_, err = conn.Do("SET", scrapePriorityKey(scrapeID), int(prio))
 	if err != nil {
 		return err
 	}
 
+	if !paused {
+		_, err = redis.Int(conn.Do("SADD", activeKey(prio), scrapeID))
+		if err != nil {
+			return err
+		}
+	}
+
 	_, err = redis.Bool(conn.Do("INCRBY", scrapeTotalCounterKey(scrapeID), len(tasks)))
 	if err != nil {
 		return err
@@ -200,6 +268,7 @@ func (q *Queue) Finish(ctx context.Context, task *discollect.QueuedTask) error {
 // INCR retries_counter
 // LREM inflight-tasks
 // DECR inflight_counter
+// SET scrapeid_last_failed_url
 // LPUSH tasks
 func (q *Queue) Error(ctx context.Context, task *discollect.QueuedTask) error {
 	conn := q.r.Get()
@@ -225,6 +294,38 @@ func (q *Queue) Error(ctx context.Context, task *discollect.QueuedTask) error {
 		return err
 	}
 
+	err = setLastFailed(conn, task)
+	if err != nil {
+		return err
+	}
+
+	_, err = redis.Int(conn.Do("LPUSH", scrapeTasksKey(task.ScrapeID), buf))
+	return err
+}
+
+// Requeue puts a task back on the queue without counting a retry
+// LREM inflight-tasks
+// DECR inflight_counter
+// LPUSH tasks
+func (q *Queue) Requeue(ctx context.Context, task *discollect.QueuedTask) error {
+	conn := q.r.Get()
+	defer conn.Close()
+
+	buf, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+
+	_, err = redis.Int(conn.Do("LREM", scrapeInflightTasksKey(task.ScrapeID), "0", buf))
+	if err != nil {
+		return err
+	}
+
+	_, err = redis.Int(conn.Do("DECR", scrapeInflightCounterKey(task.ScrapeID)))
+	if err != nil {
+		return err
+	}
+
 	_, err = redis.Int(conn.Do("LPUSH", scrapeTasksKey(task.ScrapeID), buf))
 	return err
 }
@@ -234,6 +335,11 @@ func (q *Queue) Status(ctx context.Context, scrapeID uuid.UUID) (*discollect.Scr
 	conn := q.r.Get()
 	defer conn.Close()
 
+	return scrapeStatus(conn, scrapeID)
+}
+
+// scrapeStatus reads the counters of a scrape, shared by both queues
+func scrapeStatus(conn redis.Conn, scrapeID uuid.UUID) (*discollect.ScrapeStatus, error) {
 	vals, err := redis.Ints(conn.Do("MGET",
 		scrapeTotalCounterKey(scrapeID),
 		scrapeCompletedCounterKey(scrapeID),
@@ -247,22 +353,179 @@ func (q *Queue) Status(ctx context.Context, scrapeID uuid.UUID) (*discollect.Scr
 		return nil, errors.New("could not get scrape status")
 	}
 
+	lastFailed, err := redis.String(conn.Do("GET", scrapeLastFailedKey(scrapeID)))
+	if err != nil && err != redis.ErrNil {
+		return nil, err
+	}
+
 	return &discollect.ScrapeStatus{
 		TotalTasks:     vals[0],
 		CompletedTasks: vals[1],
 		RetriedTasks:   vals[2],
 		InFlightTasks:  vals[3],
+		LastFailedURL:  lastFailed,
 	}, nil
 }
 
+// setLastFailed records the url of a task that errored, shared by both queues
+// SET scrapeid_last_failed_url
+func setLastFailed(conn redis.Conn, task *discollect.QueuedTask) error {
+	if task.Task == nil {
+		return nil
+	}
+
+	_, err := conn.Do("SET", scrapeLastFailedKey(task.ScrapeID), task.Task.URL)
+	return err
+}
+
+// Pause stops popping a scrape and takes its pending tasks
+// SADD scrapeid to paused_scrape_ids
+// SREM scrapeid from active_scrape_ids
+// MULTI LRANGE DEL scrapeid_tasks EXEC
+func (q *Queue) Pause(ctx context.Context, scrapeID uuid.UUID) ([]*discollect.QueuedTask, *discollect.ScrapeStatus, error) {
+	conn := q.r.Get()
+	defer conn.Close()
+
+	_, err := redis.Int(conn.Do("SADD", pausedScrapeIDsKey, scrapeID))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = deactivate(conn, scrapeID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	status, err := scrapeStatus(conn, scrapeID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// in flight tasks may still push, so the list is read and cleared at once
+	conn.Send("MULTI")
+	conn.Send("LRANGE", scrapeTasksKey(scrapeID), 0, -1)
+	conn.Send("DEL", scrapeTasksKey(scrapeID))
+	replies, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	raw, err := redis.ByteSlices(replies[0], nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tasks := make([]*discollect.QueuedTask, len(raw))
+	for i, buf := range raw {
+		var qt discollect.QueuedTask
+		err = json.Unmarshal(buf, &qt)
+		if err != nil {
+			return nil, nil, err
+		}
+		tasks[i] = &qt
+	}
+
+	return tasks, status, nil
+}
+
+// Resume requeues the tasks of a paused scrape, ahead of any it queued while
+// paused, and starts popping it again
+// SETNX counters
+// RPUSH onto scrapeid_tasks
+// SREM scrapeid from paused_scrape_ids
+// SADD scrapeid to active_scrape_ids_priority
+func (q *Queue) Resume(ctx context.Context, scrapeID uuid.UUID, tasks []*discollect.QueuedTask, status *discollect.ScrapeStatus) error {
+	conn := q.r.Get()
+	defer conn.Close()
+
+	err := restoreCounters(conn, scrapeID, status)
+	if err != nil {
+		return err
+	}
+
+	if len(tasks) > 0 {
+		// tasks are popped from the right, and were taken in list order
+		rpushSet := make([]interface{}, len(tasks)+1)
+		rpushSet[0] = scrapeTasksKey(scrapeID)
+		for i, t := range tasks {
+			buf, err := json.Marshal(t)
+			if err != nil {
+				return err
+			}
+
+			rpushSet[i+1] = buf
+		}
+
+		_, err = redis.Int(conn.Do("RPUSH", rpushSet...))
+		if err != nil {
+			return err
+		}
+	}
+
+	return activate(conn, scrapeID, tasks)
+}
+
+// restoreCounters sets the counters of a scrape from status if they were lost
+func restoreCounters(conn redis.Conn, scrapeID uuid.UUID, status *discollect.ScrapeStatus) error {
+	counters := map[string]int{
+		scrapeTotalCounterKey(scrapeID):     status.TotalTasks,
+		scrapeCompletedCounterKey(scrapeID): status.CompletedTasks,
+		scrapeRetriesCounterKey(scrapeID):   status.RetriedTasks,
+	}
+	for k, v := range counters {
+		_, err := conn.Do("SETNX", k, v)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// activate moves a paused scrape back into the active set of its priority
+func activate(conn redis.Conn, scrapeID uuid.UUID, tasks []*discollect.QueuedTask) error {
+	// the priority is lost if the queue was emptied while paused
+	prio, err := redis.Int(conn.Do("GET", scrapePriorityKey(scrapeID)))
+	if err == redis.ErrNil {
+		prio, err = int(discollect.PriorityScheduled), nil
+		if len(tasks) > 0 {
+			prio = int(tasks[0].Priority)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = redis.Int(conn.Do("SREM", pausedScrapeIDsKey, scrapeID))
+	if err != nil {
+		return err
+	}
+
+	_, err = redis.Int(conn.Do("SADD", activeKey(discollect.Priority(prio)), scrapeID))
+	return err
+}
+
+// deactivate removes a scrape from every active set
+func deactivate(conn redis.Conn, scrapeID uuid.UUID) error {
+	for _, key := range activeKeys() {
+		_, err := redis.Int(conn.Do("SREM", key, scrapeID))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // DELETE scrapeid_tasks
 // DELETE scrapeid_inflight_tasks
 // DELETE scrapeid_total
 // DELETE scrapeid_complete
 // DELETE scrapeid_retries
 // DELETE scrapeid_inflight
-
-// DELETE scrapeid FROM active_scrape_ids
+// DELETE scrapeid_priority
+// DELETE scrapeid_last_failed_url
+// DELETE scrapeid FROM active_scrape_ids_priority
 func (q *Queue) CompleteScrape(ctx context.Context, scrapeID uuid.UUID) error {
 	conn := q.r.Get()
 	defer conn.Close()
@@ -274,6 +537,8 @@ func (q *Queue) CompleteScrape(ctx context.Context, scrapeID uuid.UUID) error {
 		scrapeCompletedCounterKey(scrapeID),
 		scrapeRetriesCounterKey(scrapeID),
 		scrapeInflightCounterKey(scrapeID),
+		scrapePriorityKey(scrapeID),
+		scrapeLastFailedKey(scrapeID),
 	}
 
 	for _, k := range keys {
@@ -283,7 +548,12 @@ func (q *Queue) CompleteScrape(ctx context.Context, scrapeID uuid.UUID) error {
 		}
 	}
 
-	_, err := redis.Int(conn.Do("SREM", activeScrapeIDsKey, scrapeID))
+	err := deactivate(conn, scrapeID)
+	if err != nil {
+		return err
+	}
+
+	_, err = redis.Int(conn.Do("SREM", pausedScrapeIDsKey, scrapeID))
 	return err
 }
 
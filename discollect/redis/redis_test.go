@@ -10,7 +10,7 @@ import (
 )
 
 func TestRedis(t *testing.T) {
-	c, err := dockertest.RunContainer("redis:alpine", "6379", func(addr string) error {
+	c, err := dockertest.RunContainer("redis:7-alpine", "6379", func(addr string) error {
 		_, err := NewQueue(addr, 0)
 		return err
 	})
@@ -30,4 +30,16 @@ func TestRedis(t *testing.T) {
 			panic(err)
 		}
 	}))
+
+	sq, err := NewStreamQueue(c.Addr, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("streams", discollect.QueueTests(t, sq, func() {
+		err := sq.resetAll()
+		if err != nil {
+			panic(err)
+		}
+	}))
 }
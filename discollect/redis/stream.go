@@ -0,0 +1,528 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fortytw2/hydrocarbon/discollect"
+	"github.com/garyburd/redigo/redis"
+	"github.com/google/uuid"
+)
+
+const (
+	// every node reads from the same consumer group, so each task is handed to
+	// exactly one of them
+	streamGroup = "discollect"
+	// tasks claimed this long ago by a consumer that never acked them are
+	// assumed lost with their node and handed out again, it is longer than
+	// any task may run
+	streamClaimTimeout = 5 * time.Minute
+	// Pause claims the pending tasks of a scrape this many at a time
+	streamPauseBatch = 100
+)
+
+func scrapeStreamKey(scrapeID uuid.UUID) string {
+	return fmt.Sprintf("%s_stream", scrapeID)
+}
+
+// StreamQueue implements discollect.Queue using a redis stream per scrape, read
+// through a consumer group. Unlike Queue, tasks popped by a node that dies are
+// claimed by another node once they time out. It needs redis 6.2 or newer
+type StreamQueue struct {
+	r        *redis.Pool
+	consumer string
+
+	// the stream entry of every task popped and not yet finished, which is
+	// needed to ack it
+	mu      sync.Mutex
+	entries map[*discollect.QueuedTask]streamEntry
+}
+
+type streamEntry struct {
+	scrapeID uuid.UUID
+	id       string
+}
+
+// NewStreamQueue instantiates a stream queue, checks redis, and returns
+func NewStreamQueue(redisAddr string, redisDBIndex int) (*StreamQueue, error) {
+	pool, err := newPool(redisAddr, redisDBIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StreamQueue{
+		r:        pool,
+		consumer: uuid.New().String(),
+		entries:  make(map[*discollect.QueuedTask]streamEntry),
+	}, nil
+}
+
+// Pop claims a task of the highest priority active scrape, first reclaiming
+// any that timed out
+// SRANDMEMBER active_scrape_ids_priority
+// XAUTOCLAIM scrapeid_stream, or XREADGROUP scrapeid_stream >
+// INCR scrapeid_inflight
+func (q *StreamQueue) Pop(ctx context.Context) (*discollect.QueuedTask, error) {
+	conn := q.r.Get()
+	defer conn.Close()
+
+	for _, p := range priorities {
+		scrapeID, err := redis.String(conn.Do("SRANDMEMBER", activeKey(p)))
+		if err == redis.ErrNil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		id, err := uuid.Parse(scrapeID)
+		if err != nil {
+			return nil, err
+		}
+
+		// reclaimed tasks were counted in flight when they were first popped
+		reply, err := redis.Values(conn.Do("XAUTOCLAIM", scrapeStreamKey(id), streamGroup, q.consumer,
+			int64(streamClaimTimeout/time.Millisecond), "0-0", "COUNT", 1))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(reply) < 2 {
+			return nil, fmt.Errorf("redis: unexpected XAUTOCLAIM reply %v", reply)
+		}
+
+		qt, err := q.readEntry(id, reply[1])
+		if err != nil || qt != nil {
+			return qt, err
+		}
+
+		reply, err = redis.Values(conn.Do("XREADGROUP", "GROUP", streamGroup, q.consumer,
+			"COUNT", 1, "STREAMS", scrapeStreamKey(id), ">"))
+		if err == redis.ErrNil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// one stream was read
+		stream, err := redis.Values(reply[0], nil)
+		if err != nil {
+			return nil, err
+		}
+
+		qt, err = q.readEntry(id, stream[1])
+		if err != nil {
+			return nil, err
+		}
+
+		if qt != nil {
+			_, err = redis.Int(conn.Do("INCR", scrapeInflightCounterKey(id)))
+			return qt, err
+		}
+	}
+
+	return nil, nil
+}
+
+// readEntry decodes the first of a list of stream entries and remembers it so
+// it can be acked, returning nil if there are none
+func (q *StreamQueue) readEntry(scrapeID uuid.UUID, reply interface{}) (*discollect.QueuedTask, error) {
+	entries, err := redis.Values(reply, nil)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+
+	entryID, qt, err := decodeEntry(entries[0])
+	if err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	q.entries[qt] = streamEntry{scrapeID: scrapeID, id: entryID}
+	q.mu.Unlock()
+
+	return qt, nil
+}
+
+// decodeEntry decodes a single stream entry, which holds one task
+func decodeEntry(reply interface{}) (string, *discollect.QueuedTask, error) {
+	entry, err := redis.Values(reply, nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(entry) != 2 {
+		return "", nil, fmt.Errorf("redis: unexpected stream entry %v", entry)
+	}
+
+	entryID, err := redis.String(entry[0], nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	fields, err := redis.ByteSlices(entry[1], nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(fields) != 2 {
+		return "", nil, fmt.Errorf("redis: malformed stream entry %s", entryID)
+	}
+
+	var qt discollect.QueuedTask
+	err = json.Unmarshal(fields[1], &qt)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return entryID, &qt, nil
+}
+
+// Push adds a slice of tasks onto the stream of their scrape
+// XGROUP CREATE scrapeid_stream
+// SET scrapeid_priority
+// SADD scrapeid to active_scrape_ids_priority
+// INCRBY scrapeid_total
+// XADD scrapeid_stream
+func (q *StreamQueue) Push(ctx context.Context, tasks []*discollect.QueuedTask) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	conn := q.r.Get()
+	defer conn.Close()
+
+	scrapeID := tasks[0].ScrapeID
+
+	err := createGroup(conn, scrapeID)
+	if err != nil {
+		return err
+	}
+
+	// tasks queued by a paused scrape are held until it is resumed
+	paused, err := redis.Bool(conn.Do("SISMEMBER", pausedScrapeIDsKey, scrapeID))
+	if err != nil {
+		return err
+	}
+
+	prio := tasks[0].Priority
+	_, err = conn.Do("SET", scrapePriorityKey(scrapeID), int(prio))
+	if err != nil {
+		return err
+	}
+
+	_, err = redis.Int(conn.Do("INCRBY", scrapeTotalCounterKey(scrapeID), len(tasks)))
+	if err != nil {
+		return err
+	}
+
+	err = addTasks(conn, scrapeID, tasks)
+	if err != nil {
+		return err
+	}
+
+	if paused {
+		return nil
+	}
+
+	_, err = redis.Int(conn.Do("SADD", activeKey(prio), scrapeID))
+	return err
+}
+
+// createGroup creates the consumer group of a scrape, and its stream, if they
+// do not exist yet
+func createGroup(conn redis.Conn, scrapeID uuid.UUID) error {
+	_, err := conn.Do("XGROUP", "CREATE", scrapeStreamKey(scrapeID), streamGroup, "0", "MKSTREAM")
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	return nil
+}
+
+// addTasks appends tasks to the stream of a scrape in a single transaction
+func addTasks(conn redis.Conn, scrapeID uuid.UUID, tasks []*discollect.QueuedTask) error {
+	err := conn.Send("MULTI")
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tasks {
+		buf, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+
+		err = conn.Send("XADD", scrapeStreamKey(scrapeID), "*", "task", buf)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = conn.Do("EXEC")
+	return err
+}
+
+// ack removes the entry of a popped task from the stream of its scrape
+// XACK scrapeid_stream
+// XDEL scrapeid_stream
+// DECR scrapeid_inflight
+func (q *StreamQueue) ack(conn redis.Conn, task *discollect.QueuedTask) error {
+	q.mu.Lock()
+	entry, ok := q.entries[task]
+	delete(q.entries, task)
+	q.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("redis: task %s was not popped from this queue", task.TaskID)
+	}
+
+	_, err := redis.Int(conn.Do("XACK", scrapeStreamKey(entry.scrapeID), streamGroup, entry.id))
+	if err != nil {
+		return err
+	}
+
+	_, err = redis.Int(conn.Do("XDEL", scrapeStreamKey(entry.scrapeID), entry.id))
+	if err != nil {
+		return err
+	}
+
+	_, err = redis.Int(conn.Do("DECR", scrapeInflightCounterKey(task.ScrapeID)))
+	return err
+}
+
+// Finish acks a task
+// INCR scrapeid_completed
+func (q *StreamQueue) Finish(ctx context.Context, task *discollect.QueuedTask) error {
+	conn := q.r.Get()
+	defer conn.Close()
+
+	err := q.ack(conn, task)
+	if err != nil {
+		return err
+	}
+
+	_, err = redis.Int(conn.Do("INCR", scrapeCompletedCounterKey(task.ScrapeID)))
+	return err
+}
+
+// Error acks a task and adds it to the end of the stream to be retried
+// INCR scrapeid_retries
+// SET scrapeid_last_failed_url
+// XADD scrapeid_stream
+func (q *StreamQueue) Error(ctx context.Context, task *discollect.QueuedTask) error {
+	conn := q.r.Get()
+	defer conn.Close()
+
+	err := q.ack(conn, task)
+	if err != nil {
+		return err
+	}
+
+	_, err = redis.Int(conn.Do("INCR", scrapeRetriesCounterKey(task.ScrapeID)))
+	if err != nil {
+		return err
+	}
+
+	err = setLastFailed(conn, task)
+	if err != nil {
+		return err
+	}
+
+	return addTasks(conn, task.ScrapeID, []*discollect.QueuedTask{task})
+}
+
+// Requeue acks a task and adds it to the end of the stream again, without
+// counting a retry
+// XADD scrapeid_stream
+func (q *StreamQueue) Requeue(ctx context.Context, task *discollect.QueuedTask) error {
+	conn := q.r.Get()
+	defer conn.Close()
+
+	err := q.ack(conn, task)
+	if err != nil {
+		return err
+	}
+
+	return addTasks(conn, task.ScrapeID, []*discollect.QueuedTask{task})
+}
+
+// Status returns the status of a given scrape
+func (q *StreamQueue) Status(ctx context.Context, scrapeID uuid.UUID) (*discollect.ScrapeStatus, error) {
+	conn := q.r.Get()
+	defer conn.Close()
+
+	return scrapeStatus(conn, scrapeID)
+}
+
+// Pause stops popping a scrape and claims its undelivered tasks, deleting them
+// from the stream. Tasks pushed while it is paused stay in the stream
+// SADD scrapeid to paused_scrape_ids
+// SREM scrapeid from active_scrape_ids_priority
+// XREADGROUP scrapeid_stream > until it is empty
+// XACK XDEL scrapeid_stream
+func (q *StreamQueue) Pause(ctx context.Context, scrapeID uuid.UUID) ([]*discollect.QueuedTask, *discollect.ScrapeStatus, error) {
+	conn := q.r.Get()
+	defer conn.Close()
+
+	_, err := redis.Int(conn.Do("SADD", pausedScrapeIDsKey, scrapeID))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = deactivate(conn, scrapeID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	status, err := scrapeStatus(conn, scrapeID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = createGroup(conn, scrapeID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tasks := make([]*discollect.QueuedTask, 0)
+	for {
+		reply, err := redis.Values(conn.Do("XREADGROUP", "GROUP", streamGroup, q.consumer,
+			"COUNT", streamPauseBatch, "STREAMS", scrapeStreamKey(scrapeID), ">"))
+		if err == redis.ErrNil {
+			return tasks, status, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		stream, err := redis.Values(reply[0], nil)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		entries, err := redis.Values(stream[1], nil)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(entries) == 0 {
+			return tasks, status, nil
+		}
+
+		ids := []interface{}{scrapeStreamKey(scrapeID), streamGroup}
+		for _, e := range entries {
+			entryID, qt, err := decodeEntry(e)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			tasks = append(tasks, qt)
+			ids = append(ids, entryID)
+		}
+
+		_, err = conn.Do("XACK", ids...)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// XDEL takes the key but no group
+		_, err = conn.Do("XDEL", append(ids[:1:1], ids[2:]...)...)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// Resume adds the tasks of a paused scrape back to its stream, after any it
+// queued while paused, and starts popping it again
+// SETNX counters
+// XADD scrapeid_stream
+// SREM scrapeid from paused_scrape_ids
+// SADD scrapeid to active_scrape_ids_priority
+func (q *StreamQueue) Resume(ctx context.Context, scrapeID uuid.UUID, tasks []*discollect.QueuedTask, status *discollect.ScrapeStatus) error {
+	conn := q.r.Get()
+	defer conn.Close()
+
+	err := restoreCounters(conn, scrapeID, status)
+	if err != nil {
+		return err
+	}
+
+	err = createGroup(conn, scrapeID)
+	if err != nil {
+		return err
+	}
+
+	if len(tasks) > 0 {
+		err = addTasks(conn, scrapeID, tasks)
+		if err != nil {
+			return err
+		}
+	}
+
+	return activate(conn, scrapeID, tasks)
+}
+
+// CompleteScrape deletes the stream and counters of a scrape
+// DELETE scrapeid_stream
+// DELETE scrapeid_total
+// DELETE scrapeid_complete
+// DELETE scrapeid_retries
+// DELETE scrapeid_inflight
+// DELETE scrapeid_priority
+// DELETE scrapeid_last_failed_url
+// DELETE scrapeid FROM active_scrape_ids_priority
+func (q *StreamQueue) CompleteScrape(ctx context.Context, scrapeID uuid.UUID) error {
+	conn := q.r.Get()
+	defer conn.Close()
+
+	keys := []interface{}{
+		scrapeStreamKey(scrapeID),
+		scrapeTotalCounterKey(scrapeID),
+		scrapeCompletedCounterKey(scrapeID),
+		scrapeRetriesCounterKey(scrapeID),
+		scrapeInflightCounterKey(scrapeID),
+		scrapePriorityKey(scrapeID),
+		scrapeLastFailedKey(scrapeID),
+	}
+
+	_, err := redis.Int(conn.Do("DEL", keys...))
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	for qt, e := range q.entries {
+		if e.scrapeID == scrapeID {
+			delete(q.entries, qt)
+		}
+	}
+	q.mu.Unlock()
+
+	err = deactivate(conn, scrapeID)
+	if err != nil {
+		return err
+	}
+
+	_, err = redis.Int(conn.Do("SREM", pausedScrapeIDsKey, scrapeID))
+	return err
+}
+
+// resetAll runs FLUSHALL
+func (q *StreamQueue) resetAll() error {
+	conn := q.r.Get()
+	defer conn.Close()
+
+	q.mu.Lock()
+	q.entries = make(map[*discollect.QueuedTask]streamEntry)
+	q.mu.Unlock()
+
+	_, err := conn.Do("FLUSHALL")
+	return err
+}
@@ -1,6 +1,7 @@
 package discollect
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"regexp"
@@ -22,6 +23,9 @@ type Registry struct {
 
 	// handlers is immutable after creation
 	handlers map[string]map[*regexp.Regexp]Handler
+
+	// schemas every config of a plugin is validated against
+	schemas map[string]*Schema
 }
 
 // NewRegistry indexes a list of plugins and precomputes the routing table
@@ -35,6 +39,7 @@ func NewRegistry(plugins []*Plugin) (*Registry, error) {
 	// precompile all regexps
 	handlers := make(map[string]map[*regexp.Regexp]Handler)
 	entrypoints := make(map[string][]*regexp.Regexp)
+	schemas := make(map[string]*Schema)
 	for _, p := range plugins {
 		handlers[p.Name] = make(map[*regexp.Regexp]Handler)
 		for route, handler := range p.Routes {
@@ -54,6 +59,12 @@ func NewRegistry(plugins []*Plugin) (*Registry, error) {
 
 			entrypoints[p.Name] = append(entrypoints[p.Name], re)
 		}
+
+		schema, err := ParseSchema(configSchema(p))
+		if err != nil {
+			return nil, fmt.Errorf("registry: config schema did not parse for plugin %s: %s", p.Name, err)
+		}
+		schemas[p.Name] = schema
 	}
 
 	return &Registry{
@@ -61,6 +72,7 @@ func NewRegistry(plugins []*Plugin) (*Registry, error) {
 		entrypoints:   entrypoints,
 		pluginsByName: pluginsByName,
 		handlers:      handlers,
+		schemas:       schemas,
 	}, nil
 }
 
@@ -112,3 +124,64 @@ func (r *Registry) PluginFor(entrypointURL string, blacklistNames []string) (*Pl
 
 	return nil, nil, ErrNoValidPluginForEntrypoint
 }
+
+// A PluginInfo describes a registered plugin, i.e. so clients can show which
+// sites are supported
+type PluginInfo struct {
+	Name string `json:"name"`
+	// Entrypoints are the patterns of urls the plugin can follow
+	Entrypoints []string `json:"entrypoints"`
+	// ConfigSchema is the JSON schema configs of the plugin must satisfy
+	ConfigSchema json.RawMessage `json:"config_schema"`
+}
+
+// configSchema combines BaseConfigSchema with the plugin's own, if it has one
+func configSchema(p *Plugin) string {
+	if p.ConfigSchema == "" {
+		return BaseConfigSchema
+	}
+
+	return `{"allOf": [` + BaseConfigSchema + `, ` + p.ConfigSchema + `]}`
+}
+
+// Plugins describes every registered plugin, in the order they were registered
+func (r *Registry) Plugins() []*PluginInfo {
+	out := make([]*PluginInfo, 0, len(r.plugins))
+	for _, p := range r.plugins {
+		entrypoints := p.Entrypoints
+		if entrypoints == nil {
+			entrypoints = []string{}
+		}
+
+		out = append(out, &PluginInfo{
+			Name:         p.Name,
+			Entrypoints:  entrypoints,
+			ConfigSchema: json.RawMessage(configSchema(p)),
+		})
+	}
+
+	return out
+}
+
+// ValidateConfig checks c against the schema of the named plugin, returning a
+// *ValidationError listing every field that does not match
+func (r *Registry) ValidateConfig(pluginName string, c *Config) error {
+	s, ok := r.schemas[pluginName]
+	if !ok {
+		return ErrPluginUnregistered
+	}
+
+	fields, err := s.Validate(c)
+	if err != nil {
+		return err
+	}
+
+	if len(fields) > 0 {
+		return &ValidationError{
+			Plugin: pluginName,
+			Fields: fields,
+		}
+	}
+
+	return nil
+}
@@ -4,8 +4,14 @@ import (
 	"context"
 	"fmt"
 	"time"
+
+	"github.com/google/uuid"
 )
 
+// maxScrapeDuration is how long a scrape may run before it is errored and its
+// remaining tasks dropped, so a stuck scrape is retried later from scratch
+const maxScrapeDuration = 6 * time.Hour
+
 // Resolver watches for scrapes that should be marked complete.
 type Resolver struct {
 	q  Queue
@@ -39,24 +45,67 @@ func (r *Resolver) Start() {
 					continue
 				}
 
-				if ss.InFlightTasks == 0 && (ss.CompletedTasks == ss.TotalTasks) {
-					err = r.ms.EndScrape(context.TODO(), sc.ID, 0, ss.RetriedTasks, ss.CompletedTasks)
-					if err != nil {
+				if ss.InFlightTasks != 0 || ss.CompletedTasks != ss.TotalTasks {
+					if sc.Config != nil && sc.Config.Type == BackfillScrape {
+						r.backfillProgress(sc, ss)
 						continue
 					}
 
-					err = r.q.CompleteScrape(context.TODO(), sc.ID)
-					if err != nil {
-						// TODO(fortytw2):
-						r.er.Report(context.TODO(), nil, fmt.Errorf("could not clean up redis for scrape id: %s: %s", sc.ID, err))
-						continue
+					if time.Since(sc.StartedAt) > maxScrapeDuration {
+						r.errorScrape(sc.ID, ss.LastFailedURL, fmt.Errorf("scrape did not finish within %s, %d of %d tasks completed", maxScrapeDuration, ss.CompletedTasks, ss.TotalTasks))
 					}
+					continue
+				}
+
+				err = r.ms.EndScrape(context.TODO(), sc.ID, 0, ss.RetriedTasks, ss.CompletedTasks)
+				if err != nil {
+					continue
+				}
+
+				err = r.q.CompleteScrape(context.TODO(), sc.ID)
+				if err != nil {
+					// TODO(fortytw2):
+					r.er.Report(context.TODO(), nil, fmt.Errorf("could not clean up redis for scrape id: %s: %s", sc.ID, err))
+					continue
 				}
 			}
 		}
 	}
 }
 
+// backfillProgress records how far a running backfill has got, pausing it if
+// it has run too long so its remaining tasks are kept to be resumed later
+func (r *Resolver) backfillProgress(sc *Scrape, ss *ScrapeStatus) {
+	err := r.ms.RecordProgress(context.TODO(), sc.ID, ss)
+	if err != nil {
+		r.er.Report(context.TODO(), nil, fmt.Errorf("could not record progress of backfill id: %s: %s", sc.ID, err))
+	}
+
+	if time.Since(sc.StartedAt) <= maxBackfillDuration {
+		return
+	}
+
+	err = pauseScrape(context.TODO(), r.q, r.ms, sc.ID)
+	if err != nil {
+		r.er.Report(context.TODO(), nil, fmt.Errorf("could not pause backfill id: %s: %s", sc.ID, err))
+	}
+}
+
+// errorScrape records the failure and drops whatever is left of the scrape
+// from the queue
+func (r *Resolver) errorScrape(id uuid.UUID, lastFailedURL string, scrapeErr error) {
+	err := r.ms.ErrorScrape(context.TODO(), id, lastFailedURL, scrapeErr)
+	if err != nil {
+		r.er.Report(context.TODO(), nil, fmt.Errorf("could not error scrape id: %s: %s", id, err))
+		return
+	}
+
+	err = r.q.CompleteScrape(context.TODO(), id)
+	if err != nil {
+		r.er.Report(context.TODO(), nil, fmt.Errorf("could not clean up redis for scrape id: %s: %s", id, err))
+	}
+}
+
 // Stop gracefully stops the scheduler and blocks until its shutdown
 func (r *Resolver) Stop() {
 	c := make(chan struct{})
@@ -0,0 +1,374 @@
+package discollect
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// robotsAgent is the user-agent token matched against robots.txt groups
+	robotsAgent = "hydrocarbon"
+
+	robotsTTL = 24 * time.Hour
+	// robots.txt that could not be fetched is retried sooner
+	robotsErrorTTL = 10 * time.Minute
+	maxRobotsSize  = 512 * 1024
+	// sites asking for absurd crawl delays are capped to this
+	maxCrawlDelay = time.Minute
+)
+
+// ErrDisallowed is returned for requests disallowed by a sites robots.txt
+var ErrDisallowed = errors.New("discollect: disallowed by robots.txt")
+
+// RobotsStats counts what robots.txt rules have done to a plugins scrapes
+type RobotsStats struct {
+	// Skipped tasks whose URL was disallowed
+	Skipped int64 `json:"skipped"`
+	// Blocked requests made by a handler to a disallowed URL
+	Blocked int64 `json:"blocked"`
+	// Delayed requests that waited for a sites Crawl-delay
+	Delayed int64 `json:"delayed"`
+}
+
+// A RobotsCache fetches and caches robots.txt for every host scraped, and
+// spaces out requests to hosts that set a Crawl-delay. A single RobotsCache is
+// shared by every Worker of a Discollector
+type RobotsCache struct {
+	mu    sync.Mutex
+	rules map[string]*robotsRules
+	// next is the earliest time another request may be made to a host with a
+	// crawl delay
+	next  map[string]time.Time
+	stats map[string]*RobotsStats
+}
+
+// NewRobotsCache returns a new, empty RobotsCache
+func NewRobotsCache() *RobotsCache {
+	return &RobotsCache{
+		rules: make(map[string]*robotsRules),
+		next:  make(map[string]time.Time),
+		stats: make(map[string]*RobotsStats),
+	}
+}
+
+// Stats returns a copy of the counters of every plugin
+func (rc *RobotsCache) Stats() map[string]RobotsStats {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	out := make(map[string]RobotsStats, len(rc.stats))
+	for plugin, s := range rc.stats {
+		out[plugin] = *s
+	}
+	return out
+}
+
+func (rc *RobotsCache) count(plugin string, fn func(s *RobotsStats)) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	s, ok := rc.stats[plugin]
+	if !ok {
+		s = &RobotsStats{}
+		rc.stats[plugin] = s
+	}
+	fn(s)
+}
+
+// allowed returns true if robots.txt allows fetching u
+func (rc *RobotsCache) allowed(ctx context.Context, c *http.Client, u *url.URL) bool {
+	return rc.rulesFor(ctx, c, u).allowed(robotsPath(u))
+}
+
+// wait blocks until u may be fetched, returning ErrDisallowed if it may never
+// be
+func (rc *RobotsCache) wait(ctx context.Context, c *http.Client, u *url.URL) (bool, error) {
+	rr := rc.rulesFor(ctx, c, u)
+	if !rr.allowed(robotsPath(u)) {
+		return false, ErrDisallowed
+	}
+
+	if rr.crawlDelay == 0 {
+		return false, nil
+	}
+
+	rc.mu.Lock()
+	now := time.Now()
+	at := rc.next[u.Host]
+	if at.Before(now) {
+		at = now
+	}
+	rc.next[u.Host] = at.Add(rr.crawlDelay)
+	rc.mu.Unlock()
+
+	delay := at.Sub(now)
+	if delay <= 0 {
+		return false, nil
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return true, ctx.Err()
+	case <-t.C:
+		return true, nil
+	}
+}
+
+// rulesFor returns the cached rules for the host of u, fetching them if they
+// are missing or expired. Concurrent misses may fetch robots.txt twice, which
+// is cheaper than holding the lock for the request
+func (rc *RobotsCache) rulesFor(ctx context.Context, c *http.Client, u *url.URL) *robotsRules {
+	key := u.Scheme + "://" + u.Host
+
+	rc.mu.Lock()
+	rr, ok := rc.rules[key]
+	rc.mu.Unlock()
+
+	if ok && time.Now().Before(rr.expires) {
+		return rr
+	}
+
+	rr = fetchRobots(ctx, c, key)
+
+	rc.mu.Lock()
+	rc.rules[key] = rr
+	rc.mu.Unlock()
+
+	return rr
+}
+
+// fetchRobots follows RFC 9309, a missing robots.txt allows everything while
+// a server error or unreachable host disallows everything until it is retried
+func fetchRobots(ctx context.Context, c *http.Client, base string) *robotsRules {
+	disallowAll := &robotsRules{
+		rules:   []robotsRule{{pattern: "/", allow: false}},
+		expires: time.Now().Add(robotsErrorTTL),
+	}
+
+	req, err := http.NewRequest(http.MethodGet, base+"/robots.txt", nil)
+	if err != nil {
+		return disallowAll
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", DefaultUserAgent)
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return disallowAll
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		rr := parseRobots(io.LimitReader(resp.Body, maxRobotsSize), robotsAgent)
+		rr.expires = time.Now().Add(robotsTTL)
+		return rr
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return &robotsRules{expires: time.Now().Add(robotsTTL)}
+	default:
+		return disallowAll
+	}
+}
+
+type robotsRule struct {
+	pattern string
+	allow   bool
+}
+
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+	expires    time.Time
+}
+
+// parseRobots parses the groups of a robots.txt that apply to agent, falling
+// back to the groups for * if none name it
+func parseRobots(r io.Reader, agent string) *robotsRules {
+	var mine, star robotsRules
+	var matched bool
+
+	// the agents of the group currently being read
+	var isMine, isStar, inAgents bool
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		val := strings.TrimSpace(kv[1])
+
+		if key == "user-agent" {
+			// consecutive user-agent lines share one group
+			if !inAgents {
+				isMine, isStar = false, false
+			}
+			inAgents = true
+
+			ua := strings.ToLower(val)
+			if ua == "*" {
+				isStar = true
+			} else if ua != "" && strings.HasPrefix(ua, agent) {
+				isMine = true
+				matched = true
+			}
+			continue
+		}
+		inAgents = false
+
+		var target []*robotsRules
+		if isMine {
+			target = append(target, &mine)
+		}
+		if isStar {
+			target = append(target, &star)
+		}
+
+		for _, rr := range target {
+			switch key {
+			case "allow", "disallow":
+				// an empty disallow allows everything, which is the default
+				if val != "" {
+					rr.rules = append(rr.rules, robotsRule{pattern: val, allow: key == "allow"})
+				}
+			case "crawl-delay":
+				d, err := strconv.ParseFloat(val, 64)
+				if err == nil && d > 0 {
+					rr.crawlDelay = time.Duration(d * float64(time.Second))
+					if rr.crawlDelay > maxCrawlDelay {
+						rr.crawlDelay = maxCrawlDelay
+					}
+				}
+			}
+		}
+	}
+
+	if matched {
+		return &mine
+	}
+	return &star
+}
+
+// allowed applies the longest matching rule, allow rules win ties
+func (rr *robotsRules) allowed(path string) bool {
+	best, allow := -1, true
+	for _, r := range rr.rules {
+		if !robotsMatch(r.pattern, path) {
+			continue
+		}
+
+		if len(r.pattern) > best || (len(r.pattern) == best && r.allow) {
+			best, allow = len(r.pattern), r.allow
+		}
+	}
+
+	return allow
+}
+
+// robotsMatch matches a path against a robots.txt pattern, where * matches any
+// sequence of characters and a trailing $ anchors the end of the path
+func robotsMatch(pattern, path string) bool {
+	if strings.HasSuffix(pattern, "$") {
+		return globMatch(strings.TrimSuffix(pattern, "$"), path, true)
+	}
+	return globMatch(pattern, path, false)
+}
+
+func globMatch(pattern, s string, anchored bool) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == '*' {
+			pattern = strings.TrimLeft(pattern, "*")
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if globMatch(pattern, s[i:], anchored) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if s == "" || pattern[0] != s[0] {
+			return false
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+
+	return !anchored || s == ""
+}
+
+func robotsPath(u *url.URL) string {
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	}
+	if u.RawQuery != "" {
+		p += "?" + u.RawQuery
+	}
+	return p
+}
+
+// robotsTransport refuses requests disallowed by robots.txt and waits out any
+// crawl delay before passing requests on
+type robotsTransport struct {
+	next   http.RoundTripper
+	rc     *RobotsCache
+	fetch  *http.Client
+	plugin string
+}
+
+func (rt *robotsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Path == "/robots.txt" {
+		return rt.next.RoundTrip(req)
+	}
+
+	delayed, err := rt.rc.wait(req.Context(), rt.fetch, req.URL)
+	if err == ErrDisallowed {
+		rt.rc.count(rt.plugin, func(s *RobotsStats) { s.Blocked++ })
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if delayed {
+		rt.rc.count(rt.plugin, func(s *RobotsStats) { s.Delayed++ })
+	}
+
+	return rt.next.RoundTrip(req)
+}
+
+// robotsClient wraps c so every request it makes obeys robots.txt
+func robotsClient(c *http.Client, rc *RobotsCache, plugin string) *http.Client {
+	next := c.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	cc := *c
+	cc.Transport = &robotsTransport{
+		next:   next,
+		rc:     rc,
+		fetch:  c,
+		plugin: plugin,
+	}
+
+	return &cc
+}
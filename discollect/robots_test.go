@@ -0,0 +1,55 @@
+package discollect
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRobots = `# comments are ignored
+User-agent: *
+Disallow: /private
+Allow: /private/public
+Disallow: /*.pdf$
+Crawl-delay: 2
+
+User-agent: otherbot
+Disallow: /
+
+User-agent: Hydrocarbon
+User-agent: somebot
+Disallow: /search
+Crawl-delay: 5
+`
+
+func TestParseRobots(t *testing.T) {
+	t.Parallel()
+
+	var cases = []struct {
+		name    string
+		agent   string
+		path    string
+		allowed bool
+	}{
+		{"unmatched path", "nobody", "/", true},
+		{"disallowed", "nobody", "/private/thing", false},
+		{"longer allow wins", "nobody", "/private/public/thing", true},
+		{"anchored wildcard", "nobody", "/files/a.pdf", false},
+		{"anchored wildcard suffix", "nobody", "/files/a.pdf?download=1", true},
+		{"named group", "hydrocarbon", "/search?q=x", false},
+		{"named group ignores star", "hydrocarbon", "/private/thing", true},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := parseRobots(strings.NewReader(testRobots), tt.agent)
+			if rr.allowed(tt.path) != tt.allowed {
+				t.Errorf("expected allowed=%t for %s", tt.allowed, tt.path)
+			}
+		})
+	}
+
+	if d := parseRobots(strings.NewReader(testRobots), "hydrocarbon").crawlDelay; d != 5*time.Second {
+		t.Errorf("expected a crawl delay of 5s, got %s", d)
+	}
+}
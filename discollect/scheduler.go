@@ -10,19 +10,22 @@ const pollInterval = 30 * time.Second
 const scrapeLimit = 25
 const forwardScrapeLimit = 5
 
-// A Scheduler initiates new scrapes according to plugin-level schedules
-type Scheduler struct {
+// A scheduler initiates new scrapes according to plugin-level schedules
+type scheduler struct {
 	r  *Registry
 	ms Metastore
 	q  Queue
 	er ErrorReporter
 
+	// while draining no new scrapes are started
+	drain *drainSwitch
+
 	ticker   *time.Ticker
 	shutdown chan chan struct{}
 }
 
 // Start launches the scheduler
-func (s *Scheduler) Start() {
+func (s *scheduler) Start() {
 	s.ticker = time.NewTicker(pollInterval)
 
 	for {
@@ -32,6 +35,10 @@ func (s *Scheduler) Start() {
 			a <- struct{}{}
 			return
 		case <-s.ticker.C:
+			if s.drain.on() {
+				continue
+			}
+
 			scrapes, err := s.ms.StartScrapes(context.TODO(), scrapeLimit)
 			if err != nil {
 				s.er.Report(context.TODO(), nil, err)
@@ -45,7 +52,35 @@ func (s *Scheduler) Start() {
 					continue
 				}
 
-				err = launchScrape(context.TODO(), sc.ID, p, sc.Config, s.q, s.ms)
+				// scrapes handed back by a node that shut down carry on
+				if sc.RequeuedStatus != nil {
+					err = s.q.Resume(context.TODO(), sc.ID, sc.RequeuedTasks, sc.RequeuedStatus)
+					if err != nil {
+						s.er.Report(context.TODO(), nil, err)
+					}
+					continue
+				}
+
+				cfg, err := s.upgradeConfig(p, sc)
+				if _, ok := err.(*ConfigVersionError); ok {
+					// made by a newer node while a deploy rolls out, it is
+					// handed back for one of those rather than failed
+					err = s.ms.HandBackScrape(context.TODO(), sc.ID, nil, nil)
+					if err != nil {
+						s.er.Report(context.TODO(), nil, err)
+					}
+					continue
+				}
+				if err != nil {
+					s.er.Report(context.TODO(), &ReporterOpts{Plugin: sc.Plugin}, err)
+					err = s.ms.ErrorScrape(context.TODO(), sc.ID, "", err)
+					if err != nil {
+						s.er.Report(context.TODO(), nil, err)
+					}
+					continue
+				}
+
+				err = launchScrape(context.TODO(), sc.ID, p, cfg, sc.Priority, s.q, s.ms)
 				if err != nil {
 					s.er.Report(context.TODO(), nil, err)
 				}
@@ -65,11 +100,32 @@ func (s *Scheduler) Start() {
 					continue
 				}
 
-				ss, err := p.Scheduler(sr)
+				// new scrapes are made from the latest ones, so are made
+				// current along with them
+				err = migrateLatest(p, sr)
+				if err != nil {
+					s.er.Report(context.TODO(), &ReporterOpts{Plugin: sr.Plugin}, fmt.Errorf("forward-scheduler: feed %s: %s", sr.FeedID, err))
+					continue
+				}
+
+				ss, err := s.schedulerFor(p, sr).Schedule(sr)
 				if err != nil {
 					s.er.Report(context.TODO(), nil, err)
 					continue
 				}
+				ss = limitFrequency(sr, ss)
+
+				// drop schedules the plugin could never run
+				valid := ss[:0]
+				for _, sched := range ss {
+					err = s.r.ValidateConfig(sr.Plugin, sched.Config)
+					if err != nil {
+						s.er.Report(context.TODO(), &ReporterOpts{Plugin: sr.Plugin}, fmt.Errorf("forward-scheduler: %s", err))
+						continue
+					}
+					valid = append(valid, sched)
+				}
+				ss = valid
 
 				err = s.ms.InsertSchedule(context.TODO(), sr, ss)
 				if err != nil {
@@ -80,8 +136,53 @@ func (s *Scheduler) Start() {
 	}
 }
 
+// upgradeConfig migrates the config of a scrape to the current ConfigVersion
+// of its plugin, storing it if it changed so it is only migrated once
+func (s *scheduler) upgradeConfig(p *Plugin, sc *Scrape) (*Config, error) {
+	cfg, err := migrateConfig(p, sc.Config)
+	if err != nil || cfg == sc.Config {
+		return cfg, err
+	}
+
+	err = s.ms.UpdateScrapeConfig(context.TODO(), sc.ID, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// migrateLatest migrates the configs of the latest scrapes of a feed in place
+func migrateLatest(p *Plugin, sr *ScheduleRequest) error {
+	for _, sc := range sr.LatestScrapes {
+		cfg, err := migrateConfig(p, sc.Config)
+		if err != nil {
+			return err
+		}
+		sc.Config = cfg
+	}
+
+	return nil
+}
+
+// schedulerFor returns the schedule a feed was configured with, or the
+// plugins Scheduler if it has none or it is invalid
+func (s *scheduler) schedulerFor(p *Plugin, sr *ScheduleRequest) Scheduler {
+	if sr.Schedule == nil {
+		return p.Scheduler
+	}
+
+	sched, err := sr.Schedule.Scheduler()
+	if err != nil {
+		s.er.Report(context.TODO(), &ReporterOpts{Plugin: sr.Plugin}, fmt.Errorf("forward-scheduler: feed %s: %s", sr.FeedID, err))
+		return p.Scheduler
+	}
+
+	return sched
+}
+
 // Stop gracefully stops the scheduler and blocks until its shutdown
-func (s *Scheduler) Stop() {
+func (s *scheduler) Stop() {
 	c := make(chan struct{})
 	s.shutdown <- c
 	<-c
@@ -0,0 +1,155 @@
+package discollect
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// A LogEntry is a line of the log of a scrape, either a request made by one
+// of its tasks or an error a task ended with
+type LogEntry struct {
+	ScrapeID uuid.UUID `json:"scrape_id"`
+	TaskID   uuid.UUID `json:"task_id"`
+
+	URL string `json:"url"`
+	// StatusCode is zero if no response was received
+	StatusCode int `json:"status_code,omitempty"`
+	// Duration is how long the response took to start, or the request to
+	// fail
+	Duration time.Duration `json:"duration"`
+	// Bytes is the size of the response body read by the task
+	Bytes int64  `json:"bytes"`
+	Error string `json:"error,omitempty"`
+
+	At time.Time `json:"at"`
+}
+
+// A LogStore keeps the logs of scrapes, so a feed that silently produces no
+// posts can be looked into
+type LogStore interface {
+	// WriteLogs saves the log entries of a single task
+	WriteLogs(ctx context.Context, entries []*LogEntry) error
+	// GetLogs returns the entries of a scrape, oldest first
+	GetLogs(ctx context.Context, scrapeID uuid.UUID, limit, offset int) ([]*LogEntry, error)
+}
+
+// WithLogStore logs every request scrapes make, and every task error, to ls
+func WithLogStore(ls LogStore) OptionFn {
+	return func(d *Discollector) error {
+		d.ls = ls
+		return nil
+	}
+}
+
+// taskLog collects the entries of a single task
+type taskLog struct {
+	qt *QueuedTask
+
+	mu      sync.Mutex
+	entries []*LogEntry
+}
+
+func newTaskLog(qt *QueuedTask) *taskLog {
+	return &taskLog{qt: qt}
+}
+
+func (tl *taskLog) add(e *LogEntry) {
+	e.ScrapeID = tl.qt.ScrapeID
+	e.TaskID = tl.qt.TaskID
+
+	tl.mu.Lock()
+	tl.entries = append(tl.entries, e)
+	tl.mu.Unlock()
+}
+
+// addError adds an entry for an error the task ended with, or reported
+func (tl *taskLog) addError(err error) {
+	tl.add(&LogEntry{
+		URL:   tl.qt.Task.URL,
+		Error: err.Error(),
+		At:    time.Now().In(time.UTC),
+	})
+}
+
+// snapshot returns copies of every entry so far, those of requests still in
+// flight keep being updated
+func (tl *taskLog) snapshot() []*LogEntry {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	entries := make([]*LogEntry, len(tl.entries))
+	for i, e := range tl.entries {
+		ce := *e
+		entries[i] = &ce
+	}
+
+	return entries
+}
+
+// logClient wraps c so every request it makes is added to tl
+func logClient(c *http.Client, tl *taskLog) *http.Client {
+	next := c.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	cc := *c
+	cc.Transport = &logTransport{
+		next: next,
+		tl:   tl,
+	}
+
+	return &cc
+}
+
+type logTransport struct {
+	next http.RoundTripper
+	tl   *taskLog
+}
+
+func (lt *logTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	e := &LogEntry{
+		URL: req.URL.String(),
+		At:  time.Now().In(time.UTC),
+	}
+	lt.tl.add(e)
+
+	resp, err := lt.next.RoundTrip(req)
+	if err != nil {
+		lt.tl.mu.Lock()
+		e.Duration = time.Since(e.At)
+		e.Error = err.Error()
+		lt.tl.mu.Unlock()
+		return nil, err
+	}
+
+	lt.tl.mu.Lock()
+	e.StatusCode = resp.StatusCode
+	e.Duration = time.Since(e.At)
+	lt.tl.mu.Unlock()
+
+	resp.Body = &countingBody{ReadCloser: resp.Body, e: e, mu: &lt.tl.mu}
+	return resp, nil
+}
+
+// countingBody adds the bytes read from it to its entry
+type countingBody struct {
+	io.ReadCloser
+	e  *LogEntry
+	mu *sync.Mutex
+}
+
+func (cb *countingBody) Read(p []byte) (int, error) {
+	n, err := cb.ReadCloser.Read(p)
+
+	cb.mu.Lock()
+	cb.e.Bytes += int64(n)
+	cb.mu.Unlock()
+
+	return n, err
+}
@@ -0,0 +1,106 @@
+package discollect
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+type memLogStore struct {
+	mu      sync.Mutex
+	entries []*LogEntry
+}
+
+func (ml *memLogStore) WriteLogs(ctx context.Context, entries []*LogEntry) error {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	ml.entries = append(ml.entries, entries...)
+	return nil
+}
+
+func (ml *memLogStore) GetLogs(ctx context.Context, scrapeID uuid.UUID, limit, offset int) ([]*LogEntry, error) {
+	return nil, errors.New("not implemented")
+}
+
+func TestScrapeLogs(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Write([]byte("chapter one"))
+	}))
+	defer ts.Close()
+
+	p := &Plugin{
+		Name: "logged",
+		Routes: map[string]Handler{
+			`.*`: func(ctx context.Context, ho *HandlerOpts, t *Task) *HandlerResponse {
+				for _, path := range []string{"/", "/missing"} {
+					resp, err := ho.Client.Get(ts.URL + path)
+					if err != nil {
+						return ErrorResponse(err)
+					}
+					ioutil.ReadAll(resp.Body)
+					resp.Body.Close()
+				}
+
+				return ErrorResponse(errors.New("no chapters found"))
+			},
+		},
+	}
+
+	r, err := NewRegistry([]*Plugin{p})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ml := &memLogStore{}
+	w := NewWorker(r, NewDefaultRotator(), &NilLimiter{}, NewMemQueue(), NewStubFS(), &StdoutWriter{}, &StdoutReporter{})
+	w.ls = ml
+
+	qt := &QueuedTask{
+		ScrapeID: uuid.New(),
+		TaskID:   uuid.New(),
+		Plugin:   "logged",
+		Config:   &Config{Type: FullScrape},
+		Task:     &Task{URL: ts.URL},
+	}
+
+	err = w.processTask(context.Background(), qt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ml.entries) != 3 {
+		t.Fatalf("expected 2 requests and an error logged, got %d entries", len(ml.entries))
+	}
+
+	for _, e := range ml.entries {
+		if e.ScrapeID != qt.ScrapeID || e.TaskID != qt.TaskID {
+			t.Fatalf("entry not tagged with its task %+v", e)
+		}
+	}
+
+	if e := ml.entries[0]; e.StatusCode != http.StatusOK || e.Bytes != int64(len("chapter one")) {
+		t.Fatalf("unexpected entry for the first request %+v", e)
+	}
+
+	if e := ml.entries[1]; e.StatusCode != http.StatusNotFound || e.URL != ts.URL+"/missing" {
+		t.Fatalf("unexpected entry for the second request %+v", e)
+	}
+
+	if e := ml.entries[2]; e.Error != "no chapters found" || e.URL != ts.URL {
+		t.Fatalf("unexpected entry for the handler error %+v", e)
+	}
+}
@@ -0,0 +1,101 @@
+package discollect
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// handBackMetastore lists running scrapes and records those handed back, it
+// panics on any other call
+type handBackMetastore struct {
+	Metastore
+
+	running []*Scrape
+
+	mu       sync.Mutex
+	requeued map[uuid.UUID][]*QueuedTask
+}
+
+func (rm *handBackMetastore) ListScrapes(ctx context.Context, statusFilter string, limit, offset int) ([]*Scrape, error) {
+	return rm.running, nil
+}
+
+func (rm *handBackMetastore) HandBackScrape(ctx context.Context, id uuid.UUID, tasks []*QueuedTask, status *ScrapeStatus) error {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	rm.requeued[id] = tasks
+	return nil
+}
+
+func TestShutdownHandsBack(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan struct{}, 1)
+	p := &Plugin{
+		Name:         "stuck",
+		IgnoreRobots: true,
+		Routes: map[string]Handler{
+			`.*`: func(ctx context.Context, ho *HandlerOpts, t *Task) *HandlerResponse {
+				started <- struct{}{}
+				<-ctx.Done()
+				return ErrorResponse(ctx.Err())
+			},
+		},
+	}
+
+	local, remote := uuid.New(), uuid.New()
+	rm := &handBackMetastore{
+		running:  []*Scrape{{ID: local}, {ID: remote}},
+		requeued: make(map[uuid.UUID][]*QueuedTask),
+	}
+
+	q := NewMemQueue()
+	d, err := New(WithPlugins(p), WithQueue(q), WithMetastore(rm), WithLimiter(NewHostLimiter(0, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = q.Push(context.Background(), []*QueuedTask{
+		{ScrapeID: local, TaskID: uuid.New(), Plugin: "stuck", Task: &Task{URL: "https://example.com/1"}},
+		{ScrapeID: local, TaskID: uuid.New(), Plugin: "stuck", Task: &Task{URL: "https://example.com/2"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go d.Start(1)
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("task never started")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	shutdown := make(chan struct{})
+	go func() {
+		d.Shutdown(ctx)
+		close(shutdown)
+	}()
+
+	select {
+	case <-shutdown:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown did not abandon the task in flight")
+	}
+
+	if _, ok := rm.requeued[remote]; ok {
+		t.Fatal("handed back a scrape running on another node")
+	}
+
+	if len(rm.requeued[local]) != 2 {
+		t.Fatalf("expected the abandoned and pending tasks handed back, got %d", len(rm.requeued[local]))
+	}
+}
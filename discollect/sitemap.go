@@ -0,0 +1,173 @@
+package discollect
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// sitemaps may be at most 50MB uncompressed, see sitemaps.org
+const maxSitemapSize = 50 * 1024 * 1024
+
+// SitemapOptions say which urls of a sitemap become tasks
+type SitemapOptions struct {
+	// Include matches the urls that become tasks, every url does if nil.
+	// Sitemaps listed in a sitemap index are always followed
+	Include *regexp.Regexp
+	// MaxAge skips urls last modified longer ago than this, 0 keeps them
+	// all. Delta scrapes also skip urls not modified since Config.Since
+	MaxAge time.Duration
+}
+
+// SitemapHandler returns a Handler for sitemap.xml files and sitemap indexes,
+// gzipped or not. Sitemaps listed in an index become tasks routed back to the
+// plugin, so the route of the handler must match them too. Urls without a
+// lastmod are never skipped for their age
+func SitemapHandler(so *SitemapOptions) Handler {
+	if so == nil {
+		so = &SitemapOptions{}
+	}
+
+	return func(ctx context.Context, ho *HandlerOpts, t *Task) *HandlerResponse {
+		req, err := http.NewRequest(http.MethodGet, t.URL, nil)
+		if err != nil {
+			return ErrorResponse(err)
+		}
+
+		resp, err := ho.Client.Do(req.WithContext(ctx))
+		if err != nil {
+			return ErrorResponse(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return ErrorResponse(fmt.Errorf("discollect: sitemap %s returned %d", t.URL, resp.StatusCode))
+		}
+
+		sm, err := parseSitemap(resp.Body)
+		if err != nil {
+			return ErrorResponse(fmt.Errorf("discollect: could not parse sitemap %s: %s", t.URL, err))
+		}
+
+		base, err := url.Parse(t.URL)
+		if err != nil {
+			return ErrorResponse(err)
+		}
+
+		var tasks []*Task
+		for _, e := range sm.Sitemaps {
+			if u := so.keep(ho.Config, base, e, false); u != "" {
+				tasks = append(tasks, &Task{URL: u, Extra: t.Extra})
+			}
+		}
+
+		for _, e := range sm.URLs {
+			if u := so.keep(ho.Config, base, e, true); u != "" {
+				tasks = append(tasks, &Task{URL: u})
+			}
+		}
+
+		return Response(nil, tasks...)
+	}
+}
+
+// keep returns the absolute url of e if it should become a task, or an empty
+// string. Sitemaps not modified in the window are skipped like urls, nothing
+// they list can be newer
+func (so *SitemapOptions) keep(c *Config, base *url.URL, e sitemapEntry, isURL bool) string {
+	loc, err := base.Parse(strings.TrimSpace(e.Loc))
+	if err != nil || loc.Host == "" {
+		return ""
+	}
+	u := loc.String()
+
+	if isURL && so.Include != nil && !so.Include.MatchString(u) {
+		return ""
+	}
+
+	lastMod, ok := parseLastMod(e.LastMod)
+	if !ok {
+		return u
+	}
+
+	if so.MaxAge > 0 && time.Since(lastMod) > so.MaxAge {
+		return ""
+	}
+
+	if !c.Newer(lastMod) {
+		return ""
+	}
+
+	return u
+}
+
+type sitemap struct {
+	// URLs are set for a urlset, Sitemaps for a sitemap index
+	URLs     []sitemapEntry `xml:"url"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+type sitemapEntry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// parseSitemap reads a sitemap or sitemap index, gunzipping it if needed
+func parseSitemap(r io.Reader) (*sitemap, error) {
+	br := bufio.NewReader(r)
+
+	// the gzip magic number, sites serve .xml.gz with all sorts of
+	// content types so it is not looked at
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+
+		r = gz
+	} else {
+		r = br
+	}
+
+	var sm sitemap
+	err := xml.NewDecoder(io.LimitReader(r, maxSitemapSize)).Decode(&sm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sm, nil
+}
+
+// lastmod is in W3C datetime format, of which sites use any precision
+var lastModLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+func parseLastMod(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, false
+	}
+
+	for _, layout := range lastModLayouts {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
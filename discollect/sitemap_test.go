@@ -0,0 +1,86 @@
+package discollect
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestSitemapHandler(t *testing.T) {
+	t.Parallel()
+
+	recent := time.Now().Add(-time.Hour).Format(time.RFC3339)
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<url><loc>/s/3</loc><lastmod>` + recent + `</lastmod></url>
+</urlset>`))
+	zw.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<sitemap><loc>/stories.xml</loc></sitemap>
+	<sitemap><loc>/new.xml.gz</loc><lastmod>` + recent + `</lastmod></sitemap>
+	<sitemap><loc>/old.xml</loc><lastmod>2010-01-01</lastmod></sitemap>
+</sitemapindex>`))
+		case "/stories.xml":
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<url><loc>/s/1</loc><lastmod>` + recent + `</lastmod></url>
+	<url><loc>/s/2</loc><lastmod>2010-01-01</lastmod></url>
+	<url><loc>/s/4</loc></url>
+	<url><loc>/about</loc></url>
+</urlset>`))
+		case "/new.xml.gz":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(gz.Bytes())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	h := SitemapHandler(&SitemapOptions{
+		Include: regexp.MustCompile(`/s/\d+$`),
+		MaxAge:  30 * 24 * time.Hour,
+	})
+
+	var cases = []struct {
+		name  string
+		c     *Config
+		url   string
+		tasks []string
+	}{
+		{"index", &Config{Type: FullScrape}, "/sitemap.xml", []string{"/stories.xml", "/new.xml.gz"}},
+		{"urlset", &Config{Type: FullScrape}, "/stories.xml", []string{"/s/1", "/s/4"}},
+		{"gzipped", &Config{Type: FullScrape}, "/new.xml.gz", []string{"/s/3"}},
+		{"delta", (&Config{Type: FullScrape}).Delta(time.Now()), "/stories.xml", []string{"/s/4"}},
+	}
+
+	for _, tt := range cases {
+		resp := h(context.Background(), &HandlerOpts{Config: tt.c, Client: ts.Client()}, &Task{URL: ts.URL + tt.url})
+		if len(resp.Errors) > 0 {
+			t.Fatalf("%s: %s", tt.name, resp.Errors[0])
+		}
+
+		var got []string
+		for _, nt := range resp.Tasks {
+			got = append(got, nt.URL[len(ts.URL):])
+		}
+
+		if !reflect.DeepEqual(got, tt.tasks) {
+			t.Errorf("%s: expected tasks %v, got %v", tt.name, tt.tasks, got)
+		}
+	}
+}
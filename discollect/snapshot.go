@@ -0,0 +1,187 @@
+package discollect
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// responses larger than maxSnapshotSize are not captured
+const maxSnapshotSize = 5 * 1024 * 1024
+
+// ErrNoSnapshot is returned when replaying a request that was never captured
+var ErrNoSnapshot = errors.New("discollect: no snapshot captured for request")
+
+// A Snapshot is the raw response to a single GET made during a scrape
+type Snapshot struct {
+	ScrapeID   uuid.UUID   `json:"scrape_id"`
+	URL        string      `json:"url"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	CapturedAt time.Time   `json:"captured_at"`
+}
+
+// A SnapshotStore keeps raw responses so that scrapes can be replayed without
+// hitting the origin site again
+type SnapshotStore interface {
+	PutSnapshot(ctx context.Context, s *Snapshot) error
+	// GetSnapshot returns ErrNoSnapshot if the url was not captured
+	GetSnapshot(ctx context.Context, scrapeID uuid.UUID, url string) (*Snapshot, error)
+}
+
+// captureTransport records every successful GET it makes into a SnapshotStore
+type captureTransport struct {
+	next     http.RoundTripper
+	ss       SnapshotStore
+	scrapeID uuid.UUID
+}
+
+func (ct *captureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := ct.next.RoundTrip(req)
+	if err != nil || req.Method != http.MethodGet {
+		return resp, err
+	}
+
+	if resp.ContentLength > maxSnapshotSize {
+		return resp, nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSnapshotSize+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	// hand back whatever wasn't read, uncaptured
+	if len(body) > maxSnapshotSize {
+		resp.Body = &multiReadCloser{
+			Reader: io.MultiReader(bytes.NewReader(body), resp.Body),
+			Closer: resp.Body,
+		}
+		return resp, nil
+	}
+
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	err = ct.ss.PutSnapshot(req.Context(), &Snapshot{
+		ScrapeID:   ct.scrapeID,
+		URL:        req.URL.String(),
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       body,
+		CapturedAt: time.Now().In(time.UTC),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("discollect: could not capture snapshot: %s", err)
+	}
+
+	return resp, nil
+}
+
+type multiReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// replayTransport answers every request from a SnapshotStore instead of the
+// network
+type replayTransport struct {
+	ss       SnapshotStore
+	scrapeID uuid.UUID
+}
+
+func (rt *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return nil, fmt.Errorf("discollect: cannot replay %s %s", req.Method, req.URL)
+	}
+
+	s, err := rt.ss.GetSnapshot(req.Context(), rt.scrapeID, req.URL.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", s.StatusCode, http.StatusText(s.StatusCode)),
+		StatusCode:    s.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        s.Header,
+		Body:          ioutil.NopCloser(bytes.NewReader(s.Body)),
+		ContentLength: int64(len(s.Body)),
+		Request:       req,
+	}, nil
+}
+
+// captureClient returns a copy of c that records its responses for scrapeID
+func captureClient(c *http.Client, ss SnapshotStore, scrapeID uuid.UUID) *http.Client {
+	next := c.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	cc := *c
+	cc.Transport = &captureTransport{
+		next:     next,
+		ss:       ss,
+		scrapeID: scrapeID,
+	}
+
+	return &cc
+}
+
+// ReplayResult summarizes a replayed scrape
+type ReplayResult struct {
+	Tasks  int      `json:"tasks"`
+	Facts  int      `json:"facts"`
+	Errors []string `json:"errors"`
+}
+
+// Replay re-runs a plugins handlers against the responses captured during a
+// previous scrape, writing every fact out again. It is used to regenerate
+// posts after fixing an extraction bug without re-scraping the origin site.
+func (d *Discollector) Replay(ctx context.Context, scrapeID uuid.UUID) (*ReplayResult, error) {
+	if d.ss == nil {
+		return nil, errors.New("discollect: no SnapshotStore configured, cannot replay")
+	}
+
+	sc, err := d.ms.GetScrape(ctx, scrapeID)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := d.r.Get(sc.Plugin)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{
+		Transport: &replayTransport{
+			ss:       d.ss,
+			scrapeID: sc.ID,
+		},
+	}
+
+	// there is no rate limit to respect as snapshots are cheap to read
+	rs, err := d.runTasks(ctx, p, sc.Config, client, 0, nil, func(f interface{}) error {
+		return d.w.Write(ctx, sc.ID, f)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReplayResult{
+		Tasks:  rs.tasks,
+		Facts:  rs.facts,
+		Errors: rs.errors,
+	}, nil
+}
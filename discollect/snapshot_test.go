@@ -0,0 +1,73 @@
+package discollect
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+type memSnapshotStore map[string]*Snapshot
+
+func (m memSnapshotStore) PutSnapshot(ctx context.Context, s *Snapshot) error {
+	m[s.ScrapeID.String()+s.URL] = s
+	return nil
+}
+
+func (m memSnapshotStore) GetSnapshot(ctx context.Context, scrapeID uuid.UUID, url string) (*Snapshot, error) {
+	s, ok := m[scrapeID.String()+url]
+	if !ok {
+		return nil, ErrNoSnapshot
+	}
+	return s, nil
+}
+
+func TestSnapshotReplay(t *testing.T) {
+	var hits int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("hello " + r.URL.Path))
+	}))
+	defer ts.Close()
+
+	ss := memSnapshotStore{}
+	scrapeID := uuid.New()
+
+	c := captureClient(ts.Client(), ss, scrapeID)
+	resp, err := c.Get(ts.URL + "/one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	live, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	rc := &http.Client{Transport: &replayTransport{ss: ss, scrapeID: scrapeID}}
+
+	resp, err = rc.Get(ts.URL + "/one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(replayed) != string(live) {
+		t.Fatalf("replayed body %q does not match live body %q", replayed, live)
+	}
+
+	if resp.Header.Get("Content-Type") != "text/plain" {
+		t.Fatalf("headers not replayed, got %v", resp.Header)
+	}
+
+	if hits != 1 {
+		t.Fatalf("replay hit the origin, %d requests made", hits)
+	}
+
+	_, err = rc.Get(ts.URL + "/two")
+	if err == nil {
+		t.Fatal("expected error replaying uncaptured url")
+	}
+}
@@ -0,0 +1,146 @@
+package discollect
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// pages larger than this are only sniffed up to this size
+const maxSniffSize = 2 * 1024 * 1024
+
+// generatorFeeds are the paths feeds are published at by popular site
+// generators, keyed by the prefix of their <meta name="generator"> content
+var generatorFeeds = []struct {
+	generator   string
+	path        string
+	contentType string
+}{
+	{"wordpress", "/feed/", "application/rss+xml"},
+	{"ghost", "/rss/", "application/rss+xml"},
+	{"blogger", "/feeds/posts/default", "application/atom+xml"},
+	{"jekyll", "/feed.xml", "application/atom+xml"},
+	{"hugo", "/index.xml", "application/rss+xml"},
+}
+
+// SniffEntrypoint fetches rawURL and picks a plugin by what it finds, for urls
+// that no plugin could be resolved for by pattern alone. Documents are matched
+// against the ContentTypes of each plugin, HTML pages by the feeds they link to
+// with <link rel="alternate"> or the well known feed of the site generator.
+//
+// It returns the entrypoint the plugin should be given, which is a feed url if
+// one was discovered. Blacklisted plugins are only skipped for rawURL itself.
+func (d *Discollector) SniffEntrypoint(ctx context.Context, rawURL string, blacklist []string) (*Plugin, string, *HandlerOpts, error) {
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	c, err := d.ro.Get(nil)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	resp, err := headerClient(c, nil, d.headers).Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, "", nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", nil, ErrNoValidPluginForEntrypoint
+	}
+
+	found := func(p *Plugin, entrypoint string) (*Plugin, string, *HandlerOpts, error) {
+		ho := &HandlerOpts{Client: headerClient(c, p, d.headers)}
+		for _, re := range d.r.entrypoints[p.Name] {
+			if re.MatchString(entrypoint) {
+				ho.RouteParams = re.FindStringSubmatch(entrypoint)
+				break
+			}
+		}
+
+		return p, entrypoint, ho, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if p := d.r.pluginForContentType(mediaType, blacklist); p != nil {
+		return found(p, rawURL)
+	}
+
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, "", nil, ErrNoValidPluginForEntrypoint
+	}
+
+	doc, err := goquery.NewDocumentFromReader(io.LimitReader(resp.Body, maxSniffSize))
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var (
+		p          *Plugin
+		entrypoint string
+	)
+	doc.Find(`link[rel~="alternate"][type][href]`).EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		href, err := base.Parse(strings.TrimSpace(s.AttrOr("href", "")))
+		if err != nil {
+			return true
+		}
+
+		p = d.r.pluginForContentType(strings.TrimSpace(s.AttrOr("type", "")), nil)
+		entrypoint = href.String()
+		return p == nil
+	})
+	if p != nil {
+		return found(p, entrypoint)
+	}
+
+	generator := strings.ToLower(doc.Find(`meta[name="generator"]`).AttrOr("content", ""))
+	for _, gf := range generatorFeeds {
+		if !strings.HasPrefix(generator, gf.generator) {
+			continue
+		}
+
+		if p := d.r.pluginForContentType(gf.contentType, nil); p != nil {
+			feed, _ := base.Parse(gf.path)
+			return found(p, feed.String())
+		}
+	}
+
+	return nil, "", nil, ErrNoValidPluginForEntrypoint
+}
+
+// pluginForContentType returns the first plugin that reads documents of the
+// given media type, or nil if there is none
+func (r *Registry) pluginForContentType(mediaType string, blacklistNames []string) *Plugin {
+	if mediaType == "" {
+		return nil
+	}
+
+outer:
+	for _, p := range r.plugins {
+		for _, b := range blacklistNames {
+			if p.Name == b {
+				continue outer
+			}
+		}
+
+		for _, ct := range p.ContentTypes {
+			if strings.EqualFold(ct, mediaType) {
+				return p
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package discollect
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSniffEntrypoint(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed.xml":
+			w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+			w.Write([]byte(`<rss version="2.0"></rss>`))
+		case "/linked":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><link rel="alternate" type="application/feed+json" href="/feed.json"></head></html>`))
+		case "/wordpress":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><meta name="generator" content="WordPress 4.9.8"></head></html>`))
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><title>nothing here</title></head></html>`))
+		}
+	}))
+	defer ts.Close()
+
+	d, err := New(WithPlugins(
+		&Plugin{Name: "rss", ContentTypes: []string{"application/rss+xml"}},
+		&Plugin{Name: "jsonfeed", ContentTypes: []string{"application/feed+json"}},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cases = []struct {
+		name       string
+		path       string
+		blacklist  []string
+		plugin     string
+		entrypoint string
+	}{
+		{"content-type", "/feed.xml", nil, "rss", "/feed.xml"},
+		{"blacklisted", "/feed.xml", []string{"rss"}, "", ""},
+		{"link-tag", "/linked", []string{"jsonfeed"}, "jsonfeed", "/feed.json"},
+		{"generator", "/wordpress", nil, "rss", "/feed/"},
+		{"unknown", "/other", nil, "", ""},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			p, entrypoint, _, err := d.SniffEntrypoint(context.Background(), ts.URL+tt.path, tt.blacklist)
+			if tt.plugin == "" {
+				if err != ErrNoValidPluginForEntrypoint {
+					t.Fatalf("expected ErrNoValidPluginForEntrypoint, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if p.Name != tt.plugin || entrypoint != ts.URL+tt.entrypoint {
+				t.Fatalf("expected %s at %s, got %s at %s", tt.plugin, ts.URL+tt.entrypoint, p.Name, entrypoint)
+			}
+		})
+	}
+}
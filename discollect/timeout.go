@@ -0,0 +1,78 @@
+package discollect
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrTaskTimeout is returned when a Handler does not return before the
+// deadline of its task, the task is retried
+var ErrTaskTimeout = errors.New("discollect: task timed out")
+
+// WithTaskTimeout sets how long a Handler may run for before its task is
+// abandoned and retried, for tasks and plugins without their own timeout
+func WithTaskTimeout(timeout time.Duration) OptionFn {
+	return func(d *Discollector) error {
+		d.timeout = timeout
+		return nil
+	}
+}
+
+// runHandler runs h until it returns or ctx is done, whichever is first. A
+// Handler that ignores ctx is left to finish in the background, its requests
+// fail once ctx is done as the client passed to it is a deadlineClient
+func runHandler(ctx context.Context, h Handler, ho *HandlerOpts, t *Task) (*HandlerResponse, error) {
+	done := make(chan *HandlerResponse, 1)
+	go func() {
+		done <- h(ctx, ho, t)
+	}()
+
+	select {
+	case resp := <-done:
+		// a handler that gave up as the deadline passed is still a timeout
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, ErrTaskTimeout
+		}
+
+		return resp, nil
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, ErrTaskTimeout
+		}
+
+		return nil, ctx.Err()
+	}
+}
+
+// deadlineClient wraps c so requests made without a context, i.e. with
+// client.Get, are bound by ctx instead of running forever
+func deadlineClient(ctx context.Context, c *http.Client) *http.Client {
+	next := c.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	cc := *c
+	cc.Transport = &deadlineTransport{
+		next: next,
+		ctx:  ctx,
+	}
+
+	return &cc
+}
+
+type deadlineTransport struct {
+	next http.RoundTripper
+	ctx  context.Context
+}
+
+func (dt *deadlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a context that can never be done was not chosen by the handler
+	if req.Context().Done() == nil {
+		req = req.WithContext(dt.ctx)
+	}
+
+	return dt.next.RoundTrip(req)
+}
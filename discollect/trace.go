@@ -0,0 +1,72 @@
+package discollect
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer traces scrapes, it does nothing unless a TracerProvider is set up
+var tracer = otel.Tracer("github.com/fortytw2/hydrocarbon/discollect")
+
+// startScrapeTrace records the start of a scrape, returning its trace context
+// so every task of it is traced under it, on whichever node it runs
+func startScrapeTrace(ctx context.Context, id uuid.UUID, p *Plugin, cfg *Config) map[string]string {
+	ctx, span := tracer.Start(ctx, "discollect.scrape", trace.WithAttributes(
+		attribute.String("scrape.id", id.String()),
+		attribute.String("scrape.plugin", p.Name),
+		attribute.String("scrape.type", string(cfg.Type)),
+	))
+	defer span.End()
+
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	return carrier
+}
+
+// startTaskSpan starts the span of a task, as part of the trace of its scrape
+func startTaskSpan(ctx context.Context, qt *QueuedTask) (context.Context, trace.Span) {
+	if qt.Trace != nil {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(qt.Trace))
+	}
+
+	return tracer.Start(ctx, "discollect.task", trace.WithAttributes(
+		attribute.String("scrape.id", qt.ScrapeID.String()),
+		attribute.String("scrape.plugin", qt.Plugin),
+		attribute.String("task.id", qt.TaskID.String()),
+		attribute.String("task.url", qt.Task.URL),
+		attribute.Int("task.retries", qt.Retries),
+	))
+}
+
+// endSpan ends span, marking it failed if err is set
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// traceClient wraps c so every request it makes is a span of the task making
+// it. The trace context is not sent on, origin sites have no use for it
+func traceClient(c *http.Client) *http.Client {
+	next := c.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	cc := *c
+	cc.Transport = otelhttp.NewTransport(next, otelhttp.WithPropagators(propagation.NewCompositeTextMapPropagator()))
+
+	return &cc
+}
@@ -0,0 +1,97 @@
+package discollect
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTaskTracing(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var traceparent string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.Write([]byte("chapter one"))
+	}))
+	defer ts.Close()
+
+	p := &Plugin{
+		Name: "traced",
+		Routes: map[string]Handler{
+			`.*`: func(ctx context.Context, ho *HandlerOpts, t *Task) *HandlerResponse {
+				resp, err := ho.Client.Get(ts.URL)
+				if err != nil {
+					return ErrorResponse(err)
+				}
+				resp.Body.Close()
+
+				return Response([]interface{}{"chapter one"})
+			},
+		},
+	}
+
+	r, err := NewRegistry([]*Plugin{p})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := NewMemQueue()
+	id := uuid.New()
+	cfg := &Config{Type: FullScrape, Entrypoints: []string{ts.URL}}
+	err = launchScrape(context.Background(), id, p, cfg, PriorityScheduled, q, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	qt, err := q.Pop(context.Background())
+	if err != nil || qt == nil {
+		t.Fatalf("could not pop task: %v", err)
+	}
+
+	w := NewWorker(r, NewDefaultRotator(), &NilLimiter{}, q, NewStubFS(), &recordingWriter{}, &StdoutReporter{})
+	err = w.processTask(context.Background(), qt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if traceparent != "" {
+		t.Fatalf("trace context was sent to the origin site %q", traceparent)
+	}
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range sr.Ended() {
+		spans[s.Name()] = s
+	}
+
+	for _, name := range []string{"discollect.scrape", "discollect.task", "discollect.handle", "discollect.write", "HTTP GET"} {
+		if _, ok := spans[name]; !ok {
+			t.Fatalf("no %s span recorded, got %v", name, spans)
+		}
+	}
+
+	scrape := spans["discollect.scrape"].SpanContext()
+	task := spans["discollect.task"]
+	if task.SpanContext().TraceID() != scrape.TraceID() || task.Parent().SpanID() != scrape.SpanID() {
+		t.Fatal("task not traced as part of its scrape")
+	}
+
+	for _, name := range []string{"discollect.handle", "discollect.write"} {
+		if spans[name].Parent().SpanID() != task.SpanContext().SpanID() {
+			t.Fatalf("%s is not a child of the task", name)
+		}
+	}
+
+	if spans["HTTP GET"].Parent().SpanID() != spans["discollect.handle"].SpanContext().SpanID() {
+		t.Fatal("request is not a child of the handler")
+	}
+}
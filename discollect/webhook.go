@@ -0,0 +1,161 @@
+package discollect
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// deliveries are attempted this many times before the error is returned
+	maxWebhookAttempts = 4
+	// the delay before the first retry, doubled for every one after
+	webhookBackoff = 500 * time.Millisecond
+	// datums written while this many wait to be delivered are dropped
+	webhookQueueSize = 1024
+)
+
+// A WebhookWriter POSTs every datum as JSON to a url, so other systems can
+// react to new posts as they are scraped. As a secondary writer of an
+// InsertWriter, such as the stores, it is only sent new posts
+type WebhookWriter struct {
+	url     string
+	secret  []byte
+	c       *http.Client
+	backoff time.Duration
+
+	queue chan []byte
+	done  chan struct{}
+	close sync.Once
+}
+
+// NewWebhookWriter returns a WebhookWriter for url. If secret is set every
+// delivery is signed with it, see sign
+func NewWebhookWriter(url, secret string) *WebhookWriter {
+	return newWebhookWriter(url, secret, webhookBackoff)
+}
+
+func newWebhookWriter(url, secret string, backoff time.Duration) *WebhookWriter {
+	ww := &WebhookWriter{
+		url:     url,
+		secret:  []byte(secret),
+		c:       &http.Client{Timeout: 10 * time.Second},
+		backoff: backoff,
+		queue:   make(chan []byte, webhookQueueSize),
+		done:    make(chan struct{}),
+	}
+	go ww.run()
+
+	return ww
+}
+
+// Write queues the datum and the scrape it came from to be delivered in the
+// background, so a slow or failing webhook never holds up a worker. It only
+// fails once too many deliveries are waiting, dropping the datum
+func (ww *WebhookWriter) Write(ctx context.Context, scrapeID uuid.UUID, f interface{}) error {
+	buf, err := json.Marshal(struct {
+		ScrapeID uuid.UUID   `json:"scrape_id"`
+		Datum    interface{} `json:"datum"`
+	}{scrapeID, f})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case ww.queue <- buf:
+		return nil
+	default:
+		return errors.New("discollect: too many webhook deliveries waiting, dropped datum")
+	}
+}
+
+// run makes every queued delivery in turn, until the WebhookWriter is closed
+func (ww *WebhookWriter) run() {
+	defer close(ww.done)
+
+	for buf := range ww.queue {
+		err := ww.send(buf)
+		if err != nil {
+			log.Printf("discollect: webhook delivery failed: %s", err)
+		}
+	}
+}
+
+// send delivers buf, retrying network errors, 429s and 5xxs with exponential
+// backoff
+func (ww *WebhookWriter) send(buf []byte) error {
+	delay := ww.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := ww.deliver(context.Background(), buf)
+		if err == nil || !retry || attempt == maxWebhookAttempts {
+			return err
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// deliver makes a single delivery, returning whether a failure is worth
+// retrying
+func (ww *WebhookWriter) deliver(ctx context.Context, buf []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, ww.url, bytes.NewReader(buf))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if len(ww.secret) > 0 {
+		ww.sign(req, buf, time.Now())
+	}
+
+	resp, err := ww.c.Do(req.WithContext(ctx))
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retry, fmt.Errorf("discollect: webhook returned %d", resp.StatusCode)
+	}
+
+	return false, nil
+}
+
+// sign sets X-Discollect-Timestamp to the unix time of the delivery and
+// X-Discollect-Signature to the hex encoded HMAC-SHA256 of the timestamp, a
+// period and the body, so receivers can reject replayed deliveries
+func (ww *WebhookWriter) sign(req *http.Request, body []byte, now time.Time) {
+	ts := strconv.FormatInt(now.Unix(), 10)
+
+	mac := hmac.New(sha256.New, ww.secret)
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+
+	req.Header.Set("X-Discollect-Timestamp", ts)
+	req.Header.Set("X-Discollect-Signature", hex.EncodeToString(mac.Sum(nil)))
+}
+
+// Close waits for the deliveries already queued to be made, nothing may be
+// written after it
+func (ww *WebhookWriter) Close() error {
+	ww.close.Do(func() {
+		close(ww.queue)
+	})
+	<-ww.done
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package discollect
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestWebhookWriter(t *testing.T) {
+	t.Parallel()
+
+	var cases = []struct {
+		name     string
+		statuses []int
+		attempts int
+		fails    bool
+	}{
+		{"delivered", []int{200}, 1, false},
+		{"retried", []int{503, 429, 204}, 3, false},
+		{"gives-up", []int{500, 500, 500, 500, 200}, maxWebhookAttempts, true},
+		{"not-retried", []int{400, 200}, 1, true},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+
+				mac := hmac.New(sha256.New, []byte("secret"))
+				mac.Write([]byte(r.Header.Get("X-Discollect-Timestamp") + "."))
+				mac.Write(body)
+				if r.Header.Get("X-Discollect-Signature") != hex.EncodeToString(mac.Sum(nil)) {
+					t.Errorf("signature does not match body %s", body)
+				}
+
+				w.WriteHeader(tt.statuses[attempts])
+				attempts++
+			}))
+			defer ts.Close()
+
+			ww := newWebhookWriter(ts.URL, "secret", 0)
+			defer ww.Close()
+
+			err := ww.send([]byte(`{"datum":{"title":"chapter one"}}`))
+			if (err != nil) != tt.fails {
+				t.Fatalf("expected failure=%t, got %v", tt.fails, err)
+			}
+
+			if attempts != tt.attempts {
+				t.Fatalf("expected %d attempts, got %d", tt.attempts, attempts)
+			}
+		})
+	}
+}
+
+func TestWebhookWriterAsync(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	delivered := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		body, _ := ioutil.ReadAll(r.Body)
+		delivered <- string(body)
+	}))
+	defer ts.Close()
+
+	ww := newWebhookWriter(ts.URL, "", 0)
+
+	// the webhook has not answered, but the worker is not held up
+	err := ww.Write(context.Background(), uuid.New(), "chapter one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+
+	err = ww.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case body := <-delivered:
+		if !strings.Contains(body, "chapter one") {
+			t.Fatalf("unexpected delivery %s", body)
+		}
+	default:
+		t.Fatal("expected Close to wait for the queued delivery")
+	}
+}
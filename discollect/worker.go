@@ -3,10 +3,16 @@ package discollect
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // A Worker is a single-threaded worker that pulls a single task from the queue at a time
@@ -19,12 +25,46 @@ type Worker struct {
 	w  Writer
 	fs FileStore
 	er ErrorReporter
+	// ss is optional, if set every response is captured for later replay
+	ss SnapshotStore
+	// rc is optional, if set robots.txt is obeyed
+	rc *RobotsCache
+	// hc is optional, if set requests are made conditional
+	hc HTTPCache
+	// sc is optional, if set scrapes of feeds with credentials are logged in
+	sc *sessionCache
+	// cb is optional, if set tasks against hosts that keep failing are held
+	// back
+	cb *breaker
+	// ms is optional, if set timed out tasks, open circuits and tasks over
+	// their quota are recorded on their scrape
+	ms Metastore
+	// ls is optional, if set every request and error of a task is logged
+	ls LogStore
+	// headers override those of every plugin, if set
+	headers http.Header
+	// quota is enforced on plugins without their own, DefaultQuota if nil
+	quota *Quota
+
+	// timeout is how long tasks may run unless they or their plugin say
+	// otherwise, defaultTimeout if zero
+	timeout time.Duration
+
+	// busy is set while the worker is processing a task
+	busy int32
+
+	// ctx is the parent of every task, it is cancelled to abandon the task
+	// in flight when the worker is not stopped in time
+	ctx    context.Context
+	cancel context.CancelFunc
 
 	shutdown chan chan struct{}
 }
 
 // NewWorker provisions a new worker
 func NewWorker(r *Registry, ro Rotator, l Limiter, q Queue, fs FileStore, w Writer, er ErrorReporter) *Worker {
+	ctx, cancel := context.WithCancel(context.Background())
+
 	return &Worker{
 		r:        r,
 		ro:       ro,
@@ -33,6 +73,8 @@ func NewWorker(r *Registry, ro Rotator, l Limiter, q Queue, fs FileStore, w Writ
 		fs:       fs,
 		w:        w,
 		er:       er,
+		ctx:      ctx,
+		cancel:   cancel,
 		shutdown: make(chan chan struct{}),
 	}
 }
@@ -57,19 +99,51 @@ func (w *Worker) Start(wg *sync.WaitGroup) {
 				continue
 			}
 
-			timeout := defaultTimeout
-			if qt.Task.Timeout != 0 {
-				timeout = qt.Task.Timeout
+			atomic.StoreInt32(&w.busy, 1)
+
+			// the task sets its own deadline, the queue is updated whether
+			// or not it was met
+			ctx := context.Background()
+			err = w.processTask(w.ctx, qt)
+			if err != nil && w.ctx.Err() != nil {
+				// abandoned by Shutdown, the task did nothing wrong
+				w.q.Error(ctx, qt)
+				atomic.StoreInt32(&w.busy, 0)
+				continue
+			}
+
+			if ce, ok := err.(*CircuitOpenError); ok {
+				w.holdBack(ctx, qt, ce)
+				atomic.StoreInt32(&w.busy, 0)
+				continue
+			}
+
+			// retrying would only go over the quota again
+			if qe, ok := err.(*QuotaError); ok {
+				w.er.Report(ctx, &ReporterOpts{
+					ScrapeID: qt.ScrapeID,
+					Plugin:   qt.Plugin,
+					URL:      qt.Task.URL,
+				}, qe)
+
+				w.failScrape(ctx, qt, qe)
+				atomic.StoreInt32(&w.busy, 0)
+				continue
 			}
 
-			// set config timeout on all worker actions on this task
-			ctx, cancel := context.WithTimeout(context.Background(), timeout)
-			err = w.processTask(ctx, qt)
 			if err != nil {
-				w.er.Report(ctx, nil, fmt.Errorf("discollect: worker-process-task: %s", err))
+				if err == ErrTaskTimeout {
+					w.recordTimeout(ctx, qt)
+				}
+
+				w.er.Report(ctx, &ReporterOpts{
+					ScrapeID: qt.ScrapeID,
+					Plugin:   qt.Plugin,
+					URL:      qt.Task.URL,
+				}, fmt.Errorf("discollect: worker-process-task: %s", err))
 				// retry task
 				w.q.Error(ctx, qt)
-				cancel()
+				atomic.StoreInt32(&w.busy, 0)
 				continue
 			}
 
@@ -79,7 +153,7 @@ func (w *Worker) Start(wg *sync.WaitGroup) {
 				w.er.Report(ctx, nil, err)
 			}
 
-			cancel()
+			atomic.StoreInt32(&w.busy, 0)
 		}
 	}
 }
@@ -91,9 +165,137 @@ func (w *Worker) Stop() {
 	<-c
 }
 
-// processTask executes one task
+// Shutdown stops the worker once its current task is done, abandoning the
+// task to be retried if ctx is done first
+func (w *Worker) Shutdown(ctx context.Context) {
+	stopped := make(chan struct{})
+	go func() {
+		w.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		w.cancel()
+		<-stopped
+	}
+
+	w.cancel()
+}
+
+// Busy returns true while the worker is processing a task
+func (w *Worker) Busy() bool {
+	return atomic.LoadInt32(&w.busy) == 1
+}
+
+// timeoutFor returns how long a task may run, the tasks own timeout, then its
+// plugins, then the workers
+func (w *Worker) timeoutFor(p *Plugin, t *Task) time.Duration {
+	switch {
+	case t.Timeout > 0:
+		return t.Timeout
+	case p.Timeout > 0:
+		return p.Timeout
+	case w.timeout > 0:
+		return w.timeout
+	default:
+		return defaultTimeout
+	}
+}
+
+// recordTimeout counts a timed out task against its scrape
+func (w *Worker) recordTimeout(ctx context.Context, qt *QueuedTask) {
+	if w.ms == nil {
+		return
+	}
+
+	err := w.ms.RecordTimeout(ctx, qt.ScrapeID)
+	if err != nil {
+		w.er.Report(ctx, nil, fmt.Errorf("discollect: could not record timeout of scrape %s: %s", qt.ScrapeID, err))
+	}
+}
+
+// failScrape fails the scrape of a task that can not be retried, so the scrape
+// is not taken to have seen everything it would have, and drops the rest of it
+// from the queue
+func (w *Worker) failScrape(ctx context.Context, qt *QueuedTask, err error) {
+	ferr := w.q.Finish(ctx, qt)
+	if ferr != nil {
+		w.er.Report(ctx, nil, ferr)
+	}
+
+	if w.ms == nil {
+		return
+	}
+
+	ferr = w.ms.ErrorScrape(ctx, qt.ScrapeID, qt.Task.URL, err)
+	if ferr != nil {
+		w.er.Report(ctx, nil, fmt.Errorf("discollect: could not error scrape %s: %s", qt.ScrapeID, ferr))
+		return
+	}
+
+	ferr = w.q.CompleteScrape(ctx, qt.ScrapeID)
+	if ferr != nil {
+		w.er.Report(ctx, nil, fmt.Errorf("discollect: could not drop the tasks of scrape %s: %s", qt.ScrapeID, ferr))
+	}
+}
+
+// holdBack puts a task against a host with an open circuit back on the
+// queue, telling its scrape the first time it is held back by each trip. It
+// never ran, so it is not counted as a retry
+func (w *Worker) holdBack(ctx context.Context, qt *QueuedTask, ce *CircuitOpenError) {
+	err := w.q.Requeue(ctx, qt)
+	if err != nil {
+		w.er.Report(ctx, nil, fmt.Errorf("discollect: could not requeue task of scrape %s: %s", qt.ScrapeID, err))
+	}
+
+	if w.ms != nil && w.cb.shouldRecord(ce.Host, qt.ScrapeID) {
+		err = w.ms.RecordCircuitOpen(ctx, qt.ScrapeID, ce.Host, ce.Until)
+		if err != nil {
+			w.er.Report(ctx, nil, fmt.Errorf("discollect: could not record open circuit of scrape %s: %s", qt.ScrapeID, err))
+		}
+	}
+
+	// the task is likely popped again straight away, so give the host a rest
+	time.Sleep(time.Second * 1)
+}
+
+// processTask executes one task, returning ErrTaskTimeout if it does not
+// finish in time.
 // Safe for concurrent use.
-func (w *Worker) processTask(ctx context.Context, q *QueuedTask) error {
+func (w *Worker) processTask(ctx context.Context, q *QueuedTask) (err error) {
+	ctx, span := startTaskSpan(ctx, q)
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	if w.ls == nil {
+		return w.runTask(ctx, q, nil)
+	}
+
+	tl := newTaskLog(q)
+	err = w.runTask(ctx, q, tl)
+	// held back tasks are recorded on the scrape once, not every time they
+	// are popped
+	if _, ok := err.(*CircuitOpenError); err != nil && !ok {
+		tl.addError(err)
+	}
+
+	entries := tl.snapshot()
+	if len(entries) > 0 {
+		// ctx may be past its deadline, the log is kept regardless
+		logErr := w.ls.WriteLogs(context.Background(), entries)
+		if logErr != nil {
+			w.er.Report(ctx, nil, fmt.Errorf("discollect: could not write logs of scrape %s: %s", q.ScrapeID, logErr))
+		}
+	}
+
+	return err
+}
+
+// runTask executes one task, adding its requests and errors to tl if set
+func (w *Worker) runTask(ctx context.Context, q *QueuedTask, tl *taskLog) error {
 	handler, params, err := w.r.HandlerFor(q.Plugin, q.Task.URL)
 	if err != nil {
 		return err
@@ -104,9 +306,27 @@ func (w *Worker) processTask(ctx context.Context, q *QueuedTask) error {
 		return err
 	}
 
+	// tasks against a host that looks to be down are held back without using
+	// up its rate limit
+	if w.cb != nil {
+		u, err := url.Parse(q.Task.URL)
+		if err != nil {
+			return err
+		}
+
+		if ce := w.cb.open(strings.ToLower(u.Hostname())); ce != nil {
+			return ce
+		}
+	}
+
 	// if this rate limit blocks too long and the context cancels we can just
 	// return error and the task will be retried later
-	res, err := w.l.Reserve(plugin.RateLimit, q.Task.URL, q.ScrapeID)
+	rl := plugin.RateLimit
+	if q.Config != nil && q.Config.Type == BackfillScrape {
+		rl = backfillLimit(rl)
+	}
+
+	res, err := w.l.Reserve(rl, q.Task.URL, q.ScrapeID)
 	if err != nil {
 		return err
 	}
@@ -122,20 +342,106 @@ func (w *Worker) processTask(ctx context.Context, q *QueuedTask) error {
 		return ErrRateLimitExceeded
 	}
 
+	// the deadline starts once the task may run, waiting on the rate limit
+	// does not count against it
+	ctx, cancel := context.WithTimeout(ctx, w.timeoutFor(plugin, q.Task))
+	defer cancel()
+
 	client, err := w.ro.Get(q.Config)
 	if err != nil {
 		return err
 	}
+	client = headerClient(client, plugin, w.headers)
+
+	// innermost, so each span covers only the request itself
+	client = traceClient(client)
+
+	var bt *breakerTransport
+	if w.cb != nil {
+		client, bt = breakerClient(client, w.cb)
+	}
+
+	// the jar is set before the client is wrapped, every wrapper keeps it
+	var jar http.CookieJar
+	if w.sc != nil {
+		jar, err = w.sc.jar(ctx, plugin, q, client)
+		if err != nil {
+			return err
+		}
+
+		if jar != nil {
+			client = jarClient(client, jar)
+		}
+	}
+
+	if w.rc != nil && !plugin.IgnoreRobots {
+		u, err := url.Parse(q.Task.URL)
+		if err != nil {
+			return err
+		}
+
+		// disallowed tasks are finished without running, retrying them would
+		// not help
+		if !w.rc.allowed(ctx, client, u) {
+			w.rc.count(plugin.Name, func(s *RobotsStats) { s.Skipped++ })
+			return nil
+		}
+
+		client = robotsClient(client, w.rc, plugin.Name)
+	}
+
+	if w.hc != nil {
+		client = cacheClient(client, w.hc)
+	}
 
-	resp := handler(ctx, &HandlerOpts{
+	// captured after the cache, so replays see the page rather than a 304
+	if w.ss != nil {
+		client = captureClient(client, w.ss, q.ScrapeID)
+	}
+
+	if tl != nil {
+		client = logClient(client, tl)
+	}
+
+	// outermost, so only what the handler reads counts against the quota
+	quota := w.quotaFor(plugin)
+	client, qtr := quotaClient(client, plugin.Name, quota)
+
+	hctx, span := tracer.Start(ctx, "discollect.handle")
+	resp, err := runHandler(hctx, handler, &HandlerOpts{
 		Config:      q.Config,
 		FileStore:   w.fs,
 		RouteParams: params,
-		Client:      client,
+		Client:      deadlineClient(hctx, client),
+		Jar:         jar,
 	}, q.Task)
+	endSpan(span, err)
+	if err != nil {
+		return err
+	}
+
+	// whatever the handler made of a refused request is thrown away, the
+	// task is run again once the circuit closes
+	if bt != nil {
+		if ce := bt.err(); ce != nil {
+			return ce
+		}
+	}
+
+	// as is whatever it made of a page cut short by its quota
+	if qe := qtr.err(); qe != nil {
+		return qe
+	}
+	if quota.MaxTasks > 0 && len(resp.Tasks) > quota.MaxTasks {
+		return &QuotaError{Plugin: plugin.Name, Limit: "MaxTasks", Max: int64(quota.MaxTasks)}
+	}
 
 	// report errors
 	for _, err := range resp.Errors {
+		if tl != nil {
+			tl.addError(err)
+		}
+
 		w.er.Report(ctx, &ReporterOpts{
 			ScrapeID: q.ScrapeID,
 			Plugin:   q.Plugin,
@@ -154,6 +460,8 @@ func (w *Worker) processTask(ctx context.Context, q *QueuedTask) error {
 			ScrapeID: q.ScrapeID,
 			Plugin:   q.Plugin,
 			Config:   q.Config,
+			Priority: q.Priority,
+			Trace:    q.Trace,
 			QueuedAt: time.Now().In(time.UTC),
 			TaskID:   uuid.New(),
 			Task:     t,
@@ -168,12 +476,9 @@ func (w *Worker) processTask(ctx context.Context, q *QueuedTask) error {
 	}
 
 	// write facts
-	for _, f := range resp.Facts {
-		err = w.w.Write(ctx, q.ScrapeID, f)
-		if err != nil {
-			return err
-		}
-	}
+	wctx, span := tracer.Start(ctx, "discollect.write", trace.WithAttributes(attribute.Int("facts", len(resp.Facts))))
+	err = writeAll(wctx, w.w, q.ScrapeID, resp.Facts)
+	endSpan(span, err)
 
-	return nil
+	return err
 }
@@ -1,7 +1,133 @@
 package discollect
 
-import "testing"
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
 
 func TestWorker(t *testing.T) {
 
 }
+
+// timeoutMetastore counts timeouts, it panics on any other call
+type timeoutMetastore struct {
+	Metastore
+
+	mu       sync.Mutex
+	timeouts map[uuid.UUID]int
+}
+
+func (tm *timeoutMetastore) RecordTimeout(ctx context.Context, id uuid.UUID) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tm.timeouts[id]++
+	return nil
+}
+
+func TestWorkerTimeout(t *testing.T) {
+	t.Parallel()
+
+	// never answers until the request is cancelled
+	hang := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hang.Close()
+
+	var cases = []struct {
+		Name    string
+		Handler Handler
+	}{
+		{
+			"client without context",
+			func(ctx context.Context, ho *HandlerOpts, t *Task) *HandlerResponse {
+				resp, err := ho.Client.Get(hang.URL)
+				if err != nil {
+					return ErrorResponse(err)
+				}
+				resp.Body.Close()
+				return Response(nil)
+			},
+		},
+		{
+			"handler ignoring context",
+			func(ctx context.Context, ho *HandlerOpts, t *Task) *HandlerResponse {
+				time.Sleep(time.Second)
+				return Response(nil)
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			p := &Plugin{
+				Name:    "hang",
+				Timeout: 50 * time.Millisecond,
+				Routes: map[string]Handler{
+					`.*`: tc.Handler,
+				},
+			}
+
+			r, err := NewRegistry([]*Plugin{p})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tm := &timeoutMetastore{timeouts: make(map[uuid.UUID]int)}
+			w := NewWorker(r, NewDefaultRotator(), &NilLimiter{}, NewMemQueue(), NewStubFS(), &StdoutWriter{}, &StdoutReporter{})
+			w.ms = tm
+
+			qt := &QueuedTask{
+				ScrapeID: uuid.New(),
+				Plugin:   "hang",
+				Config:   &Config{Type: FullScrape},
+				Task:     &Task{URL: hang.URL},
+			}
+
+			start := time.Now()
+			err = w.processTask(context.Background(), qt)
+			if err != ErrTaskTimeout {
+				t.Fatalf("expected ErrTaskTimeout, got %v", err)
+			}
+
+			// the one second the NilLimiter waits is not part of the deadline
+			if took := time.Since(start); took > 1500*time.Millisecond {
+				t.Fatalf("task ran for %s, past its deadline", took)
+			}
+
+			w.recordTimeout(context.Background(), qt)
+			if tm.timeouts[qt.ScrapeID] != 1 {
+				t.Fatalf("expected 1 timeout recorded, got %d", tm.timeouts[qt.ScrapeID])
+			}
+		})
+	}
+}
+
+func TestTimeoutFor(t *testing.T) {
+	t.Parallel()
+
+	w := &Worker{}
+	if got := w.timeoutFor(&Plugin{}, &Task{}); got != defaultTimeout {
+		t.Fatalf("expected the default timeout, got %s", got)
+	}
+
+	w.timeout = time.Minute
+	if got := w.timeoutFor(&Plugin{}, &Task{}); got != time.Minute {
+		t.Fatalf("expected the worker timeout, got %s", got)
+	}
+
+	if got := w.timeoutFor(&Plugin{Timeout: time.Second}, &Task{}); got != time.Second {
+		t.Fatalf("expected the plugin timeout, got %s", got)
+	}
+
+	if got := w.timeoutFor(&Plugin{Timeout: time.Second}, &Task{Timeout: 2 * time.Second}); got != 2*time.Second {
+		t.Fatalf("expected the task timeout, got %s", got)
+	}
+}
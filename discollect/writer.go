@@ -3,6 +3,7 @@ package discollect
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 
@@ -15,6 +16,40 @@ type Writer interface {
 	io.Closer
 }
 
+// A BatchWriter is a Writer that can also write every datum of a task at once,
+// workers prefer it to writing datums one at a time. A failed task is retried,
+// so WriteBatch must be safe to call again with datums it already wrote
+type BatchWriter interface {
+	Writer
+	WriteBatch(ctx context.Context, scrapeID uuid.UUID, fs []interface{}) error
+}
+
+// An InsertWriter is a Writer that can tell which datums it inserted, rather
+// than found already written or updated in place, so secondary writers such as
+// webhooks are only sent what is new
+type InsertWriter interface {
+	Writer
+	// WriteInserted writes fs, as a BatchWriter would, and returns those of
+	// them that were inserted
+	WriteInserted(ctx context.Context, scrapeID uuid.UUID, fs []interface{}) ([]interface{}, error)
+}
+
+// writeAll writes fs to w, in one batch if w is a BatchWriter
+func writeAll(ctx context.Context, w Writer, scrapeID uuid.UUID, fs []interface{}) error {
+	if bw, ok := w.(BatchWriter); ok && len(fs) > 1 {
+		return bw.WriteBatch(ctx, scrapeID, fs)
+	}
+
+	for _, f := range fs {
+		err := w.Write(ctx, scrapeID, f)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // StdoutWriter fmt.Printfs to stdout
 type StdoutWriter struct{}
 
@@ -27,3 +62,58 @@ func (sw *StdoutWriter) Write(ctx context.Context, _ uuid.UUID, f interface{}) e
 func (sw *StdoutWriter) Close() error {
 	return nil
 }
+
+// A multiWriter fans datums out to several writers, only those the primary
+// inserted if it is an InsertWriter. Errors from the primary fail the task
+// before anything is written to the secondaries, as it will be retried. Errors
+// from the secondaries are only reported, so a failing archive or webhook
+// cannot hold up a scrape or have datums rewritten to the others
+type multiWriter struct {
+	primary   Writer
+	secondary []Writer
+	er        ErrorReporter
+}
+
+// Write writes f to the primary, then to every secondary if it succeeded
+func (mw *multiWriter) Write(ctx context.Context, scrapeID uuid.UUID, f interface{}) error {
+	return mw.WriteBatch(ctx, scrapeID, []interface{}{f})
+}
+
+// WriteBatch writes fs to the primary in one batch if it can, then to every
+// secondary if it succeeded
+func (mw *multiWriter) WriteBatch(ctx context.Context, scrapeID uuid.UUID, fs []interface{}) error {
+	var err error
+	if iw, ok := mw.primary.(InsertWriter); ok {
+		fs, err = iw.WriteInserted(ctx, scrapeID, fs)
+	} else {
+		err = writeAll(ctx, mw.primary, scrapeID, fs)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(fs) == 0 {
+		return nil
+	}
+
+	for i, w := range mw.secondary {
+		wErr := writeAll(ctx, w, scrapeID, fs)
+		if wErr != nil {
+			mw.er.Report(ctx, &ReporterOpts{ScrapeID: scrapeID}, fmt.Errorf("discollect: secondary writer %d: %s", i, wErr))
+		}
+	}
+
+	return nil
+}
+
+// Close closes every writer, returning the first error
+func (mw *multiWriter) Close() error {
+	err := mw.primary.Close()
+	for _, w := range mw.secondary {
+		if cErr := w.Close(); cErr != nil && err == nil {
+			err = cErr
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,164 @@
+package discollect
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+type recordingWriter struct {
+	err     error
+	written []interface{}
+}
+
+func (rw *recordingWriter) Write(ctx context.Context, _ uuid.UUID, f interface{}) error {
+	rw.written = append(rw.written, f)
+	return rw.err
+}
+
+func (rw *recordingWriter) Close() error {
+	return nil
+}
+
+type countingReporter struct {
+	errs []error
+}
+
+func (cr *countingReporter) Report(ctx context.Context, ro *ReporterOpts, err error) {
+	cr.errs = append(cr.errs, err)
+}
+
+func TestMultiWriter(t *testing.T) {
+	t.Parallel()
+
+	primaryErr := errors.New("primary down")
+
+	var cases = []struct {
+		name      string
+		primary   error
+		secondary error
+		err       error
+		written   int
+		reported  int
+	}{
+		{"ok", nil, nil, nil, 1, 0},
+		{"secondary-fails", nil, errors.New("webhook down"), nil, 1, 1},
+		{"primary-fails", primaryErr, nil, primaryErr, 0, 0},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := &recordingWriter{err: tt.primary}
+			failing := &recordingWriter{err: tt.secondary}
+			last := &recordingWriter{}
+			er := &countingReporter{}
+
+			d, err := New(WithPlugins(&Plugin{Name: "test"}), WithErrorReporter(er), WithWriters(primary, failing, last))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = d.w.Write(context.Background(), uuid.New(), "datum")
+			if err != tt.err {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+
+			if len(primary.written) != 1 {
+				t.Fatal("the primary should always be written to")
+			}
+
+			if len(failing.written) != tt.written || len(last.written) != tt.written {
+				t.Fatalf("expected the secondaries to be written %d datums, got %v and %v", tt.written, failing.written, last.written)
+			}
+
+			if len(er.errs) != tt.reported {
+				t.Fatalf("expected %d reported errors, got %v", tt.reported, er.errs)
+			}
+		})
+	}
+}
+
+type batchingWriter struct {
+	recordingWriter
+	batches int
+}
+
+func (bw *batchingWriter) WriteBatch(ctx context.Context, _ uuid.UUID, fs []interface{}) error {
+	bw.batches++
+	bw.written = append(bw.written, fs...)
+	return bw.err
+}
+
+func TestMultiWriterBatch(t *testing.T) {
+	t.Parallel()
+
+	primary := &batchingWriter{}
+	secondary := &recordingWriter{}
+
+	d, err := New(WithPlugins(&Plugin{Name: "test"}), WithWriters(primary, secondary))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writeAll(context.Background(), d.w, uuid.New(), []interface{}{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if primary.batches != 1 || len(primary.written) != 3 {
+		t.Fatalf("primary should be written to in one batch, got %d batches of %v", primary.batches, primary.written)
+	}
+
+	if len(secondary.written) != 3 {
+		t.Fatalf("secondary should be written every datum, got %v", secondary.written)
+	}
+}
+
+type insertingWriter struct {
+	recordingWriter
+	existing map[interface{}]bool
+}
+
+func (iw *insertingWriter) WriteInserted(ctx context.Context, _ uuid.UUID, fs []interface{}) ([]interface{}, error) {
+	var inserted []interface{}
+	for _, f := range fs {
+		iw.written = append(iw.written, f)
+		if !iw.existing[f] {
+			inserted = append(inserted, f)
+		}
+	}
+
+	return inserted, iw.err
+}
+
+func TestMultiWriterInserted(t *testing.T) {
+	t.Parallel()
+
+	primary := &insertingWriter{existing: map[interface{}]bool{"a": true, "c": true}}
+	secondary := &recordingWriter{}
+
+	d, err := New(WithPlugins(&Plugin{Name: "test"}), WithWriters(primary, secondary))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writeAll(context.Background(), d.w, uuid.New(), []interface{}{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.w.Write(context.Background(), uuid.New(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(primary.written) != 4 {
+		t.Fatalf("primary should be written every datum, got %v", primary.written)
+	}
+
+	if len(secondary.written) != 1 || secondary.written[0] != "b" {
+		t.Fatalf("secondary should only be written the inserted datum, got %v", secondary.written)
+	}
+}
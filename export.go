@@ -0,0 +1,397 @@
+package hydrocarbon
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	atomContentType = "application/atom+xml; charset=utf-8"
+	atomNamespace   = "http://www.w3.org/2005/Atom"
+
+	jsonFeedContentType = "application/feed+json"
+	jsonFeedVersion     = "https://jsonfeed.org/version/1.1"
+
+	// exportLimit is how many of the newest posts of a folder are exported
+	exportLimit = 50
+)
+
+// An ExportFolder is a folder exported as a feed, to anyone with its token
+type ExportFolder struct {
+	ID        string
+	Name      string
+	CreatedAt time.Time
+}
+
+// An ExportStore is an interface used to seperate the ExportAPI from knowledge
+// of the actual underlying database
+type ExportStore interface {
+	// SetFolderExportToken sets the token a folder is exported at, replacing
+	// any it had, an empty token stops exporting it
+	SetFolderExportToken(ctx context.Context, sessionKey, folderID, token string) error
+	// GetExportFolder returns the folder exported at token
+	GetExportFolder(ctx context.Context, token string) (*ExportFolder, error)
+	// GetExportPosts returns the newest posts in the feeds of a folder with
+	// their bodies, as its owner sees them
+	GetExportPosts(ctx context.Context, folderID string, limit int) ([]*Post, error)
+
+	// FeedFollower returns the ID of the user of sessionKey if they follow
+	// the feed
+	FeedFollower(ctx context.Context, sessionKey, feedID string) (string, error)
+	// GetExportFeed returns a feed the user follows with its newest posts
+	// and their bodies, as they see them
+	GetExportFeed(ctx context.Context, userID, feedID string, limit int) (*Feed, error)
+}
+
+// ExportAPI exports folders as feeds at secret urls, and single feeds at urls
+// signed for their followers, so other readers and tools can follow what
+// hydrocarbon collects
+type ExportAPI struct {
+	s      ExportStore
+	ks     *KeySigner
+	domain string
+}
+
+// NewExportAPI returns a new ExportAPI
+func NewExportAPI(s ExportStore, ks *KeySigner, domain string) *ExportAPI {
+	return &ExportAPI{
+		s:      s,
+		ks:     ks,
+		domain: domain,
+	}
+}
+
+// ExportFolder starts exporting a folder at a new url, which replaces any it
+// was exported at before, or stops exporting it
+func (ea *ExportAPI) ExportFolder(w http.ResponseWriter, r *http.Request) error {
+	key, err := ea.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		FolderID string `json:"folder_id"`
+		Export   bool   `json:"export"`
+	}
+	err = limitDecoder(r, &req)
+	if err != nil {
+		return err
+	}
+
+	if _, err := uuid.Parse(req.FolderID); err != nil {
+		return errors.New("invalid folder ID")
+	}
+
+	var token string
+	if req.Export {
+		token, err = newExportToken()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = ea.s.SetFolderExportToken(r.Context(), key, req.FolderID, token)
+	if err != nil {
+		return err
+	}
+
+	out := map[string]interface{}{
+		"export": req.Export,
+	}
+	if req.Export {
+		out["atom"] = ea.exportURL("folder", "atom", token)
+		out["json"] = ea.exportURL("folder", "json", token)
+	}
+
+	return writeSuccess(w, out)
+}
+
+// ExportFeed returns the url a feed the user follows is exported at, signed so
+// it can not be made for other users or feeds. It stops working once they
+// unfollow the feed
+func (ea *ExportAPI) ExportFeed(w http.ResponseWriter, r *http.Request) error {
+	key, err := ea.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		FeedID string `json:"feed_id"`
+	}
+	err = limitDecoder(r, &req)
+	if err != nil {
+		return err
+	}
+
+	if _, err := uuid.Parse(req.FeedID); err != nil {
+		return errors.New("invalid feed ID")
+	}
+
+	userID, err := ea.s.FeedFollower(r.Context(), key, req.FeedID)
+	if err != nil {
+		return err
+	}
+
+	sig, err := ea.ks.Sign(FeedExport(userID, req.FeedID))
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, map[string]interface{}{
+		"json": ea.exportURL("feed", "json", sig),
+	})
+}
+
+// FeedExport is what the url a feed is exported at for a user is signed over
+func FeedExport(userID, feedID string) string {
+	return "feed:" + userID + ":" + feedID
+}
+
+func (ea *ExportAPI) exportURL(of, format, token string) string {
+	return strings.TrimSuffix(ea.domain, "/") + "/v1/" + of + "/" + format + "/get?token=" + url.QueryEscape(token)
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	ID        string       `xml:"id"`
+	Title     string       `xml:"title"`
+	Link      *atomLink    `xml:"link,omitempty"`
+	Published string       `xml:"published,omitempty"`
+	Updated   string       `xml:"updated"`
+	Author    *atomAuthor  `xml:"author,omitempty"`
+	Content   *atomContent `xml:"content,omitempty"`
+}
+
+type atomFeed struct {
+	XMLName   xml.Name     `xml:"feed"`
+	Namespace string       `xml:"xmlns,attr"`
+	ID        string       `xml:"id"`
+	Title     string       `xml:"title"`
+	Updated   string       `xml:"updated"`
+	Generator string       `xml:"generator"`
+	Links     []*atomLink  `xml:"link"`
+	Entries   []*atomEntry `xml:"entry"`
+}
+
+// Atom writes out the newest posts of the folder exported at the token in the
+// query as an Atom feed
+func (ea *ExportAPI) Atom(w http.ResponseWriter, r *http.Request) error {
+	token := r.URL.Query().Get("token")
+	folder, err := ea.s.GetExportFolder(r.Context(), token)
+	if err != nil {
+		return err
+	}
+
+	posts, err := ea.s.GetExportPosts(r.Context(), folder.ID, exportLimit)
+	if err != nil {
+		return err
+	}
+
+	// the feed was updated when any of its posts last were, or created
+	updated := folder.CreatedAt
+	entries := make([]*atomEntry, len(posts))
+	for i, p := range posts {
+		entries[i] = postEntry(p)
+		if t := postUpdated(p); t.After(updated) {
+			updated = t
+		}
+	}
+
+	feed := &atomFeed{
+		Namespace: atomNamespace,
+		ID:        "urn:uuid:" + folder.ID,
+		Title:     folder.Name,
+		Updated:   exportTime(updated),
+		Generator: "hydrocarbon",
+		Links: []*atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: ea.exportURL("folder", "atom", token)},
+			{Rel: "alternate", Href: ea.domain},
+		},
+		Entries: entries,
+	}
+
+	w.Header().Set("Content-Type", atomContentType)
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write([]byte(xml.Header))
+	if err != nil {
+		return err
+	}
+
+	return xml.NewEncoder(w).Encode(feed)
+}
+
+// postUpdated is when a post was last written
+func postUpdated(p *Post) time.Time {
+	if p.UpdatedAt.IsZero() {
+		return p.CreatedAt
+	}
+
+	return p.UpdatedAt
+}
+
+// postEntry converts a post into an Atom entry
+func postEntry(p *Post) *atomEntry {
+	e := &atomEntry{
+		ID:      "urn:uuid:" + p.ID,
+		Title:   p.Title,
+		Updated: exportTime(postUpdated(p)),
+	}
+	if p.OriginalURL != "" {
+		e.Link = &atomLink{Rel: "alternate", Href: p.OriginalURL}
+	}
+	if !p.PostedAt.IsZero() {
+		e.Published = exportTime(p.PostedAt)
+	}
+	if p.Author != "" {
+		e.Author = &atomAuthor{Name: p.Author}
+	}
+	if p.Body != "" {
+		e.Content = &atomContent{Type: "html", Body: p.Body}
+	}
+
+	return e
+}
+
+// exportTime formats t as RFC 3339, which Atom and JSON Feed both use
+func exportTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedItem struct {
+	ID            string            `json:"id"`
+	URL           string            `json:"url,omitempty"`
+	Title         string            `json:"title,omitempty"`
+	ContentHTML   string            `json:"content_html"`
+	DatePublished string            `json:"date_published,omitempty"`
+	DateModified  string            `json:"date_modified,omitempty"`
+	Authors       []*jsonFeedAuthor `json:"authors,omitempty"`
+}
+
+type jsonFeed struct {
+	Version     string          `json:"version"`
+	Title       string          `json:"title"`
+	HomePageURL string          `json:"home_page_url,omitempty"`
+	FeedURL     string          `json:"feed_url"`
+	Items       []*jsonFeedItem `json:"items"`
+}
+
+// FolderJSON writes out the newest posts of the folder exported at the token
+// in the query as a JSON Feed
+func (ea *ExportAPI) FolderJSON(w http.ResponseWriter, r *http.Request) error {
+	token := r.URL.Query().Get("token")
+	folder, err := ea.s.GetExportFolder(r.Context(), token)
+	if err != nil {
+		return err
+	}
+
+	posts, err := ea.s.GetExportPosts(r.Context(), folder.ID, exportLimit)
+	if err != nil {
+		return err
+	}
+
+	return writeJSONFeed(w, &jsonFeed{
+		Version:     jsonFeedVersion,
+		Title:       folder.Name,
+		HomePageURL: ea.domain,
+		FeedURL:     ea.exportURL("folder", "json", token),
+		Items:       jsonFeedItems(posts),
+	})
+}
+
+// FeedJSON writes out the newest posts of the feed the url was signed for as a
+// JSON Feed, as long as the user it was signed for still follows it
+func (ea *ExportAPI) FeedJSON(w http.ResponseWriter, r *http.Request) error {
+	sig := r.URL.Query().Get("token")
+	val, err := ea.ks.Verify(sig)
+	if err != nil {
+		return err
+	}
+
+	parts := strings.Split(val, ":")
+	if len(parts) != 3 || parts[0] != "feed" {
+		return errors.New("invalid token")
+	}
+
+	feed, err := ea.s.GetExportFeed(r.Context(), parts[1], parts[2], exportLimit)
+	if err != nil {
+		return err
+	}
+
+	return writeJSONFeed(w, &jsonFeed{
+		Version:     jsonFeedVersion,
+		Title:       feed.Title,
+		HomePageURL: feed.BaseURL,
+		FeedURL:     ea.exportURL("feed", "json", sig),
+		Items:       jsonFeedItems(feed.Posts),
+	})
+}
+
+func writeJSONFeed(w http.ResponseWriter, f *jsonFeed) error {
+	w.Header().Set("Content-Type", jsonFeedContentType)
+	w.WriteHeader(http.StatusOK)
+	return json.NewEncoder(w).Encode(f)
+}
+
+// jsonFeedItems converts posts into JSON Feed items, which always have HTML
+// content even if it is empty
+func jsonFeedItems(posts []*Post) []*jsonFeedItem {
+	items := make([]*jsonFeedItem, len(posts))
+	for i, p := range posts {
+		it := &jsonFeedItem{
+			ID:           p.ID,
+			URL:          p.OriginalURL,
+			Title:        p.Title,
+			ContentHTML:  p.Body,
+			DateModified: exportTime(postUpdated(p)),
+		}
+		if !p.PostedAt.IsZero() {
+			it.DatePublished = exportTime(p.PostedAt)
+		}
+		if p.Author != "" {
+			it.Authors = []*jsonFeedAuthor{{Name: p.Author}}
+		}
+
+		items[i] = it
+	}
+
+	return items
+}
+
+// newExportToken returns 128 random bits, exports are as private as the folders
+// they are of until their url is shared
+func newExportToken() (string, error) {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.ToLower(tokenEncoding.EncodeToString(buf)), nil
+}
@@ -0,0 +1,195 @@
+package hydrocarbon
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// FederationSignatureHeader carries the base64 ed25519 signature of the
+	// body of every federation response
+	FederationSignatureHeader = "X-Hydrocarbon-Signature"
+
+	defaultFederatedPosts = 50
+	maxFederatedPosts     = 200
+)
+
+var errInvalidSignature = errors.New("federation: invalid signature")
+
+// A FeedManifest describes a public feed to other instances, it is signed by
+// the instance serving it
+type FeedManifest struct {
+	Instance string `json:"instance"`
+	// PublicKey is the base64 ed25519 key every response about this feed is
+	// signed with
+	PublicKey string `json:"public_key"`
+	Feed      *Feed  `json:"feed"`
+	// PostsURL is where posts of the feed are synced from
+	PostsURL string `json:"posts_url"`
+}
+
+// FederatedPosts is a page of posts synced between instances. Next is set if
+// there are more posts, and is passed as the cursor to fetch them
+type FederatedPosts struct {
+	Posts []*Post `json:"posts"`
+	Next  string  `json:"next,omitempty"`
+}
+
+// A FederationStore is an interface used to seperate the FederationAPI from
+// knowledge of the actual underlying database
+type FederationStore interface {
+	GetPublicFeed(ctx context.Context, feedID string) (*Feed, error)
+	// GetPublicFeedPosts returns posts ordered by when they were last updated,
+	// starting after the given cursor
+	GetPublicFeedPosts(ctx context.Context, feedID string, after time.Time, afterID string, limit int) ([]*Post, error)
+}
+
+// FederationAPI lets other hydrocarbon instances follow the public feeds of
+// this one without scraping the origin site themselves
+type FederationAPI struct {
+	s      FederationStore
+	key    ed25519.PrivateKey
+	domain string
+}
+
+// NewFederationAPI returns a new FederationAPI that signs responses with key
+func NewFederationAPI(s FederationStore, key ed25519.PrivateKey, domain string) *FederationAPI {
+	return &FederationAPI{
+		s:      s,
+		key:    key,
+		domain: domain,
+	}
+}
+
+// Manifest writes out the signed manifest of a public feed
+func (fa *FederationAPI) Manifest(w http.ResponseWriter, r *http.Request) error {
+	feedID := r.URL.Query().Get("feed_id")
+	if feedID == "" {
+		return errors.New("no feed ID submitted")
+	}
+
+	feed, err := fa.s.GetPublicFeed(r.Context(), feedID)
+	if err != nil {
+		return err
+	}
+
+	return fa.writeSigned(w, &FeedManifest{
+		Instance:  fa.domain,
+		PublicKey: base64.StdEncoding.EncodeToString(fa.key.Public().(ed25519.PublicKey)),
+		Feed:      feed,
+		PostsURL:  fa.domain + "/v1/federation/posts/get?feed_id=" + url.QueryEscape(feed.ID),
+	})
+}
+
+// Posts writes out a signed page of the posts of a public feed, with full
+// bodies, oldest update first
+func (fa *FederationAPI) Posts(w http.ResponseWriter, r *http.Request) error {
+	q := r.URL.Query()
+
+	feedID := q.Get("feed_id")
+	if feedID == "" {
+		return errors.New("no feed ID submitted")
+	}
+
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultFederatedPosts
+	}
+	if limit > maxFederatedPosts {
+		limit = maxFederatedPosts
+	}
+
+	after, afterID, err := parseFederationCursor(q.Get("cursor"))
+	if err != nil {
+		return err
+	}
+
+	posts, err := fa.s.GetPublicFeedPosts(r.Context(), feedID, after, afterID, limit)
+	if err != nil {
+		return err
+	}
+
+	fp := &FederatedPosts{Posts: posts}
+	if len(posts) == limit {
+		last := posts[len(posts)-1]
+		fp.Next = last.UpdatedAt.UTC().Format(time.RFC3339Nano) + "_" + last.ID
+	}
+
+	return fa.writeSigned(w, fp)
+}
+
+// parseFederationCursor splits a cursor into the update time and ID of the
+// last post seen, an empty cursor starts from the beginning
+func parseFederationCursor(cursor string) (time.Time, string, error) {
+	if cursor == "" {
+		return time.Time{}, "", nil
+	}
+
+	parts := strings.SplitN(cursor, "_", 2)
+	if len(parts) != 2 {
+		return time.Time{}, "", errors.New("invalid cursor")
+	}
+
+	after, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, "", errors.New("invalid cursor")
+	}
+
+	return after, parts[1], nil
+}
+
+// writeSigned writes x out like writeSuccess, signing the exact bytes sent
+func (fa *FederationAPI) writeSigned(w http.ResponseWriter, x interface{}) error {
+	var s = struct {
+		Status string      `json:"status"`
+		Data   interface{} `json:"data,omitempty"`
+	}{
+		statusOK,
+		x,
+	}
+
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(s)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set(FederationSignatureHeader, base64.StdEncoding.EncodeToString(ed25519.Sign(fa.key, buf.Bytes())))
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// VerifyFederated checks the signature of a federation response body, and
+// decodes its data into x
+func VerifyFederated(pub ed25519.PublicKey, body []byte, sig string, x interface{}) error {
+	rawSig, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil || len(pub) != ed25519.PublicKeySize || !ed25519.Verify(pub, body, rawSig) {
+		return errInvalidSignature
+	}
+
+	var s struct {
+		Status string          `json:"status"`
+		Error  string          `json:"error"`
+		Data   json.RawMessage `json:"data"`
+	}
+	err = json.Unmarshal(body, &s)
+	if err != nil {
+		return err
+	}
+
+	if s.Status != statusOK {
+		return errors.New("federation: " + s.Error)
+	}
+
+	return json.Unmarshal(s.Data, x)
+}
@@ -0,0 +1,54 @@
+package hydrocarbon
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type federationStore struct{}
+
+func (federationStore) GetPublicFeed(ctx context.Context, feedID string) (*Feed, error) {
+	return &Feed{ID: feedID, Title: "a feed"}, nil
+}
+
+func (federationStore) GetPublicFeedPosts(ctx context.Context, feedID string, after time.Time, afterID string, limit int) ([]*Post, error) {
+	return nil, nil
+}
+
+func TestFederationSignature(t *testing.T) {
+	t.Parallel()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fa := NewFederationAPI(federationStore{}, priv, "https://example.com")
+
+	w := httptest.NewRecorder()
+	err = fa.Manifest(w, httptest.NewRequest("GET", "/v1/federation/feed/get?feed_id=abc", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, sig := w.Body.Bytes(), w.Header().Get(FederationSignatureHeader)
+
+	var m FeedManifest
+	err = VerifyFederated(pub, body, sig, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Feed.Title != "a feed" || m.PostsURL != "https://example.com/v1/federation/posts/get?feed_id=abc" {
+		t.Errorf("unexpected manifest %+v", m)
+	}
+
+	body[len(body)-3] ^= 1
+	if err := VerifyFederated(pub, body, sig, &m); err != errInvalidSignature {
+		t.Errorf("expected a tampered body to fail verification, got %v", err)
+	}
+}
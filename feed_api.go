@@ -2,30 +2,90 @@ package hydrocarbon
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/fortytw2/hydrocarbon/discollect"
 )
 
-const maxFailedResolutions = 8
+const (
+	maxFailedResolutions = 8
+	maxBulkFeeds         = 100
+	bulkAddConcurrency   = 4
+)
 
 // A FeedStore is an interface used to seperate the FeedAPI from knowledge of the
 // actual underlying database
 type FeedStore interface {
-	AddFeed(ctx context.Context, sessionKey, folderID, title, plugin, feedURL string, initConf *discollect.Config) (string, error)
-	CheckIfFeedExists(ctx context.Context, sessionKey, folderID, plugin, url string) (*Feed, bool, error)
+	AddFeed(ctx context.Context, sessionKey, folderID, title, plugin, feedURL, externalID string, initConf *discollect.Config) (string, error)
+	// CheckIfFeedExists looks feeds up by url, or by external ID when it is
+	// set, adding any existing feed to the folder
+	CheckIfFeedExists(ctx context.Context, sessionKey, folderID, plugin, url, externalID string) (*Feed, bool, error)
 	RemoveFeed(ctx context.Context, sessionKey, folderID, feedID string) error
+	// AddPendingFeed adds a feed to be resolved later by a FeedResolver
+	AddPendingFeed(ctx context.Context, sessionKey, folderID, feedURL string) (string, error)
+
+	// GetPlanUsage returns the users plan and how many feeds they follow
+	GetPlanUsage(ctx context.Context, sessionKey string) (*PlanUsage, error)
 
 	AddFolder(ctx context.Context, sessionKey, name string) (string, error)
+	// SetFolderDeleted deletes or restores a folder, deleted folders are
+	// hidden along with their feeds until they are purged
+	SetFolderDeleted(ctx context.Context, sessionKey, folderID string, deleted bool) error
 
 	// GetFolders should not return any Posts in the nested Feeds
 	GetFoldersWithFeeds(ctx context.Context, sessionKey string) ([]*Folder, error)
+	// GetUnseenAnnouncements returns running announcements the user hasn't seen
+	GetUnseenAnnouncements(ctx context.Context, sessionKey string) ([]*Announcement, error)
 	// Return Post Title, PostedAt, Read, and ID
 	GetFeedPosts(ctx context.Context, sessionKey, feedID string, limit, offset int) (*Feed, error)
 	GetPost(ctx context.Context, sessionKey, postID string) (*Post, error)
+
+	// GetFeedByExternalID and GetPostByExternalID find feeds and posts by the
+	// ID a plugin gave them
+	GetFeedByExternalID(ctx context.Context, sessionKey, plugin, externalID string) (*Feed, error)
+	GetPostByExternalID(ctx context.Context, sessionKey, plugin, externalID string) (*Post, error)
+
+	// RefreshFeed queues a scrape of a feed the user follows at
+	// discollect.PriorityInteractive, ahead of scheduled scrapes and backfills
+	RefreshFeed(ctx context.Context, sessionKey, feedID string) error
+
+	// ImportPosts adds backfilled posts to a feed only the user follows, as
+	// every follower would see them, returning how many were new. Posts whose
+	// url starts with # are chapters without a url of their own, it is
+	// appended to the url of the feed
+	ImportPosts(ctx context.Context, sessionKey, feedID string, posts []*Post) (int, error)
+
+	// SetFeedTransform sets the users transform for a feed, an empty script
+	// removes it. Either way the output of the old script is dropped
+	SetFeedTransform(ctx context.Context, sessionKey, feedID, script string) error
+	GetFeedTransform(ctx context.Context, sessionKey, feedID string) (*FeedTransform, error)
+
+	// SetFeedCredentials sets the credentials the user logs into the origin
+	// site of a feed with, they are never read back out through the API. What
+	// they can see is for the user alone, so a feed others can follow is
+	// replaced by a private copy of it, whose ID is returned
+	SetFeedCredentials(ctx context.Context, sessionKey, feedID string, c *discollect.Credentials) (string, error)
+	DeleteFeedCredentials(ctx context.Context, sessionKey, feedID string) error
+
+	// SetFeedSchedule sets how scrapes of a feed only the user follows are
+	// scheduled, nil uses the scheduler of its plugin
+	SetFeedSchedule(ctx context.Context, sessionKey, feedID string, spec *discollect.ScheduleSpec) error
+
+	// GetFeedConfig returns the plugin of a feed and the config of its first
+	// scrape
+	GetFeedConfig(ctx context.Context, sessionKey, feedID string) (string, *discollect.Config, error)
+	// BackfillFeed queues a backfill scrape of the feed, one at a time
+	BackfillFeed(ctx context.Context, sessionKey, feedID string, c *discollect.Config) (string, error)
+	// GetBackfill returns the latest backfill scrape of the feed
+	GetBackfill(ctx context.Context, sessionKey, feedID string) (*discollect.Scrape, error)
 }
 
 // FeedAPI encapsulates everything related to user management
@@ -35,7 +95,8 @@ type FeedAPI struct {
 	dc *discollect.Discollector
 }
 
-// NewFeedAPI returns a new Feed API
+// NewFeedAPI returns a new Feed API, dc may be nil on nodes that do not scrape,
+// in which case new feeds are left pending for a FeedResolver elsewhere
 func NewFeedAPI(s FeedStore, dc *discollect.Discollector, ks *KeySigner) *FeedAPI {
 	return &FeedAPI{
 		s:  s,
@@ -66,57 +127,508 @@ func (fa *FeedAPI) AddFeed(w http.ResponseWriter, r *http.Request) error {
 		return errors.New("one of url or plugin is empty")
 	}
 
-	var blacklist []string
-	var feedTitle string
-	var id string
+	usage, err := fa.s.GetPlanUsage(r.Context(), key)
+	if err != nil {
+		return err
+	}
+
+	if usage.Feeds >= usage.Plan.MaxFeeds {
+		return fmt.Errorf("the %s plan is limited to %d feeds", usage.Plan.Name, usage.Plan.MaxFeeds)
+	}
+
+	id, feedTitle, status, err := fa.addFeed(r.Context(), key, feed.FolderID, feed.URL)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, map[string]string{
+		"id":     id,
+		"title":  feedTitle,
+		"status": status,
+	})
+}
 
+// addFeed resolves the plugin for feedURL and adds the resulting feed to the
+// given folder, returning the feed ID, title and status. When no scraper is
+// available the feed is added as pending instead
+func (fa *FeedAPI) addFeed(ctx context.Context, key, folderID, feedURL string) (string, string, string, error) {
+	if fa.dc == nil || fa.dc.Draining() {
+		id, err := fa.s.AddPendingFeed(ctx, key, folderID, feedURL)
+		if err != nil {
+			return "", "", "", err
+		}
+
+		return id, feedURL, FeedPending, nil
+	}
+
+	var (
+		blacklist []string
+		sniffed   bool
+	)
 	for {
-		plugin, handlerOpts, err := fa.dc.PluginForEntrypoint(feed.URL, blacklist)
+		plugin, handlerOpts, err := fa.dc.PluginForEntrypoint(feedURL, blacklist)
+		// fall back to fetching the page once patterns alone are exhausted
+		if err == discollect.ErrNoValidPluginForEntrypoint && !sniffed {
+			sniffed = true
+			plugin, feedURL, handlerOpts, err = fa.dc.SniffEntrypoint(ctx, feedURL, blacklist)
+		}
 		if err != nil {
-			return err
+			return "", "", "", err
+		}
+
+		var externalID string
+		if plugin.ExternalID != nil {
+			externalID = plugin.ExternalID(feedURL, handlerOpts)
 		}
 
 		// check if the plugin exists
-		dbFeed, ok, err := fa.s.CheckIfFeedExists(r.Context(), key, feed.FolderID, plugin.Name, feed.URL)
+		dbFeed, ok, err := fa.s.CheckIfFeedExists(ctx, key, folderID, plugin.Name, feedURL, externalID)
 		if err != nil {
-			return err
+			return "", "", "", err
 		}
 
 		if ok {
-			return writeSuccess(w, map[string]string{
-				"id":    dbFeed.ID,
-				"title": dbFeed.Title,
-			})
+			return dbFeed.ID, dbFeed.Title, FeedActive, nil
 		}
 
-		var initialConfig *discollect.Config
-		feedTitle, initialConfig, err = plugin.ConfigCreator(feed.URL, handlerOpts)
+		feedTitle, initialConfig, err := plugin.ConfigCreator(feedURL, handlerOpts)
 		if err != nil {
 			if len(blacklist) == maxFailedResolutions {
-				return err
+				return "", "", "", err
 			}
 			blacklist = append(blacklist, plugin.Name)
 			continue
 		}
 
-		if len(initialConfig.Entrypoints) == 0 {
-			return fmt.Errorf("%s: did not return an entrypoint for %s", plugin.Name, feed.URL)
+		initialConfig.Version = plugin.ConfigVersion
+
+		err = fa.dc.ValidateConfig(plugin.Name, initialConfig)
+		if err != nil {
+			return "", "", "", err
+		}
+
+		id, err := fa.s.AddFeed(ctx, key, folderID, feedTitle, plugin.Name, initialConfig.Entrypoints[0], externalID, initialConfig)
+		if err != nil {
+			return "", "", "", err
+		}
+
+		return id, feedTitle, FeedActive, nil
+	}
+}
+
+// A BulkFeedResult is the outcome of adding a single URL via AddFeeds
+type BulkFeedResult struct {
+	URL    string `json:"url"`
+	ID     string `json:"id,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// AddFeeds adds every URL in a newline separated list, resolving up to
+// bulkAddConcurrency of them at once, and writes out a result for each URL
+func (fa *FeedAPI) AddFeeds(w http.ResponseWriter, r *http.Request) error {
+	key, err := fa.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	var feeds struct {
+		FolderID string `json:"folder_id,omitempty"`
+		URLs     string `json:"urls"`
+	}
+
+	err = json.NewDecoder(io.LimitReader(r.Body, 1024*64)).Decode(&feeds)
+	if err != nil {
+		return err
+	}
+
+	urls := splitURLs(feeds.URLs)
+	if len(urls) == 0 {
+		return errors.New("no urls submitted")
+	}
+
+	if len(urls) > maxBulkFeeds {
+		return fmt.Errorf("at most %d urls can be added at once", maxBulkFeeds)
+	}
+
+	usage, err := fa.s.GetPlanUsage(r.Context(), key)
+	if err != nil {
+		return err
+	}
+	remaining := usage.Plan.MaxFeeds - usage.Feeds
+
+	results := make([]*BulkFeedResult, len(urls))
+	sem := make(chan struct{}, bulkAddConcurrency)
+
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		results[i] = &BulkFeedResult{URL: u}
+		if i >= remaining {
+			results[i].Error = fmt.Sprintf("the %s plan is limited to %d feeds", usage.Plan.Name, usage.Plan.MaxFeeds)
+			continue
+		}
+
+		wg.Add(1)
+		go func(res *BulkFeedResult) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			id, title, status, err := fa.addFeed(r.Context(), key, feeds.FolderID, res.URL)
+			if err != nil {
+				res.Error = err.Error()
+				return
+			}
+
+			res.ID = id
+			res.Title = title
+			res.Status = status
+		}(results[i])
+	}
+	wg.Wait()
+
+	return writeSuccess(w, results)
+}
+
+// splitURLs splits a pasted list of URLs into its unique, non-empty lines
+func splitURLs(in string) []string {
+	seen := make(map[string]bool)
+
+	var out []string
+	for _, line := range strings.Split(in, "\n") {
+		u := strings.TrimSpace(line)
+		if u == "" || seen[u] {
+			continue
+		}
+
+		seen[u] = true
+		out = append(out, u)
+	}
+
+	return out
+}
+
+// RefreshFeed scrapes a feed as soon as possible, rather than waiting for its
+// next scheduled scrape
+func (fa *FeedAPI) RefreshFeed(w http.ResponseWriter, r *http.Request) error {
+	key, err := fa.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		FeedID string `json:"feed_id"`
+	}
+	err = limitDecoder(r, &req)
+	if err != nil {
+		return err
+	}
+
+	if req.FeedID == "" {
+		return errors.New("no feed ID submitted")
+	}
+
+	err = fa.s.RefreshFeed(r.Context(), key, req.FeedID)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, nil)
+}
+
+// ImportArchive adds the posts of an epub, zip of chapters or WordPress export
+// to a feed, so a complete archive does not have to be scraped page by page.
+// The archive is the request body, the feed is given by the feed_id query
+// parameter
+func (fa *FeedAPI) ImportArchive(w http.ResponseWriter, r *http.Request) error {
+	key, err := fa.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	feedID := r.URL.Query().Get("feed_id")
+	if feedID == "" {
+		return errors.New("no feed ID submitted")
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, maxArchiveSize+1))
+	if err != nil {
+		return err
+	}
+
+	if len(data) > maxArchiveSize {
+		return fmt.Errorf("archives are limited to %d bytes", maxArchiveSize)
+	}
+
+	posts, err := ParseArchive(data)
+	if err != nil {
+		return err
+	}
+
+	n, err := fa.s.ImportPosts(r.Context(), key, feedID, posts)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, map[string]int{
+		"posts":    len(posts),
+		"imported": n,
+	})
+}
+
+// SetTransform sets the script run on every new post of a feed for the user,
+// posts already written are left as they are
+func (fa *FeedAPI) SetTransform(w http.ResponseWriter, r *http.Request) error {
+	key, err := fa.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		FeedID string `json:"feed_id"`
+		Script string `json:"script"`
+	}
+	err = limitDecoder(r, &req)
+	if err != nil {
+		return err
+	}
+
+	if req.FeedID == "" {
+		return errors.New("no feed ID submitted")
+	}
+
+	// compiled only to check it, it is compiled again for every post written
+	_, err = CompileTransform(req.Script)
+	if err != nil {
+		return err
+	}
+
+	err = fa.s.SetFeedTransform(r.Context(), key, req.FeedID, req.Script)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, nil)
+}
+
+// GetTransform returns the users script for a feed, with the last error it
+// ran into
+func (fa *FeedAPI) GetTransform(w http.ResponseWriter, r *http.Request) error {
+	key, err := fa.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		FeedID string `json:"feed_id"`
+	}
+	err = limitDecoder(r, &req)
+	if err != nil {
+		return err
+	}
+
+	ft, err := fa.s.GetFeedTransform(r.Context(), key, req.FeedID)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, ft)
+}
+
+// Backfill queues a scrape of the entire history of a feed the user follows,
+// for plugins that can walk its archives. Backfills run behind every other
+// scrape and at a lower rate, so they may take a long time. Those paused for
+// running too long are resumed where they left off
+func (fa *FeedAPI) Backfill(w http.ResponseWriter, r *http.Request) error {
+	key, err := fa.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		FeedID string `json:"feed_id"`
+	}
+	err = limitDecoder(r, &req)
+	if err != nil {
+		return err
+	}
+
+	if req.FeedID == "" {
+		return errors.New("no feed ID submitted")
+	}
+
+	// the backfill config is made by the plugin, which api-only nodes lack
+	if fa.dc == nil {
+		return errors.New("backfills can not be started right now")
+	}
+
+	// a paused backfill keeps its remaining tasks, and a new one can not be
+	// queued until it is done with
+	sc, err := fa.s.GetBackfill(r.Context(), key, req.FeedID)
+	if err == nil && sc.State == "PAUSED" {
+		err = fa.dc.Resume(r.Context(), sc.ID)
+		if err != nil {
+			return err
 		}
 
-		id, err = fa.s.AddFeed(r.Context(), key, feed.FolderID, feedTitle, plugin.Name, initialConfig.Entrypoints[0], initialConfig)
+		return writeSuccess(w, map[string]string{
+			"scrape_id": sc.ID.String(),
+		})
+	}
+
+	plugin, initConf, err := fa.s.GetFeedConfig(r.Context(), key, req.FeedID)
+	if err != nil {
+		return err
+	}
+
+	conf, err := fa.dc.BackfillConfig(plugin, initConf)
+	if err != nil {
+		return err
+	}
+
+	id, err := fa.s.BackfillFeed(r.Context(), key, req.FeedID, conf)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, map[string]string{
+		"scrape_id": id,
+	})
+}
+
+// BackfillStatus returns the latest backfill of a feed the user follows, with
+// how many of its tasks have completed
+func (fa *FeedAPI) BackfillStatus(w http.ResponseWriter, r *http.Request) error {
+	key, err := fa.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		FeedID string `json:"feed_id"`
+	}
+	err = limitDecoder(r, &req)
+	if err != nil {
+		return err
+	}
+
+	if req.FeedID == "" {
+		return errors.New("no feed ID submitted")
+	}
+
+	sc, err := fa.s.GetBackfill(r.Context(), key, req.FeedID)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, sc)
+}
+
+// SetSchedule sets how often a feed only the user follows is scraped, on a
+// fixed interval, adaptively by how often it posts or by a cron expression,
+// no more than every 15 minutes. Sending no schedule goes back to the default
+// for the feed
+func (fa *FeedAPI) SetSchedule(w http.ResponseWriter, r *http.Request) error {
+	key, err := fa.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		FeedID   string                   `json:"feed_id"`
+		Schedule *discollect.ScheduleSpec `json:"schedule"`
+	}
+	err = limitDecoder(r, &req)
+	if err != nil {
+		return err
+	}
+
+	if req.FeedID == "" {
+		return errors.New("no feed ID submitted")
+	}
+
+	if req.Schedule != nil {
+		_, err = req.Schedule.Scheduler()
 		if err != nil {
 			return err
 		}
+	}
 
-		break
+	err = fa.s.SetFeedSchedule(r.Context(), key, req.FeedID, req.Schedule)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, nil)
+}
+
+// SetCredentials sets the username and password or cookies used to log into
+// the origin site of a feed the user follows, for sites that require an account.
+// The feed is scraped with them apart from everyone else, as a private feed
+// whose ID is returned, which the user now follows in its place
+func (fa *FeedAPI) SetCredentials(w http.ResponseWriter, r *http.Request) error {
+	key, err := fa.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		FeedID string `json:"feed_id"`
+		discollect.Credentials
+	}
+	err = limitDecoder(r, &req)
+	if err != nil {
+		return err
+	}
+
+	if req.FeedID == "" {
+		return errors.New("no feed ID submitted")
+	}
+
+	if req.Username == "" && req.Password == "" && len(req.Cookies) == 0 {
+		return errors.New("no credentials submitted")
+	}
+
+	id, err := fa.s.SetFeedCredentials(r.Context(), key, req.FeedID, &req.Credentials)
+	if err != nil {
+		return err
 	}
 
 	return writeSuccess(w, map[string]string{
-		"id":    id,
-		"title": feedTitle,
+		"feed_id": id,
 	})
 }
 
+// DeleteCredentials removes the credentials of a feed the user follows, which
+// stays private to them
+func (fa *FeedAPI) DeleteCredentials(w http.ResponseWriter, r *http.Request) error {
+	key, err := fa.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		FeedID string `json:"feed_id"`
+	}
+	err = limitDecoder(r, &req)
+	if err != nil {
+		return err
+	}
+
+	if req.FeedID == "" {
+		return errors.New("no feed ID submitted")
+	}
+
+	err = fa.s.DeleteFeedCredentials(r.Context(), key, req.FeedID)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, nil)
+}
+
 // AddFolder creates a new folder
 func (fa *FeedAPI) AddFolder(w http.ResponseWriter, r *http.Request) error {
 	key, err := fa.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
@@ -143,6 +655,43 @@ func (fa *FeedAPI) AddFolder(w http.ResponseWriter, r *http.Request) error {
 	})
 }
 
+// DeleteFolder deletes a folder, it can be restored until it is purged
+func (fa *FeedAPI) DeleteFolder(w http.ResponseWriter, r *http.Request) error {
+	return fa.setFolderDeleted(w, r, true)
+}
+
+// RestoreFolder restores a deleted folder, along with its feeds
+func (fa *FeedAPI) RestoreFolder(w http.ResponseWriter, r *http.Request) error {
+	return fa.setFolderDeleted(w, r, false)
+}
+
+func (fa *FeedAPI) setFolderDeleted(w http.ResponseWriter, r *http.Request, deleted bool) error {
+	key, err := fa.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	var folder struct {
+		FolderID string `json:"folder_id"`
+	}
+
+	err = limitDecoder(r, &folder)
+	if err != nil {
+		return err
+	}
+
+	if folder.FolderID == "" {
+		return errors.New("no folder ID sent")
+	}
+
+	err = fa.s.SetFolderDeleted(r.Context(), key, folder.FolderID, deleted)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, nil)
+}
+
 // RemoveFeed removes the given feed from the users list
 func (fa *FeedAPI) RemoveFeed(w http.ResponseWriter, r *http.Request) error {
 	key, err := fa.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
@@ -167,7 +716,8 @@ func (fa *FeedAPI) RemoveFeed(w http.ResponseWriter, r *http.Request) error {
 	return fa.s.RemoveFeed(r.Context(), key, feed.FolderID, feed.FeedID)
 }
 
-// GetFolders writes all of a users folders out
+// GetFolders writes all of a users folders out, along with any announcements
+// they have yet to see
 func (fa *FeedAPI) GetFolders(w http.ResponseWriter, r *http.Request) error {
 	key, err := fa.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
 	if err != nil {
@@ -179,7 +729,18 @@ func (fa *FeedAPI) GetFolders(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	return writeSuccess(w, folders)
+	announcements, err := fa.s.GetUnseenAnnouncements(r.Context(), key)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, struct {
+		Folders       []*Folder       `json:"folders"`
+		Announcements []*Announcement `json:"announcements"`
+	}{
+		folders,
+		announcements,
+	})
 }
 
 // GetFeed writes a specific feed
@@ -276,3 +837,63 @@ func (fa *FeedAPI) GetPost(w http.ResponseWriter, r *http.Request) error {
 
 	return writeSuccess(w, feed)
 }
+
+type externalIDReq struct {
+	Plugin     string `json:"plugin"`
+	ExternalID string `json:"external_id"`
+}
+
+func (er *externalIDReq) decode(r *http.Request) error {
+	err := limitDecoder(r, er)
+	if err != nil {
+		return err
+	}
+
+	if er.Plugin == "" || er.ExternalID == "" {
+		return errors.New("plugin and external_id are required")
+	}
+
+	return nil
+}
+
+// LookupFeed finds a feed by the ID its plugin gave it
+func (fa *FeedAPI) LookupFeed(w http.ResponseWriter, r *http.Request) error {
+	key, err := fa.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	var req externalIDReq
+	err = req.decode(r)
+	if err != nil {
+		return err
+	}
+
+	feed, err := fa.s.GetFeedByExternalID(r.Context(), key, req.Plugin, req.ExternalID)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, feed)
+}
+
+// LookupPost finds a post by the ID its plugin gave it
+func (fa *FeedAPI) LookupPost(w http.ResponseWriter, r *http.Request) error {
+	key, err := fa.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	var req externalIDReq
+	err = req.decode(r)
+	if err != nil {
+		return err
+	}
+
+	post, err := fa.s.GetPostByExternalID(r.Context(), key, req.Plugin, req.ExternalID)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, post)
+}
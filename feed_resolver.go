@@ -0,0 +1,150 @@
+package hydrocarbon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/fortytw2/hydrocarbon/discollect"
+)
+
+const (
+	pendingFeedInterval  = 30 * time.Second
+	pendingFeedBatch     = 25
+	maxPendingFeedErrors = 5
+)
+
+// A PendingFeed is a feed that was added while no scraper was available to
+// resolve it to a plugin
+type PendingFeed struct {
+	ID       string
+	URL      string
+	Attempts int
+}
+
+// A PendingFeedStore is an interface used to seperate the FeedResolver from
+// knowledge of the actual underlying database
+type PendingFeedStore interface {
+	ListPendingFeeds(ctx context.Context, limit int) ([]*PendingFeed, error)
+	// ResolvePendingFeed fills in a pending feed and schedules its first
+	// scrape
+	ResolvePendingFeed(ctx context.Context, id, title, plugin, feedURL, externalID string, initConf *discollect.Config) error
+	// FailPendingFeed records a failed attempt, final gives up on the feed
+	FailPendingFeed(ctx context.Context, id, reason string, final bool) error
+}
+
+// A FeedResolver resolves pending feeds in the background, it runs alongside
+// the Discollector on scraping nodes
+type FeedResolver struct {
+	s  PendingFeedStore
+	dc *discollect.Discollector
+
+	shutdown chan chan struct{}
+}
+
+// NewFeedResolver returns a new FeedResolver
+func NewFeedResolver(s PendingFeedStore, dc *discollect.Discollector) *FeedResolver {
+	return &FeedResolver{
+		s:        s,
+		dc:       dc,
+		shutdown: make(chan chan struct{}),
+	}
+}
+
+// Start launches the resolver, it blocks until Stop is called
+func (fr *FeedResolver) Start() error {
+	ticker := time.NewTicker(pendingFeedInterval)
+
+	for {
+		select {
+		case a := <-fr.shutdown:
+			ticker.Stop()
+			a <- struct{}{}
+			return nil
+		case <-ticker.C:
+			if fr.dc.Draining() {
+				continue
+			}
+
+			err := fr.resolvePending(context.TODO())
+			if err != nil {
+				log.Println("hydrocarbon: could not resolve pending feeds:", err)
+			}
+		}
+	}
+}
+
+// Stop blocks until the resolver is shutdown
+func (fr *FeedResolver) Stop() {
+	c := make(chan struct{})
+	fr.shutdown <- c
+	<-c
+}
+
+func (fr *FeedResolver) resolvePending(ctx context.Context) error {
+	pending, err := fr.s.ListPendingFeeds(ctx, pendingFeedBatch)
+	if err != nil {
+		return err
+	}
+
+	for _, pf := range pending {
+		plugin, title, externalID, conf, err := resolveFeed(ctx, fr.dc, pf.URL)
+		if err != nil {
+			err = fr.s.FailPendingFeed(ctx, pf.ID, err.Error(), pf.Attempts+1 >= maxPendingFeedErrors)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = fr.s.ResolvePendingFeed(ctx, pf.ID, title, plugin, conf.Entrypoints[0], externalID, conf)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolveFeed finds the first plugin able to create a config for feedURL,
+// returning the plugin name, feed title, external ID and initial config
+func resolveFeed(ctx context.Context, dc *discollect.Discollector, feedURL string) (string, string, string, *discollect.Config, error) {
+	var (
+		blacklist []string
+		sniffed   bool
+	)
+	for {
+		plugin, handlerOpts, err := dc.PluginForEntrypoint(feedURL, blacklist)
+		// fall back to fetching the page once patterns alone are exhausted
+		if err == discollect.ErrNoValidPluginForEntrypoint && !sniffed {
+			sniffed = true
+			plugin, feedURL, handlerOpts, err = dc.SniffEntrypoint(ctx, feedURL, blacklist)
+		}
+		if err != nil {
+			return "", "", "", nil, err
+		}
+
+		feedTitle, initialConfig, err := plugin.ConfigCreator(feedURL, handlerOpts)
+		if err != nil {
+			if len(blacklist) == maxFailedResolutions {
+				return "", "", "", nil, err
+			}
+			blacklist = append(blacklist, plugin.Name)
+			continue
+		}
+
+		initialConfig.Version = plugin.ConfigVersion
+
+		if len(initialConfig.Entrypoints) == 0 {
+			return "", "", "", nil, fmt.Errorf("%s: did not return an entrypoint for %s", plugin.Name, feedURL)
+		}
+
+		var externalID string
+		if plugin.ExternalID != nil {
+			externalID = plugin.ExternalID(feedURL, handlerOpts)
+		}
+
+		return plugin.Name, feedTitle, externalID, initialConfig, nil
+	}
+}
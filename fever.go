@@ -0,0 +1,288 @@
+package hydrocarbon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// feverItemLimit is the most items Fever clients are sent at once, as the
+// Fever API sends
+const feverItemLimit = 50
+
+// A FeverGroup is a folder, as Fever clients see it
+type FeverGroup struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	// FeedIDs are sent in feeds_groups rather than with the group
+	FeedIDs []int64 `json:"-"`
+}
+
+// A FeverFeed is a feed the user follows, as Fever clients see it
+type FeverFeed struct {
+	ID                int64  `json:"id"`
+	FaviconID         int64  `json:"favicon_id"`
+	Title             string `json:"title"`
+	URL               string `json:"url"`
+	SiteURL           string `json:"site_url"`
+	IsSpark           int    `json:"is_spark"`
+	LastUpdatedOnTime int64  `json:"last_updated_on_time"`
+}
+
+// A FeverItem is a post, as Fever clients see it
+type FeverItem struct {
+	ID            int64  `json:"id"`
+	FeedID        int64  `json:"feed_id"`
+	Title         string `json:"title"`
+	Author        string `json:"author"`
+	HTML          string `json:"html"`
+	URL           string `json:"url"`
+	IsSaved       int    `json:"is_saved"`
+	IsRead        int    `json:"is_read"`
+	CreatedOnTime int64  `json:"created_on_time"`
+}
+
+// A FeverItemQuery selects up to feverItemLimit items, those in WithIDs if it
+// is set, otherwise the newest before MaxID if it is set, otherwise the oldest
+// after SinceID
+type FeverItemQuery struct {
+	SinceID int64
+	MaxID   int64
+	WithIDs []int64
+}
+
+// A FeverStore is the part of the store the FeverAPI needs. Fever identifies
+// folders, feeds and posts by integers, which the store keeps for each of them
+// alongside their IDs
+type FeverStore interface {
+	// SetFeverPassword sets the password Fever clients log in with, they
+	// send the md5 of the email of the user and the password as their key.
+	// An empty password stops them logging in
+	SetFeverPassword(ctx context.Context, sessionKey, password string) error
+	// FeverUser returns the ID of the user whose Fever key apiKey is, empty
+	// if there is none
+	FeverUser(ctx context.Context, apiKey string) (string, error)
+
+	FeverGroups(ctx context.Context, userID string) ([]*FeverGroup, error)
+	FeverFeeds(ctx context.Context, userID string) ([]*FeverFeed, error)
+	// FeverItems returns the items q selects and how many items the user
+	// has in total
+	FeverItems(ctx context.Context, userID string, q *FeverItemQuery) ([]*FeverItem, int, error)
+	FeverUnreadItemIDs(ctx context.Context, userID string) ([]int64, error)
+	FeverSavedItemIDs(ctx context.Context, userID string) ([]int64, error)
+
+	// FeverMarkItem marks an item read, unread, saved or unsaved
+	FeverMarkItem(ctx context.Context, userID string, itemID int64, as string) error
+	// FeverMarkRead marks the items of a feed or group posted before before
+	// read, group 0 being every feed
+	FeverMarkRead(ctx context.Context, userID, kind string, id int64, before time.Time) error
+}
+
+// FeverAPI serves the Fever API, so clients such as Reeder and Unread can be
+// used with hydrocarbon
+type FeverAPI struct {
+	s  FeverStore
+	ks *KeySigner
+}
+
+// NewFeverAPI returns a new FeverAPI
+func NewFeverAPI(s FeverStore, ks *KeySigner) *FeverAPI {
+	return &FeverAPI{
+		s:  s,
+		ks: ks,
+	}
+}
+
+// SetPassword sets the password the user logs in to Fever clients with
+func (fv *FeverAPI) SetPassword(w http.ResponseWriter, r *http.Request) error {
+	key, err := fv.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	var pwReq struct {
+		Password string `json:"password"`
+	}
+
+	err = limitDecoder(r, &pwReq)
+	if err != nil {
+		return err
+	}
+
+	err = fv.s.SetFeverPassword(r.Context(), key, pwReq.Password)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, nil)
+}
+
+// Serve answers a Fever API request, what is asked for is given by the query
+// string of the url, as in ?api&items&since_id=1, the key and what to mark by
+// the form posted
+func (fv *FeverAPI) Serve(w http.ResponseWriter, r *http.Request) error {
+	err := r.ParseForm()
+	if err != nil {
+		return err
+	}
+
+	resp := map[string]interface{}{
+		"api_version": 3,
+		"auth":        0,
+	}
+
+	userID, err := fv.s.FeverUser(r.Context(), strings.ToLower(r.Form.Get("api_key")))
+	if err != nil {
+		return err
+	}
+	if userID == "" {
+		return writeFever(w, resp)
+	}
+	resp["auth"] = 1
+	resp["last_refreshed_on_time"] = time.Now().Unix()
+
+	ctx := r.Context()
+	q := r.URL.Query()
+	has := func(name string) bool {
+		_, ok := q[name]
+		return ok
+	}
+
+	if mark := r.Form.Get("mark"); mark != "" {
+		err = fv.mark(ctx, userID, mark, r.Form.Get("as"), r.Form.Get("id"), r.Form.Get("before"))
+		if err != nil {
+			return err
+		}
+	}
+
+	if has("groups") || has("feeds") {
+		groups, err := fv.s.FeverGroups(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		feedsGroups := make([]map[string]interface{}, 0, len(groups))
+		for _, g := range groups {
+			feedsGroups = append(feedsGroups, map[string]interface{}{
+				"group_id": g.ID,
+				"feed_ids": joinIDs(g.FeedIDs),
+			})
+		}
+
+		if has("groups") {
+			resp["groups"] = groups
+		}
+		resp["feeds_groups"] = feedsGroups
+	}
+
+	if has("feeds") {
+		feeds, err := fv.s.FeverFeeds(ctx, userID)
+		if err != nil {
+			return err
+		}
+		resp["feeds"] = feeds
+	}
+
+	// favicons, sparks and hot links are not kept, clients are sent none
+	if has("favicons") {
+		resp["favicons"] = []struct{}{}
+	}
+	if has("links") {
+		resp["links"] = []struct{}{}
+	}
+
+	if has("items") {
+		iq := &FeverItemQuery{
+			SinceID: parseID(q.Get("since_id")),
+			MaxID:   parseID(q.Get("max_id")),
+		}
+		// max_id=0 asks for the newest items
+		if has("max_id") && iq.MaxID == 0 {
+			iq.MaxID = math.MaxInt64
+		}
+		for _, id := range strings.Split(q.Get("with_ids"), ",") {
+			if n := parseID(id); n > 0 && len(iq.WithIDs) < feverItemLimit {
+				iq.WithIDs = append(iq.WithIDs, n)
+			}
+		}
+
+		items, total, err := fv.s.FeverItems(ctx, userID, iq)
+		if err != nil {
+			return err
+		}
+		resp["items"] = items
+		resp["total_items"] = total
+	}
+
+	if has("unread_item_ids") {
+		ids, err := fv.s.FeverUnreadItemIDs(ctx, userID)
+		if err != nil {
+			return err
+		}
+		resp["unread_item_ids"] = joinIDs(ids)
+	}
+
+	if has("saved_item_ids") {
+		ids, err := fv.s.FeverSavedItemIDs(ctx, userID)
+		if err != nil {
+			return err
+		}
+		resp["saved_item_ids"] = joinIDs(ids)
+	}
+
+	return writeFever(w, resp)
+}
+
+// mark marks an item, or every item of a feed or group
+func (fv *FeverAPI) mark(ctx context.Context, userID, mark, as, id, before string) error {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return errors.New("invalid id")
+	}
+
+	switch mark {
+	case "item":
+		return fv.s.FeverMarkItem(ctx, userID, n, as)
+	case "feed", "group":
+		if as != "read" {
+			return errors.New("feeds and groups can only be marked read")
+		}
+
+		ts, err := strconv.ParseInt(before, 10, 64)
+		if err != nil {
+			return errors.New("invalid before")
+		}
+
+		return fv.s.FeverMarkRead(ctx, userID, mark, n, time.Unix(ts, 0))
+	default:
+		return errors.New("unknown mark")
+	}
+}
+
+// writeFever writes a Fever response, which unlike the rest of the api is not
+// wrapped in a status
+func writeFever(w http.ResponseWriter, resp map[string]interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(resp)
+}
+
+// joinIDs joins ids with commas, as Fever sends lists of IDs
+func joinIDs(ids []int64) string {
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = strconv.FormatInt(id, 10)
+	}
+
+	return strings.Join(strs, ",")
+}
+
+// parseID parses a Fever ID, zero if it is not one
+func parseID(s string) int64 {
+	n, _ := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	return n
+}
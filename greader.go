@@ -0,0 +1,729 @@
+package hydrocarbon
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// greaderPrefix is where the Google Reader API is served, clients are given it
+// as the url of the server and add /accounts/ClientLogin and /reader/api/0/
+const greaderPrefix = "/greader"
+
+// greaderItemLimit is the most items a client is sent at once, item IDs are
+// sent greaderIDLimit at a time
+const (
+	greaderItemLimit = 250
+	greaderIDLimit   = 10000
+)
+
+// streams and states every user has
+const (
+	greaderReadingList = "user/-/state/com.google/reading-list"
+	greaderRead        = "user/-/state/com.google/read"
+	greaderStarred     = "user/-/state/com.google/starred"
+	greaderKeptUnread  = "user/-/state/com.google/kept-unread"
+	greaderLabel       = "user/-/label/"
+	greaderFeed        = "feed/"
+	greaderItemPrefix  = "tag:google.com,2005:reader/item/"
+)
+
+// A GReaderQuery selects the items of a stream, newest first unless
+// OldestFirst, up to Limit of them. Continue is the last item a client was
+// sent, the items after it are selected
+type GReaderQuery struct {
+	// FeedID and GroupID, given as in the Fever API, narrow the items to
+	// those of a feed or folder
+	FeedID  int64
+	GroupID int64
+
+	Starred     bool
+	ExcludeRead bool
+	NewerThan   time.Time
+	OlderThan   time.Time
+	OldestFirst bool
+
+	Continue int64
+	Limit    int
+}
+
+// A GReaderUnreadCount is how many posts of a feed the user has not read, and
+// when the newest of them was posted
+type GReaderUnreadCount struct {
+	FeedID int64
+	Count  int
+	Newest time.Time
+}
+
+// A GReaderStore is the part of the store the GReaderAPI needs. Clients log in
+// with the same password as Fever clients, and see the same integer IDs
+type GReaderStore interface {
+	FeverStore
+
+	GReaderItemIDs(ctx context.Context, userID string, q *GReaderQuery) ([]int64, error)
+	GReaderUnreadCounts(ctx context.Context, userID string) ([]*GReaderUnreadCount, error)
+}
+
+// GReaderAPI serves the Google Reader API, as FreshRSS does, so its mobile
+// clients can be used with hydrocarbon. Subscriptions are listed but are
+// managed through hydrocarbon itself
+type GReaderAPI struct {
+	s  GReaderStore
+	ks *KeySigner
+}
+
+// NewGReaderAPI returns a new GReaderAPI
+func NewGReaderAPI(s GReaderStore, ks *KeySigner) *GReaderAPI {
+	return &GReaderAPI{
+		s:  s,
+		ks: ks,
+	}
+}
+
+// Serve answers every request under greaderPrefix
+func (gr *GReaderAPI) Serve(w http.ResponseWriter, r *http.Request) error {
+	err := r.ParseForm()
+	if err != nil {
+		return err
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, greaderPrefix)
+	if path == "/accounts/ClientLogin" {
+		return gr.clientLogin(w, r)
+	}
+
+	if !strings.HasPrefix(path, "/reader/api/0/") {
+		http.NotFound(w, r)
+		return nil
+	}
+
+	userID, err := gr.authenticate(r)
+	if err != nil {
+		return err
+	}
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil
+	}
+
+	ctx := r.Context()
+	path = strings.TrimPrefix(path, "/reader/api/0/")
+	switch {
+	case path == "token":
+		token, err := gr.ks.Sign(editToken(userID))
+		if err != nil {
+			return err
+		}
+
+		return writeGReaderText(w, token)
+	case path == "user-info":
+		return writeGReader(w, map[string]string{
+			"userId":        userID,
+			"userName":      userID,
+			"userProfileId": userID,
+		})
+	case path == "subscription/list":
+		return gr.subscriptions(ctx, w, userID)
+	case path == "tag/list":
+		return gr.tags(ctx, w, userID)
+	case path == "unread-count":
+		return gr.unreadCounts(ctx, w, userID)
+	case path == "stream/items/ids":
+		return gr.itemIDs(ctx, w, r, userID)
+	case path == "stream/items/contents":
+		return gr.itemContents(ctx, w, r, userID)
+	case strings.HasPrefix(path, "stream/contents"):
+		// the stream is given in the path, or as s by some clients
+		stream := strings.TrimPrefix(strings.TrimPrefix(path, "stream/contents"), "/")
+		if stream == "" {
+			stream = r.Form.Get("s")
+		}
+
+		return gr.streamContents(ctx, w, r, userID, stream)
+	case path == "edit-tag" || path == "mark-all-as-read":
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return nil
+		}
+
+		// edits need the token of the user as well as their login, so they
+		// can not be made by other sites
+		t, err := gr.ks.Verify(r.Form.Get("T"))
+		if err != nil || t != editToken(userID) {
+			w.Header().Set("X-Reader-Google-Bad-Token", "true")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return nil
+		}
+
+		if path == "edit-tag" {
+			return gr.editTag(ctx, w, r, userID)
+		}
+		return gr.markAllRead(ctx, w, r, userID)
+	default:
+		http.NotFound(w, r)
+		return nil
+	}
+}
+
+// clientLogin logs a client in with the email and Fever password of a user,
+// the Auth it is sent back is the signed Fever key of the user, so it stops
+// working once the password is changed
+func (gr *GReaderAPI) clientLogin(w http.ResponseWriter, r *http.Request) error {
+	// keys are made from emails in lower case, see SetFeverPassword
+	apiKey := feverKey(strings.ToLower(r.Form.Get("Email")), r.Form.Get("Passwd"))
+	userID, err := gr.s.FeverUser(r.Context(), apiKey)
+	if err != nil {
+		return err
+	}
+	if userID == "" || r.Form.Get("Passwd") == "" {
+		http.Error(w, "Error=BadAuthentication", http.StatusUnauthorized)
+		return nil
+	}
+
+	auth, err := gr.ks.Sign(apiKey)
+	if err != nil {
+		return err
+	}
+
+	return writeGReaderText(w, fmt.Sprintf("SID=%s\nLSID=null\nAuth=%s\n", auth, auth))
+}
+
+// authenticate returns the user the Authorization header of r logs in as,
+// empty if it does not log in
+func (gr *GReaderAPI) authenticate(r *http.Request) (string, error) {
+	auth := strings.TrimPrefix(r.Header.Get("Authorization"), "GoogleLogin auth=")
+	apiKey, err := gr.ks.Verify(auth)
+	if err != nil {
+		return "", nil
+	}
+
+	return gr.s.FeverUser(r.Context(), apiKey)
+}
+
+// feverKey is the key Fever clients of the user with email send, given their
+// password
+func feverKey(email, password string) string {
+	sum := md5.Sum([]byte(email + ":" + password))
+	return hex.EncodeToString(sum[:])
+}
+
+// editToken is what the token of a user signs
+func editToken(userID string) string {
+	return "edit-" + userID
+}
+
+type greaderCategory struct {
+	ID    string `json:"id"`
+	Label string `json:"label,omitempty"`
+	Type  string `json:"type,omitempty"`
+}
+
+// feedGroups returns the folder each feed the user follows is in
+func (gr *GReaderAPI) feedGroups(ctx context.Context, userID string) (map[int64]*FeverGroup, error) {
+	groups, err := gr.s.FeverGroups(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	feedGroups := make(map[int64]*FeverGroup)
+	for _, g := range groups {
+		for _, id := range g.FeedIDs {
+			feedGroups[id] = g
+		}
+	}
+
+	return feedGroups, nil
+}
+
+func (gr *GReaderAPI) subscriptions(ctx context.Context, w http.ResponseWriter, userID string) error {
+	feedGroups, err := gr.feedGroups(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	feeds, err := gr.s.FeverFeeds(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	type subscription struct {
+		ID         string             `json:"id"`
+		Title      string             `json:"title"`
+		Categories []*greaderCategory `json:"categories"`
+		URL        string             `json:"url"`
+		HTMLURL    string             `json:"htmlUrl"`
+		IconURL    string             `json:"iconUrl"`
+	}
+
+	subs := make([]*subscription, 0, len(feeds))
+	for _, f := range feeds {
+		sub := &subscription{
+			ID:         greaderFeed + strconv.FormatInt(f.ID, 10),
+			Title:      f.Title,
+			Categories: make([]*greaderCategory, 0, 1),
+			URL:        f.URL,
+			HTMLURL:    f.SiteURL,
+		}
+		if g, ok := feedGroups[f.ID]; ok {
+			sub.Categories = append(sub.Categories, &greaderCategory{ID: greaderLabel + g.Title, Label: g.Title})
+		}
+
+		subs = append(subs, sub)
+	}
+
+	return writeGReader(w, map[string]interface{}{"subscriptions": subs})
+}
+
+func (gr *GReaderAPI) tags(ctx context.Context, w http.ResponseWriter, userID string) error {
+	groups, err := gr.s.FeverGroups(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	tags := []*greaderCategory{{ID: greaderStarred}}
+	for _, g := range groups {
+		tags = append(tags, &greaderCategory{ID: greaderLabel + g.Title, Type: "folder"})
+	}
+
+	return writeGReader(w, map[string]interface{}{"tags": tags})
+}
+
+func (gr *GReaderAPI) unreadCounts(ctx context.Context, w http.ResponseWriter, userID string) error {
+	feedGroups, err := gr.feedGroups(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	counts, err := gr.s.GReaderUnreadCounts(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	type unreadCount struct {
+		ID                      string `json:"id"`
+		Count                   int    `json:"count"`
+		NewestItemTimestampUsec string `json:"newestItemTimestampUsec"`
+	}
+
+	// folders and the reading list add up the counts of their feeds
+	ids := []string{greaderReadingList}
+	sums := map[string]*GReaderUnreadCount{greaderReadingList: {}}
+	sum := func(id string, c *GReaderUnreadCount) {
+		s, ok := sums[id]
+		if !ok {
+			s = &GReaderUnreadCount{}
+			sums[id] = s
+			ids = append(ids, id)
+		}
+
+		s.Count += c.Count
+		if c.Newest.After(s.Newest) {
+			s.Newest = c.Newest
+		}
+	}
+
+	for _, c := range counts {
+		sum(greaderFeed+strconv.FormatInt(c.FeedID, 10), c)
+		if g, ok := feedGroups[c.FeedID]; ok {
+			sum(greaderLabel+g.Title, c)
+		}
+		sum(greaderReadingList, c)
+	}
+
+	out := make([]*unreadCount, len(ids))
+	for i, id := range ids {
+		out[i] = &unreadCount{ID: id, Count: sums[id].Count, NewestItemTimestampUsec: "0"}
+		if !sums[id].Newest.IsZero() {
+			out[i].NewestItemTimestampUsec = usecString(sums[id].Newest)
+		}
+	}
+
+	return writeGReader(w, map[string]interface{}{
+		"max":          greaderIDLimit,
+		"unreadcounts": out,
+	})
+}
+
+// streamQuery returns the query selecting the items of stream, filtered and
+// paged as the form of r asks, with at most limit items
+func (gr *GReaderAPI) streamQuery(ctx context.Context, r *http.Request, userID, stream string, limit int) (*GReaderQuery, error) {
+	q := &GReaderQuery{
+		// as many as Google Reader sent when not asked for a number
+		Limit:       20,
+		OldestFirst: r.Form.Get("r") == "o",
+		Continue:    parseID(r.Form.Get("c")),
+	}
+	if n, err := strconv.Atoi(r.Form.Get("n")); err == nil && n > 0 {
+		q.Limit = n
+	}
+	if q.Limit > limit {
+		q.Limit = limit
+	}
+	if ot := parseID(r.Form.Get("ot")); ot > 0 {
+		q.NewerThan = time.Unix(ot, 0)
+	}
+	if nt := parseID(r.Form.Get("nt")); nt > 0 {
+		q.OlderThan = time.Unix(nt, 0)
+	}
+	for _, xt := range r.Form["xt"] {
+		if normalizeStream(xt) == greaderRead {
+			q.ExcludeRead = true
+		}
+	}
+
+	err := gr.narrow(ctx, q, userID, stream)
+	if err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// narrow narrows q to the items of stream
+func (gr *GReaderAPI) narrow(ctx context.Context, q *GReaderQuery, userID, stream string) error {
+	stream = normalizeStream(stream)
+	switch {
+	case stream == "" || stream == greaderReadingList:
+	case stream == greaderStarred:
+		q.Starred = true
+	case strings.HasPrefix(stream, greaderFeed):
+		q.FeedID = parseID(strings.TrimPrefix(stream, greaderFeed))
+		if q.FeedID == 0 {
+			return errors.New("unknown feed")
+		}
+	case strings.HasPrefix(stream, greaderLabel):
+		groups, err := gr.s.FeverGroups(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimPrefix(stream, greaderLabel)
+		for _, g := range groups {
+			if g.Title == name {
+				q.GroupID = g.ID
+			}
+		}
+		if q.GroupID == 0 {
+			return errors.New("unknown label")
+		}
+	default:
+		return errors.New("unknown stream")
+	}
+
+	return nil
+}
+
+// normalizeStream replaces the user ID in stream with -, as every client
+// reads only its own user
+func normalizeStream(stream string) string {
+	if !strings.HasPrefix(stream, "user/") {
+		return stream
+	}
+
+	spl := strings.SplitN(stream, "/", 3)
+	if len(spl) != 3 {
+		return stream
+	}
+
+	return "user/-/" + spl[2]
+}
+
+// queryIDs returns the IDs q selects, and the continuation to send if there
+// are more of them
+func (gr *GReaderAPI) queryIDs(ctx context.Context, userID string, q *GReaderQuery) ([]int64, string, error) {
+	limit := q.Limit
+	q.Limit++
+
+	ids, err := gr.s.GReaderItemIDs(ctx, userID, q)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(ids) <= limit {
+		return ids, "", nil
+	}
+
+	ids = ids[:limit]
+	return ids, strconv.FormatInt(ids[limit-1], 10), nil
+}
+
+func (gr *GReaderAPI) itemIDs(ctx context.Context, w http.ResponseWriter, r *http.Request, userID string) error {
+	q, err := gr.streamQuery(ctx, r, userID, r.Form.Get("s"), greaderIDLimit)
+	if err != nil {
+		return err
+	}
+
+	ids, continuation, err := gr.queryIDs(ctx, userID, q)
+	if err != nil {
+		return err
+	}
+
+	type itemRef struct {
+		ID string `json:"id"`
+	}
+
+	refs := make([]*itemRef, len(ids))
+	for i, id := range ids {
+		refs[i] = &itemRef{ID: strconv.FormatInt(id, 10)}
+	}
+
+	resp := map[string]interface{}{"itemRefs": refs}
+	if continuation != "" {
+		resp["continuation"] = continuation
+	}
+
+	return writeGReader(w, resp)
+}
+
+func (gr *GReaderAPI) streamContents(ctx context.Context, w http.ResponseWriter, r *http.Request, userID, stream string) error {
+	q, err := gr.streamQuery(ctx, r, userID, stream, greaderItemLimit)
+	if err != nil {
+		return err
+	}
+
+	ids, continuation, err := gr.queryIDs(ctx, userID, q)
+	if err != nil {
+		return err
+	}
+
+	items, err := gr.items(ctx, userID, ids)
+	if err != nil {
+		return err
+	}
+
+	resp := map[string]interface{}{
+		"id":      stream,
+		"updated": time.Now().Unix(),
+		"items":   items,
+	}
+	if continuation != "" {
+		resp["continuation"] = continuation
+	}
+
+	return writeGReader(w, resp)
+}
+
+func (gr *GReaderAPI) itemContents(ctx context.Context, w http.ResponseWriter, r *http.Request, userID string) error {
+	var ids []int64
+	for _, i := range r.Form["i"] {
+		if id := parseItemID(i); id > 0 && len(ids) < greaderItemLimit {
+			ids = append(ids, id)
+		}
+	}
+
+	items, err := gr.items(ctx, userID, ids)
+	if err != nil {
+		return err
+	}
+
+	return writeGReader(w, map[string]interface{}{
+		"id":      greaderReadingList,
+		"updated": time.Now().Unix(),
+		"items":   items,
+	})
+}
+
+type greaderLink struct {
+	Href string `json:"href"`
+	Type string `json:"type,omitempty"`
+}
+
+type greaderItem struct {
+	ID            string         `json:"id"`
+	CrawlTimeMsec string         `json:"crawlTimeMsec"`
+	TimestampUsec string         `json:"timestampUsec"`
+	Published     int64          `json:"published"`
+	Title         string         `json:"title"`
+	Author        string         `json:"author"`
+	Canonical     []*greaderLink `json:"canonical"`
+	Alternate     []*greaderLink `json:"alternate"`
+	Summary       struct {
+		Content string `json:"content"`
+	} `json:"summary"`
+	Categories []string `json:"categories"`
+	Origin     struct {
+		StreamID string `json:"streamId"`
+		Title    string `json:"title"`
+		HTMLURL  string `json:"htmlUrl"`
+	} `json:"origin"`
+}
+
+// items returns the items with ids, in the same order, fetched feverItemLimit
+// at a time
+func (gr *GReaderAPI) items(ctx context.Context, userID string, ids []int64) ([]*greaderItem, error) {
+	feedGroups, err := gr.feedGroups(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	feeds, err := gr.s.FeverFeeds(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	feedsByID := make(map[int64]*FeverFeed)
+	for _, f := range feeds {
+		feedsByID[f.ID] = f
+	}
+
+	byID := make(map[int64]*FeverItem)
+	for i := 0; i < len(ids); i += feverItemLimit {
+		end := i + feverItemLimit
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		fis, _, err := gr.s.FeverItems(ctx, userID, &FeverItemQuery{WithIDs: ids[i:end]})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, fi := range fis {
+			byID[fi.ID] = fi
+		}
+	}
+
+	items := make([]*greaderItem, 0, len(ids))
+	for _, id := range ids {
+		fi, ok := byID[id]
+		if !ok {
+			continue
+		}
+
+		postedAt := time.Unix(fi.CreatedOnTime, 0)
+		it := &greaderItem{
+			ID:            fmt.Sprintf("%s%016x", greaderItemPrefix, fi.ID),
+			CrawlTimeMsec: strconv.FormatInt(postedAt.UnixNano()/int64(time.Millisecond), 10),
+			TimestampUsec: usecString(postedAt),
+			Published:     fi.CreatedOnTime,
+			Title:         fi.Title,
+			Author:        fi.Author,
+			Canonical:     []*greaderLink{{Href: fi.URL}},
+			Alternate:     []*greaderLink{{Href: fi.URL, Type: "text/html"}},
+			Categories:    []string{greaderReadingList},
+		}
+		it.Summary.Content = fi.HTML
+		it.Origin.StreamID = greaderFeed + strconv.FormatInt(fi.FeedID, 10)
+		if f, ok := feedsByID[fi.FeedID]; ok {
+			it.Origin.Title = f.Title
+			it.Origin.HTMLURL = f.SiteURL
+		}
+		if g, ok := feedGroups[fi.FeedID]; ok {
+			it.Categories = append(it.Categories, greaderLabel+g.Title)
+		}
+		if fi.IsRead == 1 {
+			it.Categories = append(it.Categories, greaderRead)
+		}
+		if fi.IsSaved == 1 {
+			it.Categories = append(it.Categories, greaderStarred)
+		}
+
+		items = append(items, it)
+	}
+
+	return items, nil
+}
+
+// editTag adds and removes the read and starred states of items, labels can
+// not be given to single items so are left alone
+func (gr *GReaderAPI) editTag(ctx context.Context, w http.ResponseWriter, r *http.Request, userID string) error {
+	var marks []string
+	for _, a := range r.Form["a"] {
+		switch normalizeStream(a) {
+		case greaderRead:
+			marks = append(marks, "read")
+		case greaderStarred:
+			marks = append(marks, "saved")
+		case greaderKeptUnread:
+			marks = append(marks, "unread")
+		}
+	}
+	for _, rm := range r.Form["r"] {
+		switch normalizeStream(rm) {
+		case greaderRead:
+			marks = append(marks, "unread")
+		case greaderStarred:
+			marks = append(marks, "unsaved")
+		}
+	}
+
+	for _, i := range r.Form["i"] {
+		id := parseItemID(i)
+		if id == 0 {
+			return errors.New("invalid item id")
+		}
+
+		for _, as := range marks {
+			err := gr.s.FeverMarkItem(ctx, userID, id, as)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return writeGReaderText(w, "OK")
+}
+
+// markAllRead marks the items of a stream read, up to the newest the client
+// has seen
+func (gr *GReaderAPI) markAllRead(ctx context.Context, w http.ResponseWriter, r *http.Request, userID string) error {
+	before := time.Now()
+	if ts := parseID(r.Form.Get("ts")); ts > 0 {
+		before = time.Unix(0, ts*int64(time.Microsecond))
+	}
+
+	var q GReaderQuery
+	err := gr.narrow(ctx, &q, userID, r.Form.Get("s"))
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case q.Starred:
+		return errors.New("starred items can not be marked read together")
+	case q.FeedID != 0:
+		err = gr.s.FeverMarkRead(ctx, userID, "feed", q.FeedID, before)
+	default:
+		// group 0 is every feed, for the reading list
+		err = gr.s.FeverMarkRead(ctx, userID, "group", q.GroupID, before)
+	}
+	if err != nil {
+		return err
+	}
+
+	return writeGReaderText(w, "OK")
+}
+
+// parseItemID parses an item ID in either of the forms clients send, the long
+// form with a hexadecimal ID or the decimal short form. It is zero for neither
+func parseItemID(s string) int64 {
+	if strings.HasPrefix(s, greaderItemPrefix) {
+		n, _ := strconv.ParseUint(strings.TrimPrefix(s, greaderItemPrefix), 16, 64)
+		return int64(n)
+	}
+
+	return parseID(s)
+}
+
+// usecString formats t as microseconds, as clients are sent timestamps
+func usecString(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano()/int64(time.Microsecond), 10)
+}
+
+func writeGReader(w http.ResponseWriter, x interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(x)
+}
+
+func writeGReaderText(w http.ResponseWriter, s string) error {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, err := w.Write([]byte(s))
+	return err
+}
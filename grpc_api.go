@@ -0,0 +1,347 @@
+package hydrocarbon
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/fortytw2/hydrocarbon/rpc"
+)
+
+// grpcKeyHeader is the metadata the signed session key is sent in, as
+// X-Hydrocarbon-Key is over http
+const grpcKeyHeader = "x-hydrocarbon-key"
+
+// grpcWrites are the methods a read-only user can not call, as the http routes
+// wrapped with RequireWritable
+var grpcWrites = map[string]bool{
+	rpc.Feeds_CreateFolder_FullMethodName:  true,
+	rpc.Feeds_DeleteFolder_FullMethodName:  true,
+	rpc.Feeds_RestoreFolder_FullMethodName: true,
+	rpc.Feeds_AddFeed_FullMethodName:       true,
+	rpc.Feeds_RemoveFeed_FullMethodName:    true,
+	rpc.Feeds_RefreshFeed_FullMethodName:   true,
+}
+
+type grpcKey struct{}
+
+// GRPCAPI serves the Feeds and Reading services of rpc/hydrocarbon.proto, the
+// same calls the FeedAPI and ReadStatusAPI serve over http
+type GRPCAPI struct {
+	fa *FeedAPI
+	rs *ReadStatusAPI
+	ba *BillingAPI
+}
+
+// NewGRPCAPI returns a new GRPCAPI, ba may be nil to run without billing
+func NewGRPCAPI(fa *FeedAPI, rs *ReadStatusAPI, ba *BillingAPI) *GRPCAPI {
+	return &GRPCAPI{
+		fa: fa,
+		rs: rs,
+		ba: ba,
+	}
+}
+
+// Server returns a grpc.Server serving every service, every call to which is
+// authorized by the session key in its metadata
+func (ga *GRPCAPI) Server(opts ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(append(opts, grpc.ChainUnaryInterceptor(ga.authorize))...)
+	rpc.RegisterFeedsServer(s, &grpcFeeds{fa: ga.fa})
+	rpc.RegisterReadingServer(s, &grpcReading{fa: ga.fa, rs: ga.rs})
+
+	return s
+}
+
+// authorize verifies the session key of a call and passes it on in the
+// context, refusing writes from read-only users
+func (ga *GRPCAPI) authorize(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	keys := md.Get(grpcKeyHeader)
+	if len(keys) != 1 {
+		return nil, status.Error(codes.Unauthenticated, "no session key sent")
+	}
+
+	key, err := ga.fa.ks.Verify(keys[0])
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	if grpcWrites[info.FullMethod] && ga.ba != nil && ga.ba.paymentRequired {
+		bs, err := ga.ba.s.GetBillingStatus(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		if bs.ReadOnly() {
+			return nil, status.Error(codes.PermissionDenied, ErrReadOnly.Error())
+		}
+	}
+
+	return handler(context.WithValue(ctx, grpcKey{}, key), req)
+}
+
+// grpcSessionKey returns the session key authorize verified
+func grpcSessionKey(ctx context.Context) string {
+	key, _ := ctx.Value(grpcKey{}).(string)
+	return key
+}
+
+// grpcMissing is the error for a call missing a field it needs
+func grpcMissing(what string) error {
+	return status.Errorf(codes.InvalidArgument, "no %s sent", what)
+}
+
+type grpcFeeds struct {
+	rpc.UnimplementedFeedsServer
+
+	fa *FeedAPI
+}
+
+func (gf *grpcFeeds) ListFolders(ctx context.Context, req *rpc.ListFoldersRequest) (*rpc.ListFoldersResponse, error) {
+	folders, err := gf.fa.s.GetFoldersWithFeeds(ctx, grpcSessionKey(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &rpc.ListFoldersResponse{
+		Folders: make([]*rpc.Folder, len(folders)),
+	}
+	for i, f := range folders {
+		resp.Folders[i] = grpcFolder(f)
+	}
+
+	return resp, nil
+}
+
+func (gf *grpcFeeds) CreateFolder(ctx context.Context, req *rpc.CreateFolderRequest) (*rpc.Folder, error) {
+	id, err := gf.fa.s.AddFolder(ctx, grpcSessionKey(ctx), req.GetName())
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpc.Folder{Id: id, Title: req.GetName()}, nil
+}
+
+func (gf *grpcFeeds) DeleteFolder(ctx context.Context, req *rpc.DeleteFolderRequest) (*rpc.DeleteFolderResponse, error) {
+	if req.GetFolderId() == "" {
+		return nil, grpcMissing("folder ID")
+	}
+
+	err := gf.fa.s.SetFolderDeleted(ctx, grpcSessionKey(ctx), req.GetFolderId(), true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpc.DeleteFolderResponse{}, nil
+}
+
+func (gf *grpcFeeds) RestoreFolder(ctx context.Context, req *rpc.RestoreFolderRequest) (*rpc.RestoreFolderResponse, error) {
+	if req.GetFolderId() == "" {
+		return nil, grpcMissing("folder ID")
+	}
+
+	err := gf.fa.s.SetFolderDeleted(ctx, grpcSessionKey(ctx), req.GetFolderId(), false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpc.RestoreFolderResponse{}, nil
+}
+
+func (gf *grpcFeeds) AddFeed(ctx context.Context, req *rpc.AddFeedRequest) (*rpc.Feed, error) {
+	if req.GetUrl() == "" {
+		return nil, grpcMissing("url")
+	}
+
+	key := grpcSessionKey(ctx)
+	usage, err := gf.fa.s.GetPlanUsage(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if usage.Feeds >= usage.Plan.MaxFeeds {
+		return nil, status.Error(codes.ResourceExhausted, fmt.Sprintf("the %s plan is limited to %d feeds", usage.Plan.Name, usage.Plan.MaxFeeds))
+	}
+
+	id, title, feedStatus, err := gf.fa.addFeed(ctx, key, req.GetFolderId(), req.GetUrl())
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpc.Feed{Id: id, Title: title, Status: feedStatus}, nil
+}
+
+func (gf *grpcFeeds) RemoveFeed(ctx context.Context, req *rpc.RemoveFeedRequest) (*rpc.RemoveFeedResponse, error) {
+	if req.GetFeedId() == "" || req.GetFolderId() == "" {
+		return nil, grpcMissing("feed or folder ID")
+	}
+
+	err := gf.fa.s.RemoveFeed(ctx, grpcSessionKey(ctx), req.GetFolderId(), req.GetFeedId())
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpc.RemoveFeedResponse{}, nil
+}
+
+func (gf *grpcFeeds) RefreshFeed(ctx context.Context, req *rpc.RefreshFeedRequest) (*rpc.RefreshFeedResponse, error) {
+	if req.GetFeedId() == "" {
+		return nil, grpcMissing("feed ID")
+	}
+
+	err := gf.fa.s.RefreshFeed(ctx, grpcSessionKey(ctx), req.GetFeedId())
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpc.RefreshFeedResponse{}, nil
+}
+
+type grpcReading struct {
+	rpc.UnimplementedReadingServer
+
+	fa *FeedAPI
+	rs *ReadStatusAPI
+}
+
+func (gr *grpcReading) ListPosts(ctx context.Context, req *rpc.ListPostsRequest) (*rpc.Feed, error) {
+	if req.GetFeedId() == "" {
+		return nil, grpcMissing("feed ID")
+	}
+
+	// limited as GetFeed limits them
+	limit, offset := int(req.GetLimit()), int(req.GetOffset())
+	if limit == 0 {
+		limit = 50
+	}
+	if limit < 10 {
+		limit = 10
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	feed, err := gr.fa.s.GetFeedPosts(ctx, grpcSessionKey(ctx), req.GetFeedId(), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return grpcFeed(feed), nil
+}
+
+func (gr *grpcReading) GetPost(ctx context.Context, req *rpc.GetPostRequest) (*rpc.Post, error) {
+	if req.GetPostId() == "" {
+		return nil, grpcMissing("post ID")
+	}
+
+	p, err := gr.fa.s.GetPost(ctx, grpcSessionKey(ctx), req.GetPostId())
+	if err != nil {
+		return nil, err
+	}
+
+	return grpcPost(p), nil
+}
+
+func (gr *grpcReading) MarkRead(ctx context.Context, req *rpc.MarkReadRequest) (*rpc.MarkReadResponse, error) {
+	if req.GetPostId() == "" {
+		return nil, grpcMissing("post ID")
+	}
+
+	err := gr.rs.s.MarkRead(ctx, grpcSessionKey(ctx), req.GetPostId())
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpc.MarkReadResponse{}, nil
+}
+
+func (gr *grpcReading) StarPost(ctx context.Context, req *rpc.StarPostRequest) (*rpc.StarPostResponse, error) {
+	if req.GetPostId() == "" {
+		return nil, grpcMissing("post ID")
+	}
+
+	err := gr.rs.s.StarPost(ctx, grpcSessionKey(ctx), req.GetPostId(), req.GetStarred())
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpc.StarPostResponse{}, nil
+}
+
+// grpcTime converts t to a timestamp, nil if it is not set
+func grpcTime(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+
+	return timestamppb.New(t)
+}
+
+func grpcFolder(f *Folder) *rpc.Folder {
+	out := &rpc.Folder{
+		Id:    f.ID,
+		Title: f.Title,
+		Feeds: make([]*rpc.Feed, len(f.Feeds)),
+	}
+	for i, fe := range f.Feeds {
+		out.Feeds[i] = grpcFeed(fe)
+	}
+
+	return out
+}
+
+func grpcFeed(f *Feed) *rpc.Feed {
+	out := &rpc.Feed{
+		Id:         f.ID,
+		CreatedAt:  grpcTime(f.CreatedAt),
+		UpdatedAt:  grpcTime(f.UpdatedAt),
+		Title:      f.Title,
+		Plugin:     f.Plugin,
+		BaseUrl:    f.BaseURL,
+		Status:     f.Status,
+		ExternalId: f.ExternalID,
+		Unread:     int32(f.Unread),
+		Posts:      make([]*rpc.Post, len(f.Posts)),
+	}
+	for i, p := range f.Posts {
+		out.Posts[i] = grpcPost(p)
+	}
+
+	return out
+}
+
+func grpcPost(p *Post) *rpc.Post {
+	out := &rpc.Post{
+		Id:          p.ID,
+		CreatedAt:   grpcTime(p.CreatedAt),
+		PostedAt:    grpcTime(p.PostedAt),
+		UpdatedAt:   grpcTime(p.UpdatedAt),
+		OriginalUrl: p.OriginalURL,
+		Url:         p.URL,
+		ExternalId:  p.ExternalID,
+		Title:       p.Title,
+		Author:      p.Author,
+		Body:        p.Body,
+		License:     p.License,
+		Attribution: p.Attribution,
+		Read:        p.Read,
+		Starred:     p.Starred,
+		Backfilled:  p.Backfilled,
+		Tags:        p.Tags,
+	}
+	for _, s := range p.Sources {
+		out.Sources = append(out.Sources, &rpc.PostSource{
+			FeedId:    s.FeedID,
+			Url:       s.URL,
+			CreatedAt: grpcTime(s.CreatedAt),
+		})
+	}
+
+	return out
+}
@@ -0,0 +1,139 @@
+package hydrocarbon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// healthTimeout bounds how long a health check waits on the database, probes
+// of orchestrators usually give up after a few seconds
+const healthTimeout = 3 * time.Second
+
+// A HealthStore reports on the health of the database
+type HealthStore interface {
+	// Health returns an error if the database cannot be reached at all, or
+	// else how healthy it is
+	Health(ctx context.Context) (*Health, error)
+}
+
+// Health describes whether the database is fit to serve hydrocarbon
+type Health struct {
+	// PendingMigrations is the number of migrations not yet run, hydrocarbon
+	// expects none
+	PendingMigrations int              `json:"pending_migrations"`
+	Replicas          []*ReplicaHealth `json:"replicas,omitempty"`
+	// LastBackup is the latest backup that succeeded, if any has
+	LastBackup *Backup `json:"last_backup,omitempty"`
+}
+
+// ReplicaHealth describes a single read replica, replicas are numbered in the
+// order they are configured rather than named, as their DSNs hold passwords
+type ReplicaHealth struct {
+	Replica int  `json:"replica"`
+	Up      bool `json:"up"`
+	// LagSeconds is how far behind the primary the replica is
+	LagSeconds float64 `json:"lag_seconds"`
+	// Lagging replicas are too far behind to be read from until they catch up
+	Lagging bool   `json:"lagging,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// HealthAPI serves the health checks of orchestrators, outside of the rest of
+// the API so they are neither traced nor logged
+type HealthAPI struct {
+	s HealthStore
+	// backups older than maxBackupAge fail Backupz, if set
+	maxBackupAge time.Duration
+}
+
+// NewHealthAPI returns a new HealthAPI
+func NewHealthAPI(s HealthStore) *HealthAPI {
+	return &HealthAPI{
+		s: s,
+	}
+}
+
+// SetMaxBackupAge makes Backupz fail once the last backup that succeeded is
+// older than maxAge
+func (ha *HealthAPI) SetMaxBackupAge(maxAge time.Duration) {
+	ha.maxBackupAge = maxAge
+}
+
+// Healthz reports the instance healthy for as long as it serves requests, for
+// liveness probes. It does not check the database, as an outage would have
+// every instance restarted at once without fixing anything
+func (ha *HealthAPI) Healthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, nil, nil)
+}
+
+// Readyz reports the instance unready while the database cannot be reached or
+// has migrations pending, for readiness probes. Replicas lagging too far
+// behind are only read from once they catch up, so do not leave it unready
+func (ha *HealthAPI) Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+
+	h, err := ha.s.Health(ctx)
+	if err == nil {
+		err = ha.ready(h)
+	}
+
+	writeHealth(w, h, err)
+}
+
+// Backupz fails while no backup has succeeded within the max backup age, for
+// monitoring to alert on. It is kept apart from Readyz, a stale backup is no
+// reason to stop serving
+func (ha *HealthAPI) Backupz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+
+	h, err := ha.s.Health(ctx)
+	if err == nil && ha.maxBackupAge > 0 {
+		switch {
+		case h.LastBackup == nil:
+			err = errors.New("no backup has succeeded")
+		case time.Since(h.LastBackup.StartedAt) > ha.maxBackupAge:
+			err = fmt.Errorf("the last backup was taken %s ago", time.Since(h.LastBackup.StartedAt).Round(time.Minute))
+		}
+	}
+
+	writeHealth(w, h, err)
+}
+
+// ready returns why the database is not ready to serve, if it is not
+func (ha *HealthAPI) ready(h *Health) error {
+	if h.PendingMigrations > 0 {
+		return fmt.Errorf("%d migrations are pending", h.PendingMigrations)
+	}
+
+	return nil
+}
+
+// writeHealth writes out h, with a 503 and the error if err is set
+func writeHealth(w http.ResponseWriter, h *Health, err error) {
+	var s = struct {
+		Status string  `json:"status"`
+		Error  string  `json:"error,omitempty"`
+		Data   *Health `json:"data,omitempty"`
+	}{
+		Status: statusOK,
+		Data:   h,
+	}
+
+	code := http.StatusOK
+	if err != nil {
+		code = http.StatusServiceUnavailable
+		s.Status = statusError
+		s.Error = err.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(s)
+}
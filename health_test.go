@@ -0,0 +1,95 @@
+package hydrocarbon
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type stubHealthStore struct {
+	h   *Health
+	err error
+}
+
+func (s *stubHealthStore) Health(ctx context.Context) (*Health, error) {
+	return s.h, s.err
+}
+
+func TestHealthAPI(t *testing.T) {
+	t.Parallel()
+
+	lagging := &Health{Replicas: []*ReplicaHealth{{Replica: 0, Up: true, LagSeconds: 90, Lagging: true}}}
+
+	var cases = []struct {
+		name    string
+		s       *stubHealthStore
+		healthz int
+		readyz  int
+	}{
+		{"healthy", &stubHealthStore{h: &Health{}}, http.StatusOK, http.StatusOK},
+		// liveness never depends on the database
+		{"unreachable", &stubHealthStore{err: errors.New("connection refused")}, http.StatusOK, http.StatusServiceUnavailable},
+		{"pending-migrations", &stubHealthStore{h: &Health{PendingMigrations: 2}}, http.StatusOK, http.StatusServiceUnavailable},
+		{"lagging-replica", &stubHealthStore{h: lagging}, http.StatusOK, http.StatusOK},
+		{"replica-down", &stubHealthStore{h: &Health{Replicas: []*ReplicaHealth{{Replica: 0, Error: "down"}}}}, http.StatusOK, http.StatusOK},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			ha := NewHealthAPI(c.s)
+
+			w := httptest.NewRecorder()
+			ha.Healthz(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			if w.Code != c.healthz {
+				t.Errorf("expected /healthz to return %d, got %d: %s", c.healthz, w.Code, w.Body.String())
+			}
+
+			w = httptest.NewRecorder()
+			ha.Readyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if w.Code != c.readyz {
+				t.Errorf("expected /readyz to return %d, got %d: %s", c.readyz, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestBackupz(t *testing.T) {
+	t.Parallel()
+
+	recent := &Backup{StartedAt: time.Now().Add(-time.Hour), State: "ok"}
+	stale := &Backup{StartedAt: time.Now().Add(-72 * time.Hour), State: "ok"}
+
+	var cases = []struct {
+		name   string
+		h      *Health
+		maxAge time.Duration
+		code   int
+	}{
+		{"recent", &Health{LastBackup: recent}, 24 * time.Hour, http.StatusOK},
+		{"stale", &Health{LastBackup: stale}, 24 * time.Hour, http.StatusServiceUnavailable},
+		{"none", &Health{}, 24 * time.Hour, http.StatusServiceUnavailable},
+		{"unchecked", &Health{}, 0, http.StatusOK},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			ha := NewHealthAPI(&stubHealthStore{h: c.h})
+			ha.SetMaxBackupAge(c.maxAge)
+
+			w := httptest.NewRecorder()
+			ha.Backupz(w, httptest.NewRequest(http.MethodGet, "/backupz", nil))
+			if w.Code != c.code {
+				t.Errorf("expected /backupz to return %d, got %d: %s", c.code, w.Code, w.Body.String())
+			}
+		})
+	}
+}
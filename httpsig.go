@@ -0,0 +1,222 @@
+package hydrocarbon
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// signatures dated further than this from now are rejected, to limit replays
+const maxSignatureSkew = time.Hour
+
+var errInvalidHTTPSignature = errors.New("activitypub: invalid http signature")
+
+// signRequest signs req with the draft-cavage HTTP signatures used across the
+// fediverse, body is the exact body of req or nil for a GET
+func signRequest(req *http.Request, keyID string, key *rsa.PrivateKey, body []byte) error {
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+
+	headers := []string{"(request-target)", "host", "date"}
+	if body != nil {
+		sum := sha256.Sum256(body)
+		req.Header.Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(sum[:]))
+		headers = append(headers, "digest")
+	}
+
+	h := sha256.Sum256([]byte(signingString(req.Method, req.URL.RequestURI(), req.URL.Host, req.Header, headers)))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, h[:])
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Signature", `keyId="`+keyID+`",algorithm="rsa-sha256",headers="`+
+		strings.Join(headers, " ")+`",signature="`+base64.StdEncoding.EncodeToString(sig)+`"`)
+	return nil
+}
+
+// verifyRequest checks the signature of r, looking up the key it names with
+// pub. It returns the ID of the key that signed r
+func verifyRequest(r *http.Request, body []byte, pub func(keyID string) (*rsa.PublicKey, error)) (string, error) {
+	sig, err := parseSignature(r.Header.Get("Signature"))
+	if err != nil {
+		return "", err
+	}
+
+	// the date, and for requests with a body its digest, must be signed or
+	// the signature could be replayed onto anything
+	if !contains(sig.headers, "date") || (r.Method == http.MethodPost && !contains(sig.headers, "digest")) {
+		return "", errInvalidHTTPSignature
+	}
+
+	date, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil || time.Since(date) > maxSignatureSkew || time.Until(date) > maxSignatureSkew {
+		return "", errors.New("activitypub: signature date out of range")
+	}
+
+	if contains(sig.headers, "digest") && !digestMatches(r.Header.Get("Digest"), body) {
+		return "", errors.New("activitypub: digest does not match body")
+	}
+
+	key, err := pub(sig.keyID)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.Sum256([]byte(signingString(r.Method, r.URL.RequestURI(), r.Host, r.Header, sig.headers)))
+	err = rsa.VerifyPKCS1v15(key, crypto.SHA256, h[:], sig.signature)
+	if err != nil {
+		return "", errInvalidHTTPSignature
+	}
+
+	return sig.keyID, nil
+}
+
+func signingString(method, target, host string, h http.Header, headers []string) string {
+	lines := make([]string, len(headers))
+	for i, name := range headers {
+		switch name {
+		case "(request-target)":
+			lines[i] = name + ": " + strings.ToLower(method) + " " + target
+		case "host":
+			lines[i] = name + ": " + host
+		default:
+			lines[i] = name + ": " + h.Get(name)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+type httpSignature struct {
+	keyID     string
+	headers   []string
+	signature []byte
+}
+
+// parseSignature parses the comma separated key="value" pairs of a Signature
+// header
+func parseSignature(header string) (*httpSignature, error) {
+	params := make(map[string]string)
+	for header != "" {
+		eq := strings.IndexByte(header, '=')
+		if eq < 0 || len(header) < eq+2 || header[eq+1] != '"' {
+			return nil, errInvalidHTTPSignature
+		}
+		key := strings.TrimSpace(header[:eq])
+
+		end := strings.IndexByte(header[eq+2:], '"')
+		if end < 0 {
+			return nil, errInvalidHTTPSignature
+		}
+		params[key] = header[eq+2 : eq+2+end]
+
+		header = strings.TrimLeft(header[eq+2+end+1:], ", ")
+	}
+
+	switch params["algorithm"] {
+	case "", "rsa-sha256", "hs2019":
+	default:
+		return nil, errors.New("activitypub: unsupported signature algorithm " + params["algorithm"])
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(params["signature"])
+	if err != nil || params["keyId"] == "" {
+		return nil, errInvalidHTTPSignature
+	}
+
+	headers := strings.Fields(strings.ToLower(params["headers"]))
+	if len(headers) == 0 {
+		headers = []string{"date"}
+	}
+
+	return &httpSignature{
+		keyID:     params["keyId"],
+		headers:   headers,
+		signature: raw,
+	}, nil
+}
+
+func digestMatches(header string, body []byte) bool {
+	sum := sha256.Sum256(body)
+	want := base64.StdEncoding.EncodeToString(sum[:])
+
+	for _, d := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(d), "=", 2)
+		if len(kv) == 2 && strings.EqualFold(kv[0], "SHA-256") && kv[1] == want {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// generateActorKey returns a new PEM encoded RSA key, mastodon does not
+// support any other kind
+func generateActorKey() (string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})), nil
+}
+
+func parsePrivateKey(keyPEM string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, errors.New("activitypub: invalid private key")
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+func publicKeyPEM(key *rsa.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: der,
+	})), nil
+}
+
+func parsePublicKey(keyPEM string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, errors.New("activitypub: invalid public key")
+	}
+
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("activitypub: only rsa keys are supported")
+	}
+	return rsaKey, nil
+}
@@ -0,0 +1,63 @@
+package hydrocarbon
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPSignature(t *testing.T) {
+	t.Parallel()
+
+	keyPEM, err := generateActorKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := parsePrivateKey(keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubPEM, err := publicKeyPEM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub, err := parsePublicKey(pubPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := []byte(`{"type":"Follow"}`)
+	lookup := func(keyID string) (*rsa.PublicKey, error) {
+		return pub, nil
+	}
+
+	req := httptest.NewRequest("POST", "https://example.com/v1/activitypub/inbox?folder_id=x", bytes.NewReader(body))
+	err = signRequest(req, "https://remote.example/actor#main-key", key, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyID, err := verifyRequest(req, body, lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if keyID != "https://remote.example/actor#main-key" {
+		t.Errorf("unexpected key ID %s", keyID)
+	}
+
+	_, err = verifyRequest(req, []byte(`{"type":"Undo"}`), lookup)
+	if err == nil {
+		t.Error("expected a changed body to fail verification")
+	}
+
+	req.URL.RawQuery = "folder_id=y"
+	_, err = verifyRequest(req, body, lookup)
+	if err != errInvalidHTTPSignature {
+		t.Errorf("expected a changed target to fail verification, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package hydrocarbon
+
+import (
+	"crypto/rand"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IDs of posts and scrapes are version 7 UUIDs made here rather than by the
+// uuid_generate_v1mc() defaults of their columns. The first 48 bits of each are
+// the unix time in milliseconds it was made at, so new rows land at the end of
+// the primary key indexes instead of all over them, and IDs sort by when they
+// were made.
+//
+// Rows made before the switch keep the version 1 IDs they were given, which do
+// not sort by time, so nothing may rely on the order of IDs alone until every
+// such row is gone, order by created_at with the ID only breaking ties. The
+// column defaults are left in place for nodes still running an older version
+// during a rolling deploy.
+var ids struct {
+	mu   sync.Mutex
+	last int64
+	seq  uint16
+}
+
+// NewID returns a new version 7 UUID. IDs made by the same process are always
+// increasing, those made within the same millisecond are ordered by a counter
+// in the 12 bits after the timestamp
+func NewID() uuid.UUID {
+	var id uuid.UUID
+	// as for uuid.New, there is nothing to do when the system has no
+	// randomness left to give
+	_, err := rand.Read(id[:])
+	if err != nil {
+		panic(err)
+	}
+
+	ms, seq := nextIDTime(time.Now())
+	for i := 5; i >= 0; i-- {
+		id[i] = byte(ms)
+		ms >>= 8
+	}
+
+	id[6] = 0x70 | byte(seq>>8)&0x0f
+	id[7] = byte(seq)
+	// RFC 4122 variant
+	id[8] = id[8]&0x3f | 0x80
+
+	return id
+}
+
+// nextIDTime returns the millisecond and counter of the next ID, borrowing
+// from the next millisecond once the counter runs out or if the clock goes
+// backwards
+func nextIDTime(now time.Time) (int64, uint16) {
+	ids.mu.Lock()
+	defer ids.mu.Unlock()
+
+	ms := now.UnixNano() / int64(time.Millisecond)
+	if ms > ids.last {
+		ids.last = ms
+		ids.seq = 0
+		return ids.last, ids.seq
+	}
+
+	ids.seq++
+	if ids.seq > 0xfff {
+		ids.last++
+		ids.seq = 0
+	}
+
+	return ids.last, ids.seq
+}
@@ -0,0 +1,37 @@
+package hydrocarbon
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestNewID(t *testing.T) {
+	t.Parallel()
+
+	before := time.Now().UnixNano() / int64(time.Millisecond)
+
+	prev := NewID()
+	for i := 0; i < 10000; i++ {
+		id := NewID()
+		if id.Version() != 7 {
+			t.Fatalf("expected a version 7 UUID, got version %d", id.Version())
+		}
+		if id.Variant().String() != "RFC4122" {
+			t.Fatalf("expected the RFC 4122 variant, got %s", id.Variant())
+		}
+		if bytes.Compare(prev[:], id[:]) >= 0 {
+			t.Fatalf("expected IDs to increase, got %s after %s", id, prev)
+		}
+		prev = id
+	}
+
+	var ms int64
+	for _, b := range prev[:6] {
+		ms = ms<<8 | int64(b)
+	}
+	// 10000 IDs may borrow a few milliseconds ahead of the clock
+	if ms < before || ms > time.Now().Add(time.Second).UnixNano()/int64(time.Millisecond) {
+		t.Fatalf("expected the ID to start with the time it was made, got %d", ms)
+	}
+}
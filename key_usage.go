@@ -0,0 +1,193 @@
+package hydrocarbon
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	keyUsageFlushInterval = time.Minute
+	keyReminderInterval   = 24 * time.Hour
+
+	// keys older than keyRotationAge should be replaced
+	keyRotationAge = 90 * 24 * time.Hour
+	// keys unused for keyStaleAge should be revoked
+	keyStaleAge = 60 * 24 * time.Hour
+	// keyRemindEvery is how long to wait before reminding about a key again
+	keyRemindEvery = 30 * 24 * time.Hour
+)
+
+// KeyUsage is how many API calls were made with a key and when it was last used
+type KeyUsage struct {
+	Calls      int64
+	LastUsedAt time.Time
+}
+
+// A KeyReminder lists every key of a single user that is due to be rotated or
+// revoked
+type KeyReminder struct {
+	Email    string
+	Sessions []*Session
+}
+
+// A KeyUsageStore is an interface used to seperate the KeyUsageTracker from
+// knowledge of the actual underlying database
+type KeyUsageStore interface {
+	// RecordKeyUsage adds the given usage, by session key, to each session
+	RecordKeyUsage(ctx context.Context, usage map[string]*KeyUsage) error
+
+	// FindKeyReminders returns active keys older than rotateAfter or unused
+	// for staleAfter, skipping any reminded about within remindEvery
+	FindKeyReminders(ctx context.Context, rotateAfter, staleAfter, remindEvery time.Duration) ([]*KeyReminder, error)
+	MarkKeysReminded(ctx context.Context, sessionIDs []string) error
+}
+
+// A KeyUsageTracker counts API calls per key, buffering them in memory to
+// avoid a database write on every request, and emails users about keys that
+// are stale or have never been rotated
+type KeyUsageTracker struct {
+	s  KeyUsageStore
+	ks *KeySigner
+	m  Mailer
+
+	mu    sync.Mutex
+	usage map[string]*KeyUsage
+
+	shutdown chan chan struct{}
+}
+
+// NewKeyUsageTracker returns a new KeyUsageTracker
+func NewKeyUsageTracker(s KeyUsageStore, ks *KeySigner, m Mailer) *KeyUsageTracker {
+	return &KeyUsageTracker{
+		s:        s,
+		ks:       ks,
+		m:        m,
+		usage:    make(map[string]*KeyUsage),
+		shutdown: make(chan chan struct{}),
+	}
+}
+
+// Middleware records a call against the key of every signed request
+func (kt *KeyUsageTracker) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h := r.Header.Get("X-Hydrocarbon-Key"); h != "" {
+			key, err := kt.ks.Verify(h)
+			if err == nil {
+				kt.record(key)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (kt *KeyUsageTracker) record(key string) {
+	kt.mu.Lock()
+	defer kt.mu.Unlock()
+
+	ku, ok := kt.usage[key]
+	if !ok {
+		ku = &KeyUsage{}
+		kt.usage[key] = ku
+	}
+
+	ku.Calls++
+	ku.LastUsedAt = time.Now()
+}
+
+// Start launches the tracker, it blocks until Stop is called
+func (kt *KeyUsageTracker) Start() error {
+	flush := time.NewTicker(keyUsageFlushInterval)
+	remind := time.NewTicker(keyReminderInterval)
+
+	for {
+		select {
+		case a := <-kt.shutdown:
+			flush.Stop()
+			remind.Stop()
+			kt.flush()
+			a <- struct{}{}
+			return nil
+		case <-flush.C:
+			kt.flush()
+		case <-remind.C:
+			err := kt.sendReminders(context.TODO())
+			if err != nil {
+				log.Println("hydrocarbon: key reminders:", err)
+			}
+		}
+	}
+}
+
+// Stop flushes any buffered usage and blocks until the tracker is shutdown
+func (kt *KeyUsageTracker) Stop() {
+	c := make(chan struct{})
+	kt.shutdown <- c
+	<-c
+}
+
+func (kt *KeyUsageTracker) flush() {
+	kt.mu.Lock()
+	usage := kt.usage
+	kt.usage = make(map[string]*KeyUsage)
+	kt.mu.Unlock()
+
+	if len(usage) == 0 {
+		return
+	}
+
+	err := kt.s.RecordKeyUsage(context.TODO(), usage)
+	if err != nil {
+		log.Println("hydrocarbon: could not record key usage:", err)
+	}
+}
+
+func (kt *KeyUsageTracker) sendReminders(ctx context.Context) error {
+	reminders, err := kt.s.FindKeyReminders(ctx, keyRotationAge, keyStaleAge, keyRemindEvery)
+	if err != nil {
+		return err
+	}
+
+	for _, kr := range reminders {
+		err = kt.m.Send(kr.Email, "Review your Hydrocarbon API keys", reminderBody(kr, kt.m.RootDomain()))
+		if err != nil {
+			return err
+		}
+
+		ids := make([]string, len(kr.Sessions))
+		for i, s := range kr.Sessions {
+			ids[i] = s.ID
+		}
+
+		err = kt.s.MarkKeysReminded(ctx, ids)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func reminderBody(kr *KeyReminder, domain string) string {
+	var buf bytes.Buffer
+	buf.WriteString(`The following API keys are either more than 90 days old or have not been used in 60 days:<ul>`)
+
+	for _, s := range kr.Sessions {
+		lastUsed := "never used"
+		if s.LastUsedAt != nil {
+			lastUsed = "last used " + s.LastUsedAt.Format("Jan 2, 2006")
+		}
+
+		fmt.Fprintf(&buf, `<li>%s, created %s, %s</li>`, html.EscapeString(s.UserAgent), s.CreatedAt.Format("Jan 2, 2006"), lastUsed)
+	}
+
+	fmt.Fprintf(&buf, `</ul>Visit <a href="%[1]s/settings">%[1]s/settings</a> to rotate or revoke them`, domain)
+
+	return buf.String()
+}
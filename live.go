@@ -0,0 +1,132 @@
+package hydrocarbon
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// livePath is opened with a GET, as every websocket is
+	livePath = "/ws"
+
+	// liveWriteWait is how long a client may take to receive a message
+	// before it is dropped
+	liveWriteWait = 10 * time.Second
+	// livePingInterval is how often clients are pinged, connections that do
+	// not answer a ping before the next is sent are closed
+	livePingInterval = 30 * time.Second
+)
+
+// LiveAPI pushes changes to the feeds a user follows over a websocket, new
+// posts, finished scrapes and posts read from their other sessions, so clients
+// can refresh what they show as it changes
+type LiveAPI struct {
+	s        ChangeStore
+	ks       *KeySigner
+	upgrader websocket.Upgrader
+}
+
+// NewLiveAPI returns a new LiveAPI, accepting websockets opened from pages on
+// domain or by clients that send no origin
+func NewLiveAPI(s ChangeStore, ks *KeySigner, domain string) *LiveAPI {
+	return &LiveAPI{
+		s:  s,
+		ks: ks,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				origin := r.Header.Get("Origin")
+				if origin == "" || origin == domain {
+					return true
+				}
+
+				u, err := url.Parse(origin)
+				return err == nil && u.Host == r.Host
+			},
+		},
+	}
+}
+
+// Serve upgrades the request to a websocket and writes every change to it as
+// JSON until either side closes it. Browsers can not set headers on websockets,
+// so the key may be sent as the key query parameter instead
+func (la *LiveAPI) Serve(w http.ResponseWriter, r *http.Request) error {
+	signed := r.Header.Get("X-Hydrocarbon-Key")
+	if signed == "" {
+		signed = r.URL.Query().Get("key")
+	}
+
+	key, err := la.ks.Verify(signed)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	changes, err := la.s.SubscribeChanges(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	conn, err := la.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already replied with the error
+		return nil
+	}
+	defer conn.Close()
+
+	// clients send nothing but pongs and closes, which are only handled
+	// while reading
+	conn.SetReadLimit(512)
+	conn.SetReadDeadline(time.Now().Add(livePingInterval + liveWriteWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(livePingInterval + liveWriteWait))
+	})
+	go func() {
+		defer cancel()
+		for {
+			_, _, err := conn.NextReader()
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(livePingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case c, ok := <-changes:
+			// closed once the client has gone
+			if !ok {
+				return nil
+			}
+
+			if c.Kind == ChangeScrape && !scrapeFinished(c.State) {
+				continue
+			}
+
+			conn.SetWriteDeadline(time.Now().Add(liveWriteWait))
+			err = conn.WriteJSON(c)
+			if err != nil {
+				return nil
+			}
+		case <-ping.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(liveWriteWait))
+			if err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// scrapeFinished is whether a scrape in state will not run again by itself,
+// those waiting after an error are retried
+func scrapeFinished(state string) bool {
+	return state == "SUCCESS" || state == "DEAD"
+}
@@ -0,0 +1,179 @@
+package memstore
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+// SetFolderPublic publishes or hides one of a users folders, a folder made
+// public only delivers posts created from then on
+func (s *Store) SetFolderPublic(ctx context.Context, sessionKey, folderID string, public bool, privateKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userFor(sessionKey)
+	if err != nil {
+		return errors.New("folder not found")
+	}
+
+	fo, ok := s.folders[folderID]
+	if !ok || fo.userID != u.id {
+		return errors.New("folder not found")
+	}
+
+	if fo.actorKey == "" {
+		fo.actorKey = privateKey
+	}
+	if public && !fo.public {
+		fo.deliveredAt = time.Now()
+	}
+	fo.public = public
+
+	return nil
+}
+
+// publicFolder returns a folder as it is published
+func publicFolder(fo *folder) *hydrocarbon.PublicFolder {
+	return &hydrocarbon.PublicFolder{
+		ID:          fo.id,
+		Name:        fo.name,
+		CreatedAt:   fo.createdAt,
+		DeliveredAt: fo.deliveredAt,
+		PrivateKey:  fo.actorKey,
+	}
+}
+
+// GetPublicFolder returns a public folder with its actor key
+func (s *Store) GetPublicFolder(ctx context.Context, folderID string) (*hydrocarbon.PublicFolder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fo, ok := s.folders[folderID]
+	if !ok || !fo.public || fo.actorKey == "" || !fo.deletedAt.IsZero() {
+		return nil, errors.New("no public folder found")
+	}
+
+	return publicFolder(fo), nil
+}
+
+// ListPublicFolders returns every public folder with at least one follower
+func (s *Store) ListPublicFolders(ctx context.Context) ([]*hydrocarbon.PublicFolder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	folders := make([]*hydrocarbon.PublicFolder, 0)
+	for _, fo := range s.folders {
+		if fo.public && fo.actorKey != "" && fo.deletedAt.IsZero() && len(s.followers[fo.id]) > 0 {
+			folders = append(folders, publicFolder(fo))
+		}
+	}
+
+	return folders, nil
+}
+
+// GetFolderPosts returns the posts of every feed in a folder created between
+// after and before, newest first
+func (s *Store) GetFolderPosts(ctx context.Context, folderID string, after, before time.Time, limit int) ([]*hydrocarbon.Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	feeds := make(map[string]bool)
+	for f := range s.follows {
+		if f.folderID == folderID {
+			feeds[f.feedID] = true
+		}
+	}
+
+	posts := make([]*hydrocarbon.Post, 0)
+	for _, p := range s.posts {
+		if !feeds[p.feedID] || s.hidden(p) || !p.CreatedAt.After(after) || !p.CreatedAt.Before(before) {
+			continue
+		}
+
+		posts = append(posts, &hydrocarbon.Post{
+			ID:          p.ID,
+			CreatedAt:   p.CreatedAt,
+			PostedAt:    p.PostedAt,
+			Title:       p.Title,
+			Author:      p.Author,
+			OriginalURL: p.OriginalURL,
+		})
+	}
+
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].CreatedAt.After(posts[j].CreatedAt)
+	})
+
+	start, end := pageOf(len(posts), limit, 0)
+	return posts[start:end], nil
+}
+
+// ClaimDelivery moves delivered_at forward if no other node has already
+func (s *Store) ClaimDelivery(ctx context.Context, folderID string, from, to time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fo, ok := s.folders[folderID]
+	if !ok || !fo.deliveredAt.Equal(from) {
+		return false, nil
+	}
+
+	fo.deliveredAt = to
+	return true, nil
+}
+
+// AddFollower records a remote actor following a folder, following again
+// updates their inbox
+func (s *Store) AddFollower(ctx context.Context, folderID string, f *hydrocarbon.Follower) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, known := range s.followers[folderID] {
+		if known.Actor == f.Actor {
+			known.Inbox = f.Inbox
+			return nil
+		}
+	}
+
+	s.followers[folderID] = append(s.followers[folderID], &hydrocarbon.Follower{
+		Actor: f.Actor,
+		Inbox: f.Inbox,
+	})
+
+	return nil
+}
+
+// RemoveFollower removes a remote actor from the followers of a folder
+func (s *Store) RemoveFollower(ctx context.Context, folderID, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	followers := s.followers[folderID][:0]
+	for _, f := range s.followers[folderID] {
+		if f.Actor != actor {
+			followers = append(followers, f)
+		}
+	}
+	s.followers[folderID] = followers
+
+	return nil
+}
+
+// ListFollowers returns every remote actor following a folder, in the order
+// they followed it
+func (s *Store) ListFollowers(ctx context.Context, folderID string) ([]*hydrocarbon.Follower, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	followers := make([]*hydrocarbon.Follower, 0, len(s.followers[folderID]))
+	for _, f := range s.followers[folderID] {
+		cp := *f
+		followers = append(followers, &cp)
+	}
+
+	return followers, nil
+}
@@ -0,0 +1,419 @@
+package memstore
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fortytw2/hydrocarbon"
+	"github.com/fortytw2/hydrocarbon/discollect"
+)
+
+// VerifyAdmin checks that the session belongs to an admin user
+func (s *Store) VerifyAdmin(ctx context.Context, sessionKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userFor(sessionKey)
+	if err != nil {
+		return err
+	}
+
+	if !u.admin {
+		return errors.New("admin access required")
+	}
+
+	return nil
+}
+
+// CreateAnnouncement stores a new announcement
+func (s *Store) CreateAnnouncement(ctx context.Context, a *hydrocarbon.Announcement) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp := *a
+	cp.ID = uuid.New().String()
+	cp.CreatedAt = time.Now()
+	s.announcements[cp.ID] = &cp
+
+	return cp.ID, nil
+}
+
+// UpdateAnnouncement replaces the contents of an announcement
+func (s *Store) UpdateAnnouncement(ctx context.Context, a *hydrocarbon.Announcement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	known, ok := s.announcements[a.ID]
+	if !ok {
+		return errors.New("announcement not found")
+	}
+
+	known.Title = a.Title
+	known.Body = a.Body
+	known.StartsAt = a.StartsAt
+	known.EndsAt = a.EndsAt
+
+	return nil
+}
+
+// DeleteAnnouncement removes an announcement and every record of it being seen
+func (s *Store) DeleteAnnouncement(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.announcements[id]; !ok {
+		return errors.New("announcement not found")
+	}
+
+	delete(s.announcements, id)
+	for k := range s.views {
+		if k[1] == id {
+			delete(s.views, k)
+		}
+	}
+
+	return nil
+}
+
+// ListAnnouncements lists every announcement, newest first
+func (s *Store) ListAnnouncements(ctx context.Context, limit, offset int) ([]*hydrocarbon.Announcement, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]*hydrocarbon.Announcement, 0, len(s.announcements))
+	for _, a := range s.announcements {
+		cp := *a
+		out = append(out, &cp)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].CreatedAt.After(out[j].CreatedAt)
+	})
+
+	start, end := pageOf(len(out), limit, offset)
+	return out[start:end], nil
+}
+
+// GetUnseenAnnouncements returns all currently running announcements the user
+// has not yet marked as seen
+func (s *Store) GetUnseenAnnouncements(ctx context.Context, sessionKey string) ([]*hydrocarbon.Announcement, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var userID string
+	if u, err := s.userFor(sessionKey); err == nil {
+		userID = u.id
+	}
+
+	now := time.Now()
+	out := make([]*hydrocarbon.Announcement, 0)
+	for _, a := range s.announcements {
+		if a.StartsAt.After(now) || (a.EndsAt != nil && !a.EndsAt.After(now)) {
+			continue
+		}
+		if s.views[[2]string{userID, a.ID}] {
+			continue
+		}
+
+		cp := *a
+		out = append(out, &cp)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].StartsAt.After(out[j].StartsAt)
+	})
+
+	return out, nil
+}
+
+// MarkAnnouncementSeen records that the user has seen an announcement
+func (s *Store) MarkAnnouncementSeen(ctx context.Context, sessionKey, announcementID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userFor(sessionKey)
+	if err != nil {
+		return err
+	}
+
+	s.views[[2]string{u.id, announcementID}] = true
+	return nil
+}
+
+// ListNodes returns every node that has heartbeated within the given window,
+// most recently started first
+func (s *Store) ListNodes(ctx context.Context, within time.Duration) ([]*discollect.Node, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	since := time.Now().Add(-within)
+
+	nodes := make([]*discollect.Node, 0)
+	for _, n := range s.nodes {
+		if n.HeartbeatAt.After(since) {
+			cp := *n
+			nodes = append(nodes, &cp)
+		}
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].StartedAt.After(nodes[j].StartedAt)
+	})
+
+	return nodes, nil
+}
+
+// SetNodeDraining drains or resumes a node, which picks up the change on its
+// next heartbeat
+func (s *Store) SetNodeDraining(ctx context.Context, id string, draining bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nodeID, err := uuid.Parse(id)
+	if err != nil {
+		return errors.New("no node exists with that id")
+	}
+
+	n, ok := s.nodes[nodeID]
+	if !ok {
+		return errors.New("no node exists with that id")
+	}
+
+	n.Draining = draining
+	return nil
+}
+
+// SetFeedDeleted deletes or restores a feed for every user following it
+func (s *Store) SetFeedDeleted(ctx context.Context, feedID string, deleted bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.feeds[feedID]
+	if !ok || f.deletedAt.IsZero() != deleted {
+		return errFeedNotFound
+	}
+
+	f.deletedAt = time.Time{}
+	if deleted {
+		f.deletedAt = time.Now()
+	}
+
+	return nil
+}
+
+// SetPostDeleted deletes or restores a post for every user
+func (s *Store) SetPostDeleted(ctx context.Context, postID string, deleted bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.posts[postID]
+	if !ok || p.deletedAt.IsZero() != deleted {
+		return errors.New("post not found")
+	}
+
+	p.deletedAt = time.Time{}
+	if deleted {
+		p.deletedAt = time.Now()
+	}
+
+	return nil
+}
+
+// GetTableStats returns the number of rows kept in each map, as there is no
+// size or bloat to speak of
+func (s *Store) GetTableStats(ctx context.Context) ([]*hydrocarbon.TableStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var logs int
+	for _, entries := range s.logs {
+		logs += len(entries)
+	}
+
+	rows := map[string]int{
+		"announcements":  len(s.announcements),
+		"feeds":          len(s.feeds),
+		"folders":        len(s.folders),
+		"nodes":          len(s.nodes),
+		"plugin_quality": len(s.quality),
+		"posts":          len(s.posts),
+		"scrape_logs":    logs,
+		"scrapes":        len(s.scrapes),
+		"sessions":       len(s.sessions),
+		"users":          len(s.users),
+	}
+
+	stats := make([]*hydrocarbon.TableStats, 0, len(rows))
+	for name, n := range rows {
+		stats = append(stats, &hydrocarbon.TableStats{
+			Name:     name,
+			LiveRows: int64(n),
+		})
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+
+	return stats, nil
+}
+
+// RequeueScrape moves a DEAD scrape back to WAITING with its errors cleared,
+// so it is started again straight away
+func (s *Store) RequeueScrape(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sc, ok := s.scrapes[id]
+	if !ok || sc.State != "DEAD" {
+		return errors.New("scrape not found or not dead")
+	}
+
+	s.requeue(sc)
+	return nil
+}
+
+// RequeueDeadScrapes requeues every DEAD scrape of plugin, or every DEAD
+// scrape if plugin is empty, returning their ids
+func (s *Store) RequeueDeadScrapes(ctx context.Context, plugin string) ([]uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []uuid.UUID
+	for _, sc := range s.scrapes {
+		if sc.State != "DEAD" || (plugin != "" && sc.Plugin != plugin) {
+			continue
+		}
+
+		s.requeue(sc)
+		ids = append(ids, sc.ID)
+	}
+
+	return ids, nil
+}
+
+// requeue schedules a scrape to start again right away, as if it were new
+func (s *Store) requeue(sc *discollect.Scrape) {
+	s.setState(sc, "WAITING")
+	sc.Errors = []string{}
+	sc.LastFailedURL = ""
+	sc.ScheduledStartAt = time.Now()
+}
+
+// qualityKey is the plugin and the date of a day of quality metrics
+func qualityKey(plugin string, day time.Time) string {
+	return plugin + "/" + day.Format("2006-01-02")
+}
+
+// QualitySampled returns true if quality metrics exist for the given day
+func (s *Store) QualitySampled(ctx context.Context, day time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	date := day.Format("2006-01-02")
+	for _, q := range s.quality {
+		if q.Day.Format("2006-01-02") == date {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// SamplePosts returns up to n random posts per plugin created in the 24 hours
+// after day
+func (s *Store) SamplePosts(ctx context.Context, day time.Time, n int) (map[string][]*hydrocarbon.Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	end := day.Add(24 * time.Hour)
+
+	posts := make(map[string][]*hydrocarbon.Post)
+	for _, p := range s.posts {
+		if p.CreatedAt.Before(day) || !p.CreatedAt.Before(end) {
+			continue
+		}
+
+		plugin := s.feeds[p.feedID].Plugin
+		posts[plugin] = append(posts[plugin], &hydrocarbon.Post{
+			Title:  p.Title,
+			Author: p.Author,
+			Body:   p.Body,
+		})
+	}
+
+	for plugin, pp := range posts {
+		rand.Shuffle(len(pp), func(i, j int) {
+			pp[i], pp[j] = pp[j], pp[i]
+		})
+		if len(pp) > n {
+			posts[plugin] = pp[:n]
+		}
+	}
+
+	return posts, nil
+}
+
+// RecordQuality saves quality metrics, replacing any already recorded for the
+// same plugin and day
+func (s *Store) RecordQuality(ctx context.Context, pq []*hydrocarbon.PluginQuality) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, q := range pq {
+		cp := *q
+		cp.Day = time.Date(q.Day.Year(), q.Day.Month(), q.Day.Day(), 0, 0, 0, 0, time.UTC)
+		s.quality[qualityKey(q.Plugin, q.Day)] = &cp
+	}
+
+	return nil
+}
+
+// Health always reports a healthy store, there is nothing to reach or migrate
+func (s *Store) Health(ctx context.Context) (*hydrocarbon.Health, error) {
+	return &hydrocarbon.Health{}, nil
+}
+
+// GetPruneStats returns no pruned posts, as posts are only ever pruned by the
+// postgres maintainer
+func (s *Store) GetPruneStats(ctx context.Context, since time.Time) ([]*hydrocarbon.PruneStats, error) {
+	return make([]*hydrocarbon.PruneStats, 0), nil
+}
+
+// ListBackups always returns no backups, there is nothing to back up
+func (s *Store) ListBackups(ctx context.Context, limit, offset int) ([]*hydrocarbon.Backup, error) {
+	return make([]*hydrocarbon.Backup, 0), nil
+}
+
+// GetQualityTrend returns the daily quality metrics recorded since the given
+// time, oldest first, optionally only for a single plugin
+func (s *Store) GetQualityTrend(ctx context.Context, since time.Time, plugin string) ([]*hydrocarbon.PluginQuality, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	since = time.Date(since.Year(), since.Month(), since.Day(), 0, 0, 0, 0, time.UTC)
+
+	trend := make([]*hydrocarbon.PluginQuality, 0)
+	for _, q := range s.quality {
+		if q.Day.Before(since) || (plugin != "" && q.Plugin != plugin) {
+			continue
+		}
+
+		cp := *q
+		trend = append(trend, &cp)
+	}
+
+	sort.Slice(trend, func(i, j int) bool {
+		if !trend[i].Day.Equal(trend[j].Day) {
+			return trend[i].Day.Before(trend[j].Day)
+		}
+		return trend[i].Plugin < trend[j].Plugin
+	})
+
+	return trend, nil
+}
@@ -0,0 +1,116 @@
+package memstore
+
+import (
+	"context"
+
+	"github.com/fortytw2/hydrocarbon"
+	"github.com/fortytw2/hydrocarbon/discollect"
+)
+
+// changeBuffer is how many changes a subscriber may fall behind by before
+// further changes are dropped, as in postgres
+const changeBuffer = 64
+
+// a changeSub is sent the changes to the feeds a user follows
+type changeSub struct {
+	userID string
+	c      chan *hydrocarbon.Change
+}
+
+// SubscribeChanges returns the changes to the feeds the user follows until ctx
+// is done
+func (s *Store) SubscribeChanges(ctx context.Context, sessionKey string) (<-chan *hydrocarbon.Change, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userFor(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &changeSub{
+		userID: u.id,
+		c:      make(chan *hydrocarbon.Change, changeBuffer),
+	}
+	s.subs[sub] = true
+
+	go func() {
+		<-ctx.Done()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		delete(s.subs, sub)
+		close(sub.c)
+	}()
+
+	return sub.c, nil
+}
+
+// notify sends c to every subscriber following its feed, or only to userID if
+// set, without waiting on any of them
+func (s *Store) notify(userID string, c *hydrocarbon.Change) {
+	for sub := range s.subs {
+		if userID != "" && sub.userID != userID {
+			continue
+		}
+
+		if userID == "" && !s.followedBy(sub.userID, c.FeedID) {
+			continue
+		}
+
+		sc := *c
+		select {
+		case sub.c <- &sc:
+		default:
+		}
+	}
+}
+
+// notifyPost notifies that p was written
+func (s *Store) notifyPost(p *post) {
+	s.notify("", &hydrocarbon.Change{Kind: hydrocarbon.ChangePost, ID: p.ID, FeedID: p.feedID})
+}
+
+// setState moves a scrape to state, notifying if it changed
+func (s *Store) setState(sc *discollect.Scrape, state string) {
+	if sc.State == state {
+		return
+	}
+
+	sc.State = state
+	s.notify("", &hydrocarbon.Change{Kind: hydrocarbon.ChangeScrape, ID: sc.ID.String(), FeedID: sc.FeedID.String(), State: state})
+}
+
+// setRead marks a post read or unread for the user, notifying them if it was
+// not already
+func (s *Store) setRead(userID, postID string, read bool) {
+	k := [2]string{userID, postID}
+	if s.reads[k] == read {
+		return
+	}
+
+	state := "unread"
+	if read {
+		s.reads[k] = true
+		state = "read"
+	} else {
+		delete(s.reads, k)
+	}
+
+	if p, ok := s.posts[postID]; ok {
+		s.notify(userID, &hydrocarbon.Change{Kind: hydrocarbon.ChangeRead, ID: postID, FeedID: p.feedID, State: state})
+	}
+}
+
+// addFollow adds fl, notifying its user
+func (s *Store) addFollow(fl follow) {
+	s.follows[fl] = true
+	s.notify(fl.userID, &hydrocarbon.Change{Kind: hydrocarbon.ChangeFollow, FeedID: fl.feedID})
+}
+
+// removeFollow removes fl, notifying its user
+func (s *Store) removeFollow(fl follow) {
+	delete(s.follows, fl)
+	s.notify(fl.userID, &hydrocarbon.Change{Kind: hydrocarbon.ChangeFollow, FeedID: fl.feedID})
+}
@@ -0,0 +1,137 @@
+package memstore
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+// SetFolderExportToken sets the token a folder is exported at, an empty token
+// stops exporting it
+func (s *Store) SetFolderExportToken(ctx context.Context, sessionKey, folderID, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userFor(sessionKey)
+	if err != nil {
+		return errors.New("folder not found")
+	}
+
+	fo, ok := s.folders[folderID]
+	if !ok || fo.userID != u.id || !fo.deletedAt.IsZero() {
+		return errors.New("folder not found")
+	}
+
+	fo.exportToken = token
+	return nil
+}
+
+// GetExportFolder returns the folder exported at token
+func (s *Store) GetExportFolder(ctx context.Context, token string) (*hydrocarbon.ExportFolder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, fo := range s.folders {
+		if token != "" && fo.exportToken == token && fo.deletedAt.IsZero() {
+			return &hydrocarbon.ExportFolder{
+				ID:        fo.id,
+				Name:      fo.name,
+				CreatedAt: fo.createdAt,
+			}, nil
+		}
+	}
+
+	return nil, errors.New("no exported folder found")
+}
+
+// GetExportPosts returns the newest posts in the feeds of a folder with their
+// bodies, as the owner of the folder sees them
+func (s *Store) GetExportPosts(ctx context.Context, folderID string, limit int) ([]*hydrocarbon.Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fo, ok := s.folders[folderID]
+	if !ok {
+		return nil, errors.New("folder not found")
+	}
+
+	posts := make([]*hydrocarbon.Post, 0)
+	for _, p := range s.posts {
+		if !s.follows[follow{userID: fo.userID, folderID: folderID, feedID: p.feedID}] || s.hidden(p) {
+			continue
+		}
+
+		posts = append(posts, exportPost(s.view(fo.userID, p)))
+	}
+
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].CreatedAt.After(posts[j].CreatedAt)
+	})
+
+	start, end := pageOf(len(posts), limit, 0)
+	return posts[start:end], nil
+}
+
+// FeedFollower returns the ID of the user of sessionKey if they follow the feed
+func (s *Store) FeedFollower(ctx context.Context, sessionKey, feedID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userFor(sessionKey)
+	if err != nil {
+		return "", err
+	}
+
+	if !s.followedBy(u.id, feedID) {
+		return "", errFeedNotFound
+	}
+
+	return u.id, nil
+}
+
+// GetExportFeed returns a feed the user follows with its newest posts and their
+// bodies, as they see them
+func (s *Store) GetExportFeed(ctx context.Context, userID, feedID string, limit int) (*hydrocarbon.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.feeds[feedID]
+	if !ok || s.feedDeleted(feedID) || !s.followedBy(userID, feedID) {
+		return nil, errFeedNotFound
+	}
+
+	posts := make([]*hydrocarbon.Post, 0)
+	for _, p := range s.posts {
+		if (p.feedID == feedID || p.sourcedFrom(feedID)) && !s.hidden(p) {
+			posts = append(posts, exportPost(s.view(userID, p)))
+		}
+	}
+
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].CreatedAt.After(posts[j].CreatedAt)
+	})
+
+	start, end := pageOf(len(posts), limit, 0)
+	return &hydrocarbon.Feed{
+		ID:      f.ID,
+		Title:   f.Title,
+		BaseURL: f.BaseURL,
+		Posts:   posts[start:end],
+	}, nil
+}
+
+// exportPost returns the parts of v that are exported
+func exportPost(v *hydrocarbon.Post) *hydrocarbon.Post {
+	return &hydrocarbon.Post{
+		ID:          v.ID,
+		CreatedAt:   v.CreatedAt,
+		UpdatedAt:   v.UpdatedAt,
+		PostedAt:    v.PostedAt,
+		OriginalURL: v.OriginalURL,
+		Title:       v.Title,
+		Author:      v.Author,
+		Body:        v.Body,
+	}
+}
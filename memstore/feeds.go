@@ -0,0 +1,764 @@
+package memstore
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fortytw2/hydrocarbon"
+	"github.com/fortytw2/hydrocarbon/discollect"
+)
+
+type folder struct {
+	id        string
+	userID    string
+	name      string
+	createdAt time.Time
+
+	public      bool
+	actorKey    string
+	deliveredAt time.Time
+
+	exportToken string
+
+	// deletedAt is zero unless the folder has been deleted
+	deletedAt time.Time
+}
+
+type feed struct {
+	hydrocarbon.Feed
+	// newsletter feeds are private to the user they are delivered to
+	public   bool
+	schedule *discollect.ScheduleSpec
+
+	resolveAttempts int
+	resolveError    string
+
+	// deletedAt is zero unless the feed has been deleted
+	deletedAt time.Time
+}
+
+// a follow is a feed in the folder of a user
+type follow struct {
+	userID   string
+	folderID string
+	feedID   string
+}
+
+// followedBy returns true if the user has the feed in any of their folders
+func (s *Store) followedBy(userID, feedID string) bool {
+	for f := range s.follows {
+		if f.userID == userID && f.feedID == feedID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// followersOf returns the IDs of every user following a feed
+func (s *Store) followersOf(feedID string) []string {
+	ids := make(map[string]bool)
+	for f := range s.follows {
+		if f.feedID == feedID {
+			ids[f.userID] = true
+		}
+	}
+
+	return sortedKeys(ids)
+}
+
+// followedFeed returns a feed the user of the session follows
+func (s *Store) followedFeed(sessionKey, feedID string) (*user, *feed, error) {
+	u, err := s.userFor(sessionKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, ok := s.feeds[feedID]
+	if !ok || !f.deletedAt.IsZero() || !s.followedBy(u.id, feedID) {
+		return nil, nil, errFeedNotFound
+	}
+
+	return u, f, nil
+}
+
+// feedDeleted returns true if the feed exists and has been deleted
+func (s *Store) feedDeleted(feedID string) bool {
+	f, ok := s.feeds[feedID]
+	return ok && !f.deletedAt.IsZero()
+}
+
+// defaultFolderID returns the ID of the default folder of a user, creating it
+// if they do not have one yet
+func (s *Store) defaultFolderID(userID string) string {
+	for _, fo := range s.folders {
+		if fo.userID == userID && fo.name == "default" && fo.deletedAt.IsZero() {
+			return fo.id
+		}
+	}
+
+	fo := &folder{
+		id:        uuid.New().String(),
+		userID:    userID,
+		name:      "default",
+		createdAt: time.Now(),
+	}
+	s.folders[fo.id] = fo
+
+	return fo.id
+}
+
+// addFeed adds a feed to a folder of the user, their default folder if
+// folderID is empty
+func (s *Store) addFeed(u *user, folderID string, f *feed) {
+	if folderID == "" {
+		folderID = s.defaultFolderID(u.id)
+	}
+
+	now := time.Now()
+	f.ID = uuid.New().String()
+	f.CreatedAt = now
+	f.UpdatedAt = now
+	s.feeds[f.ID] = f
+
+	s.addFollow(follow{u.id, folderID, f.ID})
+}
+
+// AddFeed adds a feed to a folder of the user and schedules its first scrape
+func (s *Store) AddFeed(ctx context.Context, sessionKey, folderID, title, plugin, feedURL, externalID string, initConf *discollect.Config) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userFor(sessionKey)
+	if err != nil {
+		return "", err
+	}
+
+	for _, f := range s.feeds {
+		if f.public && f.Plugin == plugin && (f.BaseURL == feedURL || (externalID != "" && f.ExternalID == externalID)) {
+			return "", errors.New("feed already exists")
+		}
+	}
+
+	f := &feed{
+		Feed: hydrocarbon.Feed{
+			Title:      title,
+			Plugin:     plugin,
+			BaseURL:    feedURL,
+			Status:     hydrocarbon.FeedActive,
+			ExternalID: externalID,
+		},
+		public: true,
+	}
+	s.addFeed(u, folderID, f)
+	s.addScrape(f.ID, plugin, initConf, time.Now()).Priority = discollect.PriorityInteractive
+
+	return f.ID, nil
+}
+
+// CheckIfFeedExists looks a feed up by url, or by external ID when it is set,
+// and adds any it finds to the folder. Private feeds are never found
+func (s *Store) CheckIfFeedExists(ctx context.Context, sessionKey, folderID, plugin, url, externalID string) (*hydrocarbon.Feed, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userFor(sessionKey)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// feeds matched on their external ID come first
+	var found *feed
+	for _, f := range s.feeds {
+		if f.Plugin != plugin || !f.public {
+			continue
+		}
+		if externalID != "" && f.ExternalID == externalID {
+			found = f
+			break
+		}
+		if f.BaseURL == url && found == nil {
+			found = f
+		}
+	}
+
+	if found == nil {
+		return nil, false, nil
+	}
+	if !found.deletedAt.IsZero() {
+		return nil, false, errors.New("feed has been removed from this instance")
+	}
+
+	s.addFollow(follow{u.id, folderID, found.ID})
+
+	return &hydrocarbon.Feed{
+		ID:    found.ID,
+		Title: found.Title,
+	}, true, nil
+}
+
+// RemoveFeed removes a feed from a folder of the user
+func (s *Store) RemoveFeed(ctx context.Context, sessionKey, folderID, feedID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userFor(sessionKey)
+	if err != nil {
+		return nil
+	}
+
+	s.removeFollow(follow{u.id, folderID, feedID})
+	return nil
+}
+
+// AddFolder creates a new folder
+func (s *Store) AddFolder(ctx context.Context, sessionKey, name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userFor(sessionKey)
+	if err != nil {
+		return "", err
+	}
+
+	for _, fo := range s.folders {
+		if fo.userID == u.id && fo.name == name && fo.deletedAt.IsZero() {
+			return "", errors.New("folder already exists")
+		}
+	}
+
+	fo := &folder{
+		id:        uuid.New().String(),
+		userID:    u.id,
+		name:      name,
+		createdAt: time.Now(),
+	}
+	s.folders[fo.id] = fo
+
+	return fo.id, nil
+}
+
+// GetFoldersWithFeeds returns every folder of the user with the ID, title,
+// status and unread posts of the feeds in it
+func (s *Store) GetFoldersWithFeeds(ctx context.Context, sessionKey string) ([]*hydrocarbon.Folder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userFor(sessionKey)
+	if err != nil {
+		return []*hydrocarbon.Folder{}, nil
+	}
+
+	folders := make([]*hydrocarbon.Folder, 0)
+	for _, fo := range s.folders {
+		if fo.userID != u.id || !fo.deletedAt.IsZero() {
+			continue
+		}
+
+		feeds := make([]*hydrocarbon.Feed, 0)
+		for fl := range s.follows {
+			if fl.userID != u.id || fl.folderID != fo.id {
+				continue
+			}
+
+			f := s.feeds[fl.feedID]
+			if !f.deletedAt.IsZero() {
+				continue
+			}
+			feeds = append(feeds, &hydrocarbon.Feed{
+				ID:     f.ID,
+				Title:  f.Title,
+				Status: f.Status,
+				Unread: s.unread(u.id, f.ID),
+			})
+		}
+		sort.Slice(feeds, func(i, j int) bool {
+			return feeds[i].Title < feeds[j].Title
+		})
+
+		folders = append(folders, &hydrocarbon.Folder{
+			ID:    fo.id,
+			Title: fo.name,
+			Feeds: feeds,
+		})
+	}
+
+	sort.Slice(folders, func(i, j int) bool {
+		return folders[i].Title > folders[j].Title
+	})
+
+	return folders, nil
+}
+
+// SetFolderDeleted deletes or restores a folder of the user
+func (s *Store) SetFolderDeleted(ctx context.Context, sessionKey, folderID string, deleted bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userFor(sessionKey)
+	if err != nil {
+		return err
+	}
+
+	fo, ok := s.folders[folderID]
+	if !ok || fo.userID != u.id || fo.deletedAt.IsZero() != deleted {
+		return errors.New("folder not found")
+	}
+
+	fo.deletedAt = time.Time{}
+	if deleted {
+		fo.deletedAt = time.Now()
+	}
+
+	return nil
+}
+
+// GetFeedByExternalID returns the public feed a plugin gave the external ID
+func (s *Store) GetFeedByExternalID(ctx context.Context, sessionKey, plugin, externalID string) (*hydrocarbon.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.userFor(sessionKey)
+	if err != nil {
+		return nil, errors.New("no feed found")
+	}
+
+	for _, f := range s.feeds {
+		if f.public && f.Plugin == plugin && f.ExternalID == externalID && f.deletedAt.IsZero() {
+			cp := f.Feed
+			return &cp, nil
+		}
+	}
+
+	return nil, errors.New("no feed found")
+}
+
+// RefreshFeed queues an interactive scrape of a feed the user follows, reusing
+// the config of its latest delta scrape. A feed is only refreshed once at a
+// time
+func (s *Store) RefreshFeed(ctx context.Context, sessionKey, feedID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	errRefreshing := errors.New("feed not found or already refreshing")
+
+	_, f, err := s.followedFeed(sessionKey, feedID)
+	if err != nil {
+		return errRefreshing
+	}
+
+	// delta scrapes come first, then the latest of the rest
+	var latest *discollect.Scrape
+	for _, sc := range s.scrapesOf(f.ID) {
+		if sc.Priority == discollect.PriorityInteractive && (sc.State == "WAITING" || sc.State == "RUNNING") {
+			return errRefreshing
+		}
+		if sc.Config.Type == discollect.BackfillScrape {
+			continue
+		}
+
+		if latest == nil {
+			latest = sc
+			continue
+		}
+
+		delta, latestDelta := sc.Config.Type == discollect.DeltaScrape, latest.Config.Type == discollect.DeltaScrape
+		if (delta && !latestDelta) || (delta == latestDelta && sc.ScheduledStartAt.After(latest.ScheduledStartAt)) {
+			latest = sc
+		}
+	}
+
+	if latest == nil {
+		return errRefreshing
+	}
+
+	sc := s.addScrape(f.ID, latest.Plugin, latest.Config, time.Now())
+	sc.Priority = discollect.PriorityInteractive
+	return nil
+}
+
+// SetFeedSchedule sets how scrapes of a feed only the user follows are
+// scheduled, dropping scheduled scrapes so the new schedule takes effect
+// right away
+func (s *Store) SetFeedSchedule(ctx context.Context, sessionKey, feedID string, spec *discollect.ScheduleSpec) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, f, err := s.followedFeed(sessionKey, feedID)
+	if err != nil {
+		return err
+	}
+	if len(s.followersOf(feedID)) > 1 {
+		return errors.New("schedules can only be set for feeds no one else follows")
+	}
+
+	f.schedule = spec
+	// backfills and scrapes users asked for are left alone
+	for id, sc := range s.scrapes {
+		if sc.FeedID.String() == feedID && sc.State == "WAITING" && sc.Priority == discollect.PriorityScheduled {
+			delete(s.scrapes, id)
+		}
+	}
+
+	return nil
+}
+
+// GetFeedConfig returns the plugin of a feed the user follows and the config
+// it was first scraped with
+func (s *Store) GetFeedConfig(ctx context.Context, sessionKey, feedID string) (string, *discollect.Config, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, f, err := s.followedFeed(sessionKey, feedID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var first *discollect.Scrape
+	for _, sc := range s.scrapesOf(f.ID) {
+		if sc.Config.Type == discollect.FullScrape && (first == nil || sc.CreatedAt.Before(first.CreatedAt)) {
+			first = sc
+		}
+	}
+
+	if first == nil {
+		return "", nil, errFeedNotFound
+	}
+
+	return first.Plugin, first.Config, nil
+}
+
+// BackfillFeed queues a backfill of a feed the user follows, unless one is
+// already waiting, running or paused, returning the ID of the scrape
+func (s *Store) BackfillFeed(ctx context.Context, sessionKey, feedID string, c *discollect.Config) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	errBackfilling := errors.New("feed not found or already backfilling")
+
+	_, f, err := s.followedFeed(sessionKey, feedID)
+	if err != nil {
+		return "", errBackfilling
+	}
+
+	for _, sc := range s.scrapesOf(f.ID) {
+		if sc.Config.Type == discollect.BackfillScrape && (sc.State == "WAITING" || sc.State == "RUNNING" || sc.State == "PAUSED") {
+			return "", errBackfilling
+		}
+	}
+
+	return s.addScrape(f.ID, f.Plugin, c, time.Now()).ID.String(), nil
+}
+
+// GetBackfill returns the latest backfill of a feed the user follows, with its
+// progress
+func (s *Store) GetBackfill(ctx context.Context, sessionKey, feedID string) (*discollect.Scrape, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, f, err := s.followedFeed(sessionKey, feedID)
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *discollect.Scrape
+	for _, sc := range s.scrapesOf(f.ID) {
+		if sc.Config.Type == discollect.BackfillScrape && (latest == nil || !sc.CreatedAt.Before(latest.CreatedAt)) {
+			latest = sc
+		}
+	}
+
+	if latest == nil {
+		return nil, errors.New("feed has not been backfilled")
+	}
+
+	cp := *latest
+	return &cp, nil
+}
+
+// SetFeedCredentials sets the credentials the user logs into the origin site of
+// a feed they follow with, first moving them onto a private copy of the feed if
+// others can follow it, and returns the ID of the feed they are used for
+func (s *Store) SetFeedCredentials(ctx context.Context, sessionKey, feedID string, c *discollect.Credentials) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, f, err := s.followedFeed(sessionKey, feedID)
+	if err != nil {
+		return "", err
+	}
+
+	if f.public {
+		f, err = s.privateFeed(u, f)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	cp := *c
+	s.credentials[[2]string{u.id, f.ID}] = &cp
+	return f.ID, nil
+}
+
+// privateFeed copies a feed into a private one, moving the user and their
+// transform over to it and scheduling its first scrape
+func (s *Store) privateFeed(u *user, f *feed) (*feed, error) {
+	var first *discollect.Scrape
+	for _, sc := range s.scrapesOf(f.ID) {
+		if sc.Config.Type == discollect.FullScrape && (first == nil || sc.CreatedAt.Before(first.CreatedAt)) {
+			first = sc
+		}
+	}
+	if first == nil {
+		return nil, errors.New("feed has not been scraped yet")
+	}
+
+	now := time.Now()
+	pf := &feed{
+		Feed: hydrocarbon.Feed{
+			ID:         uuid.New().String(),
+			CreatedAt:  now,
+			UpdatedAt:  now,
+			Title:      f.Title,
+			Plugin:     f.Plugin,
+			BaseURL:    f.BaseURL,
+			Status:     f.Status,
+			ExternalID: f.ExternalID,
+		},
+	}
+	s.feeds[pf.ID] = pf
+
+	for fl := range s.follows {
+		if fl.userID == u.id && fl.feedID == f.ID {
+			s.removeFollow(fl)
+			s.addFollow(follow{u.id, fl.folderID, pf.ID})
+		}
+	}
+
+	if ft, ok := s.transforms[[2]string{u.id, f.ID}]; ok {
+		delete(s.transforms, [2]string{u.id, f.ID})
+		ft.FeedID = pf.ID
+		s.transforms[[2]string{u.id, pf.ID}] = ft
+	}
+	for k, ov := range s.overlays {
+		if k[0] == u.id && ov.feedID == f.ID {
+			delete(s.overlays, k)
+		}
+	}
+
+	s.addScrape(pf.ID, first.Plugin, first.Config, now).Priority = discollect.PriorityInteractive
+	return pf, nil
+}
+
+// DeleteFeedCredentials removes the credentials the user set for a feed, which
+// stays private to them
+func (s *Store) DeleteFeedCredentials(ctx context.Context, sessionKey, feedID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userFor(sessionKey)
+	if err != nil || s.credentials[[2]string{u.id, feedID}] == nil {
+		return errors.New("no credentials found")
+	}
+
+	delete(s.credentials, [2]string{u.id, feedID})
+	return nil
+}
+
+// GetCredentials returns the credentials of the feed a scrape is of, or nil if
+// it has none. They are only used for private feeds the user that set them
+// alone follows
+func (s *Store) GetCredentials(ctx context.Context, scrapeID uuid.UUID) (*discollect.Credentials, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sc, ok := s.scrapes[scrapeID]
+	if !ok {
+		return nil, nil
+	}
+
+	f, ok := s.feeds[sc.FeedID.String()]
+	followers := s.followersOf(sc.FeedID.String())
+	if !ok || f.public || len(followers) != 1 {
+		return nil, nil
+	}
+
+	c, ok := s.credentials[[2]string{followers[0], f.ID}]
+	if !ok {
+		return nil, nil
+	}
+
+	cp := *c
+	return &cp, nil
+}
+
+// AddPendingFeed adds a feed that has not been resolved to a plugin yet to the
+// given folder, users adding the same url share a single pending feed
+func (s *Store) AddPendingFeed(ctx context.Context, sessionKey, folderID, feedURL string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userFor(sessionKey)
+	if err != nil {
+		return "", err
+	}
+
+	for _, f := range s.feeds {
+		if f.Status == hydrocarbon.FeedPending && f.BaseURL == feedURL {
+			if folderID == "" {
+				folderID = s.defaultFolderID(u.id)
+			}
+			s.addFollow(follow{u.id, folderID, f.ID})
+			return f.ID, nil
+		}
+	}
+
+	f := &feed{
+		Feed: hydrocarbon.Feed{
+			Title:   feedURL,
+			BaseURL: feedURL,
+			Status:  hydrocarbon.FeedPending,
+		},
+		public: true,
+	}
+	s.addFeed(u, folderID, f)
+
+	return f.ID, nil
+}
+
+// ListPendingFeeds returns the oldest feeds waiting to be resolved
+func (s *Store) ListPendingFeeds(ctx context.Context, limit int) ([]*hydrocarbon.PendingFeed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var feeds []*feed
+	for _, f := range s.feeds {
+		if f.Status == hydrocarbon.FeedPending {
+			feeds = append(feeds, f)
+		}
+	}
+	sort.Slice(feeds, func(i, j int) bool {
+		return feeds[i].CreatedAt.Before(feeds[j].CreatedAt)
+	})
+
+	start, end := pageOf(len(feeds), limit, 0)
+
+	var pending []*hydrocarbon.PendingFeed
+	for _, f := range feeds[start:end] {
+		pending = append(pending, &hydrocarbon.PendingFeed{
+			ID:       f.ID,
+			URL:      f.BaseURL,
+			Attempts: f.resolveAttempts,
+		})
+	}
+
+	return pending, nil
+}
+
+// ResolvePendingFeed turns a pending feed into a regular one and schedules its
+// first scrape. If the resolved feed already exists, its followers are moved
+// to it and the pending feed is removed
+func (s *Store) ResolvePendingFeed(ctx context.Context, id, title, plugin, feedURL, externalID string, initConf *discollect.Config) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.feeds[id]
+	if !ok || f.Status != hydrocarbon.FeedPending {
+		return errors.New("feed is no longer pending")
+	}
+
+	var existing *feed
+	for _, ef := range s.feeds {
+		if !ef.public || ef.Plugin != plugin {
+			continue
+		}
+		if externalID != "" && ef.ExternalID == externalID {
+			existing = ef
+			break
+		}
+		if ef.BaseURL == feedURL && existing == nil {
+			existing = ef
+		}
+	}
+
+	if existing == nil {
+		f.Title = title
+		f.Plugin = plugin
+		f.BaseURL = feedURL
+		f.ExternalID = externalID
+		f.Status = hydrocarbon.FeedActive
+		f.UpdatedAt = time.Now()
+		f.resolveError = ""
+
+		s.addScrape(f.ID, plugin, initConf, time.Now()).Priority = discollect.PriorityInteractive
+		return nil
+	}
+
+	for fl := range s.follows {
+		if fl.feedID != id {
+			continue
+		}
+
+		s.removeFollow(fl)
+		s.addFollow(follow{fl.userID, fl.folderID, existing.ID})
+	}
+	delete(s.feeds, id)
+
+	return nil
+}
+
+// FailPendingFeed records a failed attempt to resolve a pending feed, final
+// stops any further attempts
+func (s *Store) FailPendingFeed(ctx context.Context, id, reason string, final bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.feeds[id]
+	if !ok || f.Status != hydrocarbon.FeedPending {
+		return nil
+	}
+
+	f.resolveAttempts++
+	f.resolveError = reason
+	if final {
+		f.Status = hydrocarbon.FeedFailed
+	}
+
+	return nil
+}
+
+// GetPublicFeed returns a public feed that has been resolved to a plugin
+func (s *Store) GetPublicFeed(ctx context.Context, feedID string) (*hydrocarbon.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.feeds[feedID]
+	if !ok || !f.public || f.Status != hydrocarbon.FeedActive || !f.deletedAt.IsZero() {
+		return nil, errors.New("no public feed found")
+	}
+
+	return &hydrocarbon.Feed{
+		ID:        f.ID,
+		CreatedAt: f.CreatedAt,
+		UpdatedAt: f.UpdatedAt,
+		Title:     f.Title,
+		Plugin:    f.Plugin,
+		BaseURL:   f.BaseURL,
+	}, nil
+}
+
+// unread counts the posts of a feed, or seen in it, the user has not read
+func (s *Store) unread(userID, feedID string) int {
+	var n int
+	for _, p := range s.posts {
+		if (p.feedID == feedID || p.sourcedFrom(feedID)) && p.deletedAt.IsZero() && !s.reads[[2]string{userID, p.ID}] {
+			n++
+		}
+	}
+
+	return n
+}
@@ -0,0 +1,332 @@
+package memstore
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+// intID returns the integer Fever identifies a folder, feed or post by, it is
+// given out the first time it is asked for
+func (s *Store) intID(id string) int64 {
+	n, ok := s.intIDs[id]
+	if !ok {
+		s.lastIntID++
+		n = s.lastIntID
+		s.intIDs[id] = n
+		s.ids[n] = id
+	}
+
+	return n
+}
+
+// feverFollowed returns the feeds the user follows in folders they have not
+// deleted
+func (s *Store) feverFollowed(userID string) map[string]bool {
+	feeds := make(map[string]bool)
+	for f := range s.follows {
+		fo, ok := s.folders[f.folderID]
+		if f.userID != userID || !ok || !fo.deletedAt.IsZero() || s.feedDeleted(f.feedID) {
+			continue
+		}
+
+		feeds[f.feedID] = true
+	}
+
+	return feeds
+}
+
+// feverPosts returns the posts of the feeds the user follows, in the order of
+// their integer IDs, which posts are given in the order they were made
+func (s *Store) feverPosts(userID string) []*post {
+	followed := s.feverFollowed(userID)
+
+	var posts []*post
+	for _, p := range s.posts {
+		if followed[p.feedID] && p.deletedAt.IsZero() {
+			posts = append(posts, p)
+		}
+	}
+
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].ID < posts[j].ID
+	})
+	for _, p := range posts {
+		s.intID(p.ID)
+	}
+
+	sort.Slice(posts, func(i, j int) bool {
+		return s.intIDs[posts[i].ID] < s.intIDs[posts[j].ID]
+	})
+
+	return posts
+}
+
+// SetFeverPassword sets the password Fever clients of the user log in with
+func (s *Store) SetFeverPassword(ctx context.Context, sessionKey, password string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userFor(sessionKey)
+	if err != nil {
+		return err
+	}
+
+	u.feverKey = ""
+	if password != "" {
+		sum := md5.Sum([]byte(u.email + ":" + password))
+		u.feverKey = hex.EncodeToString(sum[:])
+	}
+
+	return nil
+}
+
+// FeverUser returns the ID of the user whose Fever key apiKey is
+func (s *Store) FeverUser(ctx context.Context, apiKey string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if apiKey == "" {
+		return "", nil
+	}
+
+	for _, u := range s.users {
+		if u.feverKey == apiKey {
+			return u.id, nil
+		}
+	}
+
+	return "", nil
+}
+
+// FeverGroups returns the folders of the user, with the feeds in each
+func (s *Store) FeverGroups(ctx context.Context, userID string) ([]*hydrocarbon.FeverGroup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var folders []*folder
+	for _, fo := range s.folders {
+		if fo.userID == userID && fo.deletedAt.IsZero() {
+			folders = append(folders, fo)
+		}
+	}
+
+	sort.Slice(folders, func(i, j int) bool {
+		return folders[i].name < folders[j].name
+	})
+
+	groups := make([]*hydrocarbon.FeverGroup, 0, len(folders))
+	for _, fo := range folders {
+		g := &hydrocarbon.FeverGroup{
+			ID:      s.intID(fo.id),
+			Title:   fo.name,
+			FeedIDs: make([]int64, 0),
+		}
+
+		for f := range s.follows {
+			if f.folderID == fo.id && !s.feedDeleted(f.feedID) {
+				g.FeedIDs = append(g.FeedIDs, s.intID(f.feedID))
+			}
+		}
+
+		sort.Slice(g.FeedIDs, func(i, j int) bool {
+			return g.FeedIDs[i] < g.FeedIDs[j]
+		})
+		groups = append(groups, g)
+	}
+
+	return groups, nil
+}
+
+// FeverFeeds returns the feeds the user follows
+func (s *Store) FeverFeeds(ctx context.Context, userID string) ([]*hydrocarbon.FeverFeed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	feeds := make([]*hydrocarbon.FeverFeed, 0)
+	for _, id := range sortedKeys(s.feverFollowed(userID)) {
+		f := s.feeds[id]
+
+		updatedAt := f.CreatedAt
+		for _, p := range s.posts {
+			if p.feedID == id && p.PostedAt.After(updatedAt) {
+				updatedAt = p.PostedAt
+			}
+		}
+
+		feeds = append(feeds, &hydrocarbon.FeverFeed{
+			ID:                s.intID(id),
+			Title:             f.Title,
+			URL:               f.BaseURL,
+			SiteURL:           f.BaseURL,
+			LastUpdatedOnTime: updatedAt.Unix(),
+		})
+	}
+
+	sort.Slice(feeds, func(i, j int) bool {
+		return feeds[i].Title < feeds[j].Title
+	})
+
+	return feeds, nil
+}
+
+// FeverItems returns up to 50 posts of the feeds the user follows, with their
+// bodies, and how many posts those feeds have
+func (s *Store) FeverItems(ctx context.Context, userID string, q *hydrocarbon.FeverItemQuery) ([]*hydrocarbon.FeverItem, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	posts := s.feverPosts(userID)
+
+	with := make(map[int64]bool)
+	for _, id := range q.WithIDs {
+		with[id] = true
+	}
+
+	var selected []*post
+	for _, p := range posts {
+		id := s.intIDs[p.ID]
+		switch {
+		case len(q.WithIDs) > 0:
+			if with[id] {
+				selected = append(selected, p)
+			}
+		case q.MaxID > 0:
+			if id < q.MaxID {
+				// newest first
+				selected = append([]*post{p}, selected...)
+			}
+		default:
+			if id > q.SinceID {
+				selected = append(selected, p)
+			}
+		}
+	}
+
+	if len(selected) > 50 {
+		selected = selected[:50]
+	}
+
+	items := make([]*hydrocarbon.FeverItem, 0, len(selected))
+	for _, p := range selected {
+		v := s.view(userID, p)
+		it := &hydrocarbon.FeverItem{
+			ID:            s.intIDs[p.ID],
+			FeedID:        s.intID(p.feedID),
+			Title:         v.Title,
+			Author:        v.Author,
+			HTML:          v.Body,
+			URL:           v.OriginalURL,
+			CreatedOnTime: v.PostedAt.Unix(),
+		}
+		if v.Read {
+			it.IsRead = 1
+		}
+		if v.Starred {
+			it.IsSaved = 1
+		}
+
+		items = append(items, it)
+	}
+
+	return items, len(posts), nil
+}
+
+// FeverUnreadItemIDs returns the posts of the feeds the user follows they
+// have not read
+func (s *Store) FeverUnreadItemIDs(ctx context.Context, userID string) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]int64, 0)
+	for _, p := range s.feverPosts(userID) {
+		if !s.reads[[2]string{userID, p.ID}] {
+			ids = append(ids, s.intIDs[p.ID])
+		}
+	}
+
+	return ids, nil
+}
+
+// FeverSavedItemIDs returns the posts the user has starred
+func (s *Store) FeverSavedItemIDs(ctx context.Context, userID string) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]int64, 0)
+	for k := range s.stars {
+		if p, ok := s.posts[k[1]]; ok && k[0] == userID && p.deletedAt.IsZero() {
+			ids = append(ids, s.intID(p.ID))
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	return ids, nil
+}
+
+// FeverMarkItem marks a post read, unread, starred or unstarred for the user
+func (s *Store) FeverMarkItem(ctx context.Context, userID string, itemID int64, as string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// posts that were never sent to a client, or are of feeds the user does
+	// not follow, can not be marked
+	postID, ok := s.ids[itemID]
+	p, isPost := s.posts[postID]
+	if !ok || !isPost || !s.feverFollowed(userID)[p.feedID] {
+		return nil
+	}
+
+	k := [2]string{userID, postID}
+	switch as {
+	case "read":
+		s.setRead(userID, postID, true)
+	case "unread":
+		s.setRead(userID, postID, false)
+	case "saved":
+		s.stars[k] = true
+	case "unsaved":
+		delete(s.stars, k)
+	default:
+		return errors.New("items can only be marked read, unread, saved or unsaved")
+	}
+
+	return nil
+}
+
+// FeverMarkRead marks the posts of a feed, or of every feed in a folder, the
+// user follows read if they were posted before before. Group 0 is every feed
+func (s *Store) FeverMarkRead(ctx context.Context, userID, kind string, id int64, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if kind != "feed" && kind != "group" {
+		return errors.New("only feeds and groups can be marked read")
+	}
+
+	target := s.ids[id]
+	for _, p := range s.feverPosts(userID) {
+		if !p.PostedAt.Before(before) {
+			continue
+		}
+
+		switch {
+		case kind == "feed" && p.feedID != target:
+			continue
+		case kind == "group" && id != 0 && !s.follows[follow{userID: userID, folderID: target, feedID: p.feedID}]:
+			continue
+		}
+
+		s.setRead(userID, p.ID, true)
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+// GReaderItemIDs returns the posts of the feeds the user follows q selects
+func (s *Store) GReaderItemIDs(ctx context.Context, userID string, q *hydrocarbon.GReaderQuery) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	posts := s.feverPosts(userID)
+	if !q.OldestFirst {
+		sort.SliceStable(posts, func(i, j int) bool {
+			return s.intIDs[posts[i].ID] > s.intIDs[posts[j].ID]
+		})
+	}
+
+	ids := make([]int64, 0)
+	for _, p := range posts {
+		id := s.intIDs[p.ID]
+		k := [2]string{userID, p.ID}
+
+		switch {
+		case q.FeedID != 0 && p.feedID != s.ids[q.FeedID]:
+			continue
+		case q.GroupID != 0 && !s.follows[follow{userID: userID, folderID: s.ids[q.GroupID], feedID: p.feedID}]:
+			continue
+		case q.Starred && !s.stars[k], q.ExcludeRead && s.reads[k]:
+			continue
+		case !q.NewerThan.IsZero() && p.PostedAt.Before(q.NewerThan),
+			!q.OlderThan.IsZero() && !p.PostedAt.Before(q.OlderThan):
+			continue
+		case q.Continue != 0 && q.OldestFirst && id <= q.Continue,
+			q.Continue != 0 && !q.OldestFirst && id >= q.Continue:
+			continue
+		}
+
+		ids = append(ids, id)
+		if len(ids) == q.Limit {
+			break
+		}
+	}
+
+	return ids, nil
+}
+
+// GReaderUnreadCounts returns how many posts of each feed the user follows
+// they have not read
+func (s *Store) GReaderUnreadCounts(ctx context.Context, userID string) ([]*hydrocarbon.GReaderUnreadCount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[string]*hydrocarbon.GReaderUnreadCount)
+	for _, p := range s.feverPosts(userID) {
+		if s.reads[[2]string{userID, p.ID}] {
+			continue
+		}
+
+		c, ok := counts[p.feedID]
+		if !ok {
+			c = &hydrocarbon.GReaderUnreadCount{FeedID: s.intID(p.feedID)}
+			counts[p.feedID] = c
+		}
+
+		c.Count++
+		if p.PostedAt.After(c.Newest) {
+			c.Newest = p.PostedAt
+		}
+	}
+
+	out := make([]*hydrocarbon.GReaderUnreadCount, 0, len(counts))
+	for _, c := range counts {
+		out = append(out, c)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].FeedID < out[j].FeedID
+	})
+
+	return out, nil
+}
@@ -0,0 +1,215 @@
+// Package memstore keeps everything hydrocarbon stores in memory, in place of
+// postgres. It is meant for tests and demos, nothing is kept once the process
+// exits and no more care is taken of memory than a test would need
+package memstore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fortytw2/hydrocarbon"
+	"github.com/fortytw2/hydrocarbon/discollect"
+)
+
+// a Store is every store hydrocarbon and discollect need
+var (
+	_ hydrocarbon.UserStore        = &Store{}
+	_ hydrocarbon.FeedStore        = &Store{}
+	_ hydrocarbon.ReadStatusStore  = &Store{}
+	_ hydrocarbon.BillingStore     = &Store{}
+	_ hydrocarbon.AdminStore       = &Store{}
+	_ hydrocarbon.FederationStore  = &Store{}
+	_ hydrocarbon.ActivityPubStore = &Store{}
+	_ hydrocarbon.NewsletterStore  = &Store{}
+	_ hydrocarbon.PendingFeedStore = &Store{}
+	_ hydrocarbon.KeyUsageStore    = &Store{}
+	_ hydrocarbon.QualityStore     = &Store{}
+	_ hydrocarbon.HealthStore      = &Store{}
+	_ hydrocarbon.ChangeStore      = &Store{}
+	_ hydrocarbon.FeverStore       = &Store{}
+	_ hydrocarbon.GReaderStore     = &Store{}
+	_ hydrocarbon.ExportStore      = &Store{}
+
+	_ discollect.Writer          = &Store{}
+	_ discollect.Metastore       = &Store{}
+	_ discollect.NodeRegistry    = &Store{}
+	_ discollect.LogStore        = &Store{}
+	_ discollect.CredentialStore = &Store{}
+)
+
+var (
+	errInvalidKey   = errors.New("invalid or inactive token")
+	errFeedNotFound = errors.New("feed not found")
+)
+
+// maxScrapeErrors is the number of times a scrape may fail before it is moved
+// to DEAD, as it is in postgres
+const maxScrapeErrors = 3
+
+// A Store holds everything in maps behind a single lock, every method takes
+// it and the unexported ones expect it to be held
+type Store struct {
+	mu sync.Mutex
+
+	sanitizer *hydrocarbon.Sanitizer
+
+	plans map[string]*plan
+	// every user is on the UnlimitedPlan if unlimited is set
+	unlimited bool
+
+	users       map[string]*user
+	sessions    map[string]*session
+	loginTokens map[string]*loginToken
+	coupons     map[[2]string]bool
+
+	folders map[string]*folder
+	feeds   map[string]*feed
+	follows map[follow]bool
+	posts   map[string]*post
+	reads   map[[2]string]bool
+	stars   map[[2]string]bool
+
+	// transforms, overlays and credentials are keyed by user, then feed or post
+	transforms  map[[2]string]*hydrocarbon.FeedTransform
+	overlays    map[[2]string]*overlay
+	credentials map[[2]string]*discollect.Credentials
+
+	announcements map[string]*hydrocarbon.Announcement
+	views         map[[2]string]bool
+
+	scrapes map[uuid.UUID]*discollect.Scrape
+	paused  map[uuid.UUID]*pausedTasks
+	usage   map[usageKey]*usage
+	logs    map[uuid.UUID][]*discollect.LogEntry
+	nodes   map[uuid.UUID]*discollect.Node
+
+	followers   map[string][]*hydrocarbon.Follower
+	newsletters map[string]*newsletter
+	quality     map[string]*hydrocarbon.PluginQuality
+
+	subs map[*changeSub]bool
+
+	// Fever identifies folders, feeds and posts by integers, see intID
+	intIDs    map[string]int64
+	ids       map[int64]string
+	lastIntID int64
+}
+
+// New returns an empty Store, with the free and pro plans every database
+// starts with
+func New() *Store {
+	return &Store{
+		plans: map[string]*plan{
+			"free": {Plan: hydrocarbon.Plan{Name: "free", MaxFeeds: 25, MaxScrapes: 2000, MinScrapeInterval: 2 * time.Hour}},
+			"pro":  {Plan: hydrocarbon.Plan{Name: "pro", MaxFeeds: 500, MaxScrapes: 100000, MinScrapeInterval: 30 * time.Minute}, paymentPlanID: "hydrocarbon"},
+		},
+		users:         make(map[string]*user),
+		sessions:      make(map[string]*session),
+		loginTokens:   make(map[string]*loginToken),
+		coupons:       make(map[[2]string]bool),
+		folders:       make(map[string]*folder),
+		feeds:         make(map[string]*feed),
+		follows:       make(map[follow]bool),
+		posts:         make(map[string]*post),
+		reads:         make(map[[2]string]bool),
+		stars:         make(map[[2]string]bool),
+		transforms:    make(map[[2]string]*hydrocarbon.FeedTransform),
+		overlays:      make(map[[2]string]*overlay),
+		credentials:   make(map[[2]string]*discollect.Credentials),
+		announcements: make(map[string]*hydrocarbon.Announcement),
+		views:         make(map[[2]string]bool),
+		scrapes:       make(map[uuid.UUID]*discollect.Scrape),
+		paused:        make(map[uuid.UUID]*pausedTasks),
+		usage:         make(map[usageKey]*usage),
+		logs:          make(map[uuid.UUID][]*discollect.LogEntry),
+		nodes:         make(map[uuid.UUID]*discollect.Node),
+		followers:     make(map[string][]*hydrocarbon.Follower),
+		newsletters:   make(map[string]*newsletter),
+		quality:       make(map[string]*hydrocarbon.PluginQuality),
+		subs:          make(map[*changeSub]bool),
+		intIDs:        make(map[string]int64),
+		ids:           make(map[int64]string),
+	}
+}
+
+// SetSanitizer cleans the body of every post written by a scrape with s before
+// it is stored
+func (s *Store) SetSanitizer(sz *hydrocarbon.Sanitizer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sanitizer = sz
+}
+
+// DisablePlans puts every user on the UnlimitedPlan, for when billing is
+// disabled
+func (s *Store) DisablePlans() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.unlimited = true
+}
+
+// SetAdmin makes the user with the given email an admin, creating them if
+// they do not exist yet
+func (s *Store) SetAdmin(email string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.userByEmail(email).admin = true
+}
+
+// userFor returns the user a session key belongs to
+func (s *Store) userFor(sessionKey string) (*user, error) {
+	sess, ok := s.sessions[strings.ToLower(sessionKey)]
+	if !ok {
+		return nil, errInvalidKey
+	}
+
+	return s.users[sess.userID], nil
+}
+
+// randomToken returns 16 random bytes, hex encoded like the keys and tokens
+// postgres generates
+func randomToken() string {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		// crypto/rand does not fail
+		panic(err)
+	}
+
+	return hex.EncodeToString(buf)
+}
+
+// pageOf returns the bounds of limit items of a slice of length n, after
+// offset. A negative limit has no bound
+func pageOf(n, limit, offset int) (int, int) {
+	if offset > n {
+		offset = n
+	}
+	if limit < 0 || offset+limit > n {
+		return offset, n
+	}
+
+	return offset, offset + limit
+}
+
+// sortedKeys returns the keys of m in order, so maps are read back the same
+// way every time
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,1277 @@
+package memstore_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mmcdole/gofeed"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/fortytw2/hydrocarbon"
+	"github.com/fortytw2/hydrocarbon/discollect"
+	"github.com/fortytw2/hydrocarbon/memstore"
+	"github.com/fortytw2/hydrocarbon/rpc"
+)
+
+func newDiscollector(t *testing.T) *discollect.Discollector {
+	t.Helper()
+
+	dc, err := discollect.New(discollect.WithPlugins(&discollect.Plugin{
+		Name:        "ycombinators",
+		Entrypoints: []string{".*"},
+		ConfigCreator: func(url string, ho *discollect.HandlerOpts) (string, *discollect.Config, error) {
+			return "gotem", &discollect.Config{
+				Type:        discollect.FullScrape,
+				Entrypoints: []string{url},
+			}, nil
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dc
+}
+
+func newRouter(t *testing.T, s *memstore.Store) http.Handler {
+	t.Helper()
+
+	dc := newDiscollector(t)
+	ks := hydrocarbon.NewKeySigner("test")
+	ua := hydrocarbon.NewUserAPI(s, ks, &hydrocarbon.MockMailer{}, nil, "")
+	ua.DisableEmailVerification()
+
+	return hydrocarbon.NewRouter(hydrocarbon.RouterConfig{
+		Users:      ua,
+		Feeds:      hydrocarbon.NewFeedAPI(s, dc, ks),
+		ReadStatus: hydrocarbon.NewReadStatusAPI(s, ks),
+		Billing:    hydrocarbon.NewBillingAPI(s, ks, nil, "http://localhost:3000"),
+		Admin:      hydrocarbon.NewAdminAPI(s, dc, ks),
+		Plugins:    hydrocarbon.NewPluginAPI(dc),
+		Fever:      hydrocarbon.NewFeverAPI(s, ks),
+		GReader:    hydrocarbon.NewGReaderAPI(s, ks),
+		Live:       hydrocarbon.NewLiveAPI(s, ks, "http://localhost:3000"),
+		Exports:    hydrocarbon.NewExportAPI(s, ks, "http://localhost:3000"),
+		Domain:     "http://localhost:3000",
+	})
+}
+
+// call makes a request to h and decodes the data of the response into out
+func call(t *testing.T, h http.Handler, key, path, body string, out interface{}) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "http://localhost:3000"+path, bytes.NewBufferString(body))
+	if key != "" {
+		req.Header.Set("X-Hydrocarbon-Key", key)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s returned %d: %s", path, w.Code, w.Body.String())
+	}
+
+	resp := struct {
+		Data interface{} `json:"data"`
+	}{out}
+
+	err := json.NewDecoder(w.Body).Decode(&resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// login logs in to h as ian@hydrocarbon.io and returns the session key
+func login(t *testing.T, h http.Handler) string {
+	t.Helper()
+
+	var loginURL string
+	call(t, h, "", "/v1/token/create", `{"email": "ian@hydrocarbon.io"}`, &loginURL)
+
+	var session struct {
+		Key string `json:"key"`
+	}
+	call(t, h, "", "/v1/key/create", `{"token": "`+loginURL[strings.Index(loginURL, "token=")+len("token="):]+`"}`, &session)
+
+	return session.Key
+}
+
+// newAccount logs in to h and follows ycombinator.com in a new folder,
+// returning the session key and the IDs of the folder and feed
+func newAccount(t *testing.T, h http.Handler) (key, folderID, feedID string) {
+	t.Helper()
+
+	key = login(t, h)
+
+	var folder, feed struct {
+		ID string `json:"id"`
+	}
+	call(t, h, key, "/v1/folder/create", `{"name": "news"}`, &folder)
+	call(t, h, key, "/v1/feed/create", `{"folder_id": "`+folder.ID+`", "url": "https://ycombinator.com"}`, &feed)
+
+	return key, folder.ID, feed.ID
+}
+
+// newSession creates the user with email in s and returns their ID and the key
+// of a session of theirs, for tests of the store itself
+func newSession(t *testing.T, s *memstore.Store, email string) (userID, key string) {
+	t.Helper()
+
+	ctx := context.Background()
+	userID, _, err := s.CreateOrGetUser(ctx, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, key, err = s.CreateSession(ctx, userID, "test-ua", "192.168.1.254")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return userID, key
+}
+
+func TestAPI(t *testing.T) {
+	t.Parallel()
+
+	s := memstore.New()
+	h := newRouter(t, s)
+
+	var loginURL string
+	call(t, h, "", "/v1/token/create", `{"email": "ian@hydrocarbon.io"}`, &loginURL)
+
+	i := strings.Index(loginURL, "token=")
+	if i == -1 {
+		t.Fatalf("no token in %q", loginURL)
+	}
+
+	var session struct {
+		Email string `json:"email"`
+		Key   string `json:"key"`
+	}
+	call(t, h, "", "/v1/key/create", `{"token": "`+loginURL[i+len("token="):]+`"}`, &session)
+	if session.Email != "ian@hydrocarbon.io" {
+		t.Fatalf("session is for %q", session.Email)
+	}
+
+	var folder, feed struct {
+		ID string `json:"id"`
+	}
+	call(t, h, session.Key, "/v1/folder/create", `{"name": "news"}`, &folder)
+	call(t, h, session.Key, "/v1/feed/create", `{"folder_id": "`+folder.ID+`", "url": "https://ycombinator.com"}`, &feed)
+
+	ss, err := s.ListScrapes(context.Background(), "WAITING", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ss) != 1 || ss[0].FeedID.String() != feed.ID {
+		t.Fatalf("expected the feed to be scheduled, got %v", ss)
+	}
+
+	err = s.Write(context.Background(), ss[0].ID, &hydrocarbon.Post{
+		Title:       "Show HN: hydrocarbon",
+		Author:      "fortytw2",
+		Body:        "<p>a feed reader</p>",
+		OriginalURL: "https://ycombinator.com/item?id=1",
+		PostedAt:    time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var list struct {
+		Folders []*hydrocarbon.Folder `json:"folders"`
+	}
+	call(t, h, session.Key, "/v1/folder/list", `{}`, &list)
+	if len(list.Folders) != 1 || len(list.Folders[0].Feeds) != 1 || list.Folders[0].Feeds[0].ID != feed.ID {
+		t.Fatalf("expected the feed in its folder, got %v", list.Folders)
+	}
+	if list.Folders[0].Feeds[0].Unread != 1 {
+		t.Fatalf("expected 1 unread post, got %d", list.Folders[0].Feeds[0].Unread)
+	}
+
+	var posts hydrocarbon.Feed
+	call(t, h, session.Key, "/v1/feed/get", `{"feed_id": "`+feed.ID+`"}`, &posts)
+	if len(posts.Posts) != 1 || posts.Posts[0].Title != "Show HN: hydrocarbon" {
+		t.Fatalf("expected the written post, got %v", posts.Posts)
+	}
+	if posts.Posts[0].Read {
+		t.Fatal("post is read before being marked read")
+	}
+
+	call(t, h, session.Key, "/v1/post/read", `{"post_id": "`+posts.Posts[0].ID+`"}`, nil)
+
+	var p hydrocarbon.Post
+	call(t, h, session.Key, "/v1/post/get", `{"post_id": "`+posts.Posts[0].ID+`"}`, &p)
+	if !p.Read || p.Body != "<p>a feed reader</p>" {
+		t.Fatalf("expected the read post with its body, got %+v", p)
+	}
+
+	call(t, h, session.Key, "/v1/folder/list", `{}`, &list)
+	if list.Folders[0].Feeds[0].Unread != 0 {
+		t.Fatalf("expected no unread posts once read, got %d", list.Folders[0].Feeds[0].Unread)
+	}
+
+	call(t, h, session.Key, "/v1/post/star", `{"post_id": "`+p.ID+`", "starred": true}`, nil)
+	call(t, h, session.Key, "/v1/feed/get", `{"feed_id": "`+feed.ID+`"}`, &posts)
+	if !posts.Posts[0].Starred {
+		t.Fatal("expected the post to be starred")
+	}
+
+	// deleted folders and posts are hidden until restored
+	call(t, h, session.Key, "/v1/folder/delete", `{"folder_id": "`+folder.ID+`"}`, nil)
+	call(t, h, session.Key, "/v1/folder/list", `{}`, &list)
+	if len(list.Folders) != 0 {
+		t.Fatalf("expected the deleted folder to be hidden, got %v", list.Folders)
+	}
+	call(t, h, session.Key, "/v1/folder/restore", `{"folder_id": "`+folder.ID+`"}`, nil)
+	call(t, h, session.Key, "/v1/folder/list", `{}`, &list)
+	if len(list.Folders) != 1 || len(list.Folders[0].Feeds) != 1 {
+		t.Fatalf("expected the restored folder with its feed, got %v", list.Folders)
+	}
+
+	err = s.SetPostDeleted(context.Background(), p.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	call(t, h, session.Key, "/v1/feed/get", `{"feed_id": "`+feed.ID+`"}`, &posts)
+	if len(posts.Posts) != 0 {
+		t.Fatalf("expected the deleted post to be hidden, got %v", posts.Posts)
+	}
+	if _, err = s.GetPost(context.Background(), session.Key, p.ID); err == nil {
+		t.Fatal("expected the deleted post not to be found")
+	}
+	if err = s.SetPostDeleted(context.Background(), p.ID, true); err == nil {
+		t.Fatal("expected deleting a deleted post to fail")
+	}
+
+	err = s.SetPostDeleted(context.Background(), p.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	call(t, h, session.Key, "/v1/feed/get", `{"feed_id": "`+feed.ID+`"}`, &posts)
+	if len(posts.Posts) != 1 {
+		t.Fatalf("expected the restored post, got %v", posts.Posts)
+	}
+}
+
+// fever makes a request to the Fever API of h, asking for what, with form
+func fever(t *testing.T, h http.Handler, what string, form url.Values) map[string]json.RawMessage {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "http://localhost:3000/fever/?api&"+what, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("fever returned %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp map[string]json.RawMessage
+	err := json.NewDecoder(w.Body).Decode(&resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp
+}
+
+func TestFever(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := memstore.New()
+	h := newRouter(t, s)
+
+	key, _, _ := newAccount(t, h)
+
+	ss, err := s.ListScrapes(ctx, "WAITING", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range []string{"1", "2"} {
+		err = s.Write(ctx, ss[0].ID, &hydrocarbon.Post{
+			Title:       "post " + n,
+			Body:        "<p>" + n + "</p>",
+			OriginalURL: "https://ycombinator.com/item?id=" + n,
+			PostedAt:    time.Now().Add(-time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the key is the md5 of email:password
+	sum := md5.Sum([]byte("ian@hydrocarbon.io:hunter2"))
+	apiKey := url.Values{"api_key": {hex.EncodeToString(sum[:])}}
+	if resp := fever(t, h, "", apiKey); string(resp["auth"]) != "0" {
+		t.Fatal("expected the key to be refused before a password is set")
+	}
+
+	call(t, h, key, "/v1/fever/password", `{"password": "hunter2"}`, nil)
+
+	resp := fever(t, h, "groups&feeds", apiKey)
+	if string(resp["auth"]) != "1" || string(resp["api_version"]) != "3" {
+		t.Fatalf("expected to be authenticated, got %s", resp["auth"])
+	}
+
+	var groups []*hydrocarbon.FeverGroup
+	var feeds []*hydrocarbon.FeverFeed
+	var feedsGroups []struct {
+		GroupID int64  `json:"group_id"`
+		FeedIDs string `json:"feed_ids"`
+	}
+	for k, v := range map[string]interface{}{"groups": &groups, "feeds": &feeds, "feeds_groups": &feedsGroups} {
+		err = json.Unmarshal(resp[k], v)
+		if err != nil {
+			t.Fatalf("could not decode %s: %s", k, err)
+		}
+	}
+	if len(groups) != 1 || groups[0].Title != "news" || len(feeds) != 1 || feeds[0].URL != "https://ycombinator.com" {
+		t.Fatalf("expected the folder and its feed, got %+v and %+v", groups[0], feeds[0])
+	}
+	if len(feedsGroups) != 1 || feedsGroups[0].GroupID != groups[0].ID || feedsGroups[0].FeedIDs != strconv.FormatInt(feeds[0].ID, 10) {
+		t.Fatalf("expected the feed in its group, got %+v", feedsGroups)
+	}
+
+	var items []*hydrocarbon.FeverItem
+	resp = fever(t, h, "items&since_id=0", apiKey)
+	err = json.Unmarshal(resp["items"], &items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].ID >= items[1].ID || items[0].FeedID != feeds[0].ID || items[1].HTML != "<p>2</p>" {
+		t.Fatalf("expected both posts, oldest first, got %+v", items)
+	}
+
+	resp = fever(t, h, "items&max_id="+strconv.FormatInt(items[1].ID, 10), apiKey)
+	var older []*hydrocarbon.FeverItem
+	err = json.Unmarshal(resp["items"], &older)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(older) != 1 || older[0].ID != items[0].ID {
+		t.Fatalf("expected the post before max_id, got %+v", older)
+	}
+
+	mark := url.Values{"api_key": apiKey["api_key"], "mark": {"item"}, "as": {"read"}, "id": {strconv.FormatInt(items[0].ID, 10)}}
+	resp = fever(t, h, "unread_item_ids", mark)
+	if want := `"` + strconv.FormatInt(items[1].ID, 10) + `"`; string(resp["unread_item_ids"]) != want {
+		t.Fatalf("expected only %s unread, got %s", want, resp["unread_item_ids"])
+	}
+
+	mark = url.Values{"api_key": apiKey["api_key"], "mark": {"group"}, "as": {"read"}, "id": {"0"}, "before": {strconv.FormatInt(time.Now().Unix(), 10)}}
+	resp = fever(t, h, "unread_item_ids", mark)
+	if string(resp["unread_item_ids"]) != `""` {
+		t.Fatalf("expected every post read, got %s", resp["unread_item_ids"])
+	}
+}
+
+// greader makes a request to the Google Reader API of h, returning the body of
+// the response
+func greader(t *testing.T, h http.Handler, auth, path string, form url.Values) []byte {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:3000/greader"+path, nil)
+	if form != nil {
+		req = httptest.NewRequest(http.MethodPost, "http://localhost:3000/greader"+path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", "GoogleLogin auth="+auth)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s returned %d: %s", path, w.Code, w.Body.String())
+	}
+
+	return w.Body.Bytes()
+}
+
+func TestGReader(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := memstore.New()
+	h := newRouter(t, s)
+
+	key, _, _ := newAccount(t, h)
+	call(t, h, key, "/v1/fever/password", `{"password": "hunter2"}`, nil)
+
+	ss, err := s.ListScrapes(ctx, "WAITING", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range []string{"1", "2", "3"} {
+		err = s.Write(ctx, ss[0].ID, &hydrocarbon.Post{
+			Title:       "post " + n,
+			Body:        "<p>" + n + "</p>",
+			OriginalURL: "https://ycombinator.com/item?id=" + n,
+			PostedAt:    time.Now().Add(-time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "http://localhost:3000/greader/accounts/ClientLogin", strings.NewReader("Email=ian@hydrocarbon.io&Passwd=wrong"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a wrong password to be refused, got %d", w.Code)
+	}
+
+	// clients send the email as it was typed
+	reply := string(greader(t, h, "", "/accounts/ClientLogin", url.Values{"Email": {"Ian@hydrocarbon.io"}, "Passwd": {"hunter2"}}))
+	i := strings.Index(reply, "Auth=")
+	if i == -1 {
+		t.Fatalf("no Auth in %q", reply)
+	}
+	auth := strings.TrimSpace(reply[i+len("Auth="):])
+	token := string(greader(t, h, auth, "/reader/api/0/token", nil))
+
+	var subs struct {
+		Subscriptions []struct {
+			ID         string `json:"id"`
+			Categories []struct {
+				ID string `json:"id"`
+			} `json:"categories"`
+		} `json:"subscriptions"`
+	}
+	err = json.Unmarshal(greader(t, h, auth, "/reader/api/0/subscription/list?output=json", nil), &subs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs.Subscriptions) != 1 || len(subs.Subscriptions[0].Categories) != 1 || subs.Subscriptions[0].Categories[0].ID != "user/-/label/news" {
+		t.Fatalf("expected the feed in its folder, got %+v", subs)
+	}
+
+	type stream struct {
+		Items []struct {
+			ID         string   `json:"id"`
+			Title      string   `json:"title"`
+			Categories []string `json:"categories"`
+			Origin     struct {
+				StreamID string `json:"streamId"`
+			} `json:"origin"`
+		} `json:"items"`
+		Continuation string `json:"continuation"`
+	}
+
+	// the folder is read two posts at a time, newest first
+	var page stream
+	err = json.Unmarshal(greader(t, h, auth, "/reader/api/0/stream/contents/user/-/label/news?n=2", nil), &page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 2 || page.Items[0].Title != "post 3" || page.Continuation == "" || page.Items[0].Origin.StreamID != subs.Subscriptions[0].ID {
+		t.Fatalf("expected the two newest posts and a continuation, got %+v", page)
+	}
+
+	var rest stream
+	err = json.Unmarshal(greader(t, h, auth, "/reader/api/0/stream/contents/"+subs.Subscriptions[0].ID+"?n=2&c="+page.Continuation, nil), &rest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest.Items) != 1 || rest.Items[0].Title != "post 1" || rest.Continuation != "" {
+		t.Fatalf("expected the oldest post and no continuation, got %+v", rest)
+	}
+
+	edit := url.Values{"i": {page.Items[0].ID}, "a": {"user/-/state/com.google/read", "user/-/state/com.google/starred"}}
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "http://localhost:3000/greader/reader/api/0/edit-tag", strings.NewReader(edit.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "GoogleLogin auth="+auth)
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized || w.Header().Get("X-Reader-Google-Bad-Token") != "true" {
+		t.Fatalf("expected an edit without a token to be refused, got %d", w.Code)
+	}
+
+	edit.Set("T", token)
+	if resp := string(greader(t, h, auth, "/reader/api/0/edit-tag", edit)); resp != "OK" {
+		t.Fatalf("expected OK, got %q", resp)
+	}
+
+	var ids struct {
+		ItemRefs []struct {
+			ID string `json:"id"`
+		} `json:"itemRefs"`
+	}
+	err = json.Unmarshal(greader(t, h, auth, "/reader/api/0/stream/items/ids?s=user/-/state/com.google/reading-list&xt=user/-/state/com.google/read&n=100", nil), &ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids.ItemRefs) != 2 {
+		t.Fatalf("expected two unread posts, got %+v", ids)
+	}
+
+	var starred stream
+	err = json.Unmarshal(greader(t, h, auth, "/reader/api/0/stream/contents/user/-/state/com.google/starred", nil), &starred)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(starred.Items) != 1 || starred.Items[0].ID != page.Items[0].ID {
+		t.Fatalf("expected the starred post, got %+v", starred)
+	}
+
+	greader(t, h, auth, "/reader/api/0/mark-all-as-read", url.Values{"s": {"user/-/label/news"}, "T": {token}})
+
+	var counts struct {
+		UnreadCounts []struct {
+			ID    string `json:"id"`
+			Count int    `json:"count"`
+		} `json:"unreadcounts"`
+	}
+	err = json.Unmarshal(greader(t, h, auth, "/reader/api/0/unread-count?output=json", nil), &counts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counts.UnreadCounts) != 1 || counts.UnreadCounts[0].Count != 0 {
+		t.Fatalf("expected nothing left unread, got %+v", counts)
+	}
+}
+
+func TestGRPC(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := memstore.New()
+	h := newRouter(t, s)
+
+	key := login(t, h)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ks := hydrocarbon.NewKeySigner("test")
+	srv := hydrocarbon.NewGRPCAPI(hydrocarbon.NewFeedAPI(s, newDiscollector(t), ks), hydrocarbon.NewReadStatusAPI(s, ks), nil).Server()
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	feeds, reading := rpc.NewFeedsClient(conn), rpc.NewReadingClient(conn)
+
+	_, err = feeds.ListFolders(ctx, &rpc.ListFoldersRequest{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected a call without a key to be refused, got %v", err)
+	}
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-hydrocarbon-key", key)
+	folder, err := feeds.CreateFolder(ctx, &rpc.CreateFolderRequest{Name: "news"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	feed, err := feeds.AddFeed(ctx, &rpc.AddFeedRequest{FolderId: folder.GetId(), Url: "https://ycombinator.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.GetStatus() != hydrocarbon.FeedActive {
+		t.Fatalf("expected the feed to be active, got %q", feed.GetStatus())
+	}
+
+	list, err := feeds.ListFolders(ctx, &rpc.ListFoldersRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found bool
+	for _, f := range list.GetFolders() {
+		for _, fe := range f.GetFeeds() {
+			found = found || (f.GetId() == folder.GetId() && fe.GetId() == feed.GetId())
+		}
+	}
+	if !found {
+		t.Fatalf("expected the feed in its folder, got %v", list.GetFolders())
+	}
+
+	ss, err := s.ListScrapes(ctx, "WAITING", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Write(ctx, ss[0].ID, &hydrocarbon.Post{
+		Title:       "Show HN: hydrocarbon",
+		Body:        "<p>a feed reader</p>",
+		OriginalURL: "https://ycombinator.com/item?id=1",
+		PostedAt:    time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posts, err := reading.ListPosts(ctx, &rpc.ListPostsRequest{FeedId: feed.GetId()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts.GetPosts()) != 1 || posts.GetPosts()[0].GetPostedAt() == nil {
+		t.Fatalf("expected the post, got %v", posts.GetPosts())
+	}
+
+	postID := posts.GetPosts()[0].GetId()
+	_, err = reading.MarkRead(ctx, &rpc.MarkReadRequest{PostId: postID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = reading.StarPost(ctx, &rpc.StarPostRequest{PostId: postID, Starred: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = reading.StarPost(ctx, &rpc.StarPostRequest{PostId: hydrocarbon.NewID().String(), Starred: true})
+	if err == nil {
+		t.Fatal("expected only posts of followed feeds to be starred")
+	}
+
+	post, err := reading.GetPost(ctx, &rpc.GetPostRequest{PostId: postID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.GetBody() != "<p>a feed reader</p>" || !post.GetRead() || !post.GetStarred() {
+		t.Fatalf("expected the post read and starred with its body, got %v", post)
+	}
+
+	_, err = reading.GetPost(ctx, &rpc.GetPostRequest{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected a post ID to be needed, got %v", err)
+	}
+}
+
+func TestScrapeLifecycle(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := memstore.New()
+
+	_, key := newSession(t, s, "ian@hydrocarbon.io")
+
+	_, err := s.AddFeed(ctx, key, "", "hn", "ycombinators", "https://ycombinator.com", "", &discollect.Config{
+		Type:        discollect.FullScrape,
+		Entrypoints: []string{"https://ycombinator.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ss, err := s.StartScrapes(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ss) != 1 {
+		t.Fatalf("expected 1 scrape to start, got %d", len(ss))
+	}
+
+	scrapeID := ss[0].ID
+	for i := 0; i < 3; i++ {
+		err = s.ErrorScrape(ctx, scrapeID, "https://ycombinator.com", errors.New("503"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sc, err := s.GetScrape(ctx, scrapeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.State != "DEAD" || len(sc.Errors) != 3 {
+		t.Fatalf("expected the scrape to be dead after 3 errors, got %s with %v", sc.State, sc.Errors)
+	}
+
+	err = s.RequeueScrape(ctx, scrapeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ss, err = s.StartScrapes(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ss) != 1 || ss[0].ID != scrapeID {
+		t.Fatalf("expected the requeued scrape to start, got %v", ss)
+	}
+
+	err = s.EndScrape(ctx, scrapeID, 5, 0, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pu, err := s.GetPlanUsage(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pu.Scrapes != 1 || pu.Tasks != 7 {
+		t.Fatalf("expected 1 scrape of 7 tasks metered, got %d of %d", pu.Scrapes, pu.Tasks)
+	}
+
+	sr, err := s.FindMissingSchedules(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sr) != 1 || len(sr[0].LatestScrapes) != 1 {
+		t.Fatalf("expected the feed to need a schedule, got %v", sr)
+	}
+
+	at := time.Now().Add(time.Hour)
+	sch := []*discollect.ScrapeSchedule{{Config: sc.Config, ScheduledStartAt: at}}
+	for i := 0; i < 2; i++ {
+		err = s.InsertSchedule(ctx, sr[0], sch)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waiting, err := s.ListScrapes(ctx, "WAITING", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(waiting) != 1 || !waiting[0].ScheduledStartAt.Equal(at) {
+		t.Fatalf("expected a single scheduled scrape, got %v", waiting)
+	}
+
+	// without billing nothing is limited by the free plan
+	if sr[0].MinInterval != 2*time.Hour {
+		t.Fatalf("expected the free plan to space scrapes 2h apart, got %s", sr[0].MinInterval)
+	}
+
+	s.DisablePlans()
+	pu, err = s.GetPlanUsage(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *pu.Plan != hydrocarbon.UnlimitedPlan {
+		t.Fatalf("expected the unlimited plan once plans are disabled, got %+v", pu.Plan)
+	}
+}
+
+func TestSubscriptionPlan(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := memstore.New()
+
+	id, key := newSession(t, s, "ian@hydrocarbon.io")
+
+	plan := func() string {
+		pu, err := s.GetPlanUsage(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pu.Plan.Name
+	}
+
+	err := s.SetStripeIDs(ctx, id, "cus_1", "sub_1", "hydrocarbon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := plan(); p != "pro" {
+		t.Fatalf("expected subscribing to move the user to pro, got %s", p)
+	}
+
+	err = s.UpdateSubscription(ctx, "sub_1", "unknown")
+	if err == nil {
+		t.Fatal("expected a subscription to a plan that does not exist to fail")
+	}
+
+	err = s.EndSubscription(ctx, "sub_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := plan(); p != "free" {
+		t.Fatalf("expected the end of the subscription to move the user to free, got %s", p)
+	}
+}
+
+func TestDeliverNewsletter(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := memstore.New()
+
+	var tokens []string
+	for _, email := range []string{"ian@hydrocarbon.io", "jill@hydrocarbon.io"} {
+		_, key := newSession(t, s, email)
+
+		a, err := s.CreateNewsletterAddress(ctx, key, "", "weekly", "token-"+email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, a.Token)
+	}
+
+	p := &hydrocarbon.Post{
+		Title:       "issue 1",
+		Body:        "<p>hello</p>",
+		OriginalURL: "mid:1234@mail.example.org",
+		PostedAt:    time.Now(),
+	}
+
+	// the same mail is sent to every subscriber
+	for _, token := range tokens {
+		delivered, err := s.DeliverNewsletter(ctx, token, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !delivered {
+			t.Fatalf("expected the newsletter to be delivered to %s", token)
+		}
+	}
+
+	delivered, err := s.DeliverNewsletter(ctx, tokens[0], p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivered {
+		t.Fatal("expected a newsletter delivered twice to an address to be skipped")
+	}
+}
+
+func TestFeedCredentials(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := memstore.New()
+
+	_, ian := newSession(t, s, "ian@hydrocarbon.io")
+	_, jill := newSession(t, s, "jill@hydrocarbon.io")
+
+	feedID, err := s.AddFeed(ctx, ian, "", "patrons", "ycombinators", "https://ycombinator.com", "", &discollect.Config{
+		Type:        discollect.FullScrape,
+		Entrypoints: []string{"https://ycombinator.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, ok, err := s.CheckIfFeedExists(ctx, jill, "", "ycombinators", "https://ycombinator.com", "")
+	if err != nil || !ok {
+		t.Fatalf("expected jill to follow the feed too, got %v", err)
+	}
+
+	shared, err := s.StartScrapes(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privateID, err := s.SetFeedCredentials(ctx, ian, feedID, &discollect.Credentials{Username: "ian", Password: "hunter2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if privateID == feedID {
+		t.Fatal("expected credentials on a shared feed to move ian onto a private one")
+	}
+
+	// the private feed can not be found, followed or given credentials by
+	// anyone else
+	f, ok, err := s.CheckIfFeedExists(ctx, jill, "", "ycombinators", "https://ycombinator.com", "")
+	if err != nil || !ok || f.ID != feedID {
+		t.Fatalf("expected jill to only find the shared feed, got %v", f)
+	}
+	_, err = s.SetFeedCredentials(ctx, jill, privateID, &discollect.Credentials{Username: "jill"})
+	if err == nil {
+		t.Fatal("expected credentials on a feed jill does not follow to be refused")
+	}
+	err = s.DeleteFeedCredentials(ctx, jill, privateID)
+	if err == nil {
+		t.Fatal("expected jill not to be able to delete ian's credentials")
+	}
+
+	c, err := s.GetCredentials(ctx, shared[0].ID)
+	if err != nil || c != nil {
+		t.Fatalf("expected no credentials for scrapes of the shared feed, got %v, %v", c, err)
+	}
+
+	private, err := s.StartScrapes(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(private) != 1 || private[0].FeedID.String() != privateID {
+		t.Fatalf("expected the first scrape of the private feed, got %v", private)
+	}
+
+	c, err = s.GetCredentials(ctx, private[0].ID)
+	if err != nil || c == nil || c.Username != "ian" {
+		t.Fatalf("expected ian's credentials for scrapes of the private feed, got %v, %v", c, err)
+	}
+
+	// the same post as a patron sees it is kept apart from the public one
+	err = s.Write(ctx, shared[0].ID, &hydrocarbon.Post{Title: "update", OriginalURL: "https://ycombinator.com/1", Body: "become a patron"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Write(ctx, private[0].ID, &hydrocarbon.Post{Title: "update", OriginalURL: "https://ycombinator.com/1", Body: "for patrons only"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	feed, err := s.GetFeedPosts(ctx, jill, feedID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Posts) != 1 {
+		t.Fatalf("expected jill to see a single post, got %d", len(feed.Posts))
+	}
+
+	p, err := s.GetPost(ctx, jill, feed.Posts[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Body != "become a patron" {
+		t.Fatalf("expected jill to only see the public post, got %q", p.Body)
+	}
+
+	feed, err = s.GetFeedPosts(ctx, ian, privateID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Posts) != 1 || feed.Posts[0].OriginalURL != "https://ycombinator.com/1" {
+		t.Fatalf("expected ian to see the post at its own url, got %v", feed.Posts)
+	}
+}
+
+func TestWriteInserted(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := memstore.New()
+
+	_, key := newSession(t, s, "ian@hydrocarbon.io")
+
+	_, err := s.AddFeed(ctx, key, "", "hn", "ycombinators", "https://ycombinator.com", "", &discollect.Config{
+		Type:        discollect.FullScrape,
+		Entrypoints: []string{"https://ycombinator.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ss, err := s.StartScrapes(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := &hydrocarbon.Post{Title: "hello", OriginalURL: "https://ycombinator.com/1", Body: "world"}
+	err = s.Write(ctx, ss[0].ID, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first is unchanged, the second edited and the third new
+	edited := &hydrocarbon.Post{Title: "hello", OriginalURL: "https://ycombinator.com/2", Body: "world"}
+	err = s.Write(ctx, ss[0].ID, &hydrocarbon.Post{Title: "hi", OriginalURL: "https://ycombinator.com/2", Body: "there"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited.Body = "everyone"
+	added := &hydrocarbon.Post{Title: "bye", OriginalURL: "https://ycombinator.com/3", Body: "world"}
+
+	inserted, err := s.WriteInserted(ctx, ss[0].ID, []interface{}{first, edited, added})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inserted) != 1 || inserted[0] != added {
+		t.Fatalf("expected only the new post to be inserted, got %v", inserted)
+	}
+}
+
+func TestSubscribeChanges(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := memstore.New()
+
+	_, key := newSession(t, s, "ian@hydrocarbon.io")
+
+	changes, err := s.SubscribeChanges(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	feedID, err := s.AddFeed(ctx, key, "", "hn", "ycombinators", "https://ycombinator.com", "", &discollect.Config{
+		Type:        discollect.FullScrape,
+		Entrypoints: []string{"https://ycombinator.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ss, err := s.StartScrapes(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ss) != 1 {
+		t.Fatalf("expected 1 scrape to start, got %d", len(ss))
+	}
+
+	err = s.Write(ctx, ss[0].ID, &hydrocarbon.Post{Title: "hello", OriginalURL: "https://ycombinator.com/1", Body: "world"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, kind := range []string{hydrocarbon.ChangeFollow, hydrocarbon.ChangeScrape, hydrocarbon.ChangePost} {
+		c := <-changes
+		if c.Kind != kind || c.FeedID != feedID {
+			t.Fatalf("expected a %s change to %s, got %+v", kind, feedID, c)
+		}
+	}
+
+	cancel()
+	for range changes {
+	}
+}
+
+func TestLive(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := memstore.New()
+	h := newRouter(t, s)
+
+	key, _, feedID := newAccount(t, h)
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+	_, _, err := websocket.DefaultDialer.Dial(wsURL+"?key=nope", nil)
+	if err == nil {
+		t.Fatal("expected a websocket without a valid key to be refused")
+	}
+
+	// as a browser would, which can not set the header
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+"?key="+url.QueryEscape(key), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	next := func(kind string) *hydrocarbon.Change {
+		t.Helper()
+
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var c hydrocarbon.Change
+		err := conn.ReadJSON(&c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Kind != kind || c.FeedID != feedID {
+			t.Fatalf("expected a %s change to %s, got %+v", kind, feedID, c)
+		}
+
+		return &c
+	}
+
+	ss, err := s.StartScrapes(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ss) != 1 {
+		t.Fatalf("expected 1 scrape to start, got %d", len(ss))
+	}
+
+	err = s.Write(ctx, ss[0].ID, &hydrocarbon.Post{Title: "hello", OriginalURL: "https://ycombinator.com/1", Body: "world"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the scrape starting is not pushed, only it finishing
+	post := next(hydrocarbon.ChangePost)
+
+	err = s.EndScrape(ctx, ss[0].ID, 1, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c := next(hydrocarbon.ChangeScrape); c.State != "SUCCESS" {
+		t.Fatalf("expected the scrape to succeed, got %q", c.State)
+	}
+
+	call(t, h, key, "/v1/post/read", `{"post_id": "`+post.ID+`"}`, nil)
+	if c := next(hydrocarbon.ChangeRead); c.ID != post.ID || c.State != "read" {
+		t.Fatalf("expected the post to be read, got %+v", c)
+	}
+}
+
+func TestExport(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := memstore.New()
+	h := newRouter(t, s)
+
+	key, folderID, feedID := newAccount(t, h)
+
+	ss, err := s.ListScrapes(ctx, "WAITING", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Write(ctx, ss[0].ID, &hydrocarbon.Post{
+		Title:       "Show HN: hydrocarbon",
+		Author:      "pg",
+		Body:        "<p>a feed reader</p>",
+		OriginalURL: "https://ycombinator.com/item?id=1",
+		PostedAt:    time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var export struct {
+		Atom string `json:"atom"`
+		JSON string `json:"json"`
+	}
+	call(t, h, key, "/v1/folder/export", `{"folder_id": "`+folderID+`", "export": true}`, &export)
+
+	get := func(u string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, u, nil))
+		return w
+	}
+
+	w := get(export.Atom)
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/atom+xml") {
+		t.Fatalf("expected an atom feed, got %q: %s", ct, w.Body.String())
+	}
+
+	atom, err := gofeed.NewParser().Parse(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if atom.FeedType != "atom" || atom.Title != "news" || len(atom.Items) != 1 {
+		t.Fatalf("expected the folder with its post, got %+v", atom)
+	}
+	if it := atom.Items[0]; it.Title != "Show HN: hydrocarbon" || it.Content != "<p>a feed reader</p>" || it.Link != "https://ycombinator.com/item?id=1" {
+		t.Fatalf("expected the post with its body, got %+v", it)
+	}
+
+	jsonFeed := func(u string) *gofeed.Feed {
+		t.Helper()
+
+		w := get(u)
+		if ct := w.Header().Get("Content-Type"); ct != "application/feed+json" {
+			t.Fatalf("expected a json feed, got %q: %s", ct, w.Body.String())
+		}
+
+		var version struct {
+			Version string `json:"version"`
+		}
+		err := json.Unmarshal(w.Body.Bytes(), &version)
+		if err != nil || version.Version != "https://jsonfeed.org/version/1.1" {
+			t.Fatalf("expected json feed 1.1, got %s", w.Body.String())
+		}
+
+		f, err := gofeed.NewParser().Parse(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.FeedType != "json" || len(f.Items) != 1 || f.Items[0].Content != "<p>a feed reader</p>" {
+			t.Fatalf("expected the post with its body, got %+v", f)
+		}
+
+		return f
+	}
+
+	if f := jsonFeed(export.JSON); f.Title != "news" {
+		t.Fatalf("expected the folder, got %q", f.Title)
+	}
+
+	var feedExport struct {
+		JSON string `json:"json"`
+	}
+	call(t, h, key, "/v1/feed/export", `{"feed_id": "`+feedID+`"}`, &feedExport)
+	if f := jsonFeed(feedExport.JSON); f.Title != "gotem" {
+		t.Fatalf("expected the feed, got %q", f.Title)
+	}
+
+	if w := get(strings.Replace(feedExport.JSON, feedID, folderID, 1)); !strings.Contains(w.Body.String(), "invalid signature") {
+		t.Fatalf("expected a url that was not signed to be refused, got %s", w.Body.String())
+	}
+
+	// exporting again replaces the url, revoking the old one
+	old := export.Atom
+	call(t, h, key, "/v1/folder/export", `{"folder_id": "`+folderID+`", "export": true}`, &export)
+	if export.Atom == old {
+		t.Fatal("expected a new url")
+	}
+	if w := get(old); !strings.Contains(w.Body.String(), "no exported folder found") {
+		t.Fatalf("expected the old url to be revoked, got %s", w.Body.String())
+	}
+
+	call(t, h, key, "/v1/folder/export", `{"folder_id": "`+folderID+`", "export": false}`, nil)
+	if w := get(export.Atom); !strings.Contains(w.Body.String(), "no exported folder found") {
+		t.Fatalf("expected the folder to no longer be exported, got %s", w.Body.String())
+	}
+
+	sessionKey, err := hydrocarbon.NewKeySigner("test").Verify(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.RemoveFeed(ctx, sessionKey, folderID, feedID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := get(feedExport.JSON); !strings.Contains(w.Body.String(), "feed not found") {
+		t.Fatalf("expected the feed to no longer be exported once unfollowed, got %s", w.Body.String())
+	}
+}
+
+func TestCouponRedemption(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := memstore.New()
+	userID, _ := newSession(t, s, "ian@hydrocarbon.io")
+
+	for i, expected := range []bool{true, false} {
+		recorded, err := s.RecordCouponRedemption(ctx, userID, "LAUNCH")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if recorded != expected {
+			t.Fatalf("expected redemption %d to be recorded: %t", i, expected)
+		}
+	}
+
+	err := s.DeleteCouponRedemption(ctx, userID, "LAUNCH")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorded, err := s.RecordCouponRedemption(ctx, userID, "LAUNCH")
+	if err != nil || !recorded {
+		t.Fatalf("expected a code that was not applied to be redeemable again, got %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package memstore
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+type newsletter struct {
+	hydrocarbon.NewsletterAddress
+	userID string
+}
+
+// CreateNewsletterAddress adds a private feed to the folder and an address
+// delivering into it
+func (s *Store) CreateNewsletterAddress(ctx context.Context, sessionKey, folderID, title, token string) (*hydrocarbon.NewsletterAddress, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userFor(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// newsletter feeds are never shared between users, so they are not public
+	f := &feed{
+		Feed: hydrocarbon.Feed{
+			Title:   title,
+			Plugin:  hydrocarbon.NewsletterPlugin,
+			BaseURL: "mailto:" + token,
+		},
+	}
+	s.addFeed(u, folderID, f)
+
+	n := &newsletter{
+		NewsletterAddress: hydrocarbon.NewsletterAddress{
+			ID:        uuid.New().String(),
+			CreatedAt: time.Now(),
+			Token:     token,
+			FeedID:    f.ID,
+			Title:     title,
+		},
+		userID: u.id,
+	}
+	s.newsletters[n.ID] = n
+
+	a := n.NewsletterAddress
+	return &a, nil
+}
+
+// ListNewsletterAddresses returns the newsletter addresses of the user, newest
+// first
+func (s *Store) ListNewsletterAddresses(ctx context.Context, sessionKey string) ([]*hydrocarbon.NewsletterAddress, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	as := make([]*hydrocarbon.NewsletterAddress, 0)
+
+	u, err := s.userFor(sessionKey)
+	if err != nil {
+		return as, nil
+	}
+
+	for _, n := range s.newsletters {
+		if n.userID != u.id || s.feedDeleted(n.FeedID) {
+			continue
+		}
+
+		a := n.NewsletterAddress
+		a.Title = s.feeds[n.FeedID].Title
+		as = append(as, &a)
+	}
+
+	sort.Slice(as, func(i, j int) bool {
+		return as[i].CreatedAt.After(as[j].CreatedAt)
+	})
+
+	return as, nil
+}
+
+// DeleteNewsletterAddress deletes an address of the user, leaving its feed
+func (s *Store) DeleteNewsletterAddress(ctx context.Context, sessionKey, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userFor(sessionKey)
+	if err != nil {
+		return errors.New("newsletter address not found")
+	}
+
+	n, ok := s.newsletters[id]
+	if !ok || n.userID != u.id {
+		return errors.New("newsletter address not found")
+	}
+
+	delete(s.newsletters, id)
+	return nil
+}
+
+// DeliverNewsletter adds a post to the feed of the address token, mail already
+// delivered to it by url or content is skipped. It is scoped to the feed as in
+// pg, where urls are only unique within their scope
+func (s *Store) DeliverNewsletter(ctx context.Context, token string, hp *hydrocarbon.Post) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var feedID string
+	for _, n := range s.newsletters {
+		if n.Token == token {
+			feedID = n.FeedID
+			break
+		}
+	}
+	if feedID == "" {
+		return false, nil
+	}
+
+	hash := hp.ContentHash()
+	if s.postWhere(func(p *post) bool {
+		return p.scope == feedID && (p.OriginalURL == hp.OriginalURL || p.contentHash == hash)
+	}) != nil {
+		return false, nil
+	}
+
+	p := s.insertPost(feedID, hp)
+	p.scope = feedID
+	s.transform(ctx, p.ID, feedID, hp)
+
+	return true, nil
+}
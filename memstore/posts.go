@@ -0,0 +1,514 @@
+package memstore
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+type post struct {
+	hydrocarbon.Post
+	feedID      string
+	contentHash string
+	// externalKey is the external ID of the post prefixed with its plugin
+	externalKey string
+	// scope is the ID of the feed of posts of private feeds, whose url,
+	// content and external ID only need to be unique within it
+	scope string
+
+	// deletedAt is zero unless the post has been deleted
+	deletedAt time.Time
+}
+
+// hidden returns true if the post, or the feed it is from, has been deleted
+func (s *Store) hidden(p *post) bool {
+	return !p.deletedAt.IsZero() || s.feedDeleted(p.feedID)
+}
+
+// an overlay is the output of the transform of a user for a post
+type overlay struct {
+	feedID string
+	title  string
+	author string
+	body   string
+	tags   []string
+}
+
+// postWhere returns the first post matching fn
+func (s *Store) postWhere(fn func(p *post) bool) *post {
+	for _, p := range s.posts {
+		if fn(p) {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// insertPost stores a new post of a feed
+func (s *Store) insertPost(feedID string, hp *hydrocarbon.Post) *post {
+	now := time.Now()
+	p := &post{
+		Post: hydrocarbon.Post{
+			ID:          hydrocarbon.NewID().String(),
+			CreatedAt:   now,
+			UpdatedAt:   now,
+			PostedAt:    hp.PostedAt,
+			OriginalURL: hp.OriginalURL,
+			Title:       hp.Title,
+			Author:      hp.Author,
+			Body:        hp.Body,
+			License:     hp.License,
+			Attribution: hp.Attribution,
+			Backfilled:  hp.Backfilled,
+		},
+		feedID:      feedID,
+		contentHash: hp.ContentHash(),
+	}
+	s.posts[p.ID] = p
+	s.notifyPost(p)
+
+	return p
+}
+
+// update replaces the contents of a post with those of hp
+func (p *post) update(hp *hydrocarbon.Post) {
+	p.Title = hp.Title
+	p.Author = hp.Author
+	p.Body = hp.Body
+	p.OriginalURL = hp.OriginalURL
+	p.License = hp.License
+	p.Attribution = hp.Attribution
+	p.UpdatedAt = time.Now()
+	p.contentHash = hp.ContentHash()
+}
+
+// Write saves a post written by a scrape
+func (s *Store) Write(ctx context.Context, scrapeID uuid.UUID, f interface{}) error {
+	_, err := s.write(ctx, scrapeID, f)
+	return err
+}
+
+// WriteInserted writes every post, returning those that were not already
+// stored
+func (s *Store) WriteInserted(ctx context.Context, scrapeID uuid.UUID, fs []interface{}) ([]interface{}, error) {
+	var inserted []interface{}
+	for _, f := range fs {
+		ok, err := s.write(ctx, scrapeID, f)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			inserted = append(inserted, f)
+		}
+	}
+
+	return inserted, nil
+}
+
+// write saves off the post, returning whether it was inserted
+func (s *Store) write(ctx context.Context, scrapeID uuid.UUID, f interface{}) (bool, error) {
+	hcp, ok := f.(*hydrocarbon.Post)
+	if !ok {
+		return false, errors.New("unable to write non *hydrocarbon.Post struct")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sc, ok := s.scrapes[scrapeID]
+	if !ok {
+		return false, errors.New("no scrape exists with that id")
+	}
+
+	if s.sanitizer != nil {
+		hcp.Body = s.sanitizer.Sanitize(sc.Plugin, hcp.Body)
+	}
+
+	// posts of private feeds are scoped to the feed, as pg scopes them, so
+	// they never write over the posts of a feed others follow
+	var scope string
+	if f, ok := s.feeds[sc.FeedID.String()]; ok && !f.public {
+		scope = f.ID
+	}
+	hash := hcp.ContentHash()
+	var externalKey string
+	if hcp.ExternalID != "" {
+		externalKey = sc.Plugin + ":" + hcp.ExternalID
+	}
+
+	if s.postWhere(func(p *post) bool {
+		return p.scope == scope && p.OriginalURL == hcp.OriginalURL && p.contentHash == hash
+	}) != nil {
+		return false, nil
+	}
+
+	// posts with an external ID are updated in place, even if their url has
+	// changed
+	if externalKey != "" {
+		if p := s.postWhere(func(p *post) bool { return p.scope == scope && p.externalKey == externalKey }); p != nil {
+			p.update(hcp)
+			s.notifyPost(p)
+			s.transform(ctx, p.ID, p.feedID, hcp)
+			return false, nil
+		}
+	}
+
+	if s.postWhere(func(p *post) bool { return p.scope == scope && p.contentHash == hash }) != nil {
+		return false, nil
+	}
+
+	p := s.postWhere(func(p *post) bool { return p.scope == scope && p.OriginalURL == hcp.OriginalURL })
+	inserted := p == nil
+	if inserted {
+		p = s.insertPost(sc.FeedID.String(), hcp)
+		p.scope = scope
+	} else {
+		p.update(hcp)
+		s.notifyPost(p)
+	}
+	if externalKey != "" {
+		p.externalKey = externalKey
+	}
+
+	s.transform(ctx, p.ID, p.feedID, hcp)
+	return inserted, nil
+}
+
+// Close implements io.Closer
+func (s *Store) Close() error {
+	return nil
+}
+
+// ImportPosts adds backfilled posts to a feed only the user follows, posts that
+// already exist by url or content are left as they are
+func (s *Store) ImportPosts(ctx context.Context, sessionKey, feedID string, posts []*hydrocarbon.Post) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, f, err := s.followedFeed(sessionKey, feedID)
+	if err != nil {
+		return 0, err
+	}
+	if len(s.followersOf(feedID)) > 1 {
+		return 0, errors.New("posts can only be imported into feeds no one else follows")
+	}
+
+	var n int
+	for _, hp := range posts {
+		if strings.HasPrefix(hp.OriginalURL, "#") {
+			hp.OriginalURL = f.BaseURL + hp.OriginalURL
+		}
+
+		// scoped as the posts scraped into a private feed are
+		var scope string
+		if !f.public {
+			scope = f.ID
+		}
+
+		hash := hp.ContentHash()
+		if s.postWhere(func(p *post) bool {
+			return p.scope == scope && (p.OriginalURL == hp.OriginalURL || p.contentHash == hash)
+		}) != nil {
+			continue
+		}
+
+		p := s.insertPost(f.ID, hp)
+		p.scope = scope
+		p.Backfilled = true
+		s.transform(ctx, p.ID, f.ID, hp)
+		n++
+	}
+
+	return n, nil
+}
+
+// view returns a copy of a post as the user sees it, with the output of their
+// transform
+func (s *Store) view(userID string, p *post) *hydrocarbon.Post {
+	cp := p.Post
+	cp.Read = s.reads[[2]string{userID, p.ID}]
+	cp.Starred = s.stars[[2]string{userID, p.ID}]
+	cp.Sources = append([]*hydrocarbon.PostSource(nil), p.Sources...)
+
+	if ov, ok := s.overlays[[2]string{userID, p.ID}]; ok {
+		cp.Title = ov.title
+		cp.Author = ov.author
+		cp.Body = ov.body
+		cp.Tags = ov.tags
+	}
+
+	return &cp
+}
+
+// GetFeedPosts returns the posts of a feed, newest first and without bodies
+func (s *Store) GetFeedPosts(ctx context.Context, sessionKey, feedID string, limit, offset int) (*hydrocarbon.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f := &hydrocarbon.Feed{
+		ID:    feedID,
+		Posts: make([]*hydrocarbon.Post, 0),
+	}
+
+	u, err := s.userFor(sessionKey)
+	if err != nil {
+		return f, nil
+	}
+	if s.feedDeleted(feedID) {
+		return f, nil
+	}
+
+	var posts []*post
+	for _, p := range s.posts {
+		if (p.feedID == feedID || p.sourcedFrom(feedID)) && !s.hidden(p) {
+			posts = append(posts, p)
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].PostedAt.After(posts[j].PostedAt)
+	})
+
+	start, end := pageOf(len(posts), limit, offset)
+	for _, p := range posts[start:end] {
+		v := s.view(u.id, p)
+		f.Posts = append(f.Posts, &hydrocarbon.Post{
+			ID:          v.ID,
+			Title:       v.Title,
+			Author:      v.Author,
+			OriginalURL: v.OriginalURL,
+			PostedAt:    v.PostedAt,
+			Tags:        v.Tags,
+			Read:        v.Read,
+			Starred:     v.Starred,
+		})
+	}
+
+	return f, nil
+}
+
+// sourcedFrom returns true if a near-duplicate of the post was seen in the
+// feed
+func (p *post) sourcedFrom(feedID string) bool {
+	for _, ps := range p.Sources {
+		if ps.FeedID == feedID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetPost returns a single post
+func (s *Store) GetPost(ctx context.Context, sessionKey, postID string) (*hydrocarbon.Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.getPost(sessionKey, postID)
+}
+
+func (s *Store) getPost(sessionKey, postID string) (*hydrocarbon.Post, error) {
+	u, err := s.userFor(sessionKey)
+	if err != nil {
+		return nil, errors.New("no post found")
+	}
+
+	p, ok := s.posts[postID]
+	if !ok || s.hidden(p) {
+		return nil, errors.New("no post found")
+	}
+
+	v := s.view(u.id, p)
+	v.CreatedAt = time.Time{}
+	v.UpdatedAt = time.Time{}
+
+	return v, nil
+}
+
+// GetPostByExternalID returns the post a plugin gave the external ID
+func (s *Store) GetPostByExternalID(ctx context.Context, sessionKey, plugin, externalID string) (*hydrocarbon.Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := plugin + ":" + externalID
+	p := s.postWhere(func(p *post) bool { return p.scope == "" && p.externalKey == key })
+	if p == nil {
+		return nil, errors.New("no post found")
+	}
+
+	v, err := s.getPost(sessionKey, p.ID)
+	if err != nil {
+		return nil, err
+	}
+	v.ExternalID = externalID
+
+	return v, nil
+}
+
+// MarkRead marks a post read for the user
+func (s *Store) MarkRead(ctx context.Context, sessionKey, postID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userFor(sessionKey)
+	if err != nil {
+		return err
+	}
+
+	s.setRead(u.id, postID, true)
+	return nil
+}
+
+// StarPost stars or unstars a post for the user, only posts of feeds they
+// follow can be starred
+func (s *Store) StarPost(ctx context.Context, sessionKey, postID string, starred bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userFor(sessionKey)
+	if err != nil {
+		return err
+	}
+
+	if starred {
+		p, ok := s.posts[postID]
+		if !ok || !s.followedBy(u.id, p.feedID) {
+			return errors.New("post not found")
+		}
+
+		s.stars[[2]string{u.id, postID}] = true
+	} else {
+		delete(s.stars, [2]string{u.id, postID})
+	}
+
+	return nil
+}
+
+// GetPublicFeedPosts returns up to limit posts of a public feed updated after
+// the post with the given update time and ID, with their bodies
+func (s *Store) GetPublicFeedPosts(ctx context.Context, feedID string, after time.Time, afterID string, limit int) ([]*hydrocarbon.Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	posts := make([]*hydrocarbon.Post, 0)
+	if f, ok := s.feeds[feedID]; !ok || !f.public || !f.deletedAt.IsZero() {
+		return posts, nil
+	}
+
+	for _, p := range s.posts {
+		if p.feedID != feedID || !p.deletedAt.IsZero() {
+			continue
+		}
+		if p.UpdatedAt.Before(after) || (p.UpdatedAt.Equal(after) && p.ID <= afterID) {
+			continue
+		}
+
+		cp := p.Post
+		cp.Sources = nil
+		posts = append(posts, &cp)
+	}
+
+	sort.Slice(posts, func(i, j int) bool {
+		if !posts[i].UpdatedAt.Equal(posts[j].UpdatedAt) {
+			return posts[i].UpdatedAt.Before(posts[j].UpdatedAt)
+		}
+		return posts[i].ID < posts[j].ID
+	})
+
+	start, end := pageOf(len(posts), limit, 0)
+	return posts[start:end], nil
+}
+
+// SetFeedTransform sets or removes the users transform for a feed they
+// follow, dropping everything the previous script output
+func (s *Store) SetFeedTransform(ctx context.Context, sessionKey, feedID, script string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, f, err := s.followedFeed(sessionKey, feedID)
+	if err != nil {
+		return err
+	}
+
+	if script == "" {
+		delete(s.transforms, [2]string{u.id, f.ID})
+	} else {
+		s.transforms[[2]string{u.id, f.ID}] = &hydrocarbon.FeedTransform{
+			FeedID:    f.ID,
+			Script:    script,
+			UpdatedAt: time.Now(),
+		}
+	}
+
+	for k, ov := range s.overlays {
+		if k[0] == u.id && ov.feedID == f.ID {
+			delete(s.overlays, k)
+		}
+	}
+
+	return nil
+}
+
+// GetFeedTransform returns the users transform for a feed, with an empty
+// script if they have none
+func (s *Store) GetFeedTransform(ctx context.Context, sessionKey, feedID string) (*hydrocarbon.FeedTransform, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userFor(sessionKey)
+	if err != nil {
+		return &hydrocarbon.FeedTransform{FeedID: feedID}, nil
+	}
+
+	ft, ok := s.transforms[[2]string{u.id, feedID}]
+	if !ok {
+		return &hydrocarbon.FeedTransform{FeedID: feedID}, nil
+	}
+
+	cp := *ft
+	return &cp, nil
+}
+
+// transform runs the transform of every user following the feed of a newly
+// written post, saving the output as an overlay of the post. Failures are
+// recorded against the transform rather than failing the write
+func (s *Store) transform(ctx context.Context, postID, feedID string, p *hydrocarbon.Post) {
+	for _, userID := range s.followersOf(feedID) {
+		ft, ok := s.transforms[[2]string{userID, feedID}]
+		if !ok {
+			continue
+		}
+
+		t, err := hydrocarbon.CompileTransform(ft.Script)
+		if err != nil {
+			ft.LastError = err.Error()
+			continue
+		}
+
+		out, err := t.Apply(ctx, p)
+		if err != nil {
+			ft.LastError = err.Error()
+			continue
+		}
+
+		tags := out.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+
+		s.overlays[[2]string{userID, postID}] = &overlay{
+			feedID: feedID,
+			title:  out.Title,
+			author: out.Author,
+			body:   out.Body,
+			tags:   tags,
+		}
+	}
+}
@@ -0,0 +1,541 @@
+package memstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fortytw2/hydrocarbon"
+	"github.com/fortytw2/hydrocarbon/discollect"
+)
+
+// scrapes of the same plugin and config scheduled closer together than this
+// are the same scrape, whatever their exact start times
+const scheduleDedupWindow = 2 * time.Minute
+
+var errNoScrape = errors.New("no scrape exists with that id")
+
+type pausedTasks struct {
+	tasks  []*discollect.QueuedTask
+	status *discollect.ScrapeStatus
+}
+
+// addScrape schedules a scrape of a feed
+func (s *Store) addScrape(feedID, plugin string, c *discollect.Config, at time.Time) *discollect.Scrape {
+	sc := &discollect.Scrape{
+		ID:               hydrocarbon.NewID(),
+		FeedID:           uuid.MustParse(feedID),
+		CreatedAt:        time.Now(),
+		ScheduledStartAt: at,
+		State:            "WAITING",
+		Errors:           []string{},
+		Priority:         c.Priority(),
+		Plugin:           plugin,
+		Config:           c,
+	}
+	s.scrapes[sc.ID] = sc
+
+	return sc
+}
+
+// scrapesOf returns every scrape of a feed, oldest first
+func (s *Store) scrapesOf(feedID string) []*discollect.Scrape {
+	var scrapes []*discollect.Scrape
+	for _, sc := range s.scrapes {
+		if sc.FeedID.String() == feedID {
+			scrapes = append(scrapes, sc)
+		}
+	}
+
+	sort.Slice(scrapes, func(i, j int) bool {
+		return scrapes[i].CreatedAt.Before(scrapes[j].CreatedAt)
+	})
+
+	return scrapes
+}
+
+// underQuota returns true if any follower of the feed has scrapes left this
+// billing period
+func (s *Store) underQuota(feedID string) bool {
+	if s.unlimited {
+		return true
+	}
+
+	ps := periodStart()
+	for _, userID := range s.followersOf(feedID) {
+		var used int
+		if us, ok := s.usage[usageKey{userID, ps}]; ok {
+			used = us.scrapes
+		}
+
+		if used < s.plans[s.users[userID].plan].MaxScrapes {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StartScrapes moves up to limit waiting scrapes that are due to RUNNING,
+// highest priority first. Scrapes handed back by a node that shut down pick up
+// their saved tasks
+func (s *Store) StartScrapes(ctx context.Context, limit int) ([]*discollect.Scrape, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	var due []*discollect.Scrape
+	for _, sc := range s.scrapes {
+		if sc.State == "WAITING" && !sc.ScheduledStartAt.After(now) && len(sc.Errors) < maxScrapeErrors && !s.feedDeleted(sc.FeedID.String()) && s.underQuota(sc.FeedID.String()) {
+			due = append(due, sc)
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		if due[i].Priority != due[j].Priority {
+			return due[i].Priority > due[j].Priority
+		}
+		return due[i].ScheduledStartAt.Before(due[j].ScheduledStartAt)
+	})
+
+	start, end := pageOf(len(due), limit, 0)
+
+	var ss []*discollect.Scrape
+	for _, sc := range due[start:end] {
+		s.setState(sc, "RUNNING")
+		sc.StartedAt = now
+
+		cp := *sc
+		if pt, ok := s.paused[sc.ID]; ok {
+			cp.RequeuedTasks = pt.tasks
+			cp.RequeuedStatus = pt.status
+			delete(s.paused, sc.ID)
+		}
+		ss = append(ss, &cp)
+	}
+
+	return ss, nil
+}
+
+// ListScrapes lists the scrapes in the given state, oldest first
+func (s *Store) ListScrapes(ctx context.Context, statusFilter string, limit, offset int) ([]*discollect.Scrape, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var scrapes []*discollect.Scrape
+	for _, sc := range s.scrapes {
+		if sc.State == statusFilter {
+			cp := *sc
+			scrapes = append(scrapes, &cp)
+		}
+	}
+
+	sort.Slice(scrapes, func(i, j int) bool {
+		return scrapes[i].CreatedAt.Before(scrapes[j].CreatedAt)
+	})
+
+	start, end := pageOf(len(scrapes), limit, offset)
+	return scrapes[start:end], nil
+}
+
+// GetScrape returns a single scrape
+func (s *Store) GetScrape(ctx context.Context, id uuid.UUID) (*discollect.Scrape, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sc, ok := s.scrapes[id]
+	if !ok {
+		return nil, errNoScrape
+	}
+
+	cp := *sc
+	return &cp, nil
+}
+
+// FindMissingSchedules returns what schedulers need to know of up to limit
+// feeds that have no scrape waiting
+func (s *Store) FindMissingSchedules(ctx context.Context, limit int) ([]*discollect.ScheduleRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]string, 0, len(s.feeds))
+	for id, f := range s.feeds {
+		if f.deletedAt.IsZero() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	var sr []*discollect.ScheduleRequest
+	for _, id := range ids {
+		if limit >= 0 && len(sr) >= limit {
+			break
+		}
+
+		var (
+			waiting bool
+			latest  []*discollect.Scrape
+		)
+		for _, sc := range s.scrapesOf(id) {
+			if sc.State == "WAITING" {
+				waiting = true
+				break
+			}
+			// backfills are one-off, schedulers never continue from them
+			if sc.Config.Type != discollect.BackfillScrape {
+				cp := *sc
+				latest = append(latest, &cp)
+			}
+		}
+		if waiting || len(latest) == 0 {
+			continue
+		}
+
+		sort.Slice(latest, func(i, j int) bool {
+			return latest[i].ScheduledStartAt.After(latest[j].ScheduledStartAt)
+		})
+		if len(latest) > 10 {
+			latest = latest[:10]
+		}
+
+		var posts []*hydrocarbon.Post
+		for _, p := range s.posts {
+			if p.feedID == id {
+				cp := p.Post
+				posts = append(posts, &cp)
+			}
+		}
+		sort.Slice(posts, func(i, j int) bool {
+			return posts[i].PostedAt.After(posts[j].PostedAt)
+		})
+		if len(posts) > 10 {
+			posts = posts[:10]
+		}
+
+		req := &discollect.ScheduleRequest{
+			FeedID:        uuid.MustParse(id),
+			Plugin:        s.feeds[id].Plugin,
+			LatestScrapes: latest,
+			LatestDatums:  posts,
+			PostTimes:     make([]time.Time, 0, len(posts)),
+			MinInterval:   s.minInterval(id),
+			Schedule:      s.feeds[id].schedule,
+		}
+		for _, p := range posts {
+			req.PostTimes = append(req.PostTimes, p.PostedAt)
+		}
+		if len(posts) > 0 {
+			req.LatestPostAt = posts[0].PostedAt
+		}
+
+		sr = append(sr, req)
+	}
+
+	return sr, nil
+}
+
+// minInterval returns the shortest scrape interval of the plans of the
+// followers of a feed, zero if it has none
+func (s *Store) minInterval(feedID string) time.Duration {
+	if s.unlimited {
+		return 0
+	}
+
+	var min time.Duration
+	for _, userID := range s.followersOf(feedID) {
+		interval := s.plans[s.users[userID].plan].MinScrapeInterval
+		if min == 0 || interval < min {
+			min = interval
+		}
+	}
+
+	return min
+}
+
+// InsertSchedule inserts all the schedules, skipping any identical to a scrape
+// already scheduled within scheduleDedupWindow of it
+func (s *Store) InsertSchedule(ctx context.Context, sr *discollect.ScheduleRequest, ss []*discollect.ScrapeSchedule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sch := range ss {
+		if s.scheduled(sr.Plugin, sch) {
+			continue
+		}
+
+		s.addScrape(sr.FeedID.String(), sr.Plugin, sch.Config, sch.ScheduledStartAt)
+	}
+
+	return nil
+}
+
+// scheduled returns true if a scrape of the plugin with the same config is
+// already scheduled close to sch
+func (s *Store) scheduled(plugin string, sch *discollect.ScrapeSchedule) bool {
+	for _, sc := range s.scrapes {
+		if sc.Plugin != plugin {
+			continue
+		}
+
+		gap := sc.ScheduledStartAt.Sub(sch.ScheduledStartAt)
+		if gap < scheduleDedupWindow && gap > -scheduleDedupWindow && sameConfig(sc.Config, sch.Config) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sameConfig compares configs as postgres does, by their JSON
+func sameConfig(a, b *discollect.Config) bool {
+	ab, aErr := json.Marshal(a)
+	bb, bErr := json.Marshal(b)
+	if aErr != nil || bErr != nil {
+		return reflect.DeepEqual(a, b)
+	}
+
+	return string(ab) == string(bb)
+}
+
+// EndScrape marks a scrape as SUCCESS, records the number of datums and
+// tasks returned and meters the scrape against every user following the feed
+func (s *Store) EndScrape(ctx context.Context, id uuid.UUID, datums, retries, tasks int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sc, ok := s.scrapes[id]
+	if !ok {
+		return errNoScrape
+	}
+
+	s.setState(sc, "SUCCESS")
+	sc.EndedAt = time.Now()
+	sc.TotalDatums = datums
+	sc.TotalRetries = retries
+	sc.TotalTasks = tasks
+
+	ps := periodStart()
+	for _, userID := range s.followersOf(sc.FeedID.String()) {
+		k := usageKey{userID, ps}
+		us, ok := s.usage[k]
+		if !ok {
+			us = &usage{}
+			s.usage[k] = us
+		}
+
+		us.scrapes++
+		us.tasks += tasks
+	}
+
+	return nil
+}
+
+// ErrorScrape adds the error to a scrape's list and either puts it back to
+// WAITING, behind an exponential backoff of 5, 25, ... minutes, or moves it to
+// DEAD once it has failed maxScrapeErrors times
+func (s *Store) ErrorScrape(ctx context.Context, id uuid.UUID, lastFailedURL string, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sc, ok := s.scrapes[id]
+	if !ok {
+		return errNoScrape
+	}
+
+	now := time.Now()
+	if len(sc.Errors)+1 < maxScrapeErrors {
+		s.setState(sc, "WAITING")
+		sc.ScheduledStartAt = now.Add(5 * time.Minute * time.Duration(math.Pow(5, float64(len(sc.Errors)))))
+	} else {
+		s.setState(sc, "DEAD")
+	}
+	sc.Errors = append(sc.Errors, err.Error())
+	sc.EndedAt = now
+	sc.LastFailedURL = lastFailedURL
+
+	return nil
+}
+
+// PauseScrape moves a running scrape to PAUSED and saves its pending tasks
+func (s *Store) PauseScrape(ctx context.Context, id uuid.UUID, tasks []*discollect.QueuedTask, status *discollect.ScrapeStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sc, err := s.saveTasks(id, tasks, status)
+	if err != nil {
+		return err
+	}
+
+	s.setState(sc, "PAUSED")
+	return nil
+}
+
+// HandBackScrape moves a running scrape back to WAITING and saves its pending
+// tasks, StartScrapes hands them back once it is started again
+func (s *Store) HandBackScrape(ctx context.Context, id uuid.UUID, tasks []*discollect.QueuedTask, status *discollect.ScrapeStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sc, err := s.saveTasks(id, tasks, status)
+	if err != nil {
+		return err
+	}
+
+	s.setState(sc, "WAITING")
+	sc.ScheduledStartAt = time.Now()
+	return nil
+}
+
+// saveTasks saves the pending tasks of a running scrape
+func (s *Store) saveTasks(id uuid.UUID, tasks []*discollect.QueuedTask, status *discollect.ScrapeStatus) (*discollect.Scrape, error) {
+	sc, ok := s.scrapes[id]
+	if !ok || sc.State != "RUNNING" {
+		return nil, errors.New("scrape is not running")
+	}
+
+	sc.Progress = status
+	s.paused[id] = &pausedTasks{
+		tasks:  tasks,
+		status: status,
+	}
+
+	return sc, nil
+}
+
+// GetPausedTasks returns the tasks saved when a scrape was paused
+func (s *Store) GetPausedTasks(ctx context.Context, id uuid.UUID) ([]*discollect.QueuedTask, *discollect.ScrapeStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sc, ok := s.scrapes[id]
+	pt, saved := s.paused[id]
+	if !ok || !saved || sc.State != "PAUSED" {
+		return nil, nil, errors.New("scrape is not paused")
+	}
+
+	return pt.tasks, pt.status, nil
+}
+
+// ResumeScrape moves a paused scrape back to RUNNING, time spent paused does
+// not count towards how long it may run
+func (s *Store) ResumeScrape(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sc, ok := s.scrapes[id]
+	if !ok || sc.State != "PAUSED" {
+		return errors.New("scrape is not paused")
+	}
+
+	s.setState(sc, "RUNNING")
+	sc.StartedAt = time.Now()
+	delete(s.paused, id)
+
+	return nil
+}
+
+// RecordProgress saves the counters of a running scrape
+func (s *Store) RecordProgress(ctx context.Context, id uuid.UUID, status *discollect.ScrapeStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sc, ok := s.scrapes[id]; ok {
+		sc.Progress = status
+	}
+
+	return nil
+}
+
+// RecordTimeout counts a task of the scrape that ran past its deadline
+func (s *Store) RecordTimeout(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sc, ok := s.scrapes[id]; ok {
+		sc.TotalTimeouts++
+	}
+
+	return nil
+}
+
+// RecordCircuitOpen notes that tasks of the scrape were held back as host
+// looked to be down
+func (s *Store) RecordCircuitOpen(ctx context.Context, id uuid.UUID, host string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sc, ok := s.scrapes[id]; ok {
+		sc.CircuitOpens = append(sc.CircuitOpens, host+" until "+until.UTC().Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// UpdateScrapeConfig replaces the config of a scrape, after it was upgraded to
+// the current version of its plugin
+func (s *Store) UpdateScrapeConfig(ctx context.Context, id uuid.UUID, c *discollect.Config) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sc, ok := s.scrapes[id]
+	if !ok {
+		return errors.New("no scrape found")
+	}
+
+	sc.Config = c
+	return nil
+}
+
+// Heartbeat registers or refreshes a node and returns whether it should drain
+func (s *Store) Heartbeat(ctx context.Context, n *discollect.Node) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	known, ok := s.nodes[n.ID]
+	if !ok {
+		cp := *n
+		cp.Draining = false
+		s.nodes[n.ID] = &cp
+		return false, nil
+	}
+
+	known.HeartbeatAt = n.HeartbeatAt
+	known.Workers = n.Workers
+	known.Load = n.Load
+
+	return known.Draining, nil
+}
+
+// WriteLogs saves the log entries of a single task
+func (s *Store) WriteLogs(ctx context.Context, entries []*discollect.LogEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range entries {
+		cp := *e
+		s.logs[e.ScrapeID] = append(s.logs[e.ScrapeID], &cp)
+	}
+
+	return nil
+}
+
+// GetLogs returns the entries of a scrape, oldest first
+func (s *Store) GetLogs(ctx context.Context, scrapeID uuid.UUID, limit, offset int) ([]*discollect.LogEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := append([]*discollect.LogEntry(nil), s.logs[scrapeID]...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].At.Before(entries[j].At)
+	})
+
+	start, end := pageOf(len(entries), limit, offset)
+	return entries[start:end], nil
+}
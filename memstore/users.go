@@ -0,0 +1,530 @@
+package memstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+type user struct {
+	id        string
+	email     string
+	createdAt time.Time
+	admin     bool
+	plan      string
+
+	trialEndsAt      time.Time
+	stripeCustomerID string
+	// stripeSubID is empty once a subscription has ended
+	stripeSubID string
+	// feverKey is the md5 Fever clients log in with, empty until set
+	feverKey string
+}
+
+type session struct {
+	hydrocarbon.Session
+	userID     string
+	key        string
+	remindedAt time.Time
+}
+
+type loginToken struct {
+	userID    string
+	expiresAt time.Time
+	used      bool
+}
+
+type plan struct {
+	hydrocarbon.Plan
+	// paymentPlanID is empty for plans that can not be subscribed to
+	paymentPlanID string
+}
+
+type usageKey struct {
+	userID      string
+	periodStart time.Time
+}
+
+type usage struct {
+	scrapes int
+	tasks   int
+}
+
+// periodStart is the start of the current billing period
+func periodStart() time.Time {
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// userByEmail returns the user with the given email, creating them on the free
+// plan with a 14 day trial if they do not exist yet
+func (s *Store) userByEmail(email string) *user {
+	email = strings.ToLower(email)
+	for _, u := range s.users {
+		if u.email == email {
+			return u
+		}
+	}
+
+	now := time.Now()
+	u := &user{
+		id:          uuid.New().String(),
+		email:       email,
+		createdAt:   now,
+		plan:        "free",
+		trialEndsAt: now.Add(14 * 24 * time.Hour),
+	}
+	s.users[u.id] = u
+
+	return u
+}
+
+// CreateOrGetUser creates a new user and returns the users ID, and whether they
+// have a subscription
+func (s *Store) CreateOrGetUser(ctx context.Context, email string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.userByEmail(email)
+	return u.id, u.stripeSubID != "", nil
+}
+
+// SetStripeIDs sets a users stripe IDs, and moves them to the plan billed as
+// planID
+func (s *Store) SetStripeIDs(ctx context.Context, userID, customerID, subID, planID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return nil
+	}
+
+	u.stripeCustomerID = customerID
+	u.stripeSubID = subID
+	return s.updateSubscription(subID, planID)
+}
+
+// RecordCouponRedemption records that the user has redeemed the code, it
+// returns false if they already had
+func (s *Store) RecordCouponRedemption(ctx context.Context, userID, code string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := [2]string{userID, code}
+	if s.coupons[k] {
+		return false, nil
+	}
+
+	s.coupons[k] = true
+	return true, nil
+}
+
+// DeleteCouponRedemption forgets a redemption whose coupon could not be
+// applied
+func (s *Store) DeleteCouponRedemption(ctx context.Context, userID, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.coupons, [2]string{userID, code})
+	return nil
+}
+
+// CreateLoginToken creates a new one-time-use login token, valid for a day
+func (s *Store) CreateLoginToken(ctx context.Context, userID, userAgent, ip string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return "", errors.New("user does not exist")
+	}
+
+	token := randomToken()
+	s.loginTokens[token] = &loginToken{
+		userID:    userID,
+		expiresAt: time.Now().Add(24 * time.Hour),
+	}
+
+	return token, nil
+}
+
+// ActivateLoginToken uses up the given token and returns the user it was for
+func (s *Store) ActivateLoginToken(ctx context.Context, token string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lt, ok := s.loginTokens[token]
+	if !ok || lt.used || !time.Now().Before(lt.expiresAt) {
+		return "", errors.New("token invalid")
+	}
+
+	lt.used = true
+	return lt.userID, nil
+}
+
+// CreateSession creates a new session for the user ID and returns their email
+// and the session key
+func (s *Store) CreateSession(ctx context.Context, userID, userAgent, ip string) (string, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return "", "", errors.New("user does not exist")
+	}
+
+	key := randomToken()
+	s.sessions[key] = &session{
+		Session: hydrocarbon.Session{
+			ID:        uuid.New().String(),
+			CreatedAt: time.Now(),
+			UserAgent: userAgent,
+			IP:        ip,
+			Active:    true,
+		},
+		userID: userID,
+		key:    key,
+	}
+
+	return u.email, key, nil
+}
+
+// VerifyKey checks that the session exists and is active
+func (s *Store) VerifyKey(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[strings.ToLower(key)]
+	if !ok || !sess.Active {
+		return errInvalidKey
+	}
+
+	return nil
+}
+
+// ListSessions lists 25 of the sessions of a user, page is the number skipped
+func (s *Store) ListSessions(ctx context.Context, key string, page int) ([]*hydrocarbon.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// as in postgres, unknown keys have no sessions
+	u, err := s.userFor(key)
+	if err != nil {
+		return nil, nil
+	}
+
+	sessions := s.sessionsOf(u.id)
+	start, end := pageOf(len(sessions), 25, page)
+
+	var out []*hydrocarbon.Session
+	for _, sess := range sessions[start:end] {
+		cp := sess.Session
+		out = append(out, &cp)
+	}
+
+	return out, nil
+}
+
+// sessionsOf returns every session of a user, oldest first
+func (s *Store) sessionsOf(userID string) []*session {
+	var sessions []*session
+	for _, sess := range s.sessions {
+		if sess.userID == userID {
+			sessions = append(sessions, sess)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+
+	return sessions
+}
+
+// DeactivateSession invalidates the current session
+func (s *Store) DeactivateSession(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sess, ok := s.sessions[strings.ToLower(key)]; ok {
+		sess.Active = false
+	}
+
+	return nil
+}
+
+// GetBillingStatus returns the trial and subscription state of a user
+func (s *Store) GetBillingStatus(ctx context.Context, sessionKey string) (*hydrocarbon.BillingStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userFor(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &hydrocarbon.BillingStatus{
+		TrialEndsAt: u.trialEndsAt,
+		Subscribed:  u.stripeSubID != "",
+	}, nil
+}
+
+// GetStripeCustomerID returns the stripe customer ID of a user
+func (s *Store) GetStripeCustomerID(ctx context.Context, sessionKey string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userFor(sessionKey)
+	if err != nil {
+		return "", err
+	}
+
+	if u.stripeCustomerID == "" {
+		return "", errors.New("no billing account exists for this user")
+	}
+
+	return u.stripeCustomerID, nil
+}
+
+// GetStripeSubscription returns the user ID and stripe subscription ID of the
+// user the session belongs to
+func (s *Store) GetStripeSubscription(ctx context.Context, sessionKey string) (string, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userFor(sessionKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	if u.stripeSubID == "" {
+		return "", "", errors.New("no subscription exists for this user")
+	}
+
+	return u.id, u.stripeSubID, nil
+}
+
+// EndSubscription clears a subscription that has been ended by the payment
+// provider, moving the user back to the free plan
+func (s *Store) EndSubscription(ctx context.Context, subscriptionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.stripeSubID == subscriptionID {
+			u.stripeSubID = ""
+			return s.setPlan(u.id, "free")
+		}
+	}
+
+	return nil
+}
+
+// UpdateSubscription moves the user with the subscription to the plan billed
+// as planID, if they are not on it already
+func (s *Store) UpdateSubscription(ctx context.Context, subscriptionID, planID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.updateSubscription(subscriptionID, planID)
+}
+
+func (s *Store) updateSubscription(subscriptionID, planID string) error {
+	var name string
+	for n, p := range s.plans {
+		if p.paymentPlanID == planID {
+			name = n
+		}
+	}
+
+	for _, u := range s.users {
+		if u.stripeSubID != subscriptionID || name == "" {
+			continue
+		}
+
+		if u.plan == name {
+			return nil
+		}
+		return s.setPlan(u.id, name)
+	}
+
+	return fmt.Errorf("no user has subscription %s, or no plan is billed as %s", subscriptionID, planID)
+}
+
+// GetPlanUsage returns the plan a user is on, the number of feeds they
+// currently follow and their scrape usage for the current billing period
+func (s *Store) GetPlanUsage(ctx context.Context, sessionKey string) (*hydrocarbon.PlanUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userFor(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	feeds := make(map[string]bool)
+	for f := range s.follows {
+		if f.userID == u.id {
+			feeds[f.feedID] = true
+		}
+	}
+
+	p := s.plans[u.plan].Plan
+	if s.unlimited {
+		p = hydrocarbon.UnlimitedPlan
+	}
+	pu := &hydrocarbon.PlanUsage{
+		Plan:        &p,
+		Feeds:       len(feeds),
+		PeriodStart: periodStart(),
+	}
+	if us, ok := s.usage[usageKey{u.id, pu.PeriodStart}]; ok {
+		pu.Scrapes = us.scrapes
+		pu.Tasks = us.tasks
+	}
+
+	return pu, nil
+}
+
+// GetPaymentPlanID returns the payment provider plan the named plan is billed
+// as
+func (s *Store) GetPaymentPlanID(ctx context.Context, name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.plans[name]
+	if !ok {
+		return "", fmt.Errorf("no plan named %s exists", name)
+	}
+
+	if p.paymentPlanID == "" {
+		return "", fmt.Errorf("the %s plan cannot be subscribed to", name)
+	}
+
+	return p.paymentPlanID, nil
+}
+
+// SetPlan moves a user to the named plan. Waiting scrapes of the feeds only
+// they follow are removed so they are rescheduled against the new scrape
+// interval
+func (s *Store) SetPlan(ctx context.Context, userID, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.setPlan(userID, name)
+}
+
+func (s *Store) setPlan(userID, name string) error {
+	if _, ok := s.plans[name]; !ok {
+		return fmt.Errorf("no plan named %s exists", name)
+	}
+
+	u, ok := s.users[userID]
+	if !ok {
+		return errors.New("user does not exist")
+	}
+	u.plan = name
+
+	for id, sc := range s.scrapes {
+		if sc.State == "WAITING" && s.followedBy(userID, sc.FeedID.String()) && len(s.followersOf(sc.FeedID.String())) == 1 {
+			delete(s.scrapes, id)
+		}
+	}
+
+	return nil
+}
+
+// RecordKeyUsage adds a batch of API call counts to their sessions
+func (s *Store) RecordKeyUsage(ctx context.Context, usage map[string]*hydrocarbon.KeyUsage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, ku := range usage {
+		sess, ok := s.sessions[strings.ToLower(key)]
+		if !ok {
+			continue
+		}
+
+		sess.APICalls += ku.Calls
+		if sess.LastUsedAt == nil || ku.LastUsedAt.After(*sess.LastUsedAt) {
+			lastUsed := ku.LastUsedAt
+			sess.LastUsedAt = &lastUsed
+		}
+	}
+
+	return nil
+}
+
+// FindKeyReminders returns every active key that should be rotated or revoked,
+// grouped by the email of its owner
+func (s *Store) FindKeyReminders(ctx context.Context, rotateAfter, staleAfter, remindEvery time.Duration) ([]*hydrocarbon.KeyReminder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	byEmail := make(map[string]*hydrocarbon.KeyReminder)
+	for _, sess := range s.sessions {
+		if !sess.Active || (!sess.remindedAt.IsZero() && sess.remindedAt.After(now.Add(-remindEvery))) {
+			continue
+		}
+
+		lastUsed := sess.CreatedAt
+		if sess.LastUsedAt != nil {
+			lastUsed = *sess.LastUsedAt
+		}
+		if !sess.CreatedAt.Before(now.Add(-rotateAfter)) && !lastUsed.Before(now.Add(-staleAfter)) {
+			continue
+		}
+
+		email := s.users[sess.userID].email
+		kr, ok := byEmail[email]
+		if !ok {
+			kr = &hydrocarbon.KeyReminder{Email: email}
+			byEmail[email] = kr
+		}
+
+		cp := sess.Session
+		kr.Sessions = append(kr.Sessions, &cp)
+	}
+
+	reminders := make([]*hydrocarbon.KeyReminder, 0, len(byEmail))
+	for _, kr := range byEmail {
+		sort.Slice(kr.Sessions, func(i, j int) bool {
+			return kr.Sessions[i].CreatedAt.Before(kr.Sessions[j].CreatedAt)
+		})
+		reminders = append(reminders, kr)
+	}
+	sort.Slice(reminders, func(i, j int) bool {
+		return reminders[i].Email < reminders[j].Email
+	})
+
+	return reminders, nil
+}
+
+// MarkKeysReminded records that the owners of the given sessions were reminded
+// about them
+func (s *Store) MarkKeysReminded(ctx context.Context, sessionIDs []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make(map[string]bool, len(sessionIDs))
+	for _, id := range sessionIDs {
+		ids[id] = true
+	}
+
+	now := time.Now()
+	for _, sess := range s.sessions {
+		if ids[sess.ID] {
+			sess.remindedAt = now
+		}
+	}
+
+	return nil
+}
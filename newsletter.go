@@ -0,0 +1,360 @@
+package hydrocarbon
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// NewsletterPlugin is the plugin of the feeds newsletters are delivered into,
+// they are never scraped
+const NewsletterPlugin = "newsletter"
+
+// the title of mails sent without a subject
+const noSubject = "(no subject)"
+
+var (
+	newsletterPolicy = basePolicy()
+	tokenEncoding    = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+// InboundMail is a mail received by a MailReceiver
+type InboundMail struct {
+	// MessageID is the Message-ID header, without angle brackets
+	MessageID string
+	From      string
+	FromName  string
+	// To holds every recipient of the mail, including Cc and Bcc
+	To       []string
+	Subject  string
+	Date     time.Time
+	HTMLBody string
+	TextBody string
+}
+
+// A MailReceiver accepts mail sent to newsletter addresses, postmark being the
+// first
+type MailReceiver interface {
+	// WebhookHandler verifies inbound mail notifications sent by the provider
+	// and passes them on to fn
+	WebhookHandler(fn func(ctx context.Context, m *InboundMail) error) ErrorHandler
+}
+
+// A NewsletterAddress is a generated address that delivers every mail sent to
+// it into a feed
+type NewsletterAddress struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	// Token is the local part of the address
+	Token   string `json:"-"`
+	Address string `json:"address"`
+	FeedID  string `json:"feed_id"`
+	Title   string `json:"title"`
+}
+
+// A NewsletterStore is an interface used to seperate the NewsletterAPI from
+// knowledge of the actual underlying database
+type NewsletterStore interface {
+	GetPlanUsage(ctx context.Context, sessionKey string) (*PlanUsage, error)
+
+	// CreateNewsletterAddress adds a private feed titled title to the folder,
+	// mail sent to token is delivered into it
+	CreateNewsletterAddress(ctx context.Context, sessionKey, folderID, title, token string) (*NewsletterAddress, error)
+	ListNewsletterAddresses(ctx context.Context, sessionKey string) ([]*NewsletterAddress, error)
+	// DeleteNewsletterAddress stops delivery to an address, its feed and the
+	// posts already delivered are kept
+	DeleteNewsletterAddress(ctx context.Context, sessionKey, id string) error
+
+	// DeliverNewsletter adds a post to the feed of the address token, it
+	// returns false if there is no such address or the post is already stored
+	DeliverNewsletter(ctx context.Context, token string, p *Post) (bool, error)
+}
+
+// NewsletterAPI hands out addresses newsletters can be subscribed with, and
+// turns the mail received at them into posts
+type NewsletterAPI struct {
+	s      NewsletterStore
+	ks     *KeySigner
+	mr     MailReceiver
+	domain string
+}
+
+// NewNewsletterAPI returns a new NewsletterAPI, addresses are generated under
+// domain, which must have its mail sent on to mr
+func NewNewsletterAPI(s NewsletterStore, ks *KeySigner, mr MailReceiver, domain string) *NewsletterAPI {
+	return &NewsletterAPI{
+		s:      s,
+		ks:     ks,
+		mr:     mr,
+		domain: strings.ToLower(domain),
+	}
+}
+
+// CreateAddress generates a new address delivering into a new feed, if
+// folder_id is left out the feed is added to the users "default" folder
+func (na *NewsletterAPI) CreateAddress(w http.ResponseWriter, r *http.Request) error {
+	key, err := na.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		FolderID string `json:"folder_id,omitempty"`
+		Title    string `json:"title"`
+	}
+
+	err = limitDecoder(r, &req)
+	if err != nil {
+		return err
+	}
+
+	if req.Title == "" {
+		req.Title = "Newsletters"
+	}
+
+	usage, err := na.s.GetPlanUsage(r.Context(), key)
+	if err != nil {
+		return err
+	}
+
+	if usage.Feeds >= usage.Plan.MaxFeeds {
+		return fmt.Errorf("the %s plan is limited to %d feeds", usage.Plan.Name, usage.Plan.MaxFeeds)
+	}
+
+	token, err := newNewsletterToken()
+	if err != nil {
+		return err
+	}
+
+	a, err := na.s.CreateNewsletterAddress(r.Context(), key, req.FolderID, req.Title, token)
+	if err != nil {
+		return err
+	}
+	a.Address = na.address(a.Token)
+
+	return writeSuccess(w, a)
+}
+
+// ListAddresses lists the newsletter addresses of the user
+func (na *NewsletterAPI) ListAddresses(w http.ResponseWriter, r *http.Request) error {
+	key, err := na.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	as, err := na.s.ListNewsletterAddresses(r.Context(), key)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range as {
+		a.Address = na.address(a.Token)
+	}
+
+	return writeSuccess(w, as)
+}
+
+// DeleteAddress stops delivery to a newsletter address, mail sent to it after
+// is dropped
+func (na *NewsletterAPI) DeleteAddress(w http.ResponseWriter, r *http.Request) error {
+	key, err := na.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		ID string `json:"id"`
+	}
+
+	err = limitDecoder(r, &req)
+	if err != nil {
+		return err
+	}
+
+	if req.ID == "" {
+		return errors.New("no address ID submitted")
+	}
+
+	err = na.s.DeleteNewsletterAddress(r.Context(), key, req.ID)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, nil)
+}
+
+// Inbound receives mail from the MailReceiver
+func (na *NewsletterAPI) Inbound(w http.ResponseWriter, r *http.Request) error {
+	return na.mr.WebhookHandler(na.deliver)(w, r)
+}
+
+// deliver adds m to the feed of every newsletter address it was sent to. Mail
+// to no known address is dropped rather than failed, so providers do not keep
+// retrying it
+func (na *NewsletterAPI) deliver(ctx context.Context, m *InboundMail) error {
+	p := newsletterPost(m)
+
+	seen := make(map[string]bool)
+	for _, rcpt := range m.To {
+		token, ok := na.token(rcpt)
+		if !ok || seen[token] {
+			continue
+		}
+		seen[token] = true
+
+		delivered, err := na.s.DeliverNewsletter(ctx, token, p)
+		if err != nil {
+			return err
+		}
+
+		if !delivered {
+			log.Println("hydrocarbon: dropped newsletter", m.MessageID, "to", rcpt)
+		}
+	}
+
+	return nil
+}
+
+func (na *NewsletterAPI) address(token string) string {
+	return token + "@" + na.domain
+}
+
+// token returns the token of a recipient at the newsletter domain, ignoring any
+// +suffix, as in token+weekly@domain
+func (na *NewsletterAPI) token(rcpt string) (string, bool) {
+	i := strings.LastIndex(rcpt, "@")
+	if i < 1 || !strings.EqualFold(rcpt[i+1:], na.domain) {
+		return "", false
+	}
+
+	local := rcpt[:i]
+	if j := strings.Index(local, "+"); j > 0 {
+		local = local[:j]
+	}
+
+	return strings.ToLower(local), true
+}
+
+// newNewsletterToken returns 80 random bits, long enough that addresses cannot
+// be guessed to send spam into feeds
+func newNewsletterToken() (string, error) {
+	buf := make([]byte, 10)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.ToLower(tokenEncoding.EncodeToString(buf)), nil
+}
+
+// newsletterPost converts a mail into a post, its url is the mid: url of its
+// Message-ID, so a mail delivered twice to an address is only stored once
+func newsletterPost(m *InboundMail) *Post {
+	body := cleanNewsletter(m.HTMLBody)
+	if strings.TrimSpace(body) == "" {
+		body = textToHTML(m.TextBody)
+	}
+
+	p := &Post{
+		PostedAt: m.Date,
+		Title:    strings.TrimSpace(m.Subject),
+		Author:   m.FromName,
+		Body:     body,
+	}
+
+	if p.Title == "" {
+		p.Title = noSubject
+	}
+	if p.Author == "" {
+		p.Author = m.From
+	}
+	// the date is set by the sender, scheduled sends are sometimes dated
+	// ahead
+	if p.PostedAt.IsZero() || p.PostedAt.After(time.Now()) {
+		p.PostedAt = time.Now()
+	}
+
+	id := strings.Trim(m.MessageID, "<> ")
+	if id == "" {
+		h := sha256.Sum256([]byte(m.From + ":" + m.Subject + ":" + m.HTMLBody + m.TextBody))
+		id = hex.EncodeToString(h[:16]) + "@" + NewsletterPlugin
+	}
+	p.OriginalURL = "mid:" + url.PathEscape(id)
+
+	return p
+}
+
+// cleanNewsletter strips a newsletter down to its content, dropping styles,
+// preheaders hidden from view and tracking pixels along with everything
+// removed from scraped posts
+func cleanNewsletter(body string) string {
+	if strings.TrimSpace(body) == "" {
+		return ""
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	doc.Find("head, style, script, title").Remove()
+	doc.Find("[style]").Each(func(i int, sel *goquery.Selection) {
+		if hiddenStyle(sel.AttrOr("style", "")) {
+			sel.Remove()
+		}
+	})
+	doc.Find("[hidden]").Remove()
+
+	out, err := doc.Find("body").Html()
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(stripTrackers(newsletterPolicy.Sanitize(out)))
+}
+
+// hiddenStyle reports if an inline style hides an element, preheaders shown
+// only in the inbox preview are hidden in every way mail clients support
+func hiddenStyle(style string) bool {
+	for _, decl := range strings.Split(strings.ToLower(style), ";") {
+		kv := strings.SplitN(decl, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		prop := strings.TrimSpace(kv[0])
+		val := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(kv[1]), "!important"))
+
+		switch prop {
+		case "display":
+			if val == "none" {
+				return true
+			}
+		case "visibility":
+			if val == "hidden" {
+				return true
+			}
+		case "mso-hide":
+			if val == "all" {
+				return true
+			}
+		case "max-height", "font-size", "opacity":
+			if val == "0" || val == "0px" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
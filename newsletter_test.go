@@ -0,0 +1,85 @@
+package hydrocarbon
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCleanNewsletter(t *testing.T) {
+	t.Parallel()
+
+	body := `<html><head><title>Weekly</title><style>p { color: red }</style></head><body>
+<div style="display: none !important; mso-hide: all">Preview text for the inbox</div>
+<table><tr><td style="font-size: 16px"><p>This week in Go</p>
+<a href="https://example.com/post?utm_source=newsletter&id=1">Read more</a>
+<img src="https://example.com/open.gif" width="1" height="1"/>
+</td></tr></table>
+<script>track()</script>
+</body></html>`
+
+	out := cleanNewsletter(body)
+
+	for _, gone := range []string{"Weekly", "color: red", "Preview text", "utm_source", "open.gif", "track()"} {
+		if strings.Contains(out, gone) {
+			t.Errorf("expected %q to be stripped, got %s", gone, out)
+		}
+	}
+
+	for _, kept := range []string{"<p>This week in Go</p>", `href="https://example.com/post?id=1"`} {
+		if !strings.Contains(out, kept) {
+			t.Errorf("expected %q to be kept, got %s", kept, out)
+		}
+	}
+}
+
+type stubNewsletterStore struct {
+	NewsletterStore
+
+	delivered map[string][]*Post
+}
+
+func (s *stubNewsletterStore) DeliverNewsletter(ctx context.Context, token string, p *Post) (bool, error) {
+	if token != "abc" && token != "def" {
+		return false, nil
+	}
+
+	s.delivered[token] = append(s.delivered[token], p)
+	return true, nil
+}
+
+func TestDeliverNewsletter(t *testing.T) {
+	t.Parallel()
+
+	s := &stubNewsletterStore{delivered: make(map[string][]*Post)}
+	na := NewNewsletterAPI(s, nil, nil, "In.Example.com")
+
+	date := time.Date(2020, 3, 1, 9, 0, 0, 0, time.UTC)
+	err := na.deliver(context.Background(), &InboundMail{
+		MessageID: "<1234@mail.example.org>",
+		From:      "news@example.org",
+		To:        []string{"ABC@in.example.com", "abc+weekly@in.example.com", "def@in.example.com", "def@example.com", "ghi@in.example.com"},
+		Subject:   " Issue #1 ",
+		Date:      date,
+		TextBody:  "Hello\n\nreaders",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.delivered["abc"]) != 1 || len(s.delivered["def"]) != 1 || len(s.delivered) != 2 {
+		t.Fatalf("expected one delivery to abc and def, got %v", s.delivered)
+	}
+
+	p := s.delivered["abc"][0]
+	if p.Title != "Issue #1" || p.Author != "news@example.org" || !p.PostedAt.Equal(date) {
+		t.Errorf("unexpected post %+v", p)
+	}
+	if p.OriginalURL != "mid:1234@mail.example.org" {
+		t.Errorf("expected the url to be the mid url of the message, got %s", p.OriginalURL)
+	}
+	if !strings.Contains(p.Body, "<p>Hello</p>") {
+		t.Errorf("expected the text body to be used when there is no html, got %s", p.Body)
+	}
+}
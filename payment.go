@@ -0,0 +1,73 @@
+package hydrocarbon
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrUnsupportedPayment is returned when the configured PaymentProvider cannot
+// perform an optional billing action
+var ErrUnsupportedPayment = errors.New("not supported by this instances payment provider")
+
+// PaymentEvent types sent by a PaymentProvider to its webhook callback
+const (
+	// PaymentSubscriptionEnded is sent once a subscription is fully cancelled
+	PaymentSubscriptionEnded = "subscription_ended"
+	// PaymentSubscriptionUpdated is sent whenever a subscription is paid for
+	// or moved to another plan
+	PaymentSubscriptionUpdated = "subscription_updated"
+)
+
+// A PaymentEvent is an asynchronous notification from a PaymentProvider
+type PaymentEvent struct {
+	Type           string
+	CustomerID     string
+	SubscriptionID string
+	// PlanID is the provider plan the subscription is on, for
+	// PaymentSubscriptionUpdated
+	PlanID string
+}
+
+// A PaymentProvider takes payment for subscriptions, stripe being the first
+type PaymentProvider interface {
+	// CreateCustomer registers a customer using a payment source collected
+	// client side, returning the customer ID
+	CreateCustomer(ctx context.Context, email, source string) (string, error)
+	// Subscribe subscribes a customer to a plan, applying coupon if set, and
+	// returns the subscription ID
+	Subscribe(ctx context.Context, customerID, planID, coupon string) (string, error)
+	// Cancel cancels a subscription at the end of its current period
+	Cancel(ctx context.Context, subscriptionID string) error
+	// WebhookHandler verifies event notifications sent by the provider and
+	// passes them on to fn, replying with an error the provider retries on
+	// if fn fails
+	WebhookHandler(fn func(ctx context.Context, e *PaymentEvent) error) ErrorHandler
+}
+
+// An InvoiceProvider is a PaymentProvider that can list invoices
+type InvoiceProvider interface {
+	ListInvoices(ctx context.Context, customerID string) ([]*Invoice, error)
+	// UpcomingInvoice returns the next invoice a subscribed customer will pay
+	UpcomingInvoice(ctx context.Context, customerID string) (*Invoice, error)
+}
+
+// A PortalProvider is a PaymentProvider that hosts its own pages for customers
+// to manage their payment details
+type PortalProvider interface {
+	PortalURL(ctx context.Context, customerID, returnURL string) (string, error)
+}
+
+// A CouponProvider is a PaymentProvider that supports discount codes
+type CouponProvider interface {
+	// GetCoupon returns an error if the code does not exist or has expired
+	GetCoupon(ctx context.Context, code string) (*Coupon, error)
+	ApplyCoupon(ctx context.Context, subscriptionID, code string) error
+}
+
+// A PlanChanger is a PaymentProvider that can move a subscription to another
+// plan part way through a billing period
+type PlanChanger interface {
+	// ChangePlan switches the subscription to planID, prorating the unused
+	// part of the current period
+	ChangePlan(ctx context.Context, subscriptionID, planID string) error
+}
@@ -0,0 +1,181 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+// SetFolderPublic publishes or hides one of a users folders, a folder made
+// public only delivers posts created from then on
+func (db *DB) SetFolderPublic(ctx context.Context, sessionKey, folderID string, public bool, privateKey string) error {
+	res, err := db.sql.ExecContext(ctx, `
+	UPDATE folders
+	SET actor_key = COALESCE(actor_key, NULLIF($4, '')),
+		delivered_at = CASE WHEN $3 AND NOT public THEN now() ELSE delivered_at END,
+		public = $3
+	WHERE id = $2
+	AND user_id = (SELECT user_id FROM sessions WHERE key = $1);`, sessionKey, folderID, public, privateKey)
+	if err != nil {
+		return err
+	}
+
+	return expectRows(res, "folder not found")
+}
+
+// GetPublicFolder returns a public folder with its actor key
+func (db *DB) GetPublicFolder(ctx context.Context, folderID string) (*hydrocarbon.PublicFolder, error) {
+	if _, err := uuid.Parse(folderID); err != nil {
+		return nil, errors.New("no public folder found")
+	}
+
+	row := db.sql.QueryRowContext(ctx, `
+	SELECT id, name, created_at, delivered_at, actor_key
+	FROM folders
+	WHERE id = $1
+	AND public
+	AND deleted_at IS NULL
+	AND actor_key IS NOT NULL;`, folderID)
+
+	var f hydrocarbon.PublicFolder
+	err := row.Scan(&f.ID, &f.Name, &f.CreatedAt, &f.DeliveredAt, &f.PrivateKey)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("no public folder found")
+		}
+		return nil, err
+	}
+
+	return &f, nil
+}
+
+// ListPublicFolders returns every public folder with at least one follower
+func (db *DB) ListPublicFolders(ctx context.Context) ([]*hydrocarbon.PublicFolder, error) {
+	rows, err := db.sql.QueryContext(ctx, `
+	SELECT id, name, created_at, delivered_at, actor_key
+	FROM folders f
+	WHERE public
+	AND deleted_at IS NULL
+	AND actor_key IS NOT NULL
+	AND EXISTS (SELECT 1 FROM activitypub_followers af WHERE af.folder_id = f.id);`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	folders := make([]*hydrocarbon.PublicFolder, 0)
+	for rows.Next() {
+		var f hydrocarbon.PublicFolder
+		err = rows.Scan(&f.ID, &f.Name, &f.CreatedAt, &f.DeliveredAt, &f.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		folders = append(folders, &f)
+	}
+
+	return folders, rows.Err()
+}
+
+// GetFolderPosts returns the posts of every feed in a folder created between
+// after and before, newest first
+func (db *DB) GetFolderPosts(ctx context.Context, folderID string, after, before time.Time, limit int) ([]*hydrocarbon.Post, error) {
+	rows, err := db.sql.QueryContext(ctx, `
+	SELECT DISTINCT p.id, p.created_at, p.posted_at, p.title, p.author, p.url
+	FROM posts p
+	JOIN feed_folders ff ON (ff.feed_id = p.feed_id)
+	WHERE ff.folder_id = $1
+	AND p.deleted_at IS NULL
+	AND NOT EXISTS (SELECT 1 FROM feeds WHERE id = p.feed_id AND deleted_at IS NOT NULL)
+	AND p.created_at > $2
+	AND p.created_at < $3
+	ORDER BY p.created_at DESC
+	LIMIT $4;`, folderID, after, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := make([]*hydrocarbon.Post, 0)
+	for rows.Next() {
+		var p hydrocarbon.Post
+		err = rows.Scan(&p.ID, &p.CreatedAt, &p.PostedAt, &p.Title, &p.Author, &p.OriginalURL)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, &p)
+	}
+
+	return posts, rows.Err()
+}
+
+// ClaimDelivery moves delivered_at forward if no other node has already
+func (db *DB) ClaimDelivery(ctx context.Context, folderID string, from, to time.Time) (bool, error) {
+	res, err := db.sql.ExecContext(ctx, `
+	UPDATE folders
+	SET delivered_at = $3
+	WHERE id = $1
+	AND delivered_at = $2;`, folderID, from, to)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// AddFollower records a remote actor following a folder, following again
+// updates their inbox
+func (db *DB) AddFollower(ctx context.Context, folderID string, f *hydrocarbon.Follower) error {
+	_, err := db.sql.ExecContext(ctx, `
+	INSERT INTO activitypub_followers
+	(folder_id, actor, inbox)
+	VALUES
+	($1, $2, $3)
+	ON CONFLICT (folder_id, actor) DO UPDATE SET inbox = EXCLUDED.inbox;`, folderID, f.Actor, f.Inbox)
+
+	return err
+}
+
+// RemoveFollower removes a remote actor from the followers of a folder
+func (db *DB) RemoveFollower(ctx context.Context, folderID, actor string) error {
+	_, err := db.sql.ExecContext(ctx, `
+	DELETE FROM activitypub_followers
+	WHERE folder_id = $1
+	AND actor = $2;`, folderID, actor)
+
+	return err
+}
+
+// ListFollowers returns every remote actor following a folder
+func (db *DB) ListFollowers(ctx context.Context, folderID string) ([]*hydrocarbon.Follower, error) {
+	rows, err := db.sql.QueryContext(ctx, `
+	SELECT actor, inbox
+	FROM activitypub_followers
+	WHERE folder_id = $1
+	ORDER BY created_at ASC;`, folderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	followers := make([]*hydrocarbon.Follower, 0)
+	for rows.Next() {
+		var f hydrocarbon.Follower
+		err = rows.Scan(&f.Actor, &f.Inbox)
+		if err != nil {
+			return nil, err
+		}
+		followers = append(followers, &f)
+	}
+
+	return followers, rows.Err()
+}
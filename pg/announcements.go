@@ -0,0 +1,150 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+// VerifyAdmin checks that the session belongs to an admin user
+func (db *DB) VerifyAdmin(ctx context.Context, sessionKey string) error {
+	row := db.sql.QueryRowContext(ctx, `
+	SELECT u.admin
+	FROM users u
+	JOIN sessions s ON (s.user_id = u.id)
+	WHERE s.key = $1 AND s.active = TRUE;`, sessionKey)
+
+	var admin bool
+	err := row.Scan(&admin)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("invalid or inactive token")
+		}
+		return err
+	}
+
+	if !admin {
+		return errors.New("admin access required")
+	}
+
+	return nil
+}
+
+// CreateAnnouncement stores a new announcement
+func (db *DB) CreateAnnouncement(ctx context.Context, a *hydrocarbon.Announcement) (string, error) {
+	row := db.sql.QueryRowContext(ctx, `
+	INSERT INTO announcements
+	(title, body, starts_at, ends_at)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id;`, a.Title, a.Body, a.StartsAt, a.EndsAt)
+
+	var id string
+	err := row.Scan(&id)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// UpdateAnnouncement replaces the contents of an announcement
+func (db *DB) UpdateAnnouncement(ctx context.Context, a *hydrocarbon.Announcement) error {
+	res, err := db.sql.ExecContext(ctx, `
+	UPDATE announcements
+	SET (title, body, starts_at, ends_at) = ($1, $2, $3, $4)
+	WHERE id = $5;`, a.Title, a.Body, a.StartsAt, a.EndsAt, a.ID)
+	if err != nil {
+		return err
+	}
+
+	return expectRows(res, "announcement not found")
+}
+
+// DeleteAnnouncement removes an announcement and every record of it being seen
+func (db *DB) DeleteAnnouncement(ctx context.Context, id string) error {
+	res, err := db.sql.ExecContext(ctx, `
+	DELETE FROM announcements
+	WHERE id = $1;`, id)
+	if err != nil {
+		return err
+	}
+
+	return expectRows(res, "announcement not found")
+}
+
+// ListAnnouncements lists every announcement, newest first
+func (db *DB) ListAnnouncements(ctx context.Context, limit, offset int) ([]*hydrocarbon.Announcement, error) {
+	rows, err := db.sql.QueryContext(ctx, `
+	SELECT id, created_at, title, body, starts_at, ends_at
+	FROM announcements
+	ORDER BY created_at DESC
+	LIMIT $1 OFFSET $2;`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAnnouncements(rows)
+}
+
+// GetUnseenAnnouncements returns all currently running announcements the user
+// has not yet marked as seen
+func (db *DB) GetUnseenAnnouncements(ctx context.Context, sessionKey string) ([]*hydrocarbon.Announcement, error) {
+	rows, err := db.sql.QueryContext(ctx, `
+	SELECT a.id, a.created_at, a.title, a.body, a.starts_at, a.ends_at
+	FROM announcements a
+	WHERE a.starts_at <= now()
+	AND (a.ends_at IS NULL OR a.ends_at > now())
+	AND NOT EXISTS (
+		SELECT 1 FROM announcement_views
+		WHERE announcement_id = a.id
+		AND user_id = (SELECT user_id FROM sessions WHERE key = $1)
+	)
+	ORDER BY a.starts_at DESC;`, sessionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAnnouncements(rows)
+}
+
+// MarkAnnouncementSeen records that the user has seen an announcement
+func (db *DB) MarkAnnouncementSeen(ctx context.Context, sessionKey, announcementID string) error {
+	_, err := db.sql.ExecContext(ctx, `
+	INSERT INTO announcement_views
+	(user_id, announcement_id)
+	VALUES
+	((SELECT user_id FROM sessions WHERE key = $1), $2)
+	ON CONFLICT DO NOTHING`, sessionKey, announcementID)
+	return err
+}
+
+func scanAnnouncements(rows *sql.Rows) ([]*hydrocarbon.Announcement, error) {
+	defer rows.Close()
+
+	out := make([]*hydrocarbon.Announcement, 0)
+	for rows.Next() {
+		var a hydrocarbon.Announcement
+		var endsAt pq.NullTime
+		err := rows.Scan(&a.ID, &a.CreatedAt, &a.Title, &a.Body, &a.StartsAt, &endsAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if endsAt.Valid {
+			a.EndsAt = &endsAt.Time
+		}
+
+		out = append(out, &a)
+	}
+
+	err := rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
@@ -0,0 +1,121 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/fortytw2/hydrocarbon"
+	"github.com/fortytw2/hydrocarbon/discollect"
+)
+
+// GetFeedConfig returns the plugin of a feed the user follows and the config
+// it was first scraped with
+func (db *DB) GetFeedConfig(ctx context.Context, sessionKey, feedID string) (string, *discollect.Config, error) {
+	row := db.sql.QueryRowContext(ctx, `
+	SELECT sc.plugin, sc.config
+	FROM scrapes sc
+	WHERE sc.feed_id = $2
+	AND sc.config->>'Type' = $3
+	AND EXISTS (SELECT 1 FROM feed_folders ff WHERE ff.feed_id = sc.feed_id AND ff.user_id = (SELECT user_id FROM sessions WHERE key = $1))
+	ORDER BY sc.created_at ASC
+	LIMIT 1;`, sessionKey, feedID, string(discollect.FullScrape))
+
+	var plugin string
+	var c discollect.Config
+	err := row.Scan(&plugin, &c)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil, errors.New("feed not found")
+		}
+		return "", nil, err
+	}
+
+	return plugin, &c, nil
+}
+
+// BackfillFeed queues a backfill of a feed the user follows, unless one is
+// already waiting, running or paused, returning the ID of the scrape
+func (db *DB) BackfillFeed(ctx context.Context, sessionKey, feedID string, c *discollect.Config) (string, error) {
+	row := db.sql.QueryRowContext(ctx, `
+	INSERT INTO scrapes
+	(id, feed_id, plugin, config, priority)
+	SELECT $6, f.id, f.plugin, $3, $4
+	FROM feeds f
+	WHERE f.id = $2
+	AND f.deleted_at IS NULL
+	AND EXISTS (SELECT 1 FROM feed_folders ff WHERE ff.feed_id = f.id AND ff.user_id = (SELECT user_id FROM sessions WHERE key = $1))
+	AND NOT EXISTS (
+		SELECT 1 FROM scrapes
+		WHERE feed_id = f.id
+		AND config->>'Type' = $5
+		AND state IN ('WAITING', 'RUNNING', 'PAUSED')
+	)
+	RETURNING id;`, sessionKey, feedID, c, int(c.Priority()), string(discollect.BackfillScrape), hydrocarbon.NewID())
+
+	var id string
+	err := row.Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", errors.New("feed not found or already backfilling")
+		}
+		return "", err
+	}
+
+	return id, nil
+}
+
+// GetBackfill returns the latest backfill of a feed the user follows, with its
+// progress
+func (db *DB) GetBackfill(ctx context.Context, sessionKey, feedID string) (*discollect.Scrape, error) {
+	row := db.sql.QueryRowContext(ctx, `
+	SELECT id, feed_id, plugin, config, created_at, scheduled_start_at,
+		started_at, ended_at, state, errors,
+		total_datums, total_retries, total_tasks, total_timeouts, priority, last_failed_url, circuit_opens, progress
+	FROM scrapes sc
+	WHERE sc.feed_id = $2
+	AND sc.config->>'Type' = $3
+	AND EXISTS (SELECT 1 FROM feed_folders ff WHERE ff.feed_id = sc.feed_id AND ff.user_id = (SELECT user_id FROM sessions WHERE key = $1))
+	ORDER BY sc.created_at DESC
+	LIMIT 1;`, sessionKey, feedID, string(discollect.BackfillScrape))
+
+	var rs discollect.Scrape
+	var progress []byte
+	err := row.Scan(&rs.ID, &rs.FeedID, &rs.Plugin, &rs.Config, &rs.CreatedAt,
+		&rs.ScheduledStartAt, &rs.StartedAt, &rs.EndedAt,
+		&rs.State, pq.Array(&rs.Errors),
+		&rs.TotalDatums, &rs.TotalRetries, &rs.TotalTasks, &rs.TotalTimeouts, &rs.Priority, &rs.LastFailedURL, pq.Array(&rs.CircuitOpens), &progress)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("feed has not been backfilled")
+		}
+		return nil, err
+	}
+
+	if len(progress) > 0 {
+		err = json.Unmarshal(progress, &rs.Progress)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &rs, nil
+}
+
+// RecordProgress saves the counters of a running scrape
+func (db *DB) RecordProgress(ctx context.Context, id uuid.UUID, status *discollect.ScrapeStatus) error {
+	buf, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.sql.ExecContext(ctx, `
+	UPDATE scrapes
+	SET progress = $2
+	WHERE id = $1;`, id, buf)
+	return err
+}
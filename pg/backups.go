@@ -0,0 +1,315 @@
+package pg
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+const (
+	// how often a Backuper checks whether a backup is due
+	backupCheckInterval = time.Minute
+	// backups taking longer than this are killed, and those left running by
+	// a node that went away are failed after it
+	backupTimeout = 6 * time.Hour
+	// a failed backup is retried after this long, rather than at once
+	backupRetryInterval = 15 * time.Minute
+	// how long hooks are waited on after they are killed, for anything they
+	// started that still holds their output open
+	hookWaitDelay = 10 * time.Second
+)
+
+// A Backuper periodically runs a backup command, such as pg_dump or wal-g
+// backup-push, then a command verifying what it made, and records each backup
+// in postgres. Any number of nodes may run one, only one backup is taken at a
+// time and no more than one every interval
+type Backuper struct {
+	db       *DB
+	interval time.Duration
+	backup   string
+	verify   string
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	shutdown chan chan struct{}
+}
+
+// NewBackuper returns a Backuper running backup in sh every interval. The last
+// line backup prints is recorded as where the backup is, and if it is a file
+// its size. verify, if not empty, is run after each backup with its location
+// in $HC_BACKUP_LOCATION and fails the backup if it fails. Both are given the
+// ID of the backup in $HC_BACKUP_ID and the environment of hydrocarbon
+func NewBackuper(db *DB, interval time.Duration, backup, verify string) *Backuper {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Backuper{
+		db:       db,
+		interval: interval,
+		backup:   backup,
+		verify:   verify,
+		ctx:      ctx,
+		cancel:   cancel,
+		shutdown: make(chan chan struct{}),
+	}
+}
+
+// Start launches the backuper, it blocks until Stop is called
+func (b *Backuper) Start() error {
+	ticker := time.NewTicker(backupCheckInterval)
+
+	for {
+		select {
+		case a := <-b.shutdown:
+			ticker.Stop()
+			a <- struct{}{}
+			return nil
+		case <-ticker.C:
+			bk, err := b.runIfDue(b.ctx)
+			if err != nil {
+				log.Println("pg: backup:", err)
+				continue
+			}
+
+			if bk == nil {
+				continue
+			}
+
+			if bk.State == "ok" {
+				log.Println("pg: backup: took", bk.ID, "at", bk.Location)
+			} else {
+				log.Println("pg: backup:", bk.ID, "failed:", bk.Error)
+			}
+		}
+	}
+}
+
+// Stop kills any backup running, recording it as failed, and blocks until the
+// backuper has shut down
+func (b *Backuper) Stop() {
+	b.cancel()
+
+	c := make(chan struct{})
+	b.shutdown <- c
+	<-c
+}
+
+// runIfDue takes and records a backup if one is due, returning nil if none was
+func (b *Backuper) runIfDue(ctx context.Context) (*hydrocarbon.Backup, error) {
+	id, err := b.db.claimBackup(ctx, b.interval)
+	if err != nil || id == "" {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, backupTimeout)
+	defer cancel()
+
+	bk := b.take(ctx, id)
+	// the backup is recorded even if it was killed by Stop
+	err = b.db.finishBackup(context.Background(), bk)
+	if err != nil {
+		return nil, err
+	}
+
+	return bk, nil
+}
+
+// take runs the backup and verify commands
+func (b *Backuper) take(ctx context.Context, id string) *hydrocarbon.Backup {
+	bk := &hydrocarbon.Backup{
+		ID:    id,
+		State: "failed",
+	}
+
+	out, err := runHook(ctx, b.backup, "HC_BACKUP_ID="+id)
+	if err != nil {
+		bk.Error = err.Error()
+		return bk
+	}
+
+	bk.Location = lastLine(out)
+	if fi, err := os.Stat(bk.Location); err == nil && !fi.IsDir() {
+		bk.Size = fi.Size()
+	}
+
+	if b.verify != "" {
+		_, err = runHook(ctx, b.verify, "HC_BACKUP_ID="+id, "HC_BACKUP_LOCATION="+bk.Location)
+		if err != nil {
+			bk.Error = "verify: " + err.Error()
+			return bk
+		}
+
+		now := time.Now()
+		bk.VerifiedAt = &now
+	}
+
+	bk.State = "ok"
+	return bk
+}
+
+// runHook runs command in sh with env added to the environment, returning
+// what it printed. Errors end with the last line it printed to stderr. The
+// command runs in a process group of its own, so everything it started, such
+// as each side of a pipe, is killed with it once ctx is done
+func runHook(ctx context.Context, command string, env ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = hookWaitDelay
+
+	err := cmd.Run()
+	if err != nil {
+		if line := lastLine(stderr.Bytes()); line != "" {
+			return nil, fmt.Errorf("%s: %s", err, line)
+		}
+		return nil, err
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// lastLine returns the last line of out that is not blank
+func lastLine(out []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// claimBackup records a new running backup and returns its ID, unless one is
+// already running or has been taken within interval, in which case it returns
+// an empty ID. Backups left running for longer than backupTimeout are failed
+func (db *DB) claimBackup(ctx context.Context, interval time.Duration) (string, error) {
+	id := hydrocarbon.NewID().String()
+
+	var claimed bool
+	err := db.withTx(ctx, func(tx *sql.Tx) error {
+		// nodes deciding whether a backup is due at the same time would
+		// otherwise both find none
+		_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('backups'));`)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+		UPDATE backups
+		SET state = 'failed', finished_at = now(), error = 'abandoned'
+		WHERE state = 'running'
+		AND started_at < now() - $1 * interval '1 second';`, backupTimeout.Seconds())
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, `
+		INSERT INTO backups
+		(id)
+		SELECT $1
+		WHERE NOT EXISTS (
+			SELECT 1 FROM backups
+			WHERE state = 'running'
+			OR (state = 'ok' AND started_at > now() - $2 * interval '1 second')
+			OR (state = 'failed' AND started_at > now() - $3 * interval '1 second')
+		);`, id, interval.Seconds(), backupRetryInterval.Seconds())
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		claimed = n > 0
+		return nil
+	})
+	if err != nil || !claimed {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// finishBackup records how a backup went
+func (db *DB) finishBackup(ctx context.Context, bk *hydrocarbon.Backup) error {
+	res, err := db.sql.ExecContext(ctx, `
+	UPDATE backups
+	SET state = $2, finished_at = now(), location = $3, size = $4, verified_at = $5, error = $6
+	WHERE id = $1
+	AND state = 'running';`, bk.ID, bk.State, bk.Location, bk.Size, bk.VerifiedAt, bk.Error)
+	if err != nil {
+		return err
+	}
+
+	return expectRows(res, "backup is no longer running")
+}
+
+// ListBackups lists backups, newest first
+func (db *DB) ListBackups(ctx context.Context, limit, offset int) ([]*hydrocarbon.Backup, error) {
+	rows, err := db.sql.QueryContext(ctx, `
+	SELECT id, started_at, finished_at, state, location, size, verified_at, error
+	FROM backups
+	ORDER BY started_at DESC
+	LIMIT $1 OFFSET $2;`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	backups := make([]*hydrocarbon.Backup, 0)
+	for rows.Next() {
+		bk, err := scanBackup(rows)
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, bk)
+	}
+
+	return backups, rows.Err()
+}
+
+// lastBackup returns the latest backup that succeeded, nil if there is none
+func (db *DB) lastBackup(ctx context.Context) (*hydrocarbon.Backup, error) {
+	bk, err := scanBackup(db.sql.QueryRowContext(ctx, `
+	SELECT id, started_at, finished_at, state, location, size, verified_at, error
+	FROM backups
+	WHERE state = 'ok'
+	ORDER BY started_at DESC
+	LIMIT 1;`))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return bk, err
+}
+
+func scanBackup(row interface{ Scan(...interface{}) error }) (*hydrocarbon.Backup, error) {
+	var bk hydrocarbon.Backup
+	var finishedAt, verifiedAt pq.NullTime
+	err := row.Scan(&bk.ID, &bk.StartedAt, &finishedAt, &bk.State, &bk.Location, &bk.Size, &verifiedAt, &bk.Error)
+	if err != nil {
+		return nil, err
+	}
+
+	if finishedAt.Valid {
+		bk.FinishedAt = &finishedAt.Time
+	}
+
+	if verifiedAt.Valid {
+		bk.VerifiedAt = &verifiedAt.Time
+	}
+
+	return &bk, nil
+}
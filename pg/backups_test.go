@@ -0,0 +1,60 @@
+package pg
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTakeBackup(t *testing.T) {
+	t.Parallel()
+
+	var cases = []struct {
+		name     string
+		backup   string
+		verify   string
+		state    string
+		location string
+		err      string
+	}{
+		{"ok", `echo dumping; echo /backups/$HC_BACKUP_ID.dump`, `test "$HC_BACKUP_LOCATION" = /backups/b1.dump`, "ok", "/backups/b1.dump", ""},
+		{"unverified", `echo s3://bucket/b1`, "", "ok", "s3://bucket/b1", ""},
+		{"failed", `echo "pg_dump: connection refused" >&2; exit 1`, "", "failed", "", "pg_dump: connection refused"},
+		{"verify-failed", `echo /backups/b1.dump`, `echo "corrupt archive" >&2; exit 1`, "failed", "/backups/b1.dump", "verify: exit status 1: corrupt archive"},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			b := NewBackuper(nil, 0, c.backup, c.verify)
+			bk := b.take(context.Background(), "b1")
+			if bk.State != c.state || bk.Location != c.location || !strings.Contains(bk.Error, c.err) {
+				t.Fatalf("expected a %s backup at %q with error %q, got %+v", c.state, c.location, c.err, bk)
+			}
+			if (bk.State == "ok" && c.verify != "") != (bk.VerifiedAt != nil) {
+				t.Fatalf("expected only verified backups to have been verified, got %+v", bk)
+			}
+		})
+	}
+}
+
+func TestRunHookKilled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// the sleep holds the output of the pipe open, and is only killed along
+	// with the shell if the whole group is
+	start := time.Now()
+	_, err := runHook(ctx, `sleep 30 | cat`)
+	if err == nil {
+		t.Fatal("expected the hook to be killed")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("expected every process of the hook to be killed, took %s", time.Since(start))
+	}
+}
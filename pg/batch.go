@@ -0,0 +1,294 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/fortytw2/hydrocarbon"
+	"github.com/fortytw2/hydrocarbon/discollect"
+)
+
+var _ discollect.BatchWriter = &DB{}
+var _ discollect.InsertWriter = &DB{}
+
+// batchedPost is a post ready to be copied into post_batch
+type batchedPost struct {
+	post       *hydrocarbon.Post
+	key        postKey
+	body       *storedBody
+	searchBody string
+}
+
+// WriteBatch writes every post of a task in one transaction, copying them into
+// a temporary table and inserting them from there, rather than making several
+// round trips per post as Write does. Posts with an external ID and posts
+// written while near-duplicates are merged need the checks of Write, so they
+// are written one at a time
+func (db *DB) WriteBatch(ctx context.Context, scrapeID uuid.UUID, fs []interface{}) error {
+	_, err := db.WriteInserted(ctx, scrapeID, fs)
+	return err
+}
+
+// WriteInserted writes posts as WriteBatch does, returning those that were
+// inserted
+func (db *DB) WriteInserted(ctx context.Context, scrapeID uuid.UUID, fs []interface{}) ([]interface{}, error) {
+	var inserted []interface{}
+	posts := make([]*hydrocarbon.Post, 0, len(fs))
+	for _, f := range fs {
+		hcp, ok := f.(*hydrocarbon.Post)
+		if !ok {
+			return nil, errors.New("unable to write non *hydrocarbon.Post struct")
+		}
+
+		if hcp.ExternalID != "" || db.dedupDistance > 0 {
+			ok, err := db.write(ctx, scrapeID, hcp)
+			if err != nil {
+				return nil, err
+			}
+
+			if ok {
+				inserted = append(inserted, hcp)
+			}
+			continue
+		}
+
+		posts = append(posts, hcp)
+	}
+
+	if len(posts) == 0 {
+		return inserted, nil
+	}
+
+	if db.sanitizer != nil {
+		var plugin string
+		err := db.sql.QueryRowContext(ctx, `SELECT plugin FROM scrapes WHERE id = $1`, scrapeID).Scan(&plugin)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, hcp := range posts {
+			hcp.Body = db.sanitizer.Sanitize(plugin, hcp.Body)
+		}
+	}
+
+	scope, err := db.postScope(ctx, scrapeID)
+	if err != nil {
+		return nil, err
+	}
+
+	batch, err := db.changedPosts(ctx, posts, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(batch) == 0 {
+		return inserted, nil
+	}
+
+	bodies := make([]string, len(batch))
+	for i, bp := range batch {
+		if db.images != nil {
+			bp.post.Body, err = discollect.RehostImages(ctx, bp.post.Body, bp.post.OriginalURL, db.imageClient, db.images)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		bodies[i] = bp.post.Body
+		bp.searchBody = db.searchBody(bp.post.Body)
+	}
+
+	sbs, err := db.prepareBodies(ctx, bodies)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, bp := range batch {
+		bp.body = sbs[i]
+	}
+
+	byURL := make(map[string]*hydrocarbon.Post, len(batch))
+	written := make(map[string]string)
+	isNew := make(map[string]bool)
+	var feedID string
+	err = db.withTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+		CREATE TEMPORARY TABLE post_batch (
+			ord INT NOT NULL,
+			id UUID NOT NULL,
+			content_hash CITEXT NOT NULL,
+			title TEXT NOT NULL,
+			author TEXT NOT NULL,
+			body_hash TEXT NOT NULL,
+			stored_body TEXT NOT NULL,
+			url TEXT NOT NULL,
+			posted_at TIMESTAMPTZ NOT NULL,
+			license TEXT NOT NULL,
+			attribution TEXT NOT NULL,
+			simhash BIGINT NOT NULL,
+			search_body TEXT NOT NULL
+		) ON COMMIT DROP;`)
+		if err != nil {
+			return err
+		}
+
+		stmt, err := tx.PrepareContext(ctx, pq.CopyIn("post_batch", "ord", "id", "content_hash", "title", "author",
+			"body_hash", "stored_body", "url", "posted_at", "license", "attribution", "simhash", "search_body"))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for i, bp := range batch {
+			p := bp.post
+			_, err = stmt.ExecContext(ctx, i, hydrocarbon.NewID(), bp.key.contentHash, p.Title, p.Author, bp.body.hash, bp.body.stored, bp.key.url,
+				p.PostedAt, p.License, p.Attribution, int64(p.SimHash()), bp.searchBody)
+			if err != nil {
+				return err
+			}
+
+			byURL[bp.key.url] = p
+		}
+
+		// flushes the copy
+		_, err = stmt.ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+		INSERT INTO post_bodies
+		(hash, body, key_id)
+		SELECT DISTINCT ON (body_hash) body_hash, stored_body, NULLIF($1, '')
+		FROM post_batch
+		WHERE stored_body <> ''
+		ON CONFLICT DO NOTHING;`, db.bodyKeyID())
+		if err != nil {
+			return err
+		}
+
+		// posts with the same content as one already stored are skipped, as
+		// they are by Write. Only the first of several posts in the batch with
+		// the same url or content is kept, a single insert cannot write a row
+		// twice
+		rows, err := tx.QueryContext(ctx, `
+		WITH firsts AS (
+			SELECT DISTINCT ON (content_hash) *
+			FROM post_batch
+			ORDER BY content_hash, ord
+		)
+		INSERT INTO posts
+		(id, feed_id, content_hash, title, author, body, body_hash, url, posted_at, license, attribution, simhash, search_body, scope)
+		SELECT DISTINCT ON (b.url) b.id, (SELECT feed_id FROM scrapes WHERE id = $1), b.content_hash, b.title, b.author,
+			'', b.body_hash, b.url, b.posted_at, b.license, b.attribution, b.simhash, b.search_body, $2
+		FROM firsts b
+		WHERE NOT EXISTS (SELECT 1 FROM posts WHERE content_hash = b.content_hash AND scope = $2)
+		ORDER BY b.url, b.ord
+		ON CONFLICT (url, scope) DO UPDATE SET title = EXCLUDED.title, author = EXCLUDED.author, body = EXCLUDED.body, body_hash = EXCLUDED.body_hash, content_hash = EXCLUDED.content_hash,
+			license = EXCLUDED.license, attribution = EXCLUDED.attribution, simhash = EXCLUDED.simhash,
+			-- the insert trigger has already cleared EXCLUDED.search_body
+			search_body = (SELECT search_body FROM firsts WHERE url = EXCLUDED.url LIMIT 1)
+		-- xmax is only 0 in rows that were inserted rather than updated
+		RETURNING id, feed_id, url, xmax = 0;`, scrapeID, scope)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var id, url string
+			var ok bool
+			err = rows.Scan(&id, &feedID, &url, &ok)
+			if err != nil {
+				return err
+			}
+
+			written[id] = url
+			isNew[url] = ok
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for id, url := range written {
+		db.transform(ctx, id, feedID, byURL[url])
+	}
+
+	if len(written) > 0 {
+		db.invalidateFeeds(ctx, feedID)
+	}
+
+	// in the order they were scraped, once for every url
+	for _, bp := range batch {
+		if isNew[bp.key.url] {
+			inserted = append(inserted, bp.post)
+			delete(isNew, bp.key.url)
+		}
+	}
+
+	return inserted, nil
+}
+
+// changedPosts returns the posts that are not already stored as they are, most
+// posts of a recurring scrape are skipped here before any images are fetched.
+// Posts pruned by the retention policy are skipped too
+func (db *DB) changedPosts(ctx context.Context, posts []*hydrocarbon.Post, scope string) ([]*batchedPost, error) {
+	keys := make([]postKey, len(posts))
+	urls := make([]string, len(posts))
+	hashes := make([]string, len(posts))
+	for i, p := range posts {
+		keys[i] = keyOf(p, scope)
+		urls[i] = keys[i].url
+		hashes[i] = keys[i].contentHash
+	}
+
+	rows, err := db.sql.QueryContext(ctx, `
+	SELECT p.url
+	FROM posts p
+	JOIN unnest($1::text[], $2::text[]) AS b(url, content_hash) ON (p.url = b.url AND p.content_hash = b.content_hash)
+	WHERE p.scope = $3
+	UNION
+	SELECT url
+	FROM pruned_posts
+	WHERE url = ANY($1::text[])
+	AND scope = $3;`,
+		pq.Array(urls), pq.Array(hashes), scope)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	unchanged := make(map[string]bool)
+	for rows.Next() {
+		var url string
+		err = rows.Scan(&url)
+		if err != nil {
+			return nil, err
+		}
+
+		unchanged[url] = true
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	batch := make([]*batchedPost, 0, len(posts))
+	for i, p := range posts {
+		if unchanged[keys[i].url] {
+			continue
+		}
+
+		batch = append(batch, &batchedPost{post: p, key: keys[i]})
+	}
+
+	return batch, nil
+}
@@ -0,0 +1,231 @@
+package pg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// blobPrefix marks a body kept in the blob store, the rest of the column is the
+// hash of the body, which is also where it is kept
+const blobPrefix = "blob_"
+
+// A BlobStore keeps the bodies of posts outside of postgres, so the database
+// stays small when bodies are large
+type BlobStore interface {
+	PutBlob(ctx context.Context, key string, contents []byte) error
+	GetBlob(ctx context.Context, key string) (io.ReadCloser, error)
+	// DeleteBlob deletes the blob at key, if it exists
+	DeleteBlob(ctx context.Context, key string) error
+}
+
+// SetBlobStore keeps the bodies of posts at least minSize bytes long in bs,
+// compressed as they would be in postgres. Bodies already stored are left
+// where they are, and are readable whether or not bs is set
+func (db *DB) SetBlobStore(bs BlobStore, minSize int) {
+	db.blobs = bs
+	db.blobMinSize = minSize
+}
+
+// blobKey is where the body with the given hash is kept, bodies are addressed
+// by their content so writing the same one twice only stores it once
+func blobKey(hash string) string {
+	return "bodies/" + hash
+}
+
+// storeBody returns what is stored in the body column of post_bodies given the
+// body and its hash, the body compressed or, if it is large enough, a pointer
+// to it in the blob store
+func (db *DB) storeBody(ctx context.Context, hash, body string) (string, error) {
+	if db.blobs == nil || len(body) < db.blobMinSize {
+		return db.compress(body)
+	}
+
+	var c codec = gzipCodec{}
+	if db.codec != nil {
+		c = db.codec
+	}
+
+	out, err := c.compress([]byte(body))
+	if err != nil {
+		return "", err
+	}
+
+	// prefixed with the codec, as compressed bodies are in postgres
+	contents := append([]byte(c.name()+"_"), out...)
+	if db.bodyKeyID() != "" {
+		contents, err = db.keys.seal(contents, nil)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = db.blobs.PutBlob(ctx, blobKey(hash), contents)
+	if err != nil {
+		return "", err
+	}
+
+	return blobPrefix + hash, nil
+}
+
+// loadBody returns the body of a post given what is stored in its body column,
+// streaming it from the blob store if it is kept there
+func (db *DB) loadBody(ctx context.Context, stored string) (string, error) {
+	if !strings.HasPrefix(stored, blobPrefix) {
+		return db.decompress(stored)
+	}
+
+	if db.blobs == nil {
+		return "", errors.New("pg: post body is kept in a blob store, but none is set")
+	}
+
+	hash := strings.TrimPrefix(stored, blobPrefix)
+	rc, err := db.blobs.GetBlob(ctx, blobKey(hash))
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	br := bufio.NewReader(rc)
+
+	// sealed blobs can only be opened whole, so they are read into memory
+	if prefix, _ := br.Peek(len(encPrefix)); string(prefix) == encPrefix {
+		if db.keys == nil {
+			return "", errors.New("pg: post body is encrypted, but no keys are set")
+		}
+
+		sealed, err := ioutil.ReadAll(br)
+		if err != nil {
+			return "", err
+		}
+
+		opened, err := db.keys.open(sealed, nil)
+		if err != nil {
+			return "", err
+		}
+
+		br = bufio.NewReader(bytes.NewReader(opened))
+	}
+
+	name, err := br.ReadString('_')
+	if err != nil {
+		return "", err
+	}
+
+	c, err := db.codecNamed(strings.TrimSuffix(name, "_"))
+	if err != nil {
+		return "", err
+	}
+
+	dr, err := c.reader(br)
+	if err != nil {
+		return "", err
+	}
+	defer dr.Close()
+
+	h, sum, err := db.bodyHasher(hash)
+	if err != nil {
+		return "", err
+	}
+
+	var body strings.Builder
+	_, err = io.Copy(io.MultiWriter(&body, h), dr)
+	if err != nil {
+		return "", err
+	}
+
+	if hex.EncodeToString(h.Sum(nil)) != sum {
+		return "", fmt.Errorf("pg: body %s does not match its hash", hash)
+	}
+
+	return body.String(), nil
+}
+
+// codecNamed returns the codec with the given name
+func (db *DB) codecNamed(name string) (codec, error) {
+	switch {
+	case name == "gzip":
+		return gzipCodec{}, nil
+	case name == "zstd" && db.zstd != nil:
+		return db.zstd, nil
+	default:
+		return nil, fmt.Errorf("pg: unknown codec %q", name)
+	}
+}
+
+// NewDirBlobStore returns a BlobStore that keeps blobs as files under dir
+func NewDirBlobStore(dir string) (*DirBlobStore, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(abs, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DirBlobStore{dir: abs}, nil
+}
+
+// DirBlobStore is a BlobStore backed by the filesystem
+type DirBlobStore struct {
+	dir string
+}
+
+func (ds *DirBlobStore) path(key string) string {
+	return filepath.Join(ds.dir, filepath.FromSlash(key))
+}
+
+// PutBlob writes the blob to a temporary file and renames it into place, so
+// a blob is never read half written
+func (ds *DirBlobStore) PutBlob(ctx context.Context, key string, contents []byte) error {
+	path := ds.path(key)
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), ".blob")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(contents)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// GetBlob opens the blob at key
+func (ds *DirBlobStore) GetBlob(ctx context.Context, key string) (io.ReadCloser, error) {
+	return os.Open(ds.path(key))
+}
+
+// DeleteBlob removes the blob at key
+func (ds *DirBlobStore) DeleteBlob(ctx context.Context, key string) error {
+	err := os.Remove(ds.path(key))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package pg
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBlobBodies(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "hydrocarbon-blobs-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bs, err := NewDirBlobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := &DB{}
+	db.SetBlobStore(bs, 100)
+
+	var cases = []struct {
+		body string
+		blob bool
+	}{
+		{"<p>short</p>", false},
+		{strings.Repeat("<p>a very long chapter</p>", 100), true},
+	}
+
+	var stored string
+	for _, c := range cases {
+		stored, err = db.storeBody(ctx, db.bodyHash(c.body), c.body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasPrefix(stored, blobPrefix) != c.blob {
+			t.Fatalf("expected the body to be in the blob store: %t, got %q", c.blob, stored)
+		}
+
+		out, err := db.loadBody(ctx, stored)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != c.body {
+			t.Fatal("did not get back the same body after loading it")
+		}
+	}
+
+	// a blob that was tampered with is not returned
+	hash := strings.TrimPrefix(stored, blobPrefix)
+	err = bs.PutBlob(ctx, blobKey(hash), []byte("gzip_nonsense"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.loadBody(ctx, stored)
+	if err == nil {
+		t.Fatal("expected an error loading a corrupted blob")
+	}
+}
@@ -0,0 +1,207 @@
+package pg
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	gohash "hash"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// bodies no post refers to are deleted this many at a time, each time the
+// maintainer runs
+const bodyPruneBatchSize = 5000
+
+// a storedBody is the body of a post ready to be written to post_bodies, posts
+// refer to their body by its hash so identical bodies are only stored once
+type storedBody struct {
+	hash string
+	// stored is left empty when the body is already in post_bodies
+	stored string
+}
+
+// hashPrefix marks the hash of a body keyed with an encryption key, it is
+// followed by the ID of the key and _
+const hashPrefix = "hmac."
+
+// bodyHash returns the hash a body is stored under, its sha256 or, while
+// bodies are encrypted, its HMAC with the active key, so that whether a body
+// is stored can not be found out by hashing a guess at it
+func (db *DB) bodyHash(body string) string {
+	id := db.bodyKeyID()
+	if id == "" {
+		sum := sha256.Sum256([]byte(body))
+		return hex.EncodeToString(sum[:])
+	}
+
+	mac := hmac.New(sha256.New, db.keys.hashKeys[id])
+	mac.Write([]byte(body))
+	return hashPrefix + id + "_" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// bodyHasher returns what the body stored under hash was hashed with, and the
+// hex encoded sum it has
+func (db *DB) bodyHasher(hash string) (gohash.Hash, string, error) {
+	if !strings.HasPrefix(hash, hashPrefix) {
+		return sha256.New(), hash, nil
+	}
+
+	i := strings.IndexByte(hash, '_')
+	if i < 0 {
+		return nil, "", errors.New("pg: body hash has no key ID")
+	}
+	if db.keys == nil {
+		return nil, "", errors.New("pg: post body is hashed with a key, but no keys are set")
+	}
+
+	id := hash[len(hashPrefix):i]
+	key, ok := db.keys.hashKeys[id]
+	if !ok {
+		return nil, "", fmt.Errorf("pg: body hashed with unknown key %q", id)
+	}
+
+	return hmac.New(sha256.New, key), hash[i+1:], nil
+}
+
+// prepareBody hashes body and, unless it is already stored, compresses it or
+// keeps it in the blob store
+func (db *DB) prepareBody(ctx context.Context, body string) (*storedBody, error) {
+	sbs, err := db.prepareBodies(ctx, []string{body})
+	if err != nil {
+		return nil, err
+	}
+
+	return sbs[0], nil
+}
+
+// prepareBodies prepares many bodies at once, see prepareBody
+func (db *DB) prepareBodies(ctx context.Context, bodies []string) ([]*storedBody, error) {
+	hashes := make([]string, len(bodies))
+	for i, b := range bodies {
+		hashes[i] = db.bodyHash(b)
+	}
+
+	rows, err := db.sql.QueryContext(ctx, `
+	SELECT hash FROM post_bodies WHERE hash = ANY($1);`, pq.Array(hashes))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stored := make(map[string]bool)
+	for rows.Next() {
+		var hash string
+		err = rows.Scan(&hash)
+		if err != nil {
+			return nil, err
+		}
+
+		stored[hash] = true
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	sbs := make([]*storedBody, len(bodies))
+	for i, b := range bodies {
+		sbs[i] = &storedBody{hash: hashes[i]}
+		if stored[hashes[i]] {
+			continue
+		}
+
+		sbs[i].stored, err = db.storeBody(ctx, hashes[i], b)
+		if err != nil {
+			return nil, err
+		}
+
+		// the same body twice in one batch is only stored once
+		stored[hashes[i]] = true
+	}
+
+	return sbs, nil
+}
+
+// insertBody writes sb to post_bodies, in the transaction that writes the post
+// that refers to it. A body pruned since it was prepared fails the post, so the
+// task is retried
+func (db *DB) insertBody(ctx context.Context, tx *sql.Tx, sb *storedBody) error {
+	if sb.stored == "" {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, `
+	INSERT INTO post_bodies
+	(hash, body, key_id)
+	VALUES
+	($1, $2, NULLIF($3, ''))
+	ON CONFLICT DO NOTHING;`, sb.hash, sb.stored, db.bodyKeyID())
+	return err
+}
+
+// PruneBodies deletes up to limit bodies no post refers to anymore, those of
+// pruned posts and those replaced by an update, and returns how many it
+// deleted. Their blobs are deleted before the bodies are, so a body written
+// again meanwhile has its blob put back
+func (db *DB) PruneBodies(ctx context.Context, limit int) (n int64, err error) {
+	err = db.withTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+		DELETE FROM post_bodies
+		WHERE hash IN (
+			SELECT hash
+			FROM post_bodies pb
+			WHERE NOT EXISTS (SELECT 1 FROM posts WHERE body_hash = pb.hash)
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING body;`, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var blobs []string
+		for rows.Next() {
+			var body string
+			err = rows.Scan(&body)
+			if err != nil {
+				return err
+			}
+
+			n++
+			if strings.HasPrefix(body, blobPrefix) {
+				blobs = append(blobs, strings.TrimPrefix(body, blobPrefix))
+			}
+		}
+
+		err = rows.Err()
+		if err != nil {
+			return err
+		}
+
+		if db.blobs == nil {
+			return nil
+		}
+
+		for _, hash := range blobs {
+			err = db.blobs.DeleteBlob(ctx, blobKey(hash))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
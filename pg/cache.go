@@ -0,0 +1,249 @@
+package pg
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// cached reads are kept this long at most, they are normally invalidated
+	// well before by the writes that change them, see invalidateUsers
+	cacheTTL = 10 * time.Minute
+	// sessions are cached for less, so a deleted session stops being able to
+	// read soon after
+	sessionCacheTTL = time.Minute
+)
+
+// A Cache keeps the results of hot reads, such as the folders of a user,
+// outside of postgres. Values may be evicted at any time
+type Cache interface {
+	// Get returns nil when key is not cached
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// SetCache caches the folders, with unread counts, and the posts read by each
+// user in c. Everything cached for a user is keyed by their generation, a
+// random token every write that changes what they read deletes once it has
+// committed, so cached reads are never stale for longer than that
+func (db *DB) SetCache(c Cache) {
+	db.cache = c
+}
+
+func userGenKey(userID string) string {
+	return "hc:gen:" + userID
+}
+
+// cacheKey returns the key what the user with sessionKey reads as name is
+// cached under, which changes with their generation. It is empty when there
+// is no cache, or it cannot be used
+func (db *DB) cacheKey(ctx context.Context, sessionKey, name string) string {
+	if db.cache == nil {
+		return ""
+	}
+
+	userID, err := db.cachedUserID(ctx, sessionKey)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Println("pg: cache:", err)
+		}
+		return ""
+	}
+
+	gen, err := db.cache.Get(ctx, userGenKey(userID))
+	if err != nil {
+		log.Println("pg: cache:", err)
+		return ""
+	}
+
+	// a new generation is started whenever there is none, whether it was
+	// invalidated, expired or evicted, so an old one is never reused
+	if gen == nil {
+		gen, err = newGeneration()
+		if err == nil {
+			err = db.cache.Set(ctx, userGenKey(userID), gen, cacheTTL)
+		}
+		if err != nil {
+			log.Println("pg: cache:", err)
+			return ""
+		}
+	}
+
+	return fmt.Sprintf("hc:%s:%s:%s", userID, gen, name)
+}
+
+// cachedUserID returns the ID of the user with sessionKey
+func (db *DB) cachedUserID(ctx context.Context, sessionKey string) (string, error) {
+	key := "hc:session:" + sessionKey
+	userID, err := db.cache.Get(ctx, key)
+	if err != nil || userID != nil {
+		return string(userID), err
+	}
+
+	var id string
+	err = db.sql.QueryRowContext(ctx, `
+	SELECT user_id FROM sessions WHERE key = $1;`, sessionKey).Scan(&id)
+	if err != nil {
+		return "", err
+	}
+
+	return id, db.cache.Set(ctx, key, []byte(id), sessionCacheTTL)
+}
+
+// cacheGet decodes the value at key into v, returning false if it is not
+// cached. Failing to read the cache is only logged, the read then falls
+// through to postgres
+func (db *DB) cacheGet(ctx context.Context, key string, v interface{}) bool {
+	if key == "" {
+		return false
+	}
+
+	buf, err := db.cache.Get(ctx, key)
+	if err != nil || buf == nil {
+		if err != nil {
+			log.Println("pg: cache:", err)
+		}
+		return false
+	}
+
+	// cached reads have post bodies in them, so they are sealed as bodies are
+	if bytes.HasPrefix(buf, []byte(encPrefix)) {
+		if db.keys == nil {
+			return false
+		}
+
+		buf, err = db.keys.open(buf, []byte(key))
+		if err != nil {
+			log.Println("pg: cache:", err)
+			return false
+		}
+	}
+
+	err = json.Unmarshal(buf, v)
+	if err != nil {
+		log.Println("pg: cache:", err)
+		return false
+	}
+
+	return true
+}
+
+// cacheSet caches v at key, unless key is empty
+func (db *DB) cacheSet(ctx context.Context, key string, v interface{}) {
+	if key == "" {
+		return
+	}
+
+	buf, err := json.Marshal(v)
+	if err != nil {
+		log.Println("pg: cache:", err)
+		return
+	}
+
+	if db.bodyKeyID() != "" {
+		buf, err = db.keys.seal(buf, []byte(key))
+		if err != nil {
+			log.Println("pg: cache:", err)
+			return
+		}
+	}
+
+	err = db.cache.Set(ctx, key, buf, cacheTTL)
+	if err != nil {
+		log.Println("pg: cache:", err)
+	}
+}
+
+func newGeneration() ([]byte, error) {
+	buf := make([]byte, 8)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(hex.EncodeToString(buf)), nil
+}
+
+// invalidateUsers deletes the generation of each user, so nothing cached for
+// them before is read again. A failure is only logged, what was cached then
+// expires with cacheTTL
+func (db *DB) invalidateUsers(ctx context.Context, userIDs ...string) {
+	if db.cache == nil || len(userIDs) == 0 {
+		return
+	}
+
+	keys := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		keys[i] = userGenKey(id)
+	}
+
+	err := db.cache.Delete(ctx, keys...)
+	if err != nil {
+		log.Println("pg: cache: could not invalidate:", err)
+	}
+}
+
+// invalidateSession invalidates the cache of the user with sessionKey
+func (db *DB) invalidateSession(ctx context.Context, sessionKey string) {
+	if db.cache == nil {
+		return
+	}
+
+	userID, err := db.cachedUserID(ctx, sessionKey)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Println("pg: cache: could not invalidate:", err)
+		}
+		return
+	}
+
+	db.invalidateUsers(ctx, userID)
+}
+
+// invalidateFeeds invalidates the cache of every user following any of the
+// feeds, as their unread counts and posts change when the feeds are written
+func (db *DB) invalidateFeeds(ctx context.Context, feedIDs ...string) {
+	if db.cache == nil || len(feedIDs) == 0 {
+		return
+	}
+
+	rows, err := db.sql.QueryContext(ctx, `
+	SELECT DISTINCT user_id
+	FROM feed_folders
+	WHERE feed_id = ANY($1);`, pq.Array(feedIDs))
+	if err != nil {
+		log.Println("pg: cache: could not invalidate:", err)
+		return
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var id string
+		err = rows.Scan(&id)
+		if err != nil {
+			log.Println("pg: cache: could not invalidate:", err)
+			return
+		}
+
+		userIDs = append(userIDs, id)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		log.Println("pg: cache: could not invalidate:", err)
+		return
+	}
+
+	db.invalidateUsers(ctx, userIDs...)
+}
@@ -0,0 +1,90 @@
+package pg
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+type memCache struct {
+	mu     sync.Mutex
+	values map[string][]byte
+}
+
+func (mc *memCache) Get(ctx context.Context, key string) ([]byte, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.values[key], nil
+}
+
+func (mc *memCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.values[key] = value
+	return nil
+}
+
+func (mc *memCache) Delete(ctx context.Context, keys ...string) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	for _, k := range keys {
+		delete(mc.values, k)
+	}
+	return nil
+}
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mc := &memCache{values: map[string][]byte{"hc:session:key": []byte("user")}}
+	db := &DB{}
+	db.SetCache(mc)
+
+	key := db.cacheKey(ctx, "key", "post:1")
+	if key == "" {
+		t.Fatal("expected a cache key")
+	}
+
+	var p *hydrocarbon.Post
+	if db.cacheGet(ctx, key, &p) {
+		t.Fatal("expected nothing cached yet")
+	}
+
+	db.cacheSet(ctx, key, &hydrocarbon.Post{ID: "1", Body: "<p>secret</p>"})
+	if !db.cacheGet(ctx, key, &p) || p.Body != "<p>secret</p>" {
+		t.Fatalf("expected the cached post, got %+v", p)
+	}
+
+	if again := db.cacheKey(ctx, "key", "post:1"); again != key {
+		t.Fatalf("expected the same key until invalidated, got %s and %s", key, again)
+	}
+
+	// writes start a new generation, so nothing cached before is read
+	db.invalidateSession(ctx, "key")
+	invalidated := db.cacheKey(ctx, "key", "post:1")
+	if invalidated == key {
+		t.Fatal("expected a new key once invalidated")
+	}
+	if db.cacheGet(ctx, invalidated, &p) {
+		t.Fatal("read what was cached before invalidating")
+	}
+
+	// bodies are sealed in the cache when they are in postgres
+	err := db.SetEncryptionKeys(map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.cacheSet(ctx, invalidated, &hydrocarbon.Post{ID: "1", Body: "<p>secret</p>"})
+	if bytes.Contains(mc.values[invalidated], []byte("secret")) {
+		t.Fatal("cached post was not sealed")
+	}
+	if !db.cacheGet(ctx, invalidated, &p) || p.Body != "<p>secret</p>" {
+		t.Fatalf("expected the cached post, got %+v", p)
+	}
+}
@@ -0,0 +1,207 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+// changesChannel is notified of every change by the triggers added in
+// 38_change_notify
+const changesChannel = "hydrocarbon_changes"
+
+// changeBuffer is how many changes a subscriber may fall behind by before
+// further changes are dropped
+const changeBuffer = 64
+
+// change is the payload of a notification, follows and reads also carry the
+// user. Every change carries the schema it was made in since 44_tenant_changes
+type change struct {
+	hydrocarbon.Change
+	UserID string `json:"user_id"`
+	Schema string `json:"schema"`
+}
+
+// a changeHub shares a single listener between every subscriber, it listens
+// only while there are any
+type changeHub struct {
+	mu       sync.Mutex
+	listener *pq.Listener
+	subs     map[*changeSub]bool
+}
+
+// a changeSub is sent the changes to the feeds a user follows, in the schema
+// of their tenant
+type changeSub struct {
+	tenant string
+	userID string
+	feeds  map[string]bool
+	c      chan *hydrocarbon.Change
+}
+
+// SubscribeChanges returns the changes to the feeds the user follows until ctx
+// is done. Notifications sent while the listener reconnects are lost
+func (db *DB) SubscribeChanges(ctx context.Context, sessionKey string) (<-chan *hydrocarbon.Change, error) {
+	var userID string
+	err := db.sql.QueryRowContext(ctx, `
+	SELECT user_id
+	FROM sessions
+	WHERE key = $1 AND active = TRUE;`, sessionKey).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("invalid or inactive token")
+		}
+		return nil, err
+	}
+
+	feeds, err := db.followedFeeds(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &changeSub{
+		tenant: db.tenantOf(ctx),
+		userID: userID,
+		feeds:  feeds,
+		c:      make(chan *hydrocarbon.Change, changeBuffer),
+	}
+
+	h := &db.changes
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.listener == nil {
+		l := pq.NewListener(db.dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+			if err != nil {
+				log.Printf("pg: change listener: %s", err)
+			}
+		})
+
+		err = l.Listen(changesChannel)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+
+		h.listener = l
+		h.subs = make(map[*changeSub]bool)
+		go db.dispatchChanges(l)
+	}
+	h.subs[sub] = true
+
+	go func() {
+		<-ctx.Done()
+
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		delete(h.subs, sub)
+		close(sub.c)
+
+		if len(h.subs) == 0 {
+			h.listener.Close()
+			h.listener = nil
+		}
+	}()
+
+	return sub.c, nil
+}
+
+// dispatchChanges sends every notification l receives to the subscribers it
+// concerns, until l is closed
+func (db *DB) dispatchChanges(l *pq.Listener) {
+	for n := range l.Notify {
+		// nil after the listener reconnects
+		if n == nil {
+			continue
+		}
+
+		var c change
+		err := json.Unmarshal([]byte(n.Extra), &c)
+		if err != nil {
+			log.Printf("pg: invalid change %q: %s", n.Extra, err)
+			continue
+		}
+
+		// the feeds of the user are reloaded before the change is sent, so
+		// changes to a feed they just followed are not missed
+		var feeds map[string]bool
+		if c.Kind == hydrocarbon.ChangeFollow {
+			ctx := context.Background()
+			if db.tenants {
+				ctx = TenantContext(ctx, tenantOfSchema(c.Schema))
+			}
+
+			feeds, err = db.followedFeeds(ctx, c.UserID)
+			if err != nil {
+				log.Printf("pg: could not reload followed feeds: %s", err)
+			}
+		}
+
+		db.changes.send(&c, feeds)
+	}
+}
+
+// send sends c to every subscriber following its feed, or to the user whose
+// follows or read posts changed, without waiting on any of them
+func (h *changeHub) send(c *change, feeds map[string]bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subs {
+		if sub.tenant != tenantOfSchema(c.Schema) {
+			continue
+		}
+
+		if c.Kind == hydrocarbon.ChangeFollow || c.Kind == hydrocarbon.ChangeRead {
+			if sub.userID != c.UserID {
+				continue
+			}
+
+			if feeds != nil {
+				sub.feeds = feeds
+			}
+		} else if !sub.feeds[c.FeedID] {
+			continue
+		}
+
+		hc := c.Change
+		select {
+		case sub.c <- &hc:
+		default:
+		}
+	}
+}
+
+// followedFeeds returns the IDs of the feeds a user follows
+func (db *DB) followedFeeds(ctx context.Context, userID string) (map[string]bool, error) {
+	rows, err := db.sql.QueryContext(ctx, `
+	SELECT DISTINCT feed_id
+	FROM feed_folders
+	WHERE user_id = $1;`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	feeds := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		feeds[id] = true
+	}
+
+	return feeds, rows.Err()
+}
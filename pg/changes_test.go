@@ -0,0 +1,64 @@
+package pg
+
+import (
+	"testing"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+func TestChangeHubSend(t *testing.T) {
+	t.Parallel()
+
+	follower := &changeSub{userID: "a", feeds: map[string]bool{"feed": true}, c: make(chan *hydrocarbon.Change, 1)}
+	other := &changeSub{userID: "b", feeds: map[string]bool{}, c: make(chan *hydrocarbon.Change, 1)}
+	h := &changeHub{subs: map[*changeSub]bool{follower: true, other: true}}
+
+	h.send(&change{Change: hydrocarbon.Change{Kind: hydrocarbon.ChangePost, ID: "post", FeedID: "feed"}}, nil)
+	if c := <-follower.c; c.ID != "post" {
+		t.Fatalf("expected the follower to be sent the post, got %+v", c)
+	}
+	if len(other.c) != 0 {
+		t.Fatal("expected a user not following the feed to be sent nothing")
+	}
+
+	h.send(&change{Change: hydrocarbon.Change{Kind: hydrocarbon.ChangeFollow, FeedID: "feed"}, UserID: "b"}, map[string]bool{"feed": true})
+	if c := <-other.c; c.Kind != hydrocarbon.ChangeFollow {
+		t.Fatalf("expected the follow to be sent, got %+v", c)
+	}
+	if len(follower.c) != 0 {
+		t.Fatal("expected follows to be sent only to their user")
+	}
+
+	h.send(&change{Change: hydrocarbon.Change{Kind: hydrocarbon.ChangeRead, FeedID: "feed", State: "read"}, UserID: "a"}, nil)
+	if c := <-follower.c; c.Kind != hydrocarbon.ChangeRead {
+		t.Fatalf("expected the read to be sent, got %+v", c)
+	}
+	if len(other.c) != 0 {
+		t.Fatal("expected reads to be sent only to their user")
+	}
+
+	// full subscribers are skipped rather than waited on
+	h.send(&change{Change: hydrocarbon.Change{Kind: hydrocarbon.ChangeScrape, ID: "scrape", FeedID: "feed"}}, nil)
+	h.send(&change{Change: hydrocarbon.Change{Kind: hydrocarbon.ChangeScrape, ID: "scrape", FeedID: "feed"}}, nil)
+	if len(other.c) != 1 || len(follower.c) != 1 {
+		t.Fatal("expected both followers to be sent the first scrape change")
+	}
+}
+
+func TestChangeHubSendTenants(t *testing.T) {
+	t.Parallel()
+
+	public := &changeSub{userID: "a", feeds: map[string]bool{"feed": true}, c: make(chan *hydrocarbon.Change, 1)}
+	acme := &changeSub{tenant: "acme", userID: "a", feeds: map[string]bool{"feed": true}, c: make(chan *hydrocarbon.Change, 1)}
+	h := &changeHub{subs: map[*changeSub]bool{public: true, acme: true}}
+
+	h.send(&change{Change: hydrocarbon.Change{Kind: hydrocarbon.ChangePost, ID: "post", FeedID: "feed"}, Schema: "tenant_acme"}, nil)
+	if len(acme.c) != 1 || len(public.c) != 0 {
+		t.Fatal("expected a change in the schema of a tenant to be sent only to its subscribers")
+	}
+
+	h.send(&change{Change: hydrocarbon.Change{Kind: hydrocarbon.ChangePost, ID: "post", FeedID: "feed"}, Schema: "public"}, nil)
+	if len(public.c) != 1 {
+		t.Fatal("expected a change in the public schema to be sent to subscribers without a tenant")
+	}
+}
@@ -4,63 +4,109 @@ import (
 	"bytes"
 	"compress/gzip"
 	"encoding/base64"
+	"io"
 	"io/ioutil"
 	"strings"
 )
 
-const compressionPrefix = "gzip_"
+// a codec compresses post bodies. Every body is stored prefixed with the name
+// of the codec that compressed it, so rows written with any codec stay
+// readable whichever one new rows are written with
+type codec interface {
+	name() string
+	compress(in []byte) ([]byte, error)
+	decompress(in []byte) ([]byte, error)
+	// reader decompresses r as it is read, for bodies too large to hold
+	// compressed and decompressed at once
+	reader(r io.Reader) (io.ReadCloser, error)
+}
+
+// compressText compresses text with c
+func compressText(c codec, in string) (string, error) {
+	out, err := c.compress([]byte(in))
+	if err != nil {
+		return "", err
+	}
+
+	return c.name() + "_" + base64.StdEncoding.EncodeToString(out), nil
+}
+
+// decompressText decompresses text with whichever of codecs it was compressed
+// with, text without a prefix was stored before compression was added
+func decompressText(in string, codecs ...codec) (string, error) {
+	for _, c := range append([]codec{gzipCodec{}}, codecs...) {
+		if !strings.HasPrefix(in, c.name()+"_") {
+			continue
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(in, c.name()+"_"))
+		if err != nil {
+			return "", err
+		}
+
+		out, err := c.decompress(decoded)
+		if err != nil {
+			return "", err
+		}
+
+		return string(out), nil
+	}
+
+	return in, nil
+}
+
+// gzipCodec is the codec bodies were first compressed with
+type gzipCodec struct{}
+
+func (gzipCodec) name() string {
+	return "gzip"
+}
 
-// compressText gzips text
-func compressText(in string) (string, error) {
+func (gzipCodec) compress(in []byte) ([]byte, error) {
 	var buf bytes.Buffer
 
 	zw, err := gzip.NewWriterLevel(&buf, 5)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	_, err = zw.Write([]byte(in))
+	_, err = zw.Write(in)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	err = zw.Flush()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	err = zw.Close()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return compressionPrefix + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+	return buf.Bytes(), nil
 }
 
-func decompressText(in string) (string, error) {
-	if !strings.HasPrefix(in, compressionPrefix) {
-		return in, nil
-	}
-
-	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(in, compressionPrefix))
-	if err != nil {
-		return "", err
-	}
-
-	zr, err := gzip.NewReader(bytes.NewReader(decoded))
+func (gzipCodec) decompress(in []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(in))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	decomp, err := ioutil.ReadAll(zr)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	err = zr.Close()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return string(decomp), nil
+	return decomp, nil
+}
+
+func (gzipCodec) reader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
 }
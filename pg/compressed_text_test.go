@@ -1,11 +1,19 @@
 package pg
 
-import "testing"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/dict"
+	"github.com/klauspost/compress/zstd"
+)
 
 func TestCompression(t *testing.T) {
 	var text = `awiojposen&V9r800wenvuasnu cvopaS*N()ea-8dfv9asuy*(_DVN-`
 
-	out, err := compressText(text)
+	out, err := compressText(gzipCodec{}, text)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -19,3 +27,79 @@ func TestCompression(t *testing.T) {
 		t.Fatal("did not get back the same thing after decompressing")
 	}
 }
+
+func TestZstdCompression(t *testing.T) {
+	var samples [][]byte
+	for i := 0; i < 200; i++ {
+		samples = append(samples, []byte(fmt.Sprintf(`<div class="storytext"><p>Chapter %d</p><p>%s</p></div>`, i, strings.Repeat("the quick brown fox jumps over the lazy dog ", i%7+1))))
+	}
+
+	d, err := dict.BuildZstdDict(samples, dict.Options{
+		MaxDictSize: 4 << 10,
+		HashBytes:   6,
+		ZstdDictID:  32768,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withDict, err := newZstdCodec([][]byte{d})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	noDict, err := newZstdCodec(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var text = `<div class="storytext"><p>Chapter 201</p><p>the quick brown fox jumps over the lazy dog</p></div>`
+
+	small, err := compressText(withDict, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	large, err := compressText(noDict, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(small) >= len(large) {
+		t.Fatalf("expected the dictionary to help, got %d bytes with it and %d without", len(small), len(large))
+	}
+
+	// bodies written with any codec can be read back while another is in use
+	gz, err := compressText(gzipCodec{}, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, in := range []string{small, large, gz, text} {
+		dec, err := decompressText(in, withDict)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if dec != text {
+			t.Fatalf("did not get back the same thing after decompressing %q", in)
+		}
+	}
+
+	// a body compressed with a dictionary that is not loaded can not be read
+	_, err = decompressText(small, noDict)
+	if !errors.Is(err, zstd.ErrUnknownDictionary) {
+		t.Fatalf("expected an unknown dictionary decompressing without it, got %v", err)
+	}
+
+	// until the dictionary trained elsewhere is loaded
+	err = noDict.set([][]byte{d})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec, err := decompressText(small, noDict)
+	if err != nil || dec != text {
+		t.Fatalf("expected the body back once the dictionary is loaded, got %q and %v", dec, err)
+	}
+}
@@ -0,0 +1,346 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/compress/dict"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// the most bodies a dictionary is trained on
+	maxDictionarySamples = 5000
+	// fewer bodies than this make a dictionary that does more harm than good
+	minDictionarySamples = 50
+	// the largest dictionary the reference zstd trainer makes by default
+	maxDictionarySize = 112 << 10
+	// dictionaries trained by other nodes are loaded this often, bodies
+	// compressed with one not loaded yet load it straight away
+	dictionaryReloadInterval = 5 * time.Minute
+)
+
+// SetCompression picks the codec post bodies are written with, gzip or zstd.
+// zstd bodies are compressed with the newest dictionary trained on the HTML
+// of stored posts, if there is none one is trained on up to samples of the
+// latest. Bodies already stored are left as they are and stay readable
+func (db *DB) SetCompression(ctx context.Context, name string, samples int) error {
+	switch name {
+	case "gzip":
+		db.codec = gzipCodec{}
+		return nil
+	case "zstd":
+	default:
+		return fmt.Errorf("pg: unknown compression %q, must be gzip or zstd", name)
+	}
+
+	if db.zstd.size() == 0 && samples > 0 {
+		err := db.trainDictionary(ctx, samples)
+		if err != nil {
+			return err
+		}
+	}
+
+	db.codec = db.zstd
+	return nil
+}
+
+// compress compresses a post body, then seals it if bodies are encrypted
+func (db *DB) compress(in string) (string, error) {
+	db.reloadDictionaries()
+
+	var c codec = gzipCodec{}
+	if db.codec != nil {
+		c = db.codec
+	}
+
+	out, err := compressText(c, in)
+	if err != nil || db.bodyKeyID() == "" {
+		return out, err
+	}
+
+	return db.keys.sealText(out)
+}
+
+func (db *DB) decompress(in string) (string, error) {
+	if strings.HasPrefix(in, encPrefix) {
+		if db.keys == nil {
+			return "", errors.New("pg: post body is encrypted, but no keys are set")
+		}
+
+		var err error
+		in, err = db.keys.openText(in)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if db.zstd == nil {
+		return decompressText(in)
+	}
+
+	db.reloadDictionaries()
+	out, err := decompressText(in, db.zstd)
+	if errors.Is(err, zstd.ErrUnknownDictionary) {
+		err = db.zstd.reload(context.Background(), db.sql)
+		if err != nil {
+			return "", err
+		}
+
+		return decompressText(in, db.zstd)
+	}
+
+	return out, err
+}
+
+// reloadDictionaries loads dictionaries trained by other nodes in the
+// background, once dictionaryReloadInterval has passed since they were last
+// loaded
+func (db *DB) reloadDictionaries() {
+	if db.zstd == nil || !db.zstd.stale() {
+		return
+	}
+
+	go func() {
+		err := db.zstd.reload(context.Background(), db.sql)
+		if err != nil {
+			log.Printf("pg: could not reload compression dictionaries: %s", err)
+		}
+	}()
+}
+
+// trainDictionary trains a new dictionary on the bodies of the latest posts
+// and loads it for compression
+func (db *DB) trainDictionary(ctx context.Context, samples int) error {
+	if samples > maxDictionarySamples {
+		samples = maxDictionarySamples
+	}
+
+	// bodies kept in the blob store are left out, fetching thousands of them
+	// would hold up startup
+	rows, err := db.sql.QueryContext(ctx, `
+	SELECT COALESCE(pb.body, po.body) AS body
+	FROM posts po
+	LEFT JOIN post_bodies pb ON (pb.hash = po.body_hash)
+	WHERE COALESCE(pb.body, po.body) NOT LIKE 'blob\_%'
+	ORDER BY po.created_at DESC
+	LIMIT $1;`, samples)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var contents [][]byte
+	for rows.Next() {
+		var compressedBody string
+		err = rows.Scan(&compressedBody)
+		if err != nil {
+			return err
+		}
+
+		body, err := db.decompress(compressedBody)
+		if err != nil {
+			return err
+		}
+
+		contents = append(contents, []byte(body))
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	// too few posts to learn from, bodies are compressed without one until
+	// another node trains one or the next restart
+	if len(contents) < minDictionarySamples {
+		return nil
+	}
+
+	var id uint32
+	err = db.sql.QueryRowContext(ctx, `SELECT nextval('compression_dictionaries_id_seq');`).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	d, err := dict.BuildZstdDict(contents, dict.Options{
+		MaxDictSize: maxDictionarySize,
+		HashBytes:   6,
+		ZstdDictID:  id,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.sql.ExecContext(ctx, `
+	INSERT INTO compression_dictionaries
+	(id, dict)
+	VALUES
+	($1, $2);`, id, d)
+	if err != nil {
+		return err
+	}
+
+	return db.zstd.reload(ctx, db.sql)
+}
+
+// loadZstdCodec returns a zstd codec that can read bodies compressed with any
+// stored dictionary
+func loadZstdCodec(ctx context.Context, db *sql.DB) (*zstdCodec, error) {
+	dicts, err := loadDictionaries(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	return newZstdCodec(dicts)
+}
+
+// loadDictionaries returns every stored dictionary, oldest first
+func loadDictionaries(ctx context.Context, db *sql.DB) ([][]byte, error) {
+	rows, err := db.QueryContext(ctx, `
+	SELECT dict FROM compression_dictionaries
+	ORDER BY id ASC;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var dicts [][]byte
+	for rows.Next() {
+		var d []byte
+		err = rows.Scan(&d)
+		if err != nil {
+			return nil, err
+		}
+
+		dicts = append(dicts, d)
+	}
+
+	return dicts, rows.Err()
+}
+
+// zstdCodec compresses with the newest of its dictionaries, the ID of which
+// is recorded in every frame, and decompresses with any of them. Its
+// dictionaries are replaced as new ones are trained
+type zstdCodec struct {
+	mu    sync.RWMutex
+	dicts [][]byte
+	enc   *zstd.Encoder
+	dec   *zstd.Decoder
+
+	// loadedAt is when, in unix nanoseconds, the dictionaries were last
+	// loaded
+	loadedAt int64
+}
+
+func newZstdCodec(dicts [][]byte) (*zstdCodec, error) {
+	zc := &zstdCodec{loadedAt: time.Now().UnixNano()}
+	err := zc.set(dicts)
+	if err != nil {
+		return nil, err
+	}
+
+	return zc, nil
+}
+
+// set replaces the dictionaries of the codec
+func (zc *zstdCodec) set(dicts [][]byte) error {
+	var encOpts []zstd.EOption
+	if len(dicts) > 0 {
+		encOpts = append(encOpts, zstd.WithEncoderDict(dicts[len(dicts)-1]))
+	}
+
+	enc, err := zstd.NewWriter(nil, encOpts...)
+	if err != nil {
+		return err
+	}
+
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderDicts(dicts...))
+	if err != nil {
+		return err
+	}
+
+	zc.mu.Lock()
+	defer zc.mu.Unlock()
+
+	if zc.dec != nil {
+		zc.dec.Close()
+	}
+	zc.dicts, zc.enc, zc.dec = dicts, enc, dec
+
+	return nil
+}
+
+// size returns how many dictionaries the codec has
+func (zc *zstdCodec) size() int {
+	zc.mu.RLock()
+	defer zc.mu.RUnlock()
+
+	return len(zc.dicts)
+}
+
+// stale returns true once dictionaryReloadInterval has passed since the
+// dictionaries were loaded, to only one caller, which is to reload them
+func (zc *zstdCodec) stale() bool {
+	loaded := atomic.LoadInt64(&zc.loadedAt)
+	now := time.Now().UnixNano()
+	return now-loaded >= int64(dictionaryReloadInterval) && atomic.CompareAndSwapInt64(&zc.loadedAt, loaded, now)
+}
+
+// reload loads the stored dictionaries, replacing those of the codec if any
+// were added since. Dictionaries are never deleted
+func (zc *zstdCodec) reload(ctx context.Context, db *sql.DB) error {
+	atomic.StoreInt64(&zc.loadedAt, time.Now().UnixNano())
+
+	dicts, err := loadDictionaries(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	if len(dicts) <= zc.size() {
+		return nil
+	}
+
+	return zc.set(dicts)
+}
+
+func (zc *zstdCodec) name() string {
+	return "zstd"
+}
+
+func (zc *zstdCodec) compress(in []byte) ([]byte, error) {
+	zc.mu.RLock()
+	defer zc.mu.RUnlock()
+
+	return zc.enc.EncodeAll(in, nil), nil
+}
+
+func (zc *zstdCodec) decompress(in []byte) ([]byte, error) {
+	zc.mu.RLock()
+	defer zc.mu.RUnlock()
+
+	return zc.dec.DecodeAll(in, nil)
+}
+
+// reader returns a decoder of its own, a single one cannot stream more than
+// one body at a time
+func (zc *zstdCodec) reader(r io.Reader) (io.ReadCloser, error) {
+	zc.mu.RLock()
+	dicts := zc.dicts
+	zc.mu.RUnlock()
+
+	dec, err := zstd.NewReader(r, zstd.WithDecoderDicts(dicts...))
+	if err != nil {
+		return nil, err
+	}
+
+	return dec.IOReadCloser(), nil
+}
@@ -0,0 +1,62 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// GetStripeSubscription returns the user ID and stripe subscription ID of the
+// user the session belongs to
+func (db *DB) GetStripeSubscription(ctx context.Context, sessionKey string) (string, string, error) {
+	row := db.sql.QueryRowContext(ctx, `
+	SELECT id, stripe_subscription_id
+	FROM users
+	WHERE id = (SELECT user_id FROM sessions WHERE key = $1 LIMIT 1);`, sessionKey)
+
+	var userID string
+	var subID sql.NullString
+	err := row.Scan(&userID, &subID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", "", errors.New("invalid or inactive token")
+		}
+		return "", "", err
+	}
+
+	if !subID.Valid {
+		return "", "", errors.New("no subscription exists for this user")
+	}
+
+	return userID, subID.String, nil
+}
+
+// RecordCouponRedemption records that the user has redeemed the code, it
+// returns false if they already had. The unique key of the redemption decides
+// between requests redeeming the same code at once
+func (db *DB) RecordCouponRedemption(ctx context.Context, userID, code string) (bool, error) {
+	res, err := db.sql.ExecContext(ctx, `
+	INSERT INTO coupon_redemptions
+	(user_id, code)
+	VALUES ($1, $2)
+	ON CONFLICT DO NOTHING;`, userID, code)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// DeleteCouponRedemption forgets a redemption whose coupon could not be
+// applied, so the user can redeem the code again
+func (db *DB) DeleteCouponRedemption(ctx context.Context, userID, code string) error {
+	_, err := db.sql.ExecContext(ctx, `
+	DELETE FROM coupon_redemptions
+	WHERE user_id = $1 AND code = $2;`, userID, code)
+	return err
+}
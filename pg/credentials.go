@@ -0,0 +1,203 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+
+	"github.com/fortytw2/hydrocarbon"
+	"github.com/fortytw2/hydrocarbon/discollect"
+)
+
+var errNoCredentialKey = errors.New("pg: no credential key set, credentials can not be stored")
+
+// SetFeedCredentials sets the credentials the user logs into the origin site of
+// a feed they follow with, returning the ID of the feed they are used for.
+// Whatever a scrape with them sees is only for the user, so a feed others can
+// follow is first copied into a private feed of the users own, which they are
+// moved onto along with their transform, and which starts over from a first
+// scrape
+func (db *DB) SetFeedCredentials(ctx context.Context, sessionKey, feedID string, c *discollect.Credentials) (string, error) {
+	buf, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	var privateID string
+	err = db.withTx(ctx, func(tx *sql.Tx) error {
+		var userID string
+		var public bool
+		err := tx.QueryRowContext(ctx, `
+		SELECT s.user_id, f.public
+		FROM feeds f
+		JOIN sessions s ON (s.key = $1)
+		WHERE f.id = $2
+		AND f.deleted_at IS NULL
+		AND EXISTS (SELECT 1 FROM feed_folders ff WHERE ff.feed_id = f.id AND ff.user_id = s.user_id)
+		FOR UPDATE OF f;`, sessionKey, feedID).Scan(&userID, &public)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return errors.New("feed not found")
+			}
+			return err
+		}
+
+		privateID = feedID
+		if public {
+			privateID, err = privateFeed(ctx, tx, userID, feedID)
+			if err != nil {
+				return err
+			}
+		}
+
+		sealed, err := db.seal(buf, privateID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+		INSERT INTO feed_credentials
+		(user_id, feed_id, sealed, key_id)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, feed_id) DO UPDATE SET sealed = EXCLUDED.sealed, key_id = EXCLUDED.key_id;`, userID, privateID, sealed, db.keys.active)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if privateID != feedID {
+		db.invalidateSession(ctx, sessionKey)
+	}
+
+	return privateID, nil
+}
+
+// privateFeed copies a feed into a private one, moving the user over to it and
+// queueing its first scrape with the config the feed was first scraped with.
+// Overlays the users transform made of the posts of the feed are dropped with
+// them
+func privateFeed(ctx context.Context, tx *sql.Tx, userID, feedID string) (string, error) {
+	var id string
+	err := tx.QueryRowContext(ctx, `
+	INSERT INTO feeds
+	(title, plugin, url, external_id, public)
+	SELECT title, plugin, url, external_id, false
+	FROM feeds
+	WHERE id = $1
+	RETURNING id;`, feedID).Scan(&id)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE feed_folders
+	SET feed_id = $3
+	WHERE user_id = $1
+	AND feed_id = $2;`, userID, feedID, id)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE feed_transforms
+	SET feed_id = $3
+	WHERE user_id = $1
+	AND feed_id = $2;`, userID, feedID, id)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	DELETE FROM post_overlays
+	WHERE user_id = $1
+	AND feed_id = $2;`, userID, feedID)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := tx.ExecContext(ctx, `
+	INSERT INTO scrapes
+	(id, feed_id, plugin, config, priority)
+	SELECT $5, $2, sc.plugin, sc.config, $4
+	FROM scrapes sc
+	WHERE sc.feed_id = $1
+	AND sc.config->>'Type' = $3
+	ORDER BY sc.created_at ASC
+	LIMIT 1;`, feedID, id, string(discollect.FullScrape), int(discollect.PriorityInteractive), hydrocarbon.NewID())
+	if err != nil {
+		return "", err
+	}
+
+	return id, expectRows(res, "feed has not been scraped yet")
+}
+
+// DeleteFeedCredentials removes the credentials the user set for a feed, which
+// stays private to them and is scraped without logging in from then on
+func (db *DB) DeleteFeedCredentials(ctx context.Context, sessionKey, feedID string) error {
+	res, err := db.sql.ExecContext(ctx, `
+	DELETE FROM feed_credentials
+	WHERE user_id = (SELECT user_id FROM sessions WHERE key = $1)
+	AND feed_id = $2;`, sessionKey, feedID)
+	if err != nil {
+		return err
+	}
+
+	return expectRows(res, "no credentials found")
+}
+
+// GetCredentials returns the credentials of the feed a scrape is of, or nil if
+// it has none. They are only used for private feeds the user that set them
+// alone follows
+func (db *DB) GetCredentials(ctx context.Context, scrapeID uuid.UUID) (*discollect.Credentials, error) {
+	var feedID string
+	var sealed []byte
+	err := db.sql.QueryRowContext(ctx, `
+	SELECT fc.feed_id, fc.sealed
+	FROM feed_credentials fc
+	JOIN scrapes s ON (s.feed_id = fc.feed_id)
+	JOIN feeds f ON (f.id = fc.feed_id)
+	WHERE s.id = $1
+	AND NOT f.public
+	AND NOT EXISTS (SELECT 1 FROM feed_folders ff WHERE ff.feed_id = fc.feed_id AND ff.user_id <> fc.user_id);`, scrapeID).Scan(&feedID, &sealed)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	buf, err := db.open(sealed, feedID)
+	if err != nil {
+		return nil, err
+	}
+
+	var c discollect.Credentials
+	err = json.Unmarshal(buf, &c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// seal encrypts buf, bound to the feed so it can't be moved to another
+func (db *DB) seal(buf []byte, feedID string) ([]byte, error) {
+	if db.keys == nil {
+		return nil, errNoCredentialKey
+	}
+
+	return db.keys.seal(buf, []byte(feedID))
+}
+
+// open decrypts the output of seal
+func (db *DB) open(sealed []byte, feedID string) ([]byte, error) {
+	if db.keys == nil {
+		return nil, errNoCredentialKey
+	}
+
+	return db.keys.open(sealed, []byte(feedID))
+}
@@ -0,0 +1,42 @@
+package pg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSealCredentials(t *testing.T) {
+	db := &DB{}
+
+	_, err := db.seal([]byte("secret"), "feed")
+	if err != errNoCredentialKey {
+		t.Fatalf("expected errNoCredentialKey without a key, got %v", err)
+	}
+
+	err = db.SetCredentialKey(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := db.seal([]byte("secret"), "feed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(sealed, []byte("secret")) {
+		t.Fatal("credentials were not encrypted")
+	}
+
+	out, err := db.open(sealed, "feed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "secret" {
+		t.Fatalf("got %q back after sealing", out)
+	}
+
+	_, err = db.open(sealed, "another-feed")
+	if err == nil {
+		t.Fatal("credentials sealed for one feed opened for another")
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,37 +21,121 @@ import (
 // A DB is responsible for all interactions with postgres
 type DB struct {
 	sql *sql.DB
+	// changes are listened for on their own connection to dsn
+	dsn     string
+	changes changeHub
+	// some reads are spread over replicas when there are any, see queryRead
+	replicas    []*replica
+	nextReplica uint32
+	// queries made on the primary and replicas are timed into queries
+	queries *queryMetrics
+
+	// posts within dedupDistance bits of the simhash of a post written in the
+	// last dedupWindow are merged into it, disabled when zero
+	dedupDistance int
+	dedupWindow   time.Duration
+
+	// every user is on the UnlimitedPlan if unlimited is set, see
+	// DisablePlans
+	unlimited bool
+
+	// sanitizer cleans the body of every post written, if set
+	sanitizer *hydrocarbon.Sanitizer
+	// images in posts written are rehosted to images, if set
+	images      discollect.FileStore
+	imageClient *http.Client
+	// bodies of at least blobMinSize bytes are kept in blobs, if set
+	blobs       BlobStore
+	blobMinSize int
+	// feed credentials, and post bodies if enabled, are sealed with keys
+	keys *keyring
+	// hot reads are cached in cache, if set
+	cache Cache
+	// statements are run in the schema of their tenant if tenants is set,
+	// see WithTenants
+	tenants bool
+	tenant  string
+
+	// post bodies are written with codec, gzip if unset. zstd is always
+	// set, so bodies written with it can be read whichever codec is in use
+	codec codec
+	zstd  *zstdCodec
 }
 
-// NewDB returns a new database
-func NewDB(dsn string, autoExplain bool) (*DB, error) {
-	db, err := sql.Open("postgres", dsn)
+// NewDB returns a new database, every query made through it is traced and
+// timed, see WriteQueryMetrics. All writes go to the primary at dsn, see
+// WithReplicas for reads. Its schema has to be migrated first, see Migrator
+func NewDB(dsn string, opts ...OptionFn) (*DB, error) {
+	o := &options{}
+	for _, opt := range opts {
+		err := opt(o)
+		if err != nil {
+			return nil, err
+		}
+	}
+	o.metrics = newQueryMetrics(o.slowQuery)
+
+	db, err := openDB(dsn, o)
 	if err != nil {
 		return nil, err
 	}
 
-	err = runMigrations(db)
+	zc, err := loadZstdCodec(context.Background(), db)
 	if err != nil {
 		return nil, err
 	}
 
-	if autoExplain {
-		_, err = db.Exec(`LOAD 'auto_explain';`)
+	// replicas are not connected to until they are first read from, one that
+	// is down or lagging is skipped in favour of the primary
+	var replicas []*replica
+	for _, rdsn := range o.replicaDSNs {
+		rdb, err := openDB(rdsn, o)
 		if err != nil {
 			return nil, err
 		}
 
-		_, err = db.Exec(`SET auto_explain.log_min_duration = 0;`)
-		if err != nil {
-			return nil, err
-		}
+		replicas = append(replicas, &replica{sql: rdb, maxLag: o.maxReplicaLag})
 	}
 
 	return &DB{
-		sql: db,
+		sql:      db,
+		dsn:      dsn,
+		replicas: replicas,
+		queries:  o.metrics,
+		zstd:     zc,
+		tenants:  o.tenants,
+		tenant:   o.tenant,
 	}, nil
 }
 
+// SetDedup enables merging of near-duplicate posts, any post whose simhash is
+// within distance bits of one written in the last window is recorded as
+// another source of the existing post instead of being saved
+func (db *DB) SetDedup(distance int, window time.Duration) {
+	db.dedupDistance = distance
+	db.dedupWindow = window
+}
+
+// DisablePlans puts every user on the UnlimitedPlan, for when billing is
+// disabled. Feeds are scraped as often as their schedule says, without
+// counting against any limit
+func (db *DB) DisablePlans() {
+	db.unlimited = true
+}
+
+// SetSanitizer cleans the body of every post written by a scrape with s before
+// it is stored
+func (db *DB) SetSanitizer(s *hydrocarbon.Sanitizer) {
+	db.sanitizer = s
+}
+
+// SetImageStore downloads the images of every post written by a scrape with c
+// and rewrites them to point at the copies stored in fs
+func (db *DB) SetImageStore(fs discollect.FileStore, c *http.Client) {
+	db.images = fs
+	db.imageClient = c
+}
+
 // CreateOrGetUser creates a new user and returns the users ID
 func (db *DB) CreateOrGetUser(ctx context.Context, email string) (string, bool, error) {
 	row := db.sql.QueryRowContext(ctx, `
@@ -69,14 +156,115 @@ func (db *DB) CreateOrGetUser(ctx context.Context, email string) (string, bool,
 	return userID, stripeSubID.Valid, nil
 }
 
-// SetStripeIDs sets a users stripe IDs
-func (db *DB) SetStripeIDs(ctx context.Context, userID, customerID, subID string) error {
+// SetStripeIDs sets a users stripe IDs, and moves them to the plan billed as
+// planID
+func (db *DB) SetStripeIDs(ctx context.Context, userID, customerID, subID, planID string) error {
 	_, err := db.sql.ExecContext(ctx, `
 	UPDATE users 
 	SET (stripe_customer_id, stripe_subscription_id) = ($1, $2)
 	WHERE id = $3;`, customerID, subID, userID)
+	if err != nil {
+		return err
+	}
 
-	return err
+	// billing webhooks only name the customer they are about
+	err = db.recordTenantKey(ctx, customerID)
+	if err != nil {
+		return err
+	}
+
+	return db.UpdateSubscription(ctx, subID, planID)
+}
+
+// UpdateSubscription moves the user with the subscription to the plan billed
+// as planID, if they are not on it already
+func (db *DB) UpdateSubscription(ctx context.Context, subscriptionID, planID string) error {
+	row := db.sql.QueryRowContext(ctx, `
+	SELECT u.id, p.name, u.plan = p.name
+	FROM users u, plans p
+	WHERE u.stripe_subscription_id = $1
+	AND p.payment_plan_id = $2;`, subscriptionID, planID)
+
+	var userID, plan string
+	var current bool
+	err := row.Scan(&userID, &plan, &current)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("no user has subscription %s, or no plan is billed as %s", subscriptionID, planID)
+		}
+		return err
+	}
+
+	if current {
+		return nil
+	}
+
+	return db.SetPlan(ctx, userID, plan)
+}
+
+// EndSubscription clears a subscription that has been ended by the payment
+// provider, moving the user back to the free plan. They drop back to read-only
+// access once their trial is over
+func (db *DB) EndSubscription(ctx context.Context, subscriptionID string) error {
+	row := db.sql.QueryRowContext(ctx, `
+	UPDATE users
+	SET stripe_subscription_id = NULL
+	WHERE stripe_subscription_id = $1
+	RETURNING id;`, subscriptionID)
+
+	var userID string
+	err := row.Scan(&userID)
+	if err != nil {
+		// already ended, the provider sends events more than once
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+
+	return db.SetPlan(ctx, userID, "free")
+}
+
+// GetBillingStatus returns the trial and subscription state of a user
+func (db *DB) GetBillingStatus(ctx context.Context, sessionKey string) (*hydrocarbon.BillingStatus, error) {
+	row := db.sql.QueryRowContext(ctx, `
+	SELECT trial_ends_at, stripe_subscription_id IS NOT NULL
+	FROM users
+	WHERE id = (SELECT user_id FROM sessions WHERE key = $1 LIMIT 1);`, sessionKey)
+
+	var bs hydrocarbon.BillingStatus
+	err := row.Scan(&bs.TrialEndsAt, &bs.Subscribed)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("invalid or inactive token")
+		}
+		return nil, err
+	}
+
+	return &bs, nil
+}
+
+// GetStripeCustomerID returns the stripe customer ID of a user
+func (db *DB) GetStripeCustomerID(ctx context.Context, sessionKey string) (string, error) {
+	row := db.sql.QueryRowContext(ctx, `
+	SELECT stripe_customer_id
+	FROM users
+	WHERE id = (SELECT user_id FROM sessions WHERE key = $1 LIMIT 1);`, sessionKey)
+
+	var customerID sql.NullString
+	err := row.Scan(&customerID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", errors.New("invalid or inactive token")
+		}
+		return "", err
+	}
+
+	if !customerID.Valid {
+		return "", errors.New("no billing account exists for this user")
+	}
+
+	return customerID.String, nil
 }
 
 // CreateLoginToken creates a new one-time-use login token
@@ -93,6 +281,11 @@ func (db *DB) CreateLoginToken(ctx context.Context, userID, userAgent, ip string
 		return "", err
 	}
 
+	err = db.recordTenantKey(ctx, token)
+	if err != nil {
+		return "", err
+	}
+
 	return token, nil
 }
 
@@ -151,6 +344,11 @@ func (db *DB) CreateSession(ctx context.Context, userID, userAgent, ip string) (
 		return "", "", err
 	}
 
+	err = db.recordTenantKey(ctx, key)
+	if err != nil {
+		return "", "", err
+	}
+
 	row = db.sql.QueryRowContext(ctx, `
 	SELECT email
 	FROM users
@@ -166,7 +364,7 @@ func (db *DB) CreateSession(ctx context.Context, userID, userAgent, ip string) (
 // ListSessions lists all sessions a user has
 func (db *DB) ListSessions(ctx context.Context, key string, page int) ([]*hydrocarbon.Session, error) {
 	rows, err := db.sql.QueryContext(ctx, `
-	SELECT created_at, user_agent, ip, active
+	SELECT id, created_at, user_agent, ip, active, api_calls, last_used_at
 	FROM sessions
 	WHERE user_id = (SELECT user_id FROM sessions WHERE key = $1)
 	LIMIT 25
@@ -179,10 +377,15 @@ func (db *DB) ListSessions(ctx context.Context, key string, page int) ([]*hydroc
 	var out []*hydrocarbon.Session
 	for rows.Next() {
 		var s hydrocarbon.Session
-		err = rows.Scan(&s.CreatedAt, &s.UserAgent, &s.IP, &s.Active)
+		var lastUsed pq.NullTime
+		err = rows.Scan(&s.ID, &s.CreatedAt, &s.UserAgent, &s.IP, &s.Active, &s.APICalls, &lastUsed)
 		if err != nil {
 			return nil, err
 		}
+
+		if lastUsed.Valid {
+			s.LastUsedAt = &lastUsed.Time
+		}
 		out = append(out, &s)
 	}
 
@@ -206,7 +409,7 @@ func (db *DB) DeactivateSession(ctx context.Context, key string) error {
 
 // AddFeed adds the given URL to the users default folder
 // and links it across feed_folder
-func (db *DB) AddFeed(ctx context.Context, sessionKey, folderID, title, plugin, feedURL string, initialConfig *discollect.Config) (string, error) {
+func (db *DB) AddFeed(ctx context.Context, sessionKey, folderID, title, plugin, feedURL, externalID string, initialConfig *discollect.Config) (string, error) {
 	if folderID == "" {
 		// ensure we don't shadow folderID
 		var err error
@@ -216,84 +419,104 @@ func (db *DB) AddFeed(ctx context.Context, sessionKey, folderID, title, plugin,
 		}
 	}
 
-	tx, err := db.sql.BeginTx(ctx, nil)
-	if err != nil {
-		return "", err
-	}
-
-	row := tx.QueryRowContext(ctx, `
-	INSERT INTO feeds
-	(title, plugin, url)
-	VALUES ($1, $2, $3)
-	RETURNING id;`, title, plugin, feedURL)
-
 	var feedID uuid.UUID
-	err = row.Scan(&feedID)
-	if err != nil {
-		txErr := tx.Rollback()
-		if txErr != nil {
-			return "", fmt.Errorf("%s - %s", err, txErr)
+	err := db.withTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `
+		INSERT INTO feeds
+		(title, plugin, url, external_id)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+		RETURNING id;`, title, plugin, feedURL, externalID).Scan(&feedID)
+		if err != nil {
+			return err
 		}
-		return "", err
-	}
 
-	_, err = tx.ExecContext(ctx, `
-	INSERT INTO feed_folders
-	(user_id, folder_id, feed_id)
-	VALUES
-	((SELECT user_id FROM sessions WHERE key = $1), $2, $3);`, sessionKey, folderID, feedID)
-	if err != nil {
-		txErr := tx.Rollback()
-		if txErr != nil {
-			return "", fmt.Errorf("%s - %s", err, txErr)
+		_, err = tx.ExecContext(ctx, `
+		INSERT INTO feed_folders
+		(user_id, folder_id, feed_id)
+		VALUES
+		((SELECT user_id FROM sessions WHERE key = $1), $2, $3);`, sessionKey, folderID, feedID)
+		if err != nil {
+			return err
 		}
+
+		_, err = tx.ExecContext(ctx, `
+		INSERT INTO scrapes
+		(id, feed_id, plugin, config, priority)
+		VALUES
+		($5, $1, $2, $3, $4)`, feedID, plugin, initialConfig, int(discollect.PriorityInteractive), hydrocarbon.NewID())
+		return err
+	})
+	if err != nil {
 		return "", err
 	}
 
-	_, err = tx.ExecContext(ctx, `
+	db.invalidateSession(ctx, sessionKey)
+	return feedID.String(), nil
+}
+
+// RefreshFeed queues an interactive scrape of a feed the user follows, reusing
+// the config of its latest delta scrape. A feed is only refreshed once at a
+// time
+func (db *DB) RefreshFeed(ctx context.Context, sessionKey, feedID string) error {
+	res, err := db.sql.ExecContext(ctx, `
 	INSERT INTO scrapes
-	(feed_id, plugin, config)
-	VALUES 
-	($1, $2, $3)`, feedID, plugin, initialConfig)
+	(id, feed_id, plugin, config, priority)
+	SELECT $6, sc.feed_id, sc.plugin, sc.config, $3
+	FROM scrapes sc
+	WHERE sc.feed_id = $2
+	AND EXISTS (SELECT 1 FROM feed_folders ff WHERE ff.feed_id = sc.feed_id AND ff.user_id = (SELECT user_id FROM sessions WHERE key = $1))
+	AND NOT EXISTS (SELECT 1 FROM scrapes WHERE feed_id = $2 AND priority = $3 AND state IN ('WAITING', 'RUNNING'))
+	AND sc.config->>'Type' != $5
+	ORDER BY sc.config->>'Type' = $4 DESC, sc.scheduled_start_at DESC
+	LIMIT 1;`, sessionKey, feedID, int(discollect.PriorityInteractive), string(discollect.DeltaScrape), string(discollect.BackfillScrape), hydrocarbon.NewID())
 	if err != nil {
-		txErr := tx.Rollback()
-		if txErr != nil {
-			return "", fmt.Errorf("%s - %s", err, txErr)
-		}
-		return "", err
+		return err
 	}
 
-	return feedID.String(), tx.Commit()
+	return expectRows(res, "feed not found or already refreshing")
 }
 
 // CheckIfFeedExists checks if a given feed exists in the DB already, and if it
-// does, adds it to the folder specified
-func (db *DB) CheckIfFeedExists(ctx context.Context, sessionKey, folderID, plugin, url string) (*hydrocarbon.Feed, bool, error) {
-	row := db.sql.QueryRowContext(ctx, `
-	SELECT id, title FROM feeds WHERE url = $1 and plugin = $2`, url, plugin)
-
+// does, adds it to the folder specified. Private feeds are never found
+func (db *DB) CheckIfFeedExists(ctx context.Context, sessionKey, folderID, plugin, url, externalID string) (*hydrocarbon.Feed, bool, error) {
 	var id uuid.UUID
 	var title string
-	err := row.Scan(&id, &title)
-	// if the row does not exist move on
-	if err != nil {
-		if err != sql.ErrNoRows {
-			return nil, false, err
-		}
+	var found bool
+	err := db.withTx(ctx, func(tx *sql.Tx) error {
+		var deleted bool
+		err := tx.QueryRowContext(ctx, `
+		SELECT id, title, deleted_at IS NOT NULL FROM feeds
+		WHERE plugin = $2
+		AND (url = $1 OR external_id = NULLIF($3, ''))
+		AND public
+		ORDER BY external_id IS NULL
+		LIMIT 1`, url, plugin, externalID).Scan(&id, &title, &deleted)
+		// if the row does not exist move on
 		if err == sql.ErrNoRows {
-			return nil, false, nil
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// deleted feeds are not added again under another ID, they would
+		// only be scraped into duplicates of the deleted posts
+		if deleted {
+			return errors.New("feed has been removed from this instance")
 		}
-	}
 
-	_, err = db.sql.ExecContext(ctx, `
-	INSERT INTO feed_folders
-	(user_id, folder_id, feed_id)
-	VALUES
-	((SELECT user_id FROM sessions WHERE key = $1), $2, $3);`, sessionKey, folderID, id)
-	if err != nil {
+		found = true
+		_, err = tx.ExecContext(ctx, `
+		INSERT INTO feed_folders
+		(user_id, folder_id, feed_id)
+		VALUES
+		((SELECT user_id FROM sessions WHERE key = $1), $2, $3);`, sessionKey, folderID, id)
+		return err
+	})
+	if err != nil || !found {
 		return nil, false, err
 	}
 
+	db.invalidateSession(ctx, sessionKey)
 	return &hydrocarbon.Feed{
 		ID:    id.String(),
 		Title: title,
@@ -305,6 +528,7 @@ func (db *DB) getDefaultFolderID(ctx context.Context, sessionKey string) (string
 	row := db.sql.QueryRowContext(ctx, `
 	SELECT id FROM folders 
 	WHERE name = 'default' 
+	AND deleted_at IS NULL
 	AND user_id = (SELECT user_id FROM sessions WHERE key = $1);`, sessionKey)
 
 	var fid string
@@ -348,6 +572,7 @@ func (db *DB) AddFolder(ctx context.Context, sessionKey, name string) (string, e
 		return "", err
 	}
 
+	db.invalidateSession(ctx, sessionKey)
 	return id, nil
 }
 
@@ -358,21 +583,88 @@ func (db *DB) RemoveFeed(ctx context.Context, sessionKey, folderID, feedID strin
 	WHERE user_id = (SELECT user_id FROM sessions WHERE key = $1 LIMIT 1)
 	AND folder_id = $2
 	AND feed_id = $3;`, sessionKey, folderID, feedID)
+	if err != nil {
+		return err
+	}
 
-	return err
+	db.invalidateSession(ctx, sessionKey)
+	return nil
 }
 
-// GetFolders returns all of the folders for a user - if there are none it creates a
-// default folder
+// GetPlanUsage returns the plan a user is on, the number of feeds they
+// currently follow and their scrape usage for the current billing period
+func (db *DB) GetPlanUsage(ctx context.Context, sessionKey string) (*hydrocarbon.PlanUsage, error) {
+	row := db.sql.QueryRowContext(ctx, `
+	SELECT p.name, p.max_feeds, p.max_scrapes, extract(epoch FROM p.min_scrape_interval)::bigint,
+		(SELECT count(DISTINCT feed_id) FROM feed_folders WHERE user_id = u.id),
+		date_trunc('month', now()), coalesce(su.scrapes, 0), coalesce(su.tasks, 0)
+	FROM users u
+	JOIN plans p ON (p.name = u.plan)
+	LEFT JOIN scrape_usage su ON (su.user_id = u.id AND su.period_start = date_trunc('month', now()))
+	WHERE u.id = (SELECT user_id FROM sessions WHERE key = $1 LIMIT 1);`, sessionKey)
+
+	var p hydrocarbon.Plan
+	var pu hydrocarbon.PlanUsage
+	var intervalSeconds int64
+	err := row.Scan(&p.Name, &p.MaxFeeds, &p.MaxScrapes, &intervalSeconds, &pu.Feeds,
+		&pu.PeriodStart, &pu.Scrapes, &pu.Tasks)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("invalid or inactive token")
+		}
+		return nil, err
+	}
+	p.MinScrapeInterval = time.Duration(intervalSeconds) * time.Second
+	pu.Plan = &p
+	if db.unlimited {
+		pu.Plan = &hydrocarbon.UnlimitedPlan
+	}
+
+	return &pu, nil
+}
+
+// GetFoldersWithFeeds returns all of the folders for a user, with the number of
+// posts of each feed they have not read
 func (db *DB) GetFoldersWithFeeds(ctx context.Context, sessionKey string) ([]*hydrocarbon.Folder, error) {
-	rows, err := db.sql.QueryContext(ctx, `
+	var folders []*hydrocarbon.Folder
+	key := db.cacheKey(ctx, sessionKey, "folders")
+	if db.cacheGet(ctx, key, &folders) {
+		return folders, nil
+	}
+
+	// a replica may not have the write that invalidated the cache yet, so
+	// what is cached is read from the primary
+	query := db.queryRead
+	if key != "" {
+		query = db.sql.QueryContext
+	}
+
+	folders, err := db.getFoldersWithFeeds(ctx, query, sessionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	db.cacheSet(ctx, key, folders)
+	return folders, nil
+}
+
+func (db *DB) getFoldersWithFeeds(ctx context.Context, query func(context.Context, string, ...interface{}) (*sql.Rows, error), sessionKey string) ([]*hydrocarbon.Folder, error) {
+	rows, err := query(ctx, `
 	SELECT fo.name as folder_name, fo.id as folder_id, jsonb_agg(
-		json_build_object('id', f.id, 'title', f.title)
+		json_build_object('id', f.id, 'title', f.title, 'status', f.status, 'unread', (
+			SELECT count(*)
+			FROM posts po
+			WHERE (po.feed_id = f.id OR po.id IN (SELECT post_id FROM post_sources WHERE feed_id = f.id))
+			AND po.deleted_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM read_statuses WHERE post_id = po.id AND user_id = fo.user_id)
+		))
 	) as feeds
 	FROM folders fo
-	LEFT JOIN feed_folders ff ON (fo.user_id = ff.user_id AND fo.id = ff.folder_id)
+	LEFT JOIN feed_folders ff ON (fo.user_id = ff.user_id AND fo.id = ff.folder_id
+		AND NOT EXISTS (SELECT 1 FROM feeds WHERE id = ff.feed_id AND deleted_at IS NOT NULL))
 	LEFT JOIN feeds f ON (ff.feed_id = f.id)
 	WHERE fo.user_id = (SELECT user_id FROM sessions WHERE key = $1 LIMIT 1) 
+	AND fo.deleted_at IS NULL
 	GROUP BY fo.name, fo.id
 	ORDER BY fo.name DESC;`, sessionKey)
 	if err != nil {
@@ -413,10 +705,15 @@ func (db *DB) GetFoldersWithFeeds(ctx context.Context, sessionKey string) ([]*hy
 
 // GetFeedPosts returns a single feed
 func (db *DB) GetFeedPosts(ctx context.Context, sessionKey, feedID string, limit, offset int) (*hydrocarbon.Feed, error) {
-	rows, err := db.sql.QueryContext(ctx, `
-	SELECT po.id, po.title, po.author, po.url, po.posted_at, (EXISTS(SELECT 1 FROM read_statuses WHERE post_id = po.id AND user_id = (SELECT user_id FROM sessions WHERE key = $1)))
+	rows, err := db.queryRead(ctx, `
+	SELECT po.id, COALESCE(pov.title, po.title), COALESCE(pov.author, po.author), po.url, po.posted_at, pov.tags,
+		(EXISTS(SELECT 1 FROM read_statuses WHERE post_id = po.id AND user_id = (SELECT user_id FROM sessions WHERE key = $1))),
+		(EXISTS(SELECT 1 FROM post_stars WHERE post_id = po.id AND user_id = (SELECT user_id FROM sessions WHERE key = $1)))
 	FROM posts po
-	WHERE po.feed_id = $2
+	LEFT JOIN post_overlays pov ON (pov.post_id = po.id AND pov.user_id = (SELECT user_id FROM sessions WHERE key = $1))
+	WHERE (po.feed_id = $2 OR po.id IN (SELECT post_id FROM post_sources WHERE feed_id = $2))
+	AND po.deleted_at IS NULL
+	AND NOT EXISTS (SELECT 1 FROM feeds WHERE id = $2 AND deleted_at IS NOT NULL)
 	AND EXISTS (SELECT 1 FROM sessions WHERE key = $1)
 	ORDER BY po.posted_at DESC
 	LIMIT $3 OFFSET $4`, sessionKey, feedID, limit, offset)
@@ -433,9 +730,10 @@ func (db *DB) GetFeedPosts(ctx context.Context, sessionKey, feedID string, limit
 	for rows.Next() {
 		var id, title, author, url string
 		var postedAt time.Time
-		var read bool
+		var tags []string
+		var read, starred bool
 
-		err := rows.Scan(&id, &title, &author, &url, &postedAt, &read)
+		err := rows.Scan(&id, &title, &author, &url, &postedAt, pq.Array(&tags), &read, &starred)
 		if err != nil {
 			return nil, err
 		}
@@ -446,7 +744,9 @@ func (db *DB) GetFeedPosts(ctx context.Context, sessionKey, feedID string, limit
 			Author:      author,
 			OriginalURL: url,
 			PostedAt:    postedAt,
+			Tags:        tags,
 			Read:        read,
+			Starred:     starred,
 		})
 	}
 
@@ -458,23 +758,54 @@ func (db *DB) GetFeedPosts(ctx context.Context, sessionKey, feedID string, limit
 	return feed, nil
 }
 
+// GetPost returns a post as the user sees it, with the output of their
+// transform
 func (db *DB) GetPost(ctx context.Context, sessionKey, postID string) (*hydrocarbon.Post, error) {
+	var p *hydrocarbon.Post
+	key := db.cacheKey(ctx, sessionKey, "post:"+postID)
+	if db.cacheGet(ctx, key, &p) {
+		return p, nil
+	}
+
+	p, err := db.getPost(ctx, sessionKey, postID)
+	if err != nil {
+		return nil, err
+	}
+
+	db.cacheSet(ctx, key, p)
+	return p, nil
+}
+
+func (db *DB) getPost(ctx context.Context, sessionKey, postID string) (*hydrocarbon.Post, error) {
 	row := db.sql.QueryRowContext(ctx, `
-	SELECT po.id, po.title, po.body, po.author, po.url, po.posted_at, (EXISTS(SELECT 1 FROM read_statuses WHERE post_id = po.id AND user_id = (SELECT user_id FROM sessions WHERE key = $1)))
-	FROM posts po WHERE id = $2
+	SELECT po.id, COALESCE(pov.title, po.title), COALESCE(pov.body, pb.body, po.body), COALESCE(pov.author, po.author), po.url, po.posted_at, po.license, po.attribution, po.backfilled, pov.tags,
+		(EXISTS(SELECT 1 FROM read_statuses WHERE post_id = po.id AND user_id = (SELECT user_id FROM sessions WHERE key = $1))),
+		(EXISTS(SELECT 1 FROM post_stars WHERE post_id = po.id AND user_id = (SELECT user_id FROM sessions WHERE key = $1)))
+	FROM posts po
+	LEFT JOIN post_bodies pb ON (pb.hash = po.body_hash)
+	LEFT JOIN post_overlays pov ON (pov.post_id = po.id AND pov.user_id = (SELECT user_id FROM sessions WHERE key = $1))
+	WHERE po.id = $2
+	AND po.deleted_at IS NULL
+	AND NOT EXISTS (SELECT 1 FROM feeds WHERE id = po.feed_id AND deleted_at IS NOT NULL)
 	AND EXISTS (SELECT id FROM sessions WHERE key = $1);`, sessionKey, postID)
 
 	var id uuid.UUID
-	var title, author, url string
+	var title, author, url, license, attribution string
 	var postedAt time.Time
-	var read bool
+	var tags []string
+	var read, starred, backfilled bool
 	var compressedBody string
-	err := row.Scan(&id, &title, &compressedBody, &author, &url, &postedAt, &read)
+	err := row.Scan(&id, &title, &compressedBody, &author, &url, &postedAt, &license, &attribution, &backfilled, pq.Array(&tags), &read, &starred)
 	if err != nil {
 		return nil, err
 	}
 
-	body, err := decompressText(compressedBody)
+	body, err := db.loadBody(ctx, compressedBody)
+	if err != nil {
+		return nil, err
+	}
+
+	sources, err := db.getPostSources(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -486,10 +817,41 @@ func (db *DB) GetPost(ctx context.Context, sessionKey, postID string) (*hydrocar
 		Body:        body,
 		Author:      author,
 		OriginalURL: url,
+		License:     license,
+		Attribution: attribution,
 		Read:        read,
+		Starred:     starred,
+		Backfilled:  backfilled,
+		Sources:     sources,
+		Tags:        tags,
 	}, nil
 }
 
+func (db *DB) getPostSources(ctx context.Context, postID uuid.UUID) ([]*hydrocarbon.PostSource, error) {
+	rows, err := db.sql.QueryContext(ctx, `
+	SELECT feed_id, url, created_at
+	FROM post_sources
+	WHERE post_id = $1
+	ORDER BY created_at ASC`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sources []*hydrocarbon.PostSource
+	for rows.Next() {
+		var ps hydrocarbon.PostSource
+		err = rows.Scan(&ps.FeedID, &ps.URL, &ps.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		sources = append(sources, &ps)
+	}
+
+	return sources, rows.Err()
+}
+
 func (db *DB) MarkRead(ctx context.Context, sessionKey, postID string) error {
 	_, err := db.sql.ExecContext(ctx, `
 	INSERT INTO read_statuses
@@ -497,7 +859,12 @@ func (db *DB) MarkRead(ctx context.Context, sessionKey, postID string) error {
 	VALUES 
 	((SELECT user_id FROM sessions WHERE key = $1), $2)
 	ON CONFLICT DO NOTHING`, sessionKey, postID)
-	return err
+	if err != nil {
+		return err
+	}
+
+	db.invalidateSession(ctx, sessionKey)
+	return nil
 }
 
 // Write saves off the post to the db
@@ -507,56 +874,216 @@ func (db *DB) Write(ctx context.Context, scrapeID uuid.UUID, f interface{}) erro
 		return errors.New("unable to write non *hydrocarbon.Post struct")
 	}
 
-	contentHash := hcp.ContentHash()
-	tx, err := db.sql.BeginTx(ctx, nil)
+	_, err := db.write(ctx, scrapeID, hcp)
+	return err
+}
+
+// a postKey is what a post is stored under, its url, content hash and external
+// ID are each unique within its scope
+type postKey struct {
+	url, contentHash, externalID, scope string
+}
+
+// keyOf returns the key hcp is stored under. Posts of private feeds, scraped
+// with the credentials of their only follower, are scoped to the feed as
+// DeliverNewsletter scopes mail, so they never write over the posts of the feed
+// everyone else follows
+func keyOf(hcp *hydrocarbon.Post, scope string) postKey {
+	return postKey{
+		url:         hcp.OriginalURL,
+		contentHash: hcp.ContentHash(),
+		externalID:  hcp.ExternalID,
+		scope:       scope,
+	}
+}
+
+// postScope returns the ID of the feed a scrape is of if the feed is private,
+// and an empty string if anyone can follow it
+func (db *DB) postScope(ctx context.Context, scrapeID uuid.UUID) (string, error) {
+	var scope string
+	err := db.sql.QueryRowContext(ctx, `
+	SELECT CASE WHEN f.public THEN '' ELSE f.id::text END
+	FROM scrapes s
+	JOIN feeds f ON (f.id = s.feed_id)
+	WHERE s.id = $1;`, scrapeID).Scan(&scope)
+	return scope, err
+}
+
+// write saves off the post, returning whether it was inserted rather than
+// already stored, updated in place or merged into a near-duplicate
+func (db *DB) write(ctx context.Context, scrapeID uuid.UUID, hcp *hydrocarbon.Post) (bool, error) {
+	if db.sanitizer != nil {
+		var plugin string
+		err := db.sql.QueryRowContext(ctx, `SELECT plugin FROM scrapes WHERE id = $1`, scrapeID).Scan(&plugin)
+		if err != nil {
+			return false, err
+		}
+
+		hcp.Body = db.sanitizer.Sanitize(plugin, hcp.Body)
+	}
+
+	scope, err := db.postScope(ctx, scrapeID)
 	if err != nil {
-		return nil
+		return false, err
 	}
 
-	rollback := true
-	// defer rollback if we throw an error
-	defer func() {
-		if rollback {
-			rollbackErr := tx.Rollback()
-			if rollbackErr != nil {
-				err = fmt.Errorf("err: %s, rollbackErr: %s", err, rollbackErr)
-			}
+	// hashed before rehosting, so unchanged posts still match
+	key := keyOf(hcp, scope)
+
+	// most posts of a recurring scrape are already stored as they are, so
+	// they are skipped before any images are fetched or rows rewritten, as
+	// are those pruned by the retention policy
+	var unchanged bool
+	err = db.sql.QueryRowContext(ctx, `
+	SELECT EXISTS (SELECT 1 FROM posts WHERE url = $1 AND content_hash = $2 AND scope = $3)
+		OR EXISTS (SELECT 1 FROM pruned_posts WHERE url = $1 AND scope = $3);`,
+		key.url, key.contentHash, key.scope).Scan(&unchanged)
+	if err != nil {
+		return false, err
+	}
+
+	if unchanged {
+		return false, nil
+	}
+
+	if db.images != nil {
+		body, err := discollect.RehostImages(ctx, hcp.Body, hcp.OriginalURL, db.imageClient, db.images)
+		if err != nil {
+			return false, err
 		}
-	}()
+		hcp.Body = body
+	}
 
-	var validHash string
-	err = tx.QueryRowContext(ctx, `
-		SELECT content_hash FROM posts WHERE content_hash = $1`, contentHash).Scan(&validHash)
+	body, err := db.prepareBody(ctx, hcp.Body)
 	if err != nil {
-		if err != sql.ErrNoRows {
+		return false, err
+	}
+	searchBody := db.searchBody(hcp.Body)
+
+	// postID is left empty when nothing was written, or only another source
+	// of a near-duplicate, and feedID when nothing was written at all
+	var postID, feedID string
+	var inserted bool
+	err = db.withTx(ctx, func(tx *sql.Tx) error {
+		err := db.insertBody(ctx, tx, body)
+		if err != nil {
+			return err
+		}
+
+		// posts with an external ID are updated in place, even if their url
+		// has changed
+		if key.externalID != "" {
+			err = tx.QueryRowContext(ctx, `
+			UPDATE posts
+			SET (title, author, body, body_hash, url, content_hash, license, attribution, search_body) = ($3, $4, '', $5, $6, $7, $8, $9, $10)
+			WHERE external_id = (SELECT plugin FROM scrapes WHERE id = $1) || ':' || $2
+			AND scope = $11
+			RETURNING id, feed_id;`,
+				scrapeID, key.externalID, hcp.Title, hcp.Author, body.hash, key.url, key.contentHash, hcp.License, hcp.Attribution, searchBody, key.scope).Scan(&postID, &feedID)
+			if err != sql.ErrNoRows {
+				return err
+			}
+		}
+
+		var validHash string
+		err = tx.QueryRowContext(ctx, `
+		SELECT content_hash FROM posts WHERE content_hash = $1 AND scope = $2`, key.contentHash, key.scope).Scan(&validHash)
+		if err != nil && err != sql.ErrNoRows {
 			return err
 		}
+
+		// do no work
+		if validHash != "" {
+			return nil
+		}
+
+		simHash := int64(hcp.SimHash())
+		// posts of private feeds are never merged into those of others
+		if db.dedupDistance > 0 && scope == "" {
+			dupID, err := findNearDuplicate(ctx, tx, key.url, simHash, db.dedupDistance, db.dedupWindow)
+			if err != nil {
+				return err
+			}
+
+			if dupID != "" {
+				err = tx.QueryRowContext(ctx, `
+				INSERT INTO post_sources
+				(post_id, feed_id, url)
+				VALUES
+				($1, (SELECT feed_id FROM scrapes WHERE id = $2), $3)
+				ON CONFLICT DO NOTHING
+				RETURNING feed_id;`, dupID, scrapeID, key.url).Scan(&feedID)
+				if err == sql.ErrNoRows {
+					return nil
+				}
+				return err
+			}
+		}
+
+		return tx.QueryRowContext(ctx, `
+		INSERT INTO posts
+		(id, feed_id, content_hash, title, author, body, body_hash, url, posted_at, license, attribution, simhash, external_id, search_body, scope)
+		VALUES
+		($13, (SELECT feed_id FROM scrapes WHERE id = $1), $2, $3, $4, '', $5, $6, $7, $8, $9, $10,
+			(SELECT plugin FROM scrapes WHERE id = $1) || ':' || NULLIF($11, ''), $12, $14)
+		ON CONFLICT (url, scope) DO UPDATE SET title = EXCLUDED.title, author = EXCLUDED.author, body = EXCLUDED.body, body_hash = EXCLUDED.body_hash, content_hash = EXCLUDED.content_hash,
+			license = EXCLUDED.license, attribution = EXCLUDED.attribution, simhash = EXCLUDED.simhash,
+			external_id = coalesce(EXCLUDED.external_id, posts.external_id),
+			-- the insert trigger has already cleared EXCLUDED.search_body
+			search_body = $12
+		-- xmax is only 0 in rows that were inserted rather than updated
+		RETURNING id, feed_id, xmax = 0;`,
+			scrapeID, key.contentHash, hcp.Title, hcp.Author, body.hash, key.url, hcp.PostedAt, hcp.License, hcp.Attribution, simHash, key.externalID, searchBody, hydrocarbon.NewID(), key.scope).Scan(&postID, &feedID, &inserted)
+	})
+	if err != nil {
+		return false, err
 	}
 
-	// do no work
-	if validHash != "" {
-		return nil
+	if postID != "" {
+		db.transform(ctx, postID, feedID, hcp)
 	}
 
-	body, err := compressText(hcp.Body)
-	if err != nil {
-		return err
+	if feedID != "" {
+		db.invalidateFeeds(ctx, feedID)
 	}
 
-	_, err = tx.ExecContext(ctx, `
-		INSERT INTO posts 
-		(feed_id, content_hash, title, author, body, url, posted_at)
-		VALUES 
-		((SELECT feed_id FROM scrapes WHERE id = $1), $2, $3, $4, $5, $6, $7)
-		ON CONFLICT (url) DO UPDATE SET title = EXCLUDED.title, author = EXCLUDED.author, body = EXCLUDED.body, content_hash = EXCLUDED.content_hash;`,
-		scrapeID, hcp.ContentHash(), hcp.Title, hcp.Author, body, hcp.OriginalURL, hcp.PostedAt)
+	return inserted, nil
+}
+
+// findNearDuplicate returns the ID of a post of a public feed created within
+// window whose simhash differs from simHash by at most distance bits. Posts at
+// the same url are never duplicates, edits to them are written in place
+func findNearDuplicate(ctx context.Context, tx *sql.Tx, url string, simHash int64, distance int, window time.Duration) (string, error) {
+	var id string
+	err := tx.QueryRowContext(ctx, `
+	SELECT id FROM posts
+	WHERE created_at > now() - $1 * interval '1 second'
+	AND simhash IS NOT NULL
+	AND url <> $2
+	AND length(replace((simhash # $3)::bit(64)::text, '0', '')) <= $4
+	AND scope = ''
+	AND NOT EXISTS (SELECT 1 FROM posts WHERE url = $2 AND scope = '')
+	ORDER BY created_at ASC
+	LIMIT 1;`, window.Seconds(), url, simHash, distance).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	return id, err
+}
+
+// expectRows returns an error with the given message if res affected no rows
+func expectRows(res sql.Result, msg string) error {
+	n, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
 
-	rollback = false
-	err = tx.Commit()
-	return err
+	if n == 0 {
+		return errors.New(msg)
+	}
+
+	return nil
 }
 
 // Close implements io.Closer for pg.DB
@@ -567,80 +1094,116 @@ func (db *DB) Close() error {
 // StartScrapes selects a subset of scrapes that should currently be running, but
 // are not yet.
 func (db *DB) StartScrapes(ctx context.Context, limit int) (ss []*discollect.Scrape, err error) {
-	tx, err := db.sql.BeginTx(ctx, nil)
-	if err != nil {
-		return nil, err
-	}
-	rollback := true
-	// defer rollback if we throw an error
-	defer func() {
-		if rollback {
-			rollbackErr := tx.Rollback()
-			if rollbackErr != nil {
-				err = fmt.Errorf("err: %s, rollbackErr: %s", err, rollbackErr)
-			}
+	err = db.withTx(ctx, func(tx *sql.Tx) error {
+		// FOR UPDATE SKIP LOCKED allows us to reduce contention against
+		// any other instance running this same query at the same time.
+		// only start scrapes for feeds that at least one follower has
+		// remaining scrape quota for, unless plans are disabled
+		rows, err := tx.QueryContext(ctx, `
+		SELECT sc.id
+		FROM scrapes sc
+		WHERE sc.scheduled_start_at <= now()
+		AND sc.state = 'WAITING'
+		AND cardinality(sc.errors) < $3
+		AND NOT EXISTS (SELECT 1 FROM feeds WHERE id = sc.feed_id AND deleted_at IS NOT NULL)
+		AND ($2 OR EXISTS (
+			SELECT 1 FROM feed_folders ff
+			JOIN users u ON (u.id = ff.user_id)
+			JOIN plans p ON (p.name = u.plan)
+			LEFT JOIN scrape_usage su ON (su.user_id = u.id AND su.period_start = date_trunc('month', now()))
+			WHERE ff.feed_id = sc.feed_id
+			AND coalesce(su.scrapes, 0) < p.max_scrapes
+		))
+		ORDER BY sc.priority DESC, sc.scheduled_start_at ASC
+		LIMIT $1
+		FOR UPDATE OF sc SKIP LOCKED;`, limit, db.unlimited, maxScrapeErrors)
+		if err != nil {
+			return err
 		}
-	}()
+		defer rows.Close()
 
-	// FOR UPDATE SKIP LOCKED allows us to reduce contention against
-	// any other instance running this same query at the same time.
-	rows, err := tx.QueryContext(ctx, `
-	SELECT id 
-	FROM scrapes
-	WHERE scheduled_start_at <= now()
-	AND state = 'WAITING'
-	AND cardinality(errors) < 3
-	LIMIT $1
-	FOR UPDATE SKIP LOCKED;`, limit)
-	if err != nil {
-		return nil, err
-	}
+		var ids []uuid.UUID
+		for rows.Next() {
+			var id uuid.UUID
+			err = rows.Scan(&id)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
 
-	var ids []uuid.UUID
-	for rows.Next() {
-		var id uuid.UUID
-		err = rows.Scan(&id)
+		err = rows.Err()
 		if err != nil {
-			return nil, err
+			return err
 		}
-		ids = append(ids, id)
-	}
 
-	err = rows.Err()
-	if err != nil {
-		return nil, err
-	}
+		// return an empty array
+		if len(ids) == 0 {
+			return nil
+		}
 
-	// return an empty array
-	if len(ids) == 0 {
-		return ss, nil
-	}
+		started, err := tx.QueryContext(ctx, `
+		UPDATE scrapes
+		SET state = 'RUNNING', started_at = now()
+		WHERE id = ANY($1)
+		RETURNING id, feed_id, plugin, config, priority;`, pq.Array(ids))
+		if err != nil {
+			return err
+		}
+		defer started.Close()
 
-	rows, err = tx.QueryContext(ctx, `
-	UPDATE scrapes 
-	SET state = 'RUNNING', started_at = now() 
-	WHERE id = ANY($1)
-	RETURNING id, feed_id, plugin, config;`, pq.Array(ids))
-	if err != nil {
-		return nil, err
-	}
+		byID := make(map[uuid.UUID]*discollect.Scrape)
+		for started.Next() {
+			var s discollect.Scrape
+			err = started.Scan(&s.ID, &s.FeedID, &s.Plugin, &s.Config, &s.Priority)
+			if err != nil {
+				return err
+			}
+			ss = append(ss, &s)
+			byID[s.ID] = &s
+		}
 
-	for rows.Next() {
-		var s discollect.Scrape
-		err = rows.Scan(&s.ID, &s.FeedID, &s.Plugin, &s.Config)
+		err = started.Err()
 		if err != nil {
-			return nil, err
+			return err
 		}
-		ss = append(ss, &s)
-	}
 
-	err = rows.Err()
-	if err != nil {
-		return nil, err
-	}
+		// scrapes requeued by a node that shut down pick up their saved tasks
+		paused, err := tx.QueryContext(ctx, `
+		DELETE FROM paused_tasks
+		WHERE scrape_id = ANY($1)
+		RETURNING scrape_id, tasks, status;`, pq.Array(ids))
+		if err != nil {
+			return err
+		}
+		defer paused.Close()
+
+		for paused.Next() {
+			var id uuid.UUID
+			var tasksJSON, statusJSON []byte
+			err = paused.Scan(&id, &tasksJSON, &statusJSON)
+			if err != nil {
+				return err
+			}
+
+			s, ok := byID[id]
+			if !ok {
+				continue
+			}
 
-	rollback = false
-	err = tx.Commit()
+			err = json.Unmarshal(tasksJSON, &s.RequeuedTasks)
+			if err != nil {
+				return err
+			}
+
+			err = json.Unmarshal(statusJSON, &s.RequeuedStatus)
+			if err != nil {
+				return err
+			}
+		}
+
+		return paused.Err()
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -649,12 +1212,13 @@ func (db *DB) StartScrapes(ctx context.Context, limit int) (ss []*discollect.Scr
 }
 
 // ListScrapes is used to list and filter scrapes, for both session resumption
-// and UI purposes
+// and UI purposes. It reads from the primary, as scrapes a replica has not seen
+// start yet would not be handed back by a node shutting down
 func (db *DB) ListScrapes(ctx context.Context, stateFilter string, limit, offset int) ([]*discollect.Scrape, error) {
 	rows, err := db.sql.QueryContext(ctx, `
 	SELECT id, feed_id, plugin, config, created_at, scheduled_start_at, 
 		started_at, ended_at, state, errors, 
-		total_datums, total_retries, total_tasks
+		total_datums, total_retries, total_tasks, total_timeouts, priority, last_failed_url, circuit_opens
 	FROM scrapes
 	WHERE state = $1::scrape_state LIMIT $2 OFFSET $3`, stateFilter, limit, offset)
 	if err != nil {
@@ -667,7 +1231,7 @@ func (db *DB) ListScrapes(ctx context.Context, stateFilter string, limit, offset
 		err := rows.Scan(&rs.ID, &rs.FeedID, &rs.Plugin, &rs.Config, &rs.CreatedAt,
 			&rs.ScheduledStartAt, &rs.StartedAt, &rs.EndedAt,
 			&rs.State, pq.Array(&rs.Errors),
-			&rs.TotalDatums, &rs.TotalRetries, &rs.TotalTasks)
+			&rs.TotalDatums, &rs.TotalRetries, &rs.TotalTasks, &rs.TotalTimeouts, &rs.Priority, &rs.LastFailedURL, pq.Array(&rs.CircuitOpens))
 		if err != nil {
 			return nil, err
 		}
@@ -689,12 +1253,24 @@ func (db *DB) FindMissingSchedules(ctx context.Context, limit int) ([]*discollec
 	SELECT f.id, max(f.plugin), jsonb_agg(
 		row_to_json(sc.*) ORDER BY scheduled_start_at DESC
 	) as scrapes, jsonb_agg(
-		row_to_json(ps.*) ORDER BY ps.created_at DESC
-	) FILTER (WHERE ps.id IS NOT NULL) as posts
+		-- the newest post is what delta scrapes continue from
+		row_to_json(ps.*) ORDER BY ps.posted_at DESC
+	) FILTER (WHERE ps.id IS NOT NULL) as posts, (
+		SELECT coalesce(extract(epoch FROM min(p.min_scrape_interval)), 0)::bigint
+		FROM feed_folders ff
+		JOIN users u ON (u.id = ff.user_id)
+		JOIN plans p ON (p.name = u.plan)
+		WHERE ff.feed_id = f.id
+	) as min_interval, f.schedule
 	FROM feeds f
-	JOIN LATERAL (SELECT * FROM scrapes WHERE feed_id = f.id ORDER BY scrapes.scheduled_start_at DESC LIMIT 10) sc ON true
+	JOIN LATERAL (
+		-- backfills are one-off, schedulers never continue from them
+		SELECT * FROM scrapes WHERE feed_id = f.id AND config->>'Type' != 'backfill_scrape'
+		ORDER BY scrapes.scheduled_start_at DESC LIMIT 10
+	) sc ON true
 	LEFT JOIN LATERAL (SELECT * FROM posts WHERE feed_id = f.id ORDER BY posts.posted_at DESC LIMIT 10) ps ON true
-	WHERE NOT EXISTS (
+	WHERE f.deleted_at IS NULL
+	AND NOT EXISTS (
 		SELECT 1 FROM scrapes 
 		WHERE feed_id = f.id
 		AND state = 'WAITING'
@@ -712,8 +1288,10 @@ func (db *DB) FindMissingSchedules(ctx context.Context, limit int) ([]*discollec
 		var plugin string
 		var scrapesJSON []byte
 		var postsJSON []byte
+		var minIntervalSeconds int64
+		var scheduleJSON []byte
 
-		err := rows.Scan(&feedID, &plugin, &scrapesJSON, &postsJSON)
+		err := rows.Scan(&feedID, &plugin, &scrapesJSON, &postsJSON, &minIntervalSeconds, &scheduleJSON)
 		if err != nil {
 			return nil, err
 		}
@@ -734,11 +1312,38 @@ func (db *DB) FindMissingSchedules(ctx context.Context, limit int) ([]*discollec
 			}
 		}
 
+		var schedule *discollect.ScheduleSpec
+		if len(scheduleJSON) > 0 {
+			err = json.Unmarshal(scheduleJSON, &schedule)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// posts are ordered newest first
+		var latestPostAt time.Time
+		if len(latestPosts) > 0 {
+			latestPostAt = latestPosts[0].PostedAt
+		}
+
+		postTimes := make([]time.Time, 0, len(latestPosts))
+		for _, p := range latestPosts {
+			postTimes = append(postTimes, p.PostedAt)
+		}
+
+		if db.unlimited {
+			minIntervalSeconds = 0
+		}
+
 		sr = append(sr, &discollect.ScheduleRequest{
 			FeedID:        feedID,
 			Plugin:        plugin,
 			LatestScrapes: latestScrapes,
 			LatestDatums:  latestPosts,
+			LatestPostAt:  latestPostAt,
+			PostTimes:     postTimes,
+			MinInterval:   time.Duration(minIntervalSeconds) * time.Second,
+			Schedule:      schedule,
 		})
 	}
 
@@ -750,46 +1355,139 @@ func (db *DB) FindMissingSchedules(ctx context.Context, limit int) ([]*discollec
 	return sr, nil
 }
 
-// InsertSchedule inserts all the schedules
+// scrapes of the same plugin and config scheduled closer together than this
+// are the same scrape, whatever their exact start times
+const scheduleDedupWindow = 2 * time.Minute
+
+// InsertSchedule inserts all the schedules, skipping any identical to a scrape
+// already scheduled within scheduleDedupWindow of it
 func (db *DB) InsertSchedule(ctx context.Context, sr *discollect.ScheduleRequest, ss []*discollect.ScrapeSchedule) error {
-	for _, s := range ss {
-		_, err := db.sql.ExecContext(ctx, `
-		INSERT INTO scrapes
-		(feed_id, plugin, config, scheduled_start_at)
-		VALUES 
-		($1, $2, $3, $4)
-		ON CONFLICT ON CONSTRAINT scrapes_plugin_scheduled_start_at_config_key DO NOTHING;`, sr.FeedID, sr.Plugin, s.Config, s.ScheduledStartAt)
+	return db.withTx(ctx, func(tx *sql.Tx) error {
+		for _, s := range ss {
+			// schedulers on other nodes may be inserting the same scrape, so
+			// the check and insert are serialized per plugin and config
+			_, err := tx.ExecContext(ctx, `
+			SELECT pg_advisory_xact_lock(hashtext($1 || md5($2::jsonb::text)));`, sr.Plugin, s.Config)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, `
+			INSERT INTO scrapes
+			(id, feed_id, plugin, config, scheduled_start_at, priority)
+			SELECT $7, $1, $2, $3, $4, $5
+			WHERE NOT EXISTS (
+				SELECT 1 FROM scrapes
+				WHERE plugin = $2
+				AND config_hash = md5($3::jsonb::text)
+				AND scheduled_start_at > $4::timestamptz - $6 * interval '1 second'
+				AND scheduled_start_at < $4::timestamptz + $6 * interval '1 second'
+			)
+			ON CONFLICT ON CONSTRAINT scrapes_plugin_scheduled_start_at_config_key DO NOTHING;`, sr.FeedID, sr.Plugin, s.Config, s.ScheduledStartAt, int(s.Config.Priority()), scheduleDedupWindow.Seconds(), hydrocarbon.NewID())
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// EndScrape marks a scrape as SUCCESS, records the number of datums and
+// tasks returned and meters the scrape against every user following the feed
+func (db *DB) EndScrape(ctx context.Context, id uuid.UUID, datums, retries, tasks int) error {
+	return db.withTx(ctx, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(ctx, `
+		UPDATE scrapes
+		SET state = 'SUCCESS'::scrape_state, ended_at = now(), total_datums = $1, total_retries = $2, total_tasks = $3
+		WHERE id = $4
+		RETURNING state`, datums, retries, tasks, id)
+
+		var state string
+		err := row.Scan(&state)
 		if err != nil {
 			return err
 		}
-	}
 
-	return nil
+		if state != "SUCCESS" {
+			return errors.New("could not end scrape")
+		}
+
+		_, err = tx.ExecContext(ctx, `
+		INSERT INTO scrape_usage
+		(user_id, period_start, scrapes, tasks)
+		SELECT DISTINCT ff.user_id, date_trunc('month', now()), 1, $2::int
+		FROM feed_folders ff
+		WHERE ff.feed_id = (SELECT feed_id FROM scrapes WHERE id = $1)
+		ON CONFLICT (user_id, period_start)
+		DO UPDATE SET scrapes = scrape_usage.scrapes + 1, tasks = scrape_usage.tasks + EXCLUDED.tasks;`, id, tasks)
+		return err
+	})
 }
 
-// EndScrape marks a scrape as SUCCESS and records the number of datums and
-// tasks returned
-func (db *DB) EndScrape(ctx context.Context, id uuid.UUID, datums, retries, tasks int) error {
-	row := db.sql.QueryRowContext(ctx, `
+// maxScrapeErrors is the number of times a scrape may fail before it is moved
+// to DEAD, StartScrapes never picks up scrapes with more errors than this
+const maxScrapeErrors = 3
+
+// RecordTimeout counts a task of the scrape that ran past its deadline
+func (db *DB) RecordTimeout(ctx context.Context, id uuid.UUID) error {
+	_, err := db.sql.ExecContext(ctx, `
 	UPDATE scrapes
-	SET state = 'SUCCESS'::scrape_state, ended_at = now(), total_datums = $1, total_retries = $2, total_tasks = $3
-	WHERE id = $4
-	RETURNING state`, datums, retries, tasks, id)
+	SET total_timeouts = total_timeouts + 1
+	WHERE id = $1;`, id)
+	return err
+}
 
-	var state string
-	err := row.Scan(&state)
+// RecordCircuitOpen notes that tasks of the scrape were held back as host
+// looked to be down
+func (db *DB) RecordCircuitOpen(ctx context.Context, id uuid.UUID, host string, until time.Time) error {
+	_, err := db.sql.ExecContext(ctx, `
+	UPDATE scrapes
+	SET circuit_opens = array_append(circuit_opens, $2)
+	WHERE id = $1;`, id, host+" until "+until.UTC().Format(time.RFC3339))
+	return err
+}
+
+// UpdateScrapeConfig replaces the config of a scrape, after it was upgraded to
+// the current version of its plugin
+func (db *DB) UpdateScrapeConfig(ctx context.Context, id uuid.UUID, c *discollect.Config) error {
+	res, err := db.sql.ExecContext(ctx, `
+	UPDATE scrapes
+	SET config = $2
+	WHERE id = $1;`, id, c)
 	if err != nil {
 		return err
 	}
 
-	if state != "SUCCESS" {
-		return errors.New("could not end scrape")
+	return expectRows(res, "no scrape found")
+}
+
+// ErrorScrape adds the error to a scrape's list and either puts it back to
+// WAITING, behind an exponential backoff of 5, 25, ... minutes, or moves it to
+// DEAD once it has failed maxScrapeErrors times, where it waits for an admin
+// to requeue it
+func (db *DB) ErrorScrape(ctx context.Context, id uuid.UUID, lastFailedURL string, err error) error {
+	row := db.sql.QueryRowContext(ctx, `
+	UPDATE scrapes
+	SET errors = array_append(errors, $1),
+	state = CASE WHEN cardinality(errors) + 1 < $2
+		THEN 'WAITING'::scrape_state ELSE 'DEAD'::scrape_state END,
+	scheduled_start_at = CASE WHEN cardinality(errors) + 1 < $2
+		THEN now() + interval '5 minutes' * power(5, cardinality(errors)) ELSE scheduled_start_at END,
+	ended_at = now(),
+	last_failed_url = $3
+	WHERE id = $4
+	RETURNING state, plugin, cardinality(errors)`, err.Error(), maxScrapeErrors, lastFailedURL, id)
+
+	var state, plugin string
+	var attempts int
+	scanErr := row.Scan(&state, &plugin, &attempts)
+	if scanErr != nil {
+		return scanErr
 	}
 
-	return nil
-}
+	// l2met style, picked up as a counter by heroku log metrics
+	log.Printf("pg: count#scrape.%s=1 plugin=%s scrape_id=%s attempts=%d", strings.ToLower(state), plugin, id, attempts)
 
-// ErrorScrape marks a scrape as ERRORED and adds the error to its list
-func (db *DB) ErrorScrape(ctx context.Context, id uuid.UUID, err error) error {
 	return nil
 }
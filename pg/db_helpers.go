@@ -1,8 +1,10 @@
-//+build integration
+//go:build integration
+// +build integration
 
 package pg
 
 import (
+	"context"
 	"testing"
 
 	"github.com/fortytw2/dockertest"
@@ -12,8 +14,20 @@ func SetupTestDB(t *testing.T) (*DB, func()) {
 	var db *DB
 
 	container, err := dockertest.RunContainer("postgres:alpine", "5432", func(addr string) error {
-		var err error
-		db, err = NewDB("postgres://postgres:postgres@"+addr+"?sslmode=disable", false)
+		dsn := "postgres://postgres:postgres@" + addr + "?sslmode=disable"
+
+		m, err := NewMigrator(dsn)
+		if err != nil {
+			return err
+		}
+		defer m.Close()
+
+		_, err = m.Up(context.Background())
+		if err != nil {
+			return err
+		}
+
+		db, err = NewDB(dsn)
 		return err
 	})
 	if err != nil {
@@ -1,45 +1,300 @@
 package pg
 
 import (
+	"context"
 	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
 	"sort"
 	"strings"
+	"time"
+
+	"github.com/lib/pq"
 )
 
-//go:generate go-bindata -pkg pg -mode 0644 -modtime 499137600 -o db_migrations_generated.go schema/
+// schema holds every migration, NN_name.sql is run in order of NN and undone by
+// NN_name.down.sql, where there is one
+//
+//go:embed schema/*.sql
+var schema embed.FS
+
+// migrationLock is the advisory lock held while migrating, so nodes deployed at
+// once do not run the same migration twice
+const migrationLock = 7221
+
+// A Migration is one change to the schema
+type Migration struct {
+	Name string `json:"name"`
+	// Schema is that of the tenant the migration is run in, empty for the
+	// default schema
+	Schema string `json:"schema,omitempty"`
+	// AppliedAt is zero while the migration is pending
+	AppliedAt time.Time `json:"applied_at"`
+	// Reversible is true if the migration can be undone by Down
+	Reversible bool `json:"reversible"`
+}
+
+// A Migrator changes the schema of a database, it is kept apart from DB so the
+// schema can be managed without the rest of hydrocarbon
+type Migrator struct {
+	sql *sql.DB
+}
 
-func runMigrations(db *sql.DB) error {
-	err := verifyMigrationsTable(db)
+// NewMigrator returns a Migrator for the database at dsn, its statements are
+// not limited by any statement timeout
+func NewMigrator(dsn string) (*Migrator, error) {
+	db, err := openDB(dsn, &options{})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	count, err := countMigrations(db)
+	return &Migrator{sql: db}, nil
+}
+
+// Close closes the connections of the Migrator
+func (m *Migrator) Close() error {
+	return m.sql.Close()
+}
+
+// Status returns every migration, in the order they are run, for the default
+// schema then for that of every tenant
+func (m *Migrator) Status(ctx context.Context) ([]*Migration, error) {
+	conn, unlock, err := m.lock(ctx)
 	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	all := make([]*Migration, 0)
+	err = eachSchema(ctx, conn, func(schema string) error {
+		ms, err := status(ctx, conn)
+		for _, mi := range ms {
+			mi.Schema = schema
+		}
+
+		all = append(all, ms...)
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// assetNames returns the map keys, which are iterated in a random order
-	// and not usable without sorting here if there are more than 1 migration.
-	names := AssetNames()
-	sort.Strings(names)
+	return all, nil
+}
 
-	for i, file := range names {
-		// skip running ones we've clearly already ran
-		if count > 0 {
-			count--
+// Pending returns how many migrations are yet to be run, across every schema
+func (m *Migrator) Pending(ctx context.Context) (int, error) {
+	ms, err := m.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, mi := range ms {
+		if mi.AppliedAt.IsZero() {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// Up runs every pending migration in order, each in a transaction of its own,
+// in the default schema then that of every tenant. It returns the names of
+// those it ran, prefixed with the schema of a tenant for theirs
+func (m *Migrator) Up(ctx context.Context) ([]string, error) {
+	conn, unlock, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	ran := make([]string, 0)
+	err = eachSchema(ctx, conn, func(schema string) error {
+		names, err := up(ctx, conn, schema)
+		ran = append(ran, names...)
+		return err
+	})
+
+	return ran, err
+}
+
+// up runs every pending migration in the schema conn is using, in
+func up(ctx context.Context, conn *sql.Conn, in string) ([]string, error) {
+	ms, err := status(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	ran := make([]string, 0)
+	for _, mi := range ms {
+		if !mi.AppliedAt.IsZero() {
 			continue
 		}
 
-		migration := MustAsset(file)
+		name := qualify(in, mi.Name)
+		buf, err := schema.ReadFile("schema/" + mi.Name)
+		if err != nil {
+			return ran, err
+		}
+
+		err = runMigration(ctx, conn, string(buf), `INSERT INTO migrations (name) VALUES ($1);`, mi.Name)
+		if err != nil {
+			return ran, fmt.Errorf("pg: migration %s failed: %w", name, err)
+		}
+
+		ran = append(ran, name)
+	}
+
+	return ran, nil
+}
+
+// Down undoes the latest migration that was run and returns its name, it fails
+// if that migration cannot be undone. It is undone in the schema of every
+// tenant it is also the latest of
+func (m *Migrator) Down(ctx context.Context) (string, error) {
+	conn, unlock, err := m.lock(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	ms, err := status(ctx, conn)
+	if err != nil {
+		return "", err
+	}
+
+	latest := latestMigration(ms)
+	if latest == nil {
+		return "", errors.New("pg: no migrations have been run")
+	}
+
+	if !latest.Reversible {
+		return "", fmt.Errorf("pg: migration %s cannot be undone", latest.Name)
+	}
+
+	buf, err := schema.ReadFile("schema/" + downName(latest.Name))
+	if err != nil {
+		return "", err
+	}
+
+	err = eachSchema(ctx, conn, func(schema string) error {
+		ms, err := status(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		if l := latestMigration(ms); l == nil || l.Name != latest.Name {
+			return nil
+		}
+
+		err = runMigration(ctx, conn, string(buf), `DELETE FROM migrations WHERE name = $1;`, latest.Name)
+		if err != nil {
+			return fmt.Errorf("pg: undoing migration %s failed: %w", qualify(schema, latest.Name), err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return latest.Name, nil
+}
+
+// latestMigration returns the latest of ms that was run, nil if none were
+func latestMigration(ms []*Migration) *Migration {
+	var latest *Migration
+	for _, mi := range ms {
+		if !mi.AppliedAt.IsZero() {
+			latest = mi
+		}
+	}
+
+	return latest
+}
+
+// Force records the first n migrations as run and the rest as pending, in
+// every schema, without running any of them. It is for repairing a database
+// after a migration that failed part way was finished or undone by hand
+func (m *Migrator) Force(ctx context.Context, n int) error {
+	names, err := migrationNames()
+	if err != nil {
+		return err
+	}
+
+	if n < 0 || n > len(names) {
+		return fmt.Errorf("pg: there are %d migrations, cannot force %d", len(names), n)
+	}
+
+	conn, unlock, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return eachSchema(ctx, conn, func(string) error {
+		return runTx(ctx, conn, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, `
+			DELETE FROM migrations
+			WHERE name <> ALL($1::text[]);`, pq.Array(names[:n]))
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, `
+			INSERT INTO migrations (name)
+			SELECT unnest($1::text[])
+			ON CONFLICT (name) DO NOTHING;`, pq.Array(names[:n]))
+			return err
+		})
+	})
+}
+
+// lock returns a connection holding the migration lock, unlock releases both
+func (m *Migrator) lock(ctx context.Context) (*sql.Conn, func(), error) {
+	conn, err := m.sql.Conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1);`, migrationLock)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
 
-		err := runMigration(i, migration, db)
+	err = verifyMigrationsTable(ctx, conn)
+	if err != nil {
+		conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1);`, migrationLock)
+		conn.Close()
+		return nil, nil, err
+	}
+
+	return conn, func() {
+		conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1);`, migrationLock)
+		conn.Close()
+	}, nil
+}
+
+// eachSchema calls fn with conn using the default schema, then the schema of
+// every tenant in turn, and leaves it using the default schema
+func eachSchema(ctx context.Context, conn *sql.Conn, fn func(schema string) error) error {
+	schemas, err := tenantSchemas(ctx, conn)
+	if err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), searchPath(""))
+
+	for _, schema := range append([]string{""}, schemas...) {
+		err = useSchema(ctx, conn, schema)
 		if err != nil {
 			return err
 		}
 
-		cleanName := strings.TrimPrefix(file, "schema/")
-		err = recordMigration(cleanName, db)
+		err = fn(schema)
 		if err != nil {
 			return err
 		}
@@ -48,38 +303,119 @@ func runMigrations(db *sql.DB) error {
 	return nil
 }
 
-func verifyMigrationsTable(db *sql.DB) error {
-	_, err := db.Exec(`CREATE EXTENSION IF NOT EXISTS pgcrypto;`)
+// useSchema has conn use schema, with a migrations table of its own
+func useSchema(ctx context.Context, conn *sql.Conn, schema string) error {
+	_, err := conn.ExecContext(ctx, searchPath(schema))
 	if err != nil {
 		return err
 	}
 
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS migrations (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
-		name TEXT NOT NULL UNIQUE
-	);`)
-	return err
+	return verifyMigrationsTable(ctx, conn)
 }
 
-func countMigrations(db *sql.DB) (int, error) {
-	row := db.QueryRow(`SELECT count(*) FROM migrations;`)
+// qualify prefixes the name of a migration with the schema it is run in,
+// unless it is the default schema
+func qualify(schema, name string) string {
+	if schema == "" {
+		return name
+	}
 
-	var count int
-	err := row.Scan(&count)
+	return schema + "." + name
+}
+
+// status returns every migration embedded, with when it was run if it has been
+func status(ctx context.Context, conn *sql.Conn) ([]*Migration, error) {
+	names, err := migrationNames()
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT name, created_at FROM migrations;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[string]time.Time)
+	for rows.Next() {
+		var name string
+		var at time.Time
+		err = rows.Scan(&name, &at)
+		if err != nil {
+			return nil, err
+		}
+
+		applied[name] = at
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
 	}
 
-	return count, nil
+	ms := make([]*Migration, 0, len(names))
+	for _, name := range names {
+		_, err := fs.Stat(schema, "schema/"+downName(name))
+		ms = append(ms, &Migration{
+			Name:       name,
+			AppliedAt:  applied[name],
+			Reversible: err == nil,
+		})
+	}
+
+	return ms, nil
 }
 
-func runMigration(num int, buf []byte, db *sql.DB) error {
-	_, err := db.Exec(string(buf))
-	return err
+// migrationNames returns the names of the migrations embedded, in the order
+// they are run
+func migrationNames() ([]string, error) {
+	files, err := fs.Glob(schema, "schema/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		if strings.HasSuffix(file, ".down.sql") {
+			continue
+		}
+
+		names = append(names, strings.TrimPrefix(file, "schema/"))
+	}
+
+	sort.Strings(names)
+	return names, nil
 }
 
-func recordMigration(name string, db *sql.DB) error {
-	_, err := db.Query("INSERT INTO migrations (name) VALUES ($1);", name)
+// downName returns the name of the file that undoes the migration name
+func downName(name string) string {
+	return strings.TrimSuffix(name, ".sql") + ".down.sql"
+}
+
+// runMigration runs a migration and records it in one transaction, so a
+// migration that fails leaves nothing behind
+func runMigration(ctx context.Context, conn *sql.Conn, migration, record, name string) error {
+	return runTx(ctx, conn, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, migration)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, record, name)
+		return err
+	})
+}
+
+func verifyMigrationsTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `CREATE EXTENSION IF NOT EXISTS pgcrypto;`)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS migrations (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		name TEXT NOT NULL UNIQUE
+	);`)
 	return err
 }
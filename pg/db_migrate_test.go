@@ -3,6 +3,7 @@
 package pg
 
 import (
+	"context"
 	"testing"
 )
 
@@ -10,13 +11,126 @@ func TestMigrations(t *testing.T) {
 	db, shutdown := SetupTestDB(t)
 	defer shutdown()
 
-	count, err := countMigrations(db.sql)
+	m := &Migrator{sql: db.sql}
+
+	// ensure we run all of the migrations
+	pending, err := m.Pending(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
+	if pending != 0 {
+		t.Fatalf("migrations not successful, %d are still pending", pending)
+	}
+}
 
-	// ensure we run all of the migrations
-	if count != len(AssetNames()) {
-		t.Fatalf("migrations not successful, expected %d but only found %d", len(AssetNames()), count)
+func TestMigrateDownAndUp(t *testing.T) {
+	db, shutdown := SetupTestDB(t)
+	defer shutdown()
+
+	ctx := context.Background()
+	m := &Migrator{sql: db.sql}
+
+	names, err := migrationNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	latest := names[len(names)-1]
+	undone, err := m.Down(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if undone != latest {
+		t.Fatalf("expected %s to be undone, got %s", latest, undone)
+	}
+
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending != 1 {
+		t.Fatalf("expected 1 pending migration, got %d", pending)
+	}
+
+	ran, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 1 || ran[0] != latest {
+		t.Fatalf("expected %s to be run again, got %v", latest, ran)
+	}
+
+	err = m.Force(ctx, len(names)-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err = m.Pending(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending != 1 {
+		t.Fatalf("expected forcing to leave 1 pending migration, got %d", pending)
+	}
+}
+
+func TestTenants(t *testing.T) {
+	db, shutdown := SetupTestDB(t)
+	defer shutdown()
+
+	ctx := context.Background()
+	m := &Migrator{sql: db.sql}
+
+	err := m.CreateTenant(ctx, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending != 0 {
+		t.Fatalf("expected the tenant to be migrated, %d are pending", pending)
+	}
+
+	tdb, err := NewDB(db.dsn, WithTenants(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acme := TenantContext(ctx, "acme")
+	inTenant, _, err := tdb.CreateOrGetUser(acme, "a@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inPublic, _, err := tdb.CreateOrGetUser(ctx, "a@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inPublic == inTenant {
+		t.Fatal("expected users of a tenant not to be seen outside of it")
+	}
+
+	again, _, err := tdb.CreateOrGetUser(acme, "a@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != inTenant {
+		t.Fatalf("expected the user of the tenant to be found again, got %s and %s", inTenant, again)
+	}
+
+	err = tdb.AddTenantMember(ctx, "acme", "a@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tenant, err := tdb.TenantForEmail(ctx, "A@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tenant != "acme" {
+		t.Fatalf("expected the member to belong to acme, got %q", tenant)
 	}
 }
@@ -0,0 +1,49 @@
+package pg
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// RequeueScrape moves a DEAD scrape back to WAITING with its errors cleared,
+// so it is started again straight away
+func (db *DB) RequeueScrape(ctx context.Context, id uuid.UUID) error {
+	res, err := db.sql.ExecContext(ctx, `
+	UPDATE scrapes
+	SET state = 'WAITING', errors = '{}', last_failed_url = '', scheduled_start_at = now()
+	WHERE id = $1
+	AND state = 'DEAD';`, id)
+	if err != nil {
+		return err
+	}
+
+	return expectRows(res, "scrape not found or not dead")
+}
+
+// RequeueDeadScrapes requeues every DEAD scrape of plugin, or every DEAD
+// scrape if plugin is empty, returning their ids
+func (db *DB) RequeueDeadScrapes(ctx context.Context, plugin string) ([]uuid.UUID, error) {
+	rows, err := db.sql.QueryContext(ctx, `
+	UPDATE scrapes
+	SET state = 'WAITING', errors = '{}', last_failed_url = '', scheduled_start_at = now()
+	WHERE state = 'DEAD'
+	AND ($1 = '' OR plugin = $1)
+	RETURNING id;`, plugin)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
@@ -0,0 +1,131 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// deleted feeds, folders and posts are purged this many at a time of each,
+// each time the maintainer runs
+const purgeBatchSize = 1000
+
+// SetFolderDeleted deletes or restores a folder of the user. The feeds in a
+// deleted folder are hidden with it, but stay followed until it is purged
+func (db *DB) SetFolderDeleted(ctx context.Context, sessionKey, folderID string, deleted bool) error {
+	res, err := db.sql.ExecContext(ctx, `
+	UPDATE folders
+	SET deleted_at = CASE WHEN $3 THEN now() END
+	WHERE id = $2
+	AND user_id = (SELECT user_id FROM sessions WHERE key = $1)
+	AND (deleted_at IS NULL) = $3;`, sessionKey, folderID, deleted)
+	if err != nil {
+		return err
+	}
+
+	err = expectRows(res, "folder not found")
+	if err != nil {
+		return err
+	}
+
+	db.invalidateSession(ctx, sessionKey)
+	return nil
+}
+
+// SetFeedDeleted deletes or restores a feed for every user following it, a
+// deleted feed is not scraped and neither it nor its posts are shown
+func (db *DB) SetFeedDeleted(ctx context.Context, feedID string, deleted bool) error {
+	res, err := db.sql.ExecContext(ctx, `
+	UPDATE feeds
+	SET deleted_at = CASE WHEN $2 THEN now() END
+	WHERE id = $1
+	AND (deleted_at IS NULL) = $2;`, feedID, deleted)
+	if err != nil {
+		return err
+	}
+
+	err = expectRows(res, "feed not found")
+	if err != nil {
+		return err
+	}
+
+	db.invalidateFeeds(ctx, feedID)
+	return nil
+}
+
+// SetPostDeleted deletes or restores a post for every user. A deleted post is
+// not written again by scrapes, it stays deleted until restored
+func (db *DB) SetPostDeleted(ctx context.Context, postID string, deleted bool) error {
+	var feedID string
+	err := db.sql.QueryRowContext(ctx, `
+	UPDATE posts
+	SET deleted_at = CASE WHEN $2 THEN now() END
+	WHERE id = $1
+	AND (deleted_at IS NULL) = $2
+	RETURNING feed_id;`, postID, deleted).Scan(&feedID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("post not found")
+		}
+		return err
+	}
+
+	db.invalidateFeeds(ctx, feedID)
+	return nil
+}
+
+// PurgeDeleted permanently deletes up to limit each of the posts, folders and
+// feeds deleted more than olderThan ago, with everything of them, and returns
+// how many rows it purged, nothing when olderThan is zero. The posts of a feed
+// are purged before it is, so a large feed is purged over several runs
+func (db *DB) PurgeDeleted(ctx context.Context, olderThan time.Duration, limit int) (n int64, err error) {
+	if olderThan <= 0 {
+		return 0, nil
+	}
+
+	err = db.withTx(ctx, func(tx *sql.Tx) error {
+		for _, q := range []string{`
+		DELETE FROM posts
+		WHERE id IN (
+			SELECT id
+			FROM posts
+			WHERE deleted_at < now() - $1 * interval '1 second'
+			OR feed_id IN (SELECT id FROM feeds WHERE deleted_at < now() - $1 * interval '1 second')
+			LIMIT $2
+		);`, `
+		DELETE FROM folders
+		WHERE id IN (
+			SELECT id
+			FROM folders
+			WHERE deleted_at < now() - $1 * interval '1 second'
+			LIMIT $2
+		);`, `
+		DELETE FROM feeds
+		WHERE id IN (
+			SELECT id
+			FROM feeds f
+			WHERE deleted_at < now() - $1 * interval '1 second'
+			AND NOT EXISTS (SELECT 1 FROM posts WHERE feed_id = f.id)
+			LIMIT $2
+		);`} {
+			res, err := tx.ExecContext(ctx, q, olderThan.Seconds(), limit)
+			if err != nil {
+				return err
+			}
+
+			purged, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			n += purged
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
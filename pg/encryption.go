@@ -0,0 +1,549 @@
+package pg
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+const (
+	// legacyKeyID is the ID of the key set with SetCredentialKey, credentials
+	// sealed before keys had IDs were sealed with it
+	legacyKeyID = "credentials"
+	// encPrefix marks anything sealed with a key, it is followed by the ID of
+	// the key and _
+	encPrefix = "enc."
+)
+
+// key IDs are kept to what can be matched with LIKE and split on _
+var validKeyID = regexp.MustCompile(`^[a-zA-Z0-9-]+$`)
+
+// a keyring seals with its active key and opens with any of its keys, so keys
+// can be rotated without losing anything sealed with the previous ones
+type keyring struct {
+	active string
+	aeads  map[string]cipher.AEAD
+	// bodies are only sealed with keys set with SetEncryptionKeys
+	bodies bool
+	// hashKeys key the hashes of bodies, each is derived from the key of the
+	// same ID so it is never used for two things
+	hashKeys map[string][]byte
+}
+
+// hashKeyInfo is what the key bodies are hashed with is derived with
+const hashKeyInfo = "hydrocarbon post body hash"
+
+// deriveHashKey returns the key to hash bodies with given an encryption key
+func deriveHashKey(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(hashKeyInfo))
+	return mac.Sum(nil)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("pg: encryption keys must be 32 bytes, got %d", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// SetCredentialKey enables storing feed credentials, sealing them with key,
+// which must be 32 bytes for AES-256. Post bodies are left as they are, see
+// SetEncryptionKeys
+func (db *DB) SetCredentialKey(key []byte) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	db.keys = &keyring{
+		active: legacyKeyID,
+		aeads:  map[string]cipher.AEAD{legacyKeyID: aead},
+	}
+	return nil
+}
+
+// SetEncryptionKeys seals post bodies and feed credentials with the key called
+// active, keys must be 32 bytes for AES-256 and are named by an ID. Everything
+// sealed with any of keys can be read, and is resealed with the active key by
+// RotateKeys, after which the others can be dropped. Credentials sealed with
+// the key of SetCredentialKey need it given here as "credentials"
+func (db *DB) SetEncryptionKeys(keys map[string][]byte, active string) error {
+	if _, ok := keys[active]; !ok {
+		return fmt.Errorf("pg: active key %q is not one of the keys", active)
+	}
+
+	kr := &keyring{
+		active:   active,
+		aeads:    make(map[string]cipher.AEAD),
+		bodies:   true,
+		hashKeys: make(map[string][]byte),
+	}
+	for id, key := range keys {
+		if !validKeyID.MatchString(id) {
+			return fmt.Errorf("pg: invalid key ID %q, IDs may only have letters, digits and -", id)
+		}
+
+		aead, err := newAEAD(key)
+		if err != nil {
+			return fmt.Errorf("pg: key %q: %s", id, err)
+		}
+
+		kr.aeads[id] = aead
+		kr.hashKeys[id] = deriveHashKey(key)
+	}
+
+	db.keys = kr
+	return nil
+}
+
+// bodyKeyID returns the ID of the key bodies are sealed with, empty if they
+// are not
+func (db *DB) bodyKeyID() string {
+	if db.keys == nil || !db.keys.bodies {
+		return ""
+	}
+
+	return db.keys.active
+}
+
+// seal encrypts buf with the active key, bound to ad so it cannot be moved
+// elsewhere, prefixed with the ID of the key and the nonce
+func (kr *keyring) seal(buf, ad []byte) ([]byte, error) {
+	aead := kr.aeads[kr.active]
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err := io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	out := append([]byte(encPrefix+kr.active+"_"), nonce...)
+	return aead.Seal(out, nonce, buf, ad), nil
+}
+
+// open decrypts the output of seal. Anything without a prefix was sealed with
+// the key of SetCredentialKey, before keys had IDs
+func (kr *keyring) open(sealed, ad []byte) ([]byte, error) {
+	id := legacyKeyID
+	if bytes.HasPrefix(sealed, []byte(encPrefix)) {
+		i := bytes.IndexByte(sealed, '_')
+		if i < 0 {
+			return nil, errors.New("pg: sealed data has no key ID")
+		}
+
+		id = string(sealed[len(encPrefix):i])
+		sealed = sealed[i+1:]
+	}
+
+	aead, ok := kr.aeads[id]
+	if !ok {
+		return nil, fmt.Errorf("pg: sealed with unknown key %q", id)
+	}
+
+	ns := aead.NonceSize()
+	if len(sealed) < ns {
+		return nil, errors.New("pg: sealed data is truncated")
+	}
+
+	return aead.Open(nil, sealed[:ns], sealed[ns:], ad)
+}
+
+// sealText seals compressed text for a text column
+func (kr *keyring) sealText(in string) (string, error) {
+	sealed, err := kr.seal([]byte(in), nil)
+	if err != nil {
+		return "", err
+	}
+
+	i := bytes.IndexByte(sealed, '_') + 1
+	return string(sealed[:i]) + base64.StdEncoding.EncodeToString(sealed[i:]), nil
+}
+
+// openText opens the output of sealText
+func (kr *keyring) openText(in string) (string, error) {
+	i := strings.IndexByte(in, '_')
+	if i < 0 {
+		return "", errors.New("pg: sealed text has no key ID")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(in[i+1:])
+	if err != nil {
+		return "", err
+	}
+
+	out, err := kr.open(append([]byte(in[:i+1]), decoded...), nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+// RotateKeys reseals up to limit each of feed credentials, post bodies and
+// transformed post bodies that were sealed with a key other than the active
+// one, or with none, and returns how many it resealed. Bodies of posts written
+// before bodies were shared are moved to be sealed along with the rest
+func (db *DB) RotateKeys(ctx context.Context, limit int) (int64, error) {
+	if db.keys == nil {
+		return 0, nil
+	}
+
+	n, err := db.rotateCredentials(ctx, limit)
+	if err != nil || !db.keys.bodies {
+		return n, err
+	}
+
+	legacy, err := db.moveLegacyBodies(ctx, limit)
+	n += legacy
+	if err != nil {
+		return n, err
+	}
+
+	bodies, err := db.rotateBodies(ctx, limit)
+	n += bodies
+	if err != nil {
+		return n, err
+	}
+
+	overlays, err := db.rotateOverlays(ctx, limit)
+	return n + overlays, err
+}
+
+func (db *DB) rotateCredentials(ctx context.Context, limit int) (n int64, err error) {
+	err = db.withTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+		SELECT user_id, feed_id, sealed
+		FROM feed_credentials
+		WHERE key_id <> $1
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED;`, db.keys.active, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		// credentials are sealed for their feed alone
+		type credentialsOf struct{ userID, feedID string }
+		sealed := make(map[credentialsOf][]byte)
+		for rows.Next() {
+			var c credentialsOf
+			var buf []byte
+			err = rows.Scan(&c.userID, &c.feedID, &buf)
+			if err != nil {
+				return err
+			}
+
+			sealed[c] = buf
+		}
+
+		err = rows.Err()
+		if err != nil {
+			return err
+		}
+		rows.Close()
+
+		for c, buf := range sealed {
+			buf, err = db.open(buf, c.feedID)
+			if err != nil {
+				return err
+			}
+
+			buf, err = db.seal(buf, c.feedID)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, `
+			UPDATE feed_credentials
+			SET sealed = $3, key_id = $4
+			WHERE user_id = $1
+			AND feed_id = $2;`, c.userID, c.feedID, buf, db.keys.active)
+			if err != nil {
+				return err
+			}
+		}
+
+		n = int64(len(sealed))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// rotateBodies reseals bodies with the active key and, as bodies are found by
+// the hash of their plain text, rehashes them with it, moving every post that
+// refers to one over to its new hash. The words of those posts are taken out
+// of the search index, which kept them in the clear
+func (db *DB) rotateBodies(ctx context.Context, limit int) (n int64, err error) {
+	var oldBlobs []string
+	err = db.withTx(ctx, func(tx *sql.Tx) error {
+		// moving a body is not a change to the post, see posts_updated_at
+		_, err := tx.ExecContext(ctx, `SET LOCAL hydrocarbon.indexing = 'on';`)
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.QueryContext(ctx, `
+		SELECT hash, body
+		FROM post_bodies
+		WHERE key_id IS DISTINCT FROM $1
+		OR hash NOT LIKE $2
+		LIMIT $3
+		FOR UPDATE SKIP LOCKED;`, db.keys.active, hashPrefix+db.keys.active+`\_%`, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		stored := make(map[string]string)
+		for rows.Next() {
+			var hash, body string
+			err = rows.Scan(&hash, &body)
+			if err != nil {
+				return err
+			}
+
+			stored[hash] = body
+		}
+
+		err = rows.Err()
+		if err != nil {
+			return err
+		}
+		rows.Close()
+
+		for hash, s := range stored {
+			body, err := db.loadBody(ctx, s)
+			if err != nil {
+				return err
+			}
+
+			newHash := db.bodyHash(body)
+			if newHash == hash {
+				// bodies kept in the blob store are put back in it, sealed
+				if !strings.HasPrefix(s, blobPrefix) {
+					s, err = db.compress(body)
+				} else {
+					s, err = db.storeBody(ctx, hash, body)
+				}
+				if err != nil {
+					return err
+				}
+
+				_, err = tx.ExecContext(ctx, `
+				UPDATE post_bodies
+				SET body = $2, key_id = $3
+				WHERE hash = $1;`, hash, s, db.keys.active)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			if strings.HasPrefix(s, blobPrefix) {
+				oldBlobs = append(oldBlobs, strings.TrimPrefix(s, blobPrefix))
+			}
+
+			sb, err := db.prepareBody(ctx, body)
+			if err != nil {
+				return err
+			}
+
+			err = db.insertBody(ctx, tx, sb)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, `
+			UPDATE posts
+			SET body_hash = $2, search_body = ''
+			WHERE body_hash = $1;`, hash, newHash)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, `
+			DELETE FROM post_bodies
+			WHERE hash = $1;`, hash)
+			if err != nil {
+				return err
+			}
+		}
+
+		n = int64(len(stored))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// the blobs of bodies that were rehashed are only deleted once nothing
+	// refers to them, a failure leaves them behind rather than losing a body
+	for _, hash := range oldBlobs {
+		err = db.blobs.DeleteBlob(ctx, blobKey(hash))
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// moveLegacyBodies moves up to limit bodies of posts written before bodies
+// were shared, which are kept in posts.body, into post_bodies, where they are
+// sealed and hashed with the active key. Their words are taken out of the
+// search index, which kept them in the clear
+func (db *DB) moveLegacyBodies(ctx context.Context, limit int) (n int64, err error) {
+	err = db.withTx(ctx, func(tx *sql.Tx) error {
+		// see rotateBodies
+		_, err := tx.ExecContext(ctx, `SET LOCAL hydrocarbon.indexing = 'on';`)
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.QueryContext(ctx, `
+		SELECT id, body
+		FROM posts
+		WHERE body <> ''
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED;`, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		stored := make(map[string]string)
+		for rows.Next() {
+			var id, body string
+			err = rows.Scan(&id, &body)
+			if err != nil {
+				return err
+			}
+
+			stored[id] = body
+		}
+
+		err = rows.Err()
+		if err != nil {
+			return err
+		}
+		rows.Close()
+
+		for id, s := range stored {
+			body, err := db.loadBody(ctx, s)
+			if err != nil {
+				return err
+			}
+
+			sb, err := db.prepareBody(ctx, body)
+			if err != nil {
+				return err
+			}
+
+			err = db.insertBody(ctx, tx, sb)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, `
+			UPDATE posts
+			SET body = '', body_hash = $2, search_body = ''
+			WHERE id = $1;`, id, sb.hash)
+			if err != nil {
+				return err
+			}
+		}
+
+		n = int64(len(stored))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+func (db *DB) rotateOverlays(ctx context.Context, limit int) (n int64, err error) {
+	err = db.withTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+		SELECT user_id, post_id, body
+		FROM post_overlays
+		WHERE body NOT LIKE $1
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED;`, encPrefix+db.keys.active+`\_%`, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		type overlayKey struct{ userID, postID string }
+		stored := make(map[overlayKey]string)
+		for rows.Next() {
+			var k overlayKey
+			var body string
+			err = rows.Scan(&k.userID, &k.postID, &body)
+			if err != nil {
+				return err
+			}
+
+			stored[k] = body
+		}
+
+		err = rows.Err()
+		if err != nil {
+			return err
+		}
+		rows.Close()
+
+		for k, s := range stored {
+			body, err := db.decompress(s)
+			if err != nil {
+				return err
+			}
+
+			s, err = db.compress(body)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, `
+			UPDATE post_overlays
+			SET body = $3
+			WHERE user_id = $1
+			AND post_id = $2;`, k.userID, k.postID, s)
+			if err != nil {
+				return err
+			}
+		}
+
+		n = int64(len(stored))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
@@ -0,0 +1,171 @@
+package pg
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEncryptionKeyRotation(t *testing.T) {
+	t.Parallel()
+
+	legacy := bytes.Repeat([]byte{1}, 32)
+	old := bytes.Repeat([]byte{2}, 32)
+	next := bytes.Repeat([]byte{3}, 32)
+
+	// credentials sealed before keys had IDs
+	db := &DB{}
+	err := db.SetCredentialKey(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nonce := make([]byte, db.keys.aeads[legacyKeyID].NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unprefixed := db.keys.aeads[legacyKeyID].Seal(nonce, nonce, []byte("secret"), []byte("feed"))
+
+	err = db.SetEncryptionKeys(map[string][]byte{"old": old, legacyKeyID: legacy}, "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := db.seal([]byte("secret"), "feed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(sealed, []byte("enc.old_")) {
+		t.Fatalf("expected credentials sealed with the active key, got %q", sealed[:8])
+	}
+
+	compressed, err := db.compress("<p>a body</p>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(compressed, "enc.old_") {
+		t.Fatalf("expected the body sealed with the active key, got %q", compressed)
+	}
+
+	// once rotated, everything sealed with either earlier key still opens
+	err = db.SetEncryptionKeys(map[string][]byte{"old": old, "next": next, legacyKeyID: legacy}, "next")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range [][]byte{unprefixed, sealed} {
+		out, err := db.open(s, "feed")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != "secret" {
+			t.Fatalf("got %q back after rotating keys", out)
+		}
+	}
+
+	body, err := db.decompress(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "<p>a body</p>" {
+		t.Fatalf("got %q back after rotating keys", body)
+	}
+
+	// but not once the key is dropped
+	err = db.SetEncryptionKeys(map[string][]byte{"next": next}, "next")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.open(sealed, "feed")
+	if err == nil {
+		t.Fatal("opened credentials sealed with a key that was dropped")
+	}
+
+	_, err = db.decompress(compressed)
+	if err == nil {
+		t.Fatal("opened a body sealed with a key that was dropped")
+	}
+}
+
+func TestInvalidEncryptionKeys(t *testing.T) {
+	t.Parallel()
+
+	key := bytes.Repeat([]byte{1}, 32)
+	var cases = []struct {
+		keys   map[string][]byte
+		active string
+	}{
+		{map[string][]byte{"a": key}, "b"},
+		{map[string][]byte{"a_b": key}, "a_b"},
+		{map[string][]byte{"a": key[:16]}, "a"},
+	}
+
+	for _, c := range cases {
+		err := (&DB{}).SetEncryptionKeys(c.keys, c.active)
+		if err == nil {
+			t.Fatalf("expected an error setting keys %v active %q", c.keys, c.active)
+		}
+	}
+}
+
+func TestEncryptedBlobBodies(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "hydrocarbon-sealed-blobs-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bs, err := NewDirBlobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := &DB{}
+	db.SetBlobStore(bs, 100)
+	err = db.SetEncryptionKeys(map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := strings.Repeat("<p>a very long chapter</p>", 100)
+	hash := db.bodyHash(body)
+	if !strings.HasPrefix(hash, "hmac.k1_") {
+		t.Fatalf("expected the body to be hashed with the key, got %s", hash)
+	}
+	stored, err := db.storeBody(ctx, hash, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := ioutil.ReadFile(bs.path(blobKey(hash)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(contents, []byte("enc.k1_")) {
+		t.Fatalf("expected the blob to be sealed, got %q", contents[:8])
+	}
+
+	out, err := db.loadBody(ctx, stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != body {
+		t.Fatal("did not get back the same body after loading it")
+	}
+
+	// without keys the blob can not be read
+	_, err = (&DB{blobs: bs}).loadBody(ctx, stored)
+	if err == nil {
+		t.Fatal("loaded a sealed blob without keys")
+	}
+}
@@ -0,0 +1,164 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+// SetFolderExportToken sets the token a folder is exported at, an empty token
+// stops exporting it
+func (db *DB) SetFolderExportToken(ctx context.Context, sessionKey, folderID, token string) error {
+	res, err := db.sql.ExecContext(ctx, `
+	UPDATE folders
+	SET export_token = NULLIF($3, '')
+	WHERE id = $2
+	AND user_id = (SELECT user_id FROM sessions WHERE key = $1)
+	AND deleted_at IS NULL;`, sessionKey, folderID, token)
+	if err != nil {
+		return err
+	}
+
+	err = expectRows(res, "folder not found")
+	if err != nil || token == "" {
+		return err
+	}
+
+	// exports are read without a session, so the token is recorded to find
+	// their tenant by
+	return db.recordTenantKey(ctx, token)
+}
+
+// GetExportFolder returns the folder exported at token
+func (db *DB) GetExportFolder(ctx context.Context, token string) (*hydrocarbon.ExportFolder, error) {
+	if token == "" {
+		return nil, errors.New("no exported folder found")
+	}
+
+	row := db.sql.QueryRowContext(ctx, `
+	SELECT id, name, created_at
+	FROM folders
+	WHERE export_token = $1
+	AND deleted_at IS NULL;`, token)
+
+	var f hydrocarbon.ExportFolder
+	err := row.Scan(&f.ID, &f.Name, &f.CreatedAt)
+	if err != nil {
+		return nil, errors.New("no exported folder found")
+	}
+
+	return &f, nil
+}
+
+// GetExportPosts returns the newest posts in the feeds of a folder with their
+// bodies, with the overlays of the owner of the folder
+func (db *DB) GetExportPosts(ctx context.Context, folderID string, limit int) ([]*hydrocarbon.Post, error) {
+	rows, err := db.queryRead(ctx, `
+	SELECT po.id, po.created_at, po.updated_at, po.posted_at, po.url,
+		COALESCE(pov.title, po.title), COALESCE(pov.author, po.author), COALESCE(pov.body, pb.body, po.body)
+	FROM posts po
+	JOIN folders fo ON (fo.id = $1)
+	LEFT JOIN post_bodies pb ON (pb.hash = po.body_hash)
+	LEFT JOIN post_overlays pov ON (pov.post_id = po.id AND pov.user_id = fo.user_id)
+	WHERE po.feed_id IN (SELECT feed_id FROM feed_folders WHERE folder_id = $1)
+	AND po.deleted_at IS NULL
+	AND NOT EXISTS (SELECT 1 FROM feeds WHERE id = po.feed_id AND deleted_at IS NOT NULL)
+	ORDER BY po.created_at DESC
+	LIMIT $2;`, folderID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return db.scanExportPosts(ctx, rows)
+}
+
+// scanExportPosts scans exported posts from rows, loading their bodies
+func (db *DB) scanExportPosts(ctx context.Context, rows *sql.Rows) ([]*hydrocarbon.Post, error) {
+	posts := make([]*hydrocarbon.Post, 0)
+	for rows.Next() {
+		var p hydrocarbon.Post
+		var compressedBody string
+		err := rows.Scan(&p.ID, &p.CreatedAt, &p.UpdatedAt, &p.PostedAt, &p.OriginalURL, &p.Title, &p.Author, &compressedBody)
+		if err != nil {
+			return nil, err
+		}
+
+		p.Body, err = db.loadBody(ctx, compressedBody)
+		if err != nil {
+			return nil, err
+		}
+
+		posts = append(posts, &p)
+	}
+
+	return posts, rows.Err()
+}
+
+// FeedFollower returns the ID of the user of sessionKey if they follow the feed
+func (db *DB) FeedFollower(ctx context.Context, sessionKey, feedID string) (string, error) {
+	var userID string
+	err := db.sql.QueryRowContext(ctx, `
+	SELECT s.user_id
+	FROM sessions s
+	WHERE s.key = $1
+	AND s.active = TRUE
+	AND EXISTS (SELECT 1 FROM feed_folders WHERE user_id = s.user_id AND feed_id = $2);`, sessionKey, feedID).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", errors.New("feed not found")
+		}
+		return "", err
+	}
+
+	// the export is read without a session, so what its url is signed over
+	// is recorded to find its tenant by
+	err = db.recordTenantKey(ctx, hydrocarbon.FeedExport(userID, feedID))
+	if err != nil {
+		return "", err
+	}
+
+	return userID, nil
+}
+
+// GetExportFeed returns a feed the user follows with its newest posts and their
+// bodies, with the overlays of the user
+func (db *DB) GetExportFeed(ctx context.Context, userID, feedID string, limit int) (*hydrocarbon.Feed, error) {
+	var f hydrocarbon.Feed
+	err := db.sql.QueryRowContext(ctx, `
+	SELECT f.id, f.title, f.url
+	FROM feeds f
+	WHERE f.id = $2
+	AND f.deleted_at IS NULL
+	AND EXISTS (SELECT 1 FROM feed_folders WHERE user_id = $1 AND feed_id = f.id);`, userID, feedID).Scan(&f.ID, &f.Title, &f.BaseURL)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("feed not found")
+		}
+		return nil, err
+	}
+
+	rows, err := db.queryRead(ctx, `
+	SELECT po.id, po.created_at, po.updated_at, po.posted_at, po.url,
+		COALESCE(pov.title, po.title), COALESCE(pov.author, po.author), COALESCE(pov.body, pb.body, po.body)
+	FROM posts po
+	LEFT JOIN post_bodies pb ON (pb.hash = po.body_hash)
+	LEFT JOIN post_overlays pov ON (pov.post_id = po.id AND pov.user_id = $1)
+	WHERE (po.feed_id = $2 OR po.id IN (SELECT post_id FROM post_sources WHERE feed_id = $2))
+	AND po.deleted_at IS NULL
+	ORDER BY po.created_at DESC
+	LIMIT $3;`, userID, feedID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	f.Posts, err = db.scanExportPosts(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
@@ -0,0 +1,54 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+// GetFeedByExternalID returns the public feed a plugin gave the external ID
+func (db *DB) GetFeedByExternalID(ctx context.Context, sessionKey, plugin, externalID string) (*hydrocarbon.Feed, error) {
+	row := db.sql.QueryRowContext(ctx, `
+	SELECT id, created_at, updated_at, title, plugin, url, status, external_id
+	FROM feeds
+	WHERE plugin = $2
+	AND external_id = $3
+	AND public
+	AND deleted_at IS NULL
+	AND EXISTS (SELECT 1 FROM sessions WHERE key = $1);`, sessionKey, plugin, externalID)
+
+	var f hydrocarbon.Feed
+	err := row.Scan(&f.ID, &f.CreatedAt, &f.UpdatedAt, &f.Title, &f.Plugin, &f.BaseURL, &f.Status, &f.ExternalID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("no feed found")
+		}
+		return nil, err
+	}
+
+	return &f, nil
+}
+
+// GetPostByExternalID returns the post a plugin gave the external ID, of the
+// feeds anyone can follow
+func (db *DB) GetPostByExternalID(ctx context.Context, sessionKey, plugin, externalID string) (*hydrocarbon.Post, error) {
+	var id string
+	err := db.sql.QueryRowContext(ctx, `
+	SELECT id FROM posts WHERE external_id = $1 || ':' || $2 AND scope = '';`, plugin, externalID).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("no post found")
+		}
+		return nil, err
+	}
+
+	p, err := db.GetPost(ctx, sessionKey, id)
+	if err != nil {
+		return nil, err
+	}
+	p.ExternalID = externalID
+
+	return p, nil
+}
@@ -0,0 +1,83 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+// GetPublicFeed returns a public feed that has been resolved to a plugin
+func (db *DB) GetPublicFeed(ctx context.Context, feedID string) (*hydrocarbon.Feed, error) {
+	if _, err := uuid.Parse(feedID); err != nil {
+		return nil, errors.New("no public feed found")
+	}
+
+	row := db.sql.QueryRowContext(ctx, `
+	SELECT id, created_at, updated_at, title, plugin, url
+	FROM feeds
+	WHERE id = $1
+	AND public
+	AND status = 'active'
+	AND deleted_at IS NULL;`, feedID)
+
+	var f hydrocarbon.Feed
+	err := row.Scan(&f.ID, &f.CreatedAt, &f.UpdatedAt, &f.Title, &f.Plugin, &f.BaseURL)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("no public feed found")
+		}
+		return nil, err
+	}
+
+	return &f, nil
+}
+
+// GetPublicFeedPosts returns up to limit posts of a public feed updated after
+// the post with the given update time and ID, with their bodies
+func (db *DB) GetPublicFeedPosts(ctx context.Context, feedID string, after time.Time, afterID string, limit int) ([]*hydrocarbon.Post, error) {
+	if afterID == "" {
+		afterID = uuid.Nil.String()
+	}
+
+	rows, err := db.sql.QueryContext(ctx, `
+	SELECT po.id, po.created_at, po.updated_at, po.posted_at, po.title, po.author, COALESCE(pb.body, po.body), po.url, po.license, po.attribution
+	FROM posts po
+	LEFT JOIN post_bodies pb ON (pb.hash = po.body_hash)
+	JOIN feeds f ON (f.id = po.feed_id)
+	WHERE po.feed_id = $1
+	AND f.public
+	AND f.deleted_at IS NULL
+	AND po.deleted_at IS NULL
+	AND (po.updated_at, po.id) > ($2, $3::uuid)
+	ORDER BY po.updated_at ASC, po.id ASC
+	LIMIT $4;`, feedID, after, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := make([]*hydrocarbon.Post, 0)
+	for rows.Next() {
+		var p hydrocarbon.Post
+		var compressedBody string
+
+		err = rows.Scan(&p.ID, &p.CreatedAt, &p.UpdatedAt, &p.PostedAt, &p.Title, &p.Author, &compressedBody, &p.OriginalURL, &p.License, &p.Attribution)
+		if err != nil {
+			return nil, err
+		}
+
+		p.Body, err = db.loadBody(ctx, compressedBody)
+		if err != nil {
+			return nil, err
+		}
+
+		posts = append(posts, &p)
+	}
+
+	return posts, rows.Err()
+}
@@ -0,0 +1,369 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+// feverFollowed selects the feeds the user $1 follows, in folders they have
+// not deleted
+const feverFollowed = `
+	SELECT ff.feed_id
+	FROM feed_folders ff
+	JOIN folders fo ON (fo.id = ff.folder_id AND fo.deleted_at IS NULL)
+	JOIN feeds f ON (f.id = ff.feed_id AND f.deleted_at IS NULL)
+	WHERE ff.user_id = $1`
+
+// feverPosts matches the posts po of the feeds the user $1 follows, whether
+// they were scraped from one or merged with a near-duplicate from one
+const feverPosts = `(po.feed_id IN (` + feverFollowed + `)
+	OR po.id IN (SELECT post_id FROM post_sources WHERE feed_id IN (` + feverFollowed + `)))`
+
+// feverFeed selects the feed Fever clients are told the post po is in, the
+// one it was scraped from if the user $1 follows it, or else the first they
+// follow it was merged from
+const feverFeed = `CASE WHEN po.feed_id IN (` + feverFollowed + `) THEN po.feed_id
+	ELSE (SELECT ps.feed_id FROM post_sources ps WHERE ps.post_id = po.id AND ps.feed_id IN (` + feverFollowed + `) ORDER BY ps.feed_id LIMIT 1) END`
+
+// posts stored before Fever clients were served are numbered this many at a
+// time, each time the maintainer runs
+const numberBatchSize = 5000
+
+// SetFeverPassword sets the password Fever clients of the user log in with.
+// The key is made from their email in lower case, emails are kept in the case
+// they were first entered in but clients hash whatever case they are given
+func (db *DB) SetFeverPassword(ctx context.Context, sessionKey, password string) error {
+	var key sql.NullString
+	err := db.sql.QueryRowContext(ctx, `
+	UPDATE users
+	SET fever_key = CASE WHEN $2 = '' THEN NULL ELSE md5(lower(email::text) || ':' || $2) END
+	WHERE id = (SELECT user_id FROM sessions WHERE key = $1 AND active = TRUE)
+	RETURNING fever_key;`, sessionKey, password).Scan(&key)
+	if err == sql.ErrNoRows {
+		return errors.New("invalid or inactive token")
+	}
+	if err != nil || !key.Valid {
+		return err
+	}
+
+	// Fever clients send the key rather than a session, so it is recorded
+	// to find their tenant by
+	return db.recordTenantKey(ctx, key.String)
+}
+
+// FeverUser returns the ID of the user whose Fever key apiKey is
+func (db *DB) FeverUser(ctx context.Context, apiKey string) (string, error) {
+	var userID string
+	err := db.sql.QueryRowContext(ctx, `
+	SELECT id
+	FROM users
+	WHERE fever_key = $1;`, apiKey).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	return userID, err
+}
+
+// FeverGroups returns the folders of the user, with the feeds in each
+func (db *DB) FeverGroups(ctx context.Context, userID string) ([]*hydrocarbon.FeverGroup, error) {
+	rows, err := db.queryRead(ctx, `
+	SELECT fo.int_id, fo.name, array_remove(array_agg(f.int_id), NULL)
+	FROM folders fo
+	LEFT JOIN feed_folders ff ON (ff.folder_id = fo.id AND ff.user_id = fo.user_id)
+	LEFT JOIN feeds f ON (f.id = ff.feed_id AND f.deleted_at IS NULL)
+	WHERE fo.user_id = $1
+	AND fo.deleted_at IS NULL
+	GROUP BY fo.int_id, fo.name
+	ORDER BY fo.name;`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := make([]*hydrocarbon.FeverGroup, 0)
+	for rows.Next() {
+		var g hydrocarbon.FeverGroup
+		err = rows.Scan(&g.ID, &g.Title, pq.Array(&g.FeedIDs))
+		if err != nil {
+			return nil, err
+		}
+
+		groups = append(groups, &g)
+	}
+
+	return groups, rows.Err()
+}
+
+// FeverFeeds returns the feeds the user follows
+func (db *DB) FeverFeeds(ctx context.Context, userID string) ([]*hydrocarbon.FeverFeed, error) {
+	rows, err := db.queryRead(ctx, `
+	SELECT f.int_id, f.title, f.url, COALESCE((SELECT max(posted_at) FROM posts WHERE feed_id = f.id), f.created_at)
+	FROM feeds f
+	WHERE f.id IN (`+feverFollowed+`)
+	ORDER BY f.title;`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	feeds := make([]*hydrocarbon.FeverFeed, 0)
+	for rows.Next() {
+		var f hydrocarbon.FeverFeed
+		var updatedAt time.Time
+		err = rows.Scan(&f.ID, &f.Title, &f.URL, &updatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		f.SiteURL = f.URL
+		f.LastUpdatedOnTime = updatedAt.Unix()
+		feeds = append(feeds, &f)
+	}
+
+	return feeds, rows.Err()
+}
+
+// FeverItems returns up to 50 posts of the feeds the user follows, with their
+// bodies, and how many posts those feeds have
+func (db *DB) FeverItems(ctx context.Context, userID string, q *hydrocarbon.FeverItemQuery) ([]*hydrocarbon.FeverItem, int, error) {
+	var total int
+	err := db.sql.QueryRowContext(ctx, `
+	SELECT count(*)
+	FROM posts po
+	WHERE `+feverPosts+`
+	AND po.deleted_at IS NULL;`, userID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	where, order, arg := `po.int_id > $2`, `ASC`, interface{}(q.SinceID)
+	if len(q.WithIDs) > 0 {
+		where, arg = `po.int_id = ANY($2::bigint[])`, pq.Array(q.WithIDs)
+	} else if q.MaxID > 0 {
+		where, order, arg = `po.int_id < $2`, `DESC`, q.MaxID
+	}
+
+	rows, err := db.sql.QueryContext(ctx, `
+	SELECT po.int_id, f.int_id, COALESCE(pov.title, po.title), COALESCE(pov.author, po.author),
+		COALESCE(pov.body, pb.body, po.body), po.url, po.posted_at,
+		(EXISTS(SELECT 1 FROM read_statuses WHERE post_id = po.id AND user_id = $1)),
+		(EXISTS(SELECT 1 FROM post_stars WHERE post_id = po.id AND user_id = $1))
+	FROM posts po
+	JOIN feeds f ON (f.id = `+feverFeed+`)
+	LEFT JOIN post_bodies pb ON (pb.hash = po.body_hash)
+	LEFT JOIN post_overlays pov ON (pov.post_id = po.id AND pov.user_id = $1)
+	WHERE `+feverPosts+`
+	AND po.deleted_at IS NULL
+	AND `+where+`
+	ORDER BY po.int_id `+order+`
+	LIMIT 50;`, userID, arg)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	items := make([]*hydrocarbon.FeverItem, 0)
+	for rows.Next() {
+		var it hydrocarbon.FeverItem
+		var compressedBody string
+		var postedAt time.Time
+		var read, saved bool
+		err = rows.Scan(&it.ID, &it.FeedID, &it.Title, &it.Author, &compressedBody, &it.URL, &postedAt, &read, &saved)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		it.HTML, err = db.loadBody(ctx, compressedBody)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		it.CreatedOnTime = postedAt.Unix()
+		if read {
+			it.IsRead = 1
+		}
+		if saved {
+			it.IsSaved = 1
+		}
+		items = append(items, &it)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return items, total, nil
+}
+
+// FeverUnreadItemIDs returns the posts of the feeds the user follows they
+// have not read
+func (db *DB) FeverUnreadItemIDs(ctx context.Context, userID string) ([]int64, error) {
+	return db.feverIDs(ctx, `
+	SELECT po.int_id
+	FROM posts po
+	WHERE `+feverPosts+`
+	AND po.deleted_at IS NULL
+	AND po.int_id IS NOT NULL
+	AND NOT EXISTS (SELECT 1 FROM read_statuses WHERE post_id = po.id AND user_id = $1)
+	ORDER BY po.int_id;`, userID)
+}
+
+// FeverSavedItemIDs returns the posts the user has starred
+func (db *DB) FeverSavedItemIDs(ctx context.Context, userID string) ([]int64, error) {
+	return db.feverIDs(ctx, `
+	SELECT po.int_id
+	FROM post_stars ps
+	JOIN posts po ON (po.id = ps.post_id)
+	WHERE ps.user_id = $1
+	AND po.deleted_at IS NULL
+	AND po.int_id IS NOT NULL
+	ORDER BY po.int_id;`, userID)
+}
+
+func (db *DB) feverIDs(ctx context.Context, query, userID string) ([]int64, error) {
+	rows, err := db.queryRead(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// FeverMarkItem marks a post read, unread, starred or unstarred for the user,
+// posts of feeds they do not follow are left alone
+func (db *DB) FeverMarkItem(ctx context.Context, userID string, itemID int64, as string) error {
+	var query string
+	switch as {
+	case "read":
+		query = `
+		INSERT INTO read_statuses
+		(user_id, post_id)
+		SELECT $1, po.id
+		FROM posts po
+		WHERE po.int_id = $2
+		AND ` + feverPosts + `
+		ON CONFLICT DO NOTHING;`
+	case "unread":
+		query = `
+		DELETE FROM read_statuses
+		WHERE user_id = $1
+		AND post_id = (SELECT po.id FROM posts po WHERE po.int_id = $2 AND ` + feverPosts + `);`
+	case "saved":
+		query = `
+		INSERT INTO post_stars
+		(user_id, post_id)
+		SELECT $1, po.id
+		FROM posts po
+		WHERE po.int_id = $2
+		AND ` + feverPosts + `
+		ON CONFLICT DO NOTHING;`
+	case "unsaved":
+		query = `
+		DELETE FROM post_stars
+		WHERE user_id = $1
+		AND post_id = (SELECT po.id FROM posts po WHERE po.int_id = $2 AND ` + feverPosts + `);`
+	default:
+		return errors.New("items can only be marked read, unread, saved or unsaved")
+	}
+
+	_, err := db.sql.ExecContext(ctx, query, userID, itemID)
+	if err != nil {
+		return err
+	}
+
+	db.invalidateUsers(ctx, userID)
+	return nil
+}
+
+// FeverMarkRead marks the posts of a feed, or of every feed in a folder, the
+// user follows read if they were posted before before. Group 0 is every feed
+func (db *DB) FeverMarkRead(ctx context.Context, userID, kind string, id int64, before time.Time) error {
+	// feeds selects those whose posts are marked, posts merged from them
+	// included
+	var feeds string
+	switch kind {
+	case "feed":
+		feeds = `SELECT id FROM feeds WHERE int_id = $2`
+	case "group":
+		feeds = `
+			SELECT ff.feed_id
+			FROM feed_folders ff
+			JOIN folders fo ON (fo.id = ff.folder_id)
+			WHERE fo.user_id = $1 AND ($2 = 0 OR fo.int_id = $2)`
+	default:
+		return errors.New("only feeds and groups can be marked read")
+	}
+
+	_, err := db.sql.ExecContext(ctx, `
+	INSERT INTO read_statuses
+	(user_id, post_id)
+	SELECT $1, po.id
+	FROM posts po
+	WHERE `+feverPosts+`
+	AND po.deleted_at IS NULL
+	AND po.posted_at < $3
+	AND (po.feed_id IN (`+feeds+`) OR po.id IN (SELECT post_id FROM post_sources WHERE feed_id IN (`+feeds+`)))
+	ON CONFLICT DO NOTHING;`, userID, id, before)
+	if err != nil {
+		return err
+	}
+
+	db.invalidateUsers(ctx, userID)
+	return nil
+}
+
+// NumberPosts gives up to limit posts stored before they were numbered their
+// integer ID, oldest first, and returns how many it numbered. Fever and Google
+// Reader clients only see posts once they are numbered
+func (db *DB) NumberPosts(ctx context.Context, limit int) (n int64, err error) {
+	err = db.withTx(ctx, func(tx *sql.Tx) error {
+		// see the posts_updated_at trigger
+		_, err := tx.ExecContext(ctx, `SET LOCAL hydrocarbon.indexing = 'on';`)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, `
+		UPDATE posts
+		SET int_id = nextval('posts_int_id_seq')
+		WHERE id IN (
+			SELECT id
+			FROM posts
+			WHERE int_id IS NULL
+			ORDER BY created_at ASC
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		);`, limit)
+		if err != nil {
+			return err
+		}
+
+		n, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
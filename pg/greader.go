@@ -0,0 +1,123 @@
+package pg
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+// GReaderItemIDs returns the posts of the feeds the user follows q selects
+func (db *DB) GReaderItemIDs(ctx context.Context, userID string, q *hydrocarbon.GReaderQuery) ([]int64, error) {
+	args := []interface{}{userID}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	query := `
+	SELECT po.int_id
+	FROM posts po
+	WHERE ` + feverPosts + `
+	AND po.deleted_at IS NULL
+	AND po.int_id IS NOT NULL`
+
+	// posts merged from the feeds selected are included
+	if q.FeedID != 0 {
+		feed := `SELECT id FROM feeds WHERE int_id = ` + arg(q.FeedID)
+		query += `
+	AND (po.feed_id IN (` + feed + `) OR po.id IN (SELECT post_id FROM post_sources WHERE feed_id IN (` + feed + `)))`
+	}
+	if q.GroupID != 0 {
+		group := `
+		SELECT ff.feed_id
+		FROM feed_folders ff
+		JOIN folders fo ON (fo.id = ff.folder_id)
+		WHERE fo.int_id = ` + arg(q.GroupID) + ` AND fo.user_id = $1`
+		query += `
+	AND (po.feed_id IN (` + group + `) OR po.id IN (SELECT post_id FROM post_sources WHERE feed_id IN (` + group + `)))`
+	}
+	if q.Starred {
+		query += `
+	AND EXISTS (SELECT 1 FROM post_stars WHERE post_id = po.id AND user_id = $1)`
+	}
+	if q.ExcludeRead {
+		query += `
+	AND NOT EXISTS (SELECT 1 FROM read_statuses WHERE post_id = po.id AND user_id = $1)`
+	}
+	if !q.NewerThan.IsZero() {
+		query += `
+	AND po.posted_at >= ` + arg(q.NewerThan)
+	}
+	if !q.OlderThan.IsZero() {
+		query += `
+	AND po.posted_at < ` + arg(q.OlderThan)
+	}
+
+	order := `DESC`
+	if q.Continue != 0 && q.OldestFirst {
+		query += `
+	AND po.int_id > ` + arg(q.Continue)
+	} else if q.Continue != 0 {
+		query += `
+	AND po.int_id < ` + arg(q.Continue)
+	}
+	if q.OldestFirst {
+		order = `ASC`
+	}
+
+	query += `
+	ORDER BY po.int_id ` + order + `
+	LIMIT ` + arg(q.Limit) + `;`
+
+	rows, err := db.queryRead(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// GReaderUnreadCounts returns how many posts of each feed the user follows
+// they have not read, posts merged with a near-duplicate are counted in the
+// feed their item is listed in
+func (db *DB) GReaderUnreadCounts(ctx context.Context, userID string) ([]*hydrocarbon.GReaderUnreadCount, error) {
+	rows, err := db.queryRead(ctx, `
+	SELECT f.int_id, count(*), max(po.posted_at)
+	FROM posts po
+	JOIN feeds f ON (f.id = `+feverFeed+`)
+	WHERE `+feverPosts+`
+	AND po.deleted_at IS NULL
+	AND NOT EXISTS (SELECT 1 FROM read_statuses WHERE post_id = po.id AND user_id = $1)
+	GROUP BY f.int_id
+	ORDER BY f.int_id;`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make([]*hydrocarbon.GReaderUnreadCount, 0)
+	for rows.Next() {
+		var c hydrocarbon.GReaderUnreadCount
+		err = rows.Scan(&c.FeedID, &c.Count, &c.Newest)
+		if err != nil {
+			return nil, err
+		}
+
+		counts = append(counts, &c)
+	}
+
+	return counts, rows.Err()
+}
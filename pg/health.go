@@ -0,0 +1,76 @@
+package pg
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/lib/pq"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+// Health returns an error if the primary cannot be reached, or else the number
+// of migrations pending, the last backup and how far behind each replica is.
+// Replicas that are down or lagging do not fail the check, as reads fall back
+// to the primary, and their lag is recorded so queryRead skips them
+func (db *DB) Health(ctx context.Context) (*hydrocarbon.Health, error) {
+	err := db.sql.PingContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := db.pendingMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &hydrocarbon.Health{
+		PendingMigrations: pending,
+		Replicas:          make([]*hydrocarbon.ReplicaHealth, 0, len(db.replicas)),
+	}
+
+	// the backups table may not exist yet while migrations are pending
+	if pending == 0 {
+		h.LastBackup, err = db.lastBackup(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, r := range db.replicas {
+		rh := &hydrocarbon.ReplicaHealth{Replica: i}
+
+		rh.LagSeconds, err = r.lag(ctx)
+		if err != nil {
+			rh.Error = err.Error()
+		} else {
+			rh.Up = true
+			r.setLag(rh.LagSeconds)
+			rh.Lagging = atomic.LoadInt32(&r.lagging) == 1
+		}
+
+		h.Replicas = append(h.Replicas, rh)
+	}
+
+	return h, nil
+}
+
+// pendingMigrations returns the number of migrations embedded that have not
+// been run
+func (db *DB) pendingMigrations(ctx context.Context) (int, error) {
+	names, err := migrationNames()
+	if err != nil {
+		return 0, err
+	}
+
+	var ran int
+	err = db.sql.QueryRowContext(ctx, `
+	SELECT count(*)
+	FROM migrations
+	WHERE name = ANY($1::text[]);`, pq.Array(names)).Scan(&ran)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(names) - ran, nil
+}
@@ -0,0 +1,58 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/fortytw2/hydrocarbon/discollect"
+)
+
+// PutCachedResponse stores the latest response to a url, replacing any earlier
+// one
+func (db *DB) PutCachedResponse(ctx context.Context, cr *discollect.CachedResponse) error {
+	header, err := json.Marshal(cr.Header)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.sql.ExecContext(ctx, `
+	INSERT INTO http_cache
+	(url, stored_at, etag, last_modified, status_code, header, body)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (url) DO UPDATE
+	SET (stored_at, etag, last_modified, status_code, header, body) =
+		(EXCLUDED.stored_at, EXCLUDED.etag, EXCLUDED.last_modified, EXCLUDED.status_code, EXCLUDED.header, EXCLUDED.body);`,
+		cr.URL, cr.StoredAt, cr.ETag, cr.LastModified, cr.StatusCode, header, cr.Body)
+	return err
+}
+
+// GetCachedResponse returns the latest response stored for a url, or nil
+func (db *DB) GetCachedResponse(ctx context.Context, url string) (*discollect.CachedResponse, error) {
+	row := db.sql.QueryRowContext(ctx, `
+	SELECT stored_at, etag, last_modified, status_code, header, body
+	FROM http_cache
+	WHERE url = $1;`, url)
+
+	cr := discollect.CachedResponse{
+		URL: url,
+	}
+
+	var header []byte
+	err := row.Scan(&cr.StoredAt, &cr.ETag, &cr.LastModified, &cr.StatusCode, &header, &cr.Body)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	cr.Header = make(http.Header)
+	err = json.Unmarshal(header, &cr.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cr, nil
+}
@@ -0,0 +1,100 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+var errSharedImport = errors.New("posts can only be imported into feeds no one else follows")
+
+// ImportPosts adds backfilled posts to a feed only the user follows, posts that
+// already exist by url or content are left as they are. Posts are shared by
+// every follower of a feed, so they can not be imported into a feed others
+// follow too
+func (db *DB) ImportPosts(ctx context.Context, sessionKey, feedID string, posts []*hydrocarbon.Post) (n int, err error) {
+	imported := make(map[string]*hydrocarbon.Post)
+	err = db.withTx(ctx, func(tx *sql.Tx) error {
+		var feedURL, scope string
+		var shared bool
+		err := tx.QueryRowContext(ctx, `
+		SELECT f.url, CASE WHEN f.public THEN '' ELSE f.id::text END, EXISTS (SELECT 1 FROM feed_folders ff WHERE ff.feed_id = f.id AND ff.user_id <> s.user_id)
+		FROM feeds f
+		JOIN sessions s ON (s.key = $1)
+		WHERE f.id = $2
+		AND f.deleted_at IS NULL
+		AND EXISTS (SELECT 1 FROM feed_folders ff WHERE ff.feed_id = f.id AND ff.user_id = s.user_id)
+		FOR UPDATE OF f;`, sessionKey, feedID).Scan(&feedURL, &scope, &shared)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return errors.New("feed not found")
+			}
+			return err
+		}
+		if shared {
+			return errSharedImport
+		}
+
+		stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO posts
+		(id, feed_id, content_hash, title, author, body, body_hash, url, posted_at, license, attribution, simhash, search_body, backfilled, scope)
+		VALUES
+		($12, $1, $2, $3, $4, '', $5, $6, $7, $8, $9, $10, $11, true, $13)
+		ON CONFLICT DO NOTHING
+		RETURNING id;`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, p := range posts {
+			if strings.HasPrefix(p.OriginalURL, "#") {
+				p.OriginalURL = feedURL + p.OriginalURL
+			}
+
+			var body *storedBody
+			body, err = db.prepareBody(ctx, p.Body)
+			if err != nil {
+				return err
+			}
+
+			err = db.insertBody(ctx, tx, body)
+			if err != nil {
+				return err
+			}
+
+			// scoped as the posts scraped into a private feed are
+			key := keyOf(p, scope)
+
+			var id string
+			err = stmt.QueryRowContext(ctx, feedID, key.contentHash, p.Title, p.Author, body.hash, key.url,
+				p.PostedAt, p.License, p.Attribution, int64(p.SimHash()), db.searchBody(p.Body), hydrocarbon.NewID(), key.scope).Scan(&id)
+			if err == sql.ErrNoRows {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			imported[id] = p
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for id, p := range imported {
+		db.transform(ctx, id, feedID, p)
+	}
+
+	if len(imported) > 0 {
+		db.invalidateFeeds(ctx, feedID)
+	}
+
+	return len(imported), nil
+}
@@ -0,0 +1,83 @@
+package pg
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+// RecordKeyUsage adds a batch of API call counts to their sessions
+func (db *DB) RecordKeyUsage(ctx context.Context, usage map[string]*hydrocarbon.KeyUsage) error {
+	keys := make([]string, 0, len(usage))
+	calls := make([]int64, 0, len(usage))
+	lastUsed := make([]int64, 0, len(usage))
+	for k, u := range usage {
+		keys = append(keys, k)
+		calls = append(calls, u.Calls)
+		lastUsed = append(lastUsed, u.LastUsedAt.Unix())
+	}
+
+	_, err := db.sql.ExecContext(ctx, `
+	UPDATE sessions s
+	SET (api_calls, last_used_at) = (s.api_calls + u.calls, greatest(s.last_used_at, to_timestamp(u.last_used)))
+	FROM unnest($1::text[], $2::bigint[], $3::bigint[]) AS u(key, calls, last_used)
+	WHERE s.key = u.key;`, pq.Array(keys), pq.Array(calls), pq.Array(lastUsed))
+	return err
+}
+
+// FindKeyReminders returns every active key that should be rotated or revoked,
+// grouped by the email of its owner
+func (db *DB) FindKeyReminders(ctx context.Context, rotateAfter, staleAfter, remindEvery time.Duration) ([]*hydrocarbon.KeyReminder, error) {
+	rows, err := db.sql.QueryContext(ctx, `
+	SELECT u.email, s.id, s.created_at, s.user_agent, s.ip, s.active, s.api_calls, s.last_used_at
+	FROM sessions s
+	JOIN users u ON (u.id = s.user_id)
+	WHERE s.active = TRUE
+	AND (s.reminded_at IS NULL OR s.reminded_at < now() - $3 * interval '1 second')
+	AND (
+		s.created_at < now() - $1 * interval '1 second' OR
+		coalesce(s.last_used_at, s.created_at) < now() - $2 * interval '1 second'
+	)
+	ORDER BY u.email, s.created_at;`, rotateAfter.Seconds(), staleAfter.Seconds(), remindEvery.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reminders := make([]*hydrocarbon.KeyReminder, 0)
+	var kr *hydrocarbon.KeyReminder
+	for rows.Next() {
+		var email string
+		var s hydrocarbon.Session
+		var lastUsed pq.NullTime
+		err = rows.Scan(&email, &s.ID, &s.CreatedAt, &s.UserAgent, &s.IP, &s.Active, &s.APICalls, &lastUsed)
+		if err != nil {
+			return nil, err
+		}
+
+		if lastUsed.Valid {
+			s.LastUsedAt = &lastUsed.Time
+		}
+
+		if kr == nil || kr.Email != email {
+			kr = &hydrocarbon.KeyReminder{Email: email}
+			reminders = append(reminders, kr)
+		}
+		kr.Sessions = append(kr.Sessions, &s)
+	}
+
+	return reminders, rows.Err()
+}
+
+// MarkKeysReminded records that the owners of the given sessions were reminded
+// about them
+func (db *DB) MarkKeysReminded(ctx context.Context, sessionIDs []string) error {
+	_, err := db.sql.ExecContext(ctx, `
+	UPDATE sessions
+	SET reminded_at = now()
+	WHERE id = ANY($1::uuid[]);`, pq.Array(sessionIDs))
+	return err
+}
@@ -0,0 +1,273 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+const (
+	maintenanceInterval = 5 * time.Minute
+	// tables with more modified rows than this since their last ANALYZE are
+	// analyzed again
+	analyzeThreshold = 5000
+	// rows sealed with an old key are resealed this many at a time
+	rotateBatchSize = 500
+)
+
+// hotTables are written to by every scrape, large scrape batches skew their
+// statistics long before autovacuum gets around to them
+var hotTables = []string{"posts", "scrapes", "scrape_usage", "snapshots", "read_statuses", "http_cache", "scrape_logs"}
+
+// A Maintainer periodically runs ANALYZE on hot tables that have seen a large
+// number of writes since they were last analyzed, deletes old scrape logs and
+// host rate limits, indexes posts written before search existed, numbers those
+// stored before Fever clients were served, prunes posts past the retention
+// policy, purges what was deleted long enough ago, deletes bodies no post
+// refers to and, if enabled, reseals everything sealed with an old key
+type Maintainer struct {
+	db *DB
+
+	// posts beyond the keepPosts newest of their feed and posted before
+	// keepFor ago are pruned, each rule is disabled when zero
+	keepPosts int
+	keepFor   time.Duration
+	// feeds, folders and posts deleted before purgeAfter ago are purged,
+	// never when zero
+	purgeAfter time.Duration
+	// rotateKeys reseals data sealed with keys other than the active one
+	rotateKeys bool
+
+	ticker   *time.Ticker
+	shutdown chan chan struct{}
+}
+
+// NewMaintainer returns a new Maintainer
+func NewMaintainer(db *DB) *Maintainer {
+	return &Maintainer{
+		db:       db,
+		shutdown: make(chan chan struct{}),
+	}
+}
+
+// SetRetention prunes posts that are neither among the keep newest of their
+// feed nor posted within the last olderThan, leaving either zero disables that
+// rule. Starred posts are always kept
+func (m *Maintainer) SetRetention(keep int, olderThan time.Duration) {
+	m.keepPosts = keep
+	m.keepFor = olderThan
+}
+
+// SetPurge purges feeds, folders and posts deleted more than after ago, until
+// then they can be restored. Zero, the default, keeps them forever
+func (m *Maintainer) SetPurge(after time.Duration) {
+	m.purgeAfter = after
+}
+
+// SetKeyRotation makes the maintainer reseal, a batch each time it runs,
+// everything sealed with a key other than the active one. It is off by
+// default, as finding what is left to reseal scans post_bodies
+func (m *Maintainer) SetKeyRotation(enabled bool) {
+	m.rotateKeys = enabled
+}
+
+// Start launches the maintainer, it blocks until Stop is called
+func (m *Maintainer) Start() error {
+	m.ticker = time.NewTicker(maintenanceInterval)
+
+	for {
+		select {
+		case a := <-m.shutdown:
+			m.ticker.Stop()
+			a <- struct{}{}
+			return nil
+		case <-m.ticker.C:
+			analyzed, err := m.db.AnalyzeHotTables(context.TODO(), analyzeThreshold)
+			if err != nil {
+				log.Println("pg: maintenance:", err)
+				continue
+			}
+
+			for _, t := range analyzed {
+				log.Println("pg: maintenance: analyzed", t)
+			}
+
+			pruned, err := m.db.PruneScrapeLogs(context.TODO(), scrapeLogRetention)
+			if err != nil {
+				log.Println("pg: maintenance:", err)
+				continue
+			}
+
+			if pruned > 0 {
+				log.Println("pg: maintenance: pruned", pruned, "scrape logs")
+			}
+
+			pruned, err = m.db.PruneRateLimits(context.TODO(), rateLimitRetention)
+			if err != nil {
+				log.Println("pg: maintenance:", err)
+				continue
+			}
+
+			if pruned > 0 {
+				log.Println("pg: maintenance: pruned", pruned, "host rate limits")
+			}
+
+			indexed, err := m.db.IndexPostBodies(context.TODO(), indexBatchSize)
+			if err != nil {
+				log.Println("pg: maintenance:", err)
+				continue
+			}
+
+			if indexed > 0 {
+				log.Println("pg: maintenance: indexed", indexed, "posts for search")
+			}
+
+			numbered, err := m.db.NumberPosts(context.TODO(), numberBatchSize)
+			if err != nil {
+				log.Println("pg: maintenance:", err)
+				continue
+			}
+
+			if numbered > 0 {
+				log.Println("pg: maintenance: numbered", numbered, "posts for fever clients")
+			}
+
+			pruned, err = m.db.PrunePosts(context.TODO(), m.keepPosts, m.keepFor, pruneBatchSize)
+			if err != nil {
+				log.Println("pg: maintenance:", err)
+				continue
+			}
+
+			if pruned > 0 {
+				log.Println("pg: maintenance: pruned", pruned, "posts past retention")
+			}
+
+			pruned, err = m.db.PurgeDeleted(context.TODO(), m.purgeAfter, purgeBatchSize)
+			if err != nil {
+				log.Println("pg: maintenance:", err)
+				continue
+			}
+
+			if pruned > 0 {
+				log.Println("pg: maintenance: purged", pruned, "deleted feeds, folders and posts")
+			}
+
+			pruned, err = m.db.PruneBodies(context.TODO(), bodyPruneBatchSize)
+			if err != nil {
+				log.Println("pg: maintenance:", err)
+				continue
+			}
+
+			if pruned > 0 {
+				log.Println("pg: maintenance: deleted", pruned, "unused post bodies")
+			}
+
+			if !m.rotateKeys {
+				continue
+			}
+
+			resealed, err := m.db.RotateKeys(context.TODO(), rotateBatchSize)
+			if err != nil {
+				log.Println("pg: maintenance:", err)
+				continue
+			}
+
+			if resealed > 0 {
+				log.Println("pg: maintenance: resealed", resealed, "rows with the active key")
+			}
+		}
+	}
+}
+
+// Stop gracefully stops the maintainer and blocks until its shutdown
+func (m *Maintainer) Stop() {
+	c := make(chan struct{})
+	m.shutdown <- c
+	<-c
+}
+
+// AnalyzeHotTables runs ANALYZE on every hot table with more than threshold
+// rows modified since it was last analyzed, and returns their names
+func (db *DB) AnalyzeHotTables(ctx context.Context, threshold int) ([]string, error) {
+	rows, err := db.sql.QueryContext(ctx, `
+	SELECT relname
+	FROM pg_stat_user_tables
+	WHERE relname = ANY($1) AND n_mod_since_analyze > $2;`, pq.Array(hotTables), threshold)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stale []string
+	for rows.Next() {
+		var t string
+		err = rows.Scan(&t)
+		if err != nil {
+			return nil, err
+		}
+		stale = append(stale, t)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range stale {
+		// table names cannot be parameterized, but these come from hotTables
+		_, err = db.sql.ExecContext(ctx, fmt.Sprintf(`ANALYZE %s;`, pq.QuoteIdentifier(t)))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return stale, nil
+}
+
+// GetTableStats returns the size and estimated bloat of every table, largest
+// first. Bloat is estimated from the ratio of dead to live tuples
+func (db *DB) GetTableStats(ctx context.Context) ([]*hydrocarbon.TableStats, error) {
+	rows, err := db.sql.QueryContext(ctx, `
+	SELECT relname, pg_total_relation_size(relid), n_live_tup, n_dead_tup,
+		n_mod_since_analyze, greatest(last_analyze, last_autoanalyze),
+		greatest(last_vacuum, last_autovacuum)
+	FROM pg_stat_user_tables
+	ORDER BY pg_total_relation_size(relid) DESC;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make([]*hydrocarbon.TableStats, 0)
+	for rows.Next() {
+		var ts hydrocarbon.TableStats
+		var lastAnalyze, lastVacuum pq.NullTime
+		err = rows.Scan(&ts.Name, &ts.Size, &ts.LiveRows, &ts.DeadRows,
+			&ts.ModifiedSinceAnalyze, &lastAnalyze, &lastVacuum)
+		if err != nil {
+			return nil, err
+		}
+
+		if total := ts.LiveRows + ts.DeadRows; total > 0 {
+			ts.BloatRatio = float64(ts.DeadRows) / float64(total)
+			ts.EstimatedBloat = int64(float64(ts.Size) * ts.BloatRatio)
+		}
+
+		if lastAnalyze.Valid {
+			ts.LastAnalyzedAt = &lastAnalyze.Time
+		}
+
+		if lastVacuum.Valid {
+			ts.LastVacuumedAt = &lastVacuum.Time
+		}
+
+		stats = append(stats, &ts)
+	}
+
+	return stats, rows.Err()
+}
@@ -0,0 +1,140 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+// CreateNewsletterAddress adds a private feed to the folder and an address
+// delivering into it
+func (db *DB) CreateNewsletterAddress(ctx context.Context, sessionKey, folderID, title, token string) (a *hydrocarbon.NewsletterAddress, err error) {
+	if folderID == "" {
+		folderID, err = db.getDefaultFolderID(ctx, sessionKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	a = &hydrocarbon.NewsletterAddress{
+		Token: token,
+		Title: title,
+	}
+
+	err = db.withTx(ctx, func(tx *sql.Tx) error {
+		// newsletter feeds are never shared between users, so they are not public
+		err := tx.QueryRowContext(ctx, `
+		INSERT INTO feeds
+		(title, plugin, url, public)
+		VALUES ($1, $2, 'mailto:' || $3, false)
+		RETURNING id;`, title, hydrocarbon.NewsletterPlugin, token).Scan(&a.FeedID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+		INSERT INTO feed_folders
+		(user_id, folder_id, feed_id)
+		VALUES
+		((SELECT user_id FROM sessions WHERE key = $1), $2, $3);`, sessionKey, folderID, a.FeedID)
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, `
+		INSERT INTO newsletter_addresses
+		(user_id, feed_id, token)
+		VALUES
+		((SELECT user_id FROM sessions WHERE key = $1), $2, $3)
+		RETURNING id, created_at;`, sessionKey, a.FeedID, token).Scan(&a.ID, &a.CreatedAt)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	db.invalidateSession(ctx, sessionKey)
+	return a, nil
+}
+
+// ListNewsletterAddresses returns the newsletter addresses of the user, newest
+// first
+func (db *DB) ListNewsletterAddresses(ctx context.Context, sessionKey string) ([]*hydrocarbon.NewsletterAddress, error) {
+	rows, err := db.sql.QueryContext(ctx, `
+	SELECT na.id, na.created_at, na.token, na.feed_id, f.title
+	FROM newsletter_addresses na
+	JOIN feeds f ON (f.id = na.feed_id)
+	WHERE na.user_id = (SELECT user_id FROM sessions WHERE key = $1)
+	AND f.deleted_at IS NULL
+	ORDER BY na.created_at DESC;`, sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	as := make([]*hydrocarbon.NewsletterAddress, 0)
+	for rows.Next() {
+		var a hydrocarbon.NewsletterAddress
+		err = rows.Scan(&a.ID, &a.CreatedAt, &a.Token, &a.FeedID, &a.Title)
+		if err != nil {
+			return nil, err
+		}
+
+		as = append(as, &a)
+	}
+
+	return as, rows.Err()
+}
+
+// DeleteNewsletterAddress deletes an address of the user, leaving its feed
+func (db *DB) DeleteNewsletterAddress(ctx context.Context, sessionKey, id string) error {
+	res, err := db.sql.ExecContext(ctx, `
+	DELETE FROM newsletter_addresses
+	WHERE id = $2
+	AND user_id = (SELECT user_id FROM sessions WHERE key = $1);`, sessionKey, id)
+	if err != nil {
+		return err
+	}
+
+	return expectRows(res, "newsletter address not found")
+}
+
+// DeliverNewsletter adds a post to the feed of the address token, mail already
+// delivered to it is skipped. The url and content hash of posts are unique
+// within their scope, so mail is scoped to the feed, as the same newsletter is
+// sent to the addresses of many users
+func (db *DB) DeliverNewsletter(ctx context.Context, token string, p *hydrocarbon.Post) (bool, error) {
+	body, err := db.prepareBody(ctx, p.Body)
+	if err != nil {
+		return false, err
+	}
+
+	var postID, feedID string
+	err = db.withTx(ctx, func(tx *sql.Tx) error {
+		err := db.insertBody(ctx, tx, body)
+		if err != nil {
+			return err
+		}
+
+		return tx.QueryRowContext(ctx, `
+		INSERT INTO posts
+		(id, feed_id, content_hash, title, author, body, body_hash, url, posted_at, simhash, search_body, scope)
+		SELECT $10, na.feed_id, $2, $3, $4, '', $5, $6, $7, $8, $9, na.feed_id::text
+		FROM newsletter_addresses na
+		WHERE na.token = $1
+		ON CONFLICT DO NOTHING
+		RETURNING id, feed_id;`,
+			token, p.ContentHash(), p.Title, p.Author, body.hash, p.OriginalURL, p.PostedAt, int64(p.SimHash()), db.searchBody(p.Body), hydrocarbon.NewID()).Scan(&postID, &feedID)
+	})
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	db.transform(ctx, postID, feedID, p)
+	db.invalidateFeeds(ctx, feedID)
+	return true, nil
+}
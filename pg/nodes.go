@@ -0,0 +1,68 @@
+package pg
+
+import (
+	"context"
+	"time"
+
+	"github.com/fortytw2/hydrocarbon/discollect"
+)
+
+// Heartbeat registers or refreshes a node and returns whether it should drain
+func (db *DB) Heartbeat(ctx context.Context, n *discollect.Node) (bool, error) {
+	row := db.sql.QueryRowContext(ctx, `
+	INSERT INTO nodes
+	(id, hostname, version, started_at, heartbeat_at, workers, load)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (id) DO UPDATE
+	SET (heartbeat_at, workers, load) = (EXCLUDED.heartbeat_at, EXCLUDED.workers, EXCLUDED.load)
+	RETURNING draining;`, n.ID, n.Hostname, n.Version, n.StartedAt, n.HeartbeatAt, n.Workers, n.Load)
+
+	var draining bool
+	err := row.Scan(&draining)
+	if err != nil {
+		return false, err
+	}
+
+	return draining, nil
+}
+
+// ListNodes returns every node that has heartbeated within the given window,
+// most recently started first
+func (db *DB) ListNodes(ctx context.Context, within time.Duration) ([]*discollect.Node, error) {
+	rows, err := db.sql.QueryContext(ctx, `
+	SELECT id, hostname, version, started_at, heartbeat_at, workers, load, draining
+	FROM nodes
+	WHERE heartbeat_at > now() - $1 * interval '1 second'
+	ORDER BY started_at DESC;`, within.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nodes := make([]*discollect.Node, 0)
+	for rows.Next() {
+		var n discollect.Node
+		err = rows.Scan(&n.ID, &n.Hostname, &n.Version, &n.StartedAt, &n.HeartbeatAt, &n.Workers, &n.Load, &n.Draining)
+		if err != nil {
+			return nil, err
+		}
+
+		nodes = append(nodes, &n)
+	}
+
+	return nodes, rows.Err()
+}
+
+// SetNodeDraining drains or resumes a node, which picks up the change on its
+// next heartbeat
+func (db *DB) SetNodeDraining(ctx context.Context, id string, draining bool) error {
+	res, err := db.sql.ExecContext(ctx, `
+	UPDATE nodes
+	SET draining = $1
+	WHERE id = $2;`, draining, id)
+	if err != nil {
+		return err
+	}
+
+	return expectRows(res, "no node exists with that id")
+}
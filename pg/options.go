@@ -0,0 +1,189 @@
+package pg
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// An OptionFn is used to pass options to NewDB
+type OptionFn func(o *options) error
+
+type options struct {
+	replicaDSNs   []string
+	maxReplicaLag time.Duration
+
+	// every query is timed into metrics, if set, those taking at least
+	// slowQuery are logged
+	metrics   *queryMetrics
+	slowQuery time.Duration
+
+	// zero leaves the database/sql default in place
+	maxOpenConns    int
+	maxIdleConns    int
+	connMaxLifetime time.Duration
+
+	// statementTimeout is set on every connection, zero is no timeout
+	statementTimeout time.Duration
+
+	// statements switch to the schema of their tenant if tenants is set,
+	// that of tenant when their context has none
+	tenants bool
+	tenant  string
+}
+
+// WithReplicas reads what can tolerate replication lag from the read replicas
+// at dsns, see queryRead
+func WithReplicas(dsns ...string) OptionFn {
+	return func(o *options) error {
+		o.replicaDSNs = append(o.replicaDSNs, dsns...)
+		return nil
+	}
+}
+
+// WithMaxReplicaLag leaves replicas further behind the primary than d out of
+// reads until they catch up. Zero reads from them however far behind they are
+func WithMaxReplicaLag(d time.Duration) OptionFn {
+	return func(o *options) error {
+		if d < 0 {
+			return errors.New("pg: max replica lag cannot be negative")
+		}
+
+		o.maxReplicaLag = d
+		return nil
+	}
+}
+
+// WithSlowQueryLog logs every query that takes at least d, with the values of
+// its parameters redacted. Zero disables it
+func WithSlowQueryLog(d time.Duration) OptionFn {
+	return func(o *options) error {
+		if d < 0 {
+			return errors.New("pg: slow query threshold cannot be negative")
+		}
+
+		o.slowQuery = d
+		return nil
+	}
+}
+
+// WithMaxOpenConns limits the connections open to each of the primary and
+// every replica, queries wait for a free connection once they are all in use
+func WithMaxOpenConns(n int) OptionFn {
+	return func(o *options) error {
+		if n < 0 {
+			return errors.New("pg: max open connections cannot be negative")
+		}
+
+		o.maxOpenConns = n
+		return nil
+	}
+}
+
+// WithMaxIdleConns sets how many unused connections are kept open to each of
+// the primary and every replica
+func WithMaxIdleConns(n int) OptionFn {
+	return func(o *options) error {
+		if n < 0 {
+			return errors.New("pg: max idle connections cannot be negative")
+		}
+
+		o.maxIdleConns = n
+		return nil
+	}
+}
+
+// WithConnMaxLifetime closes connections once they have been open for d, so
+// they are spread over servers behind a load balancer or pooler again
+func WithConnMaxLifetime(d time.Duration) OptionFn {
+	return func(o *options) error {
+		if d < 0 {
+			return errors.New("pg: connection lifetime cannot be negative")
+		}
+
+		o.connMaxLifetime = d
+		return nil
+	}
+}
+
+// WithStatementTimeout has postgres cancel any statement that runs for longer
+// than d. Migrations are not limited by it
+func WithStatementTimeout(d time.Duration) OptionFn {
+	return func(o *options) error {
+		if d < 0 {
+			return errors.New("pg: statement timeout cannot be negative")
+		}
+
+		o.statementTimeout = d
+		return nil
+	}
+}
+
+// WithTenants runs every statement in the schema of the tenant of its context,
+// see TenantContext, or of tenant for contexts without one. An empty tenant is
+// the public schema, where hydrocarbon keeps everything without tenants
+func WithTenants(tenant string) OptionFn {
+	return func(o *options) error {
+		if tenant != "" && !tenantName.MatchString(tenant) {
+			return fmt.Errorf("pg: invalid tenant name %q", tenant)
+		}
+
+		o.tenants = true
+		o.tenant = tenant
+		return nil
+	}
+}
+
+// session returns the statements run on every new connection
+func (o *options) session() []string {
+	var stmts []string
+	if o.statementTimeout > 0 {
+		stmts = append(stmts, fmt.Sprintf(`SET statement_timeout = %d;`, o.statementTimeout.Milliseconds()))
+	}
+
+	return stmts
+}
+
+// sessionConnector opens connections to postgres and runs init on each before
+// it is used, settings made with SET only last as long as their connection.
+// Every version of lib/pq hands back its connector as a driver.Connector
+type sessionConnector struct {
+	driver.Connector
+	init []string
+}
+
+func newSessionConnector(dsn string, init []string) (*sessionConnector, error) {
+	c, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sessionConnector{Connector: c, init: init}, nil
+}
+
+func (c *sessionConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok && len(c.init) > 0 {
+		conn.Close()
+		return nil, errors.New("pg: connections can not run statements when opened")
+	}
+
+	for _, stmt := range c.init {
+		_, err = execer.ExecContext(ctx, stmt, nil)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,35 @@
+package pg
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOptionsSession(t *testing.T) {
+	t.Parallel()
+
+	o := &options{}
+	for _, opt := range []OptionFn{WithStatementTimeout(1500 * time.Millisecond), WithSlowQueryLog(time.Second)} {
+		err := opt(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []string{
+		`SET statement_timeout = 1500;`,
+	}
+	if got := o.session(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	if got := (&options{}).session(); len(got) != 0 {
+		t.Fatalf("expected no session statements by default, got %v", got)
+	}
+
+	err := WithMaxOpenConns(-1)(o)
+	if err == nil {
+		t.Fatal("expected a negative connection limit to be refused")
+	}
+}
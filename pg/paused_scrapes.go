@@ -0,0 +1,121 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+
+	"github.com/fortytw2/hydrocarbon/discollect"
+)
+
+// PauseScrape moves a running scrape to PAUSED and saves its pending tasks
+func (db *DB) PauseScrape(ctx context.Context, id uuid.UUID, tasks []*discollect.QueuedTask, status *discollect.ScrapeStatus) error {
+	return db.saveTasks(ctx, id, `
+	UPDATE scrapes
+	SET state = 'PAUSED', progress = $2
+	WHERE id = $1
+	AND state = 'RUNNING';`, tasks, status)
+}
+
+// HandBackScrape moves a running scrape back to WAITING and saves its pending
+// tasks, StartScrapes hands them back once it is started again
+func (db *DB) HandBackScrape(ctx context.Context, id uuid.UUID, tasks []*discollect.QueuedTask, status *discollect.ScrapeStatus) error {
+	return db.saveTasks(ctx, id, `
+	UPDATE scrapes
+	SET state = 'WAITING', scheduled_start_at = now(), progress = $2
+	WHERE id = $1
+	AND state = 'RUNNING';`, tasks, status)
+}
+
+// saveTasks runs update, which moves a running scrape out of RUNNING given its
+// id and status, and saves its pending tasks
+func (db *DB) saveTasks(ctx context.Context, id uuid.UUID, update string, tasks []*discollect.QueuedTask, status *discollect.ScrapeStatus) error {
+	tasksJSON, err := json.Marshal(tasks)
+	if err != nil {
+		return err
+	}
+
+	statusJSON, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	return db.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, update, id, statusJSON)
+		if err != nil {
+			return err
+		}
+
+		err = expectRows(res, "scrape is not running")
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+		INSERT INTO paused_tasks
+		(scrape_id, tasks, status)
+		VALUES
+		($1, $2, $3)
+		ON CONFLICT (scrape_id) DO UPDATE SET paused_at = now(), tasks = EXCLUDED.tasks, status = EXCLUDED.status;`, id, tasksJSON, statusJSON)
+		return err
+	})
+}
+
+// GetPausedTasks returns the tasks saved when a scrape was paused
+func (db *DB) GetPausedTasks(ctx context.Context, id uuid.UUID) ([]*discollect.QueuedTask, *discollect.ScrapeStatus, error) {
+	row := db.sql.QueryRowContext(ctx, `
+	SELECT pt.tasks, pt.status
+	FROM paused_tasks pt
+	JOIN scrapes sc ON (sc.id = pt.scrape_id)
+	WHERE pt.scrape_id = $1
+	AND sc.state = 'PAUSED';`, id)
+
+	var tasksJSON, statusJSON []byte
+	err := row.Scan(&tasksJSON, &statusJSON)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, errors.New("scrape is not paused")
+		}
+		return nil, nil, err
+	}
+
+	var tasks []*discollect.QueuedTask
+	err = json.Unmarshal(tasksJSON, &tasks)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var status discollect.ScrapeStatus
+	err = json.Unmarshal(statusJSON, &status)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tasks, &status, nil
+}
+
+// ResumeScrape moves a paused scrape back to RUNNING, time spent paused does
+// not count towards how long it may run
+func (db *DB) ResumeScrape(ctx context.Context, id uuid.UUID) error {
+	return db.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+		UPDATE scrapes
+		SET state = 'RUNNING', started_at = now()
+		WHERE id = $1
+		AND state = 'PAUSED';`, id)
+		if err != nil {
+			return err
+		}
+
+		err = expectRows(res, "scrape is not paused")
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM paused_tasks WHERE scrape_id = $1;`, id)
+		return err
+	})
+}
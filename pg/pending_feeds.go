@@ -0,0 +1,169 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/fortytw2/hydrocarbon"
+	"github.com/fortytw2/hydrocarbon/discollect"
+)
+
+// AddPendingFeed adds a feed that has not been resolved to a plugin yet to the
+// given folder, users adding the same url share a single pending feed
+func (db *DB) AddPendingFeed(ctx context.Context, sessionKey, folderID, feedURL string) (id string, err error) {
+	if folderID == "" {
+		folderID, err = db.getDefaultFolderID(ctx, sessionKey)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = db.withTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `
+		SELECT id FROM feeds WHERE status = 'pending' AND url = $1 LIMIT 1;`, feedURL).Scan(&id)
+		if err == sql.ErrNoRows {
+			err = tx.QueryRowContext(ctx, `
+			INSERT INTO feeds
+			(title, plugin, url, status)
+			VALUES ($1, '', $1, 'pending')
+			RETURNING id;`, feedURL).Scan(&id)
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+		INSERT INTO feed_folders
+		(user_id, folder_id, feed_id)
+		VALUES
+		((SELECT user_id FROM sessions WHERE key = $1), $2, $3)
+		ON CONFLICT DO NOTHING;`, sessionKey, folderID, id)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	db.invalidateSession(ctx, sessionKey)
+	return id, nil
+}
+
+// ListPendingFeeds returns the oldest feeds waiting to be resolved
+func (db *DB) ListPendingFeeds(ctx context.Context, limit int) ([]*hydrocarbon.PendingFeed, error) {
+	rows, err := db.sql.QueryContext(ctx, `
+	SELECT id, url, resolve_attempts
+	FROM feeds
+	WHERE status = 'pending'
+	ORDER BY created_at ASC
+	LIMIT $1;`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pending []*hydrocarbon.PendingFeed
+	for rows.Next() {
+		var pf hydrocarbon.PendingFeed
+		err = rows.Scan(&pf.ID, &pf.URL, &pf.Attempts)
+		if err != nil {
+			return nil, err
+		}
+
+		pending = append(pending, &pf)
+	}
+
+	return pending, rows.Err()
+}
+
+// ResolvePendingFeed turns a pending feed into a regular one and schedules its
+// first scrape. If the resolved feed already exists, its followers are moved
+// to it and the pending feed is removed
+func (db *DB) ResolvePendingFeed(ctx context.Context, id, title, plugin, feedURL, externalID string, initialConfig *discollect.Config) error {
+	resolvedID := id
+	err := db.withTx(ctx, func(tx *sql.Tx) error {
+		var existingID string
+		err := tx.QueryRowContext(ctx, `
+		SELECT id FROM feeds
+		WHERE plugin = $1
+		AND (url = $2 OR external_id = NULLIF($3, ''))
+		AND public
+		ORDER BY external_id IS NULL
+		LIMIT 1;`, plugin, feedURL, externalID).Scan(&existingID)
+		switch err {
+		case sql.ErrNoRows:
+			var res sql.Result
+			res, err = tx.ExecContext(ctx, `
+			UPDATE feeds
+			SET (title, plugin, url, external_id, status, resolve_error) = ($2, $3, $4, NULLIF($5, ''), 'active', '')
+			WHERE id = $1
+			AND status = 'pending';`, id, title, plugin, feedURL, externalID)
+			if err != nil {
+				return err
+			}
+
+			err = expectRows(res, "feed is no longer pending")
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, `
+			INSERT INTO scrapes
+			(id, feed_id, plugin, config, priority)
+			VALUES 
+			($5, $1, $2, $3, $4)`, id, plugin, initialConfig, int(discollect.PriorityInteractive), hydrocarbon.NewID())
+			if err != nil {
+				return err
+			}
+		case nil:
+			resolvedID = existingID
+			_, err = tx.ExecContext(ctx, `
+			INSERT INTO feed_folders
+			(user_id, folder_id, feed_id)
+			SELECT user_id, folder_id, $2 FROM feed_folders WHERE feed_id = $1
+			ON CONFLICT DO NOTHING;`, id, existingID)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, `
+			DELETE FROM feed_folders WHERE feed_id = $1;`, id)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, `
+			DELETE FROM feeds WHERE id = $1 AND status = 'pending';`, id)
+			if err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	db.invalidateFeeds(ctx, resolvedID)
+	return nil
+}
+
+// FailPendingFeed records a failed attempt to resolve a pending feed, final
+// stops any further attempts
+func (db *DB) FailPendingFeed(ctx context.Context, id, reason string, final bool) error {
+	_, err := db.sql.ExecContext(ctx, `
+	UPDATE feeds
+	SET resolve_attempts = resolve_attempts + 1,
+		resolve_error = $2,
+		status = CASE WHEN $3 THEN 'failed' ELSE status END
+	WHERE id = $1
+	AND status = 'pending';`, id, reason, final)
+	if err != nil || !final {
+		return err
+	}
+
+	db.invalidateFeeds(ctx, id)
+	return nil
+}
@@ -0,0 +1,55 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// GetPaymentPlanID returns the payment provider plan the named plan is billed
+// as
+func (db *DB) GetPaymentPlanID(ctx context.Context, name string) (string, error) {
+	row := db.sql.QueryRowContext(ctx, `
+	SELECT payment_plan_id FROM plans WHERE name = $1;`, name)
+
+	var planID sql.NullString
+	err := row.Scan(&planID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("no plan named %s exists", name)
+		}
+		return "", err
+	}
+
+	if !planID.Valid {
+		return "", fmt.Errorf("the %s plan cannot be subscribed to", name)
+	}
+
+	return planID.String, nil
+}
+
+// SetPlan moves a user to the named plan. Waiting scrapes of the feeds only
+// they follow are removed so they are rescheduled against the new scrape
+// interval, those of feeds others also follow are left as they are, as how
+// often they are scraped depends on the plans of every follower
+func (db *DB) SetPlan(ctx context.Context, userID, name string) error {
+	return db.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+		UPDATE users SET plan = $1 WHERE id = $2;`, name, userID)
+		if err != nil {
+			return err
+		}
+
+		err = expectRows(res, "user does not exist")
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+		DELETE FROM scrapes
+		WHERE state = 'WAITING'
+		AND feed_id IN (SELECT feed_id FROM feed_folders WHERE user_id = $1)
+		AND NOT EXISTS (SELECT 1 FROM feed_folders WHERE feed_id = scrapes.feed_id AND user_id <> $1);`, userID)
+		return err
+	})
+}
@@ -0,0 +1,106 @@
+package pg
+
+import (
+	"context"
+	"time"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+// QualitySampled returns true if quality metrics exist for the given day
+func (db *DB) QualitySampled(ctx context.Context, day time.Time) (bool, error) {
+	var sampled bool
+	err := db.sql.QueryRowContext(ctx, `
+	SELECT EXISTS (SELECT 1 FROM plugin_quality WHERE day = $1::date);`, day).Scan(&sampled)
+	return sampled, err
+}
+
+// SamplePosts returns up to n random posts per plugin created in the 24 hours
+// after day
+func (db *DB) SamplePosts(ctx context.Context, day time.Time, n int) (map[string][]*hydrocarbon.Post, error) {
+	rows, err := db.sql.QueryContext(ctx, `
+	SELECT plugin, title, author, body FROM (
+		SELECT f.plugin, po.title, po.author, COALESCE(pb.body, po.body) AS body,
+			row_number() OVER (PARTITION BY f.plugin ORDER BY random()) AS n
+		FROM posts po
+		LEFT JOIN post_bodies pb ON (pb.hash = po.body_hash)
+		JOIN feeds f ON (f.id = po.feed_id)
+		WHERE po.created_at >= $1
+		AND po.created_at < $1 + interval '1 day'
+	) sampled
+	WHERE n <= $2;`, day, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := make(map[string][]*hydrocarbon.Post)
+	for rows.Next() {
+		var plugin, compressedBody string
+		var p hydrocarbon.Post
+
+		err = rows.Scan(&plugin, &p.Title, &p.Author, &compressedBody)
+		if err != nil {
+			return nil, err
+		}
+
+		p.Body, err = db.loadBody(ctx, compressedBody)
+		if err != nil {
+			return nil, err
+		}
+
+		posts[plugin] = append(posts[plugin], &p)
+	}
+
+	return posts, rows.Err()
+}
+
+// RecordQuality saves quality metrics, replacing any already recorded for the
+// same plugin and day
+func (db *DB) RecordQuality(ctx context.Context, pq []*hydrocarbon.PluginQuality) error {
+	for _, q := range pq {
+		_, err := db.sql.ExecContext(ctx, `
+		INSERT INTO plugin_quality
+		(plugin, day, samples, body_length_p10, body_length_p50, body_length_p90, link_density, empty_author_rate)
+		VALUES
+		($1, $2::date, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (plugin, day) DO UPDATE SET samples = EXCLUDED.samples,
+			body_length_p10 = EXCLUDED.body_length_p10, body_length_p50 = EXCLUDED.body_length_p50,
+			body_length_p90 = EXCLUDED.body_length_p90, link_density = EXCLUDED.link_density,
+			empty_author_rate = EXCLUDED.empty_author_rate;`,
+			q.Plugin, q.Day, q.Samples, q.BodyLengthP10, q.BodyLengthP50, q.BodyLengthP90, q.LinkDensity, q.EmptyAuthorRate)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetQualityTrend returns the daily quality metrics recorded since the given
+// time, oldest first, optionally only for a single plugin
+func (db *DB) GetQualityTrend(ctx context.Context, since time.Time, plugin string) ([]*hydrocarbon.PluginQuality, error) {
+	rows, err := db.sql.QueryContext(ctx, `
+	SELECT plugin, day, samples, body_length_p10, body_length_p50, body_length_p90, link_density, empty_author_rate
+	FROM plugin_quality
+	WHERE day >= $1::date
+	AND ($2 = '' OR plugin = $2)
+	ORDER BY day ASC, plugin ASC;`, since, plugin)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trend := make([]*hydrocarbon.PluginQuality, 0)
+	for rows.Next() {
+		var q hydrocarbon.PluginQuality
+		err = rows.Scan(&q.Plugin, &q.Day, &q.Samples, &q.BodyLengthP10, &q.BodyLengthP50, &q.BodyLengthP90, &q.LinkDensity, &q.EmptyAuthorRate)
+		if err != nil {
+			return nil, err
+		}
+
+		trend = append(trend, &q)
+	}
+
+	return trend, rows.Err()
+}
@@ -0,0 +1,214 @@
+package pg
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// queryBuckets are the upper bounds, in seconds, of the query duration
+// histogram buckets
+var queryBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// maxQueries bounds how many distinct queries are tracked, any beyond are
+// counted together as "other", as queries built at runtime would otherwise
+// grow the metrics without end
+const maxQueries = 500
+
+// queryMetrics records how long every query took, by query
+type queryMetrics struct {
+	// queries taking at least slow are logged, disabled when zero
+	slow time.Duration
+
+	mu      sync.Mutex
+	queries map[string]*queryHistogram
+}
+
+type queryHistogram struct {
+	// counts[i] is how many queries took at most queryBuckets[i]
+	counts []uint64
+	count  uint64
+	sum    float64
+	errors uint64
+}
+
+func newQueryMetrics(slow time.Duration) *queryMetrics {
+	return &queryMetrics{
+		slow:    slow,
+		queries: make(map[string]*queryHistogram),
+	}
+}
+
+// observe records a query that took d, args are only used to describe it in
+// the slow query log, their values are never logged
+func (qm *queryMetrics) observe(query string, args []driver.NamedValue, d time.Duration, err error) {
+	query = strings.Join(strings.Fields(query), " ")
+
+	if qm.slow > 0 && d >= qm.slow {
+		log.Printf("pg: slow query took %s, args %s: %s", d, redactArgs(args), query)
+	}
+
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	h, ok := qm.queries[query]
+	if !ok && len(qm.queries) >= maxQueries {
+		query = "other"
+		h, ok = qm.queries[query]
+	}
+	if !ok {
+		h = &queryHistogram{counts: make([]uint64, len(queryBuckets))}
+		qm.queries[query] = h
+	}
+
+	secs := d.Seconds()
+	for i, le := range queryBuckets {
+		if secs <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += secs
+	if err != nil {
+		h.errors++
+	}
+}
+
+// redactArgs describes query arguments by their position and type alone, so
+// slow queries can be logged without leaking what they were given
+func redactArgs(args []driver.NamedValue) string {
+	described := make([]string, len(args))
+	for i, a := range args {
+		if a.Value == nil {
+			described[i] = fmt.Sprintf("$%d=NULL", a.Ordinal)
+			continue
+		}
+
+		described[i] = fmt.Sprintf("$%d=<%T>", a.Ordinal, a.Value)
+	}
+
+	return "[" + strings.Join(described, " ") + "]"
+}
+
+// WriteQueryMetrics writes the duration histogram and error count of every
+// query made through the database in the prometheus text format
+func (db *DB) WriteQueryMetrics(w io.Writer) error {
+	if db.queries == nil {
+		return nil
+	}
+
+	return db.queries.write(w)
+}
+
+func (qm *queryMetrics) write(w io.Writer) error {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	queries := make([]string, 0, len(qm.queries))
+	for q := range qm.queries {
+		queries = append(queries, q)
+	}
+	sort.Strings(queries)
+
+	var b strings.Builder
+	b.WriteString("# HELP hydrocarbon_pg_query_duration_seconds How long postgres took to run each query, until its first rows were returned.\n")
+	b.WriteString("# TYPE hydrocarbon_pg_query_duration_seconds histogram\n")
+	for _, q := range queries {
+		h := qm.queries[q]
+		label := quoteLabel(q)
+		for i, le := range queryBuckets {
+			fmt.Fprintf(&b, "hydrocarbon_pg_query_duration_seconds_bucket{query=%s,le=\"%g\"} %d\n", label, le, h.counts[i])
+		}
+		fmt.Fprintf(&b, "hydrocarbon_pg_query_duration_seconds_bucket{query=%s,le=\"+Inf\"} %d\n", label, h.count)
+		fmt.Fprintf(&b, "hydrocarbon_pg_query_duration_seconds_sum{query=%s} %g\n", label, h.sum)
+		fmt.Fprintf(&b, "hydrocarbon_pg_query_duration_seconds_count{query=%s} %d\n", label, h.count)
+	}
+
+	b.WriteString("# HELP hydrocarbon_pg_query_errors_total Queries postgres returned an error for.\n")
+	b.WriteString("# TYPE hydrocarbon_pg_query_errors_total counter\n")
+	for _, q := range queries {
+		fmt.Fprintf(&b, "hydrocarbon_pg_query_errors_total{query=%s} %d\n", quoteLabel(q), qm.queries[q].errors)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// quoteLabel quotes a label value, queries have had their newlines collapsed
+func quoteLabel(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+}
+
+// metricsConnector times every query made on the connections it opens
+type metricsConnector struct {
+	driver.Connector
+	metrics *queryMetrics
+}
+
+func (c *metricsConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &metricsConn{Conn: conn, metrics: c.metrics}, nil
+}
+
+// metricsConn times the queries and execs made on a connection to postgres,
+// statements prepared explicitly, such as those of COPY, are not timed.
+// Everything else is passed through to the pq connection, which implements
+// each of these interfaces
+type metricsConn struct {
+	driver.Conn
+	metrics *queryMetrics
+}
+
+func (c *metricsConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		c.metrics.observe(query, args, time.Since(start), err)
+	}
+
+	return rows, err
+}
+
+func (c *metricsConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	res, err := c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		c.metrics.observe(query, args, time.Since(start), err)
+	}
+
+	return res, err
+}
+
+func (c *metricsConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.Conn.(driver.ConnPrepareContext).PrepareContext(ctx, query)
+}
+
+func (c *metricsConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+func (c *metricsConn) Ping(ctx context.Context) error {
+	return c.Conn.(driver.Pinger).Ping(ctx)
+}
+
+func (c *metricsConn) ResetSession(ctx context.Context) error {
+	return c.Conn.(driver.SessionResetter).ResetSession(ctx)
+}
+
+func (c *metricsConn) IsValid() bool {
+	return c.Conn.(driver.Validator).IsValid()
+}
+
+func (c *metricsConn) CheckNamedValue(nv *driver.NamedValue) error {
+	return c.Conn.(driver.NamedValueChecker).CheckNamedValue(nv)
+}
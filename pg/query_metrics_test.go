@@ -0,0 +1,67 @@
+package pg
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryMetrics(t *testing.T) {
+	t.Parallel()
+
+	qm := newQueryMetrics(0)
+	qm.observe("SELECT 1\n\tFROM posts", nil, 3*time.Millisecond, nil)
+	qm.observe("SELECT 1 FROM posts", nil, 2*time.Second, errors.New("canceled"))
+	qm.observe(`SELECT "title" FROM posts`, nil, time.Millisecond, nil)
+
+	var b strings.Builder
+	err := qm.write(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{
+		`hydrocarbon_pg_query_duration_seconds_bucket{query="SELECT 1 FROM posts",le="0.005"} 1`,
+		`hydrocarbon_pg_query_duration_seconds_bucket{query="SELECT 1 FROM posts",le="2.5"} 2`,
+		`hydrocarbon_pg_query_duration_seconds_bucket{query="SELECT 1 FROM posts",le="+Inf"} 2`,
+		`hydrocarbon_pg_query_duration_seconds_count{query="SELECT 1 FROM posts"} 2`,
+		`hydrocarbon_pg_query_errors_total{query="SELECT 1 FROM posts"} 1`,
+		`hydrocarbon_pg_query_duration_seconds_count{query="SELECT \"title\" FROM posts"} 1`,
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Fatalf("expected metrics to have %s, got\n%s", line, b.String())
+		}
+	}
+
+	// queries past the limit are counted together
+	for i := 0; i < maxQueries; i++ {
+		qm.observe("SELECT "+strings.Repeat("1", i+2), nil, time.Millisecond, nil)
+	}
+	if len(qm.queries) != maxQueries+1 {
+		t.Fatalf("expected %d queries tracked, got %d", maxQueries+1, len(qm.queries))
+	}
+	if qm.queries["other"] == nil {
+		t.Fatal("expected queries past the limit to be counted as other")
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	t.Parallel()
+
+	got := redactArgs([]driver.NamedValue{
+		{Ordinal: 1, Value: "hunter2@example.com"},
+		{Ordinal: 2, Value: int64(42)},
+		{Ordinal: 3, Value: nil},
+	})
+
+	if strings.Contains(got, "hunter2") || strings.Contains(got, "42") {
+		t.Fatalf("argument values were not redacted: %s", got)
+	}
+
+	expected := "[$1=<string> $2=<int64> $3=NULL]"
+	if got != expected {
+		t.Fatalf("expected %s, got %s", expected, got)
+	}
+}
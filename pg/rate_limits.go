@@ -0,0 +1,54 @@
+package pg
+
+import (
+	"context"
+	"time"
+)
+
+// slots that ended longer ago than this are deleted by the Maintainer, they
+// no longer hold anything back
+const rateLimitRetention = time.Hour
+
+// ReserveSlot implements discollect.LimiterStore, the slot is taken in a single
+// statement so nodes sharing the database never hand out the same one
+func (db *DB) ReserveSlot(ctx context.Context, domain string, interval time.Duration) (time.Duration, time.Time, error) {
+	var end time.Time
+	var delay float64
+	err := db.sql.QueryRowContext(ctx, `
+	INSERT INTO host_rate_limits (domain, next_at)
+	VALUES ($1, now() + $2 * interval '1 second')
+	ON CONFLICT (domain) DO UPDATE
+	SET next_at = greatest(host_rate_limits.next_at, now()) + $2 * interval '1 second'
+	RETURNING next_at, extract(epoch FROM next_at - now()) - $2;`, domain, interval.Seconds()).Scan(&end, &delay)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	if delay < 0 {
+		delay = 0
+	}
+
+	return time.Duration(delay * float64(time.Second)), end, nil
+}
+
+// CancelSlot implements discollect.LimiterStore
+func (db *DB) CancelSlot(ctx context.Context, domain string, end time.Time, interval time.Duration) error {
+	_, err := db.sql.ExecContext(ctx, `
+	UPDATE host_rate_limits
+	SET next_at = next_at - $3 * interval '1 second'
+	WHERE domain = $1 AND next_at = $2;`, domain, end, interval.Seconds())
+	return err
+}
+
+// PruneRateLimits deletes the slots of domains that have not been requested
+// since olderThan ago, returning how many were deleted
+func (db *DB) PruneRateLimits(ctx context.Context, olderThan time.Duration) (int64, error) {
+	res, err := db.sql.ExecContext(ctx, `
+	DELETE FROM host_rate_limits
+	WHERE next_at < now() - $1 * interval '1 second';`, olderThan.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
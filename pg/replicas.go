@@ -0,0 +1,173 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/XSAM/otelsql"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// replicaCooldown is how long a replica that failed a query is left out of
+// reads before it is tried again
+const replicaCooldown = 30 * time.Second
+
+// lagCheckInterval is how often the lag of a replica is measured while it is
+// read from
+const lagCheckInterval = 10 * time.Second
+
+// A replica is a read-only copy of the primary, kept up to date by streaming
+// replication
+type replica struct {
+	sql *sql.DB
+	// downUntil is when, in unix nanoseconds, the replica is next tried
+	downUntil int64
+
+	// replicas further behind the primary than maxLag are left out of reads
+	// until they catch up, zero never measures their lag
+	maxLag time.Duration
+	// lagCheckedAt is when, in unix nanoseconds, the lag was last measured,
+	// and lagging is 1 if it was then further behind than maxLag
+	lagCheckedAt int64
+	lagging      int32
+}
+
+// lag returns how far behind the primary the replica is, in seconds. The time
+// since the last replayed transaction is only lag while there is more to
+// replay, an idle primary sends nothing new
+func (r *replica) lag(ctx context.Context) (float64, error) {
+	var lag float64
+	err := r.sql.QueryRowContext(ctx, `
+	SELECT CASE
+		WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+	END;`).Scan(&lag)
+	return lag, err
+}
+
+// setLag records the lag of the replica, leaving it out of reads while it is
+// further behind than maxLag
+func (r *replica) setLag(lag float64) {
+	var lagging int32
+	if r.maxLag > 0 && lag > r.maxLag.Seconds() {
+		lagging = 1
+	}
+
+	if atomic.SwapInt32(&r.lagging, lagging) != lagging && lagging == 1 {
+		log.Printf("pg: replica is %.1fs behind, reading from the others until it catches up", lag)
+	}
+}
+
+// behind returns true if the replica was further behind than maxLag when its
+// lag was last measured, measuring it again once lagCheckInterval has passed.
+// Only one caller measures it at a time, the others use the last measurement
+func (r *replica) behind(ctx context.Context) bool {
+	if r.maxLag <= 0 {
+		return false
+	}
+
+	checked := atomic.LoadInt64(&r.lagCheckedAt)
+	now := time.Now().UnixNano()
+	if now-checked >= int64(lagCheckInterval) && atomic.CompareAndSwapInt64(&r.lagCheckedAt, checked, now) {
+		// a replica that can not be measured is left to fail the read
+		lag, err := r.lag(ctx)
+		if err == nil {
+			r.setLag(lag)
+		}
+	}
+
+	return atomic.LoadInt32(&r.lagging) == 1
+}
+
+// openDB opens a connection pool to dsn sized by o, every query made through it
+// is traced and, if o has metrics, timed
+func openDB(dsn string, o *options) (*sql.DB, error) {
+	var c driver.Connector
+	c, err := newSessionConnector(dsn, o.session())
+	if err != nil {
+		return nil, err
+	}
+
+	if o.tenants {
+		c = &tenantConnector{Connector: c, tenant: o.tenant}
+	}
+
+	if o.metrics != nil {
+		c = &metricsConnector{Connector: c, metrics: o.metrics}
+	}
+
+	db := otelsql.OpenDB(c,
+		otelsql.WithAttributes(attribute.String("db.system", "postgresql")),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitConnResetSession: true,
+			OmitRows:             true,
+		}),
+	)
+
+	if o.maxOpenConns > 0 {
+		db.SetMaxOpenConns(o.maxOpenConns)
+	}
+	if o.maxIdleConns > 0 {
+		db.SetMaxIdleConns(o.maxIdleConns)
+	}
+	if o.connMaxLifetime > 0 {
+		db.SetConnMaxLifetime(o.connMaxLifetime)
+	}
+
+	return db, nil
+}
+
+// queryRead runs a read-only query on the next replica, replicas take turns.
+// If a replica cannot run it the others are tried, then the primary, so reads
+// only fail when the primary does. Replicas further behind than the max lag
+// are skipped too, but reads from one may still not see the latest writes
+func (db *DB) queryRead(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	n := len(db.replicas)
+	if n > 0 {
+		start := int(atomic.AddUint32(&db.nextReplica, 1))
+		for i := 0; i < n; i++ {
+			r := db.replicas[(start+i)%n]
+			if atomic.LoadInt64(&r.downUntil) > time.Now().UnixNano() || r.behind(ctx) {
+				continue
+			}
+
+			rows, err := r.sql.QueryContext(ctx, query, args...)
+			if err == nil {
+				return rows, nil
+			}
+
+			if !replicaFailed(ctx, err) {
+				return nil, err
+			}
+
+			log.Println("pg: replica failed, reading from the next:", err)
+			atomic.StoreInt64(&r.downUntil, time.Now().Add(replicaCooldown).UnixNano())
+		}
+	}
+
+	return db.sql.QueryContext(ctx, query, args...)
+}
+
+// replicaFailed returns true if err is the fault of the replica rather than of
+// the query, so the query may succeed elsewhere
+func replicaFailed(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// class 57 is the server shutting down or cancelling the query, and
+		// 40001 a query cancelled by a conflict with replication
+		return pqErr.Code.Class() == "57" || pqErr.Code == "40001"
+	}
+
+	// anything else is the replica not being reachable at all
+	return true
+}
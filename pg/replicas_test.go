@@ -0,0 +1,87 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestReplicaFailed(t *testing.T) {
+	t.Parallel()
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var cases = []struct {
+		name   string
+		ctx    context.Context
+		err    error
+		failed bool
+	}{
+		{"unreachable", context.Background(), errors.New("dial tcp: connection refused"), true},
+		{"shutting-down", context.Background(), &pq.Error{Code: "57P01"}, true},
+		{"replication-conflict", context.Background(), &pq.Error{Code: "40001"}, true},
+		{"bad-query", context.Background(), &pq.Error{Code: "42703"}, false},
+		{"cancelled", cancelled, context.Canceled, false},
+	}
+
+	for _, c := range cases {
+		if failed := replicaFailed(c.ctx, c.err); failed != c.failed {
+			t.Errorf("%s: replicaFailed = %t, expected %t", c.name, failed, c.failed)
+		}
+	}
+}
+
+func TestQueryReadSkipsFailedReplicas(t *testing.T) {
+	t.Parallel()
+
+	// nothing listens on port 1, so every connection is refused
+	const unreachable = "postgres://postgres@127.0.0.1:1/postgres?sslmode=disable&connect_timeout=1"
+
+	primary, err := openDB(unreachable, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rdb, err := openDB(unreachable, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &replica{sql: rdb}
+	db := &DB{sql: primary, replicas: []*replica{r}}
+
+	_, err = db.queryRead(context.Background(), `SELECT 1;`)
+	if err == nil {
+		t.Fatal("expected the query to fail on the primary")
+	}
+
+	if time.Unix(0, r.downUntil).Before(time.Now()) {
+		t.Fatal("expected the failed replica to be skipped")
+	}
+}
+
+func TestReplicaLag(t *testing.T) {
+	t.Parallel()
+
+	r := &replica{maxLag: time.Minute}
+
+	r.setLag(90)
+	if r.lagging != 1 {
+		t.Fatal("expected a replica further behind than the max lag to be lagging")
+	}
+
+	r.setLag(5)
+	if r.lagging != 0 {
+		t.Fatal("expected a replica that caught up to be read from again")
+	}
+
+	unchecked := &replica{}
+	unchecked.setLag(3600)
+	if unchecked.behind(context.Background()) {
+		t.Fatal("expected replicas without a max lag to always be read from")
+	}
+}
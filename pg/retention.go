@@ -0,0 +1,136 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+// posts are pruned this many at a time, each time the maintainer runs, so a
+// newly set policy does not delete years of posts in one transaction
+const pruneBatchSize = 5000
+
+// StarPost stars or unstars a post for the user, only posts of feeds they
+// follow can be starred
+func (db *DB) StarPost(ctx context.Context, sessionKey, postID string, starred bool) error {
+	var err error
+	if starred {
+		var found int
+		err = db.sql.QueryRowContext(ctx, `
+		WITH post AS (
+			SELECT s.user_id, po.id
+			FROM sessions s
+			JOIN posts po ON (po.id = $2::uuid)
+			WHERE s.key = $1 AND s.active = TRUE
+			AND EXISTS (SELECT 1 FROM feed_folders WHERE feed_id = po.feed_id AND user_id = s.user_id)
+		), starred AS (
+			INSERT INTO post_stars
+			(user_id, post_id)
+			SELECT user_id, id
+			FROM post
+			ON CONFLICT DO NOTHING
+		)
+		SELECT count(*) FROM post;`, sessionKey, postID).Scan(&found)
+		if err == nil && found == 0 {
+			return errors.New("post not found")
+		}
+	} else {
+		_, err = db.sql.ExecContext(ctx, `
+		DELETE FROM post_stars
+		WHERE user_id = (SELECT user_id FROM sessions WHERE key = $1 AND active = TRUE)
+		AND post_id = $2;`, sessionKey, postID)
+	}
+	if err != nil {
+		return err
+	}
+
+	db.invalidateSession(ctx, sessionKey)
+	return nil
+}
+
+// PrunePosts deletes up to limit posts that are neither among the keep newest
+// of their feed nor posted within olderThan, and returns how many it deleted.
+// Either rule is skipped when zero, and posts any user has starred are never
+// deleted. The urls of pruned posts are kept, so later scrapes do not write
+// them again only for them to be pruned once more
+func (db *DB) PrunePosts(ctx context.Context, keep int, olderThan time.Duration, limit int) (n int64, err error) {
+	if keep <= 0 && olderThan <= 0 {
+		return 0, nil
+	}
+
+	err = db.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+		WITH ranked AS (
+			SELECT id, posted_at, row_number() OVER (PARTITION BY feed_id ORDER BY posted_at DESC) AS n
+			FROM posts
+		), pruned AS (
+			DELETE FROM posts
+			WHERE id IN (
+				SELECT id
+				FROM ranked
+				WHERE ($1 <= 0 OR n > $1)
+				AND ($2 <= 0 OR posted_at < now() - $2 * interval '1 second')
+				AND NOT EXISTS (SELECT 1 FROM post_stars WHERE post_id = ranked.id)
+				ORDER BY posted_at ASC
+				LIMIT $3
+			)
+			RETURNING url, feed_id, scope
+		)
+		INSERT INTO pruned_posts
+		(url, feed_id, scope)
+		SELECT url, feed_id, scope
+		FROM pruned
+		ON CONFLICT (url, scope) DO UPDATE SET feed_id = EXCLUDED.feed_id, pruned_at = now();`, keep, olderThan.Seconds(), limit)
+		if err != nil {
+			return err
+		}
+
+		n, err = res.RowsAffected()
+		if err != nil || n == 0 {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+		INSERT INTO post_prunes
+		(day, posts)
+		VALUES
+		(current_date, $1)
+		ON CONFLICT (day) DO UPDATE SET posts = post_prunes.posts + EXCLUDED.posts;`, n)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// GetPruneStats returns how many posts were pruned on each day since the given
+// time, oldest first
+func (db *DB) GetPruneStats(ctx context.Context, since time.Time) ([]*hydrocarbon.PruneStats, error) {
+	rows, err := db.sql.QueryContext(ctx, `
+	SELECT day, posts
+	FROM post_prunes
+	WHERE day >= $1::date
+	ORDER BY day ASC;`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make([]*hydrocarbon.PruneStats, 0)
+	for rows.Next() {
+		var ps hydrocarbon.PruneStats
+		err = rows.Scan(&ps.Day, &ps.Posts)
+		if err != nil {
+			return nil, err
+		}
+
+		stats = append(stats, &ps)
+	}
+
+	return stats, rows.Err()
+}
@@ -0,0 +1,66 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/fortytw2/hydrocarbon/discollect"
+)
+
+var errSharedSchedule = errors.New("schedules can only be set for feeds no one else follows")
+
+// SetFeedSchedule sets how scrapes of a feed only the user follows are
+// scheduled, nil goes back to the plugins scheduler. Scrapes already scheduled
+// are dropped so the new schedule takes effect right away. Feeds are scraped
+// once for every follower, so one of them can not schedule it for the rest
+func (db *DB) SetFeedSchedule(ctx context.Context, sessionKey, feedID string, spec *discollect.ScheduleSpec) error {
+	return db.withTx(ctx, func(tx *sql.Tx) error {
+		// left NULL to clear the schedule
+		var schedule interface{}
+		if spec != nil {
+			buf, err := json.Marshal(spec)
+			if err != nil {
+				return err
+			}
+			schedule = string(buf)
+		}
+
+		var id string
+		var shared bool
+		err := tx.QueryRowContext(ctx, `
+		SELECT f.id, EXISTS (SELECT 1 FROM feed_folders ff WHERE ff.feed_id = f.id AND ff.user_id <> s.user_id)
+		FROM feeds f
+		JOIN sessions s ON (s.key = $1)
+		WHERE f.id = $2
+		AND EXISTS (SELECT 1 FROM feed_folders ff WHERE ff.feed_id = f.id AND ff.user_id = s.user_id)
+		FOR UPDATE OF f;`, sessionKey, feedID).Scan(&id, &shared)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("feed not found")
+			}
+			return err
+		}
+		if shared {
+			return errSharedSchedule
+		}
+
+		_, err = tx.ExecContext(ctx, `
+		UPDATE feeds
+		SET schedule = $2
+		WHERE id = $1;`, id, schedule)
+		if err != nil {
+			return err
+		}
+
+		// backfills and scrapes users asked for are left alone
+		_, err = tx.ExecContext(ctx, `
+		DELETE FROM scrapes
+		WHERE feed_id = $1
+		AND state = 'WAITING'
+		AND priority = $2;`, id, int(discollect.PriorityScheduled))
+		return err
+	})
+}
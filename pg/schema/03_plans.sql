@@ -0,0 +1,24 @@
+-- plans describe the limits applied to every user on them
+CREATE TABLE plans (
+	name TEXT PRIMARY KEY,
+
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+	-- the most feeds a single user can follow
+	max_feeds INT NOT NULL,
+	-- the shortest gap allowed between two scrapes of a feed
+	min_scrape_interval INTERVAL NOT NULL
+);
+
+INSERT INTO plans
+(name, max_feeds, min_scrape_interval)
+VALUES
+('free', 25, INTERVAL '2 HOURS'),
+('pro', 500, INTERVAL '30 MINUTES');
+
+ALTER TABLE users ADD COLUMN plan TEXT NOT NULL DEFAULT 'free' REFERENCES plans (name);
+
+CREATE TRIGGER plans_updated_at
+    BEFORE UPDATE ON plans
+    FOR EACH ROW EXECUTE PROCEDURE set_updated_at();
@@ -0,0 +1,3 @@
+-- every user gets a trial period after first signing up, after which they
+-- are read-only until they subscribe
+ALTER TABLE users ADD COLUMN trial_ends_at TIMESTAMPTZ NOT NULL DEFAULT now() + INTERVAL '14 DAYS';
@@ -0,0 +1,29 @@
+-- announcements are created by instance operators and shown to every user
+-- until they have been seen
+CREATE TABLE announcements (
+	id UUID PRIMARY KEY DEFAULT uuid_generate_v1mc(),
+
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+	title TEXT NOT NULL,
+	body TEXT NOT NULL DEFAULT '',
+
+	starts_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	ends_at TIMESTAMPTZ
+);
+
+CREATE INDEX announcements_active_idx ON announcements (starts_at, ends_at);
+
+CREATE TABLE announcement_views (
+	announcement_id UUID NOT NULL REFERENCES announcements ON DELETE CASCADE,
+	user_id UUID NOT NULL REFERENCES users,
+
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+	PRIMARY KEY (announcement_id, user_id)
+);
+
+CREATE TRIGGER announcements_updated_at
+    BEFORE UPDATE ON announcements
+    FOR EACH ROW EXECUTE PROCEDURE set_updated_at();
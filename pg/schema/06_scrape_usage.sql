@@ -0,0 +1,23 @@
+ALTER TABLE plans ADD COLUMN max_scrapes INT NOT NULL DEFAULT 5000;
+
+UPDATE plans SET max_scrapes = 2000 WHERE name = 'free';
+UPDATE plans SET max_scrapes = 100000 WHERE name = 'pro';
+
+-- scrape_usage meters every scrape of a feed against each user following it,
+-- per monthly billing period
+CREATE TABLE scrape_usage (
+	user_id UUID NOT NULL REFERENCES users,
+	period_start TIMESTAMPTZ NOT NULL,
+
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+	scrapes INT NOT NULL DEFAULT 0,
+	tasks INT NOT NULL DEFAULT 0,
+
+	PRIMARY KEY (user_id, period_start)
+);
+
+CREATE TRIGGER scrape_usage_updated_at
+    BEFORE UPDATE ON scrape_usage
+    FOR EACH ROW EXECUTE PROCEDURE set_updated_at();
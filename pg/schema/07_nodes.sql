@@ -0,0 +1,25 @@
+-- nodes are running discollectors, they heartbeat regularly and can be asked
+-- to drain before deploys
+CREATE TABLE nodes (
+	id UUID PRIMARY KEY,
+
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+	hostname TEXT NOT NULL,
+	version TEXT NOT NULL DEFAULT '',
+
+	started_at TIMESTAMPTZ NOT NULL,
+	heartbeat_at TIMESTAMPTZ NOT NULL,
+
+	workers INT NOT NULL DEFAULT 0,
+	load INT NOT NULL DEFAULT 0,
+
+	draining BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX nodes_heartbeat_at_idx ON nodes (heartbeat_at);
+
+CREATE TRIGGER nodes_updated_at
+    BEFORE UPDATE ON nodes
+    FOR EACH ROW EXECUTE PROCEDURE set_updated_at();
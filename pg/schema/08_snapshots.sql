@@ -0,0 +1,16 @@
+-- snapshots are the raw responses captured during a scrape, kept so the scrape
+-- can be replayed after fixing a plugin
+CREATE TABLE snapshots (
+	scrape_id UUID NOT NULL REFERENCES scrapes ON DELETE CASCADE,
+	url TEXT NOT NULL,
+
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+	status_code INT NOT NULL,
+	header JSONB NOT NULL DEFAULT '{}',
+	body BYTEA NOT NULL,
+
+	PRIMARY KEY (scrape_id, url)
+);
+
+CREATE INDEX snapshots_created_at_idx ON snapshots (created_at);
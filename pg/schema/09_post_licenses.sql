@@ -0,0 +1,3 @@
+-- plugins may record the license and copyright line a post was published with
+ALTER TABLE posts ADD COLUMN license TEXT NOT NULL DEFAULT '';
+ALTER TABLE posts ADD COLUMN attribution TEXT NOT NULL DEFAULT '';
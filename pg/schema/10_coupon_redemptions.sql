@@ -0,0 +1,9 @@
+-- every coupon a user has redeemed, so that codes cannot be reused
+CREATE TABLE coupon_redemptions (
+	user_id UUID NOT NULL REFERENCES users,
+	code CITEXT NOT NULL,
+
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+	PRIMARY KEY (user_id, code)
+);
@@ -0,0 +1,5 @@
+-- track how often each api key is used, and when users were last reminded to
+-- rotate it
+ALTER TABLE sessions ADD COLUMN api_calls BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE sessions ADD COLUMN last_used_at TIMESTAMPTZ;
+ALTER TABLE sessions ADD COLUMN reminded_at TIMESTAMPTZ;
@@ -0,0 +1,16 @@
+-- simhash of each posts normalized text, used to find near-duplicates
+ALTER TABLE posts ADD COLUMN simhash BIGINT;
+CREATE INDEX posts_created_at_idx ON posts (created_at);
+
+-- every other place a near-duplicate of a post was seen, the post itself is
+-- shown in each of these feeds
+CREATE TABLE post_sources (
+	post_id UUID NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+	feed_id UUID NOT NULL REFERENCES feeds (id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	url TEXT NOT NULL,
+
+	PRIMARY KEY (post_id, url)
+);
+
+CREATE INDEX post_sources_feed_idx ON post_sources (feed_id);
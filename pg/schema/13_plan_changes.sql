@@ -0,0 +1,6 @@
+-- the payment provider plan each paid plan is billed as, plans without one
+-- cannot be switched to
+ALTER TABLE plans ADD COLUMN payment_plan_id TEXT UNIQUE;
+
+-- new subscriptions are created against the hydrocarbon plan
+UPDATE plans SET payment_plan_id = 'hydrocarbon' WHERE name = 'pro';
@@ -0,0 +1,16 @@
+-- daily quality metrics computed from a sample of each plugins posts
+CREATE TABLE plugin_quality (
+	plugin TEXT NOT NULL,
+	day DATE NOT NULL,
+
+	samples INT NOT NULL,
+	body_length_p10 INT NOT NULL,
+	body_length_p50 INT NOT NULL,
+	body_length_p90 INT NOT NULL,
+	link_density DOUBLE PRECISION NOT NULL,
+	empty_author_rate DOUBLE PRECISION NOT NULL,
+
+	PRIMARY KEY (plugin, day)
+);
+
+CREATE INDEX plugin_quality_day_idx ON plugin_quality (day);
@@ -0,0 +1,7 @@
+-- feeds added while no scraper is available are saved as pending, without a
+-- plugin, and resolved in the background
+ALTER TABLE feeds ADD COLUMN status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('pending', 'active', 'failed'));
+ALTER TABLE feeds ADD COLUMN resolve_attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE feeds ADD COLUMN resolve_error TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX feeds_pending_idx ON feeds (created_at) WHERE status = 'pending';
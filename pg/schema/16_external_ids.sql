@@ -0,0 +1,8 @@
+-- plugins may give feeds and posts a stable ID from the origin site, so they
+-- can be matched up again after their urls change shape
+ALTER TABLE feeds ADD COLUMN external_id TEXT;
+CREATE UNIQUE INDEX feeds_plugin_external_id_uniq_idx ON feeds (plugin, external_id) WHERE public AND external_id IS NOT NULL;
+
+-- prefixed with the plugin name, as posts do not record their plugin
+ALTER TABLE posts ADD COLUMN external_id TEXT;
+CREATE UNIQUE INDEX posts_external_id_uniq_idx ON posts (external_id);
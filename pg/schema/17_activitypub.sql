@@ -0,0 +1,16 @@
+-- public folders are published as activitypub actors, each with its own key
+-- to sign deliveries with
+ALTER TABLE folders ADD COLUMN public BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE folders ADD COLUMN actor_key TEXT;
+-- posts created before delivered_at have been sent to every follower
+ALTER TABLE folders ADD COLUMN delivered_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE TABLE activitypub_followers (
+	folder_id UUID REFERENCES folders ON DELETE CASCADE NOT NULL,
+	actor TEXT NOT NULL,
+	inbox TEXT NOT NULL,
+
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+	PRIMARY KEY (folder_id, actor)
+);
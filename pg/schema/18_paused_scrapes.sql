@@ -0,0 +1,3 @@
+-- scrapes can be paused during upstream incidents, enum values cannot be added
+-- in the same transaction they are used in, so this stands alone
+ALTER TYPE scrape_state ADD VALUE IF NOT EXISTS 'PAUSED';
@@ -0,0 +1,9 @@
+-- the pending tasks of a paused scrape, taken off the queue so they survive a
+-- queue flush and can be resumed by any node
+CREATE TABLE paused_tasks (
+	scrape_id UUID PRIMARY KEY REFERENCES scrapes ON DELETE CASCADE,
+	paused_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+	tasks JSONB NOT NULL DEFAULT '[]',
+	status JSONB NOT NULL DEFAULT '{}'
+);
@@ -0,0 +1,39 @@
+-- users can rewrite the posts of a feed they follow with a small script, run
+-- on every post as it is written
+CREATE TABLE feed_transforms (
+	user_id UUID REFERENCES users NOT NULL,
+	feed_id UUID REFERENCES feeds NOT NULL,
+
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+	script TEXT NOT NULL,
+	-- the last error running the script, cleared when it is replaced
+	last_error TEXT NOT NULL DEFAULT '',
+
+	PRIMARY KEY (user_id, feed_id)
+);
+
+CREATE INDEX feed_transforms_feed_idx ON feed_transforms (feed_id);
+
+CREATE TRIGGER feed_transforms_updated_at
+    BEFORE UPDATE ON feed_transforms
+    FOR EACH ROW EXECUTE PROCEDURE set_updated_at();
+
+-- the output of a users transform for a post, read in place of the post
+CREATE TABLE post_overlays (
+	user_id UUID REFERENCES users NOT NULL,
+	post_id UUID REFERENCES posts ON DELETE CASCADE NOT NULL,
+	feed_id UUID REFERENCES feeds NOT NULL,
+
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+	title TEXT NOT NULL,
+	author TEXT NOT NULL,
+	body TEXT NOT NULL,
+	tags TEXT[] NOT NULL DEFAULT '{}',
+
+	PRIMARY KEY (user_id, post_id)
+);
+
+CREATE INDEX post_overlays_feed_idx ON post_overlays (user_id, feed_id);
@@ -0,0 +1,2 @@
+-- posts imported from an archive of a feed, rather than scraped
+ALTER TABLE posts ADD COLUMN backfilled BOOLEAN NOT NULL DEFAULT false;
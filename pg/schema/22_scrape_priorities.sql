@@ -0,0 +1,7 @@
+-- scrapes of a higher priority are started first, 0 is a backfill, 1 a
+-- scheduled scrape and 2 a refresh a user asked for
+ALTER TABLE scrapes ADD COLUMN priority SMALLINT NOT NULL DEFAULT 1;
+
+UPDATE scrapes SET priority = 0 WHERE state = 'WAITING' AND config->>'Type' = 'full_scrape';
+
+CREATE INDEX scrapes_waiting_priority_idx ON scrapes (priority DESC, scheduled_start_at) WHERE state = 'WAITING';
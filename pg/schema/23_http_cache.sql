@@ -0,0 +1,14 @@
+-- the last response to every page scraped that can be revalidated, so the
+-- next request for it can be conditional
+CREATE TABLE http_cache (
+	url TEXT PRIMARY KEY,
+
+	stored_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+	etag TEXT NOT NULL DEFAULT '',
+	last_modified TEXT NOT NULL DEFAULT '',
+
+	status_code INT NOT NULL,
+	header JSONB NOT NULL DEFAULT '{}',
+	body BYTEA NOT NULL
+);
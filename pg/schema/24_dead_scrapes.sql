@@ -0,0 +1,4 @@
+-- scrapes that keep failing are dead-lettered until an admin requeues them,
+-- enum values cannot be added in the same transaction they are used in, so
+-- this stands alone
+ALTER TYPE scrape_state ADD VALUE IF NOT EXISTS 'DEAD';
@@ -0,0 +1,5 @@
+-- the url of the last task to error, kept with dead scrapes for debugging
+ALTER TABLE scrapes ADD COLUMN last_failed_url TEXT NOT NULL DEFAULT '';
+
+-- scrapes were never moved to ERRORED before they could be dead-lettered
+UPDATE scrapes SET state = 'DEAD' WHERE state = 'ERRORED';
@@ -0,0 +1,16 @@
+-- credentials scrapes of a feed log into the origin site with, sealed with
+-- AES-GCM so a copy of the database alone does not reveal them
+CREATE TABLE feed_credentials (
+	feed_id UUID PRIMARY KEY REFERENCES feeds ON DELETE CASCADE,
+	-- the user that last set them
+	user_id UUID REFERENCES users NOT NULL,
+
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+	sealed BYTEA NOT NULL
+);
+
+CREATE TRIGGER feed_credentials_updated_at
+    BEFORE UPDATE ON feed_credentials
+    FOR EACH ROW EXECUTE PROCEDURE set_updated_at();
@@ -0,0 +1,3 @@
+-- feeds can be scheduled by a strategy other than their plugins, a
+-- discollect.ScheduleSpec, NULL uses the plugins scheduler
+ALTER TABLE feeds ADD COLUMN schedule JSONB;
@@ -0,0 +1,5 @@
+-- the last recorded discollect.ScrapeStatus of a long running scrape, i.e. a
+-- backfill, so its progress can be shown while it runs
+ALTER TABLE scrapes ADD COLUMN progress JSONB;
+
+CREATE INDEX scrapes_backfill_idx ON scrapes (feed_id, created_at DESC) WHERE config->>'Type' = 'backfill_scrape';
@@ -0,0 +1,3 @@
+-- the number of tasks of a scrape that ran past their deadline, whether or not
+-- they succeeded when retried
+ALTER TABLE scrapes ADD COLUMN total_timeouts INT NOT NULL DEFAULT 0;
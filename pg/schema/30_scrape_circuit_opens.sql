@@ -0,0 +1,3 @@
+-- hosts that looked to be down while a scrape ran, so its tasks against them
+-- were held back, each as "host until timestamp"
+ALTER TABLE scrapes ADD COLUMN circuit_opens TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,10 @@
+-- zstd dictionaries trained on the HTML of stored posts. The ID of the one a
+-- body was compressed with is recorded in its zstd frame, so none are ever
+-- deleted. IDs below 32768 are reserved by the zstd format
+CREATE SEQUENCE compression_dictionaries_id_seq START 32768;
+
+CREATE TABLE compression_dictionaries (
+	id INT PRIMARY KEY,
+	dict BYTEA NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,19 @@
+-- every request made by the tasks of a scrape, and every error they ended
+-- with, kept for a while to look into feeds that silently produce no posts
+CREATE TABLE scrape_logs (
+	id BIGSERIAL PRIMARY KEY,
+	scrape_id UUID NOT NULL REFERENCES scrapes ON DELETE CASCADE,
+	task_id UUID NOT NULL,
+
+	url TEXT NOT NULL,
+	-- NULL if no response was received
+	status_code INT,
+	duration_ms INT NOT NULL,
+	bytes BIGINT NOT NULL,
+	error TEXT,
+
+	created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX scrape_logs_scrape_id_idx ON scrape_logs (scrape_id, id);
+CREATE INDEX scrape_logs_created_at_idx ON scrape_logs (created_at);
@@ -0,0 +1,8 @@
+-- when each domain may next be requested, shared by every node so restarts
+-- and scaling out do not reset per host rate limits
+CREATE TABLE host_rate_limits (
+	domain TEXT PRIMARY KEY,
+	next_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX host_rate_limits_next_at_idx ON host_rate_limits (next_at);
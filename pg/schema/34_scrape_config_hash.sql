@@ -0,0 +1,20 @@
+-- a hash of the config of a scrape, so logically identical scrapes can be
+-- found without comparing whole configs. jsonb is stored normalized, so
+-- configs with the same content always hash the same
+ALTER TABLE scrapes ADD COLUMN config_hash TEXT;
+
+UPDATE scrapes SET config_hash = md5(config::text);
+
+CREATE OR REPLACE FUNCTION set_config_hash()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.config_hash = md5(NEW.config::text);
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER scrapes_config_hash
+    BEFORE INSERT OR UPDATE OF config ON scrapes
+    FOR EACH ROW EXECUTE PROCEDURE set_config_hash();
+
+CREATE INDEX scrapes_config_hash_idx ON scrapes (plugin, config_hash, scheduled_start_at);
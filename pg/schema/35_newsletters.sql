@@ -0,0 +1,15 @@
+-- generated addresses newsletters are subscribed with, every mail sent to one
+-- is delivered as a post into its feed, which is private to the user and never
+-- scraped
+CREATE TABLE newsletter_addresses (
+	id UUID PRIMARY KEY DEFAULT uuid_generate_v1mc(),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+	user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+	feed_id UUID NOT NULL REFERENCES feeds ON DELETE CASCADE,
+
+	-- the local part of the address, the domain is set per instance
+	token TEXT NOT NULL UNIQUE
+);
+
+CREATE INDEX newsletter_addresses_user_id_idx ON newsletter_addresses (user_id);
@@ -0,0 +1,13 @@
+DROP TRIGGER posts_updated_at ON posts;
+CREATE TRIGGER posts_updated_at
+    BEFORE UPDATE ON posts
+    FOR EACH ROW EXECUTE PROCEDURE set_updated_at();
+
+DROP TRIGGER posts_search ON posts;
+DROP FUNCTION set_post_search();
+
+DROP INDEX posts_unindexed_idx;
+DROP INDEX posts_search_idx;
+
+ALTER TABLE posts DROP COLUMN search_body;
+ALTER TABLE posts DROP COLUMN search;
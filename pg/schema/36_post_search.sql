@@ -0,0 +1,45 @@
+-- posts are searched by their title, author and the text of their body, in that
+-- order of weight. Bodies are stored compressed, so writes pass the plain text
+-- of the body in search_body, which the trigger indexes and clears. Updates
+-- that only change the title or author keep the body part of the search
+ALTER TABLE posts ADD COLUMN search TSVECTOR;
+ALTER TABLE posts ADD COLUMN search_body TEXT;
+
+CREATE OR REPLACE FUNCTION set_post_search()
+RETURNS TRIGGER AS $$
+DECLARE
+    body TSVECTOR;
+BEGIN
+    IF NEW.search_body IS NOT NULL THEN
+        body = setweight(to_tsvector('english', NEW.search_body), 'D');
+        NEW.search_body = NULL;
+    ELSIF TG_OP = 'UPDATE' AND OLD.search IS NOT NULL THEN
+        body = ts_filter(OLD.search, '{d}');
+    ELSE
+        -- left for IndexPostBodies, which decompresses the body first
+        RETURN NEW;
+    END IF;
+
+    NEW.search = setweight(to_tsvector('english', coalesce(NEW.title, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(NEW.author, '')), 'B') ||
+        body;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER posts_search
+    BEFORE INSERT OR UPDATE OF title, author, search_body ON posts
+    FOR EACH ROW EXECUTE PROCEDURE set_post_search();
+
+CREATE INDEX posts_search_idx ON posts USING GIN (search);
+-- posts written before search existed, which the maintainer indexes in batches
+CREATE INDEX posts_unindexed_idx ON posts (created_at) WHERE search IS NULL;
+
+-- indexing a post written before search existed is not a change to it, so
+-- IndexPostBodies sets hydrocarbon.indexing to keep updated_at as it was
+DROP TRIGGER posts_updated_at ON posts;
+CREATE TRIGGER posts_updated_at
+    BEFORE UPDATE ON posts
+    FOR EACH ROW
+    WHEN (current_setting('hydrocarbon.indexing', true) IS DISTINCT FROM 'on')
+    EXECUTE PROCEDURE set_updated_at();
@@ -0,0 +1,9 @@
+DROP TABLE post_prunes;
+
+DROP INDEX posts_feed_posted_at_idx;
+
+ALTER TABLE read_statuses DROP CONSTRAINT read_statuses_post_id_fkey;
+ALTER TABLE read_statuses ADD CONSTRAINT read_statuses_post_id_fkey
+	FOREIGN KEY (post_id) REFERENCES posts;
+
+DROP TABLE post_stars;
@@ -0,0 +1,25 @@
+-- posts a user has starred are kept whatever the retention policy
+CREATE TABLE post_stars (
+	user_id UUID REFERENCES users NOT NULL,
+	post_id UUID REFERENCES posts ON DELETE CASCADE NOT NULL,
+
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+	PRIMARY KEY (user_id, post_id)
+);
+
+CREATE INDEX post_stars_post_idx ON post_stars (post_id);
+
+-- pruned posts take their read statuses with them
+ALTER TABLE read_statuses DROP CONSTRAINT read_statuses_post_id_fkey;
+ALTER TABLE read_statuses ADD CONSTRAINT read_statuses_post_id_fkey
+	FOREIGN KEY (post_id) REFERENCES posts ON DELETE CASCADE;
+
+-- the newest posts of a feed are kept by the retention policy
+CREATE INDEX posts_feed_posted_at_idx ON posts (feed_id, posted_at DESC);
+
+-- the number of posts pruned by the retention policy each day
+CREATE TABLE post_prunes (
+	day DATE PRIMARY KEY,
+	posts BIGINT NOT NULL DEFAULT 0
+);
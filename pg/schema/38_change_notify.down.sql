@@ -0,0 +1,8 @@
+DROP TRIGGER feed_folders_notify ON feed_folders;
+DROP FUNCTION notify_follow_change();
+
+DROP TRIGGER scrapes_notify ON scrapes;
+DROP FUNCTION notify_scrape_change();
+
+DROP TRIGGER posts_notify ON posts;
+DROP FUNCTION notify_post_change();
@@ -0,0 +1,51 @@
+-- changes to posts, scrapes and follows are notified on hydrocarbon_changes,
+-- which SubscribeChanges listens to. Payloads are kept to IDs, as notifications
+-- are limited to 8000 bytes
+CREATE OR REPLACE FUNCTION notify_post_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('hydrocarbon_changes', json_build_object(
+        'kind', 'post', 'id', NEW.id, 'feed_id', NEW.feed_id)::text);
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER posts_notify
+    AFTER INSERT OR UPDATE OF title, author, body, url ON posts
+    FOR EACH ROW EXECUTE PROCEDURE notify_post_change();
+
+CREATE OR REPLACE FUNCTION notify_scrape_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('hydrocarbon_changes', json_build_object(
+        'kind', 'scrape', 'id', NEW.id, 'feed_id', NEW.feed_id, 'state', NEW.state)::text);
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER scrapes_notify
+    AFTER UPDATE OF state ON scrapes
+    FOR EACH ROW
+    WHEN (OLD.state IS DISTINCT FROM NEW.state)
+    EXECUTE PROCEDURE notify_scrape_change();
+
+CREATE OR REPLACE FUNCTION notify_follow_change()
+RETURNS TRIGGER AS $$
+DECLARE
+    ff RECORD;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        ff = OLD;
+    ELSE
+        ff = NEW;
+    END IF;
+
+    PERFORM pg_notify('hydrocarbon_changes', json_build_object(
+        'kind', 'follow', 'feed_id', ff.feed_id, 'user_id', ff.user_id)::text);
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER feed_folders_notify
+    AFTER INSERT OR DELETE ON feed_folders
+    FOR EACH ROW EXECUTE PROCEDURE notify_follow_change();
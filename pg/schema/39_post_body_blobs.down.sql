@@ -0,0 +1 @@
+DROP INDEX posts_body_blobs_idx;
@@ -0,0 +1,3 @@
+-- bodies kept in a blob store are stored as blob_ followed by their sha256,
+-- which is looked up before the blob of a pruned post is deleted
+CREATE INDEX posts_body_blobs_idx ON posts (body) WHERE body LIKE 'blob\_%';
@@ -0,0 +1,9 @@
+UPDATE posts po
+SET body = pb.body
+FROM post_bodies pb
+WHERE pb.hash = po.body_hash;
+
+CREATE INDEX posts_body_blobs_idx ON posts (body) WHERE body LIKE 'blob\_%';
+
+ALTER TABLE posts DROP COLUMN body_hash;
+DROP TABLE post_bodies;
@@ -0,0 +1,26 @@
+-- bodies are stored once, keyed by their sha256, and referred to by every post
+-- with that body. Posts written before keep their body in posts.body, which is
+-- left empty for those written since. Bodies kept in a blob store were already
+-- keyed by their hash, so they are moved over as they are
+CREATE TABLE post_bodies (
+    hash TEXT PRIMARY KEY,
+    body TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE posts ADD COLUMN body_hash TEXT REFERENCES post_bodies (hash);
+CREATE INDEX posts_body_hash_idx ON posts (body_hash);
+
+INSERT INTO post_bodies
+(hash, body)
+SELECT DISTINCT substr(body, 6), body
+FROM posts
+WHERE body LIKE 'blob\_%';
+
+-- moving a body is not a change to the post, see posts_updated_at
+SET LOCAL hydrocarbon.indexing = 'on';
+UPDATE posts
+SET body_hash = substr(body, 6), body = ''
+WHERE body LIKE 'blob\_%';
+
+DROP INDEX posts_body_blobs_idx;
@@ -0,0 +1,2 @@
+ALTER TABLE post_bodies DROP COLUMN key_id;
+ALTER TABLE feed_credentials DROP COLUMN key_id;
@@ -0,0 +1,6 @@
+-- the ID of the key each was sealed with, so they can be resealed with a new
+-- one. Credentials were all sealed with the single credentials key until now
+ALTER TABLE feed_credentials ADD COLUMN key_id TEXT NOT NULL DEFAULT 'credentials';
+
+-- NULL for bodies that are not sealed
+ALTER TABLE post_bodies ADD COLUMN key_id TEXT;
@@ -0,0 +1,29 @@
+-- deleted rows would otherwise reappear, they are purged while doing so still
+-- takes everything of them along
+DELETE FROM posts WHERE deleted_at IS NOT NULL;
+DELETE FROM posts WHERE feed_id IN (SELECT id FROM feeds WHERE deleted_at IS NOT NULL);
+DELETE FROM folders WHERE deleted_at IS NOT NULL;
+DELETE FROM feeds WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE post_overlays DROP CONSTRAINT post_overlays_feed_id_fkey;
+ALTER TABLE post_overlays ADD CONSTRAINT post_overlays_feed_id_fkey
+	FOREIGN KEY (feed_id) REFERENCES feeds;
+ALTER TABLE feed_transforms DROP CONSTRAINT feed_transforms_feed_id_fkey;
+ALTER TABLE feed_transforms ADD CONSTRAINT feed_transforms_feed_id_fkey
+	FOREIGN KEY (feed_id) REFERENCES feeds;
+ALTER TABLE scrapes DROP CONSTRAINT scrapes_feed_id_fkey;
+ALTER TABLE scrapes ADD CONSTRAINT scrapes_feed_id_fkey
+	FOREIGN KEY (feed_id) REFERENCES feeds;
+ALTER TABLE feed_folders DROP CONSTRAINT feed_folders_feed_id_fkey;
+ALTER TABLE feed_folders ADD CONSTRAINT feed_folders_feed_id_fkey
+	FOREIGN KEY (feed_id) REFERENCES feeds;
+ALTER TABLE feed_folders DROP CONSTRAINT feed_folders_folder_id_fkey;
+ALTER TABLE feed_folders ADD CONSTRAINT feed_folders_folder_id_fkey
+	FOREIGN KEY (folder_id) REFERENCES folders;
+
+DROP INDEX folders_user_name_uniq_idx;
+ALTER TABLE folders ADD CONSTRAINT folders_user_id_name_key UNIQUE (user_id, name);
+
+ALTER TABLE posts DROP COLUMN deleted_at;
+ALTER TABLE folders DROP COLUMN deleted_at;
+ALTER TABLE feeds DROP COLUMN deleted_at;
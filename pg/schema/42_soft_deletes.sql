@@ -0,0 +1,30 @@
+-- feeds, folders and posts are soft deleted, left out of everything read
+-- until they are restored, or purged by the maintainer
+ALTER TABLE feeds ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE folders ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE posts ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE INDEX feeds_deleted_idx ON feeds (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX folders_deleted_idx ON folders (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX posts_deleted_idx ON posts (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- a deleted folder does not keep its name from a new one
+ALTER TABLE folders DROP CONSTRAINT folders_user_id_name_key;
+CREATE UNIQUE INDEX folders_user_name_uniq_idx ON folders (user_id, name) WHERE deleted_at IS NULL;
+
+-- purging a folder or feed takes everything of it along
+ALTER TABLE feed_folders DROP CONSTRAINT feed_folders_folder_id_fkey;
+ALTER TABLE feed_folders ADD CONSTRAINT feed_folders_folder_id_fkey
+	FOREIGN KEY (folder_id) REFERENCES folders ON DELETE CASCADE;
+ALTER TABLE feed_folders DROP CONSTRAINT feed_folders_feed_id_fkey;
+ALTER TABLE feed_folders ADD CONSTRAINT feed_folders_feed_id_fkey
+	FOREIGN KEY (feed_id) REFERENCES feeds ON DELETE CASCADE;
+ALTER TABLE scrapes DROP CONSTRAINT scrapes_feed_id_fkey;
+ALTER TABLE scrapes ADD CONSTRAINT scrapes_feed_id_fkey
+	FOREIGN KEY (feed_id) REFERENCES feeds ON DELETE CASCADE;
+ALTER TABLE feed_transforms DROP CONSTRAINT feed_transforms_feed_id_fkey;
+ALTER TABLE feed_transforms ADD CONSTRAINT feed_transforms_feed_id_fkey
+	FOREIGN KEY (feed_id) REFERENCES feeds ON DELETE CASCADE;
+ALTER TABLE post_overlays DROP CONSTRAINT post_overlays_feed_id_fkey;
+ALTER TABLE post_overlays ADD CONSTRAINT post_overlays_feed_id_fkey
+	FOREIGN KEY (feed_id) REFERENCES feeds ON DELETE CASCADE;
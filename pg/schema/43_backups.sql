@@ -0,0 +1,14 @@
+-- every backup taken by a Backuper, whether it succeeded or not
+CREATE TABLE backups (
+	id UUID PRIMARY KEY,
+	started_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	finished_at TIMESTAMPTZ,
+	state TEXT NOT NULL DEFAULT 'running' CHECK (state IN ('running', 'ok', 'failed')),
+	-- where the backup command put it, as it printed
+	location TEXT NOT NULL DEFAULT '',
+	size BIGINT NOT NULL DEFAULT 0,
+	verified_at TIMESTAMPTZ,
+	error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX backups_started_at_idx ON backups (started_at DESC);
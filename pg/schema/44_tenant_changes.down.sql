@@ -0,0 +1,34 @@
+CREATE OR REPLACE FUNCTION notify_post_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('hydrocarbon_changes', json_build_object(
+        'kind', 'post', 'id', NEW.id, 'feed_id', NEW.feed_id)::text);
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+CREATE OR REPLACE FUNCTION notify_scrape_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('hydrocarbon_changes', json_build_object(
+        'kind', 'scrape', 'id', NEW.id, 'feed_id', NEW.feed_id, 'state', NEW.state)::text);
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+CREATE OR REPLACE FUNCTION notify_follow_change()
+RETURNS TRIGGER AS $$
+DECLARE
+    ff RECORD;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        ff = OLD;
+    ELSE
+        ff = NEW;
+    END IF;
+
+    PERFORM pg_notify('hydrocarbon_changes', json_build_object(
+        'kind', 'follow', 'feed_id', ff.feed_id, 'user_id', ff.user_id)::text);
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
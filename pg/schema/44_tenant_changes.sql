@@ -0,0 +1,36 @@
+-- notifications carry the schema of the table changed, every tenant shares the
+-- hydrocarbon_changes channel
+CREATE OR REPLACE FUNCTION notify_post_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('hydrocarbon_changes', json_build_object(
+        'kind', 'post', 'id', NEW.id, 'feed_id', NEW.feed_id, 'schema', TG_TABLE_SCHEMA)::text);
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+CREATE OR REPLACE FUNCTION notify_scrape_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('hydrocarbon_changes', json_build_object(
+        'kind', 'scrape', 'id', NEW.id, 'feed_id', NEW.feed_id, 'state', NEW.state, 'schema', TG_TABLE_SCHEMA)::text);
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+CREATE OR REPLACE FUNCTION notify_follow_change()
+RETURNS TRIGGER AS $$
+DECLARE
+    ff RECORD;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        ff = OLD;
+    ELSE
+        ff = NEW;
+    END IF;
+
+    PERFORM pg_notify('hydrocarbon_changes', json_build_object(
+        'kind', 'follow', 'feed_id', ff.feed_id, 'user_id', ff.user_id, 'schema', TG_TABLE_SCHEMA)::text);
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
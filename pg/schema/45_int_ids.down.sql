@@ -0,0 +1,4 @@
+ALTER TABLE users DROP COLUMN fever_key;
+ALTER TABLE posts DROP COLUMN int_id;
+ALTER TABLE feeds DROP COLUMN int_id;
+ALTER TABLE folders DROP COLUMN int_id;
@@ -0,0 +1,20 @@
+-- clients of the Fever API identify folders, feeds and posts by integers, and
+-- log in with the md5 of the email of the user and a password they set
+ALTER TABLE folders ADD COLUMN int_id BIGSERIAL;
+CREATE UNIQUE INDEX folders_int_id_idx ON folders (int_id);
+
+ALTER TABLE feeds ADD COLUMN int_id BIGSERIAL;
+CREATE UNIQUE INDEX feeds_int_id_idx ON feeds (int_id);
+
+-- a BIGSERIAL would rewrite every post while the migration holds its lock, so
+-- the column is added empty and new posts numbered by its default, those
+-- already stored are numbered in batches by the maintainer, see NumberPosts
+CREATE SEQUENCE posts_int_id_seq;
+ALTER TABLE posts ADD COLUMN int_id BIGINT;
+ALTER TABLE posts ALTER COLUMN int_id SET DEFAULT nextval('posts_int_id_seq');
+ALTER SEQUENCE posts_int_id_seq OWNED BY posts.int_id;
+CREATE UNIQUE INDEX posts_int_id_idx ON posts (int_id);
+CREATE INDEX posts_unnumbered_idx ON posts (created_at) WHERE int_id IS NULL;
+
+ALTER TABLE users ADD COLUMN fever_key TEXT;
+CREATE UNIQUE INDEX users_fever_key_idx ON users (fever_key);
@@ -0,0 +1,3 @@
+DROP TRIGGER read_statuses_notify_unread ON read_statuses;
+DROP TRIGGER read_statuses_notify_read ON read_statuses;
+DROP FUNCTION notify_read_change();
@@ -0,0 +1,50 @@
+-- posts marked read or unread are notified once per statement, with one
+-- notification for each feed they are in, so marking a whole feed read does not
+-- flood the channel. The post is only named when it is the only one
+CREATE OR REPLACE FUNCTION notify_read_change()
+RETURNS TRIGGER AS $$
+DECLARE
+    r RECORD;
+    state TEXT;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        state = 'read';
+        FOR r IN
+            SELECT rs.user_id, p.feed_id, CASE WHEN count(*) = 1 THEN min(rs.post_id::text) END AS post_id
+            FROM new_rows rs
+            JOIN posts p ON (p.id = rs.post_id)
+            GROUP BY rs.user_id, p.feed_id
+        LOOP
+            PERFORM pg_notify('hydrocarbon_changes', json_build_object(
+                'kind', 'read', 'id', r.post_id, 'feed_id', r.feed_id, 'user_id', r.user_id,
+                'state', state, 'schema', TG_TABLE_SCHEMA)::text);
+        END LOOP;
+    ELSE
+        state = 'unread';
+        -- posts being deleted take their read statuses with them, and are
+        -- not notified
+        FOR r IN
+            SELECT rs.user_id, p.feed_id, CASE WHEN count(*) = 1 THEN min(rs.post_id::text) END AS post_id
+            FROM old_rows rs
+            JOIN posts p ON (p.id = rs.post_id)
+            GROUP BY rs.user_id, p.feed_id
+        LOOP
+            PERFORM pg_notify('hydrocarbon_changes', json_build_object(
+                'kind', 'read', 'id', r.post_id, 'feed_id', r.feed_id, 'user_id', r.user_id,
+                'state', state, 'schema', TG_TABLE_SCHEMA)::text);
+        END LOOP;
+    END IF;
+
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER read_statuses_notify_read
+    AFTER INSERT ON read_statuses
+    REFERENCING NEW TABLE AS new_rows
+    FOR EACH STATEMENT EXECUTE PROCEDURE notify_read_change();
+
+CREATE TRIGGER read_statuses_notify_unread
+    AFTER DELETE ON read_statuses
+    REFERENCING OLD TABLE AS old_rows
+    FOR EACH STATEMENT EXECUTE PROCEDURE notify_read_change();
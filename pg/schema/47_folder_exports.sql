@@ -0,0 +1,4 @@
+-- folders can be exported as feeds at a url with a secret token in it, which
+-- is replaced to revoke the url
+ALTER TABLE folders ADD COLUMN export_token TEXT;
+CREATE UNIQUE INDEX folders_export_token_idx ON folders (export_token);
@@ -0,0 +1 @@
+DROP INDEX posts_legacy_body_idx;
@@ -0,0 +1,3 @@
+-- posts written before bodies were shared keep their body in posts.body, which
+-- RotateKeys moves to post_bodies to be encrypted with the rest
+CREATE INDEX posts_legacy_body_idx ON posts (id) WHERE body <> '';
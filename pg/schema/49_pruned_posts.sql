@@ -0,0 +1,8 @@
+-- the urls of posts pruned by the retention policy, which are not written
+-- again when a later scrape finds them
+CREATE TABLE pruned_posts (
+	url TEXT PRIMARY KEY,
+	feed_id UUID REFERENCES feeds ON DELETE CASCADE NOT NULL,
+
+	pruned_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
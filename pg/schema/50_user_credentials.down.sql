@@ -0,0 +1,7 @@
+-- only the credentials last set on a feed are kept
+DELETE FROM feed_credentials a USING feed_credentials b
+WHERE a.feed_id = b.feed_id AND (a.updated_at, a.user_id) < (b.updated_at, b.user_id);
+
+DROP INDEX feed_credentials_feed_id_idx;
+ALTER TABLE feed_credentials DROP CONSTRAINT feed_credentials_pkey;
+ALTER TABLE feed_credentials ADD PRIMARY KEY (feed_id);
@@ -0,0 +1,9 @@
+-- credentials belong to the user that set them, and are only used to scrape a
+-- private feed of theirs, so no follower of a shared feed is shown what
+-- another's account can see. Those set on shared feeds are dropped, setting
+-- them again moves the user onto a feed of their own
+DELETE FROM feed_credentials fc USING feeds f WHERE f.id = fc.feed_id AND f.public;
+
+ALTER TABLE feed_credentials DROP CONSTRAINT feed_credentials_pkey;
+ALTER TABLE feed_credentials ADD PRIMARY KEY (user_id, feed_id);
+CREATE INDEX feed_credentials_feed_id_idx ON feed_credentials (feed_id);
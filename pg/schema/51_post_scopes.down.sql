@@ -0,0 +1,20 @@
+ALTER TABLE pruned_posts DROP CONSTRAINT pruned_posts_pkey;
+UPDATE pruned_posts SET url = url || '#' || scope WHERE scope <> '';
+ALTER TABLE pruned_posts ADD PRIMARY KEY (url);
+ALTER TABLE pruned_posts DROP COLUMN scope;
+
+ALTER TABLE posts DROP CONSTRAINT posts_url_key;
+ALTER TABLE posts DROP CONSTRAINT posts_content_hash_key;
+DROP INDEX posts_external_id_uniq_idx;
+
+UPDATE posts
+SET url = url || '#' || scope,
+	content_hash = content_hash || ':' || scope,
+	external_id = external_id || '#' || scope
+WHERE scope <> '';
+
+ALTER TABLE posts ADD CONSTRAINT posts_url_key UNIQUE (url);
+ALTER TABLE posts ADD CONSTRAINT posts_content_hash_key UNIQUE (content_hash);
+CREATE UNIQUE INDEX posts_external_id_uniq_idx ON posts (external_id);
+
+ALTER TABLE posts DROP COLUMN scope;
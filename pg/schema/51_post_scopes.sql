@@ -0,0 +1,34 @@
+-- posts of private feeds, mail and those scraped with the credentials of their
+-- only follower, are kept apart from posts of other feeds with the same url,
+-- content or external ID by their scope, the ID of their feed, rather than by
+-- suffixing it to those columns, which broke links to anchors in the posts
+ALTER TABLE posts ADD COLUMN scope TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE posts DROP CONSTRAINT posts_url_key;
+ALTER TABLE posts DROP CONSTRAINT posts_content_hash_key;
+DROP INDEX posts_external_id_uniq_idx;
+
+UPDATE posts p
+SET scope = f.id::text,
+	url = CASE WHEN right(p.url, 37) = '#' || f.id THEN left(p.url, -37) ELSE p.url END,
+	content_hash = CASE WHEN right(p.content_hash::text, 37) = ':' || f.id THEN left(p.content_hash::text, -37) ELSE p.content_hash::text END,
+	external_id = CASE WHEN right(p.external_id, 37) = '#' || f.id THEN left(p.external_id, -37) ELSE p.external_id END
+FROM feeds f
+WHERE f.id = p.feed_id
+AND NOT f.public;
+
+ALTER TABLE posts ADD CONSTRAINT posts_url_key UNIQUE (url, scope);
+ALTER TABLE posts ADD CONSTRAINT posts_content_hash_key UNIQUE (content_hash, scope);
+CREATE UNIQUE INDEX posts_external_id_uniq_idx ON posts (external_id, scope);
+
+ALTER TABLE pruned_posts ADD COLUMN scope TEXT NOT NULL DEFAULT '';
+ALTER TABLE pruned_posts DROP CONSTRAINT pruned_posts_pkey;
+
+UPDATE pruned_posts pp
+SET scope = f.id::text,
+	url = CASE WHEN right(pp.url, 37) = '#' || f.id THEN left(pp.url, -37) ELSE pp.url END
+FROM feeds f
+WHERE f.id = pp.feed_id
+AND NOT f.public;
+
+ALTER TABLE pruned_posts ADD PRIMARY KEY (url, scope);
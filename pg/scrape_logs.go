@@ -0,0 +1,81 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fortytw2/hydrocarbon/discollect"
+)
+
+// scrape logs older than this are deleted by the Maintainer
+const scrapeLogRetention = 14 * 24 * time.Hour
+
+// WriteLogs saves the log entries of a single task
+func (db *DB) WriteLogs(ctx context.Context, entries []*discollect.LogEntry) error {
+	return db.withTx(ctx, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO scrape_logs
+		(scrape_id, task_id, url, status_code, duration_ms, bytes, error, created_at)
+		VALUES
+		($1, $2, $3, NULLIF($4, 0), $5, $6, NULLIF($7, ''), $8);`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, e := range entries {
+			_, err = stmt.ExecContext(ctx, e.ScrapeID, e.TaskID, e.URL, e.StatusCode,
+				e.Duration.Nanoseconds()/int64(time.Millisecond), e.Bytes, e.Error, e.At)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetLogs returns the log entries of a scrape, oldest first
+func (db *DB) GetLogs(ctx context.Context, scrapeID uuid.UUID, limit, offset int) ([]*discollect.LogEntry, error) {
+	rows, err := db.sql.QueryContext(ctx, `
+	SELECT scrape_id, task_id, url, coalesce(status_code, 0), duration_ms, bytes, coalesce(error, ''), created_at
+	FROM scrape_logs
+	WHERE scrape_id = $1
+	ORDER BY id ASC
+	LIMIT $2 OFFSET $3;`, scrapeID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]*discollect.LogEntry, 0)
+	for rows.Next() {
+		var e discollect.LogEntry
+		var durationMS int64
+		err = rows.Scan(&e.ScrapeID, &e.TaskID, &e.URL, &e.StatusCode, &durationMS, &e.Bytes, &e.Error, &e.At)
+		if err != nil {
+			return nil, err
+		}
+
+		e.Duration = time.Duration(durationMS) * time.Millisecond
+		entries = append(entries, &e)
+	}
+
+	return entries, rows.Err()
+}
+
+// PruneScrapeLogs deletes scrape logs written before olderThan ago, returning
+// how many were deleted
+func (db *DB) PruneScrapeLogs(ctx context.Context, olderThan time.Duration) (int64, error) {
+	res, err := db.sql.ExecContext(ctx, `
+	DELETE FROM scrape_logs
+	WHERE created_at < now() - $1 * interval '1 second';`, olderThan.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
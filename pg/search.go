@@ -0,0 +1,165 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"html"
+
+	"github.com/lib/pq"
+	"github.com/microcosm-cc/bluemonday"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+// posts written before search existed are indexed this many at a time, each
+// time the maintainer runs
+const indexBatchSize = 2000
+
+var textPolicy = bluemonday.StrictPolicy()
+
+// searchText returns the text of an html body, as it is indexed for search
+func searchText(body string) string {
+	return html.UnescapeString(textPolicy.Sanitize(body))
+}
+
+// searchBody returns what of body is indexed for search, nothing while bodies
+// are encrypted, as the index would keep their words in the clear. Posts are
+// then only searched by their title and author
+func (db *DB) searchBody(body string) string {
+	if db.bodyKeyID() != "" {
+		return ""
+	}
+
+	return searchText(body)
+}
+
+// SearchPosts returns the posts of feeds the user follows, or merged from them,
+// matching query, best match first and without bodies. query is in the syntax
+// of web search engines, "quoted phrases", -excluded words and or are supported
+func (db *DB) SearchPosts(ctx context.Context, sessionKey, query string, limit, offset int) ([]*hydrocarbon.Post, error) {
+	rows, err := db.sql.QueryContext(ctx, `
+	SELECT po.id, COALESCE(pov.title, po.title), COALESCE(pov.author, po.author), po.url, po.posted_at, pov.tags,
+		(EXISTS(SELECT 1 FROM read_statuses WHERE post_id = po.id AND user_id = s.user_id)),
+		(EXISTS(SELECT 1 FROM post_stars WHERE post_id = po.id AND user_id = s.user_id))
+	FROM posts po
+	JOIN sessions s ON (s.key = $1 AND s.active = TRUE)
+	LEFT JOIN post_overlays pov ON (pov.post_id = po.id AND pov.user_id = s.user_id)
+	WHERE po.search @@ websearch_to_tsquery('english', $2)
+	AND po.deleted_at IS NULL
+	AND NOT EXISTS (SELECT 1 FROM feeds WHERE id = po.feed_id AND deleted_at IS NOT NULL)
+	AND EXISTS (SELECT 1 FROM feed_folders ff WHERE ff.user_id = s.user_id
+		AND (ff.feed_id = po.feed_id OR ff.feed_id IN (SELECT feed_id FROM post_sources WHERE post_id = po.id)))
+	ORDER BY ts_rank(po.search, websearch_to_tsquery('english', $2)) DESC, po.posted_at DESC
+	LIMIT $3 OFFSET $4;`, sessionKey, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := make([]*hydrocarbon.Post, 0)
+	for rows.Next() {
+		var p hydrocarbon.Post
+		err = rows.Scan(&p.ID, &p.Title, &p.Author, &p.OriginalURL, &p.PostedAt, pq.Array(&p.Tags), &p.Read, &p.Starred)
+		if err != nil {
+			return nil, err
+		}
+
+		posts = append(posts, &p)
+	}
+
+	return posts, rows.Err()
+}
+
+// MatchPosts returns the IDs of the given posts that match query, in the same
+// syntax as SearchPosts. Posts that are not yet indexed never match
+func (db *DB) MatchPosts(ctx context.Context, query string, postIDs []string) ([]string, error) {
+	rows, err := db.sql.QueryContext(ctx, `
+	SELECT id
+	FROM posts
+	WHERE id = ANY($1::uuid[])
+	AND search @@ websearch_to_tsquery('english', $2);`, pq.Array(postIDs), query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matched := make([]string, 0)
+	for rows.Next() {
+		var id string
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		matched = append(matched, id)
+	}
+
+	return matched, rows.Err()
+}
+
+// IndexPostBodies indexes up to limit posts written before search existed,
+// oldest first, and returns how many it indexed. Their bodies have to be
+// decompressed, so it cannot be done by the migration that added search.
+// While bodies are encrypted only their titles and authors are indexed
+func (db *DB) IndexPostBodies(ctx context.Context, limit int) (n int, err error) {
+	err = db.withTx(ctx, func(tx *sql.Tx) error {
+		// see the posts_updated_at trigger
+		_, err := tx.ExecContext(ctx, `SET LOCAL hydrocarbon.indexing = 'on';`)
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.QueryContext(ctx, `
+		SELECT po.id, COALESCE(pb.body, po.body)
+		FROM posts po
+		LEFT JOIN post_bodies pb ON (pb.hash = po.body_hash)
+		WHERE po.search IS NULL
+		ORDER BY po.created_at ASC
+		LIMIT $1
+		FOR UPDATE OF po SKIP LOCKED;`, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		bodies := make(map[string]string)
+		for rows.Next() {
+			var id, body string
+			err = rows.Scan(&id, &body)
+			if err != nil {
+				return err
+			}
+
+			bodies[id] = body
+		}
+
+		err = rows.Err()
+		if err != nil {
+			return err
+		}
+		rows.Close()
+
+		for id, compressed := range bodies {
+			body, err := db.loadBody(ctx, compressed)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, `
+			UPDATE posts
+			SET search_body = $2
+			WHERE id = $1;`, id, db.searchBody(body))
+			if err != nil {
+				return err
+			}
+		}
+
+		n = len(bodies)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
@@ -0,0 +1,23 @@
+package pg
+
+import "testing"
+
+func TestSearchText(t *testing.T) {
+	t.Parallel()
+
+	var cases = []struct {
+		body string
+		text string
+	}{
+		{`<p>plain</p>`, `plain`},
+		{`<p>fish &amp; chips</p>`, `fish & chips`},
+		{`<a href="https://example.com/x">a link</a><img src="x.png">`, `a link`},
+		{`<script>alert("no")</script>body`, `body`},
+	}
+
+	for _, c := range cases {
+		if text := searchText(c.body); text != c.text {
+			t.Errorf("searchText(%q) = %q, expected %q", c.body, text, c.text)
+		}
+	}
+}
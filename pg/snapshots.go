@@ -0,0 +1,86 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/fortytw2/hydrocarbon/discollect"
+)
+
+// PutSnapshot stores a raw response, replacing any earlier capture of the same
+// url during the same scrape
+func (db *DB) PutSnapshot(ctx context.Context, s *discollect.Snapshot) error {
+	header, err := json.Marshal(s.Header)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.sql.ExecContext(ctx, `
+	INSERT INTO snapshots
+	(scrape_id, url, created_at, status_code, header, body)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (scrape_id, url) DO UPDATE
+	SET (created_at, status_code, header, body) = (EXCLUDED.created_at, EXCLUDED.status_code, EXCLUDED.header, EXCLUDED.body);`,
+		s.ScrapeID, s.URL, s.CapturedAt, s.StatusCode, header, s.Body)
+	return err
+}
+
+// GetSnapshot returns the raw response captured for url during a scrape
+func (db *DB) GetSnapshot(ctx context.Context, scrapeID uuid.UUID, url string) (*discollect.Snapshot, error) {
+	row := db.sql.QueryRowContext(ctx, `
+	SELECT created_at, status_code, header, body
+	FROM snapshots
+	WHERE scrape_id = $1 AND url = $2;`, scrapeID, url)
+
+	s := discollect.Snapshot{
+		ScrapeID: scrapeID,
+		URL:      url,
+	}
+
+	var header []byte
+	err := row.Scan(&s.CapturedAt, &s.StatusCode, &header, &s.Body)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, discollect.ErrNoSnapshot
+		}
+		return nil, err
+	}
+
+	s.Header = make(http.Header)
+	err = json.Unmarshal(header, &s.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// GetScrape returns a single scrape
+func (db *DB) GetScrape(ctx context.Context, id uuid.UUID) (*discollect.Scrape, error) {
+	row := db.sql.QueryRowContext(ctx, `
+	SELECT id, feed_id, plugin, config, created_at, scheduled_start_at,
+		started_at, ended_at, state, errors,
+		total_datums, total_retries, total_tasks, total_timeouts, priority, last_failed_url, circuit_opens
+	FROM scrapes
+	WHERE id = $1;`, id)
+
+	var rs discollect.Scrape
+	err := row.Scan(&rs.ID, &rs.FeedID, &rs.Plugin, &rs.Config, &rs.CreatedAt,
+		&rs.ScheduledStartAt, &rs.StartedAt, &rs.EndedAt,
+		&rs.State, pq.Array(&rs.Errors),
+		&rs.TotalDatums, &rs.TotalRetries, &rs.TotalTasks, &rs.TotalTimeouts, &rs.Priority, &rs.LastFailedURL, pq.Array(&rs.CircuitOpens))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("no scrape exists with that id")
+		}
+		return nil, err
+	}
+
+	return &rs, nil
+}
@@ -0,0 +1,483 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// tenantPrefix starts the schema of every tenant, so a tenant can never be
+// given the schema of postgres or of another program
+const tenantPrefix = "tenant_"
+
+var tenantName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,39}$`)
+
+// A Tenant is an organization whose data is kept in a postgres schema of its
+// own, see WithTenants
+type Tenant struct {
+	Name      string    `json:"name"`
+	Schema    string    `json:"schema"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type tenantKey struct{}
+
+// TenantContext returns a copy of ctx whose statements are run in the schema
+// of tenant, by a DB given WithTenants. The empty tenant is the default schema,
+// public unless the search_path of the database says otherwise
+func TenantContext(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// tenantSchema returns the schema of tenant, empty for the default schema
+func tenantSchema(tenant string) string {
+	if tenant == "" {
+		return ""
+	}
+
+	return tenantPrefix + tenant
+}
+
+// tenantOfSchema returns the tenant whose schema is schema, empty for any
+// schema that is not a tenant's
+func tenantOfSchema(schema string) string {
+	if !strings.HasPrefix(schema, tenantPrefix) {
+		return ""
+	}
+
+	return strings.TrimPrefix(schema, tenantPrefix)
+}
+
+// searchPath returns the statement setting the search_path to schema, or
+// back to its default for the default schema. The public schema stays on the
+// search_path of tenants, as it holds the extensions every schema uses
+func searchPath(schema string) string {
+	if schema == "" {
+		return `RESET search_path;`
+	}
+
+	return fmt.Sprintf(`SET search_path TO %s, public;`, pq.QuoteIdentifier(schema))
+}
+
+// tenantOf returns the tenant statements made with ctx are run for
+func (db *DB) tenantOf(ctx context.Context) string {
+	if t, ok := ctx.Value(tenantKey{}).(string); ok {
+		return t
+	}
+
+	return db.tenant
+}
+
+// verifyTenantTables creates the tables listing tenants, who belongs to each
+// and the login tokens and session keys made for them. They are kept in the
+// public schema, apart from the migrated tables of every tenant
+func verifyTenantTables(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `
+	CREATE TABLE IF NOT EXISTS public.tenants (
+		name TEXT PRIMARY KEY,
+		schema TEXT NOT NULL UNIQUE,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+
+	CREATE TABLE IF NOT EXISTS public.tenant_members (
+		email CITEXT PRIMARY KEY,
+		tenant TEXT NOT NULL REFERENCES public.tenants (name) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS public.tenant_keys (
+		key TEXT PRIMARY KEY,
+		tenant TEXT NOT NULL REFERENCES public.tenants (name) ON DELETE CASCADE,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);`)
+	return err
+}
+
+// tenantSchemas returns the schemas of every tenant, none before the first
+// tenant is created
+func tenantSchemas(ctx context.Context, conn *sql.Conn) ([]string, error) {
+	var exists bool
+	err := conn.QueryRowContext(ctx, `SELECT to_regclass('public.tenants') IS NOT NULL;`).Scan(&exists)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT schema FROM public.tenants ORDER BY name;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schemas []string
+	for rows.Next() {
+		var s string
+		err = rows.Scan(&s)
+		if err != nil {
+			return nil, err
+		}
+
+		schemas = append(schemas, s)
+	}
+
+	return schemas, rows.Err()
+}
+
+// CreateTenant creates a schema for a new tenant and runs every migration in
+// it. Tenant names are lowercase letters, digits and underscores
+func (m *Migrator) CreateTenant(ctx context.Context, name string) error {
+	if !tenantName.MatchString(name) {
+		return fmt.Errorf("pg: invalid tenant name %q, use lowercase letters, digits and underscores", name)
+	}
+
+	conn, unlock, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = verifyTenantTables(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	// tenants are migrated from the public schema, so it has to be current
+	ms, err := status(ctx, conn)
+	if err != nil {
+		return err
+	}
+	for _, mi := range ms {
+		if mi.AppliedAt.IsZero() {
+			return errors.New("pg: migrations are pending, run them before creating a tenant")
+		}
+	}
+
+	schema := tenantSchema(name)
+	err = runTx(ctx, conn, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+		INSERT INTO public.tenants
+		(name, schema)
+		VALUES ($1, $2);`, name, schema)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `CREATE SCHEMA `+pq.QuoteIdentifier(schema)+`;`)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	defer conn.ExecContext(context.Background(), searchPath(""))
+	err = useSchema(ctx, conn, schema)
+	if err != nil {
+		return err
+	}
+
+	_, err = up(ctx, conn, schema)
+	return err
+}
+
+// ListTenants lists every tenant, by name
+func (m *Migrator) ListTenants(ctx context.Context) ([]*Tenant, error) {
+	conn, err := m.sql.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	err = verifyTenantTables(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.QueryContext(ctx, `
+	SELECT name, schema, created_at
+	FROM public.tenants
+	ORDER BY name;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tenants := make([]*Tenant, 0)
+	for rows.Next() {
+		var t Tenant
+		err = rows.Scan(&t.Name, &t.Schema, &t.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		tenants = append(tenants, &t)
+	}
+
+	return tenants, rows.Err()
+}
+
+// AddTenantMember has the user with email log in to tenant, rather than to
+// the public schema or any tenant they belonged to before
+func (db *DB) AddTenantMember(ctx context.Context, tenant, email string) error {
+	_, err := db.sql.ExecContext(ctx, `
+	INSERT INTO public.tenant_members
+	(email, tenant)
+	VALUES ($1, $2)
+	ON CONFLICT (email) DO UPDATE SET tenant = EXCLUDED.tenant;`, email, tenant)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code.Name() == "foreign_key_violation" {
+		return errors.New("tenant not found")
+	}
+
+	return err
+}
+
+// TenantForEmail returns the tenant the user with email belongs to, empty for
+// those belonging to none
+func (db *DB) TenantForEmail(ctx context.Context, email string) (string, error) {
+	var tenant string
+	err := db.sql.QueryRowContext(ctx, `
+	SELECT tenant
+	FROM public.tenant_members
+	WHERE email = $1;`, email).Scan(&tenant)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	return tenant, err
+}
+
+// TenantForKey returns the tenant a login token, session key, Fever key or
+// stripe customer was made for, empty for those of the public schema and keys
+// that do not exist
+func (db *DB) TenantForKey(ctx context.Context, key string) (string, error) {
+	var tenant string
+	err := db.sql.QueryRowContext(ctx, `
+	SELECT tenant
+	FROM public.tenant_keys
+	WHERE key = $1;`, key).Scan(&tenant)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	return tenant, err
+}
+
+// recordTenantKey records the tenant a login token, session key, Fever key or
+// stripe customer was made for, so TenantForKey finds it
+func (db *DB) recordTenantKey(ctx context.Context, key string) error {
+	tenant := db.tenantOf(ctx)
+	if !db.tenants || tenant == "" {
+		return nil
+	}
+
+	_, err := db.sql.ExecContext(ctx, `
+	INSERT INTO public.tenant_keys
+	(key, tenant)
+	VALUES ($1, $2)
+	ON CONFLICT (key) DO UPDATE SET tenant = EXCLUDED.tenant;`, key, tenant)
+	return err
+}
+
+// EnableTenants creates the tables tenants are resolved from, if they do not
+// exist yet
+func (db *DB) EnableTenants(ctx context.Context) error {
+	conn, err := db.sql.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return verifyTenantTables(ctx, conn)
+}
+
+// tenantConnector opens connections that switch schemas with the tenant of
+// each statement
+type tenantConnector struct {
+	driver.Connector
+	tenant string
+}
+
+func (c *tenantConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tenantConn{Conn: conn, tenant: c.tenant}, nil
+}
+
+// tenantConn sets the search_path to the schema of the tenant of the context
+// of each statement, or of its own tenant for contexts without one, before
+// running it. Transactions stay in the schema they began in
+type tenantConn struct {
+	driver.Conn
+	tenant string
+
+	// schema is that of the current search_path, once set is true
+	schema string
+	set    bool
+	inTx   bool
+}
+
+func (c *tenantConn) use(ctx context.Context) error {
+	if c.inTx {
+		return nil
+	}
+
+	tenant := c.tenant
+	if t, ok := ctx.Value(tenantKey{}).(string); ok {
+		tenant = t
+	}
+
+	schema := tenantSchema(tenant)
+	if c.set && schema == c.schema {
+		return nil
+	}
+
+	err := c.exec(ctx, searchPath(schema))
+	c.schema, c.set = schema, err == nil
+	return err
+}
+
+// exec runs query on the wrapped connection, preparing it first when the
+// connection can not run statements directly
+func (c *tenantConn) exec(ctx context.Context, query string) error {
+	if e, ok := c.Conn.(driver.ExecerContext); ok {
+		_, err := e.ExecContext(ctx, query, nil)
+		return err
+	}
+
+	stmt, err := c.Conn.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(nil)
+	return err
+}
+
+func (c *tenantConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	err := c.use(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	return q.QueryContext(ctx, query, args)
+}
+
+func (c *tenantConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	err := c.use(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	return e.ExecContext(ctx, query, args)
+}
+
+func (c *tenantConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	err := c.use(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p, ok := c.Conn.(driver.ConnPrepareContext)
+	if !ok {
+		return c.Conn.Prepare(query)
+	}
+
+	return p.PrepareContext(ctx, query)
+}
+
+func (c *tenantConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	err := c.use(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx driver.Tx
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		tx, err = b.BeginTx(ctx, opts)
+	} else if opts.Isolation != 0 || opts.ReadOnly {
+		err = errors.New("pg: driver does not support transaction options")
+	} else {
+		tx, err = c.Conn.Begin()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.inTx = true
+	return &tenantTx{Tx: tx, c: c}, nil
+}
+
+// the rest pass on to the wrapped connection when it implements them, and
+// otherwise do what database/sql does for drivers that do not, as older
+// versions of lib/pq implement none of them
+
+func (c *tenantConn) Ping(ctx context.Context) error {
+	p, ok := c.Conn.(driver.Pinger)
+	if !ok {
+		return nil
+	}
+
+	return p.Ping(ctx)
+}
+
+func (c *tenantConn) ResetSession(ctx context.Context) error {
+	r, ok := c.Conn.(driver.SessionResetter)
+	if !ok {
+		return nil
+	}
+
+	return r.ResetSession(ctx)
+}
+
+func (c *tenantConn) IsValid() bool {
+	v, ok := c.Conn.(driver.Validator)
+	if !ok {
+		return true
+	}
+
+	return v.IsValid()
+}
+
+func (c *tenantConn) CheckNamedValue(nv *driver.NamedValue) error {
+	nvc, ok := c.Conn.(driver.NamedValueChecker)
+	if !ok {
+		return driver.ErrSkip
+	}
+
+	return nvc.CheckNamedValue(nv)
+}
+
+// tenantTx lets its connection switch schemas again once it is done
+type tenantTx struct {
+	driver.Tx
+	c *tenantConn
+}
+
+func (t *tenantTx) Commit() error {
+	t.c.inTx = false
+	return t.Tx.Commit()
+}
+
+func (t *tenantTx) Rollback() error {
+	t.c.inTx = false
+	return t.Tx.Rollback()
+}
@@ -0,0 +1,91 @@
+package pg
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+)
+
+// bareConn implements only driver.Conn, like the connections of older
+// versions of lib/pq, and records the statements it prepares
+type bareConn struct {
+	prepared []string
+	begun    int
+}
+
+func (c *bareConn) Prepare(query string) (driver.Stmt, error) {
+	c.prepared = append(c.prepared, query)
+	return bareStmt{}, nil
+}
+
+func (c *bareConn) Close() error { return nil }
+
+func (c *bareConn) Begin() (driver.Tx, error) {
+	c.begun++
+	return bareTx{}, nil
+}
+
+type bareStmt struct{}
+
+func (bareStmt) Close() error                                    { return nil }
+func (bareStmt) NumInput() int                                   { return -1 }
+func (bareStmt) Exec(args []driver.Value) (driver.Result, error) { return driver.ResultNoRows, nil }
+func (bareStmt) Query(args []driver.Value) (driver.Rows, error)  { return nil, driver.ErrSkip }
+
+type bareTx struct{}
+
+func (bareTx) Commit() error   { return nil }
+func (bareTx) Rollback() error { return nil }
+
+func TestTenantConnFallbacks(t *testing.T) {
+	t.Parallel()
+
+	bc := &bareConn{}
+	c := &tenantConn{Conn: bc, tenant: "acme"}
+	ctx := context.Background()
+
+	if err := c.Ping(ctx); err != nil {
+		t.Fatalf("expected ping to pass, got %v", err)
+	}
+	if err := c.ResetSession(ctx); err != nil {
+		t.Fatalf("expected session reset to pass, got %v", err)
+	}
+	if !c.IsValid() {
+		t.Fatal("expected connection to be valid")
+	}
+	if err := c.CheckNamedValue(&driver.NamedValue{Value: 1}); err != driver.ErrSkip {
+		t.Fatalf("expected default value checks, got %v", err)
+	}
+
+	_, err := c.ExecContext(ctx, "SELECT 1", nil)
+	if err != driver.ErrSkip {
+		t.Fatalf("expected exec to be skipped, got %v", err)
+	}
+	if len(bc.prepared) != 1 || bc.prepared[0] != searchPath(tenantSchema("acme")) {
+		t.Fatalf("expected the search_path to be prepared, got %v", bc.prepared)
+	}
+
+	_, err = c.PrepareContext(ctx, "SELECT 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bc.prepared) != 2 || bc.prepared[1] != "SELECT 2" {
+		t.Fatalf("expected the query to be prepared, got %v", bc.prepared)
+	}
+
+	_, err = c.BeginTx(ctx, driver.TxOptions{ReadOnly: true})
+	if err == nil {
+		t.Fatal("expected read only transactions to be refused")
+	}
+
+	tx, err := c.BeginTx(ctx, driver.TxOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bc.begun != 1 {
+		t.Fatalf("expected one transaction, got %d", bc.begun)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
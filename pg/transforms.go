@@ -0,0 +1,169 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/lib/pq"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+// SetFeedTransform sets or removes the users transform for a feed they
+// follow, dropping everything the previous script output
+func (db *DB) SetFeedTransform(ctx context.Context, sessionKey, feedID, script string) error {
+	err := db.withTx(ctx, func(tx *sql.Tx) error {
+		var userID string
+		err := tx.QueryRowContext(ctx, `
+		SELECT s.user_id
+		FROM sessions s
+		WHERE s.key = $1
+		AND EXISTS (SELECT 1 FROM feed_folders ff WHERE ff.user_id = s.user_id AND ff.feed_id = $2);`, sessionKey, feedID).Scan(&userID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("feed not found")
+			}
+			return err
+		}
+
+		if script == "" {
+			_, err = tx.ExecContext(ctx, `
+			DELETE FROM feed_transforms
+			WHERE user_id = $1
+			AND feed_id = $2;`, userID, feedID)
+		} else {
+			_, err = tx.ExecContext(ctx, `
+			INSERT INTO feed_transforms
+			(user_id, feed_id, script)
+			VALUES
+			($1, $2, $3)
+			ON CONFLICT (user_id, feed_id) DO UPDATE SET script = EXCLUDED.script, last_error = '';`, userID, feedID, script)
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+		DELETE FROM post_overlays
+		WHERE user_id = $1
+		AND feed_id = $2;`, userID, feedID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	db.invalidateSession(ctx, sessionKey)
+	return nil
+}
+
+// GetFeedTransform returns the users transform for a feed, with an empty
+// script if they have none
+func (db *DB) GetFeedTransform(ctx context.Context, sessionKey, feedID string) (*hydrocarbon.FeedTransform, error) {
+	row := db.sql.QueryRowContext(ctx, `
+	SELECT script, last_error, updated_at
+	FROM feed_transforms
+	WHERE user_id = (SELECT user_id FROM sessions WHERE key = $1)
+	AND feed_id = $2;`, sessionKey, feedID)
+
+	ft := &hydrocarbon.FeedTransform{FeedID: feedID}
+	err := row.Scan(&ft.Script, &ft.LastError, &ft.UpdatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	return ft, nil
+}
+
+// applyTransforms runs the transform of every user following the feed of a
+// newly written post, saving the output as an overlay of the post. Failures
+// are recorded against the transform rather than failing the write
+func (db *DB) applyTransforms(ctx context.Context, postID, feedID string, p *hydrocarbon.Post) error {
+	rows, err := db.sql.QueryContext(ctx, `
+	SELECT ft.user_id, ft.script
+	FROM feed_transforms ft
+	WHERE ft.feed_id = $1
+	AND EXISTS (SELECT 1 FROM feed_folders ff WHERE ff.user_id = ft.user_id AND ff.feed_id = ft.feed_id);`, feedID)
+	if err != nil {
+		return err
+	}
+
+	type transform struct {
+		userID, script string
+	}
+
+	var transforms []transform
+	for rows.Next() {
+		var t transform
+		err = rows.Scan(&t.userID, &t.script)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		transforms = append(transforms, t)
+	}
+	rows.Close()
+
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	for _, t := range transforms {
+		out, err := runTransform(ctx, t.script, p)
+		if err != nil {
+			_, err = db.sql.ExecContext(ctx, `
+			UPDATE feed_transforms
+			SET last_error = $3
+			WHERE user_id = $1
+			AND feed_id = $2;`, t.userID, feedID, err.Error())
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		tags := out.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+
+		body, err := db.compress(out.Body)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.sql.ExecContext(ctx, `
+		INSERT INTO post_overlays
+		(user_id, post_id, feed_id, title, author, body, tags)
+		VALUES
+		($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id, post_id) DO UPDATE SET title = EXCLUDED.title, author = EXCLUDED.author, body = EXCLUDED.body, tags = EXCLUDED.tags;`,
+			t.userID, postID, feedID, out.Title, out.Author, body, pq.Array(tags))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func runTransform(ctx context.Context, script string, p *hydrocarbon.Post) (*hydrocarbon.Post, error) {
+	t, err := hydrocarbon.CompileTransform(script)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.Apply(ctx, p)
+}
+
+// transform applies transforms to a post that has already been written, so
+// failures are only logged
+func (db *DB) transform(ctx context.Context, postID, feedID string, p *hydrocarbon.Post) {
+	err := db.applyTransforms(ctx, postID, feedID, p)
+	if err != nil {
+		log.Println("pg: could not apply transforms to post", postID, err)
+	}
+}
@@ -0,0 +1,46 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// a beginner is a *sql.DB or a *sql.Conn
+type beginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// withTx runs fn in a transaction, see runTx
+func (db *DB) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return runTx(ctx, db.sql, fn)
+}
+
+// runTx runs fn in a transaction begun on b. It is committed only if fn returns
+// nil, and rolled back if fn returns an error or panics, so every statement of
+// fn is made or none are. Rows fn queries must be closed before it returns
+func runTx(ctx context.Context, b beginner, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := b.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	err = fn(tx)
+	if err != nil {
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			return fmt.Errorf("err: %s, rollbackErr: %s", err, rollbackErr)
+		}
+
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,27 @@
+package hydrocarbon
+
+import (
+	"net/http"
+
+	"github.com/fortytw2/hydrocarbon/discollect"
+)
+
+// PluginAPI describes the plugins feeds can be added with
+type PluginAPI struct {
+	dc *discollect.Discollector
+}
+
+// NewPluginAPI returns a new PluginAPI, dc only needs its plugins registered,
+// so api only nodes can list them too
+func NewPluginAPI(dc *discollect.Discollector) *PluginAPI {
+	return &PluginAPI{
+		dc: dc,
+	}
+}
+
+// ListPlugins writes out every registered plugin with the url patterns it
+// accepts and the schema of its configs, so the add-feed UI can show which
+// sites are supported
+func (pa *PluginAPI) ListPlugins(w http.ResponseWriter, r *http.Request) error {
+	return writeSuccess(w, pa.dc.Plugins())
+}
@@ -0,0 +1,170 @@
+package external
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+)
+
+// the test binary is also the plugin, it serves testPlugin when started by
+// Load
+func TestMain(m *testing.M) {
+	if os.Getenv(cookieKey) == cookieValue {
+		err := Serve(testPlugin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+var testPlugin = &dc.Plugin{
+	Name:          "echo",
+	Entrypoints:   []string{`^https?:\/\/`},
+	ConfigVersion: 2,
+	ConfigCreator: func(url string, ho *dc.HandlerOpts) (string, *dc.Config, error) {
+		body, _, err := get(ho.Client, url)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return body, &dc.Config{
+			Type:        dc.FullScrape,
+			Entrypoints: []string{url},
+			Version:     2,
+		}, nil
+	},
+	Routes: map[string]dc.Handler{
+		`^https?:\/\/[^/]+\/page$`: func(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+			body, final, err := get(ho.Client, t.URL)
+			if err != nil {
+				return dc.ErrorResponse(err)
+			}
+
+			return dc.Response([]interface{}{&hydrocarbon.Post{
+				URL:   final,
+				Title: body,
+				// the secret is not passed to plugins, this should be empty
+				Body: os.Getenv("HYDROCARBON_TEST_SECRET"),
+			}}, &dc.Task{URL: final + "/next"})
+		},
+		`^https?:\/\/[^/]+\/crash$`: func(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+			os.Exit(2)
+			return nil
+		},
+		`^https?:\/\/[^/]+\/panic$`: func(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+			panic("oh no")
+		},
+	},
+}
+
+func get(c *http.Client, url string) (string, string, error) {
+	resp, err := c.Get(url)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", "", err
+	}
+
+	return string(body), resp.Request.URL.String(), nil
+}
+
+func TestExternalPlugin(t *testing.T) {
+	os.Setenv("HYDROCARBON_TEST_SECRET", "hunter2")
+	defer os.Unsetenv("HYDROCARBON_TEST_SECRET")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/page", http.StatusMovedPermanently)
+		default:
+			fmt.Fprintf(w, "hello from %s", r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+
+	proc, err := Load(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proc.Close()
+
+	p := proc.Plugin
+	if p.Name != "echo" || p.ConfigVersion != 2 || len(p.Routes) != 3 {
+		t.Fatalf("plugin was not described, got %+v", p)
+	}
+	if p.ExternalID != nil || p.Backfill != nil {
+		t.Error("expected no ExternalID or Backfill for a plugin without them")
+	}
+
+	ho := &dc.HandlerOpts{Client: ts.Client()}
+
+	title, cfg, err := p.ConfigCreator(ts.URL+"/feed", ho)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title != "hello from /feed" || cfg.Version != 2 || cfg.Entrypoints[0] != ts.URL+"/feed" {
+		t.Errorf("unexpected config, got %q %+v", title, cfg)
+	}
+
+	handle := p.Routes[`^https?:\/\/[^/]+\/page$`]
+	resp := handle(context.Background(), ho, &dc.Task{URL: ts.URL + "/old"})
+	if len(resp.Errors) != 0 {
+		t.Fatal(resp.Errors)
+	}
+	if len(resp.Facts) != 1 || len(resp.Tasks) != 1 {
+		t.Fatalf("expected a post and a task, got %+v", resp)
+	}
+
+	post := resp.Facts[0].(*hydrocarbon.Post)
+	if post.URL != ts.URL+"/page" || post.Title != "hello from /page" {
+		t.Errorf("expected the page redirected to, got %+v", post)
+	}
+	if post.Body != "" {
+		t.Errorf("expected the environment of hydrocarbon to be hidden from the plugin, got %q", post.Body)
+	}
+	if resp.Tasks[0].URL != ts.URL+"/page/next" {
+		t.Errorf("unexpected task %+v", resp.Tasks[0])
+	}
+
+	resp = p.Routes[`^https?:\/\/[^/]+\/panic$`](context.Background(), ho, &dc.Task{URL: ts.URL + "/panic"})
+	if len(resp.Errors) != 1 {
+		t.Errorf("expected a panic to be returned as an error, got %+v", resp)
+	}
+
+	resp = p.Routes[`^https?:\/\/[^/]+\/crash$`](context.Background(), ho, &dc.Task{URL: ts.URL + "/crash"})
+	if len(resp.Errors) != 1 {
+		t.Errorf("expected a crash to be returned as an error, got %+v", resp)
+	}
+
+	// the next call restarts it
+	proc.mu.Lock()
+	exited := proc.exited
+	proc.mu.Unlock()
+	<-exited
+	resp = handle(context.Background(), ho, &dc.Task{URL: ts.URL + "/page"})
+	if len(resp.Errors) != 0 || len(resp.Facts) != 1 {
+		t.Errorf("expected the plugin to be restarted, got %+v", resp)
+	}
+}
+
+func TestServeByHand(t *testing.T) {
+	err := Serve(testPlugin)
+	if err != ErrNotStarted {
+		t.Errorf("expected a plugin run by hand to refuse to serve, got %v", err)
+	}
+}
@@ -0,0 +1,493 @@
+package external
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+)
+
+const (
+	// how long a started plugin has to announce its address
+	handshakeTimeout = 10 * time.Second
+	// how long ConfigCreator, ExternalID and Backfill calls may take, handlers
+	// run for the timeout of their task
+	callTimeout = 2 * time.Minute
+)
+
+var errClosed = errors.New("external: plugin is closed")
+
+// A Process is a plugin binary started by Load. It is restarted by the next
+// call made after it exits
+type Process struct {
+	// Plugin calls into the process, it is registered like any other plugin
+	Plugin *dc.Plugin
+
+	path  string
+	args  []string
+	token string
+
+	host     *grpc.Server
+	hostAddr string
+	calls    *callTable
+
+	mu     sync.Mutex
+	closed bool
+	cmd    *exec.Cmd
+	dir    string
+	conn   *grpc.ClientConn
+	exited chan struct{}
+}
+
+// Load starts the plugin binary at path and describes the plugin it serves.
+// It runs in an empty directory of its own, without the environment of
+// hydrocarbon and its secrets, and fetches every page through hydrocarbon.
+// It is not sandboxed otherwise, the binary has to be trusted as much as
+// hydrocarbon itself
+func Load(path string, args ...string) (*Process, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Process{
+		path:     path,
+		args:     args,
+		token:    token,
+		host:     newServer(token),
+		hostAddr: lis.Addr().String(),
+		calls:    newCallTable(),
+	}
+	p.host.RegisterService(&hostServiceDesc, p)
+	go p.host.Serve(lis)
+
+	conn, err := p.client()
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+
+	var info describeResponse
+	err = invoke(ctx, conn, token, pluginService, "Describe", &describeRequest{ProtocolVersion: ProtocolVersion}, &info)
+	if err != nil {
+		p.Close()
+		return nil, fmt.Errorf("external: could not describe %s: %s", path, err)
+	}
+
+	if info.ProtocolVersion != ProtocolVersion {
+		p.Close()
+		return nil, fmt.Errorf("external: %s speaks protocol %d, not %d", path, info.ProtocolVersion, ProtocolVersion)
+	}
+
+	p.Plugin = p.plugin(&info)
+	return p, nil
+}
+
+// plugin builds the plugin registered for the process from its description
+func (p *Process) plugin(info *describeResponse) *dc.Plugin {
+	plugin := &dc.Plugin{
+		Name:          info.Name,
+		RateLimit:     info.RateLimit,
+		Timeout:       info.Timeout,
+		Headers:       info.Headers,
+		Referer:       info.Referer,
+		IgnoreRobots:  info.IgnoreRobots,
+		Entrypoints:   info.Entrypoints,
+		ContentTypes:  info.ContentTypes,
+		ConfigSchema:  info.ConfigSchema,
+		ConfigVersion: info.ConfigVersion,
+		Scheduler:     dc.DefaultScheduler,
+		ConfigCreator: p.createConfig,
+		Routes:        make(map[string]dc.Handler, len(info.Routes)),
+	}
+
+	for _, route := range info.Routes {
+		plugin.Routes[route] = p.handler(route)
+	}
+
+	if info.HasExternalID {
+		plugin.ExternalID = p.externalID
+	}
+	if info.HasBackfill {
+		plugin.Backfill = p.backfill
+	}
+
+	return plugin
+}
+
+func (p *Process) createConfig(url string, ho *dc.HandlerOpts) (string, *dc.Config, error) {
+	call := p.calls.add(ho.Client)
+	defer p.calls.remove(call)
+
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+
+	var resp configResponse
+	err := p.invoke(ctx, "CreateConfig", &configRequest{
+		Call:        call,
+		URL:         url,
+		RouteParams: ho.RouteParams,
+	}, &resp)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if resp.Config == nil {
+		return "", nil, fmt.Errorf("external: %s returned no config for %s", p.Plugin.Name, url)
+	}
+
+	return resp.Title, resp.Config, nil
+}
+
+func (p *Process) externalID(url string, ho *dc.HandlerOpts) string {
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+
+	var resp externalIDResponse
+	err := p.invoke(ctx, "ExternalID", &externalIDRequest{
+		URL:         url,
+		RouteParams: ho.RouteParams,
+	}, &resp)
+	if err != nil {
+		log.Printf("external: %s could not find the external ID of %s: %s", p.Plugin.Name, url, err)
+		return ""
+	}
+
+	return resp.ID
+}
+
+func (p *Process) backfill(c *dc.Config) (*dc.Config, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+
+	var resp backfillResponse
+	err := p.invoke(ctx, "Backfill", &backfillRequest{Config: c}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Config == nil {
+		return nil, fmt.Errorf("external: %s returned no backfill config", p.Plugin.Name)
+	}
+
+	return resp.Config, nil
+}
+
+// handler returns the Handler of a route of the plugin
+func (p *Process) handler(route string) dc.Handler {
+	return func(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+		call := p.calls.add(ho.Client)
+		defer p.calls.remove(call)
+
+		var resp handleResponse
+		err := p.invoke(ctx, "Handle", &handleRequest{
+			Call:        call,
+			Route:       route,
+			RouteParams: ho.RouteParams,
+			Config:      ho.Config,
+			Task:        t,
+		}, &resp)
+		if err != nil {
+			return dc.ErrorResponse(err)
+		}
+
+		hr := &dc.HandlerResponse{Tasks: resp.Tasks}
+		for _, post := range resp.Posts {
+			hr.Facts = append(hr.Facts, post)
+		}
+		for _, e := range resp.Errors {
+			hr.Errors = append(hr.Errors, errors.New(e))
+		}
+
+		return hr
+	}
+}
+
+// fetch makes a request for the plugin, with the client of the call it was
+// made in
+func (p *Process) fetch(ctx context.Context, req *fetchRequest) (*fetchResponse, error) {
+	c := p.calls.get(req.Call)
+	if c == nil {
+		return nil, fmt.Errorf("external: fetch of %s made outside of any call", req.URL)
+	}
+
+	hreq, err := http.NewRequest(req.Method, req.URL, bytes.NewReader(req.Body))
+	if err != nil {
+		return nil, err
+	}
+	hreq.Header = req.Header
+	if hreq.Header == nil {
+		hreq.Header = make(http.Header)
+	}
+
+	resp, err := c.Do(hreq.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxFetchSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxFetchSize {
+		return nil, fmt.Errorf("external: %s is larger than %d bytes", req.URL, maxFetchSize)
+	}
+
+	return &fetchResponse{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       body,
+		URL:        resp.Request.URL.String(),
+	}, nil
+}
+
+// invoke calls a method of the plugin, restarting it first if it exited
+func (p *Process) invoke(ctx context.Context, name string, req, resp interface{}) error {
+	conn, err := p.client()
+	if err != nil {
+		return err
+	}
+
+	return invoke(ctx, conn, p.token, pluginService, name, req, resp)
+}
+
+// client returns the connection to the running process, starting it if it is
+// not running
+func (p *Process) client() (*grpc.ClientConn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, errClosed
+	}
+
+	if p.conn != nil {
+		select {
+		case <-p.exited:
+			log.Printf("external: %s exited, restarting it", p.path)
+			p.conn.Close()
+			os.RemoveAll(p.dir)
+			p.conn = nil
+		default:
+			return p.conn, nil
+		}
+	}
+
+	err := p.start()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.conn, nil
+}
+
+// start runs the binary and connects to the address it announces
+func (p *Process) start() error {
+	dir, err := ioutil.TempDir("", "hydrocarbon-plugin-")
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(p.path, p.args...)
+	cmd.Dir = dir
+	cmd.Env = []string{
+		cookieKey + "=" + cookieValue,
+		hostAddrKey + "=" + p.hostAddr,
+		tokenKey + "=" + p.token,
+		"HOME=" + dir,
+		"TMPDIR=" + dir,
+		"PATH=/usr/local/bin:/usr/bin:/bin",
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		os.RemoveAll(dir)
+		return fmt.Errorf("external: could not start %s: %s", p.path, err)
+	}
+
+	name := filepath.Base(p.path)
+	go logLines(name, stderr)
+
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+
+	out := bufio.NewReader(stdout)
+	addr, err := handshake(out, exited)
+	if err != nil {
+		cmd.Process.Kill()
+		os.RemoveAll(dir)
+		return fmt.Errorf("external: %s: %s", p.path, err)
+	}
+	// anything printed after the handshake is logged
+	go logLines(name, out)
+
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	defer cancel()
+
+	conn, err := dial(ctx, addr)
+	if err != nil {
+		cmd.Process.Kill()
+		os.RemoveAll(dir)
+		return fmt.Errorf("external: could not connect to %s: %s", p.path, err)
+	}
+
+	p.cmd = cmd
+	p.dir = dir
+	p.conn = conn
+	p.exited = exited
+	return nil
+}
+
+// handshake reads the address a plugin announces on its first line
+func handshake(stdout *bufio.Reader, exited <-chan struct{}) (string, error) {
+	lines := make(chan string, 1)
+	go func() {
+		line, _ := stdout.ReadString('\n')
+		lines <- line
+	}()
+
+	var line string
+	select {
+	case line = <-lines:
+	case <-exited:
+		return "", errors.New("exited before the handshake, is it a hydrocarbon plugin?")
+	case <-time.After(handshakeTimeout):
+		return "", errors.New("timed out waiting for the handshake")
+	}
+
+	parts := strings.Split(strings.TrimSpace(line), "|")
+	if len(parts) != 4 || parts[1] != "tcp" || parts[3] != "grpc" {
+		return "", fmt.Errorf("invalid handshake %q", line)
+	}
+
+	version, err := strconv.Atoi(parts[0])
+	if err != nil || version != ProtocolVersion {
+		return "", fmt.Errorf("speaks protocol %s, not %d", parts[0], ProtocolVersion)
+	}
+
+	host, _, err := net.SplitHostPort(parts[2])
+	if err != nil || !net.ParseIP(host).IsLoopback() {
+		return "", fmt.Errorf("must listen on loopback, not %s", parts[2])
+	}
+
+	return parts[2], nil
+}
+
+func logLines(name string, r io.Reader) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		log.Printf("external: %s: %s", name, s.Text())
+	}
+}
+
+// Close stops the process and the service it fetched through
+func (p *Process) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+
+	if p.conn != nil {
+		p.conn.Close()
+		p.cmd.Process.Kill()
+		<-p.exited
+		os.RemoveAll(p.dir)
+	}
+	p.host.Stop()
+
+	return nil
+}
+
+// a callTable holds the clients of the calls in flight, which the requests
+// made by the plugin while handling them are sent with
+type callTable struct {
+	mu      sync.Mutex
+	clients map[string]*http.Client
+}
+
+func newCallTable() *callTable {
+	return &callTable{clients: make(map[string]*http.Client)}
+}
+
+func (ct *callTable) add(c *http.Client) string {
+	id, err := newToken()
+	if err != nil {
+		// crypto/rand does not fail on any supported platform
+		panic(err)
+	}
+
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	ct.clients[id] = c
+	return id
+}
+
+func (ct *callTable) get(id string) *http.Client {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	return ct.clients[id]
+}
+
+func (ct *callTable) remove(id string) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	delete(ct.clients, id)
+}
+
+func newToken() (string, error) {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,262 @@
+// Package external runs plugins built as their own binaries, so community
+// plugins can be deployed without recompiling hydrocarbon.
+//
+// A plugin is an ordinary *discollect.Plugin whose main calls Serve. Started
+// by Load, it listens on a loopback port and announces it on stdout with a
+// single handshake line, PROTOCOL|tcp|ADDRESS|grpc, after which hydrocarbon
+// calls its ConfigCreator, ExternalID, Backfill and Routes over gRPC. Every
+// request the plugin makes is sent back through hydrocarbon, so it is rate
+// limited, polite and cached like those of built in plugins.
+package external
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+)
+
+// ProtocolVersion is bumped with every incompatible change to the messages
+// exchanged with plugins, both sides must agree on it
+const ProtocolVersion = 1
+
+const (
+	// plugins refuse to serve unless started with the cookie, so running one
+	// by hand explains itself instead of hanging
+	cookieKey   = "HYDROCARBON_PLUGIN"
+	cookieValue = "f0d6b4e1c5a8e0d1a7a4e3b2c9d8e7f6"
+	// the address of the Host service plugins fetch through
+	hostAddrKey = "HYDROCARBON_PLUGIN_HOST"
+	// the token both sides authorize their calls with
+	tokenKey = "HYDROCARBON_PLUGIN_TOKEN"
+
+	pluginService = "hydrocarbon.plugin.v1.Plugin"
+	hostService   = "hydrocarbon.plugin.v1.Host"
+
+	// messages are JSON, a fetched page is base64 encoded within them
+	codecName      = "json"
+	maxFetchSize   = 8 * 1024 * 1024
+	maxMessageSize = 4 * maxFetchSize
+)
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// jsonCodec encodes messages as JSON, so plugins need no generated code and
+// the types discollect already marshals are sent as is
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return codecName
+}
+
+type describeRequest struct {
+	ProtocolVersion int `json:"protocol_version"`
+}
+
+type describeResponse struct {
+	ProtocolVersion int `json:"protocol_version"`
+
+	Name          string           `json:"name"`
+	Entrypoints   []string         `json:"entrypoints"`
+	Routes        []string         `json:"routes"`
+	RateLimit     *dc.RateLimit    `json:"rate_limit,omitempty"`
+	Timeout       time.Duration    `json:"timeout,omitempty"`
+	Headers       http.Header      `json:"headers,omitempty"`
+	IgnoreRobots  bool             `json:"ignore_robots,omitempty"`
+	ContentTypes  []string         `json:"content_types,omitempty"`
+	ConfigSchema  string           `json:"config_schema,omitempty"`
+	ConfigVersion int              `json:"config_version,omitempty"`
+	Referer       dc.RefererPolicy `json:"referer,omitempty"`
+
+	HasExternalID bool `json:"has_external_id,omitempty"`
+	HasBackfill   bool `json:"has_backfill,omitempty"`
+}
+
+// Call is the ID of the call the requests of a plugin are made for, so they
+// are sent with the client of the scrape that made it
+type configRequest struct {
+	Call        string   `json:"call"`
+	URL         string   `json:"url"`
+	RouteParams []string `json:"route_params"`
+}
+
+type configResponse struct {
+	Title  string     `json:"title"`
+	Config *dc.Config `json:"config"`
+}
+
+type externalIDRequest struct {
+	URL         string   `json:"url"`
+	RouteParams []string `json:"route_params"`
+}
+
+type externalIDResponse struct {
+	ID string `json:"id"`
+}
+
+type backfillRequest struct {
+	Config *dc.Config `json:"config"`
+}
+
+type backfillResponse struct {
+	Config *dc.Config `json:"config"`
+}
+
+type handleRequest struct {
+	Call        string     `json:"call"`
+	Route       string     `json:"route"`
+	RouteParams []string   `json:"route_params"`
+	Config      *dc.Config `json:"config"`
+	Task        *dc.Task   `json:"task"`
+}
+
+// posts are the only facts plugins can return
+type handleResponse struct {
+	Tasks  []*dc.Task          `json:"tasks,omitempty"`
+	Posts  []*hydrocarbon.Post `json:"posts,omitempty"`
+	Errors []string            `json:"errors,omitempty"`
+}
+
+type fetchRequest struct {
+	Call   string      `json:"call"`
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+// URL is the url the response came from, after any redirects
+type fetchResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       []byte      `json:"body,omitempty"`
+	URL        string      `json:"url"`
+}
+
+// pluginServer is served by plugins
+type pluginServer interface {
+	describe(ctx context.Context, req *describeRequest) (*describeResponse, error)
+	createConfig(ctx context.Context, req *configRequest) (*configResponse, error)
+	externalID(ctx context.Context, req *externalIDRequest) (*externalIDResponse, error)
+	backfill(ctx context.Context, req *backfillRequest) (*backfillResponse, error)
+	handle(ctx context.Context, req *handleRequest) (*handleResponse, error)
+}
+
+// hostServer is served by hydrocarbon to the plugins it started
+type hostServer interface {
+	fetch(ctx context.Context, req *fetchRequest) (*fetchResponse, error)
+}
+
+var pluginServiceDesc = grpc.ServiceDesc{
+	ServiceName: pluginService,
+	HandlerType: (*pluginServer)(nil),
+	Methods: []grpc.MethodDesc{
+		method(pluginService, "Describe", func() interface{} { return &describeRequest{} }, func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+			return srv.(pluginServer).describe(ctx, req.(*describeRequest))
+		}),
+		method(pluginService, "CreateConfig", func() interface{} { return &configRequest{} }, func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+			return srv.(pluginServer).createConfig(ctx, req.(*configRequest))
+		}),
+		method(pluginService, "ExternalID", func() interface{} { return &externalIDRequest{} }, func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+			return srv.(pluginServer).externalID(ctx, req.(*externalIDRequest))
+		}),
+		method(pluginService, "Backfill", func() interface{} { return &backfillRequest{} }, func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+			return srv.(pluginServer).backfill(ctx, req.(*backfillRequest))
+		}),
+		method(pluginService, "Handle", func() interface{} { return &handleRequest{} }, func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+			return srv.(pluginServer).handle(ctx, req.(*handleRequest))
+		}),
+	},
+}
+
+var hostServiceDesc = grpc.ServiceDesc{
+	ServiceName: hostService,
+	HandlerType: (*hostServer)(nil),
+	Methods: []grpc.MethodDesc{
+		method(hostService, "Fetch", func() interface{} { return &fetchRequest{} }, func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+			return srv.(hostServer).fetch(ctx, req.(*fetchRequest))
+		}),
+	},
+}
+
+// method describes a unary method, in place of the code protoc would generate
+func method(service, name string, newReq func() interface{}, call func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := newReq()
+			err := dec(req)
+			if err != nil {
+				return nil, err
+			}
+
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return call(srv, ctx, req)
+			}
+			if interceptor == nil {
+				return handler(ctx, req)
+			}
+
+			return interceptor(ctx, req, &grpc.UnaryServerInfo{
+				Server:     srv,
+				FullMethod: "/" + service + "/" + name,
+			}, handler)
+		},
+	}
+}
+
+// newServer returns a server only answering calls made with token
+func newServer(token string) *grpc.Server {
+	return grpc.NewServer(
+		grpc.MaxRecvMsgSize(maxMessageSize),
+		grpc.MaxSendMsgSize(maxMessageSize),
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			got := md["authorization"]
+			if len(got) != 1 || subtle.ConstantTimeCompare([]byte(got[0]), []byte(token)) != 1 {
+				return nil, status.Error(codes.Unauthenticated, "external: invalid plugin token")
+			}
+
+			return handler(ctx, req)
+		}),
+	)
+}
+
+// dial connects to the server at addr, over loopback only
+func dial(ctx context.Context, addr string) (*grpc.ClientConn, error) {
+	return grpc.DialContext(ctx, addr,
+		grpc.WithInsecure(),
+		grpc.WithBlock(),
+		grpc.WithDefaultCallOptions(
+			grpc.CallContentSubtype(codecName),
+			grpc.MaxCallRecvMsgSize(maxMessageSize),
+			grpc.MaxCallSendMsgSize(maxMessageSize),
+		),
+	)
+}
+
+// invoke calls a method of service with token
+func invoke(ctx context.Context, conn *grpc.ClientConn, token, service, name string, req, resp interface{}) error {
+	ctx = metadata.NewOutgoingContext(ctx, metadata.Pairs("authorization", token))
+	return conn.Invoke(ctx, "/"+service+"/"+name, req, resp)
+}
@@ -0,0 +1,230 @@
+package external
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime/debug"
+
+	"google.golang.org/grpc"
+
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+)
+
+// ErrNotStarted is returned by Serve in binaries run by hand rather than by
+// hydrocarbon
+var ErrNotStarted = errors.New("external: this is a hydrocarbon plugin, it is run by listing it in EXTERNAL_PLUGINS")
+
+// Serve serves p to the hydrocarbon that started this binary until it is
+// stopped. p is written as any built in plugin would be, the clients its
+// handlers are given send every request through hydrocarbon. Login,
+// AllowHTML, MigrateConfig and Scheduler are not supported
+func Serve(p *dc.Plugin) error {
+	if os.Getenv(cookieKey) != cookieValue {
+		return ErrNotStarted
+	}
+	token := os.Getenv(tokenKey)
+
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	defer cancel()
+
+	host, err := dial(ctx, os.Getenv(hostAddrKey))
+	if err != nil {
+		return fmt.Errorf("external: could not connect to hydrocarbon: %s", err)
+	}
+	defer host.Close()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+
+	s := newServer(token)
+	s.RegisterService(&pluginServiceDesc, &server{p: p, host: host, token: token})
+
+	// the handshake, see Load
+	fmt.Printf("%d|tcp|%s|grpc\n", ProtocolVersion, lis.Addr())
+
+	return s.Serve(lis)
+}
+
+// server serves a plugin to hydrocarbon
+type server struct {
+	p     *dc.Plugin
+	host  *grpc.ClientConn
+	token string
+}
+
+func (s *server) describe(ctx context.Context, req *describeRequest) (*describeResponse, error) {
+	routes := make([]string, 0, len(s.p.Routes))
+	for route := range s.p.Routes {
+		routes = append(routes, route)
+	}
+
+	return &describeResponse{
+		ProtocolVersion: ProtocolVersion,
+		Name:            s.p.Name,
+		Entrypoints:     s.p.Entrypoints,
+		Routes:          routes,
+		RateLimit:       s.p.RateLimit,
+		Timeout:         s.p.Timeout,
+		Headers:         s.p.Headers,
+		Referer:         s.p.Referer,
+		IgnoreRobots:    s.p.IgnoreRobots,
+		ContentTypes:    s.p.ContentTypes,
+		ConfigSchema:    s.p.ConfigSchema,
+		ConfigVersion:   s.p.ConfigVersion,
+		HasExternalID:   s.p.ExternalID != nil,
+		HasBackfill:     s.p.Backfill != nil,
+	}, nil
+}
+
+func (s *server) createConfig(ctx context.Context, req *configRequest) (resp *configResponse, err error) {
+	defer recoverCall(&err)
+
+	title, cfg, err := s.p.ConfigCreator(req.URL, &dc.HandlerOpts{
+		RouteParams: req.RouteParams,
+		Client:      s.client(req.Call),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &configResponse{Title: title, Config: cfg}, nil
+}
+
+func (s *server) externalID(ctx context.Context, req *externalIDRequest) (resp *externalIDResponse, err error) {
+	defer recoverCall(&err)
+
+	if s.p.ExternalID == nil {
+		return &externalIDResponse{}, nil
+	}
+
+	return &externalIDResponse{
+		ID: s.p.ExternalID(req.URL, &dc.HandlerOpts{RouteParams: req.RouteParams}),
+	}, nil
+}
+
+func (s *server) backfill(ctx context.Context, req *backfillRequest) (resp *backfillResponse, err error) {
+	defer recoverCall(&err)
+
+	if s.p.Backfill == nil {
+		return nil, dc.ErrNoBackfill
+	}
+
+	cfg, err := s.p.Backfill(req.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &backfillResponse{Config: cfg}, nil
+}
+
+func (s *server) handle(ctx context.Context, req *handleRequest) (resp *handleResponse, err error) {
+	defer recoverCall(&err)
+
+	h, ok := s.p.Routes[req.Route]
+	if !ok {
+		return nil, dc.ErrHandlerNotFound
+	}
+
+	hr := h(ctx, &dc.HandlerOpts{
+		Config:      req.Config,
+		RouteParams: req.RouteParams,
+		Client:      s.client(req.Call),
+	}, req.Task)
+
+	resp = &handleResponse{Tasks: hr.Tasks}
+	for _, f := range hr.Facts {
+		post, ok := f.(*hydrocarbon.Post)
+		if !ok {
+			resp.Errors = append(resp.Errors, fmt.Sprintf("external: %s returned a %T, only posts are supported", s.p.Name, f))
+			continue
+		}
+		resp.Posts = append(resp.Posts, post)
+	}
+	for _, e := range hr.Errors {
+		resp.Errors = append(resp.Errors, e.Error())
+	}
+
+	return resp, nil
+}
+
+// recoverCall turns a panic of the plugin into the error of the call, rather
+// than taking the process down with it
+func recoverCall(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("external: panic: %v\n%s", r, debug.Stack())
+	}
+}
+
+// client returns a client fetching through hydrocarbon for a call
+func (s *server) client(call string) *http.Client {
+	return &http.Client{
+		Transport: &hostTransport{s: s, call: call},
+		// redirects are followed by hydrocarbon
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+type hostTransport struct {
+	s    *server
+	call string
+}
+
+// RoundTrip implements http.RoundTripper
+func (ht *hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var out fetchResponse
+	err := invoke(req.Context(), ht.s.host, ht.s.token, hostService, "Fetch", &fetchRequest{
+		Call:   ht.call,
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: req.Header,
+		Body:   body,
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+
+	// the request is the last of any redirects followed, as it would be
+	final := req
+	if out.URL != "" && out.URL != req.URL.String() {
+		u, err := url.Parse(out.URL)
+		if err != nil {
+			return nil, err
+		}
+		final = req.WithContext(req.Context())
+		final.URL = u
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", out.StatusCode, http.StatusText(out.StatusCode)),
+		StatusCode:    out.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        out.Header,
+		Body:          ioutil.NopCloser(bytes.NewReader(out.Body)),
+		ContentLength: int64(len(out.Body)),
+		Request:       final,
+	}, nil
+}
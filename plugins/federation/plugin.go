@@ -0,0 +1,213 @@
+package federation
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+	"github.com/fortytw2/hydrocarbon/httpx"
+)
+
+const (
+	// feeds are followed by submitting the manifest url of a public feed on
+	// another instance
+	manifestPattern = `^(https?://[^/?#]+)/v1/federation/feed/get\?feed_id=([0-9a-fA-F-]{36})$`
+	// the key from the manifest is pinned in the fragment of the posts url,
+	// so it is stored with the config of every scrape
+	postsPattern = `^(https?://[^/?#]+)/v1/federation/posts/get\?([^#]+)#key=([A-Za-z0-9_-]+)$`
+
+	syncInterval = 30 * time.Minute
+	// delta syncs overlap the previous one, posts seen twice are updated in
+	// place by their external ID
+	syncOverlap = time.Hour
+
+	maxResponseSize = 16 * 1024 * 1024
+)
+
+// Plugin follows a public feed of another hydrocarbon instance, syncing its
+// posts instead of scraping the origin site again
+var Plugin = &dc.Plugin{
+	Name: "federation",
+	// the federation api is published for other instances to poll
+	IgnoreRobots: true,
+	Entrypoints:  []string{manifestPattern},
+	ConfigCreator: func(entrypoint string, ho *dc.HandlerOpts) (string, *dc.Config, error) {
+		if len(ho.RouteParams) != 3 {
+			return "", nil, errors.New("federation: expected an instance and feed ID")
+		}
+
+		var m hydrocarbon.FeedManifest
+		pub, err := getManifest(context.TODO(), ho.Client, entrypoint, &m)
+		if err != nil {
+			return "", nil, err
+		}
+
+		// an instance may only point at posts it serves itself
+		if !strings.HasPrefix(m.PostsURL, ho.RouteParams[1]+"/") || m.Feed == nil {
+			return "", nil, fmt.Errorf("federation: invalid manifest from %s", ho.RouteParams[1])
+		}
+
+		return m.Feed.Title, &dc.Config{
+			Type:        dc.FullScrape,
+			Entrypoints: []string{m.PostsURL + "#key=" + base64.RawURLEncoding.EncodeToString(pub)},
+		}, nil
+	},
+	ExternalID: func(url string, ho *dc.HandlerOpts) string {
+		return instanceHost(ho.RouteParams[1]) + ":" + strings.ToLower(ho.RouteParams[2])
+	},
+	Scheduler: dc.SchedulerFunc(func(sr *dc.ScheduleRequest) ([]*dc.ScrapeSchedule, error) {
+		if len(sr.LatestScrapes) == 0 {
+			return nil, errors.New("discollect: cannot schedule a scrape without an initial scrape")
+		}
+
+		last := sr.LatestScrapes[0]
+		return []*dc.ScrapeSchedule{{
+			ScheduledStartAt: time.Now().Add(syncInterval),
+			Config: &dc.Config{
+				Type:        dc.DeltaScrape,
+				Entrypoints: last.Config.Entrypoints,
+				Since:       last.ScheduledStartAt.Add(-syncOverlap),
+			},
+		}}, nil
+	}),
+	Routes: map[string]dc.Handler{
+		postsPattern: syncPosts,
+	},
+}
+
+func syncPosts(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+	if len(ho.RouteParams) != 4 {
+		return dc.ErrorResponse(errors.New("federation: expected an instance, query and key"))
+	}
+
+	pub, err := base64.RawURLEncoding.DecodeString(ho.RouteParams[3])
+	if err != nil {
+		return dc.ErrorResponse(fmt.Errorf("federation: invalid pinned key: %s", err))
+	}
+
+	q, err := url.ParseQuery(ho.RouteParams[2])
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	// the first page of a delta sync starts from the config, later pages
+	// carry their own cursor
+	if q.Get("cursor") == "" && ho.Config.Type == dc.DeltaScrape && !ho.Config.Since.IsZero() {
+		q.Set("cursor", ho.Config.Since.UTC().Format(time.RFC3339Nano)+"_")
+	}
+
+	base := ho.RouteParams[1] + "/v1/federation/posts/get?"
+
+	var fp hydrocarbon.FederatedPosts
+	err = getSigned(ctx, ho.Client, base+q.Encode(), ed25519.PublicKey(pub), &fp)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	host := instanceHost(ho.RouteParams[1])
+
+	facts := make([]interface{}, len(fp.Posts))
+	for i, p := range fp.Posts {
+		p.ExternalID = host + ":" + p.ID
+		p.ID = ""
+		p.Read = false
+		p.Sources = nil
+
+		facts[i] = p
+	}
+
+	if fp.Next == "" {
+		return dc.Response(facts)
+	}
+
+	q.Set("cursor", fp.Next)
+	return dc.Response(facts, &dc.Task{
+		URL: base + q.Encode() + "#key=" + ho.RouteParams[3],
+	})
+}
+
+// getManifest fetches and verifies a manifest with the key it carries, which
+// is then trusted for every later sync of the feed
+func getManifest(ctx context.Context, c *http.Client, manifestURL string, m *hydrocarbon.FeedManifest) (ed25519.PublicKey, error) {
+	body, sig, err := get(ctx, c, manifestURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// the key is only known once the manifest is read, so decode it first and
+	// verify the whole body against it
+	var unverified struct {
+		Data hydrocarbon.FeedManifest `json:"data"`
+	}
+	err = json.Unmarshal(body, &unverified)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, err := base64.StdEncoding.DecodeString(unverified.Data.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("federation: invalid public key: %s", err)
+	}
+
+	err = hydrocarbon.VerifyFederated(ed25519.PublicKey(pub), body, sig, m)
+	if err != nil {
+		return nil, err
+	}
+
+	return ed25519.PublicKey(pub), nil
+}
+
+func getSigned(ctx context.Context, c *http.Client, u string, pub ed25519.PublicKey, x interface{}) error {
+	body, sig, err := get(ctx, c, u)
+	if err != nil {
+		return err
+	}
+
+	return hydrocarbon.VerifyFederated(pub, body, sig, x)
+}
+
+func get(ctx context.Context, c *http.Client, u string) ([]byte, string, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", "hydrocarbon/1.0 (+https://github.com/fortytw2/hydrocarbon)")
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer httpx.DrainAndClose(resp.Body)
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, "", err
+	}
+
+	sig := resp.Header.Get(hydrocarbon.FederationSignatureHeader)
+	if sig == "" {
+		return nil, "", fmt.Errorf("federation: unsigned response from %s, status %d", req.URL.Host, resp.StatusCode)
+	}
+
+	return body, sig, nil
+}
+
+func instanceHost(instance string) string {
+	u, err := url.Parse(instance)
+	if err != nil {
+		return instance
+	}
+	return strings.ToLower(u.Host)
+}
@@ -7,6 +7,7 @@ import (
 	"html"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -16,16 +17,28 @@ import (
 	dc "github.com/fortytw2/hydrocarbon/discollect"
 
 	"github.com/fortytw2/hydrocarbon/httpx"
+	"github.com/microcosm-cc/bluemonday"
 )
 
+var alignment = regexp.MustCompile(`^(left|center|right|justify)$`)
+
 // Plugin is a plugin that can scrape fictionpress
 var Plugin = &dc.Plugin{
 	Name:          "fictionpress",
 	ConfigCreator: configCreator,
+	// chapter urls end in a slug of the story title, which changes when the
+	// author renames it, but /s/{story id} does not
+	ExternalID: func(url string, ho *dc.HandlerOpts) string {
+		return storyID(ho.RouteParams)
+	},
+	// both sites are quick to ban scrapers
+	RateLimit: &dc.RateLimit{
+		PerDomain: 0.5,
+	},
 	Entrypoints: []string{
 		`https:\/\/www.(fictionpress.com|fanfiction.net)\/s\/(.*)\/(\d+)(.*)`,
 	},
-	Scheduler: func(sr *dc.ScheduleRequest) ([]*dc.ScrapeSchedule, error) {
+	Scheduler: dc.SchedulerFunc(func(sr *dc.ScheduleRequest) ([]*dc.ScrapeSchedule, error) {
 		if len(sr.LatestScrapes) == 0 {
 			return nil, errors.New("discollect: cannot schedule a scrape without an initial scrape")
 		}
@@ -53,9 +66,25 @@ var Plugin = &dc.Plugin{
 			Config: &dc.Config{
 				Type:        dc.DeltaScrape,
 				Entrypoints: []string{lastPosts[0].URL},
+				Since:       lastPosts[0].PostedAt,
 			},
 		}}, nil
+	}),
+	// backfills start from the first chapter again, which lists every other
+	Backfill: func(c *dc.Config) (*dc.Config, error) {
+		return &dc.Config{Entrypoints: c.Entrypoints}, nil
+	},
+	// authors center scene breaks and author's notes
+	AllowHTML: func(p *bluemonday.Policy) {
+		p.AllowAttrs("align").Matching(alignment).OnElements("p", "div")
 	},
+	// configCreator starts feeds at chapter 1, as /s/{story id}/1 on either
+	// site, the title slug after it is optional
+	ConfigSchema: `{
+		"properties": {
+			"Entrypoints": {"items": {"pattern": "^https://www\\.(fictionpress\\.com|fanfiction\\.net)/s/\\d+/\\d+"}}
+		}
+	}`,
 	Routes: map[string]dc.Handler{
 		`https:\/\/www.(fictionpress.com|fanfiction.net)\/s\/(.*)\/(\d+)(.*)`: storyPage,
 	},
@@ -91,6 +120,12 @@ func configCreator(entrypointURL string, ho *dc.HandlerOpts) (string, *dc.Config
 	}, nil
 }
 
+// storyID identifies a story across both sites, they number stories
+// independently
+func storyID(routeParams []string) string {
+	return routeParams[1] + ":" + routeParams[2]
+}
+
 func storyPage(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
 	parsedURL, err := url.Parse(t.URL)
 	if err != nil {
@@ -141,6 +176,7 @@ func storyPage(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerR
 		// the year to maintain ordering
 		PostedAt:    time.Date(day, 01, 01, 0, 0, 0, 0, time.UTC),
 		OriginalURL: t.URL,
+		ExternalID:  storyID(ho.RouteParams) + ":" + chapter,
 		Title:       chapterTitle,
 		Author:      strings.TrimSpace(doc.Find(`#profile_top .xcontrast_txt+ a.xcontrast_txt`).Text()),
 		Body:        html.UnescapeString(strings.TrimSpace(body)),
@@ -0,0 +1,249 @@
+package goodreads
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+	"github.com/fortytw2/hydrocarbon/httpx"
+	"github.com/mmcdole/gofeed"
+)
+
+const (
+	// authors are followed by their page, or any page of their books
+	authorPattern = `^https?:\/\/(?:www\.)?goodreads\.com\/author\/(?:show|list)\/(\d+)(?:[.-][^\/?#]*)?\/?(?:[?#].*)?$`
+
+	maxResponseSize = 8 * 1024 * 1024
+)
+
+var (
+	bookPath      = regexp.MustCompile(`\/book\/show\/(\d+)`)
+	blogPath      = regexp.MustCompile(`\/author\/(?:show\/)?(\d+)[\w.-]*\/blog$`)
+	blogPostPath  = regexp.MustCompile(`\/author_blog_posts\/(\d+)`)
+	publishedYear = regexp.MustCompile(`(?:expected publication|published)\s+(\d{4})`)
+)
+
+// Plugin is a plugin that can follow authors on goodreads, their new books and
+// the posts of their blog are merged into a single feed
+var Plugin = &dc.Plugin{
+	Name:          "goodreads",
+	ConfigCreator: configCreator,
+	ExternalID: func(url string, ho *dc.HandlerOpts) string {
+		return ho.RouteParams[1]
+	},
+	RateLimit: &dc.RateLimit{
+		PerDomain: 0.5,
+	},
+	Entrypoints: []string{authorPattern},
+	// authors announce a book or two a year, and blog about as often
+	Scheduler: &dc.Adaptive{Min: 12 * time.Hour, Max: 7 * 24 * time.Hour},
+	// the list pages through every book ever published
+	Backfill: func(c *dc.Config) (*dc.Config, error) {
+		return &dc.Config{Entrypoints: c.Entrypoints}, nil
+	},
+	Routes: map[string]dc.Handler{
+		`^https:\/\/www\.goodreads\.com\/author\/list\/(\d+)[\w.-]*\?`:                       bookList,
+		`^https:\/\/www\.goodreads\.com\/author\/(?:show\/)?(\d+)[\w.-]*\/blog\?format=rss$`: blogFeed,
+	},
+}
+
+func configCreator(entrypoint string, ho *dc.HandlerOpts) (string, *dc.Config, error) {
+	id := ho.RouteParams[1]
+
+	doc, err := getDoc(context.TODO(), ho.Client, "https://www.goodreads.com/author/show/"+id)
+	if err != nil {
+		return "", nil, err
+	}
+
+	name := strings.TrimSpace(doc.Find(`.authorName [itemprop="name"]`).First().Text())
+	if name == "" {
+		return "", nil, fmt.Errorf("goodreads: could not find the name of author %s", id)
+	}
+
+	entrypoints := []string{listURL(id)}
+	// only authors who blog on goodreads link to it
+	doc.Find(`a[href$="/blog"]`).EachWithBreak(func(i int, s *goquery.Selection) bool {
+		m := blogPath.FindStringSubmatch(s.AttrOr("href", ""))
+		if m == nil || m[1] != id {
+			return true
+		}
+
+		entrypoints = append(entrypoints, "https://www.goodreads.com"+m[0]+"?format=rss")
+		return false
+	})
+
+	return name, &dc.Config{
+		Type:        dc.FullScrape,
+		Entrypoints: entrypoints,
+	}, nil
+}
+
+// listURL returns the list of the books of an author, newest first
+func listURL(id string) string {
+	return "https://www.goodreads.com/author/list/" + id + "?sort=original_publication_year"
+}
+
+func get(ctx context.Context, c *http.Client, u string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		httpx.DrainAndClose(resp.Body)
+		return nil, fmt.Errorf("goodreads: %s returned %d", u, resp.StatusCode)
+	}
+
+	return resp, nil
+}
+
+func getDoc(ctx context.Context, c *http.Client, u string) (*goquery.Document, error) {
+	resp, err := get(ctx, c, u)
+	if err != nil {
+		return nil, err
+	}
+	defer httpx.DrainAndClose(resp.Body)
+
+	return goquery.NewDocumentFromReader(io.LimitReader(resp.Body, maxResponseSize))
+}
+
+// bookList reads a page of the books of an author, newest first. Books have
+// no date they were added on, so every one is passed on and those already
+// stored are matched on their ID, delta scrapes only read the first page
+func bookList(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+	doc, err := getDoc(ctx, ho.Client, t.URL)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	var (
+		facts []interface{}
+		errs  []error
+	)
+	doc.Find(`tr[itemtype="http://schema.org/Book"]`).Each(func(i int, s *goquery.Selection) {
+		p, err := book(s, t.URL)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		facts = append(facts, p)
+	})
+
+	if ho.Config != nil && ho.Config.Type == dc.DeltaScrape {
+		return &dc.HandlerResponse{Facts: facts, Errors: errs}
+	}
+
+	var tasks []*dc.Task
+	if nt := dc.NextPage(t, doc.Find(`a.next_page`).First().AttrOr("href", ""), 0); nt != nil {
+		tasks = append(tasks, nt)
+	}
+
+	return &dc.HandlerResponse{Facts: facts, Tasks: tasks, Errors: errs}
+}
+
+// book reads a row of the list of books of an author
+func book(s *goquery.Selection, base string) (*hydrocarbon.Post, error) {
+	link := s.Find(`a.bookTitle`).First()
+	href, _ := link.Attr("href")
+	m := bookPath.FindStringSubmatch(href)
+	if m == nil {
+		return nil, fmt.Errorf("goodreads: a book on %s has no link", base)
+	}
+
+	title := strings.TrimSpace(link.Find(`[itemprop="name"]`).Text())
+	if title == "" {
+		title = strings.TrimSpace(link.Text())
+	}
+	author := strings.TrimSpace(s.Find(`.authorName [itemprop="name"]`).First().Text())
+	details := strings.Join(strings.Fields(s.Find(`.minirating`).Parent().Text()), " ")
+
+	// only the year is listed, so books of past years are posted at the
+	// start of theirs and new ones when they are first seen
+	now := time.Now().UTC()
+	postedAt := now
+	if ym := publishedYear.FindStringSubmatch(details); ym != nil {
+		if y, err := time.Parse("2006", ym[1]); err == nil && y.Year() < now.Year() {
+			postedAt = y
+		}
+	}
+
+	var b strings.Builder
+	if cover, ok := s.Find(`img.bookCover`).Attr("src"); ok {
+		fmt.Fprintf(&b, `<p><img src="%s"/></p>`, html.EscapeString(cover))
+	}
+	if details != "" {
+		fmt.Fprintf(&b, `<p>%s</p>`, html.EscapeString(details))
+	}
+
+	return &hydrocarbon.Post{
+		PostedAt:    postedAt,
+		OriginalURL: "https://www.goodreads.com/book/show/" + m[1],
+		ExternalID:  "book-" + m[1],
+		Title:       title,
+		Author:      author,
+		Body:        b.String(),
+	}, nil
+}
+
+// blogFeed reads the feed of the blog of an author, which has its latest
+// posts
+func blogFeed(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+	resp, err := get(ctx, ho.Client, t.URL)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+	defer httpx.DrainAndClose(resp.Body)
+
+	f, err := gofeed.NewParser().Parse(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	author := strings.TrimSuffix(strings.TrimSpace(f.Title), "'s blog")
+
+	var facts []interface{}
+	for _, i := range f.Items {
+		postedAt := time.Now().UTC()
+		if i.PublishedParsed != nil {
+			postedAt = i.PublishedParsed.UTC()
+		}
+
+		if !ho.Config.Newer(postedAt) {
+			continue
+		}
+
+		var id string
+		if m := blogPostPath.FindStringSubmatch(i.Link); m != nil {
+			id = "blog-" + m[1]
+		}
+
+		body := i.Content
+		if body == "" {
+			body = i.Description
+		}
+
+		facts = append(facts, &hydrocarbon.Post{
+			PostedAt:    postedAt,
+			OriginalURL: i.Link,
+			ExternalID:  id,
+			Title:       strings.TrimSpace(i.Title),
+			Author:      author,
+			Body:        body,
+		})
+	}
+
+	return dc.Response(facts)
+}
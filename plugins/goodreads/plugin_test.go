@@ -0,0 +1,138 @@
+package goodreads
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+	"github.com/fortytw2/hydrocarbon/discollect/dctest"
+)
+
+func TestConfigCreator(t *testing.T) {
+	h := dctest.New(t, Plugin, "testdata/goodreads.json")
+	defer h.Close()
+
+	var cases = []struct {
+		URL         string
+		Title       string
+		Entrypoints []string
+	}{
+		{
+			"https://www.goodreads.com/author/show/4763.Jane_Doe",
+			"Jane Doe",
+			[]string{
+				"https://www.goodreads.com/author/list/4763?sort=original_publication_year",
+				"https://www.goodreads.com/author/show/4763.Jane_Doe/blog?format=rss",
+			},
+		},
+		{
+			// authors without a blog are only followed for their books
+			"https://goodreads.com/author/list/5-john-roe?page=3",
+			"John Roe",
+			[]string{"https://www.goodreads.com/author/list/5?sort=original_publication_year"},
+		},
+	}
+
+	for _, tc := range cases {
+		title, cfg, err := Plugin.ConfigCreator(tc.URL, &dc.HandlerOpts{
+			Client:      h.Client,
+			RouteParams: regexp.MustCompile(authorPattern).FindStringSubmatch(tc.URL),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if title != tc.Title || len(cfg.Entrypoints) != len(tc.Entrypoints) {
+			t.Fatalf("unexpected config %q for %s", cfg.Entrypoints, title)
+		}
+		for i := range tc.Entrypoints {
+			if cfg.Entrypoints[i] != tc.Entrypoints[i] {
+				t.Errorf("expected entrypoint %s, got %s", tc.Entrypoints[i], cfg.Entrypoints[i])
+			}
+		}
+	}
+}
+
+func TestBookList(t *testing.T) {
+	h := dctest.New(t, Plugin, "testdata/goodreads.json")
+	defer h.Close()
+
+	lowWater := &hydrocarbon.Post{
+		PostedAt:    time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		OriginalURL: "https://www.goodreads.com/book/show/8002",
+		ExternalID:  "book-8002",
+		Title:       "Low Water (Tides, #2)",
+		Author:      "Jane Doe",
+		Body:        `<p><img src="https://i.gr-assets.com/images/S/books/8002._SY75_.jpg"/></p><p>4.12 avg rating — 1,204 ratings — published 2021 — 3 editions</p>`,
+	}
+
+	r := h.Run(&dc.Config{Type: dc.FullScrape}, "https://www.goodreads.com/author/list/4763?sort=original_publication_year").
+		ExpectNoErrors().
+		ExpectTasks("https://www.goodreads.com/author/list/4763.Jane_Doe?page=2&sort=original_publication_year")
+
+	// books yet to be published are posted as they are announced
+	if len(r.Facts) > 0 {
+		announced := r.Facts[0].(*hydrocarbon.Post)
+		if time.Since(announced.PostedAt) > time.Minute {
+			t.Errorf("expected an announced book to be posted now, got %s", announced.PostedAt)
+		}
+		announced.PostedAt = time.Time{}
+	}
+
+	r.ExpectFacts(&hydrocarbon.Post{
+		OriginalURL: "https://www.goodreads.com/book/show/9001",
+		ExternalID:  "book-9001",
+		Title:       "The Lighthouse (Tides, #3)",
+		Author:      "Jane Doe",
+		Body:        `<p><img src="https://i.gr-assets.com/images/S/books/9001._SY75_.jpg"/></p><p>4.12 avg rating — 1,204 ratings — expected publication 2099 — 3 editions</p>`,
+	}, lowWater)
+
+	h.Run(&dc.Config{Type: dc.FullScrape}, "https://www.goodreads.com/author/list/4763.Jane_Doe?page=2&sort=original_publication_year").
+		ExpectNoErrors().
+		ExpectTasks().
+		ExpectFacts(&hydrocarbon.Post{
+			PostedAt:    time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+			OriginalURL: "https://www.goodreads.com/book/show/7003",
+			ExternalID:  "book-7003",
+			Title:       "High Water (Tides, #1)",
+			Author:      "Jane Doe",
+			Body:        `<p>4.12 avg rating — 1,204 ratings — published 2018 — 3 editions</p>`,
+		})
+
+	// delta scrapes only read the newest books
+	h.Run(&dc.Config{Type: dc.DeltaScrape, Since: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)}, "https://www.goodreads.com/author/list/4763?sort=original_publication_year").
+		ExpectNoErrors().
+		ExpectTasks()
+}
+
+func TestBlogFeed(t *testing.T) {
+	h := dctest.New(t, Plugin, "testdata/goodreads.json")
+	defer h.Close()
+
+	reveal := &hydrocarbon.Post{
+		PostedAt:    time.Date(2021, 3, 2, 18, 0, 0, 0, time.UTC),
+		OriginalURL: "https://www.goodreads.com/author_blog_posts/23001-cover-reveal-for-the-lighthouse",
+		ExternalID:  "blog-23001",
+		Title:       "Cover reveal for The Lighthouse",
+		Author:      "Jane Doe",
+		Body:        `<p>Here it is!</p>`,
+	}
+
+	h.Run(&dc.Config{Type: dc.FullScrape}, "https://www.goodreads.com/author/show/4763.Jane_Doe/blog?format=rss").
+		ExpectNoErrors().
+		ExpectTasks().
+		ExpectFacts(reveal, &hydrocarbon.Post{
+			PostedAt:    time.Date(2021, 1, 1, 17, 0, 0, 0, time.UTC),
+			OriginalURL: "https://www.goodreads.com/author_blog_posts/22001-low-water-is-out",
+			ExternalID:  "blog-22001",
+			Title:       "Low Water is out",
+			Author:      "Jane Doe",
+			Body:        `<p>Finally.</p>`,
+		})
+
+	h.Run(&dc.Config{Type: dc.DeltaScrape, Since: time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)}, "https://www.goodreads.com/author/show/4763.Jane_Doe/blog?format=rss").
+		ExpectNoErrors().
+		ExpectFacts(reveal)
+}
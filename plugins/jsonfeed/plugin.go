@@ -20,6 +20,8 @@ var rssPolicy = bluemonday.UGCPolicy().AddTargetBlankToFullyQualifiedLinks(true)
 // - [ ] strip images that don't matter
 var Plugin = &dc.Plugin{
 	Name: "jsonfeed",
+	// feeds are published for readers to poll
+	IgnoreRobots: true,
 	ConfigCreator: func(url string, ho *dc.HandlerOpts) (string, *dc.Config, error) {
 		f, err := getFeed(context.TODO(), ho.Client, url)
 		if err != nil {
@@ -31,8 +33,13 @@ var Plugin = &dc.Plugin{
 			Entrypoints: []string{url},
 		}, nil
 	},
-	Entrypoints: []string{".*"},
-	Scheduler:   dc.DefaultScheduler,
+	// backfills page through the feed by its next_url
+	Backfill: func(c *dc.Config) (*dc.Config, error) {
+		return &dc.Config{Entrypoints: c.Entrypoints}, nil
+	},
+	Entrypoints:  []string{".*"},
+	ContentTypes: []string{"application/feed+json", "application/json"},
+	Scheduler:    dc.DefaultScheduler,
 	Routes: map[string]dc.Handler{
 		`(.*)`: jsonFeed,
 	},
@@ -49,20 +56,28 @@ func jsonFeed(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerRe
 		return dc.ErrorResponse(err)
 	}
 
-	out := make([]interface{}, len(posts))
-	for i, p := range posts {
-		downloaded, err := dc.DownloadImages(p.Body, ho.Client, ho.FileStore)
-		if err != nil {
-			return dc.ErrorResponse(err)
+	// delta scrapes leave posts already stored alone, sparing their images
+	// from being rehosted again. Items without a date can not be told apart
+	// by it, so are always written, those already stored are skipped by url
+	out := make([]interface{}, 0, len(posts))
+	for _, p := range posts {
+		if !p.PostedAt.IsZero() && !ho.Config.Newer(p.PostedAt) {
+			continue
 		}
 
-		p.Body = downloaded
+		out = append(out, p)
+	}
 
-		out[i] = p
+	var tasks []*dc.Task
+	if ho.Config.Type == dc.BackfillScrape {
+		if next := dc.NextPage(t, f.NextURL, 0); next != nil {
+			tasks = append(tasks, next)
+		}
 	}
 
 	return &dc.HandlerResponse{
 		Facts: out,
+		Tasks: tasks,
 	}
 }
 
@@ -106,12 +121,24 @@ func parseFeed(f *JSONFeed) ([]*hydrocarbon.Post, error) {
 			date = *i.PublishedDate
 		}
 
+		var author string
+		if i.Author != nil {
+			author = i.Author.Name
+		}
+
+		// most feeds only give the items own url, which undated items are
+		// told apart by
+		url := i.ExternalURL
+		if url == "" {
+			url = i.URL
+		}
+
 		posts = append(posts, &hydrocarbon.Post{
 			PostedAt:    date,
-			Author:      strings.TrimSpace(i.Author.Name),
+			Author:      strings.TrimSpace(author),
 			Title:       strings.TrimSpace(i.Title),
 			Body:        strings.TrimSpace(sanitized),
-			OriginalURL: strings.TrimSpace(i.ExternalURL),
+			OriginalURL: strings.TrimSpace(url),
 		})
 	}
 
@@ -0,0 +1,322 @@
+package mastodon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+	"github.com/fortytw2/hydrocarbon/httpx"
+)
+
+const (
+	// accounts are followed by their profile url, hashtags by the url of
+	// their timeline
+	entrypointPattern = `^https:\/\/([\w.-]+)\/(@|tags\/)(\w+)\/?$`
+
+	// the most statuses the API returns a page
+	pageSize = 40
+
+	// a request refused by the rate limit of an instance waits this long for
+	// it to reset at most, longer and the task is retried later
+	maxRateWait = time.Minute
+	// titles of statuses without a content warning are cut to this many
+	// characters of their text
+	titleLength = 80
+
+	maxResponseSize = 4 * 1024 * 1024
+)
+
+// Plugin follows the public statuses of a Mastodon account or hashtag
+var Plugin = &dc.Plugin{
+	Name: "mastodon",
+	// the API is published for clients to poll
+	IgnoreRobots: true,
+	// instances allow 300 requests every 5 minutes by default
+	RateLimit: &dc.RateLimit{
+		PerDomain: 1,
+	},
+	Entrypoints:   []string{entrypointPattern},
+	ConfigCreator: configCreator,
+	ExternalID: func(url string, ho *dc.HandlerOpts) string {
+		return strings.ToLower(ho.RouteParams[1]) + ":" + ho.RouteParams[2] + strings.ToLower(ho.RouteParams[3])
+	},
+	Scheduler: &dc.Adaptive{Min: 15 * time.Minute, Max: 6 * time.Hour},
+	Backfill: func(c *dc.Config) (*dc.Config, error) {
+		return &dc.Config{Entrypoints: c.Entrypoints}, nil
+	},
+	Routes: map[string]dc.Handler{
+		`^https:\/\/([\w.-]+)\/api\/v1\/accounts\/(\d+)\/statuses\?`: statuses,
+		`^https:\/\/([\w.-]+)\/api\/v1\/timelines\/tag\/([^\/?]+)\?`: statuses,
+	},
+}
+
+type account struct {
+	ID          string `json:"id"`
+	Username    string `json:"username"`
+	Acct        string `json:"acct"`
+	DisplayName string `json:"display_name"`
+}
+
+func (a *account) name() string {
+	if a.DisplayName != "" {
+		return a.DisplayName
+	}
+
+	return "@" + a.Acct
+}
+
+type attachment struct {
+	Type        string `json:"type"`
+	URL         string `json:"url"`
+	PreviewURL  string `json:"preview_url"`
+	Description string `json:"description"`
+}
+
+type status struct {
+	ID               string        `json:"id"`
+	CreatedAt        time.Time     `json:"created_at"`
+	URL              string        `json:"url"`
+	Content          string        `json:"content"`
+	SpoilerText      string        `json:"spoiler_text"`
+	Account          *account      `json:"account"`
+	MediaAttachments []*attachment `json:"media_attachments"`
+}
+
+func configCreator(entrypoint string, ho *dc.HandlerOpts) (string, *dc.Config, error) {
+	instance := "https://" + strings.ToLower(ho.RouteParams[1])
+	name := ho.RouteParams[3]
+
+	// looking the account or tag up also tells if the site is an instance
+	// at all, as the pattern matches all sorts of sites
+	if ho.RouteParams[2] == "tags/" {
+		timeline := fmt.Sprintf("%s/api/v1/timelines/tag/%s?limit=", instance, url.PathEscape(strings.ToLower(name)))
+
+		var ss []*status
+		_, err := getJSON(context.TODO(), ho.Client, timeline+"1", &ss)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return "#" + name + " on " + ho.RouteParams[1], &dc.Config{
+			Type:        dc.FullScrape,
+			Entrypoints: []string{timeline + strconv.Itoa(pageSize)},
+		}, nil
+	}
+
+	var a account
+	_, err := getJSON(context.TODO(), ho.Client, instance+"/api/v1/accounts/lookup?acct="+url.QueryEscape(name), &a)
+	if err != nil {
+		return "", nil, err
+	}
+	if a.ID == "" {
+		return "", nil, fmt.Errorf("mastodon: no account %s on %s", name, ho.RouteParams[1])
+	}
+
+	return a.name(), &dc.Config{
+		Type: dc.FullScrape,
+		Entrypoints: []string{
+			fmt.Sprintf("%s/api/v1/accounts/%s/statuses?exclude_replies=true&exclude_reblogs=true&limit=%d", instance, a.ID, pageSize),
+		},
+	}, nil
+}
+
+// statuses reads a page of statuses, newest first, following the next page
+// until statuses already stored are reached
+func statuses(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+	var ss []*status
+	resp, err := getJSON(ctx, ho.Client, t.URL, &ss)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	host := strings.ToLower(ho.RouteParams[1])
+
+	facts := make([]interface{}, 0, len(ss))
+	for _, s := range ss {
+		if !ho.Config.Newer(s.CreatedAt) {
+			break
+		}
+
+		facts = append(facts, s.post(host))
+	}
+
+	// a short page is the last, as is one reaching back to stored statuses
+	if len(facts) < len(ss) || len(ss) == 0 {
+		return dc.Response(facts)
+	}
+
+	maxPages := 0
+	if ho.Config == nil || ho.Config.Type == dc.FullScrape {
+		maxPages = dc.FullScrapePages
+	}
+
+	next := dc.NextPage(t, dc.NextLinkHeader(resp), maxPages)
+	if next == nil {
+		return dc.Response(facts)
+	}
+
+	return dc.Response(facts, next)
+}
+
+func (s *status) post(host string) *hydrocarbon.Post {
+	var b strings.Builder
+	b.WriteString(s.Content)
+
+	for _, m := range s.MediaAttachments {
+		desc := html.EscapeString(m.Description)
+		switch m.Type {
+		case "image":
+			fmt.Fprintf(&b, `<figure><img src="%s" alt="%s"/></figure>`, html.EscapeString(m.URL), desc)
+		default:
+			// video, gifv and audio can not be embedded, so they link to
+			// the original with a preview
+			fmt.Fprintf(&b, `<figure><a href="%s"><img src="%s" alt="%s"/></a></figure>`, html.EscapeString(m.URL), html.EscapeString(m.PreviewURL), desc)
+		}
+	}
+
+	body := b.String()
+	title := s.SpoilerText
+	if title != "" {
+		// content warnings hide the status until it is opened, as they do
+		// on the instance
+		body = "<details><summary>" + html.EscapeString(s.SpoilerText) + "</summary>" + body + "</details>"
+	} else {
+		title = excerpt(s.Content)
+	}
+
+	p := &hydrocarbon.Post{
+		PostedAt:    s.CreatedAt,
+		OriginalURL: s.URL,
+		ExternalID:  host + ":" + s.ID,
+		Title:       title,
+		Body:        body,
+	}
+	if s.Account != nil {
+		p.Author = s.Account.name()
+	}
+
+	// statuses of nothing but media have no text to title them with
+	if p.Title == "" {
+		p.Title = p.Author
+	}
+
+	return p
+}
+
+// excerpt returns the start of the text of content, for a title
+func excerpt(content string) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
+	if err != nil {
+		return ""
+	}
+
+	// paragraphs run into each other in the text of the document
+	doc.Find("p, br").AfterHtml(" ")
+
+	text := strings.Join(strings.Fields(doc.Text()), " ")
+	if utf8.RuneCountInString(text) <= titleLength {
+		return text
+	}
+
+	return string([]rune(text)[:titleLength-1]) + "…"
+}
+
+// getJSON decodes the response to u into x, waiting out the rate limit of the
+// instance if it is about to reset
+func getJSON(ctx context.Context, c *http.Client, u string, x interface{}) (*http.Response, error) {
+	for retried := false; ; retried = true {
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := c.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			httpx.DrainAndClose(resp.Body)
+
+			wait := rateLimitWait(resp)
+			if retried || wait > maxRateWait {
+				return nil, fmt.Errorf("mastodon: rate limited by %s for %s", req.URL.Host, wait)
+			}
+
+			err = sleep(ctx, wait)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			httpx.DrainAndClose(resp.Body)
+			return nil, fmt.Errorf("mastodon: %s returned %d", u, resp.StatusCode)
+		}
+
+		err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(x)
+		httpx.DrainAndClose(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		// the next request would be refused, it is held back here rather
+		// than wasted
+		if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+			if wait := rateLimitWait(resp); wait <= maxRateWait {
+				err = sleep(ctx, wait)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		return resp, nil
+	}
+}
+
+// rateLimitWait returns how long until the rate limit of the instance resets,
+// by X-RateLimit-Reset or Retry-After, or maxRateWait if it does not say
+func rateLimitWait(resp *http.Response) time.Duration {
+	if reset, err := time.Parse(time.RFC3339Nano, resp.Header.Get("X-RateLimit-Reset")); err == nil {
+		if wait := time.Until(reset); wait > 0 {
+			return wait
+		}
+		return 0
+	}
+
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+
+	return maxRateWait
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
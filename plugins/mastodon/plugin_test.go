@@ -0,0 +1,86 @@
+package mastodon
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+	"github.com/fortytw2/hydrocarbon/discollect/dctest"
+)
+
+const statusesURL = "https://mastodon.social/api/v1/accounts/1/statuses?exclude_replies=true&exclude_reblogs=true&limit=2"
+
+func TestStatuses(t *testing.T) {
+	h := dctest.New(t, Plugin, "testdata/mastodon.json")
+	defer h.Close()
+
+	title, cfg, err := Plugin.ConfigCreator("https://mastodon.social/@Gargron", &dc.HandlerOpts{
+		Client:      h.Client,
+		RouteParams: regexp.MustCompile(entrypointPattern).FindStringSubmatch("https://mastodon.social/@Gargron"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title != "Eugen" || cfg.Entrypoints[0] != "https://mastodon.social/api/v1/accounts/1/statuses?exclude_replies=true&exclude_reblogs=true&limit=40" {
+		t.Fatalf("unexpected config %q for %s", cfg.Entrypoints, title)
+	}
+
+	newest := &hydrocarbon.Post{
+		PostedAt:    time.Date(2020, 3, 3, 10, 0, 0, 0, time.UTC),
+		OriginalURL: "https://mastodon.social/@Gargron/103",
+		ExternalID:  "mastodon.social:103",
+		Title:       "New release is out! Go update.",
+		Author:      "Eugen",
+		Body:        "<p>New release is out!</p><p>Go update.</p>",
+	}
+
+	h.Run(&dc.Config{Type: dc.FullScrape}, statusesURL).
+		ExpectNoErrors().
+		ExpectTasks("https://mastodon.social/api/v1/accounts/1/statuses?exclude_replies=true&exclude_reblogs=true&limit=2&max_id=102").
+		ExpectFacts(newest, &hydrocarbon.Post{
+			PostedAt:    time.Date(2020, 3, 2, 10, 0, 0, 0, time.UTC),
+			OriginalURL: "https://mastodon.social/@Gargron/102",
+			ExternalID:  "mastodon.social:102",
+			Title:       "spoilers",
+			Author:      "Eugen",
+			Body: `<details><summary>spoilers</summary><p>Behind the cut</p>` +
+				`<figure><img src="https://files.mastodon.social/a.png" alt="a cat"/></figure>` +
+				`<figure><a href="https://files.mastodon.social/b.mp4"><img src="https://files.mastodon.social/small/b.png" alt=""/></a></figure></details>`,
+		})
+
+	// the delta scrape stops at the first status already stored
+	h.Run(&dc.Config{Type: dc.DeltaScrape, Since: time.Date(2020, 3, 2, 12, 0, 0, 0, time.UTC)}, statusesURL).
+		ExpectNoErrors().
+		ExpectTasks().
+		ExpectFacts(newest)
+}
+
+func TestRateLimited(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		w.Write([]byte(`[]`))
+	}))
+	defer ts.Close()
+
+	var ss []*status
+	_, err := getJSON(context.Background(), http.DefaultClient, ts.URL, &ss)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if requests != 2 {
+		t.Fatalf("expected the refused request to be retried, got %d requests", requests)
+	}
+}
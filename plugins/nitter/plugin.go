@@ -0,0 +1,420 @@
+package nitter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+	"github.com/fortytw2/hydrocarbon/httpx"
+)
+
+const (
+	accountPattern = `^https:\/\/(?:www\.|mobile\.)?(?:twitter|x)\.com\/([A-Za-z0-9_]{1,15})\/?$`
+
+	// full scrapes only fetch the latest tweets, backfills page back as far
+	// as the mirror can
+	fullScrapePages = 3
+
+	// titles are cut to this many characters of the tweet
+	titleLength = 80
+
+	// a mirror that failed is skipped for this long
+	deadFor = 10 * time.Minute
+
+	maxResponseSize = 4 * 1024 * 1024
+)
+
+var (
+	// Instances are the hosts of the Nitter mirrors tweets are read through,
+	// i.e. nitter.net, tried in turn as they fail
+	Instances []string
+
+	mirrors = &rotation{dead: make(map[string]time.Time)}
+
+	statusPath = regexp.MustCompile(`^\/([A-Za-z0-9_]+)\/status\/(\d+)`)
+
+	errNoInstances = errors.New("nitter: no instances are configured to read tweets through")
+	errNotFound    = errors.New("nitter: the account does not exist or is protected")
+)
+
+// Plugin is a plugin that can follow twitter accounts through Nitter mirrors,
+// threads the account replies to itself in are kept together in one post
+var Plugin = &dc.Plugin{
+	Name:          "nitter",
+	ConfigCreator: configCreator,
+	ExternalID: func(url string, ho *dc.HandlerOpts) string {
+		return strings.ToLower(ho.RouteParams[1])
+	},
+	RateLimit: &dc.RateLimit{
+		PerDomain: 1,
+	},
+	Entrypoints: []string{accountPattern},
+	Scheduler:   &dc.Adaptive{Min: 30 * time.Minute, Max: 12 * time.Hour},
+	Backfill: func(c *dc.Config) (*dc.Config, error) {
+		return &dc.Config{Entrypoints: c.Entrypoints}, nil
+	},
+	// tasks are kept on twitter.com, whichever mirror they are read through
+	Routes: map[string]dc.Handler{
+		`^https:\/\/twitter\.com\/([A-Za-z0-9_]+)(?:\?cursor=.*)?$`: timeline,
+		`^https:\/\/twitter\.com\/([A-Za-z0-9_]+)\/status\/(\d+)$`:  thread,
+	},
+}
+
+func configCreator(entrypoint string, ho *dc.HandlerOpts) (string, *dc.Config, error) {
+	user := ho.RouteParams[1]
+
+	doc, err := mirrors.get(context.TODO(), ho.Client, "/"+user)
+	if err != nil {
+		return "", nil, err
+	}
+
+	name := strings.TrimSpace(doc.Find(".profile-card-fullname").First().Text())
+	if name == "" {
+		name = user
+	}
+
+	return fmt.Sprintf("%s (@%s)", name, user), &dc.Config{
+		Type:        dc.FullScrape,
+		Entrypoints: []string{"https://twitter.com/" + user},
+	}, nil
+}
+
+// rotation spreads requests over the mirrors, skipping the ones that failed
+// lately
+type rotation struct {
+	mu   sync.Mutex
+	next int
+	dead map[string]time.Time
+}
+
+// order returns the mirrors to try a request on, starting from the next in
+// turn, with the ones that failed lately last in case every one did
+func (r *rotation) order() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(Instances) == 0 {
+		return nil
+	}
+
+	start := r.next % len(Instances)
+	r.next++
+
+	var alive, dead []string
+	for i := range Instances {
+		inst := Instances[(start+i)%len(Instances)]
+		if time.Now().Before(r.dead[inst]) {
+			dead = append(dead, inst)
+		} else {
+			alive = append(alive, inst)
+		}
+	}
+
+	return append(alive, dead...)
+}
+
+func (r *rotation) fail(inst string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.dead[inst] = time.Now().Add(deadFor)
+}
+
+// get fetches path from the first mirror that answers it
+func (r *rotation) get(ctx context.Context, c *http.Client, path string) (*goquery.Document, error) {
+	order := r.order()
+	if len(order) == 0 {
+		return nil, errNoInstances
+	}
+
+	var errs []string
+	for _, inst := range order {
+		doc, err := getFrom(ctx, c, "https://"+inst+path)
+		if err == nil || err == errNotFound {
+			return doc, err
+		}
+
+		r.fail(inst)
+		errs = append(errs, err.Error())
+	}
+
+	return nil, fmt.Errorf("nitter: every instance failed: %s", strings.Join(errs, ", "))
+}
+
+func getFrom(ctx context.Context, c *http.Client, u string) (*goquery.Document, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer httpx.DrainAndClose(resp.Body)
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %d", u, resp.StatusCode)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	// mirrors that lost access to twitter still answer, with an error page
+	if msg := strings.TrimSpace(doc.Find(".error-panel").Text()); msg != "" {
+		return nil, fmt.Errorf("%s: %s", u, msg)
+	}
+
+	return doc, nil
+}
+
+// mirrorPath returns the path and query of a task url to fetch from a mirror
+func mirrorPath(t *dc.Task) (string, error) {
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return "", err
+	}
+
+	return u.RequestURI(), nil
+}
+
+// timeline reads a page of the tweets of an account, newest first
+func timeline(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+	path, err := mirrorPath(t)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	doc, err := mirrors.get(ctx, ho.Client, path)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	var (
+		facts []interface{}
+		tasks []*dc.Task
+		done  bool
+	)
+	doc.Find(".timeline > .timeline-item, .timeline > .thread-line").EachWithBreak(func(i int, sel *goquery.Selection) bool {
+		// the pinned tweet is an older one shown out of order, it is read
+		// again where it falls in the timeline
+		if sel.Find(".pinned").Length() > 0 {
+			return true
+		}
+
+		// threads are grouped together, and read whole from the page of
+		// their first tweet
+		isThread := sel.HasClass("thread-line") || sel.Find(".show-thread").Length() > 0
+		if sel.HasClass("thread-line") {
+			sel = sel.Find(".timeline-item").First()
+		}
+
+		tw := parseTweet(sel)
+		if tw == nil {
+			return true
+		}
+
+		// retweets are dated by the tweet retweeted, which can be older than
+		// the tweets after them, so only the account's own end the scrape.
+		// Retweets are read whatever their date, as when they were retweeted
+		// is not shown
+		isRetweet := sel.Find(".retweet-header").Length() > 0
+		if !isRetweet && !ho.Config.Newer(tw.postedAt) {
+			done = true
+			return false
+		}
+
+		if isThread {
+			tasks = append(tasks, &dc.Task{URL: tw.url})
+			return true
+		}
+
+		facts = append(facts, tw.post(nil))
+		return true
+	})
+
+	if done {
+		return dc.Response(facts, tasks...)
+	}
+
+	maxPages := 0
+	if ho.Config == nil || ho.Config.Type == dc.FullScrape {
+		maxPages = fullScrapePages
+	}
+
+	next := doc.Find(`.show-more a[href^="?cursor="]`).Last().AttrOr("href", "")
+	if nt := dc.NextPage(t, next, maxPages); nt != nil {
+		tasks = append(tasks, nt)
+	}
+
+	return dc.Response(facts, tasks...)
+}
+
+// thread reads a tweet and the replies its author continued it with
+func thread(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+	path, err := mirrorPath(t)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	doc, err := mirrors.get(ctx, ho.Client, path)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	main := parseTweet(doc.Find(".main-tweet").First())
+	if main == nil {
+		return dc.ErrorResponse(fmt.Errorf("nitter: could not find the tweet of %s", t.URL))
+	}
+	main.url = t.URL
+	main.id = ho.RouteParams[2]
+
+	var rest []*tweet
+	doc.Find(".after-tweet .timeline-item").EachWithBreak(func(i int, sel *goquery.Selection) bool {
+		tw := parseTweet(sel)
+		if tw == nil || !strings.EqualFold(tw.username, main.username) {
+			return false
+		}
+
+		rest = append(rest, tw)
+		return true
+	})
+
+	return dc.Response([]interface{}{main.post(rest)})
+}
+
+type tweet struct {
+	id       string
+	url      string
+	username string
+	name     string
+	postedAt time.Time
+	text     string
+	body     string
+}
+
+// parseTweet reads a tweet as nitter renders it, nil if sel is not one
+func parseTweet(sel *goquery.Selection) *tweet {
+	date := sel.Find(".tweet-date a").First()
+	postedAt, err := time.Parse("Jan 2, 2006 · 3:04 PM MST", date.AttrOr("title", ""))
+	if err != nil {
+		return nil
+	}
+
+	tw := &tweet{
+		username: strings.TrimPrefix(strings.TrimSpace(sel.Find(".username").First().Text()), "@"),
+		name:     strings.TrimSpace(sel.Find(".fullname").First().Text()),
+		postedAt: postedAt.UTC(),
+	}
+
+	if m := statusPath.FindStringSubmatch(date.AttrOr("href", "")); m != nil {
+		tw.id = m[2]
+		tw.url = "https://twitter.com/" + m[1] + "/status/" + m[2]
+	}
+
+	content := sel.Find(".tweet-content").First()
+	tw.text = strings.Join(strings.Fields(content.Text()), " ")
+	absolute(content)
+
+	var b strings.Builder
+	if rt := sel.Find(".retweet-header").First(); rt.Length() > 0 {
+		fmt.Fprintf(&b, "<p><em>%s</em></p>", html.EscapeString(strings.TrimSpace(rt.Text())))
+	}
+
+	body, _ := content.Html()
+	fmt.Fprintf(&b, "<p>%s</p>", strings.TrimSpace(body))
+
+	sel.Find(".attachments .still-image").Each(func(i int, img *goquery.Selection) {
+		if src := mediaURL(img.AttrOr("href", "")); src != "" {
+			fmt.Fprintf(&b, `<figure><img src="%s"/></figure>`, html.EscapeString(src))
+		}
+	})
+	if sel.Find(".attachments .gallery-video, .attachments .gallery-gif").Length() > 0 && tw.url != "" {
+		fmt.Fprintf(&b, `<p><a href="%s">Watch the video on twitter</a></p>`, tw.url)
+	}
+
+	if q := sel.Find(".quote").First(); q.Length() > 0 {
+		qc := q.Find(".quote-text").First()
+		absolute(qc)
+		quoted, _ := qc.Html()
+
+		link := ""
+		if m := statusPath.FindStringSubmatch(q.Find(".quote-link").AttrOr("href", "")); m != nil {
+			link = "https://twitter.com/" + m[1] + "/status/" + m[2]
+		}
+		fmt.Fprintf(&b, `<blockquote cite="%s"><p>%s</p><p>— %s</p></blockquote>`,
+			link, strings.TrimSpace(quoted), html.EscapeString(strings.TrimSpace(q.Find(".fullname").First().Text())))
+	}
+
+	tw.body = b.String()
+	return tw
+}
+
+// post converts a tweet and the rest of its thread into a post
+func (tw *tweet) post(rest []*tweet) *hydrocarbon.Post {
+	var b strings.Builder
+	b.WriteString(tw.body)
+	for _, r := range rest {
+		b.WriteString("<hr/>")
+		b.WriteString(r.body)
+	}
+
+	title := tw.text
+	if r := []rune(title); len(r) > titleLength {
+		title = strings.TrimSpace(string(r[:titleLength])) + "…"
+	}
+	if title == "" {
+		title = "Tweet by @" + tw.username
+	}
+
+	return &hydrocarbon.Post{
+		PostedAt:    tw.postedAt,
+		OriginalURL: tw.url,
+		ExternalID:  tw.id,
+		Title:       title,
+		Author:      tw.name,
+		Body:        b.String(),
+	}
+}
+
+// absolute points the links nitter makes relative to itself, to hashtags and
+// accounts, back at twitter
+func absolute(sel *goquery.Selection) {
+	sel.Find("a[href]").Each(func(i int, a *goquery.Selection) {
+		if href := a.AttrOr("href", ""); strings.HasPrefix(href, "/") {
+			a.SetAttr("href", "https://twitter.com"+href)
+		}
+	})
+}
+
+// mediaURL returns the twitter url of an image proxied by a mirror, as in
+// /pic/orig/media%2FabcXYZ.jpg
+func mediaURL(href string) string {
+	if !strings.HasPrefix(href, "/pic/") {
+		return href
+	}
+
+	p, err := url.PathUnescape(strings.TrimPrefix(strings.TrimPrefix(href, "/pic/"), "orig/"))
+	if err != nil {
+		return ""
+	}
+
+	return "https://pbs.twimg.com/" + p
+}
@@ -0,0 +1,105 @@
+package nitter
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+	"github.com/fortytw2/hydrocarbon/discollect/dctest"
+)
+
+func TestNitter(t *testing.T) {
+	Instances = []string{"dead.example.com", "nitter.example.org"}
+	mirrors = &rotation{dead: make(map[string]time.Time)}
+	defer func() { Instances = nil }()
+
+	h := dctest.New(t, Plugin, "testdata/nitter.json")
+	defer h.Close()
+
+	// the first instance is down, so the account is read from the second
+	title, cfg, err := Plugin.ConfigCreator("https://x.com/jack", &dc.HandlerOpts{
+		Client:      h.Client,
+		RouteParams: regexp.MustCompile(accountPattern).FindStringSubmatch("https://x.com/jack"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title != "Jack (@jack)" || cfg.Entrypoints[0] != "https://twitter.com/jack" {
+		t.Fatalf("unexpected config %q for %s", cfg.Entrypoints, title)
+	}
+
+	if order := mirrors.order(); order[0] != "nitter.example.org" {
+		t.Errorf("expected the failed instance to be tried last, got %v", order)
+	}
+
+	_, _, err = Plugin.ConfigCreator("https://twitter.com/nobody", &dc.HandlerOpts{
+		Client:      h.Client,
+		RouteParams: regexp.MustCompile(accountPattern).FindStringSubmatch("https://twitter.com/nobody"),
+	})
+	if err != errNotFound {
+		t.Errorf("expected a missing account to be refused, got %v", err)
+	}
+
+	spring := &hydrocarbon.Post{
+		PostedAt:    time.Date(2020, 3, 3, 10, 0, 0, 0, time.UTC),
+		OriginalURL: "https://twitter.com/jack/status/3",
+		ExternalID:  "3",
+		Title:       "Spring is here #spring",
+		Author:      "Jack",
+		Body: `<p>Spring is here <a href="https://twitter.com/search?q=%23spring">#spring</a></p>` +
+			`<figure><img src="https://pbs.twimg.com/media/Eabc.jpg"/></figure>`,
+	}
+
+	h.Run(&dc.Config{Type: dc.FullScrape}, "https://twitter.com/jack").
+		ExpectNoErrors().
+		ExpectTasks("https://twitter.com/jack/status/2", "https://twitter.com/jack?cursor=ABC").
+		ExpectFacts(spring, &hydrocarbon.Post{
+			PostedAt:    time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC),
+			OriginalURL: "https://twitter.com/jack/status/1",
+			ExternalID:  "1",
+			Title:       "Look at this",
+			Author:      "Jack",
+			Body: `<p><em>Jack retweeted</em></p><p>Look at this</p>` +
+				`<blockquote cite="https://twitter.com/biz/status/9"><p>Hello <a href="https://twitter.com/jack">@jack</a></p><p>— Biz</p></blockquote>`,
+		})
+
+	// the delta scrape stops at the first tweet already stored, but not at
+	// the pinned one
+	h.Run(&dc.Config{Type: dc.DeltaScrape, Since: time.Date(2020, 3, 2, 12, 0, 0, 0, time.UTC)}, "https://twitter.com/jack").
+		ExpectNoErrors().
+		ExpectTasks().
+		ExpectFacts(spring)
+
+	// nor at a retweet of an older tweet, which is newer than it is dated
+	h.Run(&dc.Config{Type: dc.DeltaScrape, Since: time.Date(2020, 3, 2, 12, 0, 0, 0, time.UTC)}, "https://twitter.com/jill").
+		ExpectNoErrors().
+		ExpectTasks().
+		ExpectFacts(&hydrocarbon.Post{
+			PostedAt:    time.Date(2019, 1, 5, 9, 0, 0, 0, time.UTC),
+			OriginalURL: "https://twitter.com/biz/status/8",
+			ExternalID:  "8",
+			Title:       "An old tweet, retweeted today",
+			Author:      "Biz",
+			Body:        `<p><em>Jill retweeted</em></p><p>An old tweet, retweeted today</p>`,
+		}, &hydrocarbon.Post{
+			PostedAt:    time.Date(2020, 3, 3, 11, 0, 0, 0, time.UTC),
+			OriginalURL: "https://twitter.com/jill/status/12",
+			ExternalID:  "12",
+			Title:       "Back from the hills",
+			Author:      "Jill",
+			Body:        `<p>Back from the hills</p>`,
+		})
+
+	h.Run(&dc.Config{Type: dc.FullScrape}, "https://twitter.com/jack/status/2").
+		ExpectNoErrors().
+		ExpectFacts(&hydrocarbon.Post{
+			PostedAt:    time.Date(2020, 3, 2, 10, 0, 0, 0, time.UTC),
+			OriginalURL: "https://twitter.com/jack/status/2",
+			ExternalID:  "2",
+			Title:       "A thread about threads 1/2",
+			Author:      "Jack",
+			Body:        `<p>A thread about threads 1/2</p><hr/><p>2/2</p>`,
+		})
+}
@@ -0,0 +1,377 @@
+package patreon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/microcosm-cc/bluemonday"
+
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+	"github.com/fortytw2/hydrocarbon/httpx"
+)
+
+const (
+	creatorPattern = `^https:\/\/(?:www\.)?patreon\.com\/(?:c\/)?([A-Za-z0-9_-]+)(?:\/posts)?\/?$`
+
+	maxResponseSize = 8 * 1024 * 1024
+)
+
+var (
+	campaignPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`patreon\.com\/api\/campaigns\/(\d+)`),
+		regexp.MustCompile(`"campaign"\s*:\s*\{\s*"data"\s*:\s*\{\s*"id"\s*:\s*"(\d+)"`),
+	}
+
+	// audio and video files are served from patreon's own storage
+	mediaSrc = regexp.MustCompile(`^https:\/\/[a-z0-9-]+\.patreonusercontent\.com\/`)
+
+	errNoCookies = errors.New("patreon: log in with the session_id cookie of a signed in browser, passwords can not be used")
+)
+
+// Plugin is a plugin that can follow creators on patreon, their public posts
+// and, for feeds with the cookies of a patron, the posts only patrons can see
+var Plugin = &dc.Plugin{
+	Name:          "patreon",
+	ConfigCreator: configCreator,
+	ExternalID: func(url string, ho *dc.HandlerOpts) string {
+		return strings.ToLower(ho.RouteParams[1])
+	},
+	// logging in is guarded by a captcha, so patrons hand over the cookies of
+	// a session instead, which are set on the jar before this runs
+	Login: func(ctx context.Context, ho *dc.HandlerOpts, c *dc.Credentials) error {
+		if len(c.Cookies) == 0 {
+			return errNoCookies
+		}
+
+		return nil
+	},
+	RateLimit: &dc.RateLimit{
+		PerDomain: 1,
+	},
+	Entrypoints: []string{creatorPattern},
+	Scheduler:   &dc.Adaptive{Min: time.Hour, Max: 24 * time.Hour},
+	Backfill: func(c *dc.Config) (*dc.Config, error) {
+		return &dc.Config{Entrypoints: c.Entrypoints}, nil
+	},
+	// audio and video posts are played in place
+	AllowHTML: func(p *bluemonday.Policy) {
+		p.AllowAttrs("src").Matching(mediaSrc).OnElements("audio", "video")
+		p.AllowAttrs("controls").Matching(regexp.MustCompile(`^(controls)?$`)).OnElements("audio", "video")
+	},
+	Routes: map[string]dc.Handler{
+		`^https:\/\/www\.patreon\.com\/api\/posts\?`: posts,
+	},
+}
+
+func configCreator(entrypoint string, ho *dc.HandlerOpts) (string, *dc.Config, error) {
+	creator := ho.RouteParams[1]
+
+	resp, err := get(context.TODO(), ho.Client, "https://www.patreon.com/"+creator)
+	if err != nil {
+		return "", nil, err
+	}
+	defer httpx.DrainAndClose(resp.Body)
+
+	page, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return "", nil, err
+	}
+
+	var id string
+	for _, p := range campaignPatterns {
+		if m := p.FindSubmatch(page); m != nil {
+			id = string(m[1])
+			break
+		}
+	}
+	if id == "" {
+		return "", nil, fmt.Errorf("patreon: %s is not a creator", creator)
+	}
+
+	var campaign struct {
+		Data struct {
+			Attributes struct {
+				Name string `json:"name"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	err = getJSON(context.TODO(), ho.Client, "https://www.patreon.com/api/campaigns/"+id, &campaign)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return campaign.Data.Attributes.Name, &dc.Config{
+		Type:        dc.FullScrape,
+		Entrypoints: []string{postsURL(id)},
+	}, nil
+}
+
+// postsURL returns the first page of posts of a campaign, newest first, with
+// the fields and media needed to build them
+func postsURL(campaignID string) string {
+	q := url.Values{
+		"filter[campaign_id]":              {campaignID},
+		"filter[contains_exclusive_posts]": {"true"},
+		"filter[is_draft]":                 {"false"},
+		"sort":                             {"-published_at"},
+		"include":                          {"images,user"},
+		"fields[post]":                     {"title,content,teaser_text,published_at,url,post_type,current_user_can_view,embed,image,post_file"},
+		"fields[media]":                    {"image_urls"},
+		"fields[user]":                     {"full_name"},
+		"json-api-version":                 {"1.0"},
+	}
+
+	return "https://www.patreon.com/api/posts?" + q.Encode()
+}
+
+func get(ctx context.Context, c *http.Client, u string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		httpx.DrainAndClose(resp.Body)
+		return nil, fmt.Errorf("patreon: %s returned %d", u, resp.StatusCode)
+	}
+
+	return resp, nil
+}
+
+func getJSON(ctx context.Context, c *http.Client, u string, x interface{}) error {
+	resp, err := get(ctx, c, u)
+	if err != nil {
+		return err
+	}
+	defer httpx.DrainAndClose(resp.Body)
+
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(x)
+}
+
+type relationship struct {
+	Data json.RawMessage `json:"data"`
+}
+
+// refs returns the IDs of a to-one or to-many relationship
+func (r relationship) refs() []string {
+	var one struct {
+		ID string `json:"id"`
+	}
+	if json.Unmarshal(r.Data, &one) == nil && one.ID != "" {
+		return []string{one.ID}
+	}
+
+	var many []struct {
+		ID string `json:"id"`
+	}
+	if json.Unmarshal(r.Data, &many) != nil {
+		return nil
+	}
+
+	ids := make([]string, 0, len(many))
+	for _, m := range many {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+// an embed is the preview of a page linked by a post, videos included
+type embed struct {
+	URL         string `json:"url"`
+	Subject     string `json:"subject"`
+	Description string `json:"description"`
+}
+
+type postsResp struct {
+	Data []struct {
+		ID         string `json:"id"`
+		Attributes struct {
+			Title              string    `json:"title"`
+			Content            string    `json:"content"`
+			TeaserText         string    `json:"teaser_text"`
+			PublishedAt        time.Time `json:"published_at"`
+			URL                string    `json:"url"`
+			PostType           string    `json:"post_type"`
+			CurrentUserCanView bool      `json:"current_user_can_view"`
+			Embed              *embed    `json:"embed"`
+			Image              *struct {
+				LargeURL string `json:"large_url"`
+			} `json:"image"`
+			PostFile *struct {
+				URL string `json:"url"`
+			} `json:"post_file"`
+		} `json:"attributes"`
+		Relationships struct {
+			Images relationship `json:"images"`
+			User   relationship `json:"user"`
+		} `json:"relationships"`
+	} `json:"data"`
+
+	Included []struct {
+		ID         string `json:"id"`
+		Type       string `json:"type"`
+		Attributes struct {
+			// media
+			ImageURLs struct {
+				Original string `json:"original"`
+			} `json:"image_urls"`
+			// users
+			FullName string `json:"full_name"`
+		} `json:"attributes"`
+	} `json:"included"`
+
+	Links struct {
+		Next string `json:"next"`
+	} `json:"links"`
+}
+
+// posts reads a page of posts, newest first
+func posts(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+	var pr postsResp
+	err := getJSON(ctx, ho.Client, t.URL, &pr)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	images := make(map[string]string)
+	users := make(map[string]string)
+	for _, in := range pr.Included {
+		switch in.Type {
+		case "media":
+			images[in.ID] = in.Attributes.ImageURLs.Original
+		case "user":
+			users[in.ID] = in.Attributes.FullName
+		}
+	}
+
+	var facts []interface{}
+	for _, d := range pr.Data {
+		a := d.Attributes
+		if !ho.Config.Newer(a.PublishedAt) {
+			return dc.Response(facts)
+		}
+
+		var b strings.Builder
+		text := a.Content
+		if !a.CurrentUserCanView {
+			// only the teaser of posts for patrons is shown to everyone else,
+			// without any of their media, even if the content is sent anyway
+			text = a.TeaserText
+			if a.TeaserText != "" {
+				fmt.Fprintf(&b, "<p>%s</p>", html.EscapeString(a.TeaserText))
+			}
+			fmt.Fprintf(&b, `<p><a href="%s">This post is for patrons only</a></p>`, html.EscapeString(a.URL))
+		} else {
+			for _, id := range d.Relationships.Images.refs() {
+				if src := images[id]; src != "" {
+					fmt.Fprintf(&b, `<figure><img src="%s"/></figure>`, html.EscapeString(src))
+				}
+			}
+
+			var file, preview string
+			if a.PostFile != nil {
+				file = a.PostFile.URL
+			}
+			if a.Image != nil {
+				preview = a.Image.LargeURL
+			}
+			writeMedia(&b, a.PostType, file, preview, a.Embed)
+			b.WriteString(a.Content)
+		}
+
+		p := &hydrocarbon.Post{
+			PostedAt:    a.PublishedAt.UTC(),
+			OriginalURL: a.URL,
+			ExternalID:  d.ID,
+			Title:       strings.TrimSpace(a.Title),
+			Body:        b.String(),
+		}
+		for _, id := range d.Relationships.User.refs() {
+			p.Author = users[id]
+		}
+		// untitled posts are usually a shared video or link
+		if p.Title == "" && a.Embed != nil {
+			p.Title = a.Embed.Subject
+		}
+		if p.Title == "" {
+			p.Title = excerpt(text)
+		}
+
+		facts = append(facts, p)
+	}
+
+	maxPages := 0
+	if ho.Config == nil || ho.Config.Type == dc.FullScrape {
+		maxPages = dc.FullScrapePages
+	}
+
+	if next := dc.NextPage(t, pr.Links.Next, maxPages); next != nil {
+		return dc.Response(facts, next)
+	}
+
+	return dc.Response(facts)
+}
+
+// writeMedia writes the file or embed of a post the way it is shown, files are
+// played in place and embedded videos and links become a preview of their page
+func writeMedia(b *strings.Builder, postType, file, preview string, e *embed) {
+	switch postType {
+	case "audio_file":
+		if file != "" {
+			fmt.Fprintf(b, `<p><audio controls src="%s"></audio></p>`, html.EscapeString(file))
+		}
+	case "video_external_file":
+		if file != "" {
+			fmt.Fprintf(b, `<p><video controls src="%s"></video></p>`, html.EscapeString(file))
+		}
+	case "video_embed", "audio_embed", "link":
+		if e == nil || e.URL == "" {
+			return
+		}
+
+		link := html.EscapeString(e.URL)
+		if preview != "" {
+			fmt.Fprintf(b, `<p><a href="%s"><img src="%s"/></a></p>`, link, html.EscapeString(preview))
+		}
+		subject := e.Subject
+		if subject == "" {
+			subject = e.URL
+		}
+		fmt.Fprintf(b, `<p><a href="%s">%s</a></p>`, link, html.EscapeString(subject))
+		if e.Description != "" {
+			fmt.Fprintf(b, "<blockquote>%s</blockquote>", html.EscapeString(e.Description))
+		}
+	}
+}
+
+// excerpt titles posts made without one by the start of their text
+func excerpt(body string) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	words := strings.Fields(doc.Text())
+	if len(words) > 10 {
+		return strings.Join(words[:10], " ") + "…"
+	}
+
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,105 @@
+package patreon
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+	"github.com/fortytw2/hydrocarbon/discollect/dctest"
+)
+
+const firstPage = "https://www.patreon.com/api/posts?fields%5Bmedia%5D=image_urls&fields%5Bpost%5D=title%2Ccontent%2Cteaser_text%2Cpublished_at%2Curl%2Cpost_type%2Ccurrent_user_can_view%2Cembed%2Cimage%2Cpost_file&fields%5Buser%5D=full_name&filter%5Bcampaign_id%5D=42&filter%5Bcontains_exclusive_posts%5D=true&filter%5Bis_draft%5D=false&include=images%2Cuser&json-api-version=1.0&sort=-published_at"
+
+func TestConfigCreator(t *testing.T) {
+	h := dctest.New(t, Plugin, "testdata/patreon.json")
+	defer h.Close()
+
+	for _, entrypoint := range []string{"https://www.patreon.com/inkstudio", "https://patreon.com/c/inkstudio/posts"} {
+		title, cfg, err := Plugin.ConfigCreator(entrypoint, &dc.HandlerOpts{
+			Client:      h.Client,
+			RouteParams: regexp.MustCompile(creatorPattern).FindStringSubmatch(entrypoint),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if title != "Ink Studio" || cfg.Entrypoints[0] != firstPage {
+			t.Errorf("unexpected config %q for %s", cfg.Entrypoints, title)
+		}
+	}
+
+	_, _, err := Plugin.ConfigCreator("https://www.patreon.com/nobody", &dc.HandlerOpts{
+		Client:      h.Client,
+		RouteParams: regexp.MustCompile(creatorPattern).FindStringSubmatch("https://www.patreon.com/nobody"),
+	})
+	if err == nil {
+		t.Error("expected a page without a campaign to be refused")
+	}
+}
+
+func TestPosts(t *testing.T) {
+	h := dctest.New(t, Plugin, "testdata/patreon.json")
+	defer h.Close()
+
+	sketches := &hydrocarbon.Post{
+		PostedAt:    time.Date(2020, 3, 4, 10, 0, 0, 0, time.UTC),
+		OriginalURL: "https://www.patreon.com/posts/sketches-1004",
+		ExternalID:  "1004",
+		Title:       "Sketches",
+		Author:      "Ink Studio",
+		Body: `<figure><img src="https://c10.patreonusercontent.com/img/1.png"/></figure>` +
+			`<figure><img src="https://c10.patreonusercontent.com/img/2.png"/></figure>` +
+			`<p>This week's sketches</p>`,
+	}
+
+	h.Run(&dc.Config{Type: dc.FullScrape}, firstPage).
+		ExpectNoErrors().
+		ExpectTasks("https://www.patreon.com/api/posts?filter%5Bcampaign_id%5D=42&page%5Bcursor%5D=03%3A2020&sort=-published_at").
+		ExpectFacts(sketches, &hydrocarbon.Post{
+			PostedAt:    time.Date(2020, 3, 3, 10, 0, 0, 0, time.UTC),
+			OriginalURL: "https://www.patreon.com/posts/episode-3-1003",
+			ExternalID:  "1003",
+			Title:       "Episode 3",
+			Author:      "Ink Studio",
+			Body:        `<p><audio controls src="https://c10.patreonusercontent.com/audio/ep3.mp3"></audio></p><p>Show notes</p>`,
+		}, &hydrocarbon.Post{
+			PostedAt:    time.Date(2020, 3, 2, 10, 0, 0, 0, time.UTC),
+			OriginalURL: "https://www.patreon.com/posts/early-access-1002",
+			ExternalID:  "1002",
+			Title:       "Early access: chapter 9",
+			Author:      "Ink Studio",
+			Body:        `<p>Chapter 9 starts where we left off</p><p><a href="https://www.patreon.com/posts/early-access-1002">This post is for patrons only</a></p>`,
+		}, &hydrocarbon.Post{
+			PostedAt:    time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC),
+			OriginalURL: "https://www.patreon.com/posts/1001",
+			ExternalID:  "1001",
+			Title:       "The new video",
+			Author:      "Ink Studio",
+			Body: `<p><a href="https://www.youtube.com/watch?v=abc"><img src="https://c10.patreonusercontent.com/thumb/abc.jpg"/></a></p>` +
+				`<p><a href="https://www.youtube.com/watch?v=abc">The new video</a></p><blockquote>Ten minutes of painting</blockquote>` +
+				`<p>Making of the <b>new</b> video</p>`,
+		})
+
+	// the delta scrape stops at the first post already stored
+	h.Run(&dc.Config{Type: dc.DeltaScrape, Since: time.Date(2020, 3, 3, 12, 0, 0, 0, time.UTC)}, firstPage).
+		ExpectNoErrors().
+		ExpectTasks().
+		ExpectFacts(sketches)
+}
+
+func TestLogin(t *testing.T) {
+	t.Parallel()
+
+	err := Plugin.Login(context.Background(), &dc.HandlerOpts{}, &dc.Credentials{Username: "patron@example.com", Password: "hunter2"})
+	if err != errNoCookies {
+		t.Errorf("expected logging in with a password to be refused, got %v", err)
+	}
+
+	err = Plugin.Login(context.Background(), &dc.HandlerOpts{}, &dc.Credentials{Cookies: []*http.Cookie{{Name: "session_id", Value: "abc"}}})
+	if err != nil {
+		t.Error(err)
+	}
+}
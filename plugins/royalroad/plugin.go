@@ -0,0 +1,234 @@
+package royalroad
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+	"github.com/fortytw2/hydrocarbon/httpx"
+)
+
+// chapter pages hide paragraphs with classes set to display: none in the head
+// of the page, to catch sites copying their chapters
+var hiddenClass = regexp.MustCompile(`\.([\w-]+)\s*\{[^}]*display:\s*none`)
+
+// Plugin is a plugin that can scrape fictions on royalroad
+var Plugin = &dc.Plugin{
+	Name:          "royalroad",
+	ConfigCreator: configCreator,
+	// the number after /fiction/, the slug following it is the title
+	ExternalID: func(url string, ho *dc.HandlerOpts) string {
+		return ho.RouteParams[2]
+	},
+	RateLimit: &dc.RateLimit{
+		PerDomain: 1,
+	},
+	Entrypoints: []string{
+		`^https:\/\/(www\.)?royalroad\.com\/fiction\/(\d+)`,
+	},
+	// authors on royalroad tend to post daily or a few times a week
+	Scheduler: &dc.Adaptive{Min: time.Hour, Max: 24 * time.Hour},
+	// the table of contents on the fiction page is never paged
+	Backfill: func(c *dc.Config) (*dc.Config, error) {
+		return &dc.Config{Entrypoints: c.Entrypoints}, nil
+	},
+	// configs hold the fiction page by its number alone
+	ConfigSchema: `{
+		"properties": {
+			"Entrypoints": {"items": {"pattern": "^https://www\\.royalroad\\.com/fiction/\\d+$"}}
+		}
+	}`,
+	Routes: map[string]dc.Handler{
+		`^https:\/\/www\.royalroad\.com\/fiction\/(\d+)(\/[^\/]*)?\/?$`:                  fictionPage,
+		`^https:\/\/www\.royalroad\.com\/fiction\/(\d+)\/[^\/]*\/chapter\/(\d+)(\/.*)?$`: chapterPage,
+	},
+}
+
+func configCreator(entrypointURL string, ho *dc.HandlerOpts) (string, *dc.Config, error) {
+	// chapter urls start with the url of their fiction
+	fictionURL := "https://www.royalroad.com/fiction/" + ho.RouteParams[2]
+
+	doc, err := getDoc(context.TODO(), ho.Client, fictionURL)
+	if err != nil {
+		return "", nil, err
+	}
+
+	f := parseFiction(doc)
+	if f.Title == "" {
+		return "", nil, errors.New("royalroad: could not find the title of the fiction")
+	}
+
+	return f.Title, &dc.Config{
+		Type:        dc.FullScrape,
+		Entrypoints: []string{fictionURL},
+	}, nil
+}
+
+func getDoc(ctx context.Context, c *http.Client, u string) (*goquery.Document, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer httpx.DrainAndClose(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("royalroad: %s returned %d", u, resp.StatusCode)
+	}
+
+	return goquery.NewDocumentFromReader(resp.Body)
+}
+
+// fiction holds the cover and author of a fiction, which chapter pages do not
+// show, for every chapter task
+type fiction struct {
+	Title  string `json:"title"`
+	Author string `json:"author"`
+	Cover  string `json:"cover,omitempty"`
+}
+
+func parseFiction(doc *goquery.Document) *fiction {
+	f := &fiction{
+		Title:  strings.TrimSpace(doc.Find(`.fic-title h1`).First().Text()),
+		Author: strings.TrimSpace(doc.Find(`meta[property="books:author"]`).AttrOr("content", "")),
+		Cover:  strings.TrimSpace(doc.Find(`.cover-art-container img`).First().AttrOr("src", "")),
+	}
+
+	if f.Title == "" {
+		f.Title = strings.TrimSpace(doc.Find(`meta[property="og:title"]`).AttrOr("content", ""))
+	}
+	if f.Author == "" {
+		f.Author = strings.TrimSpace(doc.Find(`.fic-title h4 a`).First().Text())
+	}
+	if f.Cover == "" {
+		f.Cover = strings.TrimSpace(doc.Find(`meta[property="og:image"]`).AttrOr("content", ""))
+	}
+
+	return f
+}
+
+// parseTime reads the time of a chapter from a time element, royalroad gives
+// it as a unix timestamp and in RFC 3339
+func parseTime(s *goquery.Selection) (time.Time, bool) {
+	if unix, err := strconv.ParseInt(s.AttrOr("unixtime", ""), 10, 64); err == nil {
+		return time.Unix(unix, 0).UTC(), true
+	}
+
+	t, err := time.Parse(time.RFC3339, s.AttrOr("datetime", ""))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return t.UTC(), true
+}
+
+func fictionPage(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+	doc, err := getDoc(ctx, ho.Client, t.URL)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	base, err := url.Parse(t.URL)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	extra, err := json.Marshal(parseFiction(doc))
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	var tasks []*dc.Task
+	doc.Find(`#chapters tr.chapter-row`).Each(func(i int, sel *goquery.Selection) {
+		href := sel.AttrOr("data-url", "")
+		if href == "" {
+			href = sel.Find(`a[href]`).First().AttrOr("href", "")
+		}
+		if href == "" {
+			return
+		}
+
+		u, err := base.Parse(href)
+		if err != nil {
+			return
+		}
+
+		// the table of contents times every release to the second, delta
+		// scrapes skip those up to the latest post
+		if postedAt, ok := parseTime(sel.Find(`time`).First()); ok && !ho.Config.Newer(postedAt) {
+			return
+		}
+
+		tasks = append(tasks, &dc.Task{
+			URL:   u.String(),
+			Extra: map[string]json.RawMessage{"fiction": extra},
+		})
+	})
+
+	return dc.Response(nil, tasks...)
+}
+
+func chapterPage(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+	doc, err := getDoc(ctx, ho.Client, t.URL)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	var f fiction
+	if raw, ok := t.Extra["fiction"]; ok {
+		err = json.Unmarshal(raw, &f)
+		if err != nil {
+			return dc.ErrorResponse(err)
+		}
+	} else {
+		f = *parseFiction(doc)
+	}
+
+	postedAt, ok := parseTime(doc.Find(`.fic-header time`).First())
+	if !ok {
+		return dc.ErrorResponse(fmt.Errorf("royalroad: could not find when %s was posted", t.URL))
+	}
+
+	content := doc.Find(`.chapter-content`).First()
+	if content.Length() == 0 {
+		return dc.ErrorResponse(fmt.Errorf("royalroad: could not find the content of %s", t.URL))
+	}
+
+	for _, m := range hiddenClass.FindAllStringSubmatch(doc.Find(`head style`).Text(), -1) {
+		content.Find("." + m[1]).Remove()
+	}
+
+	body, err := content.Html()
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	p := &hydrocarbon.Post{
+		PostedAt:    postedAt,
+		OriginalURL: t.URL,
+		ExternalID:  ho.RouteParams[1] + ":" + ho.RouteParams[2],
+		Title:       strings.TrimSpace(doc.Find(`.fic-header h1`).First().Text()),
+		Author:      f.Author,
+		Body:        html.UnescapeString(strings.TrimSpace(body)),
+	}
+	if f.Cover != "" {
+		p.Extra = map[string]interface{}{"cover": f.Cover}
+	}
+
+	return dc.Response([]interface{}{p})
+}
@@ -0,0 +1,44 @@
+package royalroad
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+	"github.com/fortytw2/hydrocarbon/discollect/dctest"
+)
+
+const (
+	fictionURL = "https://www.royalroad.com/fiction/1234"
+	chapter100 = "https://www.royalroad.com/fiction/1234/the-wandering-inn/chapter/100/1-00"
+	chapter101 = "https://www.royalroad.com/fiction/1234/the-wandering-inn/chapter/101/1-01"
+)
+
+func TestFiction(t *testing.T) {
+	h := dctest.New(t, Plugin, "testdata/royalroad.json")
+	defer h.Close()
+
+	full := h.Run(&dc.Config{Type: dc.FullScrape}, fictionURL).
+		ExpectNoErrors().
+		ExpectTasks(chapter100, chapter101)
+
+	// the delta scrape only wants the chapter released after the first
+	h.Run(&dc.Config{Type: dc.DeltaScrape, Since: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)}, fictionURL).
+		ExpectNoErrors().
+		ExpectTasks(chapter101)
+
+	h.RunTask(&dc.Config{Type: dc.FullScrape}, full.Tasks[1]).
+		ExpectNoErrors().
+		ExpectFacts(&hydrocarbon.Post{
+			PostedAt:    time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC),
+			OriginalURL: chapter101,
+			ExternalID:  "1234:101",
+			Title:       "1.01",
+			Author:      "pirateaba",
+			Body:        "<p>The inn was quiet.</p><p>Erin waited.</p>",
+			Extra: map[string]interface{}{
+				"cover": "https://www.royalroadcdn.com/public/covers-full/inn.jpg",
+			},
+		})
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/fortytw2/hydrocarbon/httpx"
 	"github.com/microcosm-cc/bluemonday"
 	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
 
 	dc "github.com/fortytw2/hydrocarbon/discollect"
 )
@@ -27,6 +28,15 @@ var rssPolicy = bluemonday.UGCPolicy().AddTargetBlankToFullyQualifiedLinks(true)
 var Plugin = &dc.Plugin{
 	Name:        "rss",
 	Entrypoints: []string{".*"},
+	ContentTypes: []string{
+		"application/rss+xml",
+		"application/atom+xml",
+		"application/rdf+xml",
+		"application/xml",
+		"text/xml",
+	},
+	// feeds are published for readers to poll
+	IgnoreRobots: true,
 	ConfigCreator: func(url string, ho *dc.HandlerOpts) (string, *dc.Config, error) {
 		f, err := getFeed(context.TODO(), ho.Client, url)
 		if err != nil {
@@ -55,16 +65,15 @@ func rssFeed(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerRes
 		return dc.ErrorResponse(err)
 	}
 
-	out := make([]interface{}, len(posts))
-	for i, p := range posts {
-		downloaded, err := dc.DownloadImages(p.Body, ho.Client, ho.FileStore)
-		if err != nil {
-			return dc.ErrorResponse(err)
+	// delta scrapes leave posts already stored alone, sparing their images
+	// from being rehosted again
+	out := make([]interface{}, 0, len(posts))
+	for _, p := range posts {
+		if !ho.Config.Newer(p.PostedAt) {
+			continue
 		}
 
-		p.Body = downloaded
-
-		out[i] = p
+		out = append(out, p)
 	}
 
 	return &dc.HandlerResponse{
@@ -124,14 +133,60 @@ func parseFeed(f *gofeed.Feed) ([]*hydrocarbon.Post, error) {
 			author = i.Author.Name
 		}
 
+		// item level terms override those of the whole feed
+		license := ccLicense(i.Extensions)
+		if license == "" {
+			license = ccLicense(f.Extensions)
+		}
+
+		attribution := dcRights(i.DublinCoreExt)
+		if attribution == "" {
+			attribution = strings.TrimSpace(f.Copyright)
+		}
+
 		posts = append(posts, &hydrocarbon.Post{
 			PostedAt:    pubDate,
 			Author:      strings.TrimSpace(author),
 			Title:       strings.TrimSpace(i.Title),
 			Body:        strings.TrimSpace(sanitized),
 			OriginalURL: strings.TrimSpace(i.Link),
+			License:     license,
+			Attribution: attribution,
 		})
 	}
 
 	return posts, nil
 }
+
+// ccLicense returns the license declared with the creativeCommons RSS module
+// https://cyber.harvard.edu/rss/creativeCommonsRssModule.html
+func ccLicense(e ext.Extensions) string {
+	for _, ns := range []string{"creativeCommons", "cc"} {
+		for _, l := range e[ns]["license"] {
+			if v := strings.TrimSpace(l.Value); v != "" {
+				return v
+			}
+
+			if v := strings.TrimSpace(l.Attrs["resource"]); v != "" {
+				return v
+			}
+		}
+	}
+
+	return ""
+}
+
+// dcRights returns the dublin core rights statement, if any
+func dcRights(dc *ext.DublinCoreExtension) string {
+	if dc == nil {
+		return ""
+	}
+
+	for _, r := range dc.Rights {
+		if r = strings.TrimSpace(r); r != "" {
+			return r
+		}
+	}
+
+	return ""
+}
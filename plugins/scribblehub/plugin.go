@@ -0,0 +1,249 @@
+package scribblehub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+	"github.com/fortytw2/hydrocarbon/httpx"
+)
+
+// the series page only shows a page of its chapters, the whole table is
+// loaded from here
+const tocURL = "https://www.scribblehub.com/wp-admin/admin-ajax.php"
+
+// dates in the chapter table, which are given in UTC
+const dateLayout = "Jan 2, 2006 03:04 PM"
+
+// Plugin is a plugin that can scrape series on scribblehub
+var Plugin = &dc.Plugin{
+	Name:          "scribblehub",
+	ConfigCreator: configCreator,
+	// the series number, which /series/ and /read/ urls both start with
+	ExternalID: func(url string, ho *dc.HandlerOpts) string {
+		return ho.RouteParams[3]
+	},
+	RateLimit: &dc.RateLimit{
+		PerDomain: 1,
+	},
+	Entrypoints: []string{
+		`^https:\/\/(www\.)?scribblehub\.com\/(series|read)\/(\d+)`,
+	},
+	// series here mostly release a chapter or two a week
+	Scheduler: &dc.Adaptive{Min: time.Hour, Max: 24 * time.Hour},
+	// the chapter table is fetched whole, never a page of it
+	Backfill: func(c *dc.Config) (*dc.Config, error) {
+		return &dc.Config{Entrypoints: c.Entrypoints}, nil
+	},
+	// chapters are read from the table of the series, not from one another
+	ConfigSchema: `{
+		"properties": {
+			"Entrypoints": {"items": {"pattern": "^https://www\\.scribblehub\\.com/series/\\d+/$"}}
+		}
+	}`,
+	Routes: map[string]dc.Handler{
+		`^https:\/\/www\.scribblehub\.com\/series\/(\d+)(\/[^\/]*)?\/?$`:           seriesPage,
+		`^https:\/\/www\.scribblehub\.com\/read\/(\d+)-[^\/]*\/chapter\/(\d+)\/?$`: chapterPage,
+	},
+}
+
+func configCreator(entrypointURL string, ho *dc.HandlerOpts) (string, *dc.Config, error) {
+	// /read/ urls of chapters hold the number of their series
+	seriesURL := "https://www.scribblehub.com/series/" + ho.RouteParams[3] + "/"
+
+	doc, err := getDoc(context.TODO(), ho.Client, http.MethodGet, seriesURL, nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	s := parseSeries(doc)
+	if s.Title == "" {
+		return "", nil, errors.New("scribblehub: could not find the title of the series")
+	}
+
+	return s.Title, &dc.Config{
+		Type:        dc.FullScrape,
+		Entrypoints: []string{seriesURL},
+	}, nil
+}
+
+func getDoc(ctx context.Context, c *http.Client, method, u string, form url.Values) (*goquery.Document, error) {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer httpx.DrainAndClose(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("scribblehub: %s returned %d", u, resp.StatusCode)
+	}
+
+	return goquery.NewDocumentFromReader(resp.Body)
+}
+
+// series is read once from the series page for all of its chapters
+type series struct {
+	Title  string `json:"title"`
+	Author string `json:"author"`
+	Cover  string `json:"cover,omitempty"`
+}
+
+func parseSeries(doc *goquery.Document) *series {
+	return &series{
+		Title:  strings.TrimSpace(doc.Find(`.fic_title`).First().Text()),
+		Author: strings.TrimSpace(doc.Find(`.auth_name_fic`).First().Text()),
+		Cover:  strings.TrimSpace(doc.Find(`.fic_image img`).First().AttrOr("src", "")),
+	}
+}
+
+// chapterExtra is passed on to every chapter task
+type chapterExtra struct {
+	Series   *series   `json:"series"`
+	PostedAt time.Time `json:"posted_at"`
+}
+
+type tocEntry struct {
+	order    int
+	url      string
+	postedAt time.Time
+}
+
+func seriesPage(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+	doc, err := getDoc(ctx, ho.Client, http.MethodGet, t.URL, nil)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+	s := parseSeries(doc)
+
+	// a pagenum of -1 returns every chapter at once
+	toc, err := getDoc(ctx, ho.Client, http.MethodPost, tocURL, url.Values{
+		"action":   {"wi_getreleases_pagination"},
+		"pagenum":  {"-1"},
+		"mypostid": {ho.RouteParams[1]},
+	})
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	var entries []*tocEntry
+	toc.Find(`li.toc_w`).Each(func(i int, sel *goquery.Selection) {
+		href, ok := sel.Find(`a.toc_a`).First().Attr("href")
+		if !ok {
+			return
+		}
+
+		e := &tocEntry{url: strings.TrimSpace(href)}
+		e.order, _ = strconv.Atoi(sel.AttrOr("order", ""))
+		// the title holds the date, the text is relative
+		e.postedAt, _ = time.Parse(dateLayout, strings.TrimSpace(sel.Find(`.fic_date_pub`).AttrOr("title", "")))
+
+		entries = append(entries, e)
+	})
+
+	// the table is newest first
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].order < entries[j].order
+	})
+
+	var tasks []*dc.Task
+	for _, e := range entries {
+		// rows whose title holds no date are fetched on every scrape
+		if !e.postedAt.IsZero() && !ho.Config.Newer(e.postedAt) {
+			continue
+		}
+
+		extra, err := json.Marshal(&chapterExtra{Series: s, PostedAt: e.postedAt})
+		if err != nil {
+			return dc.ErrorResponse(err)
+		}
+
+		tasks = append(tasks, &dc.Task{
+			URL:   e.url,
+			Extra: map[string]json.RawMessage{"chapter": extra},
+		})
+	}
+
+	return dc.Response(nil, tasks...)
+}
+
+func chapterPage(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+	doc, err := getDoc(ctx, ho.Client, http.MethodGet, t.URL, nil)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	ce := &chapterExtra{Series: &series{}}
+	if raw, ok := t.Extra["chapter"]; ok {
+		err = json.Unmarshal(raw, ce)
+		if err != nil {
+			return dc.ErrorResponse(err)
+		}
+	}
+	if ce.PostedAt.IsZero() {
+		ce.PostedAt = time.Now()
+	}
+
+	content := doc.Find(`#chp_raw`).First()
+	if content.Length() == 0 {
+		return dc.ErrorResponse(fmt.Errorf("scribblehub: could not find the content of %s", t.URL))
+	}
+
+	// author's notes sit inside the chapter, they are moved below it so the
+	// chapter reads on its own
+	var notes []string
+	content.Find(`.wi_authornotes`).Each(func(i int, sel *goquery.Selection) {
+		note, err := sel.Find(`.wi_authornotes_body`).First().Html()
+		if err == nil && strings.TrimSpace(note) != "" {
+			notes = append(notes, strings.TrimSpace(note))
+		}
+	}).Remove()
+
+	body, err := content.Html()
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+	body = strings.TrimSpace(body)
+
+	for _, note := range notes {
+		body += `<hr/><blockquote class="author-note">` + note + `</blockquote>`
+	}
+
+	p := &hydrocarbon.Post{
+		PostedAt:    ce.PostedAt,
+		OriginalURL: t.URL,
+		ExternalID:  ho.RouteParams[1] + ":" + ho.RouteParams[2],
+		Title:       strings.TrimSpace(doc.Find(`.chapter-title`).First().Text()),
+		Author:      ce.Series.Author,
+		Body:        html.UnescapeString(body),
+	}
+	if ce.Series.Cover != "" {
+		p.Extra = map[string]interface{}{"cover": ce.Series.Cover}
+	}
+
+	return dc.Response([]interface{}{p})
+}
@@ -0,0 +1,43 @@
+package scribblehub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+	"github.com/fortytw2/hydrocarbon/discollect/dctest"
+)
+
+const (
+	seriesURL = "https://www.scribblehub.com/series/1234/"
+	chapter1  = "https://www.scribblehub.com/read/1234-the-lone-dungeon/chapter/5001/"
+	chapter2  = "https://www.scribblehub.com/read/1234-the-lone-dungeon/chapter/5002/"
+)
+
+func TestSeries(t *testing.T) {
+	h := dctest.New(t, Plugin, "testdata/scribblehub.json")
+	defer h.Close()
+
+	full := h.Run(&dc.Config{Type: dc.FullScrape}, seriesURL).
+		ExpectNoErrors().
+		ExpectTasks(chapter1, chapter2)
+
+	h.Run(&dc.Config{Type: dc.DeltaScrape, Since: time.Date(2020, 3, 1, 18, 30, 0, 0, time.UTC)}, seriesURL).
+		ExpectNoErrors().
+		ExpectTasks(chapter2)
+
+	h.RunTask(&dc.Config{Type: dc.FullScrape}, full.Tasks[1]).
+		ExpectNoErrors().
+		ExpectFacts(&hydrocarbon.Post{
+			PostedAt:    time.Date(2020, 3, 2, 18, 30, 0, 0, time.UTC),
+			OriginalURL: chapter2,
+			ExternalID:  "1234:5002",
+			Title:       "Chapter 2",
+			Author:      "KeyboardKnight",
+			Body:        `<p>The dungeon woke.</p><p>It was alone.</p><hr/><blockquote class="author-note"><p>Thanks for reading!</p></blockquote>`,
+			Extra: map[string]interface{}{
+				"cover": "https://cdn.scribblehub.com/images/10/lone.jpg",
+			},
+		})
+}
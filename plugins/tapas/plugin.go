@@ -0,0 +1,286 @@
+package tapas
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+	"github.com/fortytw2/hydrocarbon/httpx"
+)
+
+// dates in the episode list
+const dateLayout = "Jan 02, 2006"
+
+// Plugin is a plugin that can scrape comics on tapas, each episode is a post
+// of its panels
+var Plugin = &dc.Plugin{
+	Name:          "tapas",
+	ConfigCreator: configCreator,
+	// the slug is the only ID in the url of a series
+	ExternalID: func(url string, ho *dc.HandlerOpts) string {
+		return ho.RouteParams[1]
+	},
+	RateLimit: &dc.RateLimit{
+		PerDomain: 1,
+	},
+	Headers: http.Header{
+		"Referer": []string{"https://tapas.io/"},
+	},
+	Entrypoints: []string{
+		`^https:\/\/(?:m\.)?tapas\.io\/series\/([\w-]+)`,
+	},
+	// tapas series usually update on a fixed day of the week
+	Scheduler: &dc.Adaptive{Min: time.Hour, Max: 24 * time.Hour},
+	// the JSON of the episode list says whether there is a next page
+	Backfill: func(c *dc.Config) (*dc.Config, error) {
+		return &dc.Config{Entrypoints: c.Entrypoints}, nil
+	},
+	// only the info page turns the slug into the numeric series ID
+	ConfigSchema: `{
+		"properties": {
+			"Entrypoints": {"items": {"pattern": "^https://tapas\\.io/series/[\\w-]+/info$"}}
+		}
+	}`,
+	Routes: map[string]dc.Handler{
+		`^https:\/\/tapas\.io\/series\/([\w-]+)\/info$`:   seriesPage,
+		`^https:\/\/tapas\.io\/series\/(\d+)\/episodes\?`: episodesPage,
+		`^https:\/\/tapas\.io\/episode\/(\d+)$`:           episodePage,
+	},
+}
+
+func configCreator(entrypointURL string, ho *dc.HandlerOpts) (string, *dc.Config, error) {
+	infoURL := "https://tapas.io/series/" + ho.RouteParams[1] + "/info"
+
+	doc, err := getDoc(context.TODO(), ho.Client, infoURL)
+	if err != nil {
+		return "", nil, err
+	}
+
+	s := parseSeries(doc)
+	if s.Title == "" {
+		return "", nil, errors.New("tapas: could not find the title of the series")
+	}
+
+	return s.Title, &dc.Config{
+		Type:        dc.FullScrape,
+		Entrypoints: []string{infoURL},
+	}, nil
+}
+
+func get(ctx context.Context, c *http.Client, u string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		httpx.DrainAndClose(resp.Body)
+		return nil, fmt.Errorf("tapas: %s returned %d", u, resp.StatusCode)
+	}
+
+	return resp, nil
+}
+
+func getDoc(ctx context.Context, c *http.Client, u string) (*goquery.Document, error) {
+	resp, err := get(ctx, c, u)
+	if err != nil {
+		return nil, err
+	}
+	defer httpx.DrainAndClose(resp.Body)
+
+	return goquery.NewDocumentFromReader(resp.Body)
+}
+
+type series struct {
+	ID     string `json:"id"`
+	Title  string `json:"title"`
+	Author string `json:"author"`
+}
+
+func parseSeries(doc *goquery.Document) *series {
+	return &series{
+		ID:     strings.TrimPrefix(doc.Find(`meta[property="al:android:url"]`).AttrOr("content", ""), "tapastic://series/"),
+		Title:  strings.TrimSpace(doc.Find(`meta[property="og:title"]`).AttrOr("content", "")),
+		Author: strings.TrimSpace(doc.Find(`.creator .name`).First().Text()),
+	}
+}
+
+// the info page links to the episode list, which is loaded as JSON holding
+// pages of HTML
+func seriesPage(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+	doc, err := getDoc(ctx, ho.Client, t.URL)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	s := parseSeries(doc)
+	if s.ID == "" {
+		return dc.ErrorResponse(fmt.Errorf("tapas: could not find the ID of the series at %s", t.URL))
+	}
+
+	extra, err := json.Marshal(s)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	return dc.Response(nil, &dc.Task{
+		URL:   "https://tapas.io/series/" + s.ID + "/episodes?page=1&sort=NEWEST",
+		Extra: map[string]json.RawMessage{"series": extra},
+	})
+}
+
+type episodeList struct {
+	Data struct {
+		Body       string `json:"body"`
+		Pagination struct {
+			HasNext bool `json:"has_next"`
+		} `json:"pagination"`
+	} `json:"data"`
+}
+
+// episode holds the date and author of an episode from the list, the viewer
+// may not show them
+type episode struct {
+	Title    string    `json:"title"`
+	Author   string    `json:"author"`
+	PostedAt time.Time `json:"posted_at"`
+}
+
+// episodesPage reads a page of the episode list, newest first
+func episodesPage(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+	var s series
+	if raw, ok := t.Extra["series"]; ok {
+		err := json.Unmarshal(raw, &s)
+		if err != nil {
+			return dc.ErrorResponse(err)
+		}
+	}
+
+	resp, err := get(ctx, ho.Client, t.URL)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+	defer httpx.DrainAndClose(resp.Body)
+
+	var el episodeList
+	err = json.NewDecoder(resp.Body).Decode(&el)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(el.Data.Body))
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	base, err := url.Parse(t.URL)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	var (
+		tasks []*dc.Task
+		// set once an episode from before the day of the newest stored is
+		// seen, there is nothing older to look for
+		done bool
+	)
+	doc.Find(`li.episode-item`).EachWithBreak(func(i int, sel *goquery.Selection) bool {
+		// episodes still to be unlocked have nothing to read
+		if sel.HasClass("locked") {
+			return true
+		}
+
+		href, ok := sel.Find(`a[href]`).First().Attr("href")
+		if !ok {
+			return true
+		}
+
+		u, err := base.Parse(href)
+		if err != nil {
+			return true
+		}
+
+		e := &episode{
+			Title:  strings.TrimSpace(sel.Find(`.title`).First().Text()),
+			Author: s.Author,
+		}
+		e.PostedAt, err = time.Parse(dateLayout, strings.TrimSpace(sel.Find(`.date`).First().Text()))
+		if err == nil && !ho.Config.NewerDay(e.PostedAt) {
+			done = true
+			return false
+		}
+
+		extra, err := json.Marshal(e)
+		if err != nil {
+			return true
+		}
+
+		tasks = append(tasks, &dc.Task{
+			URL:   u.String(),
+			Extra: map[string]json.RawMessage{"episode": extra},
+		})
+		return true
+	})
+
+	if !done && el.Data.Pagination.HasNext {
+		if next := dc.NextPageNumber(t, "page", 0); next != nil {
+			tasks = append(tasks, next)
+		}
+	}
+
+	return dc.Response(nil, tasks...)
+}
+
+func episodePage(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+	doc, err := getDoc(ctx, ho.Client, t.URL)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	e := &episode{}
+	if raw, ok := t.Extra["episode"]; ok {
+		err = json.Unmarshal(raw, e)
+		if err != nil {
+			return dc.ErrorResponse(err)
+		}
+	}
+	if e.PostedAt.IsZero() {
+		e.PostedAt = time.Now()
+	}
+
+	// data-src holds the panel, src a blank until it is scrolled to
+	var srcs []string
+	doc.Find(`.viewer__body img.content__img`).Each(func(i int, sel *goquery.Selection) {
+		if src := sel.AttrOr("data-src", sel.AttrOr("src", "")); src != "" {
+			srcs = append(srcs, src)
+		}
+	})
+
+	// the signed urls of the panels expire, so they are rehosted now
+	body, err := dc.ImageSequence(ctx, ho, t.URL, srcs)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	return dc.Response([]interface{}{&hydrocarbon.Post{
+		PostedAt:    e.PostedAt,
+		OriginalURL: t.URL,
+		ExternalID:  ho.RouteParams[1],
+		Title:       e.Title,
+		Author:      e.Author,
+		Body:        body,
+	}})
+}
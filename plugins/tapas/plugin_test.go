@@ -0,0 +1,49 @@
+package tapas
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+	"github.com/fortytw2/hydrocarbon/discollect/dctest"
+)
+
+const (
+	infoURL  = "https://tapas.io/series/lets-play/info"
+	episodes = "https://tapas.io/series/54321/episodes?page=1&sort=NEWEST"
+)
+
+func TestSeries(t *testing.T) {
+	h := dctest.New(t, Plugin, "testdata/tapas.json")
+	defer h.Close()
+
+	full := &dc.Config{Type: dc.FullScrape}
+	list := h.Run(full, infoURL).ExpectNoErrors().ExpectTasks(episodes)
+
+	// locked episodes are skipped
+	eps := h.RunTask(full, list.Tasks[0]).
+		ExpectNoErrors().
+		ExpectTasks("https://tapas.io/episode/902", "https://tapas.io/episode/901", "https://tapas.io/series/54321/episodes?page=2&sort=NEWEST")
+
+	h.RunTask(&dc.Config{Type: dc.DeltaScrape, Since: time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)}, list.Tasks[0]).
+		ExpectNoErrors().
+		ExpectTasks("https://tapas.io/episode/902")
+
+	// episodes are only dated by the day, those of the day of the newest
+	// stored post may be newer than it
+	h.RunTask(&dc.Config{Type: dc.DeltaScrape, Since: time.Date(2020, 3, 3, 18, 0, 0, 0, time.UTC)}, list.Tasks[0]).
+		ExpectNoErrors().
+		ExpectTasks("https://tapas.io/episode/902")
+
+	h.RunTask(full, eps.Tasks[0]).
+		ExpectNoErrors().
+		ExpectFacts(&hydrocarbon.Post{
+			PostedAt:    time.Date(2020, 3, 3, 0, 0, 0, 0, time.UTC),
+			OriginalURL: "https://tapas.io/episode/902",
+			ExternalID:  "902",
+			Title:       "Episode 2",
+			Author:      "Mongie",
+			Body:        `<img src="https://stubfotos.com/https://us-a.tapas.io/pc/aa/902-1.png"/><img src="https://stubfotos.com/https://us-a.tapas.io/pc/aa/902-2.png"/>`,
+		})
+}
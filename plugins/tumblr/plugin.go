@@ -0,0 +1,450 @@
+package tumblr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+	"github.com/fortytw2/hydrocarbon/httpx"
+	"github.com/mmcdole/gofeed"
+)
+
+// APIKey is the OAuth consumer key of a registered tumblr application, blogs
+// are read through the API with it and from their RSS feed without, which
+// only has the latest posts and is hidden for blogs marked sensitive
+var APIKey string
+
+const (
+	// blogs are followed by their url, #reblogs=skip leaves out every post
+	// the blog reblogged
+	subdomainPattern = `^https?:\/\/([\w-]+)\.tumblr\.com\/?(?:#(.*))?$`
+	dashboardPattern = `^https?:\/\/(?:www\.)?tumblr\.com\/(?:blog\/(?:view\/)?)?([\w-]+)\/?(?:#(.*))?$`
+
+	// the most posts the API returns a page
+	pageSize = 20
+
+	// titles of posts without one are cut to this many characters of their
+	// summary
+	titleLength = 80
+
+	maxResponseSize = 8 * 1024 * 1024
+)
+
+var (
+	postPath = regexp.MustCompile(`\/post\/(\d+)`)
+
+	errNoAPIKey = errors.New("tumblr: no API key is set to read blogs through the API with")
+)
+
+// Plugin is a plugin that can follow tumblr blogs, each photo of a photoset is
+// kept in its post
+var Plugin = &dc.Plugin{
+	Name:          "tumblr",
+	ConfigCreator: configCreator,
+	ExternalID: func(url string, ho *dc.HandlerOpts) string {
+		return strings.ToLower(ho.RouteParams[1])
+	},
+	// the API allows 1000 requests an hour to every application
+	RateLimit: &dc.RateLimit{
+		PerDomain: 1,
+	},
+	// both the API and the feeds are published for machines
+	IgnoreRobots: true,
+	Entrypoints:  []string{subdomainPattern, dashboardPattern},
+	Scheduler:    &dc.Adaptive{Min: 30 * time.Minute, Max: 12 * time.Hour},
+	Backfill: func(c *dc.Config) (*dc.Config, error) {
+		for _, e := range c.Entrypoints {
+			if !strings.HasPrefix(e, "https://api.tumblr.com/") {
+				return nil, errors.New("tumblr: blogs followed by their RSS feed can not be backfilled")
+			}
+		}
+
+		return &dc.Config{Entrypoints: c.Entrypoints}, nil
+	},
+	Routes: map[string]dc.Handler{
+		`^https:\/\/api\.tumblr\.com\/v2\/blog\/([\w-]+)\.tumblr\.com\/posts\?`: apiPosts,
+		`^https:\/\/([\w-]+)\.tumblr\.com\/rss(?:#.*)?$`:                        rssPosts,
+	},
+}
+
+func configCreator(entrypoint string, ho *dc.HandlerOpts) (string, *dc.Config, error) {
+	blog := strings.ToLower(ho.RouteParams[1])
+	// www.tumblr.com/ is followed by pages of the dashboard as well as blogs
+	switch blog {
+	case "dashboard", "explore", "tagged", "search", "settings", "login", "register":
+		return "", nil, fmt.Errorf("tumblr: %s is not a blog", entrypoint)
+	}
+
+	var fragment string
+	if ho.RouteParams[2] != "" {
+		fragment = "#" + ho.RouteParams[2]
+	}
+
+	if APIKey == "" {
+		feedURL := "https://" + blog + ".tumblr.com/rss"
+
+		f, err := getFeed(context.TODO(), ho.Client, feedURL)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return or(f.Title, blog), &dc.Config{
+			Type:        dc.FullScrape,
+			Entrypoints: []string{feedURL + fragment},
+		}, nil
+	}
+
+	var info apiResponse
+	err := getJSON(context.TODO(), ho.Client, "https://api.tumblr.com/v2/blog/"+blog+".tumblr.com/info", &info)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return or(info.Response.Blog.Title, blog), &dc.Config{
+		Type:        dc.FullScrape,
+		Entrypoints: []string{fmt.Sprintf("https://api.tumblr.com/v2/blog/%s.tumblr.com/posts?limit=%d&reblog_info=true%s", blog, pageSize, fragment)},
+	}, nil
+}
+
+// or returns s, or fallback if s is blank
+func or(s, fallback string) string {
+	if s = strings.TrimSpace(s); s != "" {
+		return s
+	}
+
+	return fallback
+}
+
+// skipReblogs reads the options in the fragment of the url of a blog
+func skipReblogs(u string) bool {
+	i := strings.Index(u, "#")
+	if i < 0 {
+		return false
+	}
+
+	opts, err := url.ParseQuery(u[i+1:])
+	if err != nil {
+		return false
+	}
+
+	return opts.Get("reblogs") == "skip"
+}
+
+// get requests u without its fragment, which only carries options of the feed
+func get(ctx context.Context, c *http.Client, u string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.SplitN(u, "#", 2)[0], nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		httpx.DrainAndClose(resp.Body)
+		// the query is left out, it holds the API key
+		return nil, fmt.Errorf("tumblr: %s returned %d", req.URL.Host+req.URL.Path, resp.StatusCode)
+	}
+
+	return resp, nil
+}
+
+func getJSON(ctx context.Context, c *http.Client, u string, x interface{}) error {
+	if APIKey == "" {
+		return errNoAPIKey
+	}
+
+	// the key is only added here, so it is never stored in a config
+	pu, err := url.Parse(u)
+	if err != nil {
+		return err
+	}
+	q := pu.Query()
+	q.Set("api_key", APIKey)
+	pu.RawQuery = q.Encode()
+	pu.Fragment = ""
+
+	resp, err := get(ctx, c, pu.String())
+	if err != nil {
+		return err
+	}
+	defer httpx.DrainAndClose(resp.Body)
+
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(x)
+}
+
+func getFeed(ctx context.Context, c *http.Client, u string) (*gofeed.Feed, error) {
+	resp, err := get(ctx, c, u)
+	if err != nil {
+		return nil, err
+	}
+	defer httpx.DrainAndClose(resp.Body)
+
+	// feeds of blogs marked sensitive redirect to an interstitial asking
+	// readers to log in
+	if !strings.HasSuffix(resp.Request.URL.Path, "/rss") {
+		return nil, fmt.Errorf("tumblr: %s is marked sensitive and is only shown through the API", strings.SplitN(u, "#", 2)[0])
+	}
+
+	return gofeed.NewParser().Parse(io.LimitReader(resp.Body, maxResponseSize))
+}
+
+// apiResponse is the response to every API request, posts are only set for
+// the posts of a blog
+type apiResponse struct {
+	Response struct {
+		Blog struct {
+			Name  string `json:"name"`
+			Title string `json:"title"`
+		} `json:"blog"`
+		Posts      []*post `json:"posts"`
+		TotalPosts int     `json:"total_posts"`
+	} `json:"response"`
+}
+
+type photo struct {
+	Caption      string `json:"caption"`
+	OriginalSize struct {
+		URL string `json:"url"`
+	} `json:"original_size"`
+}
+
+// post is a post in the legacy format of the API, which fields are set depends
+// on its type
+type post struct {
+	ID                string `json:"id_string"`
+	Type              string `json:"type"`
+	BlogName          string `json:"blog_name"`
+	PostURL           string `json:"post_url"`
+	Timestamp         int64  `json:"timestamp"`
+	Summary           string `json:"summary"`
+	RebloggedFromName string `json:"reblogged_from_name"`
+	RebloggedFromURL  string `json:"reblogged_from_url"`
+
+	// text and link posts
+	Title string `json:"title"`
+	Body  string `json:"body"`
+
+	// photo, video and audio posts
+	Caption string   `json:"caption"`
+	Photos  []*photo `json:"photos"`
+
+	// quote posts
+	Text   string `json:"text"`
+	Source string `json:"source"`
+
+	// link posts
+	URL         string `json:"url"`
+	Description string `json:"description"`
+
+	// chat posts
+	Dialogue []struct {
+		Label  string `json:"label"`
+		Phrase string `json:"phrase"`
+	} `json:"dialogue"`
+
+	// answer posts
+	AskingName string `json:"asking_name"`
+	Question   string `json:"question"`
+	Answer     string `json:"answer"`
+
+	// video and audio posts
+	VideoURL     string `json:"video_url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	AudioURL     string `json:"audio_url"`
+}
+
+// apiPosts reads a page of the posts of a blog, newest first, following the
+// next page until posts already stored are reached
+func apiPosts(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+	var pr apiResponse
+	err := getJSON(ctx, ho.Client, t.URL, &pr)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	skip := skipReblogs(t.URL)
+
+	var (
+		facts []interface{}
+		done  bool
+	)
+	for _, p := range pr.Response.Posts {
+		postedAt := time.Unix(p.Timestamp, 0).UTC()
+		if !ho.Config.Newer(postedAt) {
+			done = true
+			break
+		}
+
+		if skip && p.RebloggedFromName != "" {
+			continue
+		}
+
+		facts = append(facts, p.post(postedAt))
+	}
+
+	if done {
+		return dc.Response(facts)
+	}
+
+	maxPages := 0
+	if ho.Config == nil || ho.Config.Type == dc.FullScrape {
+		maxPages = dc.FullScrapePages
+	}
+
+	limit := pageSize
+	if u, err := url.Parse(t.URL); err == nil {
+		if l, err := strconv.Atoi(u.Query().Get("limit")); err == nil {
+			limit = l
+		}
+	}
+
+	next := dc.NextOffset(t, "offset", len(pr.Response.Posts), limit, maxPages)
+	if next == nil {
+		return dc.Response(facts)
+	}
+
+	// pagination drops the fragment, the options of the blog are carried on
+	if i := strings.Index(t.URL, "#"); i >= 0 {
+		next.URL += t.URL[i:]
+	}
+
+	return dc.Response(facts, next)
+}
+
+func (p *post) post(postedAt time.Time) *hydrocarbon.Post {
+	var b strings.Builder
+
+	if p.RebloggedFromName != "" {
+		fmt.Fprintf(&b, `<p>reblogged from <a href="%s">%s</a></p>`, html.EscapeString(p.RebloggedFromURL), html.EscapeString(p.RebloggedFromName))
+	}
+
+	switch p.Type {
+	case "photo":
+		// every photo of a photoset, in the order it was posted
+		for _, ph := range p.Photos {
+			b.WriteString(`<figure><img src="` + html.EscapeString(ph.OriginalSize.URL) + `"/>`)
+			if ph.Caption != "" {
+				b.WriteString(`<figcaption>` + html.EscapeString(ph.Caption) + `</figcaption>`)
+			}
+			b.WriteString(`</figure>`)
+		}
+		b.WriteString(p.Caption)
+	case "quote":
+		b.WriteString(`<blockquote>` + p.Text + `</blockquote>`)
+		if p.Source != "" {
+			b.WriteString(`<p>— ` + p.Source + `</p>`)
+		}
+	case "link":
+		fmt.Fprintf(&b, `<p><a href="%s">%s</a></p>`, html.EscapeString(p.URL), html.EscapeString(or(p.Title, p.URL)))
+		b.WriteString(p.Description)
+	case "chat":
+		for _, d := range p.Dialogue {
+			fmt.Fprintf(&b, `<p><strong>%s</strong> %s</p>`, html.EscapeString(d.Label), html.EscapeString(d.Phrase))
+		}
+	case "answer":
+		fmt.Fprintf(&b, `<blockquote><p><strong>%s asked:</strong></p>%s</blockquote>`, html.EscapeString(or(p.AskingName, "Anonymous")), p.Question)
+		b.WriteString(p.Answer)
+	case "video":
+		// embeds are stripped by the sanitizer, so videos link to where
+		// they are played
+		fmt.Fprintf(&b, `<figure><a href="%s"><img src="%s"/></a></figure>`, html.EscapeString(or(p.VideoURL, p.PostURL)), html.EscapeString(p.ThumbnailURL))
+		b.WriteString(p.Caption)
+	case "audio":
+		fmt.Fprintf(&b, `<p><a href="%s">Listen</a></p>`, html.EscapeString(or(p.AudioURL, p.PostURL)))
+		b.WriteString(p.Caption)
+	default:
+		b.WriteString(p.Body)
+	}
+
+	t := strings.TrimSpace(p.Title)
+	if t == "" {
+		t = excerpt(p.Summary)
+	}
+	if t == "" {
+		t = p.BlogName
+	}
+
+	return &hydrocarbon.Post{
+		PostedAt:    postedAt,
+		OriginalURL: p.PostURL,
+		ExternalID:  p.ID,
+		Title:       t,
+		Author:      p.BlogName,
+		Body:        b.String(),
+	}
+}
+
+// rssPosts reads the feed of a blog, which only has its latest posts
+func rssPosts(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+	f, err := getFeed(ctx, ho.Client, t.URL)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	blog := ho.RouteParams[1]
+	skip := skipReblogs(t.URL)
+
+	var facts []interface{}
+	for _, i := range f.Items {
+		postedAt := time.Now()
+		if i.PublishedParsed != nil {
+			postedAt = i.PublishedParsed.UTC()
+		}
+
+		if !ho.Config.Newer(postedAt) {
+			continue
+		}
+
+		// reblogs credit the blog they were reblogged from before quoting it
+		if skip && strings.Contains(i.Description, `class="tumblr_blog"`) {
+			continue
+		}
+
+		var id string
+		if m := postPath.FindStringSubmatch(i.Link); m != nil {
+			id = m[1]
+		}
+
+		facts = append(facts, &hydrocarbon.Post{
+			PostedAt:    postedAt,
+			OriginalURL: i.Link,
+			ExternalID:  id,
+			Title:       or(excerpt(i.Title), blog),
+			Author:      blog,
+			Body:        i.Description,
+		})
+	}
+
+	return dc.Response(facts)
+}
+
+// excerpt returns the start of the text of s, for a title
+func excerpt(s string) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(s))
+	if err != nil {
+		return ""
+	}
+
+	text := strings.Join(strings.Fields(doc.Text()), " ")
+	if utf8.RuneCountInString(text) <= titleLength {
+		return text
+	}
+
+	return string([]rune(text)[:titleLength-1]) + "…"
+}
@@ -0,0 +1,92 @@
+package tumblr
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+	"github.com/fortytw2/hydrocarbon/discollect/dctest"
+)
+
+func TestAPIPosts(t *testing.T) {
+	APIKey = "test"
+	defer func() { APIKey = "" }()
+
+	h := dctest.New(t, Plugin, "testdata/tumblr.json")
+	defer h.Close()
+
+	title, cfg, err := Plugin.ConfigCreator("https://staff.tumblr.com/#reblogs=skip", &dc.HandlerOpts{
+		Client:      h.Client,
+		RouteParams: regexp.MustCompile(subdomainPattern).FindStringSubmatch("https://staff.tumblr.com/#reblogs=skip"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title != "Tumblr Staff" || cfg.Entrypoints[0] != "https://api.tumblr.com/v2/blog/staff.tumblr.com/posts?limit=20&reblog_info=true#reblogs=skip" {
+		t.Fatalf("unexpected config %q for %s", cfg.Entrypoints, title)
+	}
+
+	photoset := &hydrocarbon.Post{
+		PostedAt:    time.Date(2020, 3, 2, 10, 0, 0, 0, time.UTC),
+		OriginalURL: "https://staff.tumblr.com/post/1002/photoset",
+		ExternalID:  "1002",
+		Title:       "Our new office",
+		Author:      "staff",
+		Body: `<figure><img src="https://64.media.tumblr.com/a/s2048x3072/1.jpg"/></figure>` +
+			`<figure><img src="https://64.media.tumblr.com/b/s2048x3072/2.jpg"/><figcaption>the kitchen</figcaption></figure>` +
+			`<p>Our new office</p>`,
+	}
+
+	h.Run(&dc.Config{Type: dc.FullScrape}, "https://api.tumblr.com/v2/blog/staff.tumblr.com/posts?limit=2&reblog_info=true").
+		ExpectNoErrors().
+		ExpectTasks("https://api.tumblr.com/v2/blog/staff.tumblr.com/posts?limit=2&offset=2&reblog_info=true").
+		ExpectFacts(photoset, &hydrocarbon.Post{
+			PostedAt:    time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC),
+			OriginalURL: "https://staff.tumblr.com/post/1001/reblogged",
+			ExternalID:  "1001",
+			Title:       "A post from another blog",
+			Author:      "staff",
+			Body: `<p>reblogged from <a href="https://other.tumblr.com/post/900">other</a></p>` +
+				`<p><a class="tumblr_blog" href="https://other.tumblr.com/post/900">other</a>:</p><blockquote><p>A post from another blog</p></blockquote>`,
+		})
+
+	h.Run(&dc.Config{Type: dc.FullScrape}, "https://api.tumblr.com/v2/blog/staff.tumblr.com/posts?limit=2&reblog_info=true#reblogs=skip").
+		ExpectNoErrors().
+		ExpectTasks("https://api.tumblr.com/v2/blog/staff.tumblr.com/posts?limit=2&offset=2&reblog_info=true#reblogs=skip").
+		ExpectFacts(photoset)
+
+	// the delta scrape stops at the first post already stored
+	h.Run(&dc.Config{Type: dc.DeltaScrape, Since: time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)}, "https://api.tumblr.com/v2/blog/staff.tumblr.com/posts?limit=2&reblog_info=true").
+		ExpectNoErrors().
+		ExpectTasks().
+		ExpectFacts(photoset)
+}
+
+func TestRSSPosts(t *testing.T) {
+	h := dctest.New(t, Plugin, "testdata/tumblr.json")
+	defer h.Close()
+
+	h.Run(&dc.Config{Type: dc.FullScrape}, "https://photos.tumblr.com/rss#reblogs=skip").
+		ExpectNoErrors().
+		ExpectTasks().
+		ExpectFacts(&hydrocarbon.Post{
+			PostedAt:    time.Date(2020, 3, 2, 10, 0, 0, 0, time.UTC),
+			OriginalURL: "https://photos.tumblr.com/post/2002/sunset",
+			ExternalID:  "2002",
+			Title:       "Sunset",
+			Author:      "photos",
+			Body:        `<img src="https://64.media.tumblr.com/c/s500x750/3.jpg"/><p>Sunset</p>`,
+		})
+
+	// without an API key, blogs marked sensitive can not be followed
+	_, _, err := Plugin.ConfigCreator("https://nsfw.tumblr.com", &dc.HandlerOpts{
+		Client:      h.Client,
+		RouteParams: regexp.MustCompile(subdomainPattern).FindStringSubmatch("https://nsfw.tumblr.com"),
+	})
+	if err == nil || !strings.Contains(err.Error(), "sensitive") {
+		t.Fatalf("expected the interstitial to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+// Package wasm runs plugins compiled to WebAssembly, loaded at startup from a
+// directory without recompiling hydrocarbon.
+//
+// A plugin is an ordinary *discollect.Plugin whose main calls Serve, built
+// with GOOS=wasip1 GOARCH=wasm. Every call into it, to describe it, create a
+// config or handle a task, runs a fresh instance of the module with the
+// request as JSON on stdin and the response as JSON on stdout. A module has no
+// filesystem, environment or network of its own, it can only fetch pages
+// through hydrocarbon from the hosts it was built to ask for.
+package wasm
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+)
+
+// ABIVersion is bumped with every incompatible change to the messages and
+// functions shared with modules, both sides must agree on it
+const ABIVersion = 1
+
+const (
+	// the module the functions modules import are provided by
+	hostModule = "hydrocarbon"
+
+	maxFetchSize = 8 * 1024 * 1024
+	// the stdout of a module, pages fetched are base64 encoded within it
+	maxOutputSize = 4 * maxFetchSize
+)
+
+// the calls a module answers, as given in a request
+const (
+	callDescribe   = "describe"
+	callConfig     = "config"
+	callExternalID = "external_id"
+	callBackfill   = "backfill"
+	callHandle     = "handle"
+)
+
+type request struct {
+	Call        string     `json:"call"`
+	ABIVersion  int        `json:"abi_version"`
+	URL         string     `json:"url,omitempty"`
+	Route       string     `json:"route,omitempty"`
+	RouteParams []string   `json:"route_params,omitempty"`
+	Config      *dc.Config `json:"config,omitempty"`
+	Task        *dc.Task   `json:"task,omitempty"`
+}
+
+type describeResponse struct {
+	ABIVersion int `json:"abi_version"`
+
+	Name          string           `json:"name"`
+	Entrypoints   []string         `json:"entrypoints"`
+	Routes        []string         `json:"routes"`
+	RateLimit     *dc.RateLimit    `json:"rate_limit,omitempty"`
+	Timeout       time.Duration    `json:"timeout,omitempty"`
+	Headers       http.Header      `json:"headers,omitempty"`
+	Referer       dc.RefererPolicy `json:"referer,omitempty"`
+	IgnoreRobots  bool             `json:"ignore_robots,omitempty"`
+	ContentTypes  []string         `json:"content_types,omitempty"`
+	ConfigSchema  string           `json:"config_schema,omitempty"`
+	ConfigVersion int              `json:"config_version,omitempty"`
+
+	// Hosts are the only hosts the module may fetch from, with their
+	// subdomains, or "*" for any
+	Hosts []string `json:"hosts"`
+
+	HasExternalID bool `json:"has_external_id,omitempty"`
+	HasBackfill   bool `json:"has_backfill,omitempty"`
+}
+
+// callResponse answers every call but describe, posts are the only facts
+// modules can return
+type callResponse struct {
+	Error string `json:"error,omitempty"`
+
+	Title      string     `json:"title,omitempty"`
+	Config     *dc.Config `json:"config,omitempty"`
+	ExternalID string     `json:"external_id,omitempty"`
+
+	Tasks  []*dc.Task          `json:"tasks,omitempty"`
+	Posts  []*hydrocarbon.Post `json:"posts,omitempty"`
+	Errors []string            `json:"errors,omitempty"`
+}
+
+// a fetchRequest is passed to the fetch function, which returns the length of
+// the fetchResponse that fetch_result then copies into the module
+type fetchRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+// URL is the url the response came from, after any redirects
+type fetchResponse struct {
+	Error      string      `json:"error,omitempty"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       []byte      `json:"body,omitempty"`
+	URL        string      `json:"url"`
+}
@@ -0,0 +1,465 @@
+//go:build !wasip1
+// +build !wasip1
+
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+)
+
+const (
+	// how long ConfigCreator, ExternalID and Backfill calls may take, handlers
+	// run for the timeout of their task
+	callTimeout = 2 * time.Minute
+	// 256MB of linear memory per instance
+	memoryLimitPages = 4096
+)
+
+// A Runtime compiles and runs the modules of WASM plugins
+type Runtime struct {
+	r wazero.Runtime
+}
+
+// NewRuntime returns a Runtime to load plugins into. Calls that run past
+// their context are stopped, as are modules growing past 256MB of memory
+func NewRuntime(ctx context.Context) (*Runtime, error) {
+	r := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(memoryLimitPages).
+		WithCloseOnContextDone(true))
+
+	_, err := wasi_snapshot_preview1.Instantiate(ctx, r)
+	if err != nil {
+		r.Close(ctx)
+		return nil, err
+	}
+
+	_, err = r.NewHostModuleBuilder(hostModule).
+		NewFunctionBuilder().WithFunc(fetch).Export("fetch").
+		NewFunctionBuilder().WithFunc(fetchResult).Export("fetch_result").
+		Instantiate(ctx)
+	if err != nil {
+		r.Close(ctx)
+		return nil, err
+	}
+
+	return &Runtime{r: r}, nil
+}
+
+// Close frees every module loaded, their plugins can not be used after
+func (rt *Runtime) Close(ctx context.Context) error {
+	return rt.r.Close(ctx)
+}
+
+// LoadDir loads every .wasm module in dir, in the order of their names
+func (rt *Runtime) LoadDir(ctx context.Context, dir string) ([]*dc.Plugin, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.wasm"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	plugins := make([]*dc.Plugin, 0, len(paths))
+	for _, path := range paths {
+		p, err := rt.Load(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		plugins = append(plugins, p)
+	}
+
+	return plugins, nil
+}
+
+// Load compiles the module at path and describes the plugin it serves
+func (rt *Runtime) Load(ctx context.Context, path string) (*dc.Plugin, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	compiled, err := rt.r.CompileModule(ctx, buf)
+	if err != nil {
+		return nil, fmt.Errorf("wasm: could not compile %s: %s", path, err)
+	}
+
+	m := &module{
+		r:        rt.r,
+		compiled: compiled,
+		name:     strings.TrimSuffix(filepath.Base(path), ".wasm"),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+
+	var info describeResponse
+	err = m.call(ctx, nil, &request{Call: callDescribe}, &info)
+	if err != nil {
+		compiled.Close(ctx)
+		return nil, fmt.Errorf("wasm: could not describe %s: %s", path, err)
+	}
+
+	if info.ABIVersion != ABIVersion {
+		compiled.Close(ctx)
+		return nil, fmt.Errorf("wasm: %s speaks ABI %d, not %d", path, info.ABIVersion, ABIVersion)
+	}
+
+	m.name = info.Name
+	m.hosts = info.Hosts
+	log.Printf("wasm: loaded %s from %s, it may fetch from %s", info.Name, path, strings.Join(info.Hosts, ", "))
+
+	return m.plugin(&info), nil
+}
+
+// a module is the compiled code of a plugin, instantiated anew for every call
+type module struct {
+	r        wazero.Runtime
+	compiled wazero.CompiledModule
+	name     string
+	hosts    []string
+}
+
+// plugin builds the plugin registered for the module from its description
+func (m *module) plugin(info *describeResponse) *dc.Plugin {
+	plugin := &dc.Plugin{
+		Name:          info.Name,
+		RateLimit:     info.RateLimit,
+		Timeout:       info.Timeout,
+		Headers:       info.Headers,
+		Referer:       info.Referer,
+		IgnoreRobots:  info.IgnoreRobots,
+		Entrypoints:   info.Entrypoints,
+		ContentTypes:  info.ContentTypes,
+		ConfigSchema:  info.ConfigSchema,
+		ConfigVersion: info.ConfigVersion,
+		Scheduler:     dc.DefaultScheduler,
+		ConfigCreator: m.createConfig,
+		Routes:        make(map[string]dc.Handler, len(info.Routes)),
+	}
+
+	for _, route := range info.Routes {
+		plugin.Routes[route] = m.handler(route)
+	}
+
+	if info.HasExternalID {
+		plugin.ExternalID = m.externalID
+	}
+	if info.HasBackfill {
+		plugin.Backfill = m.backfill
+	}
+
+	return plugin
+}
+
+func (m *module) createConfig(url string, ho *dc.HandlerOpts) (string, *dc.Config, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+
+	var resp callResponse
+	err := m.call(ctx, ho.Client, &request{
+		Call:        callConfig,
+		URL:         url,
+		RouteParams: ho.RouteParams,
+	}, &resp)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if resp.Config == nil {
+		return "", nil, fmt.Errorf("wasm: %s returned no config for %s", m.name, url)
+	}
+
+	return resp.Title, resp.Config, nil
+}
+
+func (m *module) externalID(url string, ho *dc.HandlerOpts) string {
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+
+	var resp callResponse
+	err := m.call(ctx, nil, &request{
+		Call:        callExternalID,
+		URL:         url,
+		RouteParams: ho.RouteParams,
+	}, &resp)
+	if err != nil {
+		log.Printf("wasm: %s could not find the external ID of %s: %s", m.name, url, err)
+		return ""
+	}
+
+	return resp.ExternalID
+}
+
+func (m *module) backfill(c *dc.Config) (*dc.Config, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+
+	var resp callResponse
+	err := m.call(ctx, nil, &request{Call: callBackfill, Config: c}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Config == nil {
+		return nil, fmt.Errorf("wasm: %s returned no backfill config", m.name)
+	}
+
+	return resp.Config, nil
+}
+
+// handler returns the Handler of a route of the plugin
+func (m *module) handler(route string) dc.Handler {
+	return func(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+		var resp callResponse
+		err := m.call(ctx, ho.Client, &request{
+			Call:        callHandle,
+			Route:       route,
+			RouteParams: ho.RouteParams,
+			Config:      ho.Config,
+			Task:        t,
+		}, &resp)
+		if err != nil {
+			return dc.ErrorResponse(err)
+		}
+
+		hr := &dc.HandlerResponse{Tasks: resp.Tasks}
+		for _, post := range resp.Posts {
+			hr.Facts = append(hr.Facts, post)
+		}
+		for _, e := range resp.Errors {
+			hr.Errors = append(hr.Errors, errors.New(e))
+		}
+
+		return hr
+	}
+}
+
+// call runs an instance of the module with req on stdin, and decodes what it
+// writes to stdout into resp. The module fetches with c, or not at all if it
+// is nil
+func (m *module) call(ctx context.Context, c *http.Client, req *request, resp interface{}) error {
+	req.ABIVersion = ABIVersion
+	in, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	out := &limitedBuffer{limit: maxOutputSize}
+	stderr := &limitedBuffer{limit: 64 * 1024}
+
+	ctx = context.WithValue(ctx, callKey{}, &callState{m: m, client: c})
+	mod, err := m.r.InstantiateModule(ctx, m.compiled, wazero.NewModuleConfig().
+		WithName("").
+		WithArgs(m.name).
+		WithStdin(bytes.NewReader(in)).
+		WithStdout(out).
+		WithStderr(stderr).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithSysNanosleep().
+		WithRandSource(rand.Reader))
+	if mod != nil {
+		mod.Close(ctx)
+	}
+	if stderr.Len() > 0 {
+		log.Printf("wasm: %s: %s", m.name, strings.TrimSpace(stderr.String()))
+	}
+	if err != nil {
+		return fmt.Errorf("wasm: %s failed: %s", m.name, err)
+	}
+	if out.overflow {
+		return fmt.Errorf("wasm: %s wrote more than %d bytes", m.name, maxOutputSize)
+	}
+
+	err = json.Unmarshal(out.Bytes(), resp)
+	if err != nil {
+		return fmt.Errorf("wasm: %s returned an invalid response: %s", m.name, err)
+	}
+
+	if cr, ok := resp.(*callResponse); ok && cr.Error != "" {
+		return errors.New(cr.Error)
+	}
+
+	return nil
+}
+
+// allowed returns whether the module may fetch from host
+func (m *module) allowed(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, h := range m.hosts {
+		h = strings.ToLower(h)
+		if h == "*" || host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type callKey struct{}
+
+// callState is what the functions imported by a module know of the call it is
+// running for
+type callState struct {
+	m      *module
+	client *http.Client
+	// the response of the last fetch, until copied by fetch_result
+	result []byte
+}
+
+// fetch is imported by modules as hydrocarbon.fetch, it makes the request
+// encoded at ptr and returns the length of the response to copy with
+// fetch_result
+func fetch(ctx context.Context, mod api.Module, ptr, size uint32) uint32 {
+	cs, ok := ctx.Value(callKey{}).(*callState)
+	if !ok {
+		panic("wasm: fetch called outside of a call")
+	}
+
+	var resp *fetchResponse
+	buf, ok := mod.Memory().Read(ptr, size)
+	if !ok {
+		resp = &fetchResponse{Error: "wasm: fetch request out of bounds"}
+	} else {
+		var req fetchRequest
+		err := json.Unmarshal(buf, &req)
+		if err == nil {
+			resp, err = cs.fetch(ctx, &req)
+		}
+		if err != nil {
+			resp = &fetchResponse{Error: err.Error()}
+		}
+	}
+
+	out, err := json.Marshal(resp)
+	if err != nil {
+		out, _ = json.Marshal(&fetchResponse{Error: err.Error()})
+	}
+
+	cs.result = out
+	return uint32(len(out))
+}
+
+// fetchResult is imported by modules as hydrocarbon.fetch_result, it copies
+// the response of the last fetch to ptr
+func fetchResult(ctx context.Context, mod api.Module, ptr uint32) {
+	cs, ok := ctx.Value(callKey{}).(*callState)
+	if !ok {
+		panic("wasm: fetch_result called outside of a call")
+	}
+
+	if !mod.Memory().Write(ptr, cs.result) {
+		panic("wasm: fetch_result out of bounds")
+	}
+	cs.result = nil
+}
+
+func (cs *callState) fetch(ctx context.Context, req *fetchRequest) (*fetchResponse, error) {
+	if cs.client == nil {
+		return nil, fmt.Errorf("wasm: %s can not fetch %s here", cs.m.name, req.URL)
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	err = cs.check(u)
+	if err != nil {
+		return nil, err
+	}
+
+	hreq, err := http.NewRequest(req.Method, req.URL, bytes.NewReader(req.Body))
+	if err != nil {
+		return nil, err
+	}
+	hreq.Header = req.Header
+	if hreq.Header == nil {
+		hreq.Header = make(http.Header)
+	}
+
+	// redirects are followed only to hosts the module may fetch from
+	c := *cs.client
+	c.CheckRedirect = func(r *http.Request, via []*http.Request) error {
+		err := cs.check(r.URL)
+		if err != nil {
+			return err
+		}
+		if cs.client.CheckRedirect != nil {
+			return cs.client.CheckRedirect(r, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+
+	resp, err := c.Do(hreq.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxFetchSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxFetchSize {
+		return nil, fmt.Errorf("wasm: %s is larger than %d bytes", req.URL, maxFetchSize)
+	}
+
+	return &fetchResponse{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       body,
+		URL:        resp.Request.URL.String(),
+	}, nil
+}
+
+// check returns an error unless the module may fetch u
+func (cs *callState) check(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("wasm: %s can not fetch %s urls", cs.m.name, u.Scheme)
+	}
+
+	if !cs.m.allowed(u.Hostname()) {
+		return fmt.Errorf("wasm: %s can not fetch from %s, it may only fetch from %s", cs.m.name, u.Hostname(), strings.Join(cs.m.hosts, ", "))
+	}
+
+	return nil
+}
+
+// limitedBuffer holds at most limit bytes, and remembers whether more were
+// written
+type limitedBuffer struct {
+	bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (lb *limitedBuffer) Write(p []byte) (int, error) {
+	if lb.Len()+len(p) > lb.limit {
+		lb.overflow = true
+		return 0, errors.New("wasm: output too large")
+	}
+
+	return lb.Buffer.Write(p)
+}
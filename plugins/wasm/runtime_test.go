@@ -0,0 +1,151 @@
+package wasm
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+)
+
+// buildEcho compiles the plugin in testdata/echo into dir
+func buildEcho(t *testing.T, dir string) {
+	if testing.Short() {
+		t.Skip("skipping compiling a plugin in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is needed to compile a plugin")
+	}
+
+	cmd := exec.Command("go", "build", "-tags", "noassets", "-o", filepath.Join(dir, "echo.wasm"), "./testdata/echo")
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("could not compile the plugin: %s\n%s", err, out)
+	}
+}
+
+func TestRuntime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hydrocarbon-wasm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	buildEcho(t, dir)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/page", http.StatusMovedPermanently)
+		case "/away":
+			// only 127.0.0.1 may be fetched from
+			http.Redirect(w, r, strings.Replace(r.Host, "127.0.0.1", "http://localhost", 1)+"/page", http.StatusFound)
+		default:
+			fmt.Fprintf(w, "hello from %s", r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	rt, err := NewRuntime(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close(ctx)
+
+	plugins, err := rt.LoadDir(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plugins) != 1 {
+		t.Fatalf("expected a plugin to be loaded, got %d", len(plugins))
+	}
+
+	p := plugins[0]
+	if p.Name != "echo" || p.ConfigVersion != 2 || len(p.Routes) != 3 {
+		t.Fatalf("plugin was not described, got %+v", p)
+	}
+	if p.ExternalID != nil || p.Backfill != nil {
+		t.Error("expected no ExternalID or Backfill for a plugin without them")
+	}
+
+	ho := &dc.HandlerOpts{Client: ts.Client()}
+
+	title, cfg, err := p.ConfigCreator(ts.URL+"/feed", ho)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title != "hello from /feed" || cfg.Version != 2 || cfg.Entrypoints[0] != ts.URL+"/feed" {
+		t.Errorf("unexpected config, got %q %+v", title, cfg)
+	}
+
+	handle := p.Routes[`^https?:\/\/[^/]+\/page$`]
+	resp := handle(ctx, ho, &dc.Task{URL: ts.URL + "/old"})
+	if len(resp.Errors) != 0 {
+		t.Fatal(resp.Errors)
+	}
+	if len(resp.Facts) != 1 || len(resp.Tasks) != 1 {
+		t.Fatalf("expected a post and a task, got %+v", resp)
+	}
+
+	post := resp.Facts[0].(*hydrocarbon.Post)
+	if post.URL != ts.URL+"/page" || post.Title != "hello from /page" {
+		t.Errorf("expected the page redirected to, got %+v", post)
+	}
+	if post.Body == "" {
+		t.Error("expected the filesystem to be hidden from the plugin")
+	}
+	if resp.Tasks[0].URL != ts.URL+"/page/next" {
+		t.Errorf("unexpected task %+v", resp.Tasks[0])
+	}
+
+	resp = handle(ctx, ho, &dc.Task{URL: ts.URL + "/away"})
+	if len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0].Error(), "can not fetch from localhost") {
+		t.Errorf("expected a redirect to another host to be refused, got %+v", resp)
+	}
+
+	resp = p.Routes[`^https?:\/\/[^/]+\/panic$`](ctx, ho, &dc.Task{URL: ts.URL + "/panic"})
+	if len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0].Error(), "oh no") {
+		t.Errorf("expected a panic to be returned as an error, got %+v", resp)
+	}
+
+	loopCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+	resp = p.Routes[`^https?:\/\/[^/]+\/loop$`](loopCtx, ho, &dc.Task{URL: ts.URL + "/loop"})
+	if len(resp.Errors) != 1 {
+		t.Errorf("expected a call running past its context to be stopped, got %+v", resp)
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	t.Parallel()
+
+	m := &module{hosts: []string{"example.com", "Cdn.Example.net"}}
+	for host, allowed := range map[string]bool{
+		"example.com":         true,
+		"www.example.com":     true,
+		"EXAMPLE.com.":        true,
+		"badexample.com":      false,
+		"example.com.evil":    false,
+		"img.cdn.example.net": true,
+		"example.net":         false,
+	} {
+		if m.allowed(host) != allowed {
+			t.Errorf("expected %s to be allowed: %t", host, allowed)
+		}
+	}
+
+	if !(&module{hosts: []string{"*"}}).allowed("anywhere.org") {
+		t.Error("expected * to allow any host")
+	}
+}
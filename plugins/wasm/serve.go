@@ -0,0 +1,209 @@
+//go:build wasip1
+// +build wasip1
+
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"unsafe"
+
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+)
+
+//go:wasmimport hydrocarbon fetch
+func hostFetch(ptr unsafe.Pointer, size uint32) uint32
+
+//go:wasmimport hydrocarbon fetch_result
+func hostFetchResult(ptr unsafe.Pointer)
+
+// Serve answers the call hydrocarbon runs the module for with p, it is called
+// by the main of every plugin. p is written as any built in plugin would be,
+// the clients its handlers are given fetch through hydrocarbon from hosts
+// only, which are domains matched with their subdomains, or "*" for any.
+// Login, AllowHTML, MigrateConfig and Scheduler are not supported
+func Serve(p *dc.Plugin, hosts ...string) {
+	var req request
+	err := json.NewDecoder(os.Stdin).Decode(&req)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "wasm: this is a hydrocarbon plugin, it is run by placing it in WASM_PLUGINS_DIR")
+		os.Exit(1)
+	}
+
+	var resp interface{}
+	if req.Call == callDescribe {
+		resp = describe(p, hosts)
+	} else {
+		resp = answer(p, &req)
+	}
+
+	err = json.NewEncoder(os.Stdout).Encode(resp)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func describe(p *dc.Plugin, hosts []string) *describeResponse {
+	routes := make([]string, 0, len(p.Routes))
+	for route := range p.Routes {
+		routes = append(routes, route)
+	}
+
+	return &describeResponse{
+		ABIVersion:    ABIVersion,
+		Name:          p.Name,
+		Entrypoints:   p.Entrypoints,
+		Routes:        routes,
+		RateLimit:     p.RateLimit,
+		Timeout:       p.Timeout,
+		Headers:       p.Headers,
+		Referer:       p.Referer,
+		IgnoreRobots:  p.IgnoreRobots,
+		ContentTypes:  p.ContentTypes,
+		ConfigSchema:  p.ConfigSchema,
+		ConfigVersion: p.ConfigVersion,
+		Hosts:         hosts,
+		HasExternalID: p.ExternalID != nil,
+		HasBackfill:   p.Backfill != nil,
+	}
+}
+
+// answer makes the call, a panic of the plugin is returned as its error
+func answer(p *dc.Plugin, req *request) (resp *callResponse) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp = &callResponse{Error: fmt.Sprintf("wasm: panic: %v\n%s", r, debug.Stack())}
+		}
+	}()
+
+	ho := &dc.HandlerOpts{
+		Config:      req.Config,
+		RouteParams: req.RouteParams,
+		Client: &http.Client{
+			Transport: hostTransport{},
+			// redirects are followed by hydrocarbon
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+
+	switch req.Call {
+	case callConfig:
+		title, cfg, err := p.ConfigCreator(req.URL, ho)
+		if err != nil {
+			return &callResponse{Error: err.Error()}
+		}
+		return &callResponse{Title: title, Config: cfg}
+	case callExternalID:
+		if p.ExternalID == nil {
+			return &callResponse{}
+		}
+		return &callResponse{ExternalID: p.ExternalID(req.URL, ho)}
+	case callBackfill:
+		if p.Backfill == nil {
+			return &callResponse{Error: dc.ErrNoBackfill.Error()}
+		}
+		cfg, err := p.Backfill(req.Config)
+		if err != nil {
+			return &callResponse{Error: err.Error()}
+		}
+		return &callResponse{Config: cfg}
+	case callHandle:
+		h, ok := p.Routes[req.Route]
+		if !ok {
+			return &callResponse{Error: dc.ErrHandlerNotFound.Error()}
+		}
+
+		hr := h(context.Background(), ho, req.Task)
+		resp = &callResponse{Tasks: hr.Tasks}
+		for _, f := range hr.Facts {
+			post, ok := f.(*hydrocarbon.Post)
+			if !ok {
+				resp.Errors = append(resp.Errors, fmt.Sprintf("wasm: %s returned a %T, only posts are supported", p.Name, f))
+				continue
+			}
+			resp.Posts = append(resp.Posts, post)
+		}
+		for _, e := range hr.Errors {
+			resp.Errors = append(resp.Errors, e.Error())
+		}
+		return resp
+	default:
+		return &callResponse{Error: fmt.Sprintf("wasm: unknown call %q", req.Call)}
+	}
+}
+
+// hostTransport fetches through hydrocarbon
+type hostTransport struct{}
+
+// RoundTrip implements http.RoundTripper
+func (hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	in, err := json.Marshal(&fetchRequest{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: req.Header,
+		Body:   body,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	size := hostFetch(unsafe.Pointer(&in[0]), uint32(len(in)))
+	buf := make([]byte, size)
+	if size > 0 {
+		hostFetchResult(unsafe.Pointer(&buf[0]))
+	}
+
+	var out fetchResponse
+	err = json.Unmarshal(buf, &out)
+	if err != nil {
+		return nil, err
+	}
+	if out.Error != "" {
+		return nil, errors.New(out.Error)
+	}
+
+	// the request is the last of any redirects followed, as it would be
+	final := req
+	if out.URL != "" && out.URL != req.URL.String() {
+		u, err := url.Parse(out.URL)
+		if err != nil {
+			return nil, err
+		}
+		final = req.WithContext(req.Context())
+		final.URL = u
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", out.StatusCode, http.StatusText(out.StatusCode)),
+		StatusCode:    out.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        out.Header,
+		Body:          ioutil.NopCloser(bytes.NewReader(out.Body)),
+		ContentLength: int64(len(out.Body)),
+		Request:       final,
+	}, nil
+}
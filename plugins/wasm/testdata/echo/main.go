@@ -0,0 +1,69 @@
+// echo is the plugin the tests of package wasm build and load
+package main
+
+import (
+	"context"
+	"io/ioutil"
+
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+	"github.com/fortytw2/hydrocarbon/plugins/wasm"
+)
+
+var plugin = &dc.Plugin{
+	Name:          "echo",
+	Entrypoints:   []string{`^https?:\/\/`},
+	ConfigVersion: 2,
+	ConfigCreator: func(url string, ho *dc.HandlerOpts) (string, *dc.Config, error) {
+		resp, err := ho.Client.Get(url)
+		if err != nil {
+			return "", nil, err
+		}
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return string(body), &dc.Config{
+			Type:        dc.FullScrape,
+			Entrypoints: []string{url},
+			Version:     2,
+		}, nil
+	},
+	Routes: map[string]dc.Handler{
+		`^https?:\/\/[^/]+\/page$`: func(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+			resp, err := ho.Client.Get(t.URL)
+			if err != nil {
+				return dc.ErrorResponse(err)
+			}
+			defer resp.Body.Close()
+
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				return dc.ErrorResponse(err)
+			}
+
+			final := resp.Request.URL.String()
+			_, err = ioutil.ReadFile("/etc/passwd")
+			return dc.Response([]interface{}{&hydrocarbon.Post{
+				URL:   final,
+				Title: string(body),
+				// the module has no filesystem, this should not be empty
+				Body: err.Error(),
+			}}, &dc.Task{URL: final + "/next"})
+		},
+		`^https?:\/\/[^/]+\/loop$`: func(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+			for {
+			}
+		},
+		`^https?:\/\/[^/]+\/panic$`: func(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+			panic("oh no")
+		},
+	},
+}
+
+func main() {
+	wasm.Serve(plugin, "127.0.0.1")
+}
@@ -0,0 +1,150 @@
+package watch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+	"github.com/fortytw2/hydrocarbon/httpx"
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// watched pages are submitted as the page url with the css selector in the
+// fragment, i.e. https://example.com/pricing#watch=.plan > .price
+const watchPattern = `^(https?://[^#]+)#watch=(.+)$`
+
+var watchPolicy = bluemonday.UGCPolicy().AddTargetBlankToFullyQualifiedLinks(true)
+
+// Plugin watches a single element of any page, and emits a post every time
+// the text of that element changes
+var Plugin = &dc.Plugin{
+	Name:        "watch",
+	Entrypoints: []string{watchPattern},
+	ConfigCreator: func(entrypoint string, ho *dc.HandlerOpts) (string, *dc.Config, error) {
+		if len(ho.RouteParams) != 3 {
+			return "", nil, errors.New("watch: expected a url and selector")
+		}
+
+		page, sel, err := parseSelector(ho.RouteParams[1], ho.RouteParams[2])
+		if err != nil {
+			return "", nil, err
+		}
+
+		doc, err := getPage(context.TODO(), ho.Client, page)
+		if err != nil {
+			return "", nil, err
+		}
+
+		if doc.FindMatcher(sel).Length() == 0 {
+			return "", nil, fmt.Errorf("watch: %s does not match anything on %s", ho.RouteParams[2], page)
+		}
+
+		title := strings.TrimSpace(doc.Find("title").First().Text())
+		if title == "" {
+			title = page
+		}
+
+		return fmt.Sprintf("%s (%s)", title, ho.RouteParams[2]), &dc.Config{
+			Type:        dc.FullScrape,
+			Entrypoints: []string{entrypoint},
+		}, nil
+	},
+	Scheduler: dc.DefaultScheduler,
+	Routes: map[string]dc.Handler{
+		watchPattern: watchElement,
+	},
+}
+
+func parseSelector(page, rawSel string) (string, cascadia.Selector, error) {
+	s, err := url.QueryUnescape(rawSel)
+	if err != nil {
+		s = rawSel
+	}
+
+	sel, err := cascadia.Compile(strings.TrimSpace(s))
+	if err != nil {
+		return "", nil, fmt.Errorf("watch: invalid selector: %s", err)
+	}
+
+	return page, sel, nil
+}
+
+func watchElement(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+	page, sel, err := parseSelector(ho.RouteParams[1], ho.RouteParams[2])
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	doc, err := getPage(ctx, ho.Client, page)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	p, err := extract(doc, sel, page, ho.RouteParams[2])
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	return dc.Response([]interface{}{p})
+}
+
+// extract builds a post out of the watched element. Posts are keyed by a hash
+// of the elements text, so unchanged content updates the existing post in
+// place while any change creates a new one
+func extract(doc *goquery.Document, sel cascadia.Selector, page, rawSel string) (*hydrocarbon.Post, error) {
+	s := doc.FindMatcher(sel)
+	if s.Length() == 0 {
+		return nil, fmt.Errorf("watch: %s no longer matches anything on %s", rawSel, page)
+	}
+
+	// compare on whitespace-normalized text, markup often contains per-request
+	// noise like csrf tokens
+	text := strings.Join(strings.Fields(s.Text()), " ")
+	sum := sha256.Sum256([]byte(text))
+
+	var body strings.Builder
+	s.Each(func(_ int, el *goquery.Selection) {
+		h, err := goquery.OuterHtml(el)
+		if err == nil {
+			body.WriteString(h)
+		}
+	})
+
+	return &hydrocarbon.Post{
+		Title:       fmt.Sprintf("%s changed", rawSel),
+		PostedAt:    time.Now(),
+		Body:        strings.TrimSpace(watchPolicy.Sanitize(body.String())),
+		OriginalURL: page + "#hc-" + hex.EncodeToString(sum[:8]),
+	}, nil
+}
+
+func getPage(ctx context.Context, c *http.Client, page string) (*goquery.Document, error) {
+	req, err := http.NewRequest(http.MethodGet, page, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", "hydrocarbon/1.0 (+https://github.com/fortytw2/hydrocarbon)")
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpx.DrainAndClose(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("watch: got %d from %s", resp.StatusCode, page)
+	}
+
+	return goquery.NewDocumentFromReader(resp.Body)
+}
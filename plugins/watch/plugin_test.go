@@ -0,0 +1,62 @@
+package watch
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestExtract(t *testing.T) {
+	var tests = []struct {
+		name     string
+		a, b     string
+		sameLink bool
+	}{
+		{
+			"unchanged",
+			`<div class="price"><span>$10</span></div>`,
+			`<div class="price"><span>$10</span></div>`,
+			true,
+		},
+		{
+			"markup noise",
+			`<div class="price"><span data-csrf="abc">$10</span></div>`,
+			`<div class="price">  <span data-csrf="xyz">$10</span></div>`,
+			true,
+		},
+		{
+			"changed",
+			`<div class="price"><span>$10</span></div>`,
+			`<div class="price"><span>$12</span></div>`,
+			false,
+		},
+	}
+
+	_, sel, err := parseSelector("https://example.com", ".price%20span")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var links []string
+			for _, in := range []string{tt.a, tt.b} {
+				doc, err := goquery.NewDocumentFromReader(strings.NewReader(in))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				p, err := extract(doc, sel, "https://example.com", ".price span")
+				if err != nil {
+					t.Fatal(err)
+				}
+				links = append(links, p.OriginalURL)
+			}
+
+			if (links[0] == links[1]) != tt.sameLink {
+				t.Fatalf("expected same link %t, got %s and %s", tt.sameLink, links[0], links[1])
+			}
+		})
+	}
+}
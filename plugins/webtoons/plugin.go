@@ -0,0 +1,244 @@
+package webtoons
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+	"github.com/fortytw2/hydrocarbon/httpx"
+)
+
+// dates in the episode list
+const dateLayout = "Jan 2, 2006"
+
+// Plugin is a plugin that can scrape series on webtoons, each episode is a
+// post of its panels
+var Plugin = &dc.Plugin{
+	Name:          "webtoons",
+	ConfigCreator: configCreator,
+	// title_no, the path holds the genre and a slug of the title
+	ExternalID: func(url string, ho *dc.HandlerOpts) string {
+		return ho.RouteParams[4]
+	},
+	RateLimit: &dc.RateLimit{
+		PerDomain: 1,
+	},
+	// the image CDN refuses requests that do not come from the site
+	Headers: http.Header{
+		"Referer": []string{"https://www.webtoons.com/"},
+	},
+	Entrypoints: []string{
+		`^https:\/\/(m|www)\.webtoons\.com\/([\w-]+\/[\w-]+)\/([\w-]+)\/list\?title_no=(\d+)`,
+	},
+	// originals update weekly, canvas series whenever their creators post
+	Scheduler: &dc.Adaptive{Min: time.Hour, Max: 24 * time.Hour},
+	// later pages of the list hold the older episodes, down to the first
+	Backfill: func(c *dc.Config) (*dc.Config, error) {
+		return &dc.Config{Entrypoints: c.Entrypoints}, nil
+	},
+	// the page parameter is left off, it is added while paging
+	ConfigSchema: `{
+		"properties": {
+			"Entrypoints": {"items": {"pattern": "^https://www\\.webtoons\\.com/[\\w-]+/[\\w-]+/[\\w-]+/list\\?title_no=\\d+$"}}
+		}
+	}`,
+	Routes: map[string]dc.Handler{
+		`^https:\/\/www\.webtoons\.com\/[\w-]+\/[\w-]+\/[\w-]+\/list\?`:           listPage,
+		`^https:\/\/www\.webtoons\.com\/[\w-]+\/[\w-]+\/[\w-]+\/[\w-]+\/viewer\?`: viewerPage,
+	},
+}
+
+func configCreator(entrypointURL string, ho *dc.HandlerOpts) (string, *dc.Config, error) {
+	// mobile urls and later pages of the list all start from the first
+	listURL := fmt.Sprintf("https://www.webtoons.com/%s/%s/list?title_no=%s", ho.RouteParams[2], ho.RouteParams[3], ho.RouteParams[4])
+
+	doc, err := getDoc(context.TODO(), ho.Client, listURL)
+	if err != nil {
+		return "", nil, err
+	}
+
+	s := parseSeries(doc)
+	if s.Title == "" {
+		return "", nil, errors.New("webtoons: could not find the title of the series")
+	}
+
+	return s.Title, &dc.Config{
+		Type:        dc.FullScrape,
+		Entrypoints: []string{listURL},
+	}, nil
+}
+
+func getDoc(ctx context.Context, c *http.Client, u string) (*goquery.Document, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer httpx.DrainAndClose(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("webtoons: %s returned %d", u, resp.StatusCode)
+	}
+
+	return goquery.NewDocumentFromReader(resp.Body)
+}
+
+type series struct {
+	Title  string `json:"title"`
+	Author string `json:"author"`
+}
+
+func parseSeries(doc *goquery.Document) *series {
+	return &series{
+		Title:  strings.TrimSpace(doc.Find(`meta[property="og:title"]`).AttrOr("content", "")),
+		Author: strings.TrimSpace(doc.Find(`meta[property="com-linewebtoon:webtoon:author"]`).AttrOr("content", "")),
+	}
+}
+
+// episode is taken from the list item of an episode, the viewer repeats
+// little of it
+type episode struct {
+	Title    string    `json:"title"`
+	Author   string    `json:"author"`
+	PostedAt time.Time `json:"posted_at"`
+}
+
+// listPage reads a page of the episode list, which is newest first
+func listPage(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+	doc, err := getDoc(ctx, ho.Client, t.URL)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	base, err := url.Parse(t.URL)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	s := parseSeries(doc)
+
+	// the list answers pages past its end with the last page again, which
+	// starts with the same episode as the page before it
+	items := doc.Find(`#_listUl > li`)
+	first, err := json.Marshal(items.First().AttrOr("data-episode-no", ""))
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+	if items.Length() == 0 || string(t.Extra["first_episode"]) == string(first) {
+		return dc.Response(nil)
+	}
+
+	var (
+		tasks []*dc.Task
+		// set once an episode from before the day of the newest stored or
+		// the first episode is seen, there is nothing older to look for
+		done bool
+	)
+	items.EachWithBreak(func(i int, sel *goquery.Selection) bool {
+		href, ok := sel.Find(`a[href]`).First().Attr("href")
+		if !ok {
+			return true
+		}
+
+		u, err := base.Parse(href)
+		if err != nil {
+			return true
+		}
+
+		e := &episode{
+			Title:  strings.TrimSpace(sel.Find(`.subj span`).First().Text()),
+			Author: s.Author,
+		}
+		e.PostedAt, err = time.Parse(dateLayout, strings.TrimSpace(sel.Find(`.date`).First().Text()))
+		if err == nil && !ho.Config.NewerDay(e.PostedAt) {
+			done = true
+			return false
+		}
+
+		extra, err := json.Marshal(e)
+		if err != nil {
+			return true
+		}
+
+		tasks = append(tasks, &dc.Task{
+			URL:   u.String(),
+			Extra: map[string]json.RawMessage{"episode": extra},
+		})
+
+		if sel.AttrOr("data-episode-no", "") == "1" {
+			done = true
+		}
+		return true
+	})
+
+	if !done {
+		if next := dc.NextPageNumber(t, "page", 0); next != nil {
+			next.Extra["first_episode"] = first
+			tasks = append(tasks, next)
+		}
+	}
+
+	return dc.Response(nil, tasks...)
+}
+
+func viewerPage(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+	doc, err := getDoc(ctx, ho.Client, t.URL)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	e := &episode{}
+	if raw, ok := t.Extra["episode"]; ok {
+		err = json.Unmarshal(raw, e)
+		if err != nil {
+			return dc.ErrorResponse(err)
+		}
+	}
+	if e.Title == "" {
+		e.Title = strings.TrimSpace(doc.Find(`.subj_episode`).First().AttrOr("title", ""))
+	}
+	if e.PostedAt.IsZero() {
+		e.PostedAt = time.Now()
+	}
+
+	// data-url is swapped into src as panels scroll into view
+	var srcs []string
+	doc.Find(`#_imageList img._images`).Each(func(i int, sel *goquery.Selection) {
+		if src := sel.AttrOr("data-url", sel.AttrOr("src", "")); src != "" {
+			srcs = append(srcs, src)
+		}
+	})
+
+	body, err := dc.ImageSequence(ctx, ho, t.URL, srcs)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	q := u.Query()
+
+	return dc.Response([]interface{}{&hydrocarbon.Post{
+		PostedAt:    e.PostedAt,
+		OriginalURL: t.URL,
+		ExternalID:  q.Get("title_no") + ":" + q.Get("episode_no"),
+		Title:       e.Title,
+		Author:      e.Author,
+		Body:        body,
+	}})
+}
@@ -0,0 +1,51 @@
+package webtoons
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+	"github.com/fortytw2/hydrocarbon/discollect/dctest"
+)
+
+const (
+	listURL  = "https://www.webtoons.com/en/fantasy/tower-of-god/list?title_no=95"
+	episode2 = "https://www.webtoons.com/en/fantasy/tower-of-god/season-1-ep-2/viewer?title_no=95&episode_no=2"
+	episode3 = "https://www.webtoons.com/en/fantasy/tower-of-god/season-1-ep-3/viewer?title_no=95&episode_no=3"
+)
+
+func TestSeries(t *testing.T) {
+	h := dctest.New(t, Plugin, "testdata/webtoons.json")
+	defer h.Close()
+
+	full := h.Run(&dc.Config{Type: dc.FullScrape}, listURL).
+		ExpectNoErrors().
+		ExpectTasks(episode3, episode2, "https://www.webtoons.com/en/fantasy/tower-of-god/list?page=2&title_no=95")
+
+	// past its end the list repeats its last page
+	h.RunTask(&dc.Config{Type: dc.FullScrape}, full.Tasks[2]).
+		ExpectNoErrors().
+		ExpectTasks()
+
+	// the delta scrape stops at the first episode from before the day of the
+	// newest stored, which is only dated by the day
+	h.Run(&dc.Config{Type: dc.DeltaScrape, Since: time.Date(2020, 3, 2, 18, 0, 0, 0, time.UTC)}, listURL).
+		ExpectNoErrors().
+		ExpectTasks(episode3, episode2, "https://www.webtoons.com/en/fantasy/tower-of-god/list?page=2&title_no=95")
+
+	h.Run(&dc.Config{Type: dc.DeltaScrape, Since: time.Date(2020, 3, 3, 0, 0, 0, 0, time.UTC)}, listURL).
+		ExpectNoErrors().
+		ExpectTasks(episode3)
+
+	h.RunTask(&dc.Config{Type: dc.FullScrape}, full.Tasks[0]).
+		ExpectNoErrors().
+		ExpectFacts(&hydrocarbon.Post{
+			PostedAt:    time.Date(2020, 3, 3, 0, 0, 0, 0, time.UTC),
+			OriginalURL: episode3,
+			ExternalID:  "95:3",
+			Title:       "[Season 1] Ep. 3",
+			Author:      "SIU",
+			Body:        `<img src="https://stubfotos.com/https://webtoon-phinf.pstatic.net/95/3/1.jpg"/><img src="https://stubfotos.com/https://webtoon-phinf.pstatic.net/95/3/2.jpg"/>`,
+		})
+}
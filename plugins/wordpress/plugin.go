@@ -0,0 +1,499 @@
+package wordpress
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+	"github.com/fortytw2/hydrocarbon/httpx"
+)
+
+const (
+	// every WordPress site links to its REST API with this relation
+	apiRel = "https://api.w.org/"
+
+	// the most posts the API returns a page
+	pageSize = 20
+
+	maxResponseSize = 8 * 1024 * 1024
+)
+
+var (
+	linkHeader = regexp.MustCompile(`<([^>]+)>;\s*rel="` + regexp.QuoteMeta(apiRel) + `"`)
+	postID     = regexp.MustCompile(`^post-(\d+)$`)
+	numeric    = regexp.MustCompile(`^\d+$`)
+
+	errAPIDisabled = errors.New("wordpress: the REST API is disabled")
+)
+
+// Plugin is a plugin that can follow any WordPress site, through its REST API
+// or by scraping its pages if the API is disabled. Sites are told apart from
+// others by the link to their API, which their feeds also send, so it has to
+// be registered after the generic feed plugins to leave feeds to them
+var Plugin = &dc.Plugin{
+	Name:          "wordpress",
+	ConfigCreator: configCreator,
+	ExternalID: func(url string, ho *dc.HandlerOpts) string {
+		return strings.ToLower(ho.RouteParams[1])
+	},
+	Entrypoints: []string{
+		`^(https?:\/\/[^\/?#]+)(?:\/[^#]*)?$`,
+	},
+	RateLimit: &dc.RateLimit{
+		PerDomain: 1,
+	},
+	Scheduler: &dc.Adaptive{Min: 30 * time.Minute, Max: 12 * time.Hour},
+	Backfill: func(c *dc.Config) (*dc.Config, error) {
+		return &dc.Config{Entrypoints: c.Entrypoints}, nil
+	},
+	// the API, pages of posts and posts can not be told apart by pattern on
+	// every site, so one handler routes them all
+	Routes: map[string]dc.Handler{
+		`^https?:\/\/`: page,
+	},
+}
+
+func configCreator(entrypoint string, ho *dc.HandlerOpts) (string, *dc.Config, error) {
+	resp, err := get(context.TODO(), ho.Client, entrypoint)
+	if err != nil {
+		return "", nil, err
+	}
+	defer httpx.DrainAndClose(resp.Body)
+
+	doc, err := goquery.NewDocumentFromReader(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return "", nil, err
+	}
+
+	root := apiRoot(resp, doc)
+	if root == "" {
+		return "", nil, fmt.Errorf("wordpress: %s is not a WordPress site", entrypoint)
+	}
+
+	title := strings.TrimSpace(doc.Find(`meta[property="og:site_name"]`).AttrOr("content", ""))
+	if title == "" {
+		title = strings.TrimSpace(doc.Find("title").First().Text())
+	}
+
+	var probe []struct {
+		ID int `json:"id"`
+	}
+	err = getJSON(context.TODO(), ho.Client, apiURL(root, "/wp/v2/posts", url.Values{"per_page": {"1"}, "_fields": {"id"}}), &probe)
+	if err == errAPIDisabled {
+		// the pages of the site are scraped instead, starting from where
+		// the user pointed at
+		return title, &dc.Config{
+			Type:        dc.FullScrape,
+			Entrypoints: []string{entrypoint},
+		}, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	return title, &dc.Config{
+		Type: dc.FullScrape,
+		Entrypoints: []string{
+			apiURL(root, "/wp/v2/posts", url.Values{"per_page": {strconv.Itoa(pageSize)}, "_embed": {"1"}}),
+		},
+	}, nil
+}
+
+// apiRoot returns the root of the REST API of a site, from the Link header or
+// the <link> in the page, or an empty string if the site is not WordPress
+func apiRoot(resp *http.Response, doc *goquery.Document) string {
+	for _, l := range resp.Header["Link"] {
+		if m := linkHeader.FindStringSubmatch(l); m != nil {
+			return m[1]
+		}
+	}
+
+	href := doc.Find(`link[rel="`+apiRel+`"]`).AttrOr("href", "")
+	if href == "" {
+		return ""
+	}
+
+	u, err := resp.Request.URL.Parse(href)
+	if err != nil {
+		return ""
+	}
+
+	return u.String()
+}
+
+// apiURL returns the url of path under the API root, which is a query
+// parameter on sites without pretty permalinks
+func apiURL(root, path string, params url.Values) string {
+	u, err := url.Parse(root)
+	if err != nil {
+		return ""
+	}
+
+	q := u.Query()
+	if route := q.Get("rest_route"); route != "" {
+		q.Set("rest_route", strings.TrimSuffix(route, "/")+path)
+	} else {
+		u.Path = strings.TrimSuffix(u.Path, "/") + path
+	}
+
+	for k, v := range params {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+func get(ctx context.Context, c *http.Client, u string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		httpx.DrainAndClose(resp.Body)
+		return nil, fmt.Errorf("wordpress: %s returned %d", u, resp.StatusCode)
+	}
+
+	return resp, nil
+}
+
+// getJSON decodes an API response into x, refusals and responses that are not
+// JSON at all, as from plugins that turn the API off, are errAPIDisabled
+func getJSON(ctx context.Context, c *http.Client, u string, x interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer httpx.DrainAndClose(resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return errAPIDisabled
+	default:
+		return fmt.Errorf("wordpress: %s returned %d", u, resp.StatusCode)
+	}
+
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(x)
+	if err != nil {
+		return errAPIDisabled
+	}
+
+	return nil
+}
+
+func page(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	q := u.Query()
+	switch {
+	case strings.Contains(u.Path, "/wp/v2/posts") || strings.Contains(q.Get("rest_route"), "/wp/v2/posts"):
+		return apiPosts(ctx, ho, t, u)
+	case numeric.MatchString(q.Get("p")):
+		return postPage(ctx, ho, t, externalID(u.Host, q.Get("p")))
+	default:
+		return indexPage(ctx, ho, t, u)
+	}
+}
+
+type rendered struct {
+	Rendered  string `json:"rendered"`
+	Protected bool   `json:"protected"`
+}
+
+type wpPost struct {
+	ID      int      `json:"id"`
+	DateGMT string   `json:"date_gmt"`
+	Link    string   `json:"link"`
+	Title   rendered `json:"title"`
+	Content rendered `json:"content"`
+
+	// set with ?_embed
+	Embedded struct {
+		Author []struct {
+			Name string `json:"name"`
+		} `json:"author"`
+		FeaturedMedia []struct {
+			SourceURL string `json:"source_url"`
+			AltText   string `json:"alt_text"`
+		} `json:"wp:featuredmedia"`
+		// one list for each taxonomy the post is in
+		Terms [][]struct {
+			Name     string `json:"name"`
+			Taxonomy string `json:"taxonomy"`
+		} `json:"wp:term"`
+	} `json:"_embedded"`
+}
+
+// apiPosts reads a page of posts from the API, newest first
+func apiPosts(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task, u *url.URL) *dc.HandlerResponse {
+	req, err := http.NewRequest(http.MethodGet, t.URL, nil)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	resp, err := ho.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+	defer httpx.DrainAndClose(resp.Body)
+
+	// a full last page is followed by a page past the end, which the API
+	// refuses
+	if resp.StatusCode == http.StatusBadRequest && u.Query().Get("page") != "" {
+		return dc.NilResponse()
+	}
+	if resp.StatusCode != http.StatusOK {
+		return dc.ErrorResponse(fmt.Errorf("wordpress: %s returned %d", t.URL, resp.StatusCode))
+	}
+
+	var posts []*wpPost
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&posts)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	var facts []interface{}
+	for _, wp := range posts {
+		postedAt, err := time.Parse("2006-01-02T15:04:05", wp.DateGMT)
+		if err != nil {
+			return dc.ErrorResponse(fmt.Errorf("wordpress: post %d has an invalid date: %s", wp.ID, err))
+		}
+
+		if !ho.Config.Newer(postedAt) {
+			return dc.Response(facts)
+		}
+
+		// password protected posts have nothing to read
+		if wp.Content.Protected {
+			continue
+		}
+
+		facts = append(facts, wp.post(u.Host, postedAt))
+	}
+
+	perPage, err := strconv.Atoi(u.Query().Get("per_page"))
+	if err != nil {
+		perPage = 10
+	}
+	if len(posts) < perPage {
+		return dc.Response(facts)
+	}
+
+	maxPages := 0
+	if ho.Config == nil || ho.Config.Type == dc.FullScrape {
+		maxPages = dc.FullScrapePages
+	}
+
+	next := dc.NextPageNumber(t, "page", maxPages)
+	if next == nil {
+		return dc.Response(facts)
+	}
+
+	return dc.Response(facts, next)
+}
+
+func (wp *wpPost) post(host string, postedAt time.Time) *hydrocarbon.Post {
+	body := wp.Content.Rendered
+	if fm := wp.Embedded.FeaturedMedia; len(fm) > 0 && fm[0].SourceURL != "" {
+		body = fmt.Sprintf(`<figure><img src="%s" alt="%s"/></figure>`, escape(fm[0].SourceURL), escape(fm[0].AltText)) + body
+	}
+
+	p := &hydrocarbon.Post{
+		PostedAt:    postedAt,
+		OriginalURL: wp.Link,
+		ExternalID:  externalID(host, strconv.Itoa(wp.ID)),
+		Title:       text(wp.Title.Rendered),
+		Body:        strings.TrimSpace(body),
+	}
+
+	if len(wp.Embedded.Author) > 0 {
+		p.Author = wp.Embedded.Author[0].Name
+	}
+
+	var categories, tags []string
+	for _, terms := range wp.Embedded.Terms {
+		for _, term := range terms {
+			switch term.Taxonomy {
+			case "category":
+				categories = append(categories, text(term.Name))
+			case "post_tag":
+				tags = append(tags, text(term.Name))
+			}
+		}
+	}
+	if len(categories) > 0 || len(tags) > 0 {
+		p.Extra = map[string]interface{}{}
+		if len(categories) > 0 {
+			p.Extra["categories"] = categories
+		}
+		if len(tags) > 0 {
+			p.Extra["tags"] = tags
+		}
+	}
+
+	return p
+}
+
+// externalID namespaces the ID of a post by the host of its site, as every
+// site numbers its posts from 1
+func externalID(host, id string) string {
+	return strings.ToLower(host) + ":" + id
+}
+
+// indexPage reads a page listing posts, the front page or an archive, when the
+// API is disabled
+func indexPage(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task, u *url.URL) *dc.HandlerResponse {
+	resp, err := get(ctx, ho.Client, t.URL)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+	defer httpx.DrainAndClose(resp.Body)
+
+	doc, err := goquery.NewDocumentFromReader(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	var (
+		tasks []*dc.Task
+		done  bool
+	)
+	doc.Find(`article[id^="post-"]`).EachWithBreak(func(i int, sel *goquery.Selection) bool {
+		m := postID.FindStringSubmatch(sel.AttrOr("id", ""))
+		if m == nil {
+			return true
+		}
+
+		if dt, ok := sel.Find(`time[datetime]`).First().Attr("datetime"); ok {
+			if postedAt, err := time.Parse(time.RFC3339, dt); err == nil && !ho.Config.Newer(postedAt) {
+				done = true
+				return false
+			}
+		}
+
+		// posts are fetched by their ID, which redirects to wherever the
+		// permalinks of the site put them
+		tasks = append(tasks, &dc.Task{
+			URL: u.Scheme + "://" + u.Host + "/?p=" + m[1],
+		})
+		return true
+	})
+
+	if done || len(tasks) == 0 {
+		return dc.Response(nil, tasks...)
+	}
+
+	next := dc.NextLink(doc)
+	if next == "" {
+		next = doc.Find(`a.next.page-numbers, .nav-previous a`).First().AttrOr("href", "")
+	}
+
+	maxPages := 0
+	if ho.Config == nil || ho.Config.Type == dc.FullScrape {
+		maxPages = dc.FullScrapePages
+	}
+
+	if nt := dc.NextPage(t, next, maxPages); nt != nil {
+		tasks = append(tasks, nt)
+	}
+
+	return dc.Response(nil, tasks...)
+}
+
+// postPage scrapes a post when the API is disabled
+func postPage(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task, id string) *dc.HandlerResponse {
+	resp, err := get(ctx, ho.Client, t.URL)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+	defer httpx.DrainAndClose(resp.Body)
+
+	doc, err := goquery.NewDocumentFromReader(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	content := doc.Find(`.entry-content`).First()
+	if content.Length() == 0 {
+		return dc.ErrorResponse(fmt.Errorf("wordpress: could not find the content of %s", t.URL))
+	}
+	// sharing buttons and related posts added by Jetpack
+	content.Find(`.sharedaddy, .jp-relatedposts`).Remove()
+
+	body, err := content.Html()
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	// the url the ID redirected to
+	link := doc.Find(`link[rel="canonical"]`).AttrOr("href", resp.Request.URL.String())
+
+	title := text(doc.Find(`.entry-title`).First().Text())
+	if title == "" {
+		title = doc.Find(`meta[property="og:title"]`).AttrOr("content", "")
+	}
+
+	published := doc.Find(`meta[property="article:published_time"]`).AttrOr("content", "")
+	if published == "" {
+		published = doc.Find(`time[datetime]`).First().AttrOr("datetime", "")
+	}
+	postedAt, err := time.Parse(time.RFC3339, published)
+	if err != nil {
+		postedAt = time.Now()
+	}
+
+	author := doc.Find(`meta[name="author"]`).AttrOr("content", "")
+	if author == "" {
+		author = text(doc.Find(`.author .fn, .byline .author a, .author a`).First().Text())
+	}
+
+	return dc.Response([]interface{}{&hydrocarbon.Post{
+		PostedAt:    postedAt.UTC(),
+		OriginalURL: link,
+		ExternalID:  id,
+		Title:       title,
+		Author:      strings.TrimSpace(author),
+		Body:        strings.TrimSpace(body),
+	}})
+}
+
+// text returns the text of a rendered fragment, titles and terms have their
+// entities escaped and sometimes markup
+func text(s string) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(s))
+	if err != nil {
+		return s
+	}
+
+	return strings.Join(strings.Fields(doc.Text()), " ")
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`&`, "&amp;", `"`, "&quot;", `<`, "&lt;", `>`, "&gt;").Replace(s)
+}
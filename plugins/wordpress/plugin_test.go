@@ -0,0 +1,122 @@
+package wordpress
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+	"github.com/fortytw2/hydrocarbon/discollect/dctest"
+)
+
+func configFor(t *testing.T, h *dctest.Harness, entrypoint string) (string, *dc.Config, error) {
+	t.Helper()
+
+	return Plugin.ConfigCreator(entrypoint, &dc.HandlerOpts{
+		Client:      h.Client,
+		RouteParams: regexp.MustCompile(Plugin.Entrypoints[0]).FindStringSubmatch(entrypoint),
+	})
+}
+
+func TestConfigCreator(t *testing.T) {
+	h := dctest.New(t, Plugin, "testdata/wordpress.json")
+	defer h.Close()
+
+	var tcs = []struct {
+		Entrypoint string
+		Title      string
+		Config     string
+	}{
+		{"https://blog.example.com/", "Example Blog", "https://blog.example.com/wp-json/wp/v2/posts?_embed=1&per_page=20"},
+		// sites without pretty permalinks route the API by a parameter
+		{"https://plain.example.com/?page_id=2", "Plain", "https://plain.example.com/index.php?_embed=1&per_page=20&rest_route=%2Fwp%2Fv2%2Fposts"},
+		// the pages are scraped when the API is disabled
+		{"https://closed.example.com/", "Closed", "https://closed.example.com/"},
+	}
+
+	for _, tc := range tcs {
+		title, cfg, err := configFor(t, h, tc.Entrypoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if title != tc.Title || cfg.Entrypoints[0] != tc.Config {
+			t.Errorf("expected %s at %s, got %s at %s", tc.Title, tc.Config, title, cfg.Entrypoints[0])
+		}
+	}
+
+	_, _, err := configFor(t, h, "https://static.example.com/")
+	if err == nil {
+		t.Error("expected a site without the API link to be refused")
+	}
+}
+
+func TestAPIPosts(t *testing.T) {
+	h := dctest.New(t, Plugin, "testdata/wordpress.json")
+	defer h.Close()
+
+	spring := &hydrocarbon.Post{
+		PostedAt:    time.Date(2020, 3, 2, 10, 0, 0, 0, time.UTC),
+		OriginalURL: "https://blog.example.com/2020/03/02/spring/",
+		ExternalID:  "blog.example.com:12",
+		Title:       "Spring ’s here",
+		Author:      "Ada",
+		Body:        `<figure><img src="https://blog.example.com/wp-content/uploads/garden.jpg" alt="the garden"/></figure>` + "\n<p>The garden is waking up.</p>",
+		Extra: map[string]interface{}{
+			"categories": []string{"Gardening"},
+			"tags":       []string{"spring", "flowers & trees"},
+		},
+	}
+
+	// the password protected post is skipped, and the full page is followed
+	// by the next
+	h.Run(&dc.Config{Type: dc.FullScrape}, "https://blog.example.com/wp-json/wp/v2/posts?_embed=1&per_page=2").
+		ExpectNoErrors().
+		ExpectTasks("https://blog.example.com/wp-json/wp/v2/posts?_embed=1&page=2&per_page=2").
+		ExpectFacts(spring)
+
+	h.Run(&dc.Config{Type: dc.FullScrape}, "https://blog.example.com/wp-json/wp/v2/posts?_embed=1&page=2&per_page=2").
+		ExpectNoErrors().
+		ExpectTasks().
+		ExpectFacts(&hydrocarbon.Post{
+			PostedAt:    time.Date(2020, 2, 20, 10, 0, 0, 0, time.UTC),
+			OriginalURL: "https://blog.example.com/2020/02/20/winter/",
+			ExternalID:  "blog.example.com:10",
+			Title:       "Winter",
+			Author:      "Grace",
+			Body:        "<p>Cold.</p>",
+			Extra: map[string]interface{}{
+				"categories": []string{"Uncategorized"},
+			},
+		})
+
+	// the delta scrape stops at the first post already stored
+	h.Run(&dc.Config{Type: dc.DeltaScrape, Since: time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)}, "https://blog.example.com/wp-json/wp/v2/posts?_embed=1&per_page=2").
+		ExpectNoErrors().
+		ExpectTasks().
+		ExpectFacts(spring)
+}
+
+func TestHTMLPosts(t *testing.T) {
+	h := dctest.New(t, Plugin, "testdata/wordpress.json")
+	defer h.Close()
+
+	h.Run(&dc.Config{Type: dc.FullScrape}, "https://closed.example.com/").
+		ExpectNoErrors().
+		ExpectTasks("https://closed.example.com/?p=7", "https://closed.example.com/?p=5", "https://closed.example.com/page/2/")
+
+	h.Run(&dc.Config{Type: dc.DeltaScrape, Since: time.Date(2020, 2, 15, 0, 0, 0, 0, time.UTC)}, "https://closed.example.com/").
+		ExpectNoErrors().
+		ExpectTasks("https://closed.example.com/?p=7")
+
+	h.Run(&dc.Config{Type: dc.FullScrape}, "https://closed.example.com/?p=7").
+		ExpectNoErrors().
+		ExpectFacts(&hydrocarbon.Post{
+			PostedAt:    time.Date(2020, 3, 2, 9, 0, 0, 0, time.UTC),
+			OriginalURL: "https://closed.example.com/2020/03/02/hello/",
+			ExternalID:  "closed.example.com:7",
+			Title:       "Hello",
+			Author:      "Grace",
+			Body:        "<p>First post.</p>",
+		})
+}
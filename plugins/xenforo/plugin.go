@@ -0,0 +1,225 @@
+package xenforo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+	"github.com/fortytw2/hydrocarbon/httpx"
+)
+
+// the forums threadmarks are read from, all run XenForo 2
+const forums = `(forums\.spacebattles\.com|forums\.sufficientvelocity\.com)`
+
+// backwardsExtra is set on the tasks of delta scrapes, which start from the
+// last page of the reader and walk back until they reach posts already stored
+const backwardsExtra = "xenforo_backwards"
+
+// Plugin is a plugin that can scrape the threadmarked posts of quests and
+// stories on XenForo forums, one post a chapter
+var Plugin = &dc.Plugin{
+	Name:          "xenforo",
+	ConfigCreator: configCreator,
+	// thread numbers are only unique on their own forum, so the host is part
+	// of the ID
+	ExternalID: func(url string, ho *dc.HandlerOpts) string {
+		return ho.RouteParams[1] + ":" + ho.RouteParams[3]
+	},
+	// both forums are quick to ban scrapers
+	RateLimit: &dc.RateLimit{
+		PerDomain: 0.5,
+	},
+	Entrypoints: []string{
+		`^https:\/\/` + forums + `\/threads\/([^\/]*\.)?(\d+)`,
+	},
+	// most stories are updated weekly or so, quests more often
+	Scheduler: &dc.Adaptive{Min: time.Hour, Max: 24 * time.Hour},
+	// page one of the reader is the first threadmark, wherever it is in the
+	// thread
+	Backfill: func(c *dc.Config) (*dc.Config, error) {
+		return &dc.Config{Entrypoints: c.Entrypoints}, nil
+	},
+	// the reader skips the replies between threadmarks that the thread shows
+	ConfigSchema: `{
+		"properties": {
+			"Entrypoints": {"items": {"pattern": "^https://` + strings.Replace(forums, `\`, `\\`, -1) + `/threads/\\d+/reader/$"}}
+		}
+	}`,
+	Routes: map[string]dc.Handler{
+		`^https:\/\/` + forums + `\/threads\/([^\/]*\.)?(\d+)\/reader\/?(page-\d+)?`: readerPage,
+	},
+}
+
+func configCreator(entrypointURL string, ho *dc.HandlerOpts) (string, *dc.Config, error) {
+	// links to a single post or a later page still carry the thread number
+	threadURL := fmt.Sprintf("https://%s/threads/%s/", ho.RouteParams[1], ho.RouteParams[3])
+
+	doc, err := getDoc(context.TODO(), ho.Client, threadURL)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// prefixes like "Worm" or "Quest" are labels inside the title
+	h := doc.Find(`h1.p-title-value`).First()
+	h.Find(`.label, .label-append`).Remove()
+
+	title := strings.TrimSpace(h.Text())
+	if title == "" {
+		title = strings.TrimSpace(doc.Find(`meta[property="og:title"]`).AttrOr("content", ""))
+	}
+	if title == "" {
+		return "", nil, errors.New("xenforo: could not find the title of the thread")
+	}
+
+	// threads without threadmarks have nothing to read
+	if doc.Find(`a[href*="/threadmarks"]`).Length() == 0 {
+		return "", nil, errors.New("xenforo: the thread has no threadmarks")
+	}
+
+	return title, &dc.Config{
+		Type:        dc.FullScrape,
+		Entrypoints: []string{threadURL + "reader/"},
+	}, nil
+}
+
+func getDoc(ctx context.Context, c *http.Client, u string) (*goquery.Document, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer httpx.DrainAndClose(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("xenforo: %s returned %d", u, resp.StatusCode)
+	}
+
+	return goquery.NewDocumentFromReader(resp.Body)
+}
+
+// parseTime reads the time of a post, XenForo gives it as a unix timestamp and
+// in ISO 8601
+func parseTime(s *goquery.Selection) (time.Time, bool) {
+	if unix, err := strconv.ParseInt(s.AttrOr("data-time", ""), 10, 64); err == nil {
+		return time.Unix(unix, 0).UTC(), true
+	}
+
+	t, err := time.Parse("2006-01-02T15:04:05-0700", s.AttrOr("datetime", ""))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return t.UTC(), true
+}
+
+// parsePosts reads every threadmarked post on a page of the reader, oldest
+// first
+func parsePosts(doc *goquery.Document, base *url.URL, threadID string) ([]*hydrocarbon.Post, error) {
+	var (
+		posts []*hydrocarbon.Post
+		err   error
+	)
+	doc.Find(`article.message[data-content^="post-"]`).EachWithBreak(func(i int, sel *goquery.Selection) bool {
+		id := strings.TrimPrefix(sel.AttrOr("data-content", ""), "post-")
+
+		postedAt, ok := parseTime(sel.Find(`.message-attribution time.u-dt`).First())
+		if !ok {
+			err = fmt.Errorf("xenforo: could not find when post %s was made", id)
+			return false
+		}
+
+		var body string
+		body, err = sel.Find(`.message-body .bbWrapper`).First().Html()
+		if err != nil {
+			return false
+		}
+
+		u, _ := base.Parse("/posts/" + id + "/")
+
+		posts = append(posts, &hydrocarbon.Post{
+			PostedAt:    postedAt,
+			OriginalURL: u.String(),
+			ExternalID:  threadID + ":" + id,
+			Title:       strings.TrimSpace(sel.Find(`.threadmarkLabel`).First().Text()),
+			Author:      sel.AttrOr("data-author", ""),
+			Body:        html.UnescapeString(strings.TrimSpace(body)),
+		})
+		return true
+	})
+
+	return posts, err
+}
+
+// readerPage reads a page of the reader, which shows only the threadmarked
+// posts of a thread and needs no login. Full scrapes page forwards through it,
+// delta scrapes jump to its last page and page backwards
+func readerPage(ctx context.Context, ho *dc.HandlerOpts, t *dc.Task) *dc.HandlerResponse {
+	doc, err := getDoc(ctx, ho.Client, t.URL)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	base, err := url.Parse(t.URL)
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	delta := ho.Config != nil && ho.Config.Type == dc.DeltaScrape
+	_, backwards := t.Extra[backwardsExtra]
+
+	if delta && !backwards {
+		last, ok := doc.Find(`.pageNav-main .pageNav-page:last-child a`).First().Attr("href")
+		if ok {
+			lastURL, err := base.Parse(last)
+			if err == nil && lastURL.String() != t.URL {
+				return dc.Response(nil, &dc.Task{
+					URL:   lastURL.String(),
+					Extra: map[string]json.RawMessage{backwardsExtra: json.RawMessage(`true`)},
+				})
+			}
+		}
+	}
+
+	posts, err := parsePosts(doc, base, ho.RouteParams[1]+":"+ho.RouteParams[3])
+	if err != nil {
+		return dc.ErrorResponse(err)
+	}
+
+	facts := make([]interface{}, 0, len(posts))
+	for _, p := range posts {
+		if ho.Config.Newer(p.PostedAt) {
+			facts = append(facts, p)
+		}
+	}
+
+	var next *dc.Task
+	if delta {
+		// earlier pages may hold new posts too, until one already stored is
+		// seen
+		if len(posts) > 0 && len(facts) == len(posts) {
+			next = dc.NextPage(t, doc.Find(`link[rel="prev"]`).AttrOr("href", ""), 0)
+		}
+	} else {
+		next = dc.NextPage(t, dc.NextLink(doc), 0)
+	}
+
+	if next == nil {
+		return dc.Response(facts)
+	}
+
+	return dc.Response(facts, next)
+}
@@ -0,0 +1,58 @@
+package xenforo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fortytw2/hydrocarbon"
+	dc "github.com/fortytw2/hydrocarbon/discollect"
+	"github.com/fortytw2/hydrocarbon/discollect/dctest"
+)
+
+const (
+	page1 = "https://forums.spacebattles.com/threads/worm.1/reader/"
+	page2 = "https://forums.spacebattles.com/threads/worm.1/reader/page-2"
+)
+
+func chapter(id, title string, postedAt int64, body string) *hydrocarbon.Post {
+	return &hydrocarbon.Post{
+		PostedAt:    time.Unix(postedAt, 0).UTC(),
+		OriginalURL: "https://forums.spacebattles.com/posts/" + id + "/",
+		ExternalID:  "forums.spacebattles.com:1:" + id,
+		Title:       title,
+		Author:      "Wildbow",
+		Body:        body,
+	}
+}
+
+func TestReader(t *testing.T) {
+	h := dctest.New(t, Plugin, "testdata/spacebattles.json")
+	defer h.Close()
+
+	h.Run(&dc.Config{Type: dc.FullScrape}, page1).
+		ExpectNoErrors().
+		ExpectTasks(page2).
+		ExpectFacts(
+			chapter("100", "1.1", 1500000000, "<b>Gestation</b> 1.1"),
+			chapter("101", "1.2", 1500086400, "Gestation 1.2"),
+		)
+
+	// delta scrapes start from the last page and walk back to the posts
+	// already stored
+	delta := &dc.Config{Type: dc.DeltaScrape, Since: time.Unix(1500040000, 0)}
+
+	last := h.Run(delta, page1).ExpectNoErrors().ExpectTasks(page2)
+	if len(last.Facts) != 0 {
+		t.Fatalf("expected the first page to be skipped, got %d facts", len(last.Facts))
+	}
+
+	prev := h.RunTask(delta, last.Tasks[0]).
+		ExpectNoErrors().
+		ExpectTasks(page1).
+		ExpectFacts(chapter("102", "1.3", 1500172800, "Gestation 1.3"))
+
+	h.RunTask(delta, prev.Tasks[0]).
+		ExpectNoErrors().
+		ExpectTasks().
+		ExpectFacts(chapter("101", "1.2", 1500086400, "Gestation 1.2"))
+}
@@ -0,0 +1,182 @@
+package hydrocarbon
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// the sampler wakes up hourly so a restart never skips a day, each day is only
+// sampled once
+const qualityCheckInterval = time.Hour
+
+// PluginQuality summarizes a sample of the posts a plugin extracted in a day,
+// a plugin whose extraction is slowly breaking shows up as a trend in these
+type PluginQuality struct {
+	Plugin  string    `json:"plugin"`
+	Day     time.Time `json:"day"`
+	Samples int       `json:"samples"`
+
+	// percentiles of the length of the text of each post body, in characters
+	BodyLengthP10 int `json:"body_length_p10"`
+	BodyLengthP50 int `json:"body_length_p50"`
+	BodyLengthP90 int `json:"body_length_p90"`
+
+	// LinkDensity is the mean fraction of body text that is inside a link
+	LinkDensity float64 `json:"link_density"`
+	// EmptyAuthorRate is the fraction of posts without an author
+	EmptyAuthorRate float64 `json:"empty_author_rate"`
+}
+
+// A QualityStore is an interface used to seperate the QualitySampler from
+// knowledge of the actual underlying database
+type QualityStore interface {
+	// QualitySampled returns true if the day has already been sampled
+	QualitySampled(ctx context.Context, day time.Time) (bool, error)
+	// SamplePosts returns up to n random posts for each plugin, from posts
+	// created in the 24 hours starting at day
+	SamplePosts(ctx context.Context, day time.Time, n int) (map[string][]*Post, error)
+	RecordQuality(ctx context.Context, pq []*PluginQuality) error
+}
+
+// A QualitySampler samples the posts written by every plugin once a day and
+// records quality metrics for them
+type QualitySampler struct {
+	s QualityStore
+	n int
+
+	shutdown chan chan struct{}
+}
+
+// NewQualitySampler returns a new QualitySampler that samples n posts per
+// plugin per day
+func NewQualitySampler(s QualityStore, n int) *QualitySampler {
+	return &QualitySampler{
+		s:        s,
+		n:        n,
+		shutdown: make(chan chan struct{}),
+	}
+}
+
+// Start launches the sampler, it blocks until Stop is called
+func (qs *QualitySampler) Start() error {
+	ticker := time.NewTicker(qualityCheckInterval)
+
+	for {
+		select {
+		case a := <-qs.shutdown:
+			ticker.Stop()
+			a <- struct{}{}
+			return nil
+		case <-ticker.C:
+			// yesterday is the latest complete day
+			day := time.Now().UTC().Truncate(24 * time.Hour).Add(-24 * time.Hour)
+
+			err := qs.sample(context.TODO(), day)
+			if err != nil {
+				log.Println("hydrocarbon: could not sample post quality:", err)
+			}
+		}
+	}
+}
+
+// Stop blocks until the sampler is shutdown
+func (qs *QualitySampler) Stop() {
+	c := make(chan struct{})
+	qs.shutdown <- c
+	<-c
+}
+
+func (qs *QualitySampler) sample(ctx context.Context, day time.Time) error {
+	sampled, err := qs.s.QualitySampled(ctx, day)
+	if err != nil || sampled {
+		return err
+	}
+
+	posts, err := qs.s.SamplePosts(ctx, day, qs.n)
+	if err != nil {
+		return err
+	}
+
+	pq := make([]*PluginQuality, 0, len(posts))
+	for plugin, p := range posts {
+		pq = append(pq, measureQuality(plugin, day, p))
+	}
+
+	return qs.s.RecordQuality(ctx, pq)
+}
+
+func measureQuality(plugin string, day time.Time, posts []*Post) *PluginQuality {
+	pq := &PluginQuality{
+		Plugin:  plugin,
+		Day:     day,
+		Samples: len(posts),
+	}
+
+	if len(posts) == 0 {
+		return pq
+	}
+
+	lengths := make([]int, len(posts))
+	var density float64
+	var noAuthor int
+	for i, p := range posts {
+		text, linkText := bodyText(p.Body)
+		lengths[i] = text
+		if text > 0 {
+			density += float64(linkText) / float64(text)
+		}
+
+		if strings.TrimSpace(p.Author) == "" {
+			noAuthor++
+		}
+	}
+
+	sort.Ints(lengths)
+	pq.BodyLengthP10 = percentile(lengths, 0.1)
+	pq.BodyLengthP50 = percentile(lengths, 0.5)
+	pq.BodyLengthP90 = percentile(lengths, 0.9)
+	pq.LinkDensity = density / float64(len(posts))
+	pq.EmptyAuthorRate = float64(noAuthor) / float64(len(posts))
+
+	return pq
+}
+
+// percentile returns the qth percentile of sorted
+func percentile(sorted []int, q float64) int {
+	return sorted[int(q*float64(len(sorted)-1))]
+}
+
+// bodyText returns the number of characters of text in an html body, and how
+// many of those are inside links
+func bodyText(body string) (int, int) {
+	z := html.NewTokenizer(strings.NewReader(body))
+
+	var text, linkText, inLink int
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			// io.EOF, the tokenizer does not fail on malformed html
+			return text, linkText
+		case html.StartTagToken:
+			if name, _ := z.TagName(); string(name) == "a" {
+				inLink++
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "a" && inLink > 0 {
+				inLink--
+			}
+		case html.TextToken:
+			n := utf8.RuneCountInString(strings.TrimSpace(string(z.Text())))
+			text += n
+			if inLink > 0 {
+				linkText += n
+			}
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package hydrocarbon
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMeasureQuality(t *testing.T) {
+	t.Parallel()
+
+	posts := []*Post{
+		{Author: "a", Body: "<p>0123456789</p>"},
+		{Author: "", Body: `<p>01234<a href="/x">56789</a></p>`},
+		{Author: "b", Body: `<a href="/x">0123456789</a>`},
+		{Author: " ", Body: ""},
+	}
+
+	pq := measureQuality("test", time.Now(), posts)
+
+	if pq.Samples != 4 {
+		t.Errorf("expected 4 samples, got %d", pq.Samples)
+	}
+
+	if pq.BodyLengthP10 != 0 || pq.BodyLengthP50 != 10 || pq.BodyLengthP90 != 10 {
+		t.Errorf("unexpected body lengths %d %d %d", pq.BodyLengthP10, pq.BodyLengthP50, pq.BodyLengthP90)
+	}
+
+	if math.Abs(pq.LinkDensity-0.375) > 0.0001 {
+		t.Errorf("expected link density 0.375, got %f", pq.LinkDensity)
+	}
+
+	if pq.EmptyAuthorRate != 0.5 {
+		t.Errorf("expected empty author rate 0.5, got %f", pq.EmptyAuthorRate)
+	}
+}
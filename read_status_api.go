@@ -2,12 +2,17 @@ package hydrocarbon
 
 import (
 	"context"
+	"errors"
 	"net/http"
 )
 
 // ReadStatusStore tracks read_statuses
 type ReadStatusStore interface {
 	MarkRead(ctx context.Context, postID, sessionKey string) error
+	MarkAnnouncementSeen(ctx context.Context, sessionKey, announcementID string) error
+	// StarPost stars or unstars a post of a feed the user follows, starred
+	// posts are kept whatever the retention policy
+	StarPost(ctx context.Context, sessionKey, postID string, starred bool) error
 }
 
 type ReadStatusAPI struct {
@@ -48,3 +53,64 @@ func (rs *ReadStatusAPI) MarkRead(w http.ResponseWriter, r *http.Request) error
 		readReq.PostID: true,
 	})
 }
+
+// StarPost stars or unstars the given post
+func (rs *ReadStatusAPI) StarPost(w http.ResponseWriter, r *http.Request) error {
+	key, err := rs.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	var starReq struct {
+		PostID  string `json:"post_id"`
+		Starred bool   `json:"starred"`
+	}
+
+	err = limitDecoder(r, &starReq)
+	if err != nil {
+		return err
+	}
+
+	if starReq.PostID == "" {
+		return errors.New("no post ID sent")
+	}
+
+	err = rs.s.StarPost(r.Context(), key, starReq.PostID, starReq.Starred)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, map[string]bool{
+		starReq.PostID: starReq.Starred,
+	})
+}
+
+// MarkAnnouncementSeen stops an announcement from being shown to the user again
+func (rs *ReadStatusAPI) MarkAnnouncementSeen(w http.ResponseWriter, r *http.Request) error {
+	key, err := rs.ks.Verify(r.Header.Get("X-Hydrocarbon-Key"))
+	if err != nil {
+		return err
+	}
+
+	var seenReq struct {
+		AnnouncementID string `json:"announcement_id"`
+	}
+
+	err = limitDecoder(r, &seenReq)
+	if err != nil {
+		return err
+	}
+
+	if seenReq.AnnouncementID == "" {
+		return errors.New("no announcement ID sent")
+	}
+
+	err = rs.s.MarkAnnouncementSeen(r.Context(), key, seenReq.AnnouncementID)
+	if err != nil {
+		return err
+	}
+
+	return writeSuccess(w, map[string]bool{
+		seenReq.AnnouncementID: true,
+	})
+}
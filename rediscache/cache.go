@@ -0,0 +1,83 @@
+// package rediscache caches hot reads of hydrocarbon in redis, see pg.Cache
+package rediscache
+
+import (
+	"context"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// Cache is a pg.Cache backed by redis. It is best given an instance of its own
+// with an eviction policy such as allkeys-lru, rather than that of the queue
+type Cache struct {
+	pool *redis.Pool
+}
+
+// New dials redis at redisAddr, an address or a redis:// URL, and checks it
+// can be reached
+func New(redisAddr string, redisDBIndex int) (*Cache, error) {
+	pool := &redis.Pool{
+		MaxIdle:     10,
+		IdleTimeout: 5 * time.Minute,
+		Dial: func() (redis.Conn, error) {
+			c, err := redis.Dial("tcp", redisAddr)
+			if err != nil {
+				c, err = redis.DialURL(redisAddr)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if _, err := c.Do("SELECT", redisDBIndex); err != nil {
+				c.Close()
+				return nil, err
+			}
+			return c, nil
+		},
+	}
+
+	conn := pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("PING")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cache{pool: pool}, nil
+}
+
+// Get returns the value at key, nil if there is none
+func (c *Cache) Get(ctx context.Context, key string) ([]byte, error) {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	v, err := redis.Bytes(conn.Do("GET", key))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+
+	return v, err
+}
+
+// Set sets key to value, expiring after ttl
+func (c *Cache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("SET", key, value, "PX", ttl.Nanoseconds()/int64(time.Millisecond))
+	return err
+}
+
+// Delete deletes every key in one round trip
+func (c *Cache) Delete(ctx context.Context, keys ...string) error {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	args := make([]interface{}, len(keys))
+	for i, k := range keys {
+		args[i] = k
+	}
+
+	_, err := conn.Do("DEL", args...)
+	return err
+}
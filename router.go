@@ -9,7 +9,11 @@ import (
 	"strings"
 
 	assetfs "github.com/elazarl/go-bindata-assetfs"
+	"github.com/fortytw2/hydrocarbon/discollect"
 	"github.com/fortytw2/hydrocarbon/public"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 //go:generate bash -c "pushd ui && NODE_ENV=production yarn build && popd"
@@ -27,6 +31,10 @@ func (eh ErrorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	err := eh(w, r)
 	if err != nil {
+		span := trace.SpanFromContext(r.Context())
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
 		writeErr(w, err)
 	}
 }
@@ -54,14 +62,22 @@ func writeSuccess(w http.ResponseWriter, x interface{}) error {
 	return json.NewEncoder(w).Encode(s)
 }
 
-// writeErr is the only way to write an error
+// writeErr is the only way to write an error, invalid plugin configs also list
+// every field that failed validation
 func writeErr(w http.ResponseWriter, uErr error) {
+	var fields []*discollect.FieldError
+	if ve, ok := uErr.(*discollect.ValidationError); ok {
+		fields = ve.Fields
+	}
+
 	var s = struct {
-		Status string `json:"status"`
-		Error  string `json:"error"`
+		Status string                   `json:"status"`
+		Error  string                   `json:"error"`
+		Fields []*discollect.FieldError `json:"fields,omitempty"`
 	}{
 		statusError,
 		uErr.Error(),
+		fields,
 	}
 	err := json.NewEncoder(w).Encode(s)
 	if err != nil {
@@ -69,10 +85,46 @@ func writeErr(w http.ResponseWriter, uErr error) {
 	}
 }
 
+// A RouterConfig holds the apis a router serves, and the domain it is served
+// at. Users, Feeds, ReadStatus, Admin and Plugins are always served, the rest
+// may be left nil
+type RouterConfig struct {
+	Users      *UserAPI
+	Feeds      *FeedAPI
+	ReadStatus *ReadStatusAPI
+	Admin      *AdminAPI
+	Plugins    *PluginAPI
+
+	// Billing is nil to run without billing
+	Billing *BillingAPI
+	// Federation is nil to not publish feeds to other instances
+	Federation *FederationAPI
+	// ActivityPub is nil to not publish folders to the fediverse
+	ActivityPub *ActivityPubAPI
+	// Newsletters is nil to not receive newsletters
+	Newsletters *NewsletterAPI
+	// Fever is nil to not serve Fever clients
+	Fever *FeverAPI
+	// GReader is nil to not serve Google Reader clients
+	GReader *GReaderAPI
+	// Live is nil to not push changes over websockets
+	Live *LiveAPI
+	// Exports is nil to not export folders as feeds
+	Exports *ExportAPI
+
+	Domain string
+}
+
 // NewRouter configures a new http.Handler that serves hydrocarbon
-func NewRouter(ua *UserAPI, fa *FeedAPI, rs *ReadStatusAPI, domain string) http.Handler {
+func NewRouter(rc RouterConfig) http.Handler {
+	ua, fa, rs, aa, pa := rc.Users, rc.Feeds, rc.ReadStatus, rc.Admin, rc.Plugins
+	ba, fed, ap, na := rc.Billing, rc.Federation, rc.ActivityPub, rc.Newsletters
+	fv, gr, la, ex := rc.Fever, rc.GReader, rc.Live, rc.Exports
+	domain := rc.Domain
+
 	fpr := &fixedPathRouter{
-		paths: make(map[string]http.Handler),
+		paths:    make(map[string]http.Handler),
+		prefixes: make(map[string]http.Handler),
 	}
 
 	fs := http.FileServer(
@@ -109,9 +161,6 @@ func NewRouter(ua *UserAPI, fa *FeedAPI, rs *ReadStatusAPI, domain string) http.
 		// login tokens
 		"/v1/token/create": ua.RequestToken,
 
-		// payment managemnet
-		"/v1/payment/create": ua.CreatePayment,
-
 		// api keys
 		"/v1/key/create": ua.Activate,
 		"/v1/key/verify": ua.VerifyKey,
@@ -119,13 +168,38 @@ func NewRouter(ua *UserAPI, fa *FeedAPI, rs *ReadStatusAPI, domain string) http.
 		"/v1/key/list":   ua.ListSessions,
 
 		// feed management
-		"/v1/feed/create": fa.AddFeed,
-		"/v1/feed/delete": fa.RemoveFeed,
+		"/v1/feed/create":      ba.RequireWritable(fa.AddFeed),
+		"/v1/feed/bulk_create": ba.RequireWritable(fa.AddFeeds),
+		"/v1/feed/delete":      ba.RequireWritable(fa.RemoveFeed),
+		// scrape a feed now, ahead of scheduled scrapes
+		"/v1/feed/refresh": ba.RequireWritable(fa.RefreshFeed),
+		// backfill a feed from an archive of it
+		"/v1/feed/import": ba.RequireWritable(fa.ImportArchive),
+		// or by scraping its entire history
+		"/v1/feed/backfill":        ba.RequireWritable(fa.Backfill),
+		"/v1/feed/backfill/status": fa.BackfillStatus,
+		// user-defined scripts run on each new post of a feed
+		"/v1/feed/transform":     ba.RequireWritable(fa.SetTransform),
+		"/v1/feed/transform/get": fa.GetTransform,
+		// fixed, adaptive or cron schedules in place of the plugins
+		"/v1/feed/schedule": ba.RequireWritable(fa.SetSchedule),
+		// credentials to scrape sites that require an account with
+		"/v1/feed/credentials":        ba.RequireWritable(fa.SetCredentials),
+		"/v1/feed/credentials/delete": ba.RequireWritable(fa.DeleteCredentials),
 		// list all posts with no body for a feed
 		"/v1/feed/get": fa.GetFeed,
+		// find feeds and posts by the ID of the origin site
+		"/v1/feed/lookup": fa.LookupFeed,
+		"/v1/post/lookup": fa.LookupPost,
+
+		// supported sites
+		"/v1/plugin/list": pa.ListPlugins,
 
 		// folder management
-		"/v1/folder/create": fa.AddFolder,
+		"/v1/folder/create": ba.RequireWritable(fa.AddFolder),
+		// deleted folders can be restored until they are purged
+		"/v1/folder/delete":  ba.RequireWritable(fa.DeleteFolder),
+		"/v1/folder/restore": ba.RequireWritable(fa.RestoreFolder),
 		// list all folders with the feed titles
 		"/v1/folder/list": fa.GetFolders,
 
@@ -133,10 +207,97 @@ func NewRouter(ua *UserAPI, fa *FeedAPI, rs *ReadStatusAPI, domain string) http.
 		"/v1/post/get": fa.GetPost,
 
 		"/v1/post/read": rs.MarkRead,
+		"/v1/post/star": rs.StarPost,
+
+		"/v1/announcement/seen": rs.MarkAnnouncementSeen,
+
+		// instance administration
+		"/v1/admin/announcement/create": aa.CreateAnnouncement,
+		"/v1/admin/announcement/update": aa.UpdateAnnouncement,
+		"/v1/admin/announcement/delete": aa.DeleteAnnouncement,
+		"/v1/admin/announcement/list":   aa.ListAnnouncements,
+		"/v1/admin/node/list":           aa.ListNodes,
+		"/v1/admin/node/drain":          aa.DrainNode,
+		"/v1/admin/feed/delete":         aa.DeleteFeed,
+		"/v1/admin/feed/restore":        aa.RestoreFeed,
+		"/v1/admin/post/delete":         aa.DeletePost,
+		"/v1/admin/post/restore":        aa.RestorePost,
+		"/v1/admin/scrape/replay":       aa.ReplayScrape,
+		"/v1/admin/scrape/dry-run":      aa.DryRunScrape,
+		"/v1/admin/scrape/pause":        aa.PauseScrapes,
+		"/v1/admin/scrape/resume":       aa.ResumeScrapes,
+		"/v1/admin/scrape/dead":         aa.DeadScrapes,
+		"/v1/admin/scrape/requeue":      aa.RequeueScrapes,
+		"/v1/admin/scrape/logs":         aa.ScrapeLogs,
+		"/v1/admin/stats":               aa.Stats,
+		"/v1/admin/backup/list":         aa.ListBackups,
+		"/v1/admin/quality":             aa.QualityTrend,
 	}
 
+	// billing is left out entirely on self-hosted instances
+	if ba != nil {
+		routes["/v1/payment/create"] = ua.CreatePayment
+		routes["/v1/billing/status"] = ba.Status
+		routes["/v1/billing/invoices"] = ba.ListInvoices
+		routes["/v1/billing/usage"] = ba.Usage
+		routes["/v1/billing/portal"] = ba.CreatePortalSession
+		routes["/v1/billing/coupon"] = ba.RedeemCoupon
+		routes["/v1/billing/cancel"] = ba.CancelSubscription
+		routes["/v1/billing/plan"] = ba.ChangePlan
+		routes["/v1/billing/webhook"] = ba.Webhook
+	}
+
+	if fed != nil {
+		routes["/v1/federation/feed/get"] = fed.Manifest
+		routes["/v1/federation/posts/get"] = fed.Posts
+	}
+
+	if ap != nil {
+		routes["/v1/folder/publish"] = ba.RequireWritable(ap.Publish)
+		routes[webFingerPath] = ap.WebFinger
+		routes["/v1/activitypub/actor/get"] = ap.Actor
+		routes["/v1/activitypub/outbox/get"] = ap.Outbox
+		routes["/v1/activitypub/followers/get"] = ap.Followers
+		routes["/v1/activitypub/inbox"] = ap.Inbox
+	}
+
+	if na != nil {
+		routes["/v1/newsletter/create"] = ba.RequireWritable(na.CreateAddress)
+		routes["/v1/newsletter/list"] = na.ListAddresses
+		routes["/v1/newsletter/delete"] = ba.RequireWritable(na.DeleteAddress)
+		// mail to every address, from the MailReceiver
+		routes["/v1/newsletter/inbound"] = na.Inbound
+	}
+
+	if fv != nil {
+		routes["/v1/fever/password"] = ba.RequireWritable(fv.SetPassword)
+		// clients are given the url of the api with or without the slash
+		routes["/fever"] = fv.Serve
+		routes["/fever/"] = fv.Serve
+	}
+
+	if la != nil {
+		routes[livePath] = la.Serve
+	}
+
+	if ex != nil {
+		routes["/v1/folder/export"] = ba.RequireWritable(ex.ExportFolder)
+		routes["/v1/feed/export"] = ba.RequireWritable(ex.ExportFeed)
+		// read by other feed readers, with the token of the folder or the
+		// signature of the feed
+		routes["/v1/folder/atom/get"] = ex.Atom
+		routes["/v1/folder/json/get"] = ex.FolderJSON
+		routes["/v1/feed/json/get"] = ex.FeedJSON
+	}
+
+	// every request is traced, continuing the trace of the caller if any
 	for route, handler := range routes {
-		fpr.paths[route] = handler
+		fpr.paths[route] = otelhttp.NewHandler(handler, route)
+	}
+
+	// the Google Reader API puts stream IDs in its paths
+	if gr != nil {
+		fpr.prefixes[greaderPrefix+"/"] = otelhttp.NewHandler(ErrorHandler(gr.Serve), greaderPrefix)
 	}
 
 	if httpsOnly(domain) {
@@ -146,19 +307,32 @@ func NewRouter(ua *UserAPI, fa *FeedAPI, rs *ReadStatusAPI, domain string) http.
 	return fpr
 }
 
-// fixedPathRouter is a brutally simple http router that can handle three cases
+// webFingerPath is fixed by RFC 7033, so it is a GET route without get in its
+// path, as is livePath
+const webFingerPath = "/.well-known/webfinger"
+
+// fixedPathRouter is a brutally simple http router that can handle four cases
 // a static file handler for /static/*
 // a default handler that should serve index.html
 // exact match HTTP POST routes
+// prefixes for apis of other readers, which check methods themselves
 type fixedPathRouter struct {
 	// default
 	def    http.Handler
 	static http.Handler
 
-	paths map[string]http.Handler
+	paths    map[string]http.Handler
+	prefixes map[string]http.Handler
 }
 
 func (fpr *fixedPathRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for prefix, h := range fpr.prefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			h.ServeHTTP(w, r)
+			return
+		}
+	}
+
 	if strings.Contains(r.URL.Path, "static") {
 		fpr.static.ServeHTTP(w, r)
 		return
@@ -166,7 +340,7 @@ func (fpr *fixedPathRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	h, ok := fpr.paths[r.URL.Path]
 	if ok {
-		if r.Method != http.MethodPost && !strings.Contains(r.URL.Path, "get") {
+		if r.Method != http.MethodPost && !strings.Contains(r.URL.Path, "get") && r.URL.Path != webFingerPath && r.URL.Path != livePath {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
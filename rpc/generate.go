@@ -0,0 +1,5 @@
+// Package rpc holds the protobuf definitions of the gRPC api of hydrocarbon,
+// and the code generated from them for Go clients and the server. The
+// generated code is committed, so only changes to hydrocarbon.proto need buf,
+// protoc-gen-go and protoc-gen-go-grpc, run with make rpc.
+package rpc
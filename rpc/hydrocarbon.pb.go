@@ -0,0 +1,1424 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: hydrocarbon.proto
+
+// hydrocarbon.v1 is the gRPC api of hydrocarbon, for native clients. Every call
+// is made with the signed session key of the user in the x-hydrocarbon-key
+// metadata, as the http api is with the X-Hydrocarbon-Key header.
+
+package rpc
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// A Folder holds a collection of feeds.
+type Folder struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Title         string                 `protobuf:"bytes,2,opt,name=title,proto3" json:"title,omitempty"`
+	Feeds         []*Feed                `protobuf:"bytes,3,rep,name=feeds,proto3" json:"feeds,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Folder) Reset() {
+	*x = Folder{}
+	mi := &file_hydrocarbon_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Folder) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Folder) ProtoMessage() {}
+
+func (x *Folder) ProtoReflect() protoreflect.Message {
+	mi := &file_hydrocarbon_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Folder.ProtoReflect.Descriptor instead.
+func (*Folder) Descriptor() ([]byte, []int) {
+	return file_hydrocarbon_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Folder) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Folder) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *Folder) GetFeeds() []*Feed {
+	if x != nil {
+		return x.Feeds
+	}
+	return nil
+}
+
+// A Feed is a collection of posts.
+type Feed struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Id        string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	CreatedAt *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	Title     string                 `protobuf:"bytes,4,opt,name=title,proto3" json:"title,omitempty"`
+	Plugin    string                 `protobuf:"bytes,5,opt,name=plugin,proto3" json:"plugin,omitempty"`
+	BaseUrl   string                 `protobuf:"bytes,6,opt,name=base_url,json=baseUrl,proto3" json:"base_url,omitempty"`
+	// status is pending until a scraping node finds the plugin of the feed,
+	// then active, or failed if none is found.
+	Status        string  `protobuf:"bytes,7,opt,name=status,proto3" json:"status,omitempty"`
+	ExternalId    string  `protobuf:"bytes,8,opt,name=external_id,json=externalId,proto3" json:"external_id,omitempty"`
+	Unread        int32   `protobuf:"varint,9,opt,name=unread,proto3" json:"unread,omitempty"`
+	Posts         []*Post `protobuf:"bytes,10,rep,name=posts,proto3" json:"posts,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Feed) Reset() {
+	*x = Feed{}
+	mi := &file_hydrocarbon_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Feed) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Feed) ProtoMessage() {}
+
+func (x *Feed) ProtoReflect() protoreflect.Message {
+	mi := &file_hydrocarbon_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Feed.ProtoReflect.Descriptor instead.
+func (*Feed) Descriptor() ([]byte, []int) {
+	return file_hydrocarbon_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Feed) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Feed) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Feed) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+func (x *Feed) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *Feed) GetPlugin() string {
+	if x != nil {
+		return x.Plugin
+	}
+	return ""
+}
+
+func (x *Feed) GetBaseUrl() string {
+	if x != nil {
+		return x.BaseUrl
+	}
+	return ""
+}
+
+func (x *Feed) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Feed) GetExternalId() string {
+	if x != nil {
+		return x.ExternalId
+	}
+	return ""
+}
+
+func (x *Feed) GetUnread() int32 {
+	if x != nil {
+		return x.Unread
+	}
+	return 0
+}
+
+func (x *Feed) GetPosts() []*Post {
+	if x != nil {
+		return x.Posts
+	}
+	return nil
+}
+
+// A Post is a single post on a feed.
+type Post struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Id          string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	CreatedAt   *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	PostedAt    *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=posted_at,json=postedAt,proto3" json:"posted_at,omitempty"`
+	UpdatedAt   *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	OriginalUrl string                 `protobuf:"bytes,5,opt,name=original_url,json=originalUrl,proto3" json:"original_url,omitempty"`
+	Url         string                 `protobuf:"bytes,6,opt,name=url,proto3" json:"url,omitempty"`
+	ExternalId  string                 `protobuf:"bytes,7,opt,name=external_id,json=externalId,proto3" json:"external_id,omitempty"`
+	Title       string                 `protobuf:"bytes,8,opt,name=title,proto3" json:"title,omitempty"`
+	Author      string                 `protobuf:"bytes,9,opt,name=author,proto3" json:"author,omitempty"`
+	// body is only sent by GetPost.
+	Body          string        `protobuf:"bytes,10,opt,name=body,proto3" json:"body,omitempty"`
+	License       string        `protobuf:"bytes,11,opt,name=license,proto3" json:"license,omitempty"`
+	Attribution   string        `protobuf:"bytes,12,opt,name=attribution,proto3" json:"attribution,omitempty"`
+	Read          bool          `protobuf:"varint,13,opt,name=read,proto3" json:"read,omitempty"`
+	Starred       bool          `protobuf:"varint,14,opt,name=starred,proto3" json:"starred,omitempty"`
+	Backfilled    bool          `protobuf:"varint,15,opt,name=backfilled,proto3" json:"backfilled,omitempty"`
+	Sources       []*PostSource `protobuf:"bytes,16,rep,name=sources,proto3" json:"sources,omitempty"`
+	Tags          []string      `protobuf:"bytes,17,rep,name=tags,proto3" json:"tags,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Post) Reset() {
+	*x = Post{}
+	mi := &file_hydrocarbon_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Post) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Post) ProtoMessage() {}
+
+func (x *Post) ProtoReflect() protoreflect.Message {
+	mi := &file_hydrocarbon_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Post.ProtoReflect.Descriptor instead.
+func (*Post) Descriptor() ([]byte, []int) {
+	return file_hydrocarbon_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Post) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Post) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Post) GetPostedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.PostedAt
+	}
+	return nil
+}
+
+func (x *Post) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+func (x *Post) GetOriginalUrl() string {
+	if x != nil {
+		return x.OriginalUrl
+	}
+	return ""
+}
+
+func (x *Post) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *Post) GetExternalId() string {
+	if x != nil {
+		return x.ExternalId
+	}
+	return ""
+}
+
+func (x *Post) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *Post) GetAuthor() string {
+	if x != nil {
+		return x.Author
+	}
+	return ""
+}
+
+func (x *Post) GetBody() string {
+	if x != nil {
+		return x.Body
+	}
+	return ""
+}
+
+func (x *Post) GetLicense() string {
+	if x != nil {
+		return x.License
+	}
+	return ""
+}
+
+func (x *Post) GetAttribution() string {
+	if x != nil {
+		return x.Attribution
+	}
+	return ""
+}
+
+func (x *Post) GetRead() bool {
+	if x != nil {
+		return x.Read
+	}
+	return false
+}
+
+func (x *Post) GetStarred() bool {
+	if x != nil {
+		return x.Starred
+	}
+	return false
+}
+
+func (x *Post) GetBackfilled() bool {
+	if x != nil {
+		return x.Backfilled
+	}
+	return false
+}
+
+func (x *Post) GetSources() []*PostSource {
+	if x != nil {
+		return x.Sources
+	}
+	return nil
+}
+
+func (x *Post) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+// A PostSource is another feed a near-duplicate of a post was seen in.
+type PostSource struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FeedId        string                 `protobuf:"bytes,1,opt,name=feed_id,json=feedId,proto3" json:"feed_id,omitempty"`
+	Url           string                 `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PostSource) Reset() {
+	*x = PostSource{}
+	mi := &file_hydrocarbon_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PostSource) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PostSource) ProtoMessage() {}
+
+func (x *PostSource) ProtoReflect() protoreflect.Message {
+	mi := &file_hydrocarbon_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PostSource.ProtoReflect.Descriptor instead.
+func (*PostSource) Descriptor() ([]byte, []int) {
+	return file_hydrocarbon_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *PostSource) GetFeedId() string {
+	if x != nil {
+		return x.FeedId
+	}
+	return ""
+}
+
+func (x *PostSource) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *PostSource) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+type ListFoldersRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListFoldersRequest) Reset() {
+	*x = ListFoldersRequest{}
+	mi := &file_hydrocarbon_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListFoldersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListFoldersRequest) ProtoMessage() {}
+
+func (x *ListFoldersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_hydrocarbon_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListFoldersRequest.ProtoReflect.Descriptor instead.
+func (*ListFoldersRequest) Descriptor() ([]byte, []int) {
+	return file_hydrocarbon_proto_rawDescGZIP(), []int{4}
+}
+
+type ListFoldersResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Folders       []*Folder              `protobuf:"bytes,1,rep,name=folders,proto3" json:"folders,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListFoldersResponse) Reset() {
+	*x = ListFoldersResponse{}
+	mi := &file_hydrocarbon_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListFoldersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListFoldersResponse) ProtoMessage() {}
+
+func (x *ListFoldersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_hydrocarbon_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListFoldersResponse.ProtoReflect.Descriptor instead.
+func (*ListFoldersResponse) Descriptor() ([]byte, []int) {
+	return file_hydrocarbon_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ListFoldersResponse) GetFolders() []*Folder {
+	if x != nil {
+		return x.Folders
+	}
+	return nil
+}
+
+type CreateFolderRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateFolderRequest) Reset() {
+	*x = CreateFolderRequest{}
+	mi := &file_hydrocarbon_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateFolderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateFolderRequest) ProtoMessage() {}
+
+func (x *CreateFolderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_hydrocarbon_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateFolderRequest.ProtoReflect.Descriptor instead.
+func (*CreateFolderRequest) Descriptor() ([]byte, []int) {
+	return file_hydrocarbon_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *CreateFolderRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type DeleteFolderRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FolderId      string                 `protobuf:"bytes,1,opt,name=folder_id,json=folderId,proto3" json:"folder_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteFolderRequest) Reset() {
+	*x = DeleteFolderRequest{}
+	mi := &file_hydrocarbon_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteFolderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteFolderRequest) ProtoMessage() {}
+
+func (x *DeleteFolderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_hydrocarbon_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteFolderRequest.ProtoReflect.Descriptor instead.
+func (*DeleteFolderRequest) Descriptor() ([]byte, []int) {
+	return file_hydrocarbon_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *DeleteFolderRequest) GetFolderId() string {
+	if x != nil {
+		return x.FolderId
+	}
+	return ""
+}
+
+type DeleteFolderResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteFolderResponse) Reset() {
+	*x = DeleteFolderResponse{}
+	mi := &file_hydrocarbon_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteFolderResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteFolderResponse) ProtoMessage() {}
+
+func (x *DeleteFolderResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_hydrocarbon_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteFolderResponse.ProtoReflect.Descriptor instead.
+func (*DeleteFolderResponse) Descriptor() ([]byte, []int) {
+	return file_hydrocarbon_proto_rawDescGZIP(), []int{8}
+}
+
+type RestoreFolderRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FolderId      string                 `protobuf:"bytes,1,opt,name=folder_id,json=folderId,proto3" json:"folder_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RestoreFolderRequest) Reset() {
+	*x = RestoreFolderRequest{}
+	mi := &file_hydrocarbon_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RestoreFolderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RestoreFolderRequest) ProtoMessage() {}
+
+func (x *RestoreFolderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_hydrocarbon_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RestoreFolderRequest.ProtoReflect.Descriptor instead.
+func (*RestoreFolderRequest) Descriptor() ([]byte, []int) {
+	return file_hydrocarbon_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *RestoreFolderRequest) GetFolderId() string {
+	if x != nil {
+		return x.FolderId
+	}
+	return ""
+}
+
+type RestoreFolderResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RestoreFolderResponse) Reset() {
+	*x = RestoreFolderResponse{}
+	mi := &file_hydrocarbon_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RestoreFolderResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RestoreFolderResponse) ProtoMessage() {}
+
+func (x *RestoreFolderResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_hydrocarbon_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RestoreFolderResponse.ProtoReflect.Descriptor instead.
+func (*RestoreFolderResponse) Descriptor() ([]byte, []int) {
+	return file_hydrocarbon_proto_rawDescGZIP(), []int{10}
+}
+
+type AddFeedRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FolderId      string                 `protobuf:"bytes,1,opt,name=folder_id,json=folderId,proto3" json:"folder_id,omitempty"`
+	Url           string                 `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddFeedRequest) Reset() {
+	*x = AddFeedRequest{}
+	mi := &file_hydrocarbon_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddFeedRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddFeedRequest) ProtoMessage() {}
+
+func (x *AddFeedRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_hydrocarbon_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddFeedRequest.ProtoReflect.Descriptor instead.
+func (*AddFeedRequest) Descriptor() ([]byte, []int) {
+	return file_hydrocarbon_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *AddFeedRequest) GetFolderId() string {
+	if x != nil {
+		return x.FolderId
+	}
+	return ""
+}
+
+func (x *AddFeedRequest) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+type RemoveFeedRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FolderId      string                 `protobuf:"bytes,1,opt,name=folder_id,json=folderId,proto3" json:"folder_id,omitempty"`
+	FeedId        string                 `protobuf:"bytes,2,opt,name=feed_id,json=feedId,proto3" json:"feed_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RemoveFeedRequest) Reset() {
+	*x = RemoveFeedRequest{}
+	mi := &file_hydrocarbon_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RemoveFeedRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoveFeedRequest) ProtoMessage() {}
+
+func (x *RemoveFeedRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_hydrocarbon_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoveFeedRequest.ProtoReflect.Descriptor instead.
+func (*RemoveFeedRequest) Descriptor() ([]byte, []int) {
+	return file_hydrocarbon_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *RemoveFeedRequest) GetFolderId() string {
+	if x != nil {
+		return x.FolderId
+	}
+	return ""
+}
+
+func (x *RemoveFeedRequest) GetFeedId() string {
+	if x != nil {
+		return x.FeedId
+	}
+	return ""
+}
+
+type RemoveFeedResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RemoveFeedResponse) Reset() {
+	*x = RemoveFeedResponse{}
+	mi := &file_hydrocarbon_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RemoveFeedResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoveFeedResponse) ProtoMessage() {}
+
+func (x *RemoveFeedResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_hydrocarbon_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoveFeedResponse.ProtoReflect.Descriptor instead.
+func (*RemoveFeedResponse) Descriptor() ([]byte, []int) {
+	return file_hydrocarbon_proto_rawDescGZIP(), []int{13}
+}
+
+type RefreshFeedRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FeedId        string                 `protobuf:"bytes,1,opt,name=feed_id,json=feedId,proto3" json:"feed_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RefreshFeedRequest) Reset() {
+	*x = RefreshFeedRequest{}
+	mi := &file_hydrocarbon_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RefreshFeedRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RefreshFeedRequest) ProtoMessage() {}
+
+func (x *RefreshFeedRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_hydrocarbon_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RefreshFeedRequest.ProtoReflect.Descriptor instead.
+func (*RefreshFeedRequest) Descriptor() ([]byte, []int) {
+	return file_hydrocarbon_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *RefreshFeedRequest) GetFeedId() string {
+	if x != nil {
+		return x.FeedId
+	}
+	return ""
+}
+
+type RefreshFeedResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RefreshFeedResponse) Reset() {
+	*x = RefreshFeedResponse{}
+	mi := &file_hydrocarbon_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RefreshFeedResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RefreshFeedResponse) ProtoMessage() {}
+
+func (x *RefreshFeedResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_hydrocarbon_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RefreshFeedResponse.ProtoReflect.Descriptor instead.
+func (*RefreshFeedResponse) Descriptor() ([]byte, []int) {
+	return file_hydrocarbon_proto_rawDescGZIP(), []int{15}
+}
+
+type ListPostsRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	FeedId string                 `protobuf:"bytes,1,opt,name=feed_id,json=feedId,proto3" json:"feed_id,omitempty"`
+	// limit is 50 if it is not set, and at least 10.
+	Limit         int32 `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	Offset        int32 `protobuf:"varint,3,opt,name=offset,proto3" json:"offset,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListPostsRequest) Reset() {
+	*x = ListPostsRequest{}
+	mi := &file_hydrocarbon_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListPostsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListPostsRequest) ProtoMessage() {}
+
+func (x *ListPostsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_hydrocarbon_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListPostsRequest.ProtoReflect.Descriptor instead.
+func (*ListPostsRequest) Descriptor() ([]byte, []int) {
+	return file_hydrocarbon_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *ListPostsRequest) GetFeedId() string {
+	if x != nil {
+		return x.FeedId
+	}
+	return ""
+}
+
+func (x *ListPostsRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *ListPostsRequest) GetOffset() int32 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+type GetPostRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	PostId        string                 `protobuf:"bytes,1,opt,name=post_id,json=postId,proto3" json:"post_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPostRequest) Reset() {
+	*x = GetPostRequest{}
+	mi := &file_hydrocarbon_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPostRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPostRequest) ProtoMessage() {}
+
+func (x *GetPostRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_hydrocarbon_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPostRequest.ProtoReflect.Descriptor instead.
+func (*GetPostRequest) Descriptor() ([]byte, []int) {
+	return file_hydrocarbon_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *GetPostRequest) GetPostId() string {
+	if x != nil {
+		return x.PostId
+	}
+	return ""
+}
+
+type MarkReadRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	PostId        string                 `protobuf:"bytes,1,opt,name=post_id,json=postId,proto3" json:"post_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MarkReadRequest) Reset() {
+	*x = MarkReadRequest{}
+	mi := &file_hydrocarbon_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MarkReadRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MarkReadRequest) ProtoMessage() {}
+
+func (x *MarkReadRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_hydrocarbon_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MarkReadRequest.ProtoReflect.Descriptor instead.
+func (*MarkReadRequest) Descriptor() ([]byte, []int) {
+	return file_hydrocarbon_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *MarkReadRequest) GetPostId() string {
+	if x != nil {
+		return x.PostId
+	}
+	return ""
+}
+
+type MarkReadResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MarkReadResponse) Reset() {
+	*x = MarkReadResponse{}
+	mi := &file_hydrocarbon_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MarkReadResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MarkReadResponse) ProtoMessage() {}
+
+func (x *MarkReadResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_hydrocarbon_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MarkReadResponse.ProtoReflect.Descriptor instead.
+func (*MarkReadResponse) Descriptor() ([]byte, []int) {
+	return file_hydrocarbon_proto_rawDescGZIP(), []int{19}
+}
+
+type StarPostRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	PostId        string                 `protobuf:"bytes,1,opt,name=post_id,json=postId,proto3" json:"post_id,omitempty"`
+	Starred       bool                   `protobuf:"varint,2,opt,name=starred,proto3" json:"starred,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StarPostRequest) Reset() {
+	*x = StarPostRequest{}
+	mi := &file_hydrocarbon_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StarPostRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StarPostRequest) ProtoMessage() {}
+
+func (x *StarPostRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_hydrocarbon_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StarPostRequest.ProtoReflect.Descriptor instead.
+func (*StarPostRequest) Descriptor() ([]byte, []int) {
+	return file_hydrocarbon_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *StarPostRequest) GetPostId() string {
+	if x != nil {
+		return x.PostId
+	}
+	return ""
+}
+
+func (x *StarPostRequest) GetStarred() bool {
+	if x != nil {
+		return x.Starred
+	}
+	return false
+}
+
+type StarPostResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StarPostResponse) Reset() {
+	*x = StarPostResponse{}
+	mi := &file_hydrocarbon_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StarPostResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StarPostResponse) ProtoMessage() {}
+
+func (x *StarPostResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_hydrocarbon_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StarPostResponse.ProtoReflect.Descriptor instead.
+func (*StarPostResponse) Descriptor() ([]byte, []int) {
+	return file_hydrocarbon_proto_rawDescGZIP(), []int{21}
+}
+
+var File_hydrocarbon_proto protoreflect.FileDescriptor
+
+const file_hydrocarbon_proto_rawDesc = "" +
+	"\n" +
+	"\x11hydrocarbon.proto\x12\x0ehydrocarbon.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"Z\n" +
+	"\x06Folder\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x14\n" +
+	"\x05title\x18\x02 \x01(\tR\x05title\x12*\n" +
+	"\x05feeds\x18\x03 \x03(\v2\x14.hydrocarbon.v1.FeedR\x05feeds\"\xd2\x02\n" +
+	"\x04Feed\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x129\n" +
+	"\n" +
+	"created_at\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
+	"\n" +
+	"updated_at\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\x12\x14\n" +
+	"\x05title\x18\x04 \x01(\tR\x05title\x12\x16\n" +
+	"\x06plugin\x18\x05 \x01(\tR\x06plugin\x12\x19\n" +
+	"\bbase_url\x18\x06 \x01(\tR\abaseUrl\x12\x16\n" +
+	"\x06status\x18\a \x01(\tR\x06status\x12\x1f\n" +
+	"\vexternal_id\x18\b \x01(\tR\n" +
+	"externalId\x12\x16\n" +
+	"\x06unread\x18\t \x01(\x05R\x06unread\x12*\n" +
+	"\x05posts\x18\n" +
+	" \x03(\v2\x14.hydrocarbon.v1.PostR\x05posts\"\xb1\x04\n" +
+	"\x04Post\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x129\n" +
+	"\n" +
+	"created_at\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x127\n" +
+	"\tposted_at\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\bpostedAt\x129\n" +
+	"\n" +
+	"updated_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\x12!\n" +
+	"\foriginal_url\x18\x05 \x01(\tR\voriginalUrl\x12\x10\n" +
+	"\x03url\x18\x06 \x01(\tR\x03url\x12\x1f\n" +
+	"\vexternal_id\x18\a \x01(\tR\n" +
+	"externalId\x12\x14\n" +
+	"\x05title\x18\b \x01(\tR\x05title\x12\x16\n" +
+	"\x06author\x18\t \x01(\tR\x06author\x12\x12\n" +
+	"\x04body\x18\n" +
+	" \x01(\tR\x04body\x12\x18\n" +
+	"\alicense\x18\v \x01(\tR\alicense\x12 \n" +
+	"\vattribution\x18\f \x01(\tR\vattribution\x12\x12\n" +
+	"\x04read\x18\r \x01(\bR\x04read\x12\x18\n" +
+	"\astarred\x18\x0e \x01(\bR\astarred\x12\x1e\n" +
+	"\n" +
+	"backfilled\x18\x0f \x01(\bR\n" +
+	"backfilled\x124\n" +
+	"\asources\x18\x10 \x03(\v2\x1a.hydrocarbon.v1.PostSourceR\asources\x12\x12\n" +
+	"\x04tags\x18\x11 \x03(\tR\x04tags\"r\n" +
+	"\n" +
+	"PostSource\x12\x17\n" +
+	"\afeed_id\x18\x01 \x01(\tR\x06feedId\x12\x10\n" +
+	"\x03url\x18\x02 \x01(\tR\x03url\x129\n" +
+	"\n" +
+	"created_at\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\"\x14\n" +
+	"\x12ListFoldersRequest\"G\n" +
+	"\x13ListFoldersResponse\x120\n" +
+	"\afolders\x18\x01 \x03(\v2\x16.hydrocarbon.v1.FolderR\afolders\")\n" +
+	"\x13CreateFolderRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\"2\n" +
+	"\x13DeleteFolderRequest\x12\x1b\n" +
+	"\tfolder_id\x18\x01 \x01(\tR\bfolderId\"\x16\n" +
+	"\x14DeleteFolderResponse\"3\n" +
+	"\x14RestoreFolderRequest\x12\x1b\n" +
+	"\tfolder_id\x18\x01 \x01(\tR\bfolderId\"\x17\n" +
+	"\x15RestoreFolderResponse\"?\n" +
+	"\x0eAddFeedRequest\x12\x1b\n" +
+	"\tfolder_id\x18\x01 \x01(\tR\bfolderId\x12\x10\n" +
+	"\x03url\x18\x02 \x01(\tR\x03url\"I\n" +
+	"\x11RemoveFeedRequest\x12\x1b\n" +
+	"\tfolder_id\x18\x01 \x01(\tR\bfolderId\x12\x17\n" +
+	"\afeed_id\x18\x02 \x01(\tR\x06feedId\"\x14\n" +
+	"\x12RemoveFeedResponse\"-\n" +
+	"\x12RefreshFeedRequest\x12\x17\n" +
+	"\afeed_id\x18\x01 \x01(\tR\x06feedId\"\x15\n" +
+	"\x13RefreshFeedResponse\"Y\n" +
+	"\x10ListPostsRequest\x12\x17\n" +
+	"\afeed_id\x18\x01 \x01(\tR\x06feedId\x12\x14\n" +
+	"\x05limit\x18\x02 \x01(\x05R\x05limit\x12\x16\n" +
+	"\x06offset\x18\x03 \x01(\x05R\x06offset\")\n" +
+	"\x0eGetPostRequest\x12\x17\n" +
+	"\apost_id\x18\x01 \x01(\tR\x06postId\"*\n" +
+	"\x0fMarkReadRequest\x12\x17\n" +
+	"\apost_id\x18\x01 \x01(\tR\x06postId\"\x12\n" +
+	"\x10MarkReadResponse\"D\n" +
+	"\x0fStarPostRequest\x12\x17\n" +
+	"\apost_id\x18\x01 \x01(\tR\x06postId\x12\x18\n" +
+	"\astarred\x18\x02 \x01(\bR\astarred\"\x12\n" +
+	"\x10StarPostResponse2\xd3\x04\n" +
+	"\x05Feeds\x12V\n" +
+	"\vListFolders\x12\".hydrocarbon.v1.ListFoldersRequest\x1a#.hydrocarbon.v1.ListFoldersResponse\x12K\n" +
+	"\fCreateFolder\x12#.hydrocarbon.v1.CreateFolderRequest\x1a\x16.hydrocarbon.v1.Folder\x12Y\n" +
+	"\fDeleteFolder\x12#.hydrocarbon.v1.DeleteFolderRequest\x1a$.hydrocarbon.v1.DeleteFolderResponse\x12\\\n" +
+	"\rRestoreFolder\x12$.hydrocarbon.v1.RestoreFolderRequest\x1a%.hydrocarbon.v1.RestoreFolderResponse\x12?\n" +
+	"\aAddFeed\x12\x1e.hydrocarbon.v1.AddFeedRequest\x1a\x14.hydrocarbon.v1.Feed\x12S\n" +
+	"\n" +
+	"RemoveFeed\x12!.hydrocarbon.v1.RemoveFeedRequest\x1a\".hydrocarbon.v1.RemoveFeedResponse\x12V\n" +
+	"\vRefreshFeed\x12\".hydrocarbon.v1.RefreshFeedRequest\x1a#.hydrocarbon.v1.RefreshFeedResponse2\xad\x02\n" +
+	"\aReading\x12C\n" +
+	"\tListPosts\x12 .hydrocarbon.v1.ListPostsRequest\x1a\x14.hydrocarbon.v1.Feed\x12?\n" +
+	"\aGetPost\x12\x1e.hydrocarbon.v1.GetPostRequest\x1a\x14.hydrocarbon.v1.Post\x12M\n" +
+	"\bMarkRead\x12\x1f.hydrocarbon.v1.MarkReadRequest\x1a .hydrocarbon.v1.MarkReadResponse\x12M\n" +
+	"\bStarPost\x12\x1f.hydrocarbon.v1.StarPostRequest\x1a .hydrocarbon.v1.StarPostResponseB%Z#github.com/fortytw2/hydrocarbon/rpcb\x06proto3"
+
+var (
+	file_hydrocarbon_proto_rawDescOnce sync.Once
+	file_hydrocarbon_proto_rawDescData []byte
+)
+
+func file_hydrocarbon_proto_rawDescGZIP() []byte {
+	file_hydrocarbon_proto_rawDescOnce.Do(func() {
+		file_hydrocarbon_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_hydrocarbon_proto_rawDesc), len(file_hydrocarbon_proto_rawDesc)))
+	})
+	return file_hydrocarbon_proto_rawDescData
+}
+
+var file_hydrocarbon_proto_msgTypes = make([]protoimpl.MessageInfo, 22)
+var file_hydrocarbon_proto_goTypes = []any{
+	(*Folder)(nil),                // 0: hydrocarbon.v1.Folder
+	(*Feed)(nil),                  // 1: hydrocarbon.v1.Feed
+	(*Post)(nil),                  // 2: hydrocarbon.v1.Post
+	(*PostSource)(nil),            // 3: hydrocarbon.v1.PostSource
+	(*ListFoldersRequest)(nil),    // 4: hydrocarbon.v1.ListFoldersRequest
+	(*ListFoldersResponse)(nil),   // 5: hydrocarbon.v1.ListFoldersResponse
+	(*CreateFolderRequest)(nil),   // 6: hydrocarbon.v1.CreateFolderRequest
+	(*DeleteFolderRequest)(nil),   // 7: hydrocarbon.v1.DeleteFolderRequest
+	(*DeleteFolderResponse)(nil),  // 8: hydrocarbon.v1.DeleteFolderResponse
+	(*RestoreFolderRequest)(nil),  // 9: hydrocarbon.v1.RestoreFolderRequest
+	(*RestoreFolderResponse)(nil), // 10: hydrocarbon.v1.RestoreFolderResponse
+	(*AddFeedRequest)(nil),        // 11: hydrocarbon.v1.AddFeedRequest
+	(*RemoveFeedRequest)(nil),     // 12: hydrocarbon.v1.RemoveFeedRequest
+	(*RemoveFeedResponse)(nil),    // 13: hydrocarbon.v1.RemoveFeedResponse
+	(*RefreshFeedRequest)(nil),    // 14: hydrocarbon.v1.RefreshFeedRequest
+	(*RefreshFeedResponse)(nil),   // 15: hydrocarbon.v1.RefreshFeedResponse
+	(*ListPostsRequest)(nil),      // 16: hydrocarbon.v1.ListPostsRequest
+	(*GetPostRequest)(nil),        // 17: hydrocarbon.v1.GetPostRequest
+	(*MarkReadRequest)(nil),       // 18: hydrocarbon.v1.MarkReadRequest
+	(*MarkReadResponse)(nil),      // 19: hydrocarbon.v1.MarkReadResponse
+	(*StarPostRequest)(nil),       // 20: hydrocarbon.v1.StarPostRequest
+	(*StarPostResponse)(nil),      // 21: hydrocarbon.v1.StarPostResponse
+	(*timestamppb.Timestamp)(nil), // 22: google.protobuf.Timestamp
+}
+var file_hydrocarbon_proto_depIdxs = []int32{
+	1,  // 0: hydrocarbon.v1.Folder.feeds:type_name -> hydrocarbon.v1.Feed
+	22, // 1: hydrocarbon.v1.Feed.created_at:type_name -> google.protobuf.Timestamp
+	22, // 2: hydrocarbon.v1.Feed.updated_at:type_name -> google.protobuf.Timestamp
+	2,  // 3: hydrocarbon.v1.Feed.posts:type_name -> hydrocarbon.v1.Post
+	22, // 4: hydrocarbon.v1.Post.created_at:type_name -> google.protobuf.Timestamp
+	22, // 5: hydrocarbon.v1.Post.posted_at:type_name -> google.protobuf.Timestamp
+	22, // 6: hydrocarbon.v1.Post.updated_at:type_name -> google.protobuf.Timestamp
+	3,  // 7: hydrocarbon.v1.Post.sources:type_name -> hydrocarbon.v1.PostSource
+	22, // 8: hydrocarbon.v1.PostSource.created_at:type_name -> google.protobuf.Timestamp
+	0,  // 9: hydrocarbon.v1.ListFoldersResponse.folders:type_name -> hydrocarbon.v1.Folder
+	4,  // 10: hydrocarbon.v1.Feeds.ListFolders:input_type -> hydrocarbon.v1.ListFoldersRequest
+	6,  // 11: hydrocarbon.v1.Feeds.CreateFolder:input_type -> hydrocarbon.v1.CreateFolderRequest
+	7,  // 12: hydrocarbon.v1.Feeds.DeleteFolder:input_type -> hydrocarbon.v1.DeleteFolderRequest
+	9,  // 13: hydrocarbon.v1.Feeds.RestoreFolder:input_type -> hydrocarbon.v1.RestoreFolderRequest
+	11, // 14: hydrocarbon.v1.Feeds.AddFeed:input_type -> hydrocarbon.v1.AddFeedRequest
+	12, // 15: hydrocarbon.v1.Feeds.RemoveFeed:input_type -> hydrocarbon.v1.RemoveFeedRequest
+	14, // 16: hydrocarbon.v1.Feeds.RefreshFeed:input_type -> hydrocarbon.v1.RefreshFeedRequest
+	16, // 17: hydrocarbon.v1.Reading.ListPosts:input_type -> hydrocarbon.v1.ListPostsRequest
+	17, // 18: hydrocarbon.v1.Reading.GetPost:input_type -> hydrocarbon.v1.GetPostRequest
+	18, // 19: hydrocarbon.v1.Reading.MarkRead:input_type -> hydrocarbon.v1.MarkReadRequest
+	20, // 20: hydrocarbon.v1.Reading.StarPost:input_type -> hydrocarbon.v1.StarPostRequest
+	5,  // 21: hydrocarbon.v1.Feeds.ListFolders:output_type -> hydrocarbon.v1.ListFoldersResponse
+	0,  // 22: hydrocarbon.v1.Feeds.CreateFolder:output_type -> hydrocarbon.v1.Folder
+	8,  // 23: hydrocarbon.v1.Feeds.DeleteFolder:output_type -> hydrocarbon.v1.DeleteFolderResponse
+	10, // 24: hydrocarbon.v1.Feeds.RestoreFolder:output_type -> hydrocarbon.v1.RestoreFolderResponse
+	1,  // 25: hydrocarbon.v1.Feeds.AddFeed:output_type -> hydrocarbon.v1.Feed
+	13, // 26: hydrocarbon.v1.Feeds.RemoveFeed:output_type -> hydrocarbon.v1.RemoveFeedResponse
+	15, // 27: hydrocarbon.v1.Feeds.RefreshFeed:output_type -> hydrocarbon.v1.RefreshFeedResponse
+	1,  // 28: hydrocarbon.v1.Reading.ListPosts:output_type -> hydrocarbon.v1.Feed
+	2,  // 29: hydrocarbon.v1.Reading.GetPost:output_type -> hydrocarbon.v1.Post
+	19, // 30: hydrocarbon.v1.Reading.MarkRead:output_type -> hydrocarbon.v1.MarkReadResponse
+	21, // 31: hydrocarbon.v1.Reading.StarPost:output_type -> hydrocarbon.v1.StarPostResponse
+	21, // [21:32] is the sub-list for method output_type
+	10, // [10:21] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
+}
+
+func init() { file_hydrocarbon_proto_init() }
+func file_hydrocarbon_proto_init() {
+	if File_hydrocarbon_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_hydrocarbon_proto_rawDesc), len(file_hydrocarbon_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   22,
+			NumExtensions: 0,
+			NumServices:   2,
+		},
+		GoTypes:           file_hydrocarbon_proto_goTypes,
+		DependencyIndexes: file_hydrocarbon_proto_depIdxs,
+		MessageInfos:      file_hydrocarbon_proto_msgTypes,
+	}.Build()
+	File_hydrocarbon_proto = out.File
+	file_hydrocarbon_proto_goTypes = nil
+	file_hydrocarbon_proto_depIdxs = nil
+}
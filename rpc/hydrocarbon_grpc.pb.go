@@ -0,0 +1,591 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: hydrocarbon.proto
+
+// hydrocarbon.v1 is the gRPC api of hydrocarbon, for native clients. Every call
+// is made with the signed session key of the user in the x-hydrocarbon-key
+// metadata, as the http api is with the X-Hydrocarbon-Key header.
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Feeds_ListFolders_FullMethodName   = "/hydrocarbon.v1.Feeds/ListFolders"
+	Feeds_CreateFolder_FullMethodName  = "/hydrocarbon.v1.Feeds/CreateFolder"
+	Feeds_DeleteFolder_FullMethodName  = "/hydrocarbon.v1.Feeds/DeleteFolder"
+	Feeds_RestoreFolder_FullMethodName = "/hydrocarbon.v1.Feeds/RestoreFolder"
+	Feeds_AddFeed_FullMethodName       = "/hydrocarbon.v1.Feeds/AddFeed"
+	Feeds_RemoveFeed_FullMethodName    = "/hydrocarbon.v1.Feeds/RemoveFeed"
+	Feeds_RefreshFeed_FullMethodName   = "/hydrocarbon.v1.Feeds/RefreshFeed"
+)
+
+// FeedsClient is the client API for Feeds service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Feeds manages the folders of a user and the feeds in them.
+type FeedsClient interface {
+	// ListFolders lists the folders of the user with their feeds, without posts.
+	ListFolders(ctx context.Context, in *ListFoldersRequest, opts ...grpc.CallOption) (*ListFoldersResponse, error)
+	CreateFolder(ctx context.Context, in *CreateFolderRequest, opts ...grpc.CallOption) (*Folder, error)
+	// DeleteFolder hides a folder and its feeds until it is restored or purged.
+	DeleteFolder(ctx context.Context, in *DeleteFolderRequest, opts ...grpc.CallOption) (*DeleteFolderResponse, error)
+	RestoreFolder(ctx context.Context, in *RestoreFolderRequest, opts ...grpc.CallOption) (*RestoreFolderResponse, error)
+	// AddFeed finds the plugin for a url and follows the feed it gives, in the
+	// folder given or the default folder.
+	AddFeed(ctx context.Context, in *AddFeedRequest, opts ...grpc.CallOption) (*Feed, error)
+	RemoveFeed(ctx context.Context, in *RemoveFeedRequest, opts ...grpc.CallOption) (*RemoveFeedResponse, error)
+	// RefreshFeed scrapes a feed ahead of its next scheduled scrape.
+	RefreshFeed(ctx context.Context, in *RefreshFeedRequest, opts ...grpc.CallOption) (*RefreshFeedResponse, error)
+}
+
+type feedsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFeedsClient(cc grpc.ClientConnInterface) FeedsClient {
+	return &feedsClient{cc}
+}
+
+func (c *feedsClient) ListFolders(ctx context.Context, in *ListFoldersRequest, opts ...grpc.CallOption) (*ListFoldersResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListFoldersResponse)
+	err := c.cc.Invoke(ctx, Feeds_ListFolders_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *feedsClient) CreateFolder(ctx context.Context, in *CreateFolderRequest, opts ...grpc.CallOption) (*Folder, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Folder)
+	err := c.cc.Invoke(ctx, Feeds_CreateFolder_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *feedsClient) DeleteFolder(ctx context.Context, in *DeleteFolderRequest, opts ...grpc.CallOption) (*DeleteFolderResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteFolderResponse)
+	err := c.cc.Invoke(ctx, Feeds_DeleteFolder_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *feedsClient) RestoreFolder(ctx context.Context, in *RestoreFolderRequest, opts ...grpc.CallOption) (*RestoreFolderResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RestoreFolderResponse)
+	err := c.cc.Invoke(ctx, Feeds_RestoreFolder_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *feedsClient) AddFeed(ctx context.Context, in *AddFeedRequest, opts ...grpc.CallOption) (*Feed, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Feed)
+	err := c.cc.Invoke(ctx, Feeds_AddFeed_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *feedsClient) RemoveFeed(ctx context.Context, in *RemoveFeedRequest, opts ...grpc.CallOption) (*RemoveFeedResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RemoveFeedResponse)
+	err := c.cc.Invoke(ctx, Feeds_RemoveFeed_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *feedsClient) RefreshFeed(ctx context.Context, in *RefreshFeedRequest, opts ...grpc.CallOption) (*RefreshFeedResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RefreshFeedResponse)
+	err := c.cc.Invoke(ctx, Feeds_RefreshFeed_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// FeedsServer is the server API for Feeds service.
+// All implementations must embed UnimplementedFeedsServer
+// for forward compatibility.
+//
+// Feeds manages the folders of a user and the feeds in them.
+type FeedsServer interface {
+	// ListFolders lists the folders of the user with their feeds, without posts.
+	ListFolders(context.Context, *ListFoldersRequest) (*ListFoldersResponse, error)
+	CreateFolder(context.Context, *CreateFolderRequest) (*Folder, error)
+	// DeleteFolder hides a folder and its feeds until it is restored or purged.
+	DeleteFolder(context.Context, *DeleteFolderRequest) (*DeleteFolderResponse, error)
+	RestoreFolder(context.Context, *RestoreFolderRequest) (*RestoreFolderResponse, error)
+	// AddFeed finds the plugin for a url and follows the feed it gives, in the
+	// folder given or the default folder.
+	AddFeed(context.Context, *AddFeedRequest) (*Feed, error)
+	RemoveFeed(context.Context, *RemoveFeedRequest) (*RemoveFeedResponse, error)
+	// RefreshFeed scrapes a feed ahead of its next scheduled scrape.
+	RefreshFeed(context.Context, *RefreshFeedRequest) (*RefreshFeedResponse, error)
+	mustEmbedUnimplementedFeedsServer()
+}
+
+// UnimplementedFeedsServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedFeedsServer struct{}
+
+func (UnimplementedFeedsServer) ListFolders(context.Context, *ListFoldersRequest) (*ListFoldersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListFolders not implemented")
+}
+func (UnimplementedFeedsServer) CreateFolder(context.Context, *CreateFolderRequest) (*Folder, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateFolder not implemented")
+}
+func (UnimplementedFeedsServer) DeleteFolder(context.Context, *DeleteFolderRequest) (*DeleteFolderResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteFolder not implemented")
+}
+func (UnimplementedFeedsServer) RestoreFolder(context.Context, *RestoreFolderRequest) (*RestoreFolderResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RestoreFolder not implemented")
+}
+func (UnimplementedFeedsServer) AddFeed(context.Context, *AddFeedRequest) (*Feed, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddFeed not implemented")
+}
+func (UnimplementedFeedsServer) RemoveFeed(context.Context, *RemoveFeedRequest) (*RemoveFeedResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveFeed not implemented")
+}
+func (UnimplementedFeedsServer) RefreshFeed(context.Context, *RefreshFeedRequest) (*RefreshFeedResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RefreshFeed not implemented")
+}
+func (UnimplementedFeedsServer) mustEmbedUnimplementedFeedsServer() {}
+func (UnimplementedFeedsServer) testEmbeddedByValue()               {}
+
+// UnsafeFeedsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FeedsServer will
+// result in compilation errors.
+type UnsafeFeedsServer interface {
+	mustEmbedUnimplementedFeedsServer()
+}
+
+func RegisterFeedsServer(s grpc.ServiceRegistrar, srv FeedsServer) {
+	// If the following call pancis, it indicates UnimplementedFeedsServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Feeds_ServiceDesc, srv)
+}
+
+func _Feeds_ListFolders_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListFoldersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FeedsServer).ListFolders(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Feeds_ListFolders_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FeedsServer).ListFolders(ctx, req.(*ListFoldersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Feeds_CreateFolder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateFolderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FeedsServer).CreateFolder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Feeds_CreateFolder_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FeedsServer).CreateFolder(ctx, req.(*CreateFolderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Feeds_DeleteFolder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteFolderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FeedsServer).DeleteFolder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Feeds_DeleteFolder_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FeedsServer).DeleteFolder(ctx, req.(*DeleteFolderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Feeds_RestoreFolder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreFolderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FeedsServer).RestoreFolder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Feeds_RestoreFolder_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FeedsServer).RestoreFolder(ctx, req.(*RestoreFolderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Feeds_AddFeed_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddFeedRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FeedsServer).AddFeed(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Feeds_AddFeed_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FeedsServer).AddFeed(ctx, req.(*AddFeedRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Feeds_RemoveFeed_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveFeedRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FeedsServer).RemoveFeed(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Feeds_RemoveFeed_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FeedsServer).RemoveFeed(ctx, req.(*RemoveFeedRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Feeds_RefreshFeed_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RefreshFeedRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FeedsServer).RefreshFeed(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Feeds_RefreshFeed_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FeedsServer).RefreshFeed(ctx, req.(*RefreshFeedRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Feeds_ServiceDesc is the grpc.ServiceDesc for Feeds service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Feeds_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "hydrocarbon.v1.Feeds",
+	HandlerType: (*FeedsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListFolders",
+			Handler:    _Feeds_ListFolders_Handler,
+		},
+		{
+			MethodName: "CreateFolder",
+			Handler:    _Feeds_CreateFolder_Handler,
+		},
+		{
+			MethodName: "DeleteFolder",
+			Handler:    _Feeds_DeleteFolder_Handler,
+		},
+		{
+			MethodName: "RestoreFolder",
+			Handler:    _Feeds_RestoreFolder_Handler,
+		},
+		{
+			MethodName: "AddFeed",
+			Handler:    _Feeds_AddFeed_Handler,
+		},
+		{
+			MethodName: "RemoveFeed",
+			Handler:    _Feeds_RemoveFeed_Handler,
+		},
+		{
+			MethodName: "RefreshFeed",
+			Handler:    _Feeds_RefreshFeed_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "hydrocarbon.proto",
+}
+
+const (
+	Reading_ListPosts_FullMethodName = "/hydrocarbon.v1.Reading/ListPosts"
+	Reading_GetPost_FullMethodName   = "/hydrocarbon.v1.Reading/GetPost"
+	Reading_MarkRead_FullMethodName  = "/hydrocarbon.v1.Reading/MarkRead"
+	Reading_StarPost_FullMethodName  = "/hydrocarbon.v1.Reading/StarPost"
+)
+
+// ReadingClient is the client API for Reading service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Reading reads the posts of the feeds a user follows.
+type ReadingClient interface {
+	// ListPosts lists the posts of a feed, newest first, without their bodies.
+	ListPosts(ctx context.Context, in *ListPostsRequest, opts ...grpc.CallOption) (*Feed, error)
+	GetPost(ctx context.Context, in *GetPostRequest, opts ...grpc.CallOption) (*Post, error)
+	MarkRead(ctx context.Context, in *MarkReadRequest, opts ...grpc.CallOption) (*MarkReadResponse, error)
+	// StarPost stars or unstars a post, starred posts are never pruned.
+	StarPost(ctx context.Context, in *StarPostRequest, opts ...grpc.CallOption) (*StarPostResponse, error)
+}
+
+type readingClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewReadingClient(cc grpc.ClientConnInterface) ReadingClient {
+	return &readingClient{cc}
+}
+
+func (c *readingClient) ListPosts(ctx context.Context, in *ListPostsRequest, opts ...grpc.CallOption) (*Feed, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Feed)
+	err := c.cc.Invoke(ctx, Reading_ListPosts_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *readingClient) GetPost(ctx context.Context, in *GetPostRequest, opts ...grpc.CallOption) (*Post, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Post)
+	err := c.cc.Invoke(ctx, Reading_GetPost_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *readingClient) MarkRead(ctx context.Context, in *MarkReadRequest, opts ...grpc.CallOption) (*MarkReadResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MarkReadResponse)
+	err := c.cc.Invoke(ctx, Reading_MarkRead_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *readingClient) StarPost(ctx context.Context, in *StarPostRequest, opts ...grpc.CallOption) (*StarPostResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StarPostResponse)
+	err := c.cc.Invoke(ctx, Reading_StarPost_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ReadingServer is the server API for Reading service.
+// All implementations must embed UnimplementedReadingServer
+// for forward compatibility.
+//
+// Reading reads the posts of the feeds a user follows.
+type ReadingServer interface {
+	// ListPosts lists the posts of a feed, newest first, without their bodies.
+	ListPosts(context.Context, *ListPostsRequest) (*Feed, error)
+	GetPost(context.Context, *GetPostRequest) (*Post, error)
+	MarkRead(context.Context, *MarkReadRequest) (*MarkReadResponse, error)
+	// StarPost stars or unstars a post, starred posts are never pruned.
+	StarPost(context.Context, *StarPostRequest) (*StarPostResponse, error)
+	mustEmbedUnimplementedReadingServer()
+}
+
+// UnimplementedReadingServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedReadingServer struct{}
+
+func (UnimplementedReadingServer) ListPosts(context.Context, *ListPostsRequest) (*Feed, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListPosts not implemented")
+}
+func (UnimplementedReadingServer) GetPost(context.Context, *GetPostRequest) (*Post, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPost not implemented")
+}
+func (UnimplementedReadingServer) MarkRead(context.Context, *MarkReadRequest) (*MarkReadResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MarkRead not implemented")
+}
+func (UnimplementedReadingServer) StarPost(context.Context, *StarPostRequest) (*StarPostResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StarPost not implemented")
+}
+func (UnimplementedReadingServer) mustEmbedUnimplementedReadingServer() {}
+func (UnimplementedReadingServer) testEmbeddedByValue()                 {}
+
+// UnsafeReadingServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ReadingServer will
+// result in compilation errors.
+type UnsafeReadingServer interface {
+	mustEmbedUnimplementedReadingServer()
+}
+
+func RegisterReadingServer(s grpc.ServiceRegistrar, srv ReadingServer) {
+	// If the following call pancis, it indicates UnimplementedReadingServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Reading_ServiceDesc, srv)
+}
+
+func _Reading_ListPosts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPostsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReadingServer).ListPosts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Reading_ListPosts_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReadingServer).ListPosts(ctx, req.(*ListPostsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Reading_GetPost_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPostRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReadingServer).GetPost(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Reading_GetPost_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReadingServer).GetPost(ctx, req.(*GetPostRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Reading_MarkRead_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MarkReadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReadingServer).MarkRead(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Reading_MarkRead_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReadingServer).MarkRead(ctx, req.(*MarkReadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Reading_StarPost_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StarPostRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReadingServer).StarPost(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Reading_StarPost_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReadingServer).StarPost(ctx, req.(*StarPostRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Reading_ServiceDesc is the grpc.ServiceDesc for Reading service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Reading_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "hydrocarbon.v1.Reading",
+	HandlerType: (*ReadingServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListPosts",
+			Handler:    _Reading_ListPosts_Handler,
+		},
+		{
+			MethodName: "GetPost",
+			Handler:    _Reading_GetPost_Handler,
+		},
+		{
+			MethodName: "MarkRead",
+			Handler:    _Reading_MarkRead_Handler,
+		},
+		{
+			MethodName: "StarPost",
+			Handler:    _Reading_StarPost_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "hydrocarbon.proto",
+}
@@ -0,0 +1,90 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// BlobStore keeps post bodies in an S3 compatible bucket, which should not be
+// public. It is addressed and signed as a FileStore is
+type BlobStore struct {
+	fs *FileStore
+}
+
+// NewBlobStore returns a BlobStore for bucket, endpoint may be empty to use AWS
+func NewBlobStore(endpoint, region, bucket, accessKey, secretKey string) (*BlobStore, error) {
+	fs, err := NewFileStore(endpoint, region, bucket, accessKey, secretKey, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &BlobStore{fs: fs}, nil
+}
+
+// do makes a signed request for the object at key
+func (bs *BlobStore) do(ctx context.Context, method, key string, payload []byte) (*http.Response, error) {
+	u := *bs.fs.endpoint
+	u.Path = "/" + bs.fs.bucket + "/" + key
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	bs.fs.sign(req, payload, time.Now().UTC())
+
+	return bs.fs.client.Do(req.WithContext(ctx))
+}
+
+// PutBlob uploads contents to key
+func (bs *BlobStore) PutBlob(ctx context.Context, key string, contents []byte) error {
+	resp, err := bs.do(ctx, http.MethodPut, key, contents)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("s3: put %s returned %d: %s", key, resp.StatusCode, msg)
+	}
+
+	return nil
+}
+
+// GetBlob streams the object at key, the caller closes it
+func (bs *BlobStore) GetBlob(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := bs.do(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("s3: get %s returned %d: %s", key, resp.StatusCode, msg)
+	}
+
+	return resp.Body, nil
+}
+
+// DeleteBlob deletes the object at key, S3 does not mind if there is none
+func (bs *BlobStore) DeleteBlob(ctx context.Context, key string) error {
+	resp, err := bs.do(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("s3: delete %s returned %d: %s", key, resp.StatusCode, msg)
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// FileStore stores images in an S3 compatible bucket, signing requests with
+// AWS signature version 4
+type FileStore struct {
+	client *http.Client
+
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+
+	// publicURL is the prefix images are served from
+	publicURL string
+}
+
+// NewFileStore returns a FileStore for bucket. endpoint may be empty to use
+// AWS, otherwise objects are addressed by path, i.e. for minio. publicURL may
+// be empty to serve images straight from the bucket
+func NewFileStore(endpoint, region, bucket, accessKey, secretKey, publicURL string) (*FileStore, error) {
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if publicURL == "" {
+		publicURL = fmt.Sprintf("%s/%s/", strings.TrimSuffix(endpoint, "/"), bucket)
+	}
+
+	return &FileStore{
+		client:    &http.Client{Timeout: 15 * time.Second},
+		endpoint:  u,
+		region:    region,
+		bucket:    bucket,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		publicURL: publicURL,
+	}, nil
+}
+
+func (fs *FileStore) Put(fileName string, contents []byte) (string, error) {
+	h := sha1.New()
+	_, err := h.Write(contents)
+	if err != nil {
+		return "", err
+	}
+	hash := base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+
+	contentType := http.DetectContentType(contents)
+
+	// only hash the file for now
+	fName := hash
+	switch contentType {
+	case "image/png":
+		fName += ".png"
+	case "image/jpeg":
+		fName += ".jpeg"
+	case "image/gif":
+		fName += ".gif"
+	case "image/webp":
+		fName += ".webp"
+	default:
+		return "", fmt.Errorf("unsupported image type: %s", contentType)
+	}
+
+	u := *fs.endpoint
+	u.Path = "/" + fs.bucket + "/" + fName
+
+	req, err := http.NewRequest(http.MethodPut, u.String(), bytes.NewReader(contents))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Cache-Control", "public, max-age=86400")
+
+	fs.sign(req, contents, time.Now().UTC())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	resp, err := fs.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("s3: put %s returned %d: %s", fName, resp.StatusCode, msg)
+	}
+
+	return fs.publicURL + fName, nil
+}
+
+// sign adds an AWS signature version 4 Authorization header to req
+// https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+func (fs *FileStore) sign(req *http.Request, payload []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	payloadHash := sha256Hex(payload)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + fs.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+fs.secretKey), date)
+	key = hmacSHA256(key, fs.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		fs.accessKey, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign))))
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
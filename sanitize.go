@@ -0,0 +1,153 @@
+package hydrocarbon
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/microcosm-cc/bluemonday"
+
+	"github.com/fortytw2/hydrocarbon/discollect"
+)
+
+var (
+	// images served from trackerHosts only exist to count readers
+	trackerHosts = map[string]bool{
+		"pixel.wp.com":             true,
+		"stats.wp.com":             true,
+		"feeds.feedburner.com":     true,
+		"www.google-analytics.com": true,
+		"pixel.quantserve.com":     true,
+		"sb.scorecardresearch.com": true,
+		"ad.doubleclick.net":       true,
+	}
+
+	// trackingParams are stripped from the query of every link
+	trackingParams = []string{"utm_source", "utm_medium", "utm_campaign", "utm_term", "utm_content", "fbclid", "gclid", "mc_cid", "mc_eid"}
+)
+
+// A Sanitizer cleans every scraped post body before it is stored, stripping
+// scripts, dangerous attributes, tracking pixels and tracking link parameters
+type Sanitizer struct {
+	base    *bluemonday.Policy
+	plugins map[string]*bluemonday.Policy
+}
+
+// NewSanitizer builds a Sanitizer, plugins with AllowHTML set are given their
+// own policy extending the base one
+func NewSanitizer(plugins ...*discollect.Plugin) *Sanitizer {
+	s := &Sanitizer{
+		base:    basePolicy(),
+		plugins: make(map[string]*bluemonday.Policy),
+	}
+
+	for _, p := range plugins {
+		if p.AllowHTML == nil {
+			continue
+		}
+
+		policy := basePolicy()
+		p.AllowHTML(policy)
+		s.plugins[p.Name] = policy
+	}
+
+	return s
+}
+
+func basePolicy() *bluemonday.Policy {
+	return bluemonday.UGCPolicy().
+		AddTargetBlankToFullyQualifiedLinks(true).
+		RequireNoFollowOnFullyQualifiedLinks(true)
+}
+
+// Sanitize cleans body with the policy of the given plugin
+func (s *Sanitizer) Sanitize(plugin, body string) string {
+	policy, ok := s.plugins[plugin]
+	if !ok {
+		policy = s.base
+	}
+
+	return stripTrackers(policy.Sanitize(body))
+}
+
+// stripTrackers removes tracking pixels and tracking link parameters, body is
+// only re-rendered if it contains either
+func stripTrackers(body string) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(body))
+	if err != nil {
+		return body
+	}
+
+	changed := false
+	doc.Find("img").Each(func(i int, sel *goquery.Selection) {
+		if isTrackingPixel(sel) {
+			sel.Remove()
+			changed = true
+		}
+	})
+
+	doc.Find("a[href]").Each(func(i int, sel *goquery.Selection) {
+		href, _ := sel.Attr("href")
+		if clean, ok := stripTrackingParams(href); ok {
+			sel.SetAttr("href", clean)
+			changed = true
+		}
+	})
+
+	if !changed {
+		return body
+	}
+
+	out, err := doc.Find("body").Html()
+	if err != nil {
+		return body
+	}
+
+	return out
+}
+
+func isTrackingPixel(sel *goquery.Selection) bool {
+	src, _ := sel.Attr("src")
+	if u, err := url.Parse(src); err == nil && trackerHosts[u.Hostname()] {
+		return true
+	}
+
+	width, _ := sel.Attr("width")
+	height, _ := sel.Attr("height")
+	w, err := strconv.Atoi(width)
+	if err != nil {
+		return false
+	}
+	h, err := strconv.Atoi(height)
+	if err != nil {
+		return false
+	}
+
+	return w <= 1 && h <= 1
+}
+
+// stripTrackingParams returns href without any trackingParams, and whether it
+// had any
+func stripTrackingParams(href string) (string, bool) {
+	u, err := url.Parse(href)
+	if err != nil || u.RawQuery == "" {
+		return href, false
+	}
+
+	q := u.Query()
+	found := false
+	for _, p := range trackingParams {
+		if _, ok := q[p]; ok {
+			q.Del(p)
+			found = true
+		}
+	}
+
+	if !found {
+		return href, false
+	}
+
+	u.RawQuery = q.Encode()
+	return u.String(), true
+}
@@ -0,0 +1,73 @@
+package hydrocarbon
+
+import (
+	"testing"
+
+	"github.com/microcosm-cc/bluemonday"
+
+	"github.com/fortytw2/hydrocarbon/discollect"
+)
+
+func TestSanitizer(t *testing.T) {
+	t.Parallel()
+
+	s := NewSanitizer(&discollect.Plugin{
+		Name: "aligned",
+		AllowHTML: func(p *bluemonday.Policy) {
+			p.AllowAttrs("align").OnElements("p")
+		},
+	})
+
+	var cases = []struct {
+		name   string
+		plugin string
+		body   string
+		out    string
+	}{
+		{
+			"untouched",
+			"rss",
+			`<p>Chapter one</p>`,
+			`<p>Chapter one</p>`,
+		},
+		{
+			"scripts",
+			"rss",
+			`<p onclick="steal()">Chapter one</p><script>steal()</script>`,
+			`<p>Chapter one</p>`,
+		},
+		{
+			"tracking-pixels",
+			"rss",
+			`<p>Chapter one</p><img src="https://example.com/p.gif" width="1" height="1"><img src="https://pixel.wp.com/g.gif">`,
+			`<p>Chapter one</p>`,
+		},
+		{
+			"tracking-params",
+			"rss",
+			`<a href="https://example.com/next?page=2&amp;utm_source=rss">next</a>`,
+			`<a href="https://example.com/next?page=2" rel="nofollow noopener" target="_blank">next</a>`,
+		},
+		{
+			"plugin-allowlist",
+			"aligned",
+			`<p align="center">* * *</p>`,
+			`<p align="center">* * *</p>`,
+		},
+		{
+			"other-plugins",
+			"rss",
+			`<p align="center">* * *</p>`,
+			`<p>* * *</p>`,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			out := s.Sanitize(tt.plugin, tt.body)
+			if out != tt.out {
+				t.Fatalf("expected %q, got %q", tt.out, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package hydrocarbon
+
+import (
+	"hash/fnv"
+	"html"
+	"math/bits"
+	"strings"
+	"unicode"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// simHashShingle is the number of consecutive words hashed together, so that
+// word order still matters for near-duplicate detection
+const simHashShingle = 3
+
+var stripPolicy = bluemonday.StrictPolicy()
+
+// SimHash returns a 64 bit locality sensitive hash of the title and body of a
+// post. Lightly edited copies of the same text hash to values that differ in
+// only a few bits, see HammingDistance
+func (p *Post) SimHash() uint64 {
+	words := normalizeWords(p.Title + " " + stripPolicy.Sanitize(p.Body))
+	if len(words) == 0 {
+		return 0
+	}
+
+	var weights [64]int
+	add := func(shingle []string) {
+		h := fnv.New64a()
+		// fnv never returns an error
+		_, _ = h.Write([]byte(strings.Join(shingle, " ")))
+		sum := h.Sum64()
+
+		for i := uint(0); i < 64; i++ {
+			if sum&(1<<i) != 0 {
+				weights[i]++
+			} else {
+				weights[i]--
+			}
+		}
+	}
+
+	if len(words) < simHashShingle {
+		add(words)
+	}
+	for i := 0; i+simHashShingle <= len(words); i++ {
+		add(words[i : i+simHashShingle])
+	}
+
+	var out uint64
+	for i, w := range weights {
+		if w > 0 {
+			out |= 1 << uint(i)
+		}
+	}
+
+	return out
+}
+
+// HammingDistance returns the number of bits that differ between two SimHashes
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// normalizeWords lowercases text and splits it into words, dropping
+// punctuation and entities so formatting changes do not affect the hash
+func normalizeWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(html.UnescapeString(s)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
@@ -0,0 +1,51 @@
+package hydrocarbon
+
+import "testing"
+
+func TestSimHash(t *testing.T) {
+	t.Parallel()
+
+	const announcement = `<p>We are excited to announce version 2.0 of the project, which brings a
+	new plugin system, faster scrapes, a redesigned settings page and dozens of
+	bug fixes contributed by the community over the last six months.</p>`
+
+	var cases = []struct {
+		name    string
+		a, b    *Post
+		similar bool
+	}{
+		{
+			"identical",
+			&Post{Title: "Release 2.0", Body: announcement},
+			&Post{Title: "Release 2.0", Body: announcement},
+			true,
+		},
+		{
+			"markup and case",
+			&Post{Title: "Release 2.0", Body: announcement},
+			&Post{Title: "RELEASE 2.0", Body: "<div><b>We are excited</b> to announce version 2.0 of the project, which brings a new plugin system, faster scrapes, a redesigned settings page and dozens of bug fixes contributed by the community over the last six months!</div>"},
+			true,
+		},
+		{
+			"light edit",
+			&Post{Title: "Release 2.0", Body: announcement},
+			&Post{Title: "Release 2.0", Body: announcement + "<p>Update: fixed a typo.</p>"},
+			true,
+		},
+		{
+			"different",
+			&Post{Title: "Release 2.0", Body: announcement},
+			&Post{Title: "Quarterly report", Body: "<p>Revenue grew eleven percent while operating costs were flat, driven mostly by new enterprise customers in europe and a reduction in hosting spend.</p>"},
+			false,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			d := HammingDistance(tt.a.SimHash(), tt.b.SimHash())
+			if similar := d <= 8; similar != tt.similar {
+				t.Errorf("expected similar=%t, got distance %d", tt.similar, d)
+			}
+		})
+	}
+}
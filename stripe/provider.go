@@ -0,0 +1,227 @@
+package stripe
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	stripego "github.com/stripe/stripe-go"
+	"github.com/stripe/stripe-go/client"
+	"github.com/stripe/stripe-go/webhook"
+
+	"github.com/fortytw2/hydrocarbon"
+)
+
+// Provider is a hydrocarbon.PaymentProvider backed by stripe
+type Provider struct {
+	key           string
+	webhookSecret string
+	sc            *client.API
+}
+
+// NewProvider returns a new Provider, webhookSecret is used to verify the
+// signatures of incoming webhooks
+func NewProvider(key, webhookSecret string) *Provider {
+	sc := &client.API{}
+	sc.Init(key, nil)
+
+	return &Provider{
+		key:           key,
+		webhookSecret: webhookSecret,
+		sc:            sc,
+	}
+}
+
+// CreateCustomer creates a stripe customer with the given card token
+func (p *Provider) CreateCustomer(ctx context.Context, email, source string) (string, error) {
+	params := &stripego.CustomerParams{
+		Email: &email,
+	}
+
+	err := params.SetSource(source)
+	if err != nil {
+		return "", err
+	}
+
+	c, err := p.sc.Customers.New(params)
+	if err != nil {
+		return "", err
+	}
+
+	return c.ID, nil
+}
+
+// Subscribe subscribes a customer to a stripe plan
+func (p *Provider) Subscribe(ctx context.Context, customerID, planID, coupon string) (string, error) {
+	sp := &stripego.SubscriptionParams{
+		Customer: &customerID,
+		Plan:     &planID,
+	}
+
+	if coupon != "" {
+		sp.Coupon = &coupon
+	}
+
+	s, err := p.sc.Subscriptions.New(sp)
+	if err != nil {
+		return "", err
+	}
+
+	return s.ID, nil
+}
+
+// Cancel cancels a subscription at the end of the period already paid for
+func (p *Provider) Cancel(ctx context.Context, subscriptionID string) error {
+	_, err := p.sc.Subscriptions.Update(subscriptionID, &stripego.SubscriptionParams{
+		CancelAtPeriodEnd: stripego.Bool(true),
+	})
+	return err
+}
+
+// WebhookHandler verifies stripe webhook signatures and translates the events
+// hydrocarbon cares about
+func (p *Provider) WebhookHandler(fn func(ctx context.Context, e *hydrocarbon.PaymentEvent) error) hydrocarbon.ErrorHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		payload, err := ioutil.ReadAll(io.LimitReader(r.Body, 1024*64))
+		if err != nil {
+			return err
+		}
+
+		e, err := webhook.ConstructEvent(payload, r.Header.Get("Stripe-Signature"), p.webhookSecret)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return errors.New("invalid webhook signature")
+		}
+
+		pe := &hydrocarbon.PaymentEvent{
+			CustomerID:     e.GetObjectValue("customer"),
+			SubscriptionID: e.GetObjectValue("id"),
+		}
+
+		switch e.Type {
+		case "customer.subscription.deleted":
+			pe.Type = hydrocarbon.PaymentSubscriptionEnded
+		case "customer.subscription.created", "customer.subscription.updated":
+			// past due subscriptions keep their plan while stripe retries
+			// the payment, until it gives up and cancels them
+			switch e.GetObjectValue("status") {
+			case "active", "trialing":
+				pe.Type = hydrocarbon.PaymentSubscriptionUpdated
+				pe.PlanID = e.GetObjectValue("plan", "id")
+			case "canceled", "unpaid", "incomplete_expired":
+				pe.Type = hydrocarbon.PaymentSubscriptionEnded
+			}
+		}
+
+		if pe.Type != "" {
+			err = fn(r.Context(), pe)
+			if err != nil {
+				// stripe retries events that are not answered with a 2xx
+				w.WriteHeader(http.StatusInternalServerError)
+				return err
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+}
+
+// ListInvoices returns every invoice sent to a customer
+func (p *Provider) ListInvoices(ctx context.Context, customerID string) ([]*hydrocarbon.Invoice, error) {
+	invoices := make([]*hydrocarbon.Invoice, 0)
+
+	iter := p.sc.Invoices.List(&stripego.InvoiceListParams{
+		Customer: &customerID,
+	})
+	for iter.Next() {
+		invoices = append(invoices, convertInvoice(iter.Invoice()))
+	}
+
+	return invoices, iter.Err()
+}
+
+// UpcomingInvoice returns the next invoice for a subscribed customer
+func (p *Provider) UpcomingInvoice(ctx context.Context, customerID string) (*hydrocarbon.Invoice, error) {
+	in, err := p.sc.Invoices.GetNext(&stripego.InvoiceParams{
+		Customer: &customerID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return convertInvoice(in), nil
+}
+
+// PortalURL creates a stripe customer portal session and returns its URL
+func (p *Provider) PortalURL(ctx context.Context, customerID, returnURL string) (string, error) {
+	// the vendored stripe-go predates the billing portal, so the endpoint is
+	// called through the raw backend
+	params := &stripego.Params{}
+	params.AddExtra("customer", customerID)
+	params.AddExtra("return_url", returnURL)
+
+	var session struct {
+		URL string `json:"url"`
+	}
+	err := stripego.GetBackend(stripego.APIBackend).Call(http.MethodPost, "/billing_portal/sessions", p.key, params, &session)
+	if err != nil {
+		return "", err
+	}
+
+	return session.URL, nil
+}
+
+// GetCoupon returns a coupon, if it is still valid
+func (p *Provider) GetCoupon(ctx context.Context, code string) (*hydrocarbon.Coupon, error) {
+	c, err := p.sc.Coupons.Get(code, nil)
+	if err != nil || !c.Valid {
+		return nil, errors.New("this code is not valid")
+	}
+
+	return &hydrocarbon.Coupon{
+		Code:             c.ID,
+		AmountOff:        c.AmountOff,
+		PercentOff:       c.PercentOff,
+		Currency:         string(c.Currency),
+		Duration:         string(c.Duration),
+		DurationInMonths: c.DurationInMonths,
+	}, nil
+}
+
+// ApplyCoupon applies a coupon to an existing subscription
+func (p *Provider) ApplyCoupon(ctx context.Context, subscriptionID, code string) error {
+	_, err := p.sc.Subscriptions.Update(subscriptionID, &stripego.SubscriptionParams{
+		Coupon: &code,
+	})
+	return err
+}
+
+// ChangePlan moves a subscription to another plan, stripe credits or charges
+// the difference for the rest of the period on the next invoice
+func (p *Provider) ChangePlan(ctx context.Context, subscriptionID, planID string) error {
+	_, err := p.sc.Subscriptions.Update(subscriptionID, &stripego.SubscriptionParams{
+		Plan:    &planID,
+		Prorate: stripego.Bool(true),
+	})
+	return err
+}
+
+func convertInvoice(in *stripego.Invoice) *hydrocarbon.Invoice {
+	return &hydrocarbon.Invoice{
+		ID:          in.ID,
+		Number:      in.Number,
+		CreatedAt:   time.Unix(in.Date, 0),
+		PeriodStart: time.Unix(in.PeriodStart, 0),
+		PeriodEnd:   time.Unix(in.PeriodEnd, 0),
+		AmountDue:   in.AmountDue,
+		AmountPaid:  in.AmountPaid,
+		Currency:    string(in.Currency),
+		Paid:        in.Paid,
+		URL:         in.HostedInvoiceURL,
+		PDFURL:      in.InvoicePDF,
+	}
+}
@@ -0,0 +1,661 @@
+package hydrocarbon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+const (
+	maxTransformSize = 4 * 1024
+	// a transform may take this many evaluation steps per post
+	maxTransformSteps = 10000
+	transformTimeout  = 50 * time.Millisecond
+	// values larger than this abort a transform, so repeated concatenation
+	// can not eat memory
+	maxTransformValue = 1024 * 1024
+	maxTransformTags  = 32
+)
+
+var (
+	errTransformLimit = errors.New("transform: exceeded its cpu limit")
+	errTransformSize  = errors.New("transform: value too large")
+
+	transformPolicy = bluemonday.UGCPolicy().AddTargetBlankToFullyQualifiedLinks(true)
+	textPolicy      = bluemonday.StrictPolicy()
+)
+
+// A FeedTransform is the script a user has set to run on a feed
+type FeedTransform struct {
+	FeedID    string    `json:"feed_id"`
+	Script    string    `json:"script"`
+	LastError string    `json:"last_error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// A Transform is a compiled, user-defined script run on every incoming post of
+// a feed. Scripts are a list of statements, one per line
+//
+//	# rewrite titles, strip sections and set tags
+//	set title = replace(title, "^Chapter \\d+: ", "")
+//	strip "(?s)<div class=\"ad\">.*?</div>"
+//	if author == "someone" and not title ~ "(?i)draft": tag "favourite"
+//
+// Statements are `set title|author|body = expr`, `strip "regexp"` which removes
+// matches from the body, and `tag expr`, each optionally guarded by `if cond:`.
+// Expressions are string literals, the fields title, author, body, url and
+// text (the body without html), joined with +, and the functions lower,
+// upper, trim and replace(s, "regexp", with). Conditions compare expressions
+// with ==, != and ~ (regexp match), combined with and, or, not and
+// parentheses. Regexps are RE2, so always run in linear time
+type Transform struct {
+	stmts []*tStmt
+}
+
+// CompileTransform parses a script, returning an error with its line number
+// if it is invalid
+func CompileTransform(src string) (*Transform, error) {
+	if len(src) > maxTransformSize {
+		return nil, fmt.Errorf("transform: scripts are limited to %d bytes", maxTransformSize)
+	}
+
+	t := &Transform{}
+	for i, line := range strings.Split(src, "\n") {
+		toks, err := tokenize(line)
+		if err != nil {
+			return nil, fmt.Errorf("transform: line %d: %s", i+1, err)
+		}
+
+		if len(toks) == 0 {
+			continue
+		}
+
+		p := &tParser{toks: toks}
+		stmt, err := p.stmt()
+		if err == nil && p.pos != len(p.toks) {
+			err = fmt.Errorf("unexpected %q", p.toks[p.pos].val)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("transform: line %d: %s", i+1, err)
+		}
+
+		t.stmts = append(t.stmts, stmt)
+	}
+
+	return t, nil
+}
+
+// Apply runs the transform on a copy of p, returning the copy. Transforms that
+// run out of steps or time return an error and no post
+func (t *Transform) Apply(ctx context.Context, p *Post) (*Post, error) {
+	ctx, cancel := context.WithTimeout(ctx, transformTimeout)
+	defer cancel()
+
+	out := *p
+	out.Tags = append([]string(nil), p.Tags...)
+
+	e := &tEnv{ctx: ctx, post: &out}
+	for _, s := range t.stmts {
+		err := s.exec(e)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if out.Body != p.Body {
+		out.Body = transformPolicy.Sanitize(out.Body)
+	}
+
+	return &out, nil
+}
+
+// tEnv is the state of a single run of a transform
+type tEnv struct {
+	ctx   context.Context
+	post  *Post
+	steps int
+
+	text      string
+	textValid bool
+}
+
+func (e *tEnv) step() error {
+	e.steps++
+	if e.steps > maxTransformSteps {
+		return errTransformLimit
+	}
+
+	if e.steps%100 == 0 && e.ctx.Err() != nil {
+		return errTransformLimit
+	}
+	return nil
+}
+
+func (e *tEnv) field(name string) string {
+	switch name {
+	case "title":
+		return e.post.Title
+	case "author":
+		return e.post.Author
+	case "body":
+		return e.post.Body
+	case "url":
+		return e.post.OriginalURL
+	case "text":
+		if !e.textValid {
+			e.text = textPolicy.Sanitize(e.post.Body)
+			e.textValid = true
+		}
+		return e.text
+	}
+	return ""
+}
+
+func (e *tEnv) set(name, val string) {
+	switch name {
+	case "title":
+		e.post.Title = val
+	case "author":
+		e.post.Author = val
+	case "body":
+		e.post.Body = val
+		e.textValid = false
+	}
+}
+
+type tStmt struct {
+	cond tCond
+
+	// one of set, strip or tag
+	action string
+	field  string
+	expr   tExpr
+	re     *regexp.Regexp
+}
+
+func (s *tStmt) exec(e *tEnv) error {
+	err := e.step()
+	if err != nil {
+		return err
+	}
+
+	if s.cond != nil {
+		ok, err := s.cond.test(e)
+		if err != nil || !ok {
+			return err
+		}
+	}
+
+	switch s.action {
+	case "set":
+		v, err := s.expr.eval(e)
+		if err != nil {
+			return err
+		}
+		e.set(s.field, v)
+	case "strip":
+		e.set("body", s.re.ReplaceAllString(e.post.Body, ""))
+	case "tag":
+		v, err := s.expr.eval(e)
+		if err != nil {
+			return err
+		}
+
+		v = strings.TrimSpace(v)
+		if v == "" || len(e.post.Tags) >= maxTransformTags {
+			return nil
+		}
+		for _, t := range e.post.Tags {
+			if t == v {
+				return nil
+			}
+		}
+		e.post.Tags = append(e.post.Tags, v)
+	}
+
+	return nil
+}
+
+type tExpr interface {
+	eval(e *tEnv) (string, error)
+}
+
+type tLit string
+
+func (l tLit) eval(e *tEnv) (string, error) {
+	return string(l), e.step()
+}
+
+type tField string
+
+func (f tField) eval(e *tEnv) (string, error) {
+	return e.field(string(f)), e.step()
+}
+
+type tConcat []tExpr
+
+func (c tConcat) eval(e *tEnv) (string, error) {
+	var sb strings.Builder
+	for _, x := range c {
+		v, err := x.eval(e)
+		if err != nil {
+			return "", err
+		}
+
+		if sb.Len()+len(v) > maxTransformValue {
+			return "", errTransformSize
+		}
+		sb.WriteString(v)
+	}
+	return sb.String(), nil
+}
+
+type tCall struct {
+	fn   string
+	args []tExpr
+	re   *regexp.Regexp
+}
+
+func (c *tCall) eval(e *tEnv) (string, error) {
+	err := e.step()
+	if err != nil {
+		return "", err
+	}
+
+	v, err := c.args[0].eval(e)
+	if err != nil {
+		return "", err
+	}
+
+	switch c.fn {
+	case "lower":
+		return strings.ToLower(v), nil
+	case "upper":
+		return strings.ToUpper(v), nil
+	case "trim":
+		return strings.TrimSpace(v), nil
+	case "replace":
+		with, err := c.args[2].eval(e)
+		if err != nil {
+			return "", err
+		}
+
+		out := c.re.ReplaceAllString(v, with)
+		if len(out) > maxTransformValue {
+			return "", errTransformSize
+		}
+		return out, nil
+	}
+
+	return "", fmt.Errorf("transform: unknown function %s", c.fn)
+}
+
+type tCond interface {
+	test(e *tEnv) (bool, error)
+}
+
+type tCmp struct {
+	op   string
+	l, r tExpr
+	re   *regexp.Regexp
+}
+
+func (c *tCmp) test(e *tEnv) (bool, error) {
+	l, err := c.l.eval(e)
+	if err != nil {
+		return false, err
+	}
+
+	if c.op == "~" {
+		return c.re.MatchString(l), e.step()
+	}
+
+	r, err := c.r.eval(e)
+	if err != nil {
+		return false, err
+	}
+
+	return (l == r) == (c.op == "=="), nil
+}
+
+type tLogic struct {
+	op   string
+	l, r tCond
+}
+
+func (c *tLogic) test(e *tEnv) (bool, error) {
+	err := e.step()
+	if err != nil {
+		return false, err
+	}
+
+	l, err := c.l.test(e)
+	if err != nil {
+		return false, err
+	}
+
+	switch c.op {
+	case "not":
+		return !l, nil
+	case "and":
+		if !l {
+			return false, nil
+		}
+	case "or":
+		if l {
+			return true, nil
+		}
+	}
+
+	return c.r.test(e)
+}
+
+type tToken struct {
+	// one of ident, string or op
+	kind string
+	val  string
+}
+
+func tokenize(line string) ([]tToken, error) {
+	var toks []tToken
+	for i := 0; i < len(line); {
+		c := line[i]
+		switch {
+		case c == '#':
+			return toks, nil
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(line) {
+				return nil, errors.New("unterminated string")
+			}
+
+			s, err := strconv.Unquote(line[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string %s", line[i:end+1])
+			}
+			toks = append(toks, tToken{"string", s})
+			i = end + 1
+		case c == '=' || c == '!':
+			if i+1 < len(line) && line[i+1] == '=' {
+				toks = append(toks, tToken{"op", line[i : i+2]})
+				i += 2
+			} else if c == '=' {
+				toks = append(toks, tToken{"op", "="})
+				i++
+			} else {
+				return nil, errors.New("unexpected !")
+			}
+		case strings.IndexByte("~+(),:", c) >= 0:
+			toks = append(toks, tToken{"op", string(c)})
+			i++
+		case unicode.IsLetter(rune(c)) || c == '_':
+			end := i
+			for end < len(line) && (unicode.IsLetter(rune(line[end])) || unicode.IsDigit(rune(line[end])) || line[end] == '_') {
+				end++
+			}
+			toks = append(toks, tToken{"ident", line[i:end]})
+			i = end
+		default:
+			return nil, fmt.Errorf("unexpected %q", c)
+		}
+	}
+
+	return toks, nil
+}
+
+type tParser struct {
+	toks []tToken
+	pos  int
+}
+
+func (p *tParser) peek() tToken {
+	if p.pos >= len(p.toks) {
+		return tToken{}
+	}
+	return p.toks[p.pos]
+}
+
+func (p *tParser) accept(kind, val string) bool {
+	t := p.peek()
+	if t.kind == kind && t.val == val {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *tParser) expect(kind, val string) error {
+	if !p.accept(kind, val) {
+		return fmt.Errorf("expected %s", val)
+	}
+	return nil
+}
+
+func (p *tParser) regexp() (*regexp.Regexp, error) {
+	t := p.peek()
+	if t.kind != "string" {
+		return nil, errors.New("expected a regexp string")
+	}
+	p.pos++
+
+	return regexp.Compile(t.val)
+}
+
+func (p *tParser) stmt() (*tStmt, error) {
+	s := &tStmt{}
+
+	if p.accept("ident", "if") {
+		cond, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+
+		err = p.expect("op", ":")
+		if err != nil {
+			return nil, err
+		}
+		s.cond = cond
+	}
+
+	t := p.peek()
+	p.pos++
+
+	var err error
+	switch {
+	case t.kind == "ident" && t.val == "set":
+		f := p.peek()
+		if f.kind != "ident" || (f.val != "title" && f.val != "author" && f.val != "body") {
+			return nil, errors.New("only title, author and body can be set")
+		}
+		p.pos++
+
+		err = p.expect("op", "=")
+		if err != nil {
+			return nil, err
+		}
+
+		s.action, s.field = "set", f.val
+		s.expr, err = p.expr()
+	case t.kind == "ident" && t.val == "strip":
+		s.action = "strip"
+		s.re, err = p.regexp()
+	case t.kind == "ident" && t.val == "tag":
+		s.action = "tag"
+		s.expr, err = p.expr()
+	default:
+		return nil, errors.New("expected set, strip or tag")
+	}
+
+	return s, err
+}
+
+func (p *tParser) or() (tCond, error) {
+	l, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("ident", "or") {
+		r, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l = &tLogic{op: "or", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *tParser) and() (tCond, error) {
+	l, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("ident", "and") {
+		r, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l = &tLogic{op: "and", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *tParser) unary() (tCond, error) {
+	if p.accept("ident", "not") {
+		c, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &tLogic{op: "not", l: c}, nil
+	}
+
+	// expressions never start with a parenthesis, so this is always grouping
+	if p.accept("op", "(") {
+		c, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return c, p.expect("op", ")")
+	}
+
+	l, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.accept("op", "~"):
+		re, err := p.regexp()
+		if err != nil {
+			return nil, err
+		}
+		return &tCmp{op: "~", l: l, re: re}, nil
+	case p.accept("op", "=="):
+		r, err := p.expr()
+		return &tCmp{op: "==", l: l, r: r}, err
+	case p.accept("op", "!="):
+		r, err := p.expr()
+		return &tCmp{op: "!=", l: l, r: r}, err
+	}
+
+	return nil, errors.New("expected ==, != or ~")
+}
+
+func (p *tParser) expr() (tExpr, error) {
+	first, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+
+	c := tConcat{first}
+	for p.accept("op", "+") {
+		t, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		c = append(c, t)
+	}
+
+	if len(c) == 1 {
+		return first, nil
+	}
+	return c, nil
+}
+
+func (p *tParser) term() (tExpr, error) {
+	t := p.peek()
+	p.pos++
+
+	switch t.kind {
+	case "string":
+		return tLit(t.val), nil
+	case "ident":
+		switch t.val {
+		case "title", "author", "body", "url", "text":
+			return tField(t.val), nil
+		case "lower", "upper", "trim", "replace":
+			return p.call(t.val)
+		}
+		return nil, fmt.Errorf("unknown name %s", t.val)
+	}
+
+	return nil, errors.New("expected a value")
+}
+
+func (p *tParser) call(fn string) (tExpr, error) {
+	err := p.expect("op", "(")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &tCall{fn: fn}
+
+	arg, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	c.args = append(c.args, arg)
+
+	if fn == "replace" {
+		err = p.expect("op", ",")
+		if err != nil {
+			return nil, err
+		}
+
+		c.re, err = p.regexp()
+		if err != nil {
+			return nil, err
+		}
+		// keep args lined up with their position in the call
+		c.args = append(c.args, nil)
+
+		err = p.expect("op", ",")
+		if err != nil {
+			return nil, err
+		}
+
+		with, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		c.args = append(c.args, with)
+	}
+
+	return c, p.expect("op", ")")
+}
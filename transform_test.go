@@ -0,0 +1,95 @@
+package hydrocarbon
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTransform(t *testing.T) {
+	t.Parallel()
+
+	post := &Post{
+		Title:       "Chapter 12: The Return",
+		Author:      "someone",
+		Body:        `<p>Previously on...</p><p>The story continues.</p>`,
+		OriginalURL: "https://example.com/story/12",
+	}
+
+	var cases = []struct {
+		name   string
+		script string
+		title  string
+		body   string
+		tags   []string
+		err    string
+	}{
+		{
+			"rewrite title",
+			`set title = replace(title, "^Chapter ([0-9]+): ", "#$1 ")`,
+			"#12 The Return",
+			post.Body,
+			nil,
+			"",
+		},
+		{
+			"strip section",
+			`strip "<p>Previously on[^<]*</p>"`,
+			post.Title,
+			"<p>The story continues.</p>",
+			nil,
+			"",
+		},
+		{
+			"conditional tags",
+			"if url ~ \"/story/\" and not author == \"nobody\": tag \"fiction\"\nif title == \"x\": tag \"never\"\ntag lower(author)",
+			post.Title,
+			post.Body,
+			[]string{"fiction", "someone"},
+			"",
+		},
+		{
+			"parse error",
+			"tag \"ok\"\nset url = \"nope\"",
+			"",
+			"",
+			nil,
+			"transform: line 2: only title, author and body can be set",
+		},
+		{
+			"value limit",
+			strings.Repeat("set body = body + body\n", 24),
+			"",
+			"",
+			nil,
+			errTransformSize.Error(),
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, err := CompileTransform(tt.script)
+			if err == nil {
+				var out *Post
+				out, err = tr.Apply(context.Background(), post)
+				if err == nil {
+					if out.Title != tt.title || out.Body != tt.body || !reflect.DeepEqual(out.Tags, tt.tags) {
+						t.Errorf("unexpected output %q %q %v", out.Title, out.Body, out.Tags)
+					}
+				}
+			}
+
+			if tt.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.err != "" && (err == nil || err.Error() != tt.err) {
+				t.Fatalf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+
+	if post.Title != "Chapter 12: The Return" {
+		t.Error("transform modified its input")
+	}
+}
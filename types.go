@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"math"
 	"time"
 )
 
@@ -14,6 +15,13 @@ type Folder struct {
 	Feeds []*Feed `json:"feeds"`
 }
 
+// Feed statuses, pending feeds have not been resolved to a plugin yet
+const (
+	FeedPending = "pending"
+	FeedActive  = "active"
+	FeedFailed  = "failed"
+)
+
 // A Feed is a collection of posts
 type Feed struct {
 	ID        string    `json:"id"`
@@ -22,6 +30,10 @@ type Feed struct {
 	Title     string    `json:"title"`
 	Plugin    string    `json:"plugin"`
 	BaseURL   string    `json:"base_url"`
+	Status    string    `json:"status,omitempty"`
+
+	// ExternalID is the ID of the feed on the origin site, if it has one
+	ExternalID string `json:"external_id,omitempty"`
 
 	Unread int `json:"unread"`
 
@@ -39,20 +51,55 @@ type Post struct {
 	OriginalURL string `json:"original_url"`
 	URL         string `json:"url"`
 
+	// ExternalID is set by plugins to the ID of the post on the origin site.
+	// Posts are matched on it before their url, so a post keeps its ID when
+	// the site changes its url scheme
+	ExternalID string `json:"external_id,omitempty"`
+
 	Title  string `json:"title"`
 	Author string `json:"author"`
 	Body   string `json:"body"`
 
+	// License identifies the terms the post is published under, usually a URL
+	// to a creative commons license, and Attribution is the copyright line
+	License     string `json:"license,omitempty"`
+	Attribution string `json:"attribution,omitempty"`
+
 	Read bool `json:"read"`
+	// Starred posts are never pruned, whatever the retention policy
+	Starred bool `json:"starred"`
+
+	// Backfilled posts were imported from an archive of the feed rather
+	// than scraped
+	Backfilled bool `json:"backfilled,omitempty"`
+
+	// Sources lists the other feeds a near-duplicate of this post was seen in
+	Sources []*PostSource `json:"sources,omitempty"`
+
+	// Tags are set by the users transform for the feed, if they have one
+	Tags []string `json:"tags,omitempty"`
 
 	Extra map[string]interface{} `json:"extra"`
 }
 
+// A PostSource is somewhere else a post was published
+type PostSource struct {
+	FeedID    string    `json:"feed_id"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 // ContentHash returns the stable hex encoded SHA256 of a post
 func (p *Post) ContentHash() string {
 	h := sha256.New()
 
-	_, err := h.Write([]byte(fmt.Sprintf("%s:%s:%s", p.Title, p.Author, p.Body)))
+	content := fmt.Sprintf("%s:%s:%s", p.Title, p.Author, p.Body)
+	// only hashed when set, so the hash of unlicensed posts is unchanged
+	if p.License != "" || p.Attribution != "" {
+		content += fmt.Sprintf(":%s:%s", p.License, p.Attribution)
+	}
+
+	_, err := h.Write([]byte(content))
 	if err != nil {
 		// pretty certain this cannot error
 		panic(err)
@@ -61,10 +108,126 @@ func (p *Post) ContentHash() string {
 	return hex.EncodeToString(h.Sum(nil))
 }
 
+// An Announcement is a message from the instance operators to every user
+type Announcement struct {
+	ID        string     `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	Title     string     `json:"title"`
+	Body      string     `json:"body"`
+	StartsAt  time.Time  `json:"starts_at"`
+	EndsAt    *time.Time `json:"ends_at,omitempty"`
+}
+
+// A Plan describes the limits placed on a user
+type Plan struct {
+	Name              string        `json:"name"`
+	MaxFeeds          int           `json:"max_feeds"`
+	MaxScrapes        int           `json:"max_scrapes"`
+	MinScrapeInterval time.Duration `json:"min_scrape_interval"`
+}
+
+// UnlimitedPlan is the plan of every user while billing is disabled, as when
+// self hosting, which limits nothing
+var UnlimitedPlan = Plan{
+	Name:       "unlimited",
+	MaxFeeds:   math.MaxInt32,
+	MaxScrapes: math.MaxInt32,
+}
+
+// PlanUsage is how much of their Plan a user is currently using, scrapes and
+// tasks are counted from the start of the current billing period
+type PlanUsage struct {
+	Plan        *Plan     `json:"plan"`
+	Feeds       int       `json:"feeds"`
+	PeriodStart time.Time `json:"period_start"`
+	Scrapes     int       `json:"scrapes"`
+	Tasks       int       `json:"tasks"`
+}
+
+// BillingStatus describes whether a user is trialing, subscribed, or limited
+// to read-only access
+type BillingStatus struct {
+	TrialEndsAt time.Time `json:"trial_ends_at"`
+	Subscribed  bool      `json:"subscribed"`
+}
+
+// Trialing returns true if the user is still within their trial period
+func (bs *BillingStatus) Trialing() bool {
+	return time.Now().Before(bs.TrialEndsAt)
+}
+
+// ReadOnly returns true once the trial has expired without a subscription
+func (bs *BillingStatus) ReadOnly() bool {
+	return !bs.Subscribed && !bs.Trialing()
+}
+
+// An Invoice is a single bill sent to a user
+type Invoice struct {
+	ID          string    `json:"id"`
+	Number      string    `json:"number"`
+	CreatedAt   time.Time `json:"created_at"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	AmountDue   int64     `json:"amount_due"`
+	AmountPaid  int64     `json:"amount_paid"`
+	Currency    string    `json:"currency"`
+	Paid        bool      `json:"paid"`
+	URL         string    `json:"url,omitempty"`
+	PDFURL      string    `json:"pdf_url,omitempty"`
+}
+
+// A Coupon is a discount applied to a subscription
+type Coupon struct {
+	Code             string  `json:"code"`
+	AmountOff        int64   `json:"amount_off,omitempty"`
+	PercentOff       float64 `json:"percent_off,omitempty"`
+	Currency         string  `json:"currency,omitempty"`
+	Duration         string  `json:"duration"`
+	DurationInMonths int64   `json:"duration_in_months,omitempty"`
+}
+
+// TableStats describe the size and health of a single database table
+type TableStats struct {
+	Name                 string     `json:"name"`
+	Size                 int64      `json:"size"`
+	LiveRows             int64      `json:"live_rows"`
+	DeadRows             int64      `json:"dead_rows"`
+	ModifiedSinceAnalyze int64      `json:"modified_since_analyze"`
+	BloatRatio           float64    `json:"bloat_ratio"`
+	EstimatedBloat       int64      `json:"estimated_bloat"`
+	LastAnalyzedAt       *time.Time `json:"last_analyzed_at,omitempty"`
+	LastVacuumedAt       *time.Time `json:"last_vacuumed_at,omitempty"`
+}
+
+// A Backup is a single run of the backup command of an instance
+type Backup struct {
+	ID         string     `json:"id"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// State is one of running, ok or failed. Backups are only ok once they
+	// have been verified, or once taken when there is no verify command
+	State string `json:"state"`
+	// Location is the last line the backup command printed, such as the path
+	// it wrote the dump to
+	Location   string     `json:"location,omitempty"`
+	Size       int64      `json:"size,omitempty"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// PruneStats counts the posts deleted by the retention policy on a single day
+type PruneStats struct {
+	Day   time.Time `json:"day"`
+	Posts int64     `json:"posts"`
+}
+
 // A Session is a session
 type Session struct {
-	CreatedAt time.Time `json:"created_at"`
-	UserAgent string    `json:"user_agent"`
-	IP        string    `json:"ip"`
-	Active    bool      `json:"active"`
+	ID         string     `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	Active     bool       `json:"active"`
+	APICalls   int64      `json:"api_calls"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
 }
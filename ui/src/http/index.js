@@ -61,7 +61,7 @@ export const listFolders = ({ apiKey }) => {
       if (json.status === "error") {
         throw json.error;
       }
-      return json.data;
+      return json.data.folders;
     });
 };
 
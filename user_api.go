@@ -7,11 +7,6 @@ import (
 	"net"
 	"net/http"
 	"strings"
-
-	stripe "github.com/stripe/stripe-go"
-	"github.com/stripe/stripe-go/client"
-	"github.com/stripe/stripe-go/customer"
-	"github.com/stripe/stripe-go/sub"
 )
 
 // A UserStore is an interface used to seperate the UserAPI from knowledge of the
@@ -21,7 +16,16 @@ type UserStore interface {
 	VerifyKey(ctx context.Context, key string) error
 
 	CreateOrGetUser(ctx context.Context, email string) (string, bool, error)
-	SetStripeIDs(ctx context.Context, userID, customerID, subscriptionID string) error
+	// SetStripeIDs records the subscription of a user, moving them to the plan
+	// billed as planID
+	SetStripeIDs(ctx context.Context, userID, customerID, subscriptionID, planID string) error
+
+	// RecordCouponRedemption records that the user has redeemed the code, it
+	// returns false if they already had
+	RecordCouponRedemption(ctx context.Context, userID, code string) (bool, error)
+	// DeleteCouponRedemption forgets a redemption whose coupon could not be
+	// applied
+	DeleteCouponRedemption(ctx context.Context, userID, code string) error
 
 	CreateLoginToken(ctx context.Context, userID, userAgent, ip string) (string, error)
 	ActivateLoginToken(ctx context.Context, token string) (string, error)
@@ -35,29 +39,24 @@ type UserStore interface {
 type UserAPI struct {
 	emailVerify     bool
 	paymentRequired bool
-	stripePlanID    string
-	sc              *client.API
+	planID          string
+	pp              PaymentProvider
 	s               UserStore
 	m               Mailer
 	ks              *KeySigner
 }
 
-// NewUserAPI sets up a new UserAPI used for user/session management
-func NewUserAPI(s UserStore, ks *KeySigner, m Mailer, stripePlanID, stripeKey string, paymentRequired bool) *UserAPI {
-	var c *client.API
-	if paymentRequired {
-		c = &client.API{}
-		c.Init(stripeKey, nil)
-	}
-
+// NewUserAPI sets up a new UserAPI used for user/session management, payment
+// is only required if pp is not nil
+func NewUserAPI(s UserStore, ks *KeySigner, m Mailer, pp PaymentProvider, planID string) *UserAPI {
 	return &UserAPI{
 		emailVerify:     true,
 		s:               s,
 		ks:              ks,
 		m:               m,
-		sc:              c,
-		stripePlanID:    stripePlanID,
-		paymentRequired: paymentRequired,
+		pp:              pp,
+		planID:          planID,
+		paymentRequired: pp != nil,
 	}
 }
 
@@ -80,15 +79,13 @@ func (ua *UserAPI) RequestToken(w http.ResponseWriter, r *http.Request) error {
 		return errors.New("invalid email")
 	}
 
-	userID, paid, err := ua.s.CreateOrGetUser(r.Context(), registerData.Email)
+	// users without a subscription may still login, once their trial expires
+	// they are limited to read-only access by the BillingAPI
+	userID, _, err := ua.s.CreateOrGetUser(r.Context(), registerData.Email)
 	if err != nil {
 		return err
 	}
 
-	if ua.paymentRequired && !paid {
-		return errors.New("payment is required")
-	}
-
 	lt, err := ua.s.CreateLoginToken(r.Context(), userID, r.UserAgent(), GetRemoteIP(r))
 	if err != nil {
 		return err
@@ -124,24 +121,24 @@ func (ua *UserAPI) VerifyKey(w http.ResponseWriter, r *http.Request) error {
 	return writeSuccess(w, "token currently valid")
 }
 
-// CreatePayment sets up the initial stripe stuff for a user
+// CreatePayment sets up the initial customer and subscription for a user
 func (ua *UserAPI) CreatePayment(w http.ResponseWriter, r *http.Request) error {
 	if !ua.paymentRequired {
-		return errors.New("payments are not enabled on this instance")
+		return errPaymentsDisabled
 	}
 
-	var stripeData struct {
+	var paymentData struct {
 		Email  string `json:"email"`
 		Coupon string `json:"coupon"`
 		Token  string `json:"token"`
 	}
 
-	err := limitDecoder(r, &stripeData)
+	err := limitDecoder(r, &paymentData)
 	if err != nil {
 		return err
 	}
 
-	userID, paid, err := ua.s.CreateOrGetUser(r.Context(), stripeData.Email)
+	userID, paid, err := ua.s.CreateOrGetUser(r.Context(), paymentData.Email)
 	if err != nil {
 		return err
 	}
@@ -150,39 +147,61 @@ func (ua *UserAPI) CreatePayment(w http.ResponseWriter, r *http.Request) error {
 		return errors.New("subscription already exists")
 	}
 
-	params := &stripe.CustomerParams{
-		Email: &stripeData.Email,
+	code := strings.TrimSpace(paymentData.Coupon)
+	if code != "" {
+		cp, ok := ua.pp.(CouponProvider)
+		if !ok {
+			return ErrUnsupportedPayment
+		}
+
+		_, err = cp.GetCoupon(r.Context(), code)
+		if err != nil {
+			return err
+		}
+
+		// recorded before it is used, so requests made at once can not both
+		// redeem the code
+		recorded, err := ua.s.RecordCouponRedemption(r.Context(), userID, code)
+		if err != nil {
+			return err
+		}
+
+		if !recorded {
+			return errCouponRedeemed
+		}
 	}
-	err = params.SetSource(stripeData.Token)
+
+	customerID, subID, err := ua.subscribe(r.Context(), paymentData.Email, paymentData.Token, code)
 	if err != nil {
+		if code != "" {
+			releaseCoupon(r.Context(), ua.s, userID, code)
+		}
 		return err
 	}
 
-	customer, err := customer.New(params)
+	err = ua.s.SetStripeIDs(r.Context(), userID, customerID, subID, ua.planID)
 	if err != nil {
 		return err
 	}
 
-	sp := &stripe.SubscriptionParams{
-		Customer: &customer.ID,
-		Plan:     &ua.stripePlanID,
-	}
-
-	if stripeData.Coupon != "" {
-		sp.Coupon = &stripeData.Coupon
-	}
+	return writeSuccess(w, "subscription created")
+}
 
-	s, err := sub.New(sp)
+// subscribe creates a customer paying with the card token and subscribes them
+// to the plan, with the coupon code if there is one. It returns the IDs of the
+// customer and subscription
+func (ua *UserAPI) subscribe(ctx context.Context, email, token, code string) (string, string, error) {
+	customerID, err := ua.pp.CreateCustomer(ctx, email, token)
 	if err != nil {
-		return err
+		return "", "", err
 	}
 
-	err = ua.s.SetStripeIDs(r.Context(), userID, customer.ID, s.ID)
+	subID, err := ua.pp.Subscribe(ctx, customerID, ua.planID, code)
 	if err != nil {
-		return err
+		return "", "", err
 	}
 
-	return writeSuccess(w, "stripe subscription created")
+	return customerID, subID, nil
 }
 
 // ListSessions writes out all of a users current / past sessions